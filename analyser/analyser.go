@@ -1,7 +1,9 @@
 package analyser
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -9,75 +11,510 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/ONSdigital/dp-map-renderer/colour"
 	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/palette"
 	"github.com/ONSdigital/go-ns/log"
-	"github.com/ThinkingLogic/jenks"
+	"github.com/paulmach/go.geojson"
 	"github.com/rubenv/topojson"
 )
 
+// outlierFenceFactor is the multiple of the interquartile range beyond the quartiles at which a value is considered an outlier.
+// This is much wider than Tukey's 1.5 (or 3 for 'far out' values) because choropleth data is often heavily skewed
+// - we only want to catch gross errors, such as a count entered into a column of percentages.
+const outlierFenceFactor = 6.0
+
+// maxDecimalPlaces is the maximum number of decimal places that will be suggested for displaying values
+const maxDecimalPlaces = 6
+
+// defaultMaxMessageDetails is the default maximum number of ids (or row numbers) listed in a single message
+const defaultMaxMessageDetails = 50
+
+var maxMessageDetails = defaultMaxMessageDetails
+
+// UseMaxMessageDetails sets the maximum number of ids (or row numbers) listed in a single message - the remainder are counted but not listed.
+func UseMaxMessageDetails(n int) {
+	maxMessageDetails = n
+}
+
+// errNoNumericValues is returned when no rows of the data have a numeric value to analyse
+var errNoNumericValues = errors.New("No CSV rows had a numeric value - could not read data")
+
+// defaultMaxRows is the default maximum number of rows accepted in a csv file
+const defaultMaxRows = 100000
+
+var maxRows = defaultMaxRows
+
+// UseMaxRows sets the maximum number of rows accepted in a csv file. A value of 0 (or less) removes the limit.
+func UseMaxRows(rows int) {
+	maxRows = rows
+}
+
+// colourBlindChecks is true if suggested palettes are checked for classes that are hard to tell apart with colour blindness
+var colourBlindChecks = false
+
+// UseColourBlindChecks sets whether the warnings of suggested palettes include the classes that are hard to tell apart with
+// red-green colour blindness (see colour.CheckPalette), as well as those that are hard to tell apart with normal vision
+func UseColourBlindChecks(enabled bool) {
+	colourBlindChecks = enabled
+}
+
 // AnalyseData analyses the given topology and csv file to confirm that they match, returning the csv converted to json
 func AnalyseData(request *models.AnalyseRequest) (*models.AnalyseResponse, error) {
+	return AnalyseDataWithContext(context.Background(), request)
+}
+
+// AnalyseDataWithContext is AnalyseData with a context that may be used to cancel the (potentially lengthy) calculation of breaks
+func AnalyseDataWithContext(ctx context.Context, request *models.AnalyseRequest) (*models.AnalyseResponse, error) {
+
+	var records recordReader
+	var err error
+	if len(request.XLSX) > 0 {
+		records, err = readXLSX(request.XLSX, request.SheetName, request.SheetIndex)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		records = newCSVReader(strings.NewReader(request.CSV))
+	}
+
+	ids, topology := getTopologyIDs(request.Geography)
+	normalisedIDs := normaliseIDs(ids, request.IDNormalisation)
 
-	parseInfo, err := parseData(request.CSV, request.IDIndex, request.ValueIndex, request.HasHeaderRow)
+	detected, records := detectIDColumn(records, request.ValueIndex, request.HasHeaderRow, ids, normalisedIDs, request.IDNormalisation)
+	idIndex := defaultIDIndex(request.ValueIndex)
+	if request.IDIndex != nil {
+		idIndex = *request.IDIndex
+	} else if detected.index >= 0 {
+		idIndex = detected.index
+	}
+
+	parseInfo, err := parseData(records, idIndex, request.ValueIndex, request.HasHeaderRow, request.MissingValueReasons)
 	if err != nil {
 		return nil, err
 	}
 
 	messages := parseInfo.messages
+	if request.IDIndex == nil && detected.index >= 0 {
+		messages = append(messages, &models.Message{Level: "info", Code: models.MessageCodeDetectedIDColumn, Count: detected.matched,
+			Text: fmt.Sprintf("No id_index was given - the IDs were read from column %d, which matched the topology in %d%% of the %d rows checked", detected.index, detected.percentage(), detected.scanned)})
+	}
 
-	ids := getTopologyIDs(request.Geography.Topojson, request.Geography.IDProperty)
-	unmatchedRows := []string{}
-	for _, row := range parseInfo.rows {
+	messages = append(messages, topology.messages(request.Geography.IDProperty)...)
+	topologySummary := topology.summary(request.Geography.IDProperty)
+	summariseGeography(request.Geography, topologySummary)
+	referenceRow := extractReferenceRow(parseInfo, request, ids, normalisedIDs)
+	unmatchedRows := &idList{}
+	normalisedRows := &idList{}
+	for i, row := range parseInfo.rows {
 		id := ids[row.ID]
+		if len(id) == 0 && normalisedIDs != nil {
+			id = normalisedIDs[request.IDNormalisation.Normalise(row.ID)]
+			if len(id) > 0 {
+				normalisedRows.add(row.ID)
+				row.ID = id
+			}
+		}
 		if len(id) == 0 {
-			unmatchedRows = append(unmatchedRows, row.ID)
+			unmatchedRows.addWithDetail(row.ID, fmt.Sprintf("row %d: %s", parseInfo.rowNumbers[i], row.ID))
 		}
 	}
-	if len(unmatchedRows) == len(parseInfo.rows) {
+	var suggestedMappings []*models.IDMapping
+	if unmatchedRows.count*2 > len(parseInfo.rows) {
+		suggestedMappings = suggestMappings(request.Geography, unmatchedIDs(parseInfo.rows, ids))
+	}
+	if unmatchedRows.count == len(parseInfo.rows) && len(suggestedMappings) == 0 {
+		if detected.index >= 0 && detected.index != idIndex {
+			return nil, fmt.Errorf("Data does not match Topology - IDs in the data do not match any IDs in the topology (using property '%s' to identify features in the topology) - but column %d matched %d%% of the rows checked, so may be the id_index", request.Geography.IDProperty, detected.index, detected.percentage())
+		}
 		return nil, fmt.Errorf("Data does not match Topology - IDs in the data do not match any IDs in the topology (using property '%s' to identify features in the topology)", request.Geography.IDProperty)
 	}
-	if len(unmatchedRows) > 0 {
-		messages = append(messages, &models.Message{Level: "error", Text: fmt.Sprintf("IDs of %d rows could not be found in the topology. Row IDs: [%v]", len(unmatchedRows), strings.Join(unmatchedRows, ", "))})
+	if unmatchedRows.count > 0 {
+		messages = append(messages, unmatchedRows.message("error", models.MessageCodeUnmatchedIDs, fmt.Sprintf("IDs of %d rows could not be found in the topology. Row IDs: %v", unmatchedRows.count, unmatchedRows)))
+	}
+	if len(suggestedMappings) > 0 {
+		messages = append(messages, &models.Message{Level: "info", Code: models.MessageCodeSuggestedMappings, Count: len(suggestedMappings), Text: fmt.Sprintf("%d unmatched rows have IDs resembling names in the topology (using property '%s') - suggested mappings to topology IDs are provided in suggested_mappings", len(suggestedMappings), request.Geography.NameProperty)})
+	}
+	if normalisedRows.count > 0 {
+		messages = append(messages, normalisedRows.message("info", models.MessageCodeNormalisedIDs, fmt.Sprintf("%d rows matched the topology only after normalising their IDs - these rows are returned with the ID used in the topology", normalisedRows.count)))
 	}
-
-	count := len(parseInfo.rows) - len(unmatchedRows)
-	messages = append(messages, &models.Message{Level: "info", Text: fmt.Sprintf("Successfully processed %d of %d rows", count, parseInfo.totalRows)})
 
 	values := extractValues(parseInfo.rows)
-	breaks := jenks.AllNaturalBreaks(values, 11)
+	if len(values) == 0 {
+		// the only numeric row was the reference row
+		return nil, errNoNumericValues
+	}
+
+	breakValues := values
+	lower, upper := outlierFences(values)
+	outliers := findOutliers(parseInfo.rows, lower, upper)
+	if outliers.count > 0 {
+		messages = append(messages, outliers.message("warn", models.MessageCodeOutliers, fmt.Sprintf("%d rows have outlying values (outside the range %g to %g) which may distort the breaks. Rows: %v", outliers.count, lower, upper, outliers)))
+		if request.ExcludeOutliers {
+			breakValues = excludeOutliers(values, lower, upper)
+		}
+	}
+
+	count := len(parseInfo.rows) - unmatchedRows.count
+	messages = append(messages, &models.Message{Level: "info", Code: models.MessageCodeProcessed, Count: count, Text: fmt.Sprintf("Successfully processed %d of %d rows", count, parseInfo.totalRows)})
+
+	classCountFactor := defaultClassCountFactor
+	if request.ClassCountWeighting != nil {
+		classCountFactor = *request.ClassCountWeighting
+	}
+	analysis, err := analyseBreaks(ctx, breakValues, classCountFactor)
+	if err != nil {
+		return nil, err
+	}
+	if analysis.sampled < len(breakValues) {
+		messages = append(messages, &models.Message{Level: "info", Code: models.MessageCodeSampled, Count: analysis.sampled, Text: fmt.Sprintf("Breaks were calculated from a sample of %d of the %d values", analysis.sampled, len(breakValues))})
+	}
+	breaks, classCount, fitMetrics := analysis.breaks, analysis.classCount, analysis.fitMetrics
+	messages = append(messages, emptyClassMessages(values, breaks, request.CandidateBreaks)...)
+
+	decimalPlaces, allIntegers := suggestDecimalPlaces(values, breaks)
+
+	var divergingBreaks []float64
+	if spansZero(values) {
+		divergingBreaks = divergingBreaksCentredOnZero(values, divergingClassCount(classCount, request.ClassCount))
+		messages = append(messages, &models.Message{Level: "info", Code: models.MessageCodeDivergingData, Text: "The data contains both negative and positive values - a diverging palette is recommended, using breaks centred on zero (diverging_breaks)"})
+	}
+
+	palettes, paletteMessages := suggestPalettes(values, classCount, request.ClassCount)
+	messages = append(messages, paletteMessages...)
+
+	statistics := calculateStatistics(values)
+	choropleths := suggestChoropleths(breaks, palettes, values[len(values)-1], classCount, request.ClassCount)
+	referenceLine, referenceMessage := suggestReferenceLine(request, referenceRow, statistics, decimalPlaces)
+	if referenceMessage != nil {
+		messages = append(messages, referenceMessage)
+	}
+	if referenceLine != nil {
+		for _, choropleth := range choropleths {
+			choropleth.ReferenceLines = []*models.ReferenceLine{{Value: referenceLine.Value, Text: referenceLine.Text}}
+		}
+	}
+
+	return &models.AnalyseResponse{Data: parseInfo.rows, Messages: messages, Breaks: breaks, MinValue: values[0], MaxValue: values[len(values)-1], BestFitClassCount: classCount,
+		SuggestedDecimalPlaces: decimalPlaces, AllIntegers: allIntegers, Palettes: palettes,
+		Statistics: statistics, DivergingBreaks: divergingBreaks,
+		Choropleths: choropleths, SuggestedMappings: suggestedMappings,
+		TopologySummary: topologySummary, FitMetrics: fitMetrics,
+		Histogram: calculateHistogram(values, histogramBins(request.HistogramBins)), ReferenceLine: referenceLine}, nil
+}
+
+// histogramBins returns the requested number of histogram bins, or the default if none was requested
+func histogramBins(requestedBins int) int {
+	if requestedBins > 0 {
+		return requestedBins
+	}
+	return defaultHistogramBins
+}
+
+// calculateHistogram counts the (sorted) values in the given number of equal-width bins between the minimum and maximum value.
+// Each bin includes its lower edge, and the last bin also includes the maximum value. If all values are equal there is a single bin.
+func calculateHistogram(values []float64, bins int) *models.Histogram {
+	min, max := values[0], values[len(values)-1]
+	if min == max {
+		return &models.Histogram{Edges: []float64{min, max}, Counts: []int{len(values)}}
+	}
+
+	width := (max - min) / float64(bins)
+	edges := make([]float64, bins+1)
+	for i := range edges {
+		edges[i] = min + (float64(i) * width)
+	}
+	edges[bins] = max // avoid rounding errors
+
+	counts := make([]int, bins)
+	for _, v := range values {
+		i := int((v - min) / width)
+		if i < 0 {
+			i = 0
+		} else if i >= bins {
+			i = bins - 1
+		}
+		counts[i]++
+	}
+	return &models.Histogram{Edges: edges, Counts: counts}
+}
+
+// unmatchedIDs returns the ids of rows that are not in the topology ids
+func unmatchedIDs(rows []*models.DataRow, ids map[string]string) []string {
+	unmatched := []string{}
+	for _, row := range rows {
+		if len(ids[row.ID]) == 0 {
+			unmatched = append(unmatched, row.ID)
+		}
+	}
+	return unmatched
+}
+
+// suggestChoropleths pairs the breaks for the best fit and requested class counts with the colours of the first suggested palette of that size
+func suggestChoropleths(breaks [][]float64, palettes []*models.PaletteSuggestion, upperBound float64, bestFitClassCount int, requestedClassCount int) []*models.Choropleth {
+	classCounts := []int{bestFitClassCount}
+	if requestedClassCount > 0 && requestedClassCount != bestFitClassCount {
+		classCounts = append(classCounts, requestedClassCount)
+	}
+
+	choropleths := []*models.Choropleth{}
+	for _, n := range classCounts {
+		lowerBounds := findBreaks(breaks, n)
+		colours := findPaletteColours(palettes, n)
+		if lowerBounds == nil || colours == nil {
+			continue
+		}
+		choroplethBreaks := make([]*models.ChoroplethBreak, n)
+		for i := range choroplethBreaks {
+			choroplethBreaks[i] = &models.ChoroplethBreak{LowerBound: lowerBounds[i], Colour: colours[i]}
+		}
+		choropleths = append(choropleths, &models.Choropleth{Breaks: choroplethBreaks, UpperBound: upperBound})
+	}
+	return choropleths
+}
+
+// findBreaks returns the breaks for the given number of classes, or nil if there are none
+func findBreaks(breaks [][]float64, classCount int) []float64 {
+	for _, b := range breaks {
+		if len(b) == classCount {
+			return b
+		}
+	}
+	return nil
+}
+
+// findPaletteColours returns the colours of the first palette with the given number of classes, or nil if there are none
+func findPaletteColours(palettes []*models.PaletteSuggestion, classCount int) []string {
+	for _, p := range palettes {
+		if p.ClassCount == classCount {
+			return p.Colours
+		}
+	}
+	return nil
+}
+
+// spansZero returns true if the (sorted) values include both negative and positive numbers
+func spansZero(values []float64) bool {
+	return values[0] < 0 && values[len(values)-1] > 0
+}
+
+// divergingClassCount returns the (even) number of classes to use for diverging breaks - the requested class count if provided, otherwise the best fit,
+// rounded down to an even number (but at least 2)
+func divergingClassCount(bestFitClassCount int, requestedClassCount int) int {
+	n := bestFitClassCount
+	if requestedClassCount > 0 {
+		n = requestedClassCount
+	}
+	n = n - (n % 2)
+	if n < 2 {
+		n = 2
+	}
+	return n
+}
+
+// divergingBreaksCentredOnZero returns a symmetric set of breaks (lower bounds) with classCount/2 equal-width classes either side of zero,
+// so that zero is always on a class boundary. The classes extend far enough to include the largest absolute value.
+func divergingBreaksCentredOnZero(values []float64, classCount int) []float64 {
+	perSide := classCount / 2
+	extent := math.Max(math.Abs(values[0]), math.Abs(values[len(values)-1]))
+	width := extent / float64(perSide)
+
+	breaks := make([]float64, classCount)
 	for i := range breaks {
-		breaks[i] = jenks.Round(breaks[i], values)
+		breaks[i] = float64(i-perSide) * width
+	}
+	breaks[perSide] = 0 // guard against floating point error
+	return breaks
+}
+
+// calculateStatistics calculates summary statistics for the given (sorted) values.
+// Mean and standard deviation are calculated in a single pass using Welford's algorithm.
+func calculateStatistics(values []float64) *models.Statistics {
+	mean, m2 := 0.0, 0.0
+	for i, v := range values {
+		delta := v - mean
+		mean += delta / float64(i+1)
+		m2 += delta * (v - mean)
+	}
+	return &models.Statistics{
+		Count:             len(values),
+		Mean:              mean,
+		Median:            quantile(values, 0.5),
+		StandardDeviation: math.Sqrt(m2 / float64(len(values))),
+		LowerQuartile:     quantile(values, 0.25),
+		UpperQuartile:     quantile(values, 0.75),
+		DistinctValues:    countDistinct(values),
+	}
+}
+
+// suggestDecimalPlaces returns the number of decimal places required to display the values and (rounded) breaks without loss of precision,
+// capped at maxDecimalPlaces, along with a flag indicating whether all values are integers.
+func suggestDecimalPlaces(values []float64, allBreaks [][]float64) (int, bool) {
+	places := 0
+	allIntegers := true
+	for _, v := range values {
+		p := decimalPlaces(v)
+		if p > 0 {
+			allIntegers = false
+		}
+		places = int(math.Max(float64(places), float64(p)))
+	}
+	// jenks.Round may leave a break with more precision than the data (e.g. 2.5 between data values 2 and 3)
+	for _, breaks := range allBreaks {
+		for _, b := range breaks {
+			places = int(math.Max(float64(places), float64(decimalPlaces(b))))
+		}
+	}
+	if places > maxDecimalPlaces {
+		places = maxDecimalPlaces
+	}
+	return places, allIntegers
+}
+
+// suggestPalettes returns the palettes that support the best fit class count and the requested class count (if any).
+// Diverging palettes are suggested first if the data spans zero, otherwise sequential palettes are first.
+// Each suggestion has warnings describing any of its classes that are hard to tell apart (see UseColourBlindChecks).
+// A message is returned for each class count that no palette of a type supports (e.g. sequential palettes have at most 9 classes).
+func suggestPalettes(values []float64, bestFitClassCount int, requestedClassCount int) ([]*models.PaletteSuggestion, []*models.Message) {
+	classCounts := []int{bestFitClassCount}
+	if requestedClassCount > 0 && requestedClassCount != bestFitClassCount {
+		classCounts = append(classCounts, requestedClassCount)
+	}
+
+	types := []string{palette.Sequential, palette.Diverging}
+	if spansZero(values) {
+		types = []string{palette.Diverging, palette.Sequential}
 	}
 
-	classCount := bestFitClassCount(values, breaks)
+	suggestions := []*models.PaletteSuggestion{}
+	messages := []*models.Message{}
+	for _, n := range classCounts {
+		for _, t := range types {
+			if max := palette.MaxClassCount(t); n > max {
+				messages = append(messages, &models.Message{Level: "info", Code: models.MessageCodeNoPalette,
+					Text: fmt.Sprintf("No %s palette supports %d classes - %s palettes have at most %d classes", t, n, t, max)})
+				continue
+			}
+			for _, p := range palette.All() {
+				if p.Type != t {
+					continue
+				}
+				colours, err := p.Colours(n)
+				if err != nil {
+					continue
+				}
+				suggestions = append(suggestions, &models.PaletteSuggestion{Name: p.Name, Type: p.Type, ClassCount: n, Colours: colours, ColourBlindSafe: p.ColourBlindSafe,
+					Warnings: colour.CheckPalette(colours, models.KeyForegrounds, colourBlindChecks)})
+			}
+		}
+	}
+	return suggestions, messages
+}
 
-	return &models.AnalyseResponse{Data: parseInfo.rows, Messages: messages, Breaks: breaks, MinValue: values[0], MaxValue: values[len(values)-1], BestFitClassCount: classCount}, nil
+// decimalPlaces returns the number of digits after the decimal point in the shortest representation of the value
+func decimalPlaces(value float64) int {
+	s := strconv.FormatFloat(value, 'f', -1, 64)
+	i := strings.Index(s, ".")
+	if i < 0 {
+		return 0
+	}
+	return len(s) - i - 1
 }
 
 // extractValues extracts and sorts the values in rows.
 func extractValues(rows []*models.DataRow) []float64 {
-	values := make([]float64, len(rows))
-	for i := range rows {
-		values[i] = rows[i].Value
+	values := make([]float64, 0, len(rows))
+	for _, row := range rows {
+		if !row.Missing {
+			values = append(values, row.Value)
+		}
 	}
 	sort.Float64s(values)
 	return values
 }
 
-// parseData parses the csv file into a slice of DataRows, returning it along with messages about the number of rows parsed and any failed rows.
-func parseData(csvSource string, idIndex int, valueIndex int, hasHeader bool) (*parseInfo, error) {
-	r := csv.NewReader(strings.NewReader(csvSource))
+// outlierFences returns the lower and upper values outside of which a value is considered to be an outlier. values must be sorted.
+func outlierFences(values []float64) (float64, float64) {
+	q1, q3 := quantile(values, 0.25), quantile(values, 0.75)
+	iqr := q3 - q1
+	return q1 - (iqr * outlierFenceFactor), q3 + (iqr * outlierFenceFactor)
+}
+
+// findOutliers returns a description ("id (value)") of each row whose value lies outside the given fences
+func findOutliers(rows []*models.DataRow, lower float64, upper float64) *idList {
+	outliers := &idList{}
+	for _, row := range rows {
+		if !row.Missing && (row.Value < lower || row.Value > upper) {
+			outliers.add(fmt.Sprintf("%s (%g)", row.ID, row.Value))
+		}
+	}
+	return outliers
+}
+
+// excludeOutliers returns a copy of the (sorted) values without those lying outside the given fences
+func excludeOutliers(values []float64, lower float64, upper float64) []float64 {
+	start := sort.SearchFloat64s(values, lower)
+	end := sort.Search(len(values), func(i int) bool { return values[i] > upper })
+	result := make([]float64, end-start)
+	copy(result, values[start:end])
+	return result
+}
+
+// quantile returns the value at the given quantile (0-1) of the sorted values, interpolating between values where necessary
+func quantile(values []float64, q float64) float64 {
+	pos := q * float64(len(values)-1)
+	i := int(pos)
+	if i >= len(values)-1 {
+		return values[len(values)-1]
+	}
+	return values[i] + ((values[i+1] - values[i]) * (pos - float64(i)))
+}
+
+// recordReader reads records (rows) one at a time, returning io.EOF when there are no more
+type recordReader interface {
+	Read() ([]string, error)
+	// RowNumber returns the 1-based row (or line) number in the source of the last record read
+	RowNumber() int
+}
+
+// csvRecordReader is a recordReader for csv files
+type csvRecordReader struct {
+	*csv.Reader
+}
+
+// newCSVReader returns a recordReader for the csv source
+func newCSVReader(csvSource io.Reader) *csvRecordReader {
+	r := csv.NewReader(csvSource)
+	r.ReuseRecord = true
 	r.FieldsPerRecord = -1 // allow variable count of fields per record
+	return &csvRecordReader{r}
+}
+
+func (r *csvRecordReader) RowNumber() int {
+	line, _ := r.FieldPos(0)
+	return line
+}
 
+// parseData parses the csv file (or spreadsheet) into a slice of DataRows, returning it along with messages about the number of rows parsed and any failed rows.
+// A row whose value is one of the keys of missingValueReasons is parsed as a Missing row, with the Reason it maps to.
+// Returns an error if the csv has more than maxRows rows (excluding any header).
+func parseData(r recordReader, idIndex int, valueIndex int, hasHeader bool, missingValueReasons map[string]string) (*parseInfo, error) {
 	if hasHeader {
-		r.Read()
+		for {
+			record, err := r.Read()
+			if err != nil || !isBlank(record) {
+				break
+			}
+		}
 	}
 
 	requiredColumns := int(math.Max(float64(idIndex), float64(valueIndex))) + 1
 
-	missingColumns := []int{}
-	missingValues := []string{}
+	missingColumns := &idList{}
+	missingValues := &idList{}
+	missingWithReason := &idList{}
 	rows := []*models.DataRow{}
+	rowNumbers := []int{}
 
 	i := 0
 	for {
@@ -85,88 +522,239 @@ func parseData(csvSource string, idIndex int, valueIndex int, hasHeader bool) (*
 		if err == io.EOF {
 			break
 		}
+		if err == nil && isBlank(record) {
+			continue
+		}
 		i++
+		if maxRows > 0 && i > maxRows {
+			return nil, fmt.Errorf("CSV has too many rows - the maximum is %d", maxRows)
+		}
 		if err != nil {
 			log.Error(err, log.Data{"_message": "Error reading CSV"})
 			return nil, fmt.Errorf("Error reading CSV: %v", err.Error())
 		}
+		rowNumber := r.RowNumber()
 		if len(record) < requiredColumns {
-			missingColumns = append(missingColumns, i)
+			missingColumns.addWithDetail(strconv.Itoa(rowNumber), fmt.Sprintf("row %d: %s", rowNumber, strings.Join(record, ",")))
 			continue
 		}
 		id := record[idIndex]
 		value, err := strconv.ParseFloat(record[valueIndex], 64)
+		if err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+			// NaN and Inf parse as floats, but cannot be shown on a map (or given breaks)
+			err = fmt.Errorf("Not a finite value: %v", record[valueIndex])
+		}
+		if reason, ok := missingValueReasons[strings.TrimSpace(record[valueIndex])]; err != nil && ok {
+			missingWithReason.addWithDetail(id, fmt.Sprintf("row %d: %s (%s)", rowNumber, id, reason))
+			rows = append(rows, &models.DataRow{ID: id, Missing: true, Reason: reason})
+			rowNumbers = append(rowNumbers, rowNumber)
+			continue
+		}
 		if err != nil {
-			missingValues = append(missingValues, id)
+			missingValues.addWithDetail(id, fmt.Sprintf("row %d: %s", rowNumber, id))
 			continue
 		}
 		rows = append(rows, &models.DataRow{ID: id, Value: value})
+		rowNumbers = append(rowNumbers, rowNumber)
 	}
-	if len(missingColumns) == i {
+	if missingColumns.count == i {
 		return nil, fmt.Errorf("All CSV rows had fewer than %d columns - could not read data", requiredColumns)
 	}
-	if len(missingValues) == i {
-		return nil, fmt.Errorf("No CSV rows had a numeric value - could not read data")
+	if len(rows) == missingWithReason.count {
+		return nil, errNoNumericValues
 	}
 
 	messages := []*models.Message{}
-	if len(missingColumns) > 0 {
-		rowNumbers := strings.Join(strings.Fields(fmt.Sprint(missingColumns)), ", ")
-		messages = append(messages, &models.Message{Level: "warn", Text: fmt.Sprintf("%d rows have missing columns and could not be parsed. Row numbers: %v", len(missingColumns), rowNumbers)})
+	if missingColumns.count > 0 {
+		messages = append(messages, missingColumns.message("warn", models.MessageCodeMissingColumns, fmt.Sprintf("%d rows have missing columns and could not be parsed. Row numbers: %v", missingColumns.count, missingColumns)))
+	}
+	if missingValues.count > 0 {
+		messages = append(messages, missingValues.message("warn", models.MessageCodeMissingValues, fmt.Sprintf("%d rows have missing (or non-numeric) values and could not be parsed. Row IDs: %v", missingValues.count, missingValues)))
+	}
+	if missingWithReason.count > 0 {
+		messages = append(messages, missingWithReason.message("info", models.MessageCodeMissingWithReason, fmt.Sprintf("%d rows have values marking them as missing - these rows are returned as missing, with the reason shown in place of their value. Row IDs: %v", missingWithReason.count, missingWithReason)))
+	}
+
+	return &parseInfo{rows: rows, rowNumbers: rowNumbers, messages: messages, totalRows: i}, nil
+}
+
+// isBlank returns true if every field in the record is empty or only whitespace
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if len(strings.TrimSpace(field)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// getTopologyIDs extracts the id from each object in the topology, using the given idProperty first, or the ID if no such property found.
+// Also returns a summary of the ids, including any duplicates.
+func getTopologyIDs(geography *models.Geography) (map[string]string, *topologyInfo) {
+	info := &topologyInfo{featureCounts: make(map[string]int), missingProperty: &idList{}, duplicates: &idList{}}
+	var m map[string]string
+	if geography.Geojson != nil {
+		m = getFeatureIDs(geography.Geojson.Features, geography.IDProperty, info)
+	} else {
+		names := []string{}
+		for k := range geography.Topojson.Objects {
+			names = append(names, k)
+		}
+		sort.Strings(names) // for consistent messages
+		o := []*topojson.Geometry{}
+		for _, k := range names {
+			o = append(o, geography.Topojson.Objects[k])
+		}
+		m = getGeographyIDs(o, geography.IDProperty, info)
+	}
+
+	ids := make([]string, 0, len(info.featureCounts))
+	for id, n := range info.featureCounts {
+		if n > 1 {
+			ids = append(ids, id)
+		}
 	}
-	if len(missingValues) > 0 {
-		messages = append(messages, &models.Message{Level: "warn", Text: fmt.Sprintf("%d rows have missing (or non-numeric) values and could not be parsed. Row IDs: [%v]", len(missingValues), strings.Join(missingValues, ", "))})
+	sort.Strings(ids)
+	for _, id := range ids {
+		info.duplicates.addWithDetail(id, fmt.Sprintf("%s (%d features)", id, info.featureCounts[id]))
 	}
+	return m, info
+}
+
+// topologyInfo summarises the ids of the features in a topology
+type topologyInfo struct {
+	featureCount    int
+	featureCounts   map[string]int // the number of features with each id
+	missingProperty *idList        // features without the id property
+	duplicates      *idList        // ids used by more than one feature
+}
 
-	return &parseInfo{rows: rows, messages: messages, totalRows: i}, nil
+// summary returns the summary of the topology for the response
+func (info *topologyInfo) summary(idProperty string) *models.TopologySummary {
+	return &models.TopologySummary{FeatureCount: info.featureCount, DistinctIDCount: len(info.featureCounts), IDProperty: idProperty}
 }
 
-// getTopologyIDs extracts the id from each object in the topology, using the given idProperty first, or the ID if no such property found
-func getTopologyIDs(topology *topojson.Topology, idProperty string) map[string]string {
-	o := []*topojson.Geometry{}
-	for _, v := range topology.Objects {
-		o = append(o, v)
+// messages returns warnings about duplicate ids, and features without the id property
+func (info *topologyInfo) messages(idProperty string) []*models.Message {
+	messages := []*models.Message{}
+	if info.duplicates.count > 0 {
+		messages = append(messages, info.duplicates.message("warn", models.MessageCodeDuplicateTopologyIDs, fmt.Sprintf("%d IDs are used by more than one feature in the topology (using property '%s'), so the count of matched features may be inaccurate. IDs: %v", info.duplicates.count, idProperty, info.duplicates)))
+	}
+	if info.missingProperty.count > 0 {
+		messages = append(messages, info.missingProperty.message("warn", models.MessageCodeMissingIDProperty, fmt.Sprintf("%d features in the topology do not have the property '%s' - their feature id has been used instead. Feature IDs: %v", info.missingProperty.count, idProperty, info.missingProperty)))
 	}
-	return getGeographyIDs(o, idProperty)
+	return messages
 }
 
-// getGeographyIDs extracts the id from each geometry, using the given idProperty first, or the ID if no such property found
-func getGeographyIDs(topologyObjects []*topojson.Geometry, idProperty string) map[string]string {
+// normaliseIDs returns a map of normalised id to topology id, or nil if no normalisation is required
+func normaliseIDs(ids map[string]string, normalisation *models.IDNormalisation) map[string]string {
+	if !normalisation.IsEnabled() {
+		return nil
+	}
+	m := make(map[string]string, len(ids))
+	for k, v := range ids {
+		m[normalisation.Normalise(k)] = v
+	}
+	return m
+}
+
+// getGeographyIDs extracts the id from each geometry, using the given idProperty first, or the ID if no such property found, counting the features in info
+func getGeographyIDs(topologyObjects []*topojson.Geometry, idProperty string, info *topologyInfo) map[string]string {
 	m := make(map[string]string)
 	for _, o := range topologyObjects {
 		if o.Type == "GeometryCollection" {
-			om := getGeographyIDs(o.Geometries, idProperty)
+			om := getGeographyIDs(o.Geometries, idProperty, info)
 			for k, v := range om {
 				m[k] = v
 			}
 		} else {
-			id, isString := o.Properties[idProperty].(string)
-			if isString && len(id) > 0 {
-				m[id] = id
-			} else {
-				m[o.ID] = o.ID
+			id, isValid := models.FormatID(o.Properties[idProperty])
+			if !isValid || len(id) == 0 {
+				id = o.ID
+				info.missingProperty.add(o.ID)
 			}
+			m[id] = id
+			info.featureCount++
+			info.featureCounts[id]++
+		}
+	}
+	return m
+}
+
+// getFeatureIDs is the equivalent of getGeographyIDs for geojson features
+func getFeatureIDs(features []*geojson.Feature, idProperty string, info *topologyInfo) map[string]string {
+	m := make(map[string]string)
+	for _, f := range features {
+		id, isValid := models.FormatID(f.Properties[idProperty])
+		if !isValid || len(id) == 0 {
+			id = geojsonFeatureID(f)
+			info.missingProperty.add(id)
 		}
+		m[id] = id
+		info.featureCount++
+		info.featureCounts[id]++
 	}
 	return m
 }
 
 // parseInfo contains information about the rows parsed from the csv
 type parseInfo struct {
-	rows      []*models.DataRow
-	messages  []*models.Message
-	totalRows int
+	rows       []*models.DataRow
+	rowNumbers []int // the source row number of each row
+	messages   []*models.Message
+	totalRows  int
+}
+
+// idList counts the ids (or row numbers) added to it, retaining only the first maxMessageDetails (with their details) for inclusion in a message
+type idList struct {
+	ids     []string
+	details []string
+	count   int
+}
+
+func (l *idList) add(id string) {
+	l.addWithDetail(id, id)
 }
 
-// bestFitClassCount tries to find the breaks that best fit the data in the fewest classes.
+// addWithDetail adds the id, with a more detailed description of it for the message details
+func (l *idList) addWithDetail(id string, detail string) {
+	if len(l.ids) < maxMessageDetails {
+		l.ids = append(l.ids, id)
+		l.details = append(l.details, detail)
+	}
+	l.count++
+}
+
+// String returns the retained ids in the form "[a, b, c]", or "[a, b, c] and N more" if some were not retained
+func (l *idList) String() string {
+	s := "[" + strings.Join(l.ids, ", ") + "]"
+	if l.count > len(l.ids) {
+		s += fmt.Sprintf(" and %d more", l.count-len(l.ids))
+	}
+	return s
+}
+
+// message returns a message with the given level, code and text, detailing the ids in the list
+func (l *idList) message(level string, code string, text string) *models.Message {
+	return &models.Message{Level: level, Text: text, Code: code, Count: l.count, Details: l.details, Truncated: l.count > len(l.ids)}
+}
+
+// defaultHistogramBins is the default number of bins in the histogram of values
+const defaultHistogramBins = 30
+
+// defaultClassCountFactor is the default weighting given to the number of classes (as opposed to the goodness of fit) when finding the best fit class count
+const defaultClassCountFactor = 0.2
+
+// bestFitClassCount tries to find the breaks that best fit the data in the fewest classes, where classCountFactor (0-1) is the weighting given to the number of classes.
+// Also returns the metrics used for each class count.
 // This is purely a best guess suggestion
-func bestFitClassCount(data []float64, allBreaks [][]float64) int {
+func bestFitClassCount(data []float64, allBreaks [][]float64, classCountFactor float64) (int, []*models.FitMetric) {
 
+	metrics := []*models.FitMetric{}
 	if len(allBreaks) == 0 {
-		return 0
+		return 0, metrics
 	}
 
-	const classCountFactor = 0.2
 	goodnessFactor := 1.0 - classCountFactor
 
 	maxClasses := float64(len(allBreaks[len(allBreaks)-1]))
@@ -176,13 +764,14 @@ func bestFitClassCount(data []float64, allBreaks [][]float64) int {
 		goodness := goodnessOfVarianceFit(data, breaks)
 		classFitness := 1.0 - (float64(len(breaks)) / maxClasses) // fewer classes are fitter
 		fitness := ((goodness * goodnessFactor) + (classFitness * classCountFactor)) / 2.0
+		metrics = append(metrics, &models.FitMetric{ClassCount: len(breaks), GoodnessOfVarianceFit: goodness, Fitness: fitness})
 		if fitness > bestFitness {
 			bestCount = len(breaks)
 			bestFitness = fitness
 		}
 	}
 
-	return bestCount
+	return bestCount, metrics
 }
 
 // goodnessOfVarianceFit returns a value indicating how well the given breaks fit the data,
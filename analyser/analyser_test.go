@@ -3,11 +3,20 @@ package analyser_test
 import (
 	"testing"
 
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
 
 	"github.com/ONSdigital/dp-map-renderer/analyser"
 	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/renderer"
 	"github.com/ONSdigital/dp-map-renderer/testdata"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -232,3 +241,1643 @@ func filterMessages(response *models.AnalyseResponse, level string) []*models.Me
 	}
 	return m
 }
+
+func TestAnalyseDataSuggestsDecimalPlaces(t *testing.T) {
+	Convey("AnalyseData should suggest 0 decimal places for integer data", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,1\nS12000023,2\nS12000027,30")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.SuggestedDecimalPlaces, ShouldEqual, 0)
+		So(result.AllIntegers, ShouldBeTrue)
+	})
+
+	Convey("AnalyseData should suggest 1 decimal place for data with one decimal place", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,1.5\nS12000023,2.1\nS12000027,30.0\nS12000033,12.7")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.SuggestedDecimalPlaces, ShouldEqual, 1)
+		So(result.AllIntegers, ShouldBeFalse)
+	})
+
+	Convey("AnalyseData should suggest the largest number of decimal places for data with mixed precision", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,1\nS12000023,2.25\nS12000027,30.1\nS12000033,12.125")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.SuggestedDecimalPlaces, ShouldEqual, 3)
+		So(result.AllIntegers, ShouldBeFalse)
+	})
+
+	Convey("AnalyseData should cap the number of decimal places suggested", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,1\nS12000023,2.123456789\nS12000027,30")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.SuggestedDecimalPlaces, ShouldEqual, 6)
+	})
+
+	Convey("AnalyseData should suggest 0 decimal places for the example request", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.SuggestedDecimalPlaces, ShouldEqual, 0)
+		So(result.AllIntegers, ShouldBeTrue)
+	})
+}
+
+// simpleAnalyseRequest returns the example analyse request (for its topology), replacing the csv with the given content (id, value - no header row)
+func simpleAnalyseRequest(t *testing.T, csv string) *models.AnalyseRequest {
+	reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+	request, err := models.CreateAnalyseRequest(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.CSV = csv
+	request.IDIndex = columnIndex(0)
+	request.ValueIndex = 1
+	request.HasHeaderRow = false
+	return request
+}
+
+// columnIndex returns a pointer to the index, for the IDIndex of a request
+func columnIndex(i int) *int {
+	return &i
+}
+
+func TestAnalyseDataSuggestsPalettes(t *testing.T) {
+	Convey("AnalyseData should suggest palettes sized to the best fit class count", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.Palettes), ShouldBeGreaterThan, 0)
+		for _, p := range result.Palettes {
+			So(p.ClassCount, ShouldEqual, result.BestFitClassCount)
+			So(len(p.Colours), ShouldEqual, p.ClassCount)
+		}
+		So(result.Palettes[0].Type, ShouldEqual, "sequential")
+	})
+
+	Convey("AnalyseData should suggest palettes sized to the requested class count as well as the best fit", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.ClassCount = 8
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		bestFit, requested := 0, 0
+		for _, p := range result.Palettes {
+			So(len(p.Colours), ShouldEqual, p.ClassCount)
+			if p.ClassCount == result.BestFitClassCount {
+				bestFit++
+			}
+			if p.ClassCount == 8 {
+				requested++
+			}
+		}
+		So(bestFit, ShouldBeGreaterThan, 0)
+		So(requested, ShouldBeGreaterThan, 0)
+		So(bestFit+requested, ShouldEqual, len(result.Palettes))
+	})
+
+	Convey("AnalyseData should report the class counts that no palette of a type supports", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.ClassCount = 10
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		requested := 0
+		for _, p := range result.Palettes {
+			if p.ClassCount == 10 {
+				So(p.Type, ShouldEqual, "diverging")
+				requested++
+			}
+		}
+		So(requested, ShouldBeGreaterThan, 0)
+		var noPalette []*models.Message
+		for _, m := range result.Messages {
+			if m.Code == models.MessageCodeNoPalette {
+				noPalette = append(noPalette, m)
+			}
+		}
+		So(noPalette, ShouldResemble, []*models.Message{{Level: "info", Code: "no_palette", Text: "No sequential palette supports 10 classes - sequential palettes have at most 9 classes"}})
+	})
+
+	Convey("AnalyseData should only warn about the palettes that are hard to tell apart with colour blindness when checking for it", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,-20\nS12000023,-5\nS12000027,0\nS12000033,10\nS12000034,30")
+		warned := func() []string {
+			result, err := analyser.AnalyseData(request)
+			So(err, ShouldBeNil)
+			var names []string
+			for _, p := range result.Palettes {
+				if len(p.Warnings) > 0 {
+					names = append(names, p.Name)
+				}
+			}
+			return names
+		}
+
+		So(warned(), ShouldBeEmpty)
+
+		analyser.UseColourBlindChecks(true)
+		defer analyser.UseColourBlindChecks(false)
+		So(warned(), ShouldResemble, []string{"RdYlGn"})
+	})
+
+	Convey("AnalyseData should suggest a diverging palette first when the data spans zero", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,-20\nS12000023,-5\nS12000027,0\nS12000033,10\nS12000034,30")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.Palettes), ShouldBeGreaterThan, 0)
+		So(result.Palettes[0].Type, ShouldEqual, "diverging")
+		So(len(result.Palettes[0].Colours), ShouldEqual, result.Palettes[0].ClassCount)
+	})
+}
+
+func TestAnalyseDataDetectsOutliers(t *testing.T) {
+	Convey("AnalyseData should not warn about outliers in the example data", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		for _, w := range filterMessages(result, "warn") {
+			So(w.Text, ShouldNotContainSubstring, "outlying values")
+		}
+	})
+
+	Convey("AnalyseData should warn about an outlier planted in the example data, and exclude it from the breaks when requested", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.CSV = strings.Replace(request.CSV, "E06000001,Hartlepool,3", "E06000001,Hartlepool,4500", 1)
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 2)
+		So(warnings[1].Text, ShouldContainSubstring, "1 rows have outlying values")
+		So(warnings[1].Text, ShouldContainSubstring, "E06000001 (4500)")
+		So(result.MaxValue, ShouldEqual, 4500.0)
+		includedBreaks := result.Breaks
+
+		request.ExcludeOutliers = true
+		result, err = analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(filterMessages(result, "warn")), ShouldEqual, 2)
+		So(len(result.Data), ShouldEqual, 415) // the outlier is still included in the data
+		So(result.MaxValue, ShouldEqual, 4500.0)
+		So(result.Breaks, ShouldNotResemble, includedBreaks)
+		So(result.Breaks[9], ShouldResemble, []float64{0.0, 4.0, 7.0, 10.0, 13.0, 16.0, 20.0, 26.0, 33.0, 39.0, 46.0})
+	})
+}
+
+func TestAnalyseDataCalculatesStatistics(t *testing.T) {
+	Convey("AnalyseData should calculate summary statistics for a small dataset", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,2\nS12000023,4\nS12000027,4\nS12000033,4\nS12000034,5\nS12000035,5\nS12000036,7\nS12000038,9\nS12000039,x")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		stats := result.Statistics
+		So(stats, ShouldNotBeNil)
+		So(stats.Count, ShouldEqual, 8) // the row with a non-numeric value is excluded
+		So(stats.Mean, ShouldEqual, 5.0)
+		So(stats.Median, ShouldEqual, 4.5)
+		So(stats.StandardDeviation, ShouldEqual, 2.0)
+		So(stats.LowerQuartile, ShouldEqual, 4.0)
+		So(stats.UpperQuartile, ShouldEqual, 5.5)
+		So(stats.DistinctValues, ShouldEqual, 5)
+	})
+
+	Convey("AnalyseData should calculate summary statistics for the example request, consistent with the min and max values", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		stats := result.Statistics
+		So(stats.Count, ShouldEqual, len(result.Data))
+		So(stats.Mean, ShouldAlmostEqual, 11.137349, 0.000001)
+		So(stats.Median, ShouldEqual, 8.0)
+		So(stats.StandardDeviation, ShouldAlmostEqual, 9.812356, 0.000001)
+		So(stats.LowerQuartile, ShouldEqual, 5.0)
+		So(stats.UpperQuartile, ShouldEqual, 13.0)
+		So(stats.DistinctValues, ShouldEqual, 46)
+		So(stats.LowerQuartile, ShouldBeGreaterThanOrEqualTo, result.MinValue)
+		So(stats.UpperQuartile, ShouldBeLessThanOrEqualTo, result.MaxValue)
+	})
+}
+
+func TestAnalyseDataSuggestsDivergingBreaks(t *testing.T) {
+	Convey("AnalyseData should suggest breaks centred on zero for data with both negative and positive values", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,-20\nS12000023,-12\nS12000027,-3\nS12000033,4\nS12000034,9\nS12000035,15\nS12000036,22\nS12000038,30")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		breaks := result.DivergingBreaks
+		So(len(breaks), ShouldBeGreaterThanOrEqualTo, 2)
+		So(len(breaks)%2, ShouldEqual, 0)
+		So(breaks, ShouldContain, 0.0)
+		So(breaks[len(breaks)/2], ShouldEqual, 0.0)
+		So(breaks[0], ShouldBeLessThanOrEqualTo, -20.0)
+		for i := 0; i < len(breaks)/2; i++ {
+			So(breaks[i], ShouldAlmostEqual, -breaks[len(breaks)-i-1]-(breaks[1]-breaks[0]))
+		}
+
+		info := filterMessages(result, "info")
+		So(len(info), ShouldEqual, 2)
+		So(info[1].Text, ShouldContainSubstring, "a diverging palette is recommended")
+	})
+
+	Convey("AnalyseData should size the diverging breaks to the requested class count", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,-20\nS12000023,-12\nS12000027,-3\nS12000033,4\nS12000034,9\nS12000035,15\nS12000036,22\nS12000038,30")
+		request.ClassCount = 6
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.DivergingBreaks, ShouldResemble, []float64{-30.0, -20.0, -10.0, 0.0, 10.0, 20.0})
+	})
+
+	Convey("AnalyseData should not suggest diverging breaks for data with only positive values", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,1\nS12000023,2\nS12000027,30")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.DivergingBreaks, ShouldBeNil)
+		So(len(filterMessages(result, "info")), ShouldEqual, 1)
+	})
+}
+
+func TestAnalyseDataSamplesLargeDatasets(t *testing.T) {
+	Convey("AnalyseData should calculate breaks from a sample of a large dataset that are close to those from the full dataset", t, func() {
+		defer analyser.UseSampleSize(5000)
+
+		request := largeAnalyseRequest(2000)
+
+		analyser.UseSampleSize(0)
+		full, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+		So(len(filterMessages(full, "info")), ShouldEqual, 1)
+
+		analyser.UseSampleSize(400)
+		sampled, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+
+		info := filterMessages(sampled, "info")
+		So(len(info), ShouldEqual, 2)
+		So(info[1].Text, ShouldEqual, "Breaks were calculated from a sample of 400 of the 2000 values")
+
+		So(len(sampled.Breaks), ShouldEqual, len(full.Breaks))
+		values := make([]float64, len(full.Data))
+		for i, row := range full.Data {
+			values[i] = row.Value
+		}
+		for i := range full.Breaks {
+			So(len(sampled.Breaks[i]), ShouldEqual, len(full.Breaks[i]))
+			So(varianceFit(values, sampled.Breaks[i]), ShouldAlmostEqual, varianceFit(values, full.Breaks[i]), 0.01)
+		}
+	})
+}
+
+func TestAnalyseDataWithContextShouldReturnErrorWhenCancelled(t *testing.T) {
+	Convey("AnalyseDataWithContext should return an error when the context is cancelled", t, func() {
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		result, err := analyser.AnalyseDataWithContext(ctx, largeAnalyseRequest(100))
+
+		So(result, ShouldBeNil)
+		So(err, ShouldEqual, context.Canceled)
+	})
+}
+
+func BenchmarkAnalyseDataSampled(b *testing.B) {
+	benchmarkAnalyseData(b, 5000)
+}
+
+func BenchmarkAnalyseDataUnsampled(b *testing.B) {
+	benchmarkAnalyseData(b, 0)
+}
+
+func benchmarkAnalyseData(b *testing.B, sampleSize int) {
+	defer analyser.UseSampleSize(5000)
+	analyser.UseSampleSize(sampleSize)
+	runAnalyseDataBenchmark(b, largeAnalyseRequest(50000))
+}
+
+func BenchmarkAnalyseDataExample(b *testing.B) {
+	request, err := models.CreateAnalyseRequest(bytes.NewReader(testdata.LoadExampleAnalyseRequest(b)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	runAnalyseDataBenchmark(b, request)
+}
+
+// BenchmarkAnalyseDataSynthetic analyses the values of a synthetic geography - which, unlike largeAnalyseRequest, has arcs
+func BenchmarkAnalyseDataSynthetic(b *testing.B) {
+	geography := testdata.GenerateGeography(2000, 50)
+	request := &models.AnalyseRequest{
+		Geography:  &models.Geography{Topojson: geography.Topology, IDProperty: "code", NameProperty: "name"},
+		CSV:        geography.CSV(),
+		IDIndex:    columnIndex(0),
+		ValueIndex: 1,
+	}
+	runAnalyseDataBenchmark(b, request)
+}
+
+func runAnalyseDataBenchmark(b *testing.B, request *models.AnalyseRequest) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := analyser.AnalyseData(request); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// varianceFit returns the goodness of variance fit of the given breaks to the values (0 being no fit and 1 a perfect fit)
+func varianceFit(values []float64, breaks []float64) float64 {
+	sumOfSquares := func(v []float64) float64 {
+		mean, sum := 0.0, 0.0
+		for _, x := range v {
+			mean += x / float64(len(v))
+		}
+		for _, x := range v {
+			sum += (x - mean) * (x - mean)
+		}
+		return sum
+	}
+	classes := make([][]float64, len(breaks))
+	for _, v := range values {
+		i := len(breaks) - 1
+		for i > 0 && v < breaks[i] {
+			i--
+		}
+		classes[i] = append(classes[i], v)
+	}
+	classSum := 0.0
+	for _, c := range classes {
+		classSum += sumOfSquares(c)
+	}
+	return 1.0 - (classSum / sumOfSquares(values))
+}
+
+// largeAnalyseRequest returns a request with a synthetic topology of the given number of features, and a csv with a (skewed, random but repeatable) value for every feature
+func largeAnalyseRequest(size int) *models.AnalyseRequest {
+	random := rand.New(rand.NewSource(1))
+	geometries := make([]*topojson.Geometry, size)
+	var csv bytes.Buffer
+	for i := range geometries {
+		id := fmt.Sprintf("F%06d", i)
+		geometries[i] = &topojson.Geometry{ID: id, Type: "Polygon", Properties: map[string]interface{}{"code": id}}
+		fmt.Fprintf(&csv, "%s,%.1f\n", id, random.ExpFloat64()*10)
+	}
+	topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+	return &models.AnalyseRequest{
+		Geography:  &models.Geography{Topojson: topology, IDProperty: "code"},
+		CSV:        csv.String(),
+		IDIndex:    columnIndex(0),
+		ValueIndex: 1,
+	}
+}
+
+func TestAnalyseDataShouldReturnErrorWhenTooManyRows(t *testing.T) {
+	Convey("AnalyseData should return an error when the csv has more than the maximum number of rows", t, func() {
+		defer analyser.UseMaxRows(100000)
+		analyser.UseMaxRows(2)
+
+		request := simpleAnalyseRequest(t, "S12000013,1\nS12000023,2\nS12000027,3")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(result, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "CSV has too many rows - the maximum is 2")
+	})
+
+	Convey("AnalyseData should not count the header row towards the maximum number of rows", t, func() {
+		defer analyser.UseMaxRows(100000)
+		analyser.UseMaxRows(2)
+
+		request := simpleAnalyseRequest(t, "id,value\nS12000013,1\nS12000023,2")
+		request.HasHeaderRow = true
+
+		_, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestAnalyseDataShouldTruncateIDsInMessages(t *testing.T) {
+	Convey("AnalyseData should list at most 50 IDs in a message, reporting how many more there are", t, func() {
+
+		var csv bytes.Buffer
+		csv.WriteString("S12000013,1\n")
+		for i := 0; i < 60; i++ {
+			fmt.Fprintf(&csv, "Unknown%d,1\n", i)
+		}
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, csv.String()))
+
+		So(err, ShouldBeNil)
+		errors := filterMessages(result, "error")
+		So(len(errors), ShouldEqual, 1)
+		So(errors[0].Text, ShouldStartWith, "IDs of 60 rows could not be found in the topology. Row IDs: [Unknown0, Unknown1,")
+		So(errors[0].Text, ShouldEndWith, "Unknown48, Unknown49] and 10 more")
+		So(errors[0].Text, ShouldNotContainSubstring, "Unknown50")
+	})
+
+	Convey("AnalyseData should list all IDs in the same form as before when there are fewer than 50", t, func() {
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,1\nUnknownA,2\nS12000023,b\nUnknownB,3\nS12000027"))
+
+		So(err, ShouldBeNil)
+		errors := filterMessages(result, "error")
+		So(len(errors), ShouldEqual, 1)
+		So(errors[0].Text, ShouldEqual, "IDs of 2 rows could not be found in the topology. Row IDs: [UnknownA, UnknownB]")
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 2)
+		So(warnings[0].Text, ShouldEqual, "1 rows have missing columns and could not be parsed. Row numbers: [5]")
+		So(warnings[1].Text, ShouldEqual, "1 rows have missing (or non-numeric) values and could not be parsed. Row IDs: [S12000023]")
+	})
+}
+
+func TestAnalyseDataSuggestsChoropleths(t *testing.T) {
+	Convey("AnalyseData should return choropleths for the best fit and requested class counts", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.ClassCount = 3
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.Choropleths), ShouldEqual, 2)
+		for i, n := range []int{result.BestFitClassCount, 3} {
+			choropleth := result.Choropleths[i]
+			So(choropleth.UpperBound, ShouldEqual, result.MaxValue)
+			So(len(choropleth.Breaks), ShouldEqual, n)
+			for j, b := range choropleth.Breaks {
+				So(b.LowerBound, ShouldEqual, result.Breaks[n-2][j])
+				So(b.Colour, ShouldEqual, paletteColour(result, n, j))
+			}
+		}
+	})
+
+	Convey("The suggested choropleth should render a correctly coloured map", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+
+		renderRequest := &models.RenderRequest{Filename: "analysed", Geography: request.Geography, Data: result.Data, Choropleth: result.Choropleths[0], DefaultWidth: 400}
+		svg := renderer.RenderSVG(renderer.PrepareSVGRequest(renderRequest))
+
+		breaks := result.Choropleths[0].Breaks
+		rendered := 0
+		for _, row := range result.Data {
+			if !strings.Contains(svg, fmt.Sprintf(`id="map-analysed-%s"`, row.ID)) {
+				continue // not in the topology
+			}
+			rendered++
+			colour := breaks[0].Colour
+			for _, b := range breaks {
+				if row.Value >= b.LowerBound {
+					colour = b.Colour
+				}
+			}
+			So(strings.Contains(svg, fmt.Sprintf(`id="map-analysed-%s" style="fill: %s;"`, row.ID, colour)), ShouldBeTrue)
+		}
+		So(rendered, ShouldBeGreaterThan, 0)
+	})
+}
+
+// paletteColour returns the colour for class i of the first suggested palette with n classes
+func paletteColour(result *models.AnalyseResponse, n int, i int) string {
+	for _, p := range result.Palettes {
+		if p.ClassCount == n {
+			return p.Colours[i]
+		}
+	}
+	return ""
+}
+
+func TestAnalyseDataNormalisesIDs(t *testing.T) {
+	csv := " f001,1\nF002,2\n3,3\n F004 ,4"
+
+	Convey("AnalyseData should require exact matches without id normalisation", t, func() {
+
+		result, err := analyser.AnalyseData(normalisationRequest(csv, nil))
+
+		So(err, ShouldBeNil)
+		So(filterMessages(result, "error")[0].Text, ShouldStartWith, "IDs of 3 rows could not be found in the topology")
+	})
+
+	Convey("AnalyseData should match trimmed ids", t, func() {
+
+		result, err := analyser.AnalyseData(normalisationRequest(csv, &models.IDNormalisation{Trim: true}))
+
+		So(err, ShouldBeNil)
+		So(filterMessages(result, "error")[0].Text, ShouldEqual, "IDs of 2 rows could not be found in the topology. Row IDs: [ f001, 3]")
+		info := filterMessages(result, "info")
+		So(info[0].Text, ShouldStartWith, "1 rows matched the topology only after normalising their IDs")
+		So(result.Data[3].ID, ShouldEqual, "F004")
+	})
+
+	Convey("AnalyseData should match ids case insensitively", t, func() {
+
+		result, err := analyser.AnalyseData(normalisationRequest("f001,1\nF002,2", &models.IDNormalisation{CaseInsensitive: true}))
+
+		So(err, ShouldBeNil)
+		So(len(filterMessages(result, "error")), ShouldEqual, 0)
+		So(filterMessages(result, "info")[0].Text, ShouldStartWith, "1 rows matched the topology only after normalising their IDs")
+		So(result.Data[0].ID, ShouldEqual, "F001")
+	})
+
+	Convey("AnalyseData should match ids ignoring leading zeros", t, func() {
+
+		result, err := analyser.AnalyseData(normalisationRequest("3,3\n0005,5\nF002,2", &models.IDNormalisation{StripLeadingZeros: true}))
+
+		So(err, ShouldBeNil)
+		So(len(filterMessages(result, "error")), ShouldEqual, 0)
+		So(filterMessages(result, "info")[0].Text, ShouldStartWith, "2 rows matched the topology only after normalising their IDs")
+		So(result.Data[0].ID, ShouldEqual, "003")
+		So(result.Data[1].ID, ShouldEqual, "5")
+	})
+
+	Convey("AnalyseData should apply all normalisation options together", t, func() {
+
+		result, err := analyser.AnalyseData(normalisationRequest(csv, &models.IDNormalisation{Trim: true, CaseInsensitive: true, StripLeadingZeros: true}))
+
+		So(err, ShouldBeNil)
+		So(len(filterMessages(result, "error")), ShouldEqual, 0)
+		So(filterMessages(result, "info")[0].Text, ShouldStartWith, "3 rows matched the topology only after normalising their IDs")
+		ids := []string{}
+		for _, row := range result.Data {
+			ids = append(ids, row.ID)
+		}
+		So(ids, ShouldResemble, []string{"F001", "F002", "003", "F004"})
+	})
+}
+
+// normalisationRequest returns a request with a topology of features F001, F002, 003, F004 and 5, and the given csv
+func normalisationRequest(csv string, normalisation *models.IDNormalisation) *models.AnalyseRequest {
+	geometries := []*topojson.Geometry{}
+	for _, id := range []string{"F001", "F002", "003", "F004", "5"} {
+		geometries = append(geometries, &topojson.Geometry{ID: id, Type: "Polygon", Properties: map[string]interface{}{"code": id}})
+	}
+	topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+	return &models.AnalyseRequest{
+		Geography:       &models.Geography{Topojson: topology, IDProperty: "code"},
+		CSV:             csv,
+		IDIndex:         columnIndex(0),
+		ValueIndex:      1,
+		IDNormalisation: normalisation,
+	}
+}
+
+func TestAnalyseDataSuggestsMappingsForNames(t *testing.T) {
+	Convey("AnalyseData should suggest mappings for csv ids that resemble names in the topology, without applying them", t, func() {
+
+		request := simpleAnalyseRequest(t, "Hartlepol,1\nmiddlesbrough,2\nRedcar and Cleaveland,3\nNowhere,4\nE06000004,5")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.SuggestedMappings, ShouldResemble, []*models.IDMapping{
+			{CSVValue: "Hartlepol", TopologyID: "E06000001", TopologyName: "Hartlepool", Confidence: 0.9},
+			{CSVValue: "middlesbrough", TopologyID: "E06000002", TopologyName: "Middlesbrough", Confidence: 1},
+			{CSVValue: "Redcar and Cleaveland", TopologyID: "E06000003", TopologyName: "Redcar and Cleveland", Confidence: 1.0 - (1.0 / 21.0)},
+		})
+
+		So(result.Data[0].ID, ShouldEqual, "Hartlepol")
+		errors := filterMessages(result, "error")
+		So(len(errors), ShouldEqual, 1)
+		So(errors[0].Text, ShouldStartWith, "IDs of 4 rows could not be found in the topology")
+		info := filterMessages(result, "info")
+		So(info[0].Text, ShouldStartWith, "3 unmatched rows have IDs resembling names in the topology (using property 'AREANM')")
+		So(info[1].Text, ShouldEqual, "Successfully processed 1 of 5 rows")
+	})
+
+	Convey("AnalyseData should return a response with suggested mappings even when no rows match the topology", t, func() {
+
+		request := simpleAnalyseRequest(t, "Hartlepool,1\nMiddlesborough,2")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.SuggestedMappings), ShouldEqual, 2)
+		So(result.SuggestedMappings[1].TopologyID, ShouldEqual, "E06000002")
+		So(filterMessages(result, "info")[1].Text, ShouldEqual, "Successfully processed 0 of 2 rows")
+	})
+
+	Convey("AnalyseData should not suggest mappings when most rows match the topology", t, func() {
+
+		request := simpleAnalyseRequest(t, "Hartlepool,1\nE06000002,2\nE06000003,3")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.SuggestedMappings, ShouldBeNil)
+	})
+
+	Convey("AnalyseData should not suggest mappings for names that are not similar", t, func() {
+
+		request := simpleAnalyseRequest(t, "Hartlepool,1\nMiddle,2\nRedcar,3")
+		request.Geography.NameProperty = "AREANM"
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.SuggestedMappings), ShouldEqual, 1)
+		So(result.SuggestedMappings[0].CSVValue, ShouldEqual, "Hartlepool")
+	})
+}
+
+func TestAnalyseDataSuggestsMappingsForNamesThatAreTheSameOnceNormalised(t *testing.T) {
+	Convey("AnalyseData should not suggest a mapping to names of different ids that are the same once normalised", t, func() {
+
+		geometries := []*topojson.Geometry{
+			{ID: "g1", Type: "Polygon", Properties: map[string]interface{}{"code": "A1", "name": "St. Helens"}},
+			{ID: "g2", Type: "Polygon", Properties: map[string]interface{}{"code": "A2", "name": "St Helens"}},
+			{ID: "g3", Type: "Polygon", Properties: map[string]interface{}{"code": "A3", "name": "Hartlepool"}},
+		}
+		topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+		request := &models.AnalyseRequest{Geography: &models.Geography{Topojson: topology, IDProperty: "code", NameProperty: "name"}, CSV: "St Helens,1\nSt Helen,2\nHartlepol,3", ValueIndex: 1}
+
+		for i := 0; i < 10; i++ {
+			result, err := analyser.AnalyseData(request)
+
+			So(err, ShouldBeNil)
+			So(result.SuggestedMappings, ShouldResemble, []*models.IDMapping{{CSVValue: "Hartlepol", TopologyID: "A3", TopologyName: "Hartlepool", Confidence: 0.9}})
+		}
+	})
+
+	Convey("AnalyseData should consistently suggest the same name of an id when its names are the same once normalised", t, func() {
+
+		geometries := []*topojson.Geometry{
+			{ID: "g1", Type: "Polygon", Properties: map[string]interface{}{"code": "A1", "name": "St. Helens"}},
+			{ID: "g2", Type: "Polygon", Properties: map[string]interface{}{"code": "A1", "name": "St Helens"}},
+		}
+		topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+		request := &models.AnalyseRequest{Geography: &models.Geography{Topojson: topology, IDProperty: "code", NameProperty: "name"}, CSV: "st helens,1", ValueIndex: 1}
+
+		for i := 0; i < 10; i++ {
+			result, err := analyser.AnalyseData(request)
+
+			So(err, ShouldBeNil)
+			So(result.SuggestedMappings, ShouldResemble, []*models.IDMapping{{CSVValue: "st helens", TopologyID: "A1", TopologyName: "St Helens", Confidence: 1}})
+		}
+	})
+}
+
+func TestAnalyseDataReadsXLSX(t *testing.T) {
+	Convey("AnalyseData should read numeric values from the named sheet of an xlsx file", t, func() {
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = testdata.LoadExampleXLSX(t)
+		request.SheetName = "Data"
+		request.ValueIndex = 2
+		request.HasHeaderRow = true
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.Data, ShouldResemble, []*models.DataRow{{ID: "E06000001", Value: 1.5}, {ID: "E06000002", Value: 2}})
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 1)
+		So(warnings[0].Text, ShouldEqual, "2 rows have missing (or non-numeric) values and could not be parsed. Row IDs: [E06000003, E06000004]")
+		So(filterMessages(result, "info")[0].Text, ShouldEqual, "Successfully processed 2 of 4 rows")
+	})
+
+	Convey("AnalyseData should use the cached values of formula cells", t, func() {
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = testdata.LoadExampleXLSX(t)
+		request.SheetIndex = 1
+		request.IDIndex = columnIndex(1)
+		request.ValueIndex = 3
+		request.HasHeaderRow = true
+		request.Geography.IDProperty = "AREANM"
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.Data, ShouldResemble, []*models.DataRow{{ID: "Hartlepool", Value: 3}, {ID: "Middlesbrough", Value: 4}, {ID: "Redcar and Cleveland", Value: 0}})
+		So(len(filterMessages(result, "error")), ShouldEqual, 0)
+	})
+
+	Convey("AnalyseData should read the first sheet by default", t, func() {
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = testdata.LoadExampleXLSX(t)
+
+		result, err := analyser.AnalyseData(request)
+
+		So(result, ShouldBeNil)
+		So(err.Error(), ShouldEqual, "All CSV rows had fewer than 2 columns - could not read data")
+	})
+
+	Convey("AnalyseData should return an error when the sheet does not exist", t, func() {
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = testdata.LoadExampleXLSX(t)
+		request.SheetName = "Missing"
+
+		_, err := analyser.AnalyseData(request)
+		So(err.Error(), ShouldEqual, "xlsx file does not contain a sheet named 'Missing'")
+
+		request.SheetName = ""
+		request.SheetIndex = 2
+		_, err = analyser.AnalyseData(request)
+		So(err.Error(), ShouldEqual, "xlsx file does not contain a sheet with index 2 - it has 2 sheets")
+	})
+
+	Convey("AnalyseData should return an error when the xlsx file is invalid", t, func() {
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = []byte("not a zip file")
+
+		_, err := analyser.AnalyseData(request)
+		So(err.Error(), ShouldStartWith, "Unable to read xlsx file")
+	})
+
+	Convey("AnalyseData should return an error when a cell is beyond the last column of a sheet", t, func() {
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = createXLSX(t, `<row r="1"><c r="A1" t="inlineStr"><is><t>E06000001</t></is></c><c r="XFE1"><v>1</v></c></row>`)
+
+		_, err := analyser.AnalyseData(request)
+		So(err.Error(), ShouldEqual, "Unable to read cell XFE1 in xlsx file: column is beyond XFD, the last column of a sheet")
+
+		request.XLSX = createXLSX(t, `<row r="1"><c r="ZZZZZZZZZZZZZZZ1"><v>1</v></c></row>`)
+		_, err = analyser.AnalyseData(request)
+		So(err.Error(), ShouldEqual, "Unable to read cell ZZZZZZZZZZZZZZZ1 in xlsx file: column is beyond XFD, the last column of a sheet")
+	})
+
+	Convey("AnalyseData should return an error when a file in the xlsx file is larger than the maximum", t, func() {
+		defer analyser.UseMaxXLSXEntrySize(100 << 20)
+		analyser.UseMaxXLSXEntrySize(1024)
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = createXLSX(t, strings.Repeat(`<row><c t="inlineStr"><is><t>E06000001</t></is></c><c><v>1</v></c></row>`, 100))
+
+		_, err := analyser.AnalyseData(request)
+		So(err.Error(), ShouldEqual, "Unable to read xlsx file: xl/worksheets/sheet1.xml is larger than the maximum of 1024 bytes")
+	})
+}
+
+// createXLSX returns an xlsx file with a single sheet containing the given rows
+func createXLSX(t *testing.T, rows string) []byte {
+	files := map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Data" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData>` + rows + `</sheetData></worksheet>`,
+	}
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAnalyseDataReturnsStructuredMessages(t *testing.T) {
+	Convey("AnalyseData should return messages with codes, counts and details", t, func() {
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,1\nUnknownA,2\nS12000023,b\nUnknownB,3\nS12000027"))
+
+		So(err, ShouldBeNil)
+		So(result.Messages, ShouldResemble, []*models.Message{
+			{Level: "warn", Code: models.MessageCodeMissingColumns, Count: 1, Details: []string{"row 5: S12000027"},
+				Text: "1 rows have missing columns and could not be parsed. Row numbers: [5]"},
+			{Level: "warn", Code: models.MessageCodeMissingValues, Count: 1, Details: []string{"row 3: S12000023"},
+				Text: "1 rows have missing (or non-numeric) values and could not be parsed. Row IDs: [S12000023]"},
+			{Level: "error", Code: models.MessageCodeUnmatchedIDs, Count: 2, Details: []string{"row 2: UnknownA", "row 4: UnknownB"},
+				Text: "IDs of 2 rows could not be found in the topology. Row IDs: [UnknownA, UnknownB]"},
+			{Level: "info", Code: models.MessageCodeProcessed, Count: 1, Text: "Successfully processed 1 of 5 rows"},
+		})
+	})
+
+	Convey("AnalyseData should cap the details in a message at the configured length, flagging that they are truncated", t, func() {
+		defer analyser.UseMaxMessageDetails(50)
+		analyser.UseMaxMessageDetails(2)
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,1\nUnknownA,2\nUnknownB,3\nUnknownC,4"))
+
+		So(err, ShouldBeNil)
+		errors := filterMessages(result, "error")
+		So(len(errors), ShouldEqual, 1)
+		So(errors[0].Code, ShouldEqual, models.MessageCodeUnmatchedIDs)
+		So(errors[0].Count, ShouldEqual, 3)
+		So(errors[0].Details, ShouldResemble, []string{"row 2: UnknownA", "row 3: UnknownB"})
+		So(errors[0].Truncated, ShouldBeTrue)
+		So(errors[0].Text, ShouldEqual, "IDs of 3 rows could not be found in the topology. Row IDs: [UnknownA, UnknownB] and 1 more")
+	})
+
+	Convey("AnalyseData should give outlier and diverging messages codes", t, func() {
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,-1\nS12000023,1\nS12000027,1\nS12000033,2\nS12000034,2\nS12000035,3\nS12000036,1000"))
+
+		So(err, ShouldBeNil)
+		codes := []string{}
+		for _, m := range result.Messages {
+			codes = append(codes, m.Code)
+		}
+		So(codes, ShouldResemble, []string{models.MessageCodeOutliers, models.MessageCodeProcessed, models.MessageCodeDivergingData})
+		So(filterMessages(result, "warn")[0].Details, ShouldResemble, []string{"S12000036 (1000)"})
+	})
+}
+
+func TestAnalyseDataReportsSourceRowNumbers(t *testing.T) {
+	Convey("AnalyseData should report the source row number (including the header and blank lines) of each skipped row", t, func() {
+
+		request := simpleAnalyseRequest(t, "code,value\nS12000013,1\n,2\n\nS12000023,\nS12000027\n\"S12000033\",\"a\nb\"\nS12000034,3")
+		request.HasHeaderRow = true
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 2)
+		So(warnings[0].Text, ShouldEqual, "1 rows have missing columns and could not be parsed. Row numbers: [6]")
+		So(warnings[0].Details, ShouldResemble, []string{"row 6: S12000027"})
+		So(warnings[1].Details, ShouldResemble, []string{"row 5: S12000023", "row 7: S12000033"})
+		errors := filterMessages(result, "error")
+		So(len(errors), ShouldEqual, 1)
+		So(errors[0].Details, ShouldResemble, []string{"row 3: "})
+	})
+
+	Convey("AnalyseData should report the row numbers of an xlsx sheet", t, func() {
+
+		request := simpleAnalyseRequest(t, "")
+		request.XLSX = testdata.LoadExampleXLSX(t)
+		request.SheetName = "Data"
+		request.ValueIndex = 2
+		request.HasHeaderRow = true
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(filterMessages(result, "warn")[0].Details, ShouldResemble, []string{"row 5: E06000003", "row 6: E06000004"})
+	})
+}
+
+func TestAnalyseDataValidatesTopologyIDs(t *testing.T) {
+	Convey("AnalyseData should warn about duplicate topology ids and features without the id property", t, func() {
+
+		geometries := []*topojson.Geometry{
+			{ID: "g1", Type: "Polygon", Properties: map[string]interface{}{"code": "A"}},
+			{ID: "g2", Type: "Polygon", Properties: map[string]interface{}{"code": "A"}},
+			{ID: "g3", Type: "Polygon", Properties: map[string]interface{}{"code": "B"}},
+			{ID: "g4", Type: "Polygon", Properties: map[string]interface{}{"name": "no code"}},
+		}
+		topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+		request := &models.AnalyseRequest{Geography: &models.Geography{Topojson: topology, IDProperty: "code"}, CSV: "A,1\nB,2\ng4,3", ValueIndex: 1}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 2)
+		So(warnings[0].Code, ShouldEqual, models.MessageCodeDuplicateTopologyIDs)
+		So(warnings[0].Count, ShouldEqual, 1)
+		So(warnings[0].Details, ShouldResemble, []string{"A (2 features)"})
+		So(warnings[0].Text, ShouldStartWith, "1 IDs are used by more than one feature in the topology (using property 'code')")
+		So(warnings[1].Code, ShouldEqual, models.MessageCodeMissingIDProperty)
+		So(warnings[1].Details, ShouldResemble, []string{"g4"})
+		So(warnings[1].Text, ShouldEqual, "1 features in the topology do not have the property 'code' - their feature id has been used instead. Feature IDs: [g4]")
+
+		So(result.TopologySummary.FeatureCount, ShouldEqual, 4)
+		So(result.TopologySummary.DistinctIDCount, ShouldEqual, 3)
+		So(result.TopologySummary.IDProperty, ShouldEqual, "code")
+		So(len(filterMessages(result, "error")), ShouldEqual, 0)
+	})
+
+	Convey("AnalyseData should not warn about a topology with unique ids", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		for _, m := range result.Messages {
+			So(m.Code, ShouldNotEqual, models.MessageCodeDuplicateTopologyIDs)
+			So(m.Code, ShouldNotEqual, models.MessageCodeMissingIDProperty)
+		}
+		So(result.TopologySummary.FeatureCount, ShouldEqual, result.TopologySummary.DistinctIDCount)
+		So(result.TopologySummary.IDProperty, ShouldEqual, "AREACD")
+	})
+}
+
+func TestAnalyseDataSkipsBlankRows(t *testing.T) {
+	Convey("AnalyseData should skip blank and whitespace-only rows without counting them", t, func() {
+
+		request := simpleAnalyseRequest(t, "\n  \ncode,value\nS12000013,1\n\n,,\nS12000023,2\n \t \n , \nS12000027\nS12000033,3\n\n\n")
+		request.HasHeaderRow = true
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.Data), ShouldEqual, 3)
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 1)
+		So(warnings[0].Text, ShouldEqual, "1 rows have missing columns and could not be parsed. Row numbers: [10]")
+		So(filterMessages(result, "info")[0].Text, ShouldEqual, "Successfully processed 3 of 4 rows")
+	})
+
+	Convey("AnalyseData should not count trailing blank lines as rows with missing columns", t, func() {
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,1\nS12000023,2\n\r\n,\n"))
+
+		So(err, ShouldBeNil)
+		So(len(filterMessages(result, "warn")), ShouldEqual, 0)
+		So(filterMessages(result, "info")[0].Text, ShouldEqual, "Successfully processed 2 of 2 rows")
+	})
+
+	Convey("Blank rows should not count towards the maximum number of rows", t, func() {
+		defer analyser.UseMaxRows(100000)
+		analyser.UseMaxRows(2)
+
+		_, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,1\n,\n,,\nS12000023,2\n"))
+
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestAnalyseDataReturnsFitMetrics(t *testing.T) {
+	Convey("AnalyseData should return the fit metrics for each class count, with goodness of fit increasing with the number of classes", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,1\nS12000023,2\nS12000027,4\nS12000033,8\nS12000034,16\nS12000035,32\nS12000036,64\nS12000038,128")
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.FitMetrics), ShouldEqual, len(result.Breaks))
+		best := result.FitMetrics[0]
+		for i, m := range result.FitMetrics {
+			So(m.ClassCount, ShouldEqual, len(result.Breaks[i]))
+			So(m.GoodnessOfVarianceFit, ShouldBeBetweenOrEqual, 0, 1)
+			if i > 0 {
+				So(m.GoodnessOfVarianceFit, ShouldBeGreaterThanOrEqualTo, result.FitMetrics[i-1].GoodnessOfVarianceFit)
+			}
+			if m.Fitness > best.Fitness {
+				best = m
+			}
+		}
+		So(result.BestFitClassCount, ShouldEqual, best.ClassCount)
+	})
+
+	Convey("Changing the class count weighting should change the recommendation", t, func() {
+
+		request := largeAnalyseRequest(200)
+		defaultResult, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+
+		fewerClasses := 0.9
+		request.ClassCountWeighting = &fewerClasses
+		fewerResult, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+
+		moreClasses := 0.0
+		request.ClassCountWeighting = &moreClasses
+		moreResult, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+
+		So(fewerResult.BestFitClassCount, ShouldBeLessThan, defaultResult.BestFitClassCount)
+		So(moreResult.BestFitClassCount, ShouldBeGreaterThan, defaultResult.BestFitClassCount)
+	})
+}
+
+func TestAnalyseDataReturnsHistogram(t *testing.T) {
+	Convey("AnalyseData should return a histogram of 30 bins by default, whose counts sum to the number of values", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		h := result.Histogram
+		So(len(h.Counts), ShouldEqual, 30)
+		So(len(h.Edges), ShouldEqual, 31)
+		So(h.Edges[0], ShouldEqual, result.MinValue)
+		So(h.Edges[30], ShouldEqual, result.MaxValue)
+		total := 0
+		for _, c := range h.Counts {
+			total += c
+		}
+		So(total, ShouldEqual, len(result.Data))
+	})
+
+	Convey("AnalyseData should include the maximum value in the last bin and values on an edge in the upper bin", t, func() {
+
+		request := simpleAnalyseRequest(t, "S12000013,0\nS12000023,1\nS12000027,2\nS12000033,2.5\nS12000034,4")
+		request.HistogramBins = 4
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.Histogram, ShouldResemble, &models.Histogram{Edges: []float64{0, 1, 2, 3, 4}, Counts: []int{1, 1, 2, 1}})
+	})
+
+	Convey("AnalyseData should return a single bin when all values are equal", t, func() {
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,7\nS12000023,7\nS12000027,7"))
+
+		So(err, ShouldBeNil)
+		So(result.Histogram, ShouldResemble, &models.Histogram{Edges: []float64{7, 7}, Counts: []int{3}})
+	})
+
+	Convey("AnalyseData should treat NaN and Inf values as non-numeric, and leave them out of the histogram", t, func() {
+
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, "S12000013,0\nS12000023,NaN\nS12000027,Inf\nS12000033,-Inf\nS12000034,4"))
+
+		So(err, ShouldBeNil)
+		So(len(result.Data), ShouldEqual, 2)
+		So(result.MinValue, ShouldEqual, 0)
+		So(result.MaxValue, ShouldEqual, 4)
+		So(result.Histogram.Counts[0]+result.Histogram.Counts[len(result.Histogram.Counts)-1], ShouldEqual, 2)
+
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 1)
+		So(warnings[0].Code, ShouldEqual, models.MessageCodeMissingValues)
+		So(warnings[0].Details, ShouldResemble, []string{"row 2: S12000023", "row 3: S12000027", "row 4: S12000033"})
+	})
+}
+
+func TestAnalyseDataReturnsGeographySummary(t *testing.T) {
+	Convey("AnalyseData should compute the bounding box of a topology without one, and list its largest features", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		summary := result.TopologySummary
+		So(len(summary.BoundingBox), ShouldEqual, 4)
+		So(summary.BoundingBox[0], ShouldBeLessThan, summary.BoundingBox[2])
+		So(summary.BoundingBox[1], ShouldBeLessThan, summary.BoundingBox[3])
+		So(summary.GeometryTypes, ShouldResemble, []string{"MultiPolygon", "Polygon"})
+		So(len(summary.LargestFeatures), ShouldEqual, 5)
+		for i, f := range summary.LargestFeatures {
+			So(f.ID, ShouldNotBeEmpty)
+			So(f.Name, ShouldNotBeEmpty)
+			So(f.Area, ShouldBeGreaterThan, 0)
+			if i > 0 {
+				So(f.Area, ShouldBeLessThanOrEqualTo, summary.LargestFeatures[i-1].Area)
+			}
+		}
+	})
+
+	Convey("AnalyseData should use the bounding box of the topology when it has one", t, func() {
+
+		topology, err := topojson.UnmarshalTopology([]byte(`{"type":"Topology","objects":{"simplegeojson":{"type":"GeometryCollection","geometries":[{"type":"Polygon","arcs":[[0]],"properties":{"code":"f0","name":"feature 0"}},{"type":"Polygon","arcs":[[1]],"properties":{"code":"f1","name":"feature 1"}}]}},"arcs":[[[47.13148713111877,9.53216215939578],[47.13148713111877,9.53216215939578],[47.13148713111877,9.53216215939578],[47.13148713111877,9.53216215939578]],[[47.128000259399414,9.52858586376412],[47.132699489593506,9.52858586376412],[47.132699489593506,9.532394934735397],[47.128000259399414,9.532394934735397],[47.128000259399414,9.52858586376412]]],"bbox":[47.128000259399414,9.52858586376412,47.132699489593506,9.532394934735397]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := &models.AnalyseRequest{
+			Geography:  &models.Geography{Topojson: topology, IDProperty: "code", NameProperty: "name"},
+			CSV:        "f0,1\nf1,2",
+			IDIndex:    columnIndex(0),
+			ValueIndex: 1,
+		}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		summary := result.TopologySummary
+		So(summary.BoundingBox, ShouldResemble, []float64{47.128000259399414, 9.52858586376412, 47.132699489593506, 9.532394934735397})
+		So(summary.GeometryTypes, ShouldResemble, []string{"Polygon"})
+		So(len(summary.LargestFeatures), ShouldEqual, 2)
+		So(summary.LargestFeatures[0].ID, ShouldEqual, "f1")
+		So(summary.LargestFeatures[0].Name, ShouldEqual, "feature 1")
+		So(summary.LargestFeatures[0].Area, ShouldBeGreaterThan, 0)
+		So(summary.LargestFeatures[1].ID, ShouldEqual, "f0")
+		So(summary.LargestFeatures[1].Area, ShouldEqual, 0)
+	})
+}
+
+func TestAnalyseDataAcceptsGeoJSON(t *testing.T) {
+	Convey("AnalyseData should return the same result for geojson as for the equivalent topojson", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		topojsonRequest, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		geojsonRequest, err := models.CreateAnalyseRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		geojsonRequest.Geography.Geojson = toGeoJSON(t, geojsonRequest.Geography.Topojson)
+		geojsonRequest.Geography.Topojson = nil
+
+		expected, err := analyser.AnalyseData(topojsonRequest)
+		So(err, ShouldBeNil)
+		result, err := analyser.AnalyseData(geojsonRequest)
+		So(err, ShouldBeNil)
+
+		So(result, ShouldResemble, expected)
+	})
+
+	Convey("AnalyseData should treat id and name properties of geojson features in the same way as topojson", t, func() {
+
+		geometries := []*topojson.Geometry{
+			{ID: "g1", Type: "Polygon", Properties: map[string]interface{}{"code": "A", "name": "Hartlepool"}},
+			{ID: "g2", Type: "Polygon", Properties: map[string]interface{}{"code": "A", "name": "Middlesbrough"}},
+			{ID: "g3", Type: "Polygon", Properties: map[string]interface{}{"code": "B", "name": "Redcar"}},
+			{ID: "g4", Type: "Polygon", Properties: map[string]interface{}{"name": "Stockton"}},
+		}
+		topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+		csv := "Hartlepol,1\nRedcar,2\nStockton,3"
+
+		expected, err := analyser.AnalyseData(&models.AnalyseRequest{Geography: &models.Geography{Topojson: topology, IDProperty: "code", NameProperty: "name"}, CSV: csv, ValueIndex: 1})
+		So(err, ShouldBeNil)
+		result, err := analyser.AnalyseData(&models.AnalyseRequest{Geography: &models.Geography{Geojson: toGeoJSON(t, topology), IDProperty: "code", NameProperty: "name"}, CSV: csv, ValueIndex: 1})
+		So(err, ShouldBeNil)
+
+		So(len(result.SuggestedMappings), ShouldEqual, 3)
+		So(result.SuggestedMappings, ShouldResemble, expected.SuggestedMappings)
+		So(result.Messages, ShouldResemble, expected.Messages)
+		So(result.TopologySummary, ShouldResemble, expected.TopologySummary)
+	})
+}
+
+// toGeoJSON converts the topology to a geojson feature collection via its json representation, as a client would supply it
+func toGeoJSON(t *testing.T, topology *topojson.Topology) *geojson.FeatureCollection {
+	b, err := json.Marshal(topology.ToGeoJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
+func TestAnalyseDataMatchesNumericTopologyIDs(t *testing.T) {
+	Convey("AnalyseData should match csv ids against numeric id properties in their canonical form", t, func() {
+
+		geometries := []*topojson.Geometry{
+			{ID: "g1", Type: "Polygon", Properties: map[string]interface{}{"code": 101.0, "name": "Hartlepool"}},
+			{ID: "g2", Type: "Polygon", Properties: map[string]interface{}{"code": 2000000.0, "name": "Middlesbrough"}},
+			{ID: "g3", Type: "Polygon", Properties: map[string]interface{}{"code": 1.5, "name": "Redcar"}},
+		}
+		topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+		request := &models.AnalyseRequest{Geography: &models.Geography{Topojson: topology, IDProperty: "code", NameProperty: "name"}, CSV: "101,1\n2000000,2\n1.5,3", ValueIndex: 1}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(filterMessages(result, "error")), ShouldEqual, 0)
+		So(len(filterMessages(result, "warn")), ShouldEqual, 0)
+		So(len(result.Data), ShouldEqual, 3)
+		So(result.TopologySummary.DistinctIDCount, ShouldEqual, 3)
+	})
+
+	Convey("AnalyseData should suggest mappings to numeric topology ids in their canonical form", t, func() {
+
+		geometries := []*topojson.Geometry{
+			{ID: "g1", Type: "Polygon", Properties: map[string]interface{}{"code": 101.0, "name": "Hartlepool"}},
+			{ID: "g2", Type: "Polygon", Properties: map[string]interface{}{"code": 102.0, "name": "Middlesbrough"}},
+		}
+		topology := &topojson.Topology{Objects: map[string]*topojson.Geometry{"features": {Type: "GeometryCollection", Geometries: geometries}}}
+		request := &models.AnalyseRequest{Geography: &models.Geography{Topojson: topology, IDProperty: "code", NameProperty: "name"}, CSV: "Hartlepool,1\nMiddlesbrough,2", ValueIndex: 1}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.SuggestedMappings), ShouldEqual, 2)
+		So(result.SuggestedMappings[0].TopologyID, ShouldEqual, "101")
+		So(result.SuggestedMappings[1].TopologyID, ShouldEqual, "102")
+	})
+}
+
+func TestChooseBreaks(t *testing.T) {
+	values := []float64{64, 1, 2, 128, 4, 8, 16, 32, 1, 2, 128, 64}
+
+	Convey("ChooseBreaks should choose the best fit natural breaks and a palette for them", t, func() {
+		request := simpleAnalyseRequest(t, "S12000013,1\nS12000023,2\nS12000027,4\nS12000033,8\nS12000034,16\nS12000035,32\nS12000036,64\nS12000038,128\nS12000039,1\nS12000040,2\nS12000041,128\nS12000042,64")
+		analysis, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+
+		chosen, err := analyser.ChooseBreaks(context.Background(), values, 0, "")
+
+		So(err, ShouldBeNil)
+		So(chosen.BestFit, ShouldBeTrue)
+		So(len(chosen.LowerBounds), ShouldEqual, analysis.BestFitClassCount)
+		So(chosen.LowerBounds, ShouldResemble, analysis.Breaks[analysis.BestFitClassCount-2])
+		So(chosen.Palette, ShouldEqual, analysis.Palettes[0].Name)
+	})
+
+	Convey("ChooseBreaks should respect the requested class count and palette", t, func() {
+		chosen, err := analyser.ChooseBreaks(context.Background(), values, 4, "greens")
+
+		So(err, ShouldBeNil)
+		So(chosen.BestFit, ShouldBeFalse)
+		So(len(chosen.LowerBounds), ShouldEqual, 4)
+		So(chosen.LowerBounds[0], ShouldBeLessThanOrEqualTo, 1)
+		So(chosen.Palette, ShouldEqual, "Greens")
+	})
+
+	Convey("ChooseBreaks should return an error if the values cannot be divided or coloured", t, func() {
+		_, err := analyser.ChooseBreaks(context.Background(), []float64{1, 1, 1}, 0, "")
+		So(err, ShouldNotBeNil)
+
+		_, err = analyser.ChooseBreaks(context.Background(), []float64{1, 2, 3}, 5, "")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "5 classes")
+
+		_, err = analyser.ChooseBreaks(context.Background(), values, 4, "Rainbow")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "Rainbow")
+	})
+}
+
+func TestAnalyseDataCachesBreaks(t *testing.T) {
+	defer analyser.UseBreaksCache(analyser.NewBreaksCache(32))
+	csv := "S12000013,1\nS12000023,5\nS12000027,9\nUnknownA,2\nS12000013,7"
+
+	Convey("AnalyseData should reuse the breaks calculated for the same values, but match the data to the geography afresh", t, func() {
+		cache := analyser.NewBreaksCache(4)
+		analyser.UseBreaksCache(cache)
+
+		first, err := analyser.AnalyseData(simpleAnalyseRequest(t, csv))
+		So(err, ShouldBeNil)
+		So(cache.Snapshot(), ShouldResemble, analyser.BreaksCacheSnapshot{Size: 4, Entries: 1, Hits: 0, Misses: 1})
+		lowest := first.Breaks[0][0]
+		first.Breaks[0][0] = -1 // must not change the cached breaks
+
+		request := simpleAnalyseRequest(t, csv)
+		for _, object := range request.Geography.Topojson.Objects {
+			for _, g := range object.Geometries {
+				if g.Properties[request.Geography.IDProperty] == "S12000027" {
+					g.Properties[request.Geography.IDProperty] = "UnknownA"
+				}
+			}
+		}
+		second, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+		So(cache.Snapshot(), ShouldResemble, analyser.BreaksCacheSnapshot{Size: 4, Entries: 1, Hits: 1, Misses: 1, HitRate: 0.5})
+
+		So(second.Breaks[0][0], ShouldEqual, lowest)
+		So(second.Breaks[1:], ShouldResemble, first.Breaks[1:])
+		So(second.FitMetrics, ShouldResemble, first.FitMetrics)
+		So(filterMessages(first, "error")[0].Details, ShouldResemble, []string{"row 4: UnknownA"})
+		So(filterMessages(second, "error")[0].Details, ShouldResemble, []string{"row 3: S12000027"})
+	})
+
+	Convey("AnalyseData should recalculate the breaks when the parameters of the analysis differ", t, func() {
+		cache := analyser.NewBreaksCache(4)
+		analyser.UseBreaksCache(cache)
+
+		_, err := analyser.AnalyseData(simpleAnalyseRequest(t, csv))
+		So(err, ShouldBeNil)
+		request := simpleAnalyseRequest(t, csv)
+		weighting := 0.9
+		request.ClassCountWeighting = &weighting
+		_, err = analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+
+		So(cache.Snapshot().Misses, ShouldEqual, 2)
+		So(cache.Snapshot().Hits, ShouldEqual, 0)
+	})
+
+	Convey("The least recently used breaks should be removed from a full cache", t, func() {
+		cache := analyser.NewBreaksCache(1)
+		analyser.UseBreaksCache(cache)
+
+		for _, data := range []string{csv, "S12000013,3\nS12000023,4\nS12000027,8", csv} {
+			_, err := analyser.AnalyseData(simpleAnalyseRequest(t, data))
+			So(err, ShouldBeNil)
+		}
+
+		So(cache.Snapshot(), ShouldResemble, analyser.BreaksCacheSnapshot{Size: 1, Entries: 1, Hits: 0, Misses: 3})
+	})
+}
+
+func TestAnalyseDataSuggestsReferenceLine(t *testing.T) {
+	csv := "S12000013,1.5\nS12000023,5\nS12000027,9\nS92000003,4.2"
+
+	Convey("AnalyseData should suggest the value of a named reference row that is not in the geography, excluding it from the data", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+		request.Reference = "S92000003"
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.ReferenceLine, ShouldResemble, &models.ReferenceLine{Value: 4.2, Text: "S92000003"})
+		So(len(result.Data), ShouldEqual, 3)
+		So(filterMessages(result, "error"), ShouldBeEmpty)
+		So(filterMessages(result, "warn"), ShouldBeEmpty)
+		So(result.Statistics.Count, ShouldEqual, 3)
+		So(len(result.Choropleths), ShouldBeGreaterThan, 0)
+		for _, choropleth := range result.Choropleths {
+			So(choropleth.ReferenceLines, ShouldResemble, []*models.ReferenceLine{{Value: 4.2, Text: "S92000003"}})
+		}
+	})
+
+	Convey("AnalyseData should label a reference row that is in the geography with the name of its region, keeping it in the data", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+		request.Reference = "S12000023"
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.ReferenceLine, ShouldResemble, &models.ReferenceLine{Value: 5, Text: "Orkney Islands"})
+		So(len(result.Data), ShouldEqual, 4)
+	})
+
+	Convey("AnalyseData should keep a reference row in the data if it is in the geography once its id is normalised", t, func() {
+		request := simpleAnalyseRequest(t, "S12000013,1.5\n s12000023 ,5\nS12000027,9")
+		request.IDNormalisation = &models.IDNormalisation{Trim: true, CaseInsensitive: true}
+		request.Reference = "S12000023"
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.ReferenceLine, ShouldResemble, &models.ReferenceLine{Value: 5, Text: "Orkney Islands"})
+		So(len(result.Data), ShouldEqual, 3)
+		So(result.Statistics.Count, ShouldEqual, 3)
+	})
+
+	Convey("AnalyseData should suggest the mean or median of the values, rounded to the suggested decimal places", t, func() {
+		request := simpleAnalyseRequest(t, "S12000013,1.5\nS12000023,5.2\nS12000027,9.1")
+		request.Reference = models.ReferenceMean
+
+		result, err := analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+		So(result.ReferenceLine, ShouldResemble, &models.ReferenceLine{Value: 5.3, Text: "Average"})
+
+		request.Reference = models.ReferenceMedian
+		result, err = analyser.AnalyseData(request)
+		So(err, ShouldBeNil)
+		So(result.ReferenceLine, ShouldResemble, &models.ReferenceLine{Value: 5.2, Text: "Median"})
+	})
+
+	Convey("AnalyseData should warn, and fall back to the mean, when the reference row is not in the data", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+		request.Reference = "K02000001"
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.ReferenceLine, ShouldResemble, &models.ReferenceLine{Value: 4.9, Text: "Average"})
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 1)
+		So(warnings[0].Code, ShouldEqual, models.MessageCodeMissingReference)
+		So(warnings[0].Text, ShouldEqual, "The reference row 'K02000001' could not be found in the data - the mean of the values is suggested as the reference instead")
+	})
+
+	Convey("AnalyseData should not suggest a reference line unless one is requested", t, func() {
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, csv))
+
+		So(err, ShouldBeNil)
+		So(result.ReferenceLine, ShouldBeNil)
+		So(result.Choropleths[0].ReferenceLines, ShouldBeEmpty)
+	})
+}
+
+func TestAnalyseDataDetectsIDColumn(t *testing.T) {
+	csv := "first,1,S12000013\nsecond,5,S12000023\nthird,9,S12000027\nfourth,3,UnknownA"
+
+	Convey("AnalyseData should read the ids from the column that best matches the topology when no id_index is given", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+		request.IDIndex = nil
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(result.Data[0], ShouldResemble, &models.DataRow{ID: "S12000013", Value: 1})
+		info := filterMessages(result, "info")
+		So(info[0], ShouldResemble, &models.Message{Level: "info", Code: models.MessageCodeDetectedIDColumn, Count: 3,
+			Text: "No id_index was given - the IDs were read from column 2, which matched the topology in 75% of the 4 rows checked"})
+	})
+
+	Convey("AnalyseData should not count the header row when detecting the id column", t, func() {
+		request := simpleAnalyseRequest(t, "name,value,code\n"+csv)
+		request.IDIndex = nil
+		request.HasHeaderRow = true
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.Data), ShouldEqual, 4)
+		So(filterMessages(result, "info")[0].Text, ShouldEqual, "No id_index was given - the IDs were read from column 2, which matched the topology in 75% of the 4 rows checked")
+	})
+
+	Convey("An explicit id_index should always be used, with the detected column suggested if nothing matches", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+
+		_, err := analyser.AnalyseData(request)
+
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Data does not match Topology - IDs in the data do not match any IDs in the topology (using property 'AREACD' to identify features in the topology)"+
+			" - but column 2 matched 75% of the rows checked, so may be the id_index")
+	})
+
+	Convey("AnalyseData should return the usual error when no column matches the topology", t, func() {
+		request := simpleAnalyseRequest(t, "UnknownA,1,Other\nUnknownB,2,Other")
+		request.IDIndex = nil
+
+		_, err := analyser.AnalyseData(request)
+
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Data does not match Topology - IDs in the data do not match any IDs in the topology (using property 'AREACD' to identify features in the topology)")
+	})
+
+	Convey("Detecting the id column should scan a limited number of rows", t, func() {
+		request := largeAnalyseRequest(1500)
+		request.IDIndex = nil
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.Data), ShouldEqual, 1500)
+		So(filterMessages(result, "info")[0].Text, ShouldEqual, "No id_index was given - the IDs were read from column 0, which matched the topology in 100% of the 1000 rows checked")
+	})
+}
+
+func TestAnalyseDataFlagsEmptyClasses(t *testing.T) {
+	csv := "S12000013,1\nS12000023,2\nS12000027,3\nS12000033,10\nS12000034,11\nS12000035,12"
+
+	Convey("AnalyseData should warn of candidate breaks whose classes contain no values, identifying the empty classes", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+		request.CandidateBreaks = [][]float64{{1, 5, 8, 10}, {1, 10}}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 1)
+		So(warnings[0].Code, ShouldEqual, models.MessageCodeEmptyClasses)
+		So(warnings[0].Details, ShouldResemble, []string{"class 2 (5 to 8), class 3 (8 to 10)"})
+		So(warnings[0].Text, ShouldEqual, "The candidate breaks [1 5 8 10] (candidate_breaks[0]) have classes containing no values, whose colours would not appear on the map: class 2 (5 to 8), class 3 (8 to 10)")
+	})
+
+	Convey("AnalyseData should identify an empty last class", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+		request.CandidateBreaks = [][]float64{{1, 10, 20}}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 1)
+		So(warnings[0].Details, ShouldResemble, []string{"class 3 (20 and above)"})
+	})
+
+	Convey("AnalyseData should not warn of empty classes in the suggested breaks, which are drawn from the values", t, func() {
+		result, err := analyser.AnalyseData(simpleAnalyseRequest(t, csv))
+
+		So(err, ShouldBeNil)
+		So(filterMessages(result, "warn"), ShouldBeEmpty)
+	})
+}
+
+func TestAnalyseDataReturnsMissingRowsWithReasons(t *testing.T) {
+	csv := "S12000013,1\nS12000023,[c]\nS12000027,3\nS12000033,x\nS12000034,7"
+
+	Convey("AnalyseData should return rows whose value is a missing value token as missing rows with the reason, excluded from the breaks", t, func() {
+		request := simpleAnalyseRequest(t, csv)
+		request.MissingValueReasons = map[string]string{"[c]": "data suppressed"}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(err, ShouldBeNil)
+		So(len(result.Data), ShouldEqual, 4)
+		So(result.Data[1], ShouldResemble, &models.DataRow{ID: "S12000023", Missing: true, Reason: "data suppressed"})
+		So(result.Statistics.Count, ShouldEqual, 3)
+		So(result.MinValue, ShouldEqual, 1)
+
+		infos := filterMessages(result, "info")
+		So(infos[0].Code, ShouldEqual, models.MessageCodeMissingWithReason)
+		So(infos[0].Details, ShouldResemble, []string{"row 2: S12000023 (data suppressed)"})
+		warnings := filterMessages(result, "warn")
+		So(len(warnings), ShouldEqual, 1)
+		So(warnings[0].Code, ShouldEqual, models.MessageCodeMissingValues)
+		So(warnings[0].Details, ShouldResemble, []string{"row 4: S12000033"})
+	})
+
+	Convey("AnalyseData should still return an error if no row has a numeric value", t, func() {
+		request := simpleAnalyseRequest(t, "S12000013,[c]\nS12000023,x")
+		request.MissingValueReasons = map[string]string{"[c]": "data suppressed"}
+
+		_, err := analyser.AnalyseData(request)
+
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "No CSV rows had a numeric value - could not read data")
+	})
+
+	Convey("AnalyseData should return an error if no numeric value remains once rows with missing columns or a reason, and the reference row, are excluded", t, func() {
+		request := simpleAnalyseRequest(t, "S12000013,[c]\nS12000023\n")
+		request.MissingValueReasons = map[string]string{"[c]": "data suppressed"}
+
+		result, err := analyser.AnalyseData(request)
+
+		So(result, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "No CSV rows had a numeric value - could not read data")
+
+		request = simpleAnalyseRequest(t, "S12000013,[c]\nS92000003,4.2")
+		request.MissingValueReasons = map[string]string{"[c]": "data suppressed"}
+		request.Reference = "S92000003"
+
+		result, err = analyser.AnalyseData(request)
+
+		So(result, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "No CSV rows had a numeric value - could not read data")
+	})
+}
@@ -0,0 +1,213 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/palette"
+	"github.com/ThinkingLogic/jenks"
+)
+
+// defaultSampleSize is the default maximum number of values used to calculate natural breaks
+const defaultSampleSize = 5000
+
+var sampleSize = defaultSampleSize
+
+// UseSampleSize sets the maximum number of values used to calculate natural breaks. Larger datasets are sampled down to this size.
+// A size of 0 (or less) disables sampling.
+func UseSampleSize(size int) {
+	sampleSize = size
+}
+
+// breakAnalysis is the natural breaks of a set of values for every class count, with the class count that best fits the values
+type breakAnalysis struct {
+	breaks     [][]float64         // the (rounded) breaks for each class count, from 2 classes upwards
+	sampled    int                 // the number of values the breaks were calculated from
+	classCount int                 // the best fit class count, or 0 if there are fewer than 2 distinct values
+	fitMetrics []*models.FitMetric // the metrics used to find the best fit, for each class count
+}
+
+// analyseBreaks calculates the natural breaks in the (sorted) values for every class count up to models.MaxClassCount,
+// and finds the best fit class count, where classCountFactor (0-1) is the weighting given to having fewer classes (see bestFitClassCount).
+// The analysis is taken from the breaksCache if the same values have been analysed recently.
+func analyseBreaks(ctx context.Context, values []float64, classCountFactor float64) (*breakAnalysis, error) {
+	cache := breaksCache
+	key := breaksFingerprint(values, classCountFactor)
+	if analysis := cache.get(key); analysis != nil {
+		return analysis, nil
+	}
+	breaks, sampled, err := calculateNaturalBreaks(ctx, values, models.MaxClassCount)
+	if err != nil {
+		return nil, err
+	}
+	classCount, fitMetrics := bestFitClassCount(values, breaks, classCountFactor)
+	analysis := &breakAnalysis{breaks: breaks, sampled: sampled, classCount: classCount, fitMetrics: fitMetrics}
+	cache.put(key, analysis)
+	return analysis, nil
+}
+
+// ChosenBreaks are the breaks chosen by ChooseBreaks
+type ChosenBreaks struct {
+	LowerBounds []float64 // the lower bound of each class, ascending
+	Palette     string    // the name of the palette to colour the classes with
+	BestFit     bool      // true if the number of classes is the best fit for the values, rather than the requested class count
+}
+
+// ChooseBreaks calculates the natural breaks in the values (which need not be sorted), as AnalyseData does, returning the breaks for
+// the requested class count, or for the best fit class count if classCount is 0. If a paletteName is given, the best fit is chosen
+// from the class counts that the palette supports; otherwise the first palette suggested for the class count (see suggestPalettes) is chosen.
+// Returns an error if the values cannot be divided into the classes, or cannot be coloured by the palette.
+func ChooseBreaks(ctx context.Context, values []float64, classCount int, paletteName string) (*ChosenBreaks, error) {
+	var p *palette.Palette
+	if len(paletteName) > 0 {
+		if p = palette.Get(paletteName); p == nil {
+			return nil, fmt.Errorf("Unknown palette '%s'", paletteName)
+		}
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	if countDistinct(sorted) < models.MinClassCount {
+		return nil, fmt.Errorf("The data has fewer than %d distinct values, so cannot be divided into classes", models.MinClassCount)
+	}
+
+	analysis, err := analyseBreaks(ctx, sorted, defaultClassCountFactor)
+	if err != nil {
+		return nil, err
+	}
+	chosen := &ChosenBreaks{BestFit: classCount == 0}
+	if chosen.BestFit {
+		classCount = analysis.classCount
+		if p != nil && !p.SupportsClassCount(classCount) {
+			classCount, _ = bestFitClassCount(sorted, supportedBreaks(analysis.breaks, p), defaultClassCountFactor)
+		}
+	}
+	if chosen.LowerBounds = findBreaks(analysis.breaks, classCount); chosen.LowerBounds == nil {
+		return nil, fmt.Errorf("The data has too few distinct values to be divided into %d classes", classCount)
+	}
+
+	if p != nil {
+		if _, err := p.Colours(classCount); err != nil {
+			return nil, err
+		}
+		chosen.Palette = p.Name
+		return chosen, nil
+	}
+	palettes, _ := suggestPalettes(sorted, classCount, 0)
+	if chosen.Palette = findPaletteName(palettes, classCount); len(chosen.Palette) == 0 {
+		return nil, fmt.Errorf("No palette supports %d classes", classCount)
+	}
+	return chosen, nil
+}
+
+// supportedBreaks returns the breaks for the class counts that the palette supports
+func supportedBreaks(breaks [][]float64, p *palette.Palette) [][]float64 {
+	supported := [][]float64{}
+	for _, b := range breaks {
+		if p.SupportsClassCount(len(b)) {
+			supported = append(supported, b)
+		}
+	}
+	return supported
+}
+
+// findPaletteName returns the name of the first palette with the given number of classes, or empty if there are none
+func findPaletteName(palettes []*models.PaletteSuggestion, classCount int) string {
+	for _, p := range palettes {
+		if p.ClassCount == classCount {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// calculateNaturalBreaks calculates and rounds the natural breaks in the (sorted) values for every class count between 2 and maxClasses,
+// returning the breaks and the number of values they were calculated from (which will be less than len(values) if the values were sampled).
+func calculateNaturalBreaks(ctx context.Context, values []float64, maxClasses int) ([][]float64, int, error) {
+	sample := values
+	if sampleSize > 0 && len(values) > sampleSize {
+		sample = stratifiedSample(values, sampleSize)
+	}
+
+	breaks, err := allNaturalBreaks(ctx, sample, maxClasses)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range breaks {
+		breaks[i] = jenks.Round(breaks[i], values)
+	}
+	return breaks, len(sample), nil
+}
+
+// breaksWorkers is the number of class counts whose natural breaks are calculated concurrently
+var breaksWorkers = runtime.NumCPU()
+
+// naturalBreaks calculates the natural breaks in the (sorted) values for a class count
+var naturalBreaks = jenks.NaturalBreaks
+
+// allNaturalBreaks returns the natural breaks in the (sorted) values for every class count between 2 and maxClasses (or the number of distinct values, if lower),
+// calculating up to breaksWorkers class counts concurrently. Returns ctx.Err() if the context is cancelled before all calculations complete,
+// in which case no further class counts are calculated.
+func allNaturalBreaks(ctx context.Context, values []float64, maxClasses int) ([][]float64, error) {
+	maxClasses = int(math.Min(float64(maxClasses), float64(countDistinct(values))))
+	if maxClasses < 2 {
+		return [][]float64{}, nil
+	}
+
+	counts := make(chan int, maxClasses-1)
+	for n := 2; n <= maxClasses; n++ {
+		counts <- n
+	}
+	close(counts)
+
+	breaks := make([][]float64, maxClasses-1)
+	var wg sync.WaitGroup
+	for i := 0; i < breaksWorkers || i == 0; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range counts {
+				if ctx.Err() != nil {
+					return
+				}
+				breaks[n-2] = naturalBreaks(values, n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return breaks, nil
+}
+
+// stratifiedSample returns size values taken at evenly spaced positions through the (sorted) values - always including the minimum and maximum.
+// The sample is deterministic, so the same data always produces the same breaks.
+func stratifiedSample(values []float64, size int) []float64 {
+	if size < 2 {
+		size = 2
+	}
+	sample := make([]float64, size)
+	step := float64(len(values)-1) / float64(size-1)
+	for i := range sample {
+		sample[i] = values[int(math.Floor((float64(i)*step)+0.5))]
+	}
+	return sample
+}
+
+// countDistinct returns the number of distinct values in the (sorted) values
+func countDistinct(values []float64) int {
+	count := 0
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			count++
+		}
+	}
+	return count
+}
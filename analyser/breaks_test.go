@@ -0,0 +1,42 @@
+package analyser
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAllNaturalBreaksStopsWhenCancelled(t *testing.T) {
+	Convey("allNaturalBreaks should not calculate further class counts once the context is cancelled", t, func() {
+		defer func(workers int, calculate func([]float64, int) []float64) {
+			breaksWorkers = workers
+			naturalBreaks = calculate
+		}(breaksWorkers, naturalBreaks)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		calculated := 0
+		breaksWorkers = 1
+		naturalBreaks = func(values []float64, n int) []float64 {
+			calculated++
+			cancel()
+			return values[:n]
+		}
+
+		breaks, err := allNaturalBreaks(ctx, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 11)
+
+		So(err, ShouldEqual, context.Canceled)
+		So(breaks, ShouldBeNil)
+		So(calculated, ShouldEqual, 1)
+	})
+
+	Convey("allNaturalBreaks should calculate every class count when not cancelled", t, func() {
+		breaks, err := allNaturalBreaks(context.Background(), []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 11)
+
+		So(err, ShouldBeNil)
+		So(len(breaks), ShouldEqual, 10)
+		for i, b := range breaks {
+			So(len(b), ShouldEqual, i+2)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package analyser
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"sync"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// defaultBreaksCacheSize is the default number of break analyses held by the BreaksCache
+const defaultBreaksCacheSize = 32
+
+// BreaksCache holds the most recently used break analyses (the natural breaks and fit metrics of a set of values), keyed by a fingerprint of
+// the values and the parameters of the analysis, so that analysing the same data again (e.g. while the presentation options are changed)
+// does not recalculate the breaks. Only the breaks are cached - matching the data to the geography is always repeated, as the geography may differ.
+// A BreaksCache is safe for concurrent use.
+type BreaksCache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // of *breaksCacheEntry, the most recently used first
+	hits    int64
+	misses  int64
+}
+
+type breaksCacheEntry struct {
+	key      string
+	analysis *breakAnalysis
+}
+
+// BreaksCacheSnapshot summarises the use of a BreaksCache
+type BreaksCacheSnapshot struct {
+	Size    int     `json:"size"`
+	Entries int     `json:"entries"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`   // the number of analyses calculated because they were not in the cache
+	HitRate float64 `json:"hit_rate"` // hits as a fraction of all lookups, or 0 if there have been none
+}
+
+// NewBreaksCache creates an empty BreaksCache holding up to size analyses. A size of 0 (or less) caches nothing, but still counts the misses.
+func NewBreaksCache(size int) *BreaksCache {
+	return &BreaksCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// breaksCache is the BreaksCache used by AnalyseData and ChooseBreaks
+var breaksCache = NewBreaksCache(defaultBreaksCacheSize)
+
+// UseBreaksCache sets the BreaksCache used by AnalyseData and ChooseBreaks, replacing the default cache (see defaultBreaksCacheSize).
+// A cache with a size of 0 disables caching.
+func UseBreaksCache(cache *BreaksCache) {
+	breaksCache = cache
+}
+
+// CurrentBreaksCacheSnapshot returns a summary of the use of the BreaksCache used by AnalyseData and ChooseBreaks
+func CurrentBreaksCacheSnapshot() BreaksCacheSnapshot {
+	return breaksCache.Snapshot()
+}
+
+// Snapshot returns a summary of the use of the cache
+func (c *BreaksCache) Snapshot() BreaksCacheSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	snapshot := BreaksCacheSnapshot{Size: c.size, Entries: c.order.Len(), Hits: c.hits, Misses: c.misses}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		snapshot.HitRate = float64(c.hits) / float64(lookups)
+	}
+	return snapshot
+}
+
+// get returns a copy of the analysis cached with the given key, or nil (counting a miss) if there is none
+func (c *BreaksCache) get(key string) *breakAnalysis {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*breaksCacheEntry).analysis.copy()
+}
+
+// put caches a copy of the analysis with the given key, removing the least recently used analysis if the cache is full
+func (c *BreaksCache) put(key string, analysis *breakAnalysis) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.size <= 0 {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*breaksCacheEntry).analysis = analysis.copy()
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&breaksCacheEntry{key: key, analysis: analysis.copy()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*breaksCacheEntry).key)
+	}
+}
+
+// breaksFingerprint returns the key of the analysis of the (sorted) values with the given classCountFactor, which includes every parameter
+// that changes the analysis - the maximum class count and sample size as well as the values themselves
+func breaksFingerprint(values []float64, classCountFactor float64) string {
+	hash := sha256.New()
+	b := make([]byte, 8)
+	for _, v := range values {
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+		hash.Write(b)
+	}
+	for _, parameter := range []float64{classCountFactor, float64(models.MaxClassCount), float64(sampleSize), float64(len(values))} {
+		binary.LittleEndian.PutUint64(b, math.Float64bits(parameter))
+		hash.Write(b)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// copy returns a copy of the analysis that shares none of its slices, so that neither a cached analysis nor the copy returned can change the other
+func (a *breakAnalysis) copy() *breakAnalysis {
+	breaks := make([][]float64, len(a.breaks))
+	for i, b := range a.breaks {
+		breaks[i] = append([]float64{}, b...)
+	}
+	fitMetrics := make([]*models.FitMetric, len(a.fitMetrics))
+	for i, m := range a.fitMetrics {
+		metric := *m
+		fitMetrics[i] = &metric
+	}
+	return &breakAnalysis{breaks: breaks, sampled: a.sampled, classCount: a.classCount, fitMetrics: fitMetrics}
+}
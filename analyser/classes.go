@@ -0,0 +1,67 @@
+package analyser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// classCounts returns the number of the (sorted) values in each class of the breaks (the ascending lower bound of each class).
+// As when the map is rendered, the first class also includes any values below its lower bound, and the last class every value from its lower bound upwards.
+func classCounts(values []float64, breaks []float64) []int {
+	counts := make([]int, len(breaks))
+	for i, lower := range breaks {
+		start := 0
+		if i > 0 {
+			start = sort.SearchFloat64s(values, lower)
+		}
+		end := len(values)
+		if i < len(breaks)-1 {
+			end = sort.SearchFloat64s(values, breaks[i+1])
+		}
+		counts[i] = end - start
+	}
+	return counts
+}
+
+// describeEmptyClasses returns a description of the classes of the breaks that contain none of the (sorted) values
+// (e.g. "class 3 (10 to 12), class 5 (20 and above)"), or empty if every class contains a value. Classes are numbered from 1.
+func describeEmptyClasses(values []float64, breaks []float64) string {
+	empty := []string{}
+	for i, count := range classCounts(values, breaks) {
+		if count > 0 {
+			continue
+		}
+		if i < len(breaks)-1 {
+			empty = append(empty, fmt.Sprintf("class %d (%g to %g)", i+1, breaks[i], breaks[i+1]))
+		} else {
+			empty = append(empty, fmt.Sprintf("class %d (%g and above)", i+1, breaks[i]))
+		}
+	}
+	return strings.Join(empty, ", ")
+}
+
+// emptyClassMessages returns a warning listing the suggested break sets that have classes containing none of the (sorted) values,
+// whose colours would appear in the legend but not on the map, and a warning for each of the candidate break sets of the request that does.
+func emptyClassMessages(values []float64, breaks [][]float64, candidates [][]float64) []*models.Message {
+	messages := []*models.Message{}
+	suggested := &idList{}
+	for _, b := range breaks {
+		if empty := describeEmptyClasses(values, b); len(empty) > 0 {
+			suggested.addWithDetail(fmt.Sprintf("%d classes", len(b)), fmt.Sprintf("%d classes: %s", len(b), empty))
+		}
+	}
+	if suggested.count > 0 {
+		messages = append(messages, suggested.message("warn", models.MessageCodeEmptyClasses,
+			fmt.Sprintf("The suggested breaks for %d class counts have classes containing no values, whose colours would not appear on the map. Class counts: %v", suggested.count, suggested)))
+	}
+	for i, b := range candidates {
+		if empty := describeEmptyClasses(values, b); len(empty) > 0 {
+			messages = append(messages, &models.Message{Level: "warn", Code: models.MessageCodeEmptyClasses, Count: 1, Details: []string{empty},
+				Text: fmt.Sprintf("The candidate breaks %v (candidate_breaks[%d]) have classes containing no values, whose colours would not appear on the map: %s", b, i, empty)})
+		}
+	}
+	return messages
+}
@@ -0,0 +1,79 @@
+package analyser
+
+import (
+	"sort"
+
+	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/paulmach/go.geojson"
+)
+
+// largestFeatureCount is the number of features listed in the geography summary
+const largestFeatureCount = 5
+
+// summariseGeography adds the bounding box, geometry types and largest features of the geography to the summary
+func summariseGeography(geography *models.Geography, summary *models.TopologySummary) {
+	idProperty, nameProperty := geography.IDProperty, geography.NameProperty
+	fc := geography.Geojson
+	if fc != nil {
+		summary.BoundingBox = fc.BoundingBox
+	} else {
+		fc = geography.Topojson.ToGeoJSON()
+		summary.BoundingBox = geography.Topojson.BoundingBox
+	}
+	if len(summary.BoundingBox) != 4 {
+		summary.BoundingBox = geojson2svg.BoundingBox(fc)
+	}
+
+	types := make(map[string]bool)
+	features := []*models.FeatureSummary{}
+	for _, f := range fc.Features {
+		if f.Geometry == nil {
+			continue
+		}
+		types[string(f.Geometry.Type)] = true
+		features = append(features, &models.FeatureSummary{
+			ID:   featureID(f, idProperty),
+			Name: featureName(f, nameProperty),
+			Area: geojson2svg.Area(func(x, y float64) (float64, float64) { return x, y }, f.Geometry),
+		})
+	}
+
+	summary.GeometryTypes = []string{}
+	for t := range types {
+		summary.GeometryTypes = append(summary.GeometryTypes, t)
+	}
+	sort.Strings(summary.GeometryTypes)
+
+	sort.Slice(features, func(i, j int) bool {
+		if features[i].Area == features[j].Area {
+			return features[i].ID < features[j].ID
+		}
+		return features[i].Area > features[j].Area
+	})
+	if len(features) > largestFeatureCount {
+		features = features[:largestFeatureCount]
+	}
+	summary.LargestFeatures = features
+}
+
+// featureID returns the value of the idProperty of the feature if it has one, otherwise the feature id
+func featureID(f *geojson.Feature, idProperty string) string {
+	id, isValid := models.FormatID(f.Properties[idProperty])
+	if isValid && len(id) > 0 {
+		return id
+	}
+	return geojsonFeatureID(f)
+}
+
+// geojsonFeatureID returns the id of the feature as a string, or an empty string if it has none
+func geojsonFeatureID(f *geojson.Feature) string {
+	id, _ := models.FormatID(f.ID)
+	return id
+}
+
+// featureName returns the value of the nameProperty of the feature, or an empty string if it has none
+func featureName(f *geojson.Feature, nameProperty string) string {
+	name, _ := f.Properties[nameProperty].(string)
+	return name
+}
@@ -0,0 +1,110 @@
+package analyser
+
+import (
+	"io"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// The maximum number of rows and columns scanned to find the column of ids (see detectIDColumn)
+const (
+	maxDetectionRows    = 1000
+	maxDetectionColumns = 50
+)
+
+// idColumn is the column of a csv (or spreadsheet) that best matches the ids of a geography
+type idColumn struct {
+	index   int // the index of the column, or -1 if no column matches any id
+	matched int // the number of rows scanned whose value in the column is the id of a region
+	scanned int // the number of rows scanned (excluding blank rows and any header)
+}
+
+// percentage returns the percentage of the rows scanned that matched, rounded down
+func (c *idColumn) percentage() int {
+	if c.scanned == 0 {
+		return 0
+	}
+	return 100 * c.matched / c.scanned
+}
+
+// detectIDColumn reads up to maxDetectionRows rows, finding the column (other than the valueIndex, and of the first maxDetectionColumns)
+// whose values match the most ids of the geography (either exactly or once normalised) - the first such column if several match equally.
+// Returns the column, and a reader that reads the rows already read again before the rest of the records.
+func detectIDColumn(records recordReader, valueIndex int, hasHeader bool, ids map[string]string, normalisedIDs map[string]string, normalisation *models.IDNormalisation) (*idColumn, recordReader) {
+	replay := &replayRecordReader{source: records}
+	matches := make([]int, maxDetectionColumns)
+	scanned := 0
+	headerSkipped := !hasHeader
+	for scanned < maxDetectionRows {
+		record, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			replay.err = err // reported when the rows are parsed
+			break
+		}
+		replay.records = append(replay.records, append([]string{}, record...)) // the csv reader reuses the record
+		replay.rowNumbers = append(replay.rowNumbers, records.RowNumber())
+		if isBlank(record) {
+			continue
+		}
+		if !headerSkipped {
+			headerSkipped = true
+			continue
+		}
+		scanned++
+		for i, field := range record {
+			if i >= maxDetectionColumns {
+				break
+			}
+			if _, ok := ids[field]; ok {
+				matches[i]++
+			} else if _, ok := normalisedIDs[normalisation.Normalise(field)]; ok {
+				matches[i]++
+			}
+		}
+	}
+
+	best := &idColumn{index: -1, scanned: scanned}
+	for i, matched := range matches {
+		if i != valueIndex && matched > best.matched {
+			best.index, best.matched = i, matched
+		}
+	}
+	return best, replay
+}
+
+// defaultIDIndex returns the index of the first column that is not the valueIndex - the id column when it cannot be detected
+func defaultIDIndex(valueIndex int) int {
+	if valueIndex == 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayRecordReader returns records already read from the source (with their row numbers), followed by any error reading them, then the rest of the source
+type replayRecordReader struct {
+	sliceRecordReader
+	source recordReader
+	err    error
+}
+
+func (r *replayRecordReader) Read() ([]string, error) {
+	if r.next < len(r.records) {
+		return r.sliceRecordReader.Read()
+	}
+	r.next = len(r.records) + 1 // the row number is now that of the source
+	if err := r.err; err != nil {
+		r.err = nil
+		return nil, err
+	}
+	return r.source.Read()
+}
+
+func (r *replayRecordReader) RowNumber() int {
+	if r.next <= len(r.records) {
+		return r.sliceRecordReader.RowNumber()
+	}
+	return r.source.RowNumber()
+}
@@ -0,0 +1,196 @@
+package analyser
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+)
+
+// maxNameDistance is the maximum Levenshtein distance between a (normalised) csv id and topology name for them to be considered a match
+const maxNameDistance = 2
+
+// maxFuzzyMatchRows is the maximum number of unmatched rows for which a match with a topology name is attempted
+const maxFuzzyMatchRows = 1000
+
+// suggestMappings attempts to match each of the unmatched csv ids against the names in the topology (found using nameProperty),
+// returning a suggested mapping from csv id to topology id for each that is found. The mappings are not applied.
+func suggestMappings(geography *models.Geography, unmatched []string) []*models.IDMapping {
+	if len(geography.NameProperty) == 0 || len(unmatched) == 0 {
+		return nil
+	}
+	names := getTopologyNames(geography)
+	if len(names) == 0 {
+		return nil
+	}
+
+	// names that are the same once normalised (e.g. "St. Helens" and "St Helens") are ambiguous, unless they have the same id
+	normalisedNames := make(map[string]string, len(names))
+	for name, id := range names {
+		n := normaliseName(name)
+		other, exists := normalisedNames[n]
+		switch {
+		case !exists:
+			normalisedNames[n] = name
+		case len(other) == 0 || names[other] != id:
+			normalisedNames[n] = ""
+		case name < other:
+			normalisedNames[n] = name
+		}
+	}
+	candidates := make([]string, 0, len(normalisedNames))
+	for n := range normalisedNames {
+		candidates = append(candidates, n)
+	}
+	sort.Strings(candidates) // for consistent results
+
+	mappings := []*models.IDMapping{}
+	seen := make(map[string]bool)
+	for _, csvID := range unmatched {
+		if seen[csvID] {
+			continue
+		}
+		seen[csvID] = true
+		if len(seen) > maxFuzzyMatchRows {
+			break
+		}
+		normalised := normaliseName(csvID)
+		if len(normalised) == 0 {
+			continue
+		}
+		name, distance := closestName(normalised, candidates, normalisedNames)
+		if len(name) == 0 {
+			continue
+		}
+		confidence := 1.0 - (float64(distance) / float64(maxInt(len([]rune(normalised)), len([]rune(normaliseName(name))))))
+		mappings = append(mappings, &models.IDMapping{CSVValue: csvID, TopologyID: names[name], TopologyName: name, Confidence: confidence})
+	}
+	return mappings
+}
+
+// closestName returns the (original) name whose normalised form is nearest to the given normalised id, along with the distance,
+// where candidates are the (sorted) keys of normalisedNames, a map of normalised name to name.
+// Returns an empty name if there is no name within maxNameDistance (or a quarter of the length of the id), if two names are equally close,
+// or if the nearest normalised name is ambiguous (i.e. has an empty name).
+func closestName(normalised string, candidates []string, normalisedNames map[string]string) (string, int) {
+	if name, exists := normalisedNames[normalised]; exists {
+		return name, 0
+	}
+
+	maxDistance := maxNameDistance
+	if l := len([]rune(normalised)) / 4; l < maxDistance {
+		maxDistance = l
+	}
+
+	best, bestDistance, ambiguous := "", maxDistance+1, false
+	for _, n := range candidates {
+		if absInt(len(n)-len(normalised)) > maxDistance {
+			continue
+		}
+		d := levenshtein(normalised, n)
+		if d < bestDistance {
+			best, bestDistance, ambiguous = n, d, false
+		} else if d == bestDistance {
+			ambiguous = true
+		}
+	}
+	if len(best) == 0 || ambiguous {
+		return "", 0
+	}
+	return normalisedNames[best], bestDistance
+}
+
+// getTopologyNames returns a map of name to id for each object (or feature) in the geography that has a name
+func getTopologyNames(geography *models.Geography) map[string]string {
+	m := make(map[string]string)
+	if geography.Geojson != nil {
+		for _, f := range geography.Geojson.Features {
+			addFeatureName(f, geography.IDProperty, geography.NameProperty, m)
+		}
+		return m
+	}
+	for _, o := range geography.Topojson.Objects {
+		addGeographyNames(o, geography.IDProperty, geography.NameProperty, m)
+	}
+	return m
+}
+
+func addGeographyNames(geometry *topojson.Geometry, idProperty string, nameProperty string, m map[string]string) {
+	if geometry.Type == "GeometryCollection" {
+		for _, g := range geometry.Geometries {
+			addGeographyNames(g, idProperty, nameProperty, m)
+		}
+		return
+	}
+	name, isString := geometry.Properties[nameProperty].(string)
+	if !isString || len(name) == 0 {
+		return
+	}
+	id, isValid := models.FormatID(geometry.Properties[idProperty])
+	if !isValid || len(id) == 0 {
+		id = geometry.ID
+	}
+	m[name] = id
+}
+
+// addFeatureName is the equivalent of addGeographyNames for a geojson feature
+func addFeatureName(f *geojson.Feature, idProperty string, nameProperty string, m map[string]string) {
+	name := featureName(f, nameProperty)
+	if len(name) == 0 {
+		return
+	}
+	m[name] = featureID(f, idProperty)
+}
+
+// normaliseName lower cases the name, replacing any sequence of characters other than letters and digits with a single space
+func normaliseName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// levenshtein returns the number of single character edits (insertions, deletions or substitutions) needed to change a into b
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,72 @@
+package analyser
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// The text suggested for a reference line of the mean or median of the values
+const (
+	meanReferenceText   = "Average"
+	medianReferenceText = "Median"
+)
+
+// extractReferenceRow finds the row whose id is the reference of the request (comparing normalised ids if the request has an IDNormalisation),
+// returning nil if the reference is the mean or median, or there is no such row. A row that is not in the geography (i.e. not in ids),
+// such as the national figure of a regional map, is removed from the parsed rows, so that it is neither reported as unmatched nor included in the breaks.
+// normalisedIDs are the ids keyed by their normalised form (nil if the request has no IDNormalisation) - see normaliseIDs.
+func extractReferenceRow(info *parseInfo, request *models.AnalyseRequest, ids map[string]string, normalisedIDs map[string]string) *models.DataRow {
+	if len(request.Reference) == 0 || request.Reference == models.ReferenceMean || request.Reference == models.ReferenceMedian {
+		return nil
+	}
+	reference := request.IDNormalisation.Normalise(request.Reference)
+	for i, row := range info.rows {
+		if row.Missing || request.IDNormalisation.Normalise(row.ID) != reference {
+			continue
+		}
+		_, inGeography := ids[row.ID]
+		if !inGeography && normalisedIDs != nil {
+			_, inGeography = normalisedIDs[request.IDNormalisation.Normalise(row.ID)]
+		}
+		if !inGeography && len(info.rows) > 1 {
+			info.rows = append(info.rows[:i:i], info.rows[i+1:]...)
+			info.rowNumbers = append(info.rowNumbers[:i:i], info.rowNumbers[i+1:]...)
+		}
+		return row
+	}
+	return nil
+}
+
+// suggestReferenceLine returns the reference line of the request - the value of the referenceRow (labelled with the name of its region, or its id
+// if it is not in the geography), or the mean or median of the values, rounded to the given number of decimal places. If the request names a row that
+// could not be found, the mean is suggested instead, with a warning message. Returns nil if the request has no reference.
+func suggestReferenceLine(request *models.AnalyseRequest, referenceRow *models.DataRow, statistics *models.Statistics, decimalPlaces int) (*models.ReferenceLine, *models.Message) {
+	switch {
+	case len(request.Reference) == 0:
+		return nil, nil
+	case request.Reference == models.ReferenceMedian:
+		return &models.ReferenceLine{Value: roundTo(statistics.Median, decimalPlaces), Text: medianReferenceText}, nil
+	case request.Reference == models.ReferenceMean:
+		return &models.ReferenceLine{Value: roundTo(statistics.Mean, decimalPlaces), Text: meanReferenceText}, nil
+	case referenceRow == nil:
+		return &models.ReferenceLine{Value: roundTo(statistics.Mean, decimalPlaces), Text: meanReferenceText},
+			&models.Message{Level: "warn", Code: models.MessageCodeMissingReference, Count: 1, Details: []string{request.Reference},
+				Text: fmt.Sprintf("The reference row '%s' could not be found in the data - the mean of the values is suggested as the reference instead", request.Reference)}
+	}
+	text := referenceRow.ID
+	for name, id := range getTopologyNames(request.Geography) {
+		if id == referenceRow.ID {
+			text = name
+			break
+		}
+	}
+	return &models.ReferenceLine{Value: referenceRow.Value, Text: text}, nil
+}
+
+// roundTo rounds the value to the given number of decimal places
+func roundTo(value float64, decimalPlaces int) float64 {
+	factor := math.Pow(10, float64(decimalPlaces))
+	return math.Round(value*factor) / factor
+}
@@ -0,0 +1,251 @@
+package analyser
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+)
+
+// maxXLSXColumns is the number of columns in an xlsx sheet - the last column is XFD
+const maxXLSXColumns = 16384
+
+// defaultMaxXLSXEntrySize is the default maximum uncompressed size of each file read from an xlsx file
+const defaultMaxXLSXEntrySize = 100 << 20
+
+var maxXLSXEntrySize int64 = defaultMaxXLSXEntrySize
+
+// UseMaxXLSXEntrySize sets the maximum uncompressed size, in bytes, of each file (e.g. a sheet) read from an xlsx file. A value of 0 (or less) removes the limit.
+func UseMaxXLSXEntrySize(size int64) {
+	maxXLSXEntrySize = size
+}
+
+// workbook is the subset of xl/workbook.xml needed to locate the sheets
+type workbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// relationships is the content of xl/_rels/workbook.xml.rels
+type relationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// sharedStrings is the content of xl/sharedStrings.xml
+type sharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+// worksheet is the subset of a worksheet needed to read the cell values
+type worksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref          string `xml:"r,attr"`
+			Type         string `xml:"t,attr"`
+			Value        string `xml:"v"`
+			InlineString string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reads the rows of a sheet in the given xlsx file, returning a reader of the value of each cell as a string (using the cached value of formula cells).
+// The sheet is identified by name if sheetName is given, otherwise by its (0-based) index.
+func readXLSX(data []byte, sheetName string, sheetIndex int) (*sliceRecordReader, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read xlsx file: %v", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+
+	var wb workbook
+	if err := unmarshalZipFile(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	var rels relationships
+	if err := unmarshalZipFile(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	var strs sharedStrings
+	if _, exists := files["xl/sharedStrings.xml"]; exists {
+		if err := unmarshalZipFile(files, "xl/sharedStrings.xml", &strs); err != nil {
+			return nil, err
+		}
+	}
+
+	rid, err := findSheet(&wb, sheetName, sheetIndex)
+	if err != nil {
+		return nil, err
+	}
+	target := ""
+	for _, r := range rels.Relationships {
+		if r.ID == rid {
+			target = r.Target
+		}
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	var ws worksheet
+	if err := unmarshalZipFile(files, target, &ws); err != nil {
+		return nil, err
+	}
+
+	records := &sliceRecordReader{records: make([][]string, 0, len(ws.Rows))}
+	for i, r := range ws.Rows {
+		row := []string{}
+		for j, c := range r.Cells {
+			col := columnIndex(c.Ref)
+			if col < 0 {
+				col = j
+			}
+			if col >= maxXLSXColumns {
+				return nil, fmt.Errorf("Unable to read cell %s in xlsx file: column is beyond XFD, the last column of a sheet", c.Ref)
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			row[col], err = cellValue(c.Type, c.Value, c.InlineString, &strs)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read cell %s in xlsx file: %v", c.Ref, err)
+			}
+		}
+		if len(row) > 0 {
+			number := r.Number
+			if number == 0 {
+				number = i + 1
+			}
+			records.records = append(records.records, row)
+			records.rowNumbers = append(records.rowNumbers, number)
+		}
+	}
+	return records, nil
+}
+
+// findSheet returns the relationship id of the sheet with the given name, or at the given index if no name is given
+func findSheet(wb *workbook, sheetName string, sheetIndex int) (string, error) {
+	if len(sheetName) > 0 {
+		for _, s := range wb.Sheets {
+			if s.Name == sheetName {
+				return s.RID, nil
+			}
+		}
+		return "", fmt.Errorf("xlsx file does not contain a sheet named '%s'", sheetName)
+	}
+	if sheetIndex < 0 || sheetIndex >= len(wb.Sheets) {
+		return "", fmt.Errorf("xlsx file does not contain a sheet with index %d - it has %d sheets", sheetIndex, len(wb.Sheets))
+	}
+	return wb.Sheets[sheetIndex].RID, nil
+}
+
+// cellValue returns the value of a cell as a string, looking up shared strings
+func cellValue(cellType string, value string, inlineString string, strs *sharedStrings) (string, error) {
+	switch cellType {
+	case "s":
+		var i int
+		if _, err := fmt.Sscan(value, &i); err != nil || i < 0 || i >= len(strs.Items) {
+			return "", fmt.Errorf("invalid shared string index '%s'", value)
+		}
+		item := strs.Items[i]
+		if len(item.Runs) == 0 {
+			return item.Text, nil
+		}
+		s := ""
+		for _, r := range item.Runs {
+			s += r.Text
+		}
+		return s, nil
+	case "inlineStr":
+		return inlineString, nil
+	case "b":
+		if value == "1" {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	default: // numbers, formula strings (str) and errors (e)
+		return value, nil
+	}
+}
+
+// columnIndex returns the 0-based column index of a cell reference such as "AB12", or -1 if the reference has no column.
+// Any column beyond maxXLSXColumns is returned as maxXLSXColumns.
+func columnIndex(ref string) int {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		if col <= maxXLSXColumns {
+			col = (col * 26) + int(ref[i]-'A'+1)
+		}
+	}
+	if i == 0 {
+		return -1
+	}
+	return col - 1
+}
+
+func unmarshalZipFile(files map[string]*zip.File, name string, v interface{}) error {
+	f, exists := files[name]
+	if !exists {
+		return fmt.Errorf("Unable to read xlsx file: missing %s", name)
+	}
+	if maxXLSXEntrySize > 0 && f.UncompressedSize64 > uint64(maxXLSXEntrySize) {
+		return fmt.Errorf("Unable to read xlsx file: %s is larger than the maximum of %d bytes", name, maxXLSXEntrySize)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("Unable to read xlsx file: %v", err)
+	}
+	defer r.Close()
+	// the uncompressed size in the zip may be wrong, so the content is limited too
+	limited := &io.LimitedReader{R: r, N: maxXLSXEntrySize + 1}
+	if maxXLSXEntrySize <= 0 {
+		limited.N = math.MaxInt64
+	}
+	err = xml.NewDecoder(limited).Decode(v)
+	if limited.N == 0 {
+		return fmt.Errorf("Unable to read xlsx file: %s is larger than the maximum of %d bytes", name, maxXLSXEntrySize)
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("Unable to read xlsx file %s: %v", name, err)
+	}
+	return nil
+}
+
+// sliceRecordReader returns each of a slice of records in turn, in the same way as csv.Reader
+type sliceRecordReader struct {
+	records    [][]string
+	rowNumbers []int
+	next       int
+}
+
+func (r *sliceRecordReader) RowNumber() int {
+	return r.rowNumbers[r.next-1]
+}
+
+func (r *sliceRecordReader) Read() ([]string, error) {
+	if r.next >= len(r.records) {
+		return nil, io.EOF
+	}
+	r.next++
+	return r.records[r.next-1], nil
+}
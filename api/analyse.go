@@ -4,29 +4,59 @@ import (
 	"net/http"
 
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ONSdigital/dp-map-renderer/analyser"
+	"github.com/ONSdigital/dp-map-renderer/health"
 	"github.com/ONSdigital/dp-map-renderer/models"
 	"github.com/ONSdigital/go-ns/log"
 )
 
 func (api *RendererAPI) analyseData(w http.ResponseWriter, r *http.Request) {
 
+	atomic.AddInt64(&analysesInFlight, 1)
+	defer atomic.AddInt64(&analysesInFlight, -1)
+	defer health.TrackTime(time.Now(), "analyse")
 	log.Debug("analyseData", log.Data{"headers": r.Header})
-	request, err := models.CreateAnalyseRequest(r.Body)
+	var request *models.AnalyseRequest
+	var err error
+	if isMultipart(r) {
+		request, err = createMultipartAnalyseRequest(w, r)
+	} else if isStrict(r) {
+		request, err = models.CreateAnalyseRequestStrict(r.Body)
+	} else {
+		request, err = models.CreateAnalyseRequest(r.Body)
+	}
+	if err == errUploadTooLarge {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		log.Error(err, nil)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if err = request.ResolveGeography(lookupGeography); err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
 	if err = request.ValidateAnalyseRequest(); err != nil {
 		log.Error(err, log.Data{"_message": "AnalyseRequest failed validation"})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), validationErrorCode(err))
 		return
 	}
 
-	response, err := analyser.AnalyseData(request)
+	response, err := analyser.AnalyseDataWithContext(r.Context(), request)
 	if err != nil {
 		log.Error(err, log.Data{"_message": "Unable to Analyse request"})
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -51,3 +81,74 @@ func (api *RendererAPI) analyseData(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// maxMultipartMemory is the maximum number of bytes of a multipart request held in memory - the remainder is stored in temporary files
+const maxMultipartMemory = 32 << 20
+
+// defaultMaxUploadSize is the default maximum size of a multipart analyse request
+const defaultMaxUploadSize = 32 << 20
+
+var maxUploadSize int64 = defaultMaxUploadSize
+
+// UseMaxUploadSize sets the maximum size, in bytes, of a multipart analyse request (i.e. an uploaded csv or xlsx file and its json request).
+// Larger requests are rejected with 413 Request Entity Too Large. A value of 0 (or less) removes the limit.
+func UseMaxUploadSize(size int64) {
+	maxUploadSize = size
+}
+
+// errUploadTooLarge is returned when a multipart analyse request is larger than maxUploadSize
+var errUploadTooLarge = errors.New("The uploaded file is too large")
+
+// xlsx content type
+var contentXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// isMultipart returns true if the request has a multipart/form-data body
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// createMultipartAnalyseRequest creates an AnalyseRequest from a multipart form, where the 'request' field contains the json request
+// and the 'file' field contains the csv or xlsx file (identified by its file name or content type)
+// The request is limited to maxUploadSize.
+func createMultipartAnalyseRequest(w http.ResponseWriter, r *http.Request) (*models.AnalyseRequest, error) {
+	if maxUploadSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	}
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errUploadTooLarge
+		}
+		return nil, fmt.Errorf("Unable to read multipart form: %v", err)
+	}
+
+	var request *models.AnalyseRequest
+	var err error
+	if isStrict(r) {
+		request, err = models.CreateAnalyseRequestStrict(strings.NewReader(r.FormValue("request")))
+	} else {
+		request, err = models.CreateAnalyseRequest(strings.NewReader(r.FormValue("request")))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file from multipart form: %v", err)
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, models.ErrorReadingBody
+	}
+
+	if strings.HasSuffix(strings.ToLower(header.Filename), ".xlsx") || header.Header.Get("Content-Type") == contentXLSX {
+		request.XLSX = content
+	} else {
+		request.CSV = string(content)
+	}
+	return request, nil
+}
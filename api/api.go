@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/renderer"
 	"github.com/ONSdigital/go-ns/log"
 	"github.com/ONSdigital/go-ns/server"
 	"github.com/gorilla/handlers"
@@ -14,15 +16,19 @@ import (
 
 var httpServer *server.Server
 
+// debugServer serves the debug endpoints, if they have their own bind address - see UseDebugEndpoints
+var debugServer *server.Server
+
 // RendererAPI manages rendering tables from json
 type RendererAPI struct {
-	router *mux.Router
+	router      *mux.Router
+	mapRenderer *renderer.Renderer
 }
 
-// CreateRendererAPI manages all the routes configured to the renderer
-func CreateRendererAPI(bindAddr string, allowedOrigins string, errorChan chan error) {
+// CreateRendererAPI manages all the routes configured to the renderer, rendering maps with mapRenderer
+func CreateRendererAPI(bindAddr string, allowedOrigins string, mapRenderer *renderer.Renderer, errorChan chan error) {
 	router := mux.NewRouter()
-	routes(router)
+	routes(router, mapRenderer)
 
 	httpServer = server.New(bindAddr, createCORSHandler(allowedOrigins, router))
 	// Disable this here to allow main to manage graceful shutdown of the entire app.
@@ -35,33 +41,79 @@ func CreateRendererAPI(bindAddr string, allowedOrigins string, errorChan chan er
 			errorChan <- err
 		}
 	}()
+
+	if debugEnabled && len(debugBindAddr) > 0 {
+		debugRouter := mux.NewRouter()
+		debugRoutes(debugRouter)
+		debugServer = server.New(debugBindAddr, debugRouter)
+		debugServer.HandleOSSignals = false
+
+		go func() {
+			log.Debug("Starting debug endpoints...", log.Data{"bind_addr": debugBindAddr})
+			if err := debugServer.ListenAndServe(); err != nil {
+				log.ErrorC("Main", err, log.Data{"MethodInError": "debugServer.ListenAndServe()"})
+				errorChan <- err
+			}
+		}()
+	}
 }
 
 // createCORSHandler wraps the router in a CORS handler that responds to OPTIONS requests and returns the headers necessary to allow CORS-enabled clients to work
 func createCORSHandler(allowedOrigins string, router *mux.Router) http.Handler {
 	headersOk := handlers.AllowedHeaders([]string{"Accept", "Content-Type", "Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "X-Requested-With"})
 	originsOk := handlers.AllowedOrigins([]string{allowedOrigins})
-	methodsOk := handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS"})
+	methodsOk := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
 
 	return handlers.CORS(originsOk, headersOk, methodsOk)(router)
 }
 
 // routes contain all endpoints for the renderer
-func routes(router *mux.Router) *RendererAPI {
-	api := RendererAPI{router: router}
+func routes(router *mux.Router, mapRenderer *renderer.Renderer) *RendererAPI {
+	api := RendererAPI{router: router, mapRenderer: mapRenderer}
+	models.UsePresetLookup(lookupPreset)
 
 	router.Path("/healthcheck").Methods("GET").HandlerFunc(health.EmptyHealthcheck)
+	router.Path("/ready").Methods("GET").HandlerFunc(health.Readiness)
+	router.Path("/version").Methods("GET").HandlerFunc(health.VersionHandler)
+	router.Use(serverHeader)
+	router.Use(cacheHeaders)
 
 	api.router.HandleFunc("/render/{render_type}", api.renderMap).Methods("POST")
+	api.router.HandleFunc("/render-csv/{render_type}", api.renderCSV).Methods("POST")
 	api.router.HandleFunc("/analyse", api.analyseData).Methods("POST")
+	api.router.HandleFunc("/convert/"+models.ConversionTopoJSONToGeoJSON, api.convertTopoJSONToGeoJSON).Methods("POST")
+	api.router.HandleFunc("/convert/"+models.ConversionGeoJSONToTopoJSON, api.convertGeoJSONToTopoJSON).Methods("POST")
+	api.router.HandleFunc("/topology/simplify", api.simplifyTopology).Methods("POST")
+	api.router.HandleFunc("/geographies/{id}", api.putGeography).Methods("PUT")
+	api.router.HandleFunc("/geographies/{id}", api.getGeography).Methods("GET")
+	api.router.HandleFunc("/geographies/{id}", api.deleteGeography).Methods("DELETE")
+	api.router.HandleFunc("/presets/{id}", api.putPreset).Methods("PUT")
+	api.router.HandleFunc("/presets/{id}", api.getPreset).Methods("GET")
+	api.router.HandleFunc("/presets/{id}", api.deletePreset).Methods("DELETE")
+	if debugEnabled && len(debugBindAddr) == 0 {
+		debugRoutes(router)
+	}
 	return &api
 }
 
+// serverHeader identifies the version of the service in the Server header of every response
+func serverHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", health.ServerHeader())
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Close represents the graceful shutting down of the http server
 func Close(ctx context.Context) error {
 	if err := httpServer.Shutdown(ctx); err != nil {
 		return err
 	}
+	if debugServer != nil {
+		if err := debugServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
 
 	log.Info("graceful shutdown of http server complete", nil)
 	return nil
@@ -3,40 +3,59 @@ package api
 import (
 	"testing"
 
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	"bytes"
 
+	"github.com/ONSdigital/dp-map-renderer/analyser"
+	"github.com/ONSdigital/dp-map-renderer/geography"
 	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/ONSdigital/dp-map-renderer/models"
 	"github.com/ONSdigital/dp-map-renderer/renderer"
 	"github.com/ONSdigital/dp-map-renderer/testdata"
+	"github.com/ONSdigital/go-ns/log"
 	"github.com/gorilla/mux"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 var (
-	host          = "http://localhost:80"
-	requestSVGURL = host + "/render/svg"
-	requestPNGURL = host + "/render/png"
-	analyseURL    = host + "/analyse"
+	host           = "http://localhost:80"
+	requestSVGURL  = host + "/render/svg"
+	requestPNGURL  = host + "/render/png"
+	requestAllURL  = host + "/render/all"
+	requestPageURL = host + "/render/page"
+	metricsURL     = host + "/render/metrics"
+	renderCSVURL   = host + "/render-csv/svg"
+	analyseURL     = host + "/analyse"
+	toGeoJSONURL   = host + "/convert/topojson-to-geojson"
+	toTopoJSONURL  = host + "/convert/geojson-to-topojson"
+	simplifyURL    = host + "/topology/simplify"
 )
 
 var saveTestResponse = true
 
+// testRenderer renders the maps of the api under test, with a png converter that returns testdata/fallback.png
+var testRenderer = renderer.New(geojson2svg.NewPNGConverter("sh", []string{"-c", "cat testdata/fallback.png >> " + geojson2svg.ArgPNGFilename}), renderer.DefaultOptions())
+
 func TestSuccessfullyRenderSVGMap(t *testing.T) {
 	Convey("Successfully render an html map with svg images", t, func() {
 
-		renderer.UsePNGConverter(geojson2svg.NewPNGConverter("sh", []string{"-c", "cat testdata/fallback.png >> " + geojson2svg.ArgPNGFilename}))
-
 		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
 		r, err := http.NewRequest("POST", requestSVGURL, reader)
 		So(err, ShouldBeNil)
 
 		w := httptest.NewRecorder()
-		api := routes(mux.NewRouter())
+		api := routes(mux.NewRouter(), testRenderer)
 		api.router.ServeHTTP(w, r)
 		So(w.Code, ShouldEqual, http.StatusOK)
 		So(w.Header().Get("Content-Type"), ShouldEqual, "text/html")
@@ -44,6 +63,11 @@ func TestSuccessfullyRenderSVGMap(t *testing.T) {
 		So(w.Body.String(), ShouldContainSubstring, "Non-UK born population, Great Britain, 2015")
 		So(w.Body.String(), ShouldNotContainSubstring, "[CSS Here]")
 		So(w.Body.String(), ShouldNotContainSubstring, "[javascript Here]")
+
+		var warnings []string
+		So(json.Unmarshal([]byte(w.Header().Get(warningsHeader)), &warnings), ShouldBeNil)
+		So(warnings, ShouldHaveLength, 2)
+		So(warnings[0], ShouldStartWith, "42 data rows do not match a region in the geography.")
 		if saveTestResponse {
 			s := exampleResponseStart + w.Body.String() + exampleResponseEnd
 			ioutil.WriteFile("../testdata/exampleResponse.html", []byte(s), 0644)
@@ -54,14 +78,12 @@ func TestSuccessfullyRenderSVGMap(t *testing.T) {
 func TestSuccessfullyRenderPNGMap(t *testing.T) {
 	Convey("Successfully render an html map with png images", t, func() {
 
-		renderer.UsePNGConverter(geojson2svg.NewPNGConverter("sh", []string{"-c", "cat testdata/fallback.png >> " + geojson2svg.ArgPNGFilename}))
-
 		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
 		r, err := http.NewRequest("POST", requestPNGURL, reader)
 		So(err, ShouldBeNil)
 
 		w := httptest.NewRecorder()
-		api := routes(mux.NewRouter())
+		api := routes(mux.NewRouter(), testRenderer)
 		api.router.ServeHTTP(w, r)
 		So(w.Code, ShouldEqual, http.StatusOK)
 		So(w.Header().Get("Content-Type"), ShouldEqual, "text/html")
@@ -74,6 +96,128 @@ func TestSuccessfullyRenderPNGMap(t *testing.T) {
 	})
 }
 
+func TestSuccessfullyRenderPage(t *testing.T) {
+	Convey("Successfully render a standalone html page", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		r, err := http.NewRequest("POST", requestPageURL, reader)
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "text/html")
+		So(w.Body.String(), ShouldStartWith, "<!DOCTYPE html>")
+		So(w.Body.String(), ShouldContainSubstring, "<svg")
+		So(w.Body.String(), ShouldContainSubstring, renderer.PanZoomLibraryURL)
+	})
+
+	Convey("Successfully render a self-contained standalone html page", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		r, err := http.NewRequest("POST", requestPageURL+"?self_contained=true", reader)
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldStartWith, "<!DOCTYPE html>")
+		So(w.Body.String(), ShouldNotContainSubstring, renderer.PanZoomLibraryURL)
+	})
+}
+
+func TestSuccessfullyRenderLayoutMetrics(t *testing.T) {
+	Convey("Successfully return the layout metrics of a map without rendering it", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		r, err := http.NewRequest("POST", metricsURL, reader)
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+		var metrics renderer.LayoutMetrics
+		So(json.Unmarshal(w.Body.Bytes(), &metrics), ShouldBeNil)
+		So(metrics.ViewBoxWidth, ShouldEqual, 400)
+		So(metrics.HorizontalLegend, ShouldBeTrue)
+		So(metrics.VerticalLegend, ShouldBeTrue)
+		So(metrics.LegendSwitchPoint, ShouldBeGreaterThan, 400)
+	})
+}
+
+func TestSuccessfullyRenderAllMaps(t *testing.T) {
+	Convey("Successfully render both the svg and png html maps in a json envelope", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		r, err := http.NewRequest("POST", requestAllURL, reader)
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+		So(w.Header().Get(warningsHeader), ShouldNotBeEmpty)
+
+		var response renderAllResponse
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.SVG, ShouldContainSubstring, "<svg")
+		So(response.SVG, ShouldContainSubstring, "Non-UK born population, Great Britain, 2015")
+		So(response.PNG, ShouldNotContainSubstring, "<svg")
+		So(response.PNG, ShouldContainSubstring, `src="data:image/png;base64,`)
+	})
+}
+
+func TestRenderIsLogged(t *testing.T) {
+	Convey("Each render should be logged in a single record describing the request and the work done", t, func() {
+
+		var records []log.Data
+		defer func(event func(string, string, log.Data)) { log.Event = event }(log.Event)
+		log.Event = func(name string, context string, data log.Data) {
+			if data["message"] == "rendered map" {
+				records = append(records, data)
+			}
+		}
+
+		for _, url := range []string{requestSVGURL, requestPNGURL} {
+			records = nil
+			r, err := http.NewRequest("POST", url, bytes.NewReader(testdata.LoadExampleRequest(t)))
+			So(err, ShouldBeNil)
+			r.Header.Set("X-Request-Id", "test-request-id")
+
+			w := httptest.NewRecorder()
+			routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			So(records, ShouldHaveLength, 1)
+			record := records[0]
+			So(record["request_id"], ShouldEqual, "test-request-id")
+			So(record["render_type"], ShouldEqual, strings.TrimPrefix(url, host+"/render/"))
+			So(record["filename"], ShouldEqual, "abcd1234")
+			So(record["version"], ShouldEqual, health.Version)
+			So(record["feature_count"], ShouldBeGreaterThan, 300)
+			So(record["data_row_count"], ShouldBeGreaterThan, 300)
+			So(record["break_count"], ShouldEqual, 5)
+			So(record["output_bytes"], ShouldEqual, w.Body.Len())
+			So(record["warning_count"], ShouldEqual, 2)
+			So(record["warnings"], ShouldHaveLength, 2)
+			So(record["prepare_ms"], ShouldBeGreaterThan, 0)
+			So(record["draw_ms"], ShouldBeGreaterThan, 0)
+			if url == requestPNGURL {
+				So(record["png_conversions"], ShouldEqual, 2)
+				So(record["convert_ms"], ShouldBeGreaterThan, 0)
+			} else {
+				So(record["png_conversions"], ShouldEqual, 0) // the example request does not include fallback pngs
+			}
+		}
+	})
+}
+
 func TestSuccessfullyAnalyseData(t *testing.T) {
 	Convey("Successfully analyse data and topology", t, func() {
 		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
@@ -81,7 +225,7 @@ func TestSuccessfullyAnalyseData(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		w := httptest.NewRecorder()
-		api := routes(mux.NewRouter())
+		api := routes(mux.NewRouter(), testRenderer)
 		api.router.ServeHTTP(w, r)
 		So(w.Code, ShouldEqual, http.StatusOK)
 		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
@@ -92,6 +236,159 @@ func TestSuccessfullyAnalyseData(t *testing.T) {
 	})
 }
 
+// renderCSVRequest returns the example analyse request with the given fields added (or replaced), as the body of a request to render-csv
+func renderCSVRequest(t *testing.T, fields map[string]interface{}) []byte {
+	request := map[string]interface{}{}
+	if err := json.Unmarshal(testdata.LoadExampleAnalyseRequest(t), &request); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range fields {
+		request[name] = value
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestSuccessfullyRenderCSV(t *testing.T) {
+	Convey("Successfully analyse a csv and render the map of its data, coloured using the suggested breaks and palette", t, func() {
+		body := renderCSVRequest(t, map[string]interface{}{"title": "Rendered from a csv", "filename": "csv1234", "choropleth": map[string]interface{}{"horizontal_legend_position": "before"}})
+		r, err := http.NewRequest("POST", renderCSVURL, bytes.NewReader(body))
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "text/html")
+		So(w.Body.String(), ShouldContainSubstring, "Rendered from a csv")
+
+		var messages []*models.Message
+		So(json.Unmarshal([]byte(w.Header().Get(messagesHeader)), &messages), ShouldBeNil)
+		So(messages, ShouldNotBeEmpty)
+		for _, m := range messages {
+			So(m.Details, ShouldBeEmpty)
+		}
+		So(messages[len(messages)-1].Code, ShouldEqual, models.MessageCodeProcessed)
+
+		analyseRequest, err := models.CreateAnalyseRequest(bytes.NewReader(testdata.LoadExampleAnalyseRequest(t)))
+		So(err, ShouldBeNil)
+		analysis, err := analyser.AnalyseData(analyseRequest)
+		So(err, ShouldBeNil)
+		for _, colour := range analysis.Choropleths[0].Breaks {
+			So(w.Body.String(), ShouldContainSubstring, "fill: "+colour.Colour)
+		}
+	})
+
+	Convey("A csv that cannot be analysed should return 422 with the messages of the analysis", t, func() {
+		body := renderCSVRequest(t, map[string]interface{}{"csv": "unknown1,1\nunknown2,2", "id_index": 0, "value_index": 1, "has_header_row": false})
+		r, err := http.NewRequest("POST", renderCSVURL, bytes.NewReader(body))
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+		var response analyseFailedResponse
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Messages, ShouldHaveLength, 1)
+		So(response.Messages[0].Level, ShouldEqual, "error")
+		So(response.Messages[0].Text, ShouldStartWith, "Data does not match Topology")
+	})
+
+	Convey("A render-csv request without a csv should be rejected", t, func() {
+		body := renderCSVRequest(t, map[string]interface{}{"csv": ""})
+		r, err := http.NewRequest("POST", renderCSVURL, bytes.NewReader(body))
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func TestSuccessfullyAnalyseXLSX(t *testing.T) {
+	Convey("Successfully analyse an xlsx file uploaded in a multipart form", t, func() {
+		request := models.AnalyseRequest{}
+		So(json.Unmarshal(testdata.LoadExampleAnalyseRequest(t), &request), ShouldBeNil)
+		request.CSV = ""
+		request.SheetName = "Data"
+		idIndex := 0
+		request.IDIndex = &idIndex
+		request.ValueIndex = 2
+		request.HasHeaderRow = true
+		requestJSON, err := json.Marshal(request)
+		So(err, ShouldBeNil)
+
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		So(form.WriteField("request", string(requestJSON)), ShouldBeNil)
+		file, err := form.CreateFormFile("file", "data.xlsx")
+		So(err, ShouldBeNil)
+		file.Write(testdata.LoadExampleXLSX(t))
+		So(form.Close(), ShouldBeNil)
+
+		r, err := http.NewRequest("POST", analyseURL, body)
+		So(err, ShouldBeNil)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var response models.AnalyseResponse
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(len(response.Data), ShouldEqual, 2)
+		So(response.Data[0].ID, ShouldEqual, "E06000001")
+	})
+
+	Convey("Reject a multipart form without a file", t, func() {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		So(form.WriteField("request", string(testdata.LoadExampleAnalyseRequest(t))), ShouldBeNil)
+		So(form.Close(), ShouldBeNil)
+
+		r, err := http.NewRequest("POST", analyseURL, body)
+		So(err, ShouldBeNil)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldStartWith, "Unable to read file from multipart form")
+	})
+
+	Convey("Reject a multipart form larger than the maximum upload size", t, func() {
+		defer UseMaxUploadSize(defaultMaxUploadSize)
+		UseMaxUploadSize(1024)
+
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		So(form.WriteField("request", string(testdata.LoadExampleAnalyseRequest(t))), ShouldBeNil)
+		file, err := form.CreateFormFile("file", "data.xlsx")
+		So(err, ShouldBeNil)
+		file.Write(testdata.LoadExampleXLSX(t))
+		So(form.Close(), ShouldBeNil)
+
+		r, err := http.NewRequest("POST", analyseURL, body)
+		So(err, ShouldBeNil)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		So(w.Body.String(), ShouldEqual, "The uploaded file is too large\n")
+	})
+}
+
 func TestRejectInvalidRequest(t *testing.T) {
 	Convey("Reject invalid render type in url with StatusNotFound", t, func() {
 		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
@@ -99,7 +396,7 @@ func TestRejectInvalidRequest(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		w := httptest.NewRecorder()
-		api := routes(mux.NewRouter())
+		api := routes(mux.NewRouter(), testRenderer)
 		api.router.ServeHTTP(w, r)
 		So(w.Code, ShouldEqual, http.StatusNotFound)
 		So(w.Body.String(), ShouldResemble, "Unknown render type\n")
@@ -113,9 +410,216 @@ func TestRejectInvalidJSON(t *testing.T) {
 		So(err, ShouldBeNil)
 
 		w := httptest.NewRecorder()
-		api := routes(mux.NewRouter())
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func TestRejectUnknownMapType(t *testing.T) {
+	Convey("When a render request has an unknown map_type, a bad request is returned", t, func() {
+		body := strings.Replace(string(testdata.LoadExampleRequest(t)), `"map_type": "choropleth"`, `"map_type": "foo"`, 1)
+		r, err := http.NewRequest("POST", requestSVGURL, strings.NewReader(body))
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldStartWith, "map_type must be one of 'choropleth'")
+	})
+}
+
+func TestRenderWithRegisteredGeography(t *testing.T) {
+	var example map[string]interface{}
+	if err := json.Unmarshal(testdata.LoadExampleRequest(t), &example); err != nil {
+		t.Fatal(err)
+	}
+	geographyJSON, _ := json.Marshal(example["geography"])
+	delete(example, "geography")
+	example["geography_id"] = "example"
+	renderJSON, _ := json.Marshal(example)
+
+	Convey("When a geography is registered, a map can be rendered using its id", t, func() {
+		UseGeographyStore(geography.NewStore())
+		r, err := http.NewRequest("PUT", host+"/geographies/example", bytes.NewReader(geographyJSON))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+
+		r, err = http.NewRequest("POST", requestSVGURL, bytes.NewReader(renderJSON))
+		So(err, ShouldBeNil)
+		w = httptest.NewRecorder()
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldContainSubstring, `<svg `)
+
+		Convey("The geography can be retrieved", func() {
+			r, err := http.NewRequest("GET", host+"/geographies/example", nil)
+			So(err, ShouldBeNil)
+			w := httptest.NewRecorder()
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, `"id_property":"AREACD"`)
+		})
+
+		Convey("Rendering the map again gives the same result", func() {
+			first := w.Body.String()
+			r, err := http.NewRequest("POST", requestSVGURL, bytes.NewReader(renderJSON))
+			So(err, ShouldBeNil)
+			w := httptest.NewRecorder()
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldEqual, first)
+		})
+
+		Convey("Once the geography is deleted, rendering using its id returns a 404", func() {
+			r, err := http.NewRequest("DELETE", host+"/geographies/example", nil)
+			So(err, ShouldBeNil)
+			w := httptest.NewRecorder()
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusNoContent)
+
+			r, err = http.NewRequest("POST", requestSVGURL, bytes.NewReader(renderJSON))
+			So(err, ShouldBeNil)
+			w = httptest.NewRecorder()
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+			So(w.Body.String(), ShouldEqual, "No geography has been registered with geography_id=example\n")
+		})
+	})
+
+	Convey("When a request has both a geography and a geography_id, a bad request is returned", t, func() {
+		UseGeographyStore(geography.NewStore())
+		body := strings.Replace(string(testdata.LoadExampleRequest(t)), `"filename"`, `"geography_id":"example","filename"`, 1)
+		r, err := http.NewRequest("POST", requestSVGURL, strings.NewReader(body))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "Only one of geography and geography_id may be provided\n")
+	})
+
+	Convey("Getting or deleting an unknown geography returns a 404", t, func() {
+		api := routes(mux.NewRouter(), testRenderer)
+		for _, method := range []string{"GET", "DELETE"} {
+			r, err := http.NewRequest(method, host+"/geographies/unknown", nil)
+			So(err, ShouldBeNil)
+			w := httptest.NewRecorder()
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+		}
+	})
+
+	Convey("Registering an invalid geography returns a bad request", t, func() {
+		r, err := http.NewRequest("PUT", host+"/geographies/invalid", strings.NewReader(`{"id_property":"code"}`))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "Missing mandatory field(s): [topojson or geojson]\n")
+	})
+
+	Convey("Registering a geography when the store is full returns insufficient storage", t, func() {
+		store := geography.NewStore()
+		store.SetMaxCount(1)
+		UseGeographyStore(store)
+		defer UseGeographyStore(geography.NewStore())
+
+		puts := []struct {
+			id     string
+			status int
+		}{{"first", http.StatusCreated}, {"first", http.StatusOK}, {"second", http.StatusInsufficientStorage}}
+		for _, put := range puts {
+			r, err := http.NewRequest("PUT", host+"/geographies/"+put.id, bytes.NewReader(geographyJSON))
+			So(err, ShouldBeNil)
+			w := httptest.NewRecorder()
+			api := routes(mux.NewRouter(), testRenderer)
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, put.status)
+		}
+	})
+}
+
+func TestRejectUnknownFieldsInStrictMode(t *testing.T) {
+	Convey("When a render request with misspelt fields is sent in strict mode, a bad request naming the fields is returned", t, func() {
+		body := strings.Replace(string(testdata.LoadExampleRequest(t)), `"id_property"`, `"id-property"`, 1)
+		body = strings.Replace(body, `"lower_bound"`, `"lowerBound"`, 1)
+		r, err := http.NewRequest("POST", requestSVGURL+"?strict=true", strings.NewReader(body))
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
 		api.router.ServeHTTP(w, r)
 		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "Unknown field(s): [choropleth.breaks[0].lowerBound geography.id-property]\n")
+	})
+
+	Convey("When an analyse request with a misspelt field is sent in strict mode, a bad request naming the field is returned", t, func() {
+		body := strings.Replace(string(testdata.LoadExampleAnalyseRequest(t)), `"value_index"`, `"valueIndex"`, 1)
+		r, err := http.NewRequest("POST", analyseURL+"?strict=true", strings.NewReader(body))
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "Unknown field(s): [valueIndex]\n")
+	})
+
+	Convey("When a valid request is sent in strict mode, it is rendered", t, func() {
+		r, err := http.NewRequest("POST", requestSVGURL+"?strict=true", bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+	})
+}
+
+func TestWarningsHeader(t *testing.T) {
+	Convey("When there are no warnings, the warnings header is not set", t, func() {
+		w := httptest.NewRecorder()
+		setWarningsHeader(w, nil)
+		So(w.Header(), ShouldNotContainKey, warningsHeader)
+	})
+
+	Convey("When the warnings are too long for the header, they are truncated with a count of those omitted", t, func() {
+		warnings := []string{}
+		for i := 0; i < 100; i++ {
+			warnings = append(warnings, strings.Repeat("x", 100))
+		}
+		w := httptest.NewRecorder()
+		setWarningsHeader(w, warnings)
+
+		header := w.Header().Get(warningsHeader)
+		So(len(header), ShouldBeLessThanOrEqualTo, maxWarningsHeaderLength)
+		var result []string
+		So(json.Unmarshal([]byte(header), &result), ShouldBeNil)
+		So(len(result), ShouldBeGreaterThan, 1)
+		So(result[len(result)-1], ShouldEqual, fmt.Sprintf("... and %d more warnings", 100-len(result)+1))
+	})
+}
+
+func TestRejectOversizedTopology(t *testing.T) {
+	Convey("When a render request has a topology larger than the limits, an unprocessable entity error is returned", t, func() {
+		models.UseTopologyLimits(100, 0, 0)
+		defer models.UseTopologyLimits(100000, 20000, 2000000)
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		r, err := http.NewRequest("POST", requestSVGURL, reader)
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		api := routes(mux.NewRouter(), testRenderer)
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+		So(w.Body.String(), ShouldStartWith, "The geography has 1521 arcs, which exceeds the limit of 100.")
 	})
 }
 
@@ -161,7 +665,8 @@ var exampleResponseEnd = `
 	document.addEventListener("DOMContentLoaded", function() {
 		var mapId = "map-abcd1234-map-svg"
 		var svg = document.getElementById(mapId);
-		if (svg && svg.clientWidth > 0 && svg.hasAttribute("viewBox")) {
+		// an svg marked data-pan-zoom="false" is left as a static responsive image
+		if (svg && svg.clientWidth > 0 && svg.hasAttribute("viewBox") && svg.getAttribute("data-pan-zoom") !== "false") {
 			viewBox = svg.getAttribute("viewBox").split(" ") // x1 y1 x2 y2
 			heightRatio = parseInt(viewBox[3]) / parseInt(viewBox[2])
 			var setSvgHeight = function() {	
@@ -169,16 +674,374 @@ var exampleResponseEnd = `
 				return true;
 			};
 			setSvgHeight();
-			var panZoom = window.panZoom = svgPanZoom('#' + mapId, {minZoom: 0.75, maxZoom: 100, zoomScaleSensitivity: 0.4, mouseWheelZoomEnabled: false, controlIconsEnabled: true, fit: true, center: true});
+			var options = {minZoom: 0.75, maxZoom: 100, zoomScaleSensitivity: 0.4, mouseWheelZoomEnabled: false, controlIconsEnabled: true, fit: true, center: true};
+			// any options given in the request (see pan_zoom_options) replace the defaults
+			var custom = svg.hasAttribute("data-pan-zoom-options") ? JSON.parse(svg.getAttribute("data-pan-zoom-options")) : {};
+			for (var name in custom) {
+				options[name] = custom[name];
+			}
+			var panZoom = window.panZoom = svgPanZoom('#' + mapId, options);
+			// centre the view on the focus region (the path named by data-focus-region, with its bounding box as data attributes), if any
+			var focus = function() {
+				panZoom.fit();
+				panZoom.center();
+				var region = svg.hasAttribute("data-focus-region") && document.getElementById(svg.getAttribute("data-focus-region"));
+				if (!region || !region.hasAttribute("data-focus-width")) {
+					return;
+				}
+				var x = parseFloat(region.getAttribute("data-focus-x")), y = parseFloat(region.getAttribute("data-focus-y"));
+				var w = parseFloat(region.getAttribute("data-focus-width")), h = parseFloat(region.getAttribute("data-focus-height"));
+				var sizes = panZoom.getSizes();
+				panZoom.zoom(Math.max(1, Math.min(options.maxZoom, 0.8 * Math.min(sizes.viewBox.width / w, sizes.viewBox.height / h))));
+				sizes = panZoom.getSizes();
+				panZoom.pan({x: sizes.width / 2 - (x + w / 2) * sizes.realZoom, y: sizes.height / 2 - (y + h / 2) * sizes.realZoom});
+			};
+			focus();
 	
 			window.addEventListener('resize', function(){
 				setSvgHeight()
 				panZoom.resize();
-				panZoom.fit();
-				panZoom.center();
+				focus();
 			});
 		}
 	});
 </script>
 </body>
 </html>`
+
+func TestVersion(t *testing.T) {
+	Convey("The version endpoint should return the build information", t, func() {
+		r, err := http.NewRequest("GET", host+"/version", nil)
+		So(err, ShouldBeNil)
+
+		w := httptest.NewRecorder()
+		routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var build health.BuildInfo
+		So(json.Unmarshal(w.Body.Bytes(), &build), ShouldBeNil)
+		So(build, ShouldResemble, health.Build())
+	})
+
+	Convey("Every response should give the version in the Server header", t, func() {
+		for _, url := range []string{"/healthcheck", "/version", "/geographies/unknown"} {
+			r, err := http.NewRequest("GET", host+url, nil)
+			So(err, ShouldBeNil)
+
+			w := httptest.NewRecorder()
+			routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+			So(w.Header().Get("Server"), ShouldEqual, "dp-map-renderer/"+health.Version)
+		}
+	})
+}
+
+func TestDebugEndpoints(t *testing.T) {
+
+	Convey("The debug endpoints should not exist when disabled", t, func() {
+		UseDebugEndpoints(false, "")
+
+		api := routes(mux.NewRouter(), testRenderer)
+		for _, url := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine", "/debug/vars"} {
+			r, err := http.NewRequest("GET", host+url, nil)
+			So(err, ShouldBeNil)
+			w := httptest.NewRecorder()
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+		}
+	})
+
+	Convey("The debug endpoints should exist when enabled", t, func() {
+		UseDebugEndpoints(true, "")
+		defer UseDebugEndpoints(false, "")
+
+		api := routes(mux.NewRouter(), testRenderer)
+		for _, url := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine?debug=1", "/debug/pprof/cmdline"} {
+			r, err := http.NewRequest("GET", host+url, nil)
+			So(err, ShouldBeNil)
+			w := httptest.NewRecorder()
+			api.router.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusOK)
+		}
+	})
+
+	Convey("/debug/vars should include the number of renders in progress and registered geographies", t, func() {
+		UseDebugEndpoints(true, "")
+		defer UseDebugEndpoints(false, "")
+		UseGeographyStore(geography.NewStore())
+		defer UseGeographyStore(geography.NewStore())
+
+		r, err := http.NewRequest("GET", host+"/debug/vars", nil)
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var vars map[string]interface{}
+		So(json.Unmarshal(w.Body.Bytes(), &vars), ShouldBeNil)
+		So(vars["renders_in_flight"], ShouldEqual, 0)
+		So(vars["analyses_in_flight"], ShouldEqual, 0)
+		So(vars["geographies"], ShouldEqual, 0)
+		So(vars, ShouldContainKey, "goroutines")
+		So(vars, ShouldContainKey, "memstats")
+		So(vars, ShouldContainKey, "timings")
+	})
+
+	Convey("The debug endpoints should not be served with the api when they have their own bind address", t, func() {
+		UseDebugEndpoints(true, "localhost:0")
+		defer UseDebugEndpoints(false, "")
+
+		r, err := http.NewRequest("GET", host+"/debug/vars", nil)
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestConvertGeography(t *testing.T) {
+	var example map[string]interface{}
+	if err := json.Unmarshal(testdata.LoadExampleRequest(t), &example); err != nil {
+		t.Fatal(err)
+	}
+	geographyJSON, _ := json.Marshal(example["geography"])
+	api := routes(mux.NewRouter(), testRenderer)
+	post := func(url string, body string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("POST", url, strings.NewReader(body))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api.router.ServeHTTP(w, r)
+		return w
+	}
+
+	Convey("A registered topology can be converted to geojson and back, keeping the features and their ids", t, func() {
+		UseGeographyStore(geography.NewStore())
+		r, err := http.NewRequest("PUT", host+"/geographies/example", bytes.NewReader(geographyJSON))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+
+		w = post(toGeoJSONURL, `{"geography_id": "example", "id_and_name_only": true}`)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+		fc, err := geojson.UnmarshalFeatureCollection(w.Body.Bytes())
+		So(err, ShouldBeNil)
+		So(len(fc.Features), ShouldEqual, 380)
+		So(fc.Features[0].Properties, ShouldResemble, map[string]interface{}{"AREACD": "E06000001", "AREANM": "Hartlepool"})
+
+		w = post(toTopoJSONURL, `{"geography": {"geojson": `+w.Body.String()+`, "id_property": "AREACD"}, "quantisation": 100000}`)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		topology, err := topojson.UnmarshalTopology(w.Body.Bytes())
+		So(err, ShouldBeNil)
+		So(len(topology.Objects), ShouldEqual, 380)
+		So(topology.Objects["E06000001"].Properties["AREANM"], ShouldEqual, "Hartlepool")
+	})
+
+	Convey("A request without a geography of the type converted from should be rejected", t, func() {
+		w := post(toTopoJSONURL, `{"geography": `+string(geographyJSON)+`}`)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "Missing mandatory field(s): [geography.geojson]\n")
+
+		w = post(toGeoJSONURL, `{"geography": `+string(geographyJSON)+`, "quantisation": 1000}`)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "quantisation and output_quantisation may only be given when converting geojson to topojson\n")
+	})
+
+	Convey("A geography that would be too large once converted should be rejected", t, func() {
+		models.UseTopologyLimits(0, 0, 20000)
+		defer models.UseTopologyLimits(100000, 20000, 2000000)
+
+		w := post(toGeoJSONURL, `{"geography": `+string(geographyJSON)+`}`)
+		So(w.Code, ShouldEqual, http.StatusUnprocessableEntity)
+		So(w.Body.String(), ShouldStartWith, "The geography has ")
+	})
+}
+
+func TestSimplifyTopology(t *testing.T) {
+	var example map[string]interface{}
+	if err := json.Unmarshal(testdata.LoadExampleRequest(t), &example); err != nil {
+		t.Fatal(err)
+	}
+	geographyJSON, _ := json.Marshal(example["geography"])
+	api := routes(mux.NewRouter(), testRenderer)
+
+	Convey("A topology should be simplified to a target number of points, with its statistics before and after", t, func() {
+		r, err := http.NewRequest("POST", simplifyURL, strings.NewReader(`{"geography": `+string(geographyJSON)+`, "target_points": 5000, "quantisation": 10000}`))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+		var response models.SimplifyResponse
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Before.Points, ShouldEqual, 17907)
+		So(response.After.Points, ShouldBeLessThanOrEqualTo, 5000)
+		So(response.After.Bytes, ShouldBeLessThan, response.Before.Bytes)
+		So(len(response.Topojson.Objects["LA2014merc"].Geometries), ShouldEqual, 380)
+	})
+
+	Convey("A request without a tolerance, target_points or quantisation should be rejected", t, func() {
+		r, err := http.NewRequest("POST", simplifyURL, strings.NewReader(`{"geography": `+string(geographyJSON)+`}`))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api.router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "One of tolerance, target_points or quantisation must be provided\n")
+	})
+}
+
+func TestRenderWithPreset(t *testing.T) {
+	var example map[string]interface{}
+	if err := json.Unmarshal(testdata.LoadExampleRequest(t), &example); err != nil {
+		t.Fatal(err)
+	}
+	delete(example["choropleth"].(map[string]interface{}), "vertical_legend_position")
+	example["preset_id"] = "house-style"
+	renderJSON, _ := json.Marshal(example)
+	api := routes(mux.NewRouter(), testRenderer)
+	serve := func(method string, url string, body string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, url, strings.NewReader(body))
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		api.router.ServeHTTP(w, r)
+		return w
+	}
+
+	Convey("When a preset is stored, a map can be rendered using it, with the fields of the request taking precedence", t, func() {
+		preset := `{"choropleth": {"horizontal_legend_position": "after", "vertical_legend_position": "none", "value_suffix": " preset units"}}`
+		w := serve("PUT", host+"/presets/house-style", preset)
+		So(w.Code, ShouldEqual, http.StatusCreated)
+
+		w = serve("GET", host+"/presets/house-style", "")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+		So(w.Body.String(), ShouldContainSubstring, `"vertical_legend_position":"none"`)
+
+		w = serve("POST", requestSVGURL, string(renderJSON))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		html := w.Body.String()
+		So(html, ShouldNotContainSubstring, "legend-vertical-svg")
+		So(html, ShouldContainSubstring, "legend-horizontal-svg")
+		So(strings.Index(html, "legend-horizontal-svg"), ShouldBeLessThan, strings.Index(html, "map-svg"))
+		So(html, ShouldContainSubstring, "% non-UK born")
+		So(html, ShouldNotContainSubstring, "preset units")
+
+		So(serve("DELETE", host+"/presets/house-style", "").Code, ShouldEqual, http.StatusNoContent)
+	})
+
+	Convey("A request with an unknown preset_id should be rejected with a 404", t, func() {
+		w := serve("POST", requestSVGURL, string(renderJSON))
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+		So(w.Body.String(), ShouldEqual, "No preset has been stored with preset_id=house-style\n")
+
+		So(serve("GET", host+"/presets/house-style", "").Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("A preset containing a geography or data should be rejected", t, func() {
+		w := serve("PUT", host+"/presets/invalid", `{"geography_id": "example", "data": [], "font_size": 14}`)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldEqual, "A preset may only contain the presentation fields of a render request, not: [data geography_id]\n")
+
+		w = serve("PUT", host+"/presets/not valid", `{"font_size": 14}`)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func TestCachingHeaders(t *testing.T) {
+	render := func(url string, header http.Header) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("POST", url, bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+		return w
+	}
+
+	Convey("A successful render should be cacheable for the configured max-age, with an ETag", t, func() {
+		w := render(metricsURL, nil)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=3600")
+		So(w.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+		So(w.Header().Get("ETag"), ShouldStartWith, `"`)
+		So(w.Header().Get("Last-Modified"), ShouldBeEmpty)
+
+		Convey("And the same request should have the same ETag", func() {
+			again := render(metricsURL, nil)
+			So(again.Header().Get("ETag"), ShouldEqual, w.Header().Get("ETag"))
+		})
+
+		Convey("But another render type should have a different ETag", func() {
+			svg := render(requestSVGURL, nil)
+			So(svg.Code, ShouldEqual, http.StatusOK)
+			So(svg.Header().Get("ETag"), ShouldNotBeEmpty)
+			So(svg.Header().Get("ETag"), ShouldNotEqual, w.Header().Get("ETag"))
+		})
+
+		Convey("And a request with a matching If-None-Match should fail its precondition, without being rendered", func() {
+			for _, inm := range []string{`"other", ` + w.Header().Get("ETag"), "*"} {
+				conditional := render(metricsURL, http.Header{"If-None-Match": {inm}})
+				So(conditional.Code, ShouldEqual, http.StatusPreconditionFailed)
+				So(conditional.Body.Len(), ShouldEqual, 0)
+				So(conditional.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+			}
+		})
+
+		Convey("And a request with a different If-None-Match should be rendered", func() {
+			modified := render(metricsURL, http.Header{"If-None-Match": {`"other"`}})
+			So(modified.Code, ShouldEqual, http.StatusOK)
+			So(modified.Body.Len(), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("And If-Modified-Since should be ignored", func() {
+			for _, since := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(-time.Hour)} {
+				modified := render(metricsURL, http.Header{"If-Modified-Since": {since.UTC().Format(http.TimeFormat)}})
+				So(modified.Code, ShouldEqual, http.StatusOK)
+				So(modified.Body.Len(), ShouldBeGreaterThan, 0)
+			}
+		})
+	})
+
+	Convey("A request with an unknown render type should not be found, whatever its conditions", t, func() {
+		w := render(host+"/render/unknown", http.Header{"If-None-Match": {"*"}})
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+		So(w.Header().Get("ETag"), ShouldBeEmpty)
+	})
+
+	Convey("The max-age of successful renders should be configurable", t, func() {
+		UseRenderCacheMaxAge(10 * time.Minute)
+		defer UseRenderCacheMaxAge(time.Hour)
+
+		w := render(metricsURL, nil)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=600")
+	})
+
+	Convey("Error responses should not be stored", t, func() {
+		for _, url := range []string{host + "/render/unknown", host + "/render/svg?strict=true", host + "/geographies/unknown"} {
+			r, err := http.NewRequest("POST", url, strings.NewReader(`{"filename": "x", "unknown_field": 1}`))
+			So(err, ShouldBeNil)
+			if strings.Contains(url, "geographies") {
+				r.Method = "GET"
+			}
+			w := httptest.NewRecorder()
+			routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+			So(w.Code, ShouldBeGreaterThanOrEqualTo, http.StatusBadRequest)
+			So(w.Header().Get("Cache-Control"), ShouldEqual, "no-store")
+			So(w.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+			So(w.Header().Get("ETag"), ShouldBeEmpty)
+		}
+	})
+
+	Convey("Successful responses that are not renders should not be given a max-age", t, func() {
+		r, err := http.NewRequest("GET", host+"/version", nil)
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		routes(mux.NewRouter(), testRenderer).router.ServeHTTP(w, r)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Cache-Control"), ShouldBeEmpty)
+		So(w.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+	})
+}
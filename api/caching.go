@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/gorilla/mux"
+)
+
+// renderMaxAge is the max-age of the Cache-Control header of successful renders - see UseRenderCacheMaxAge
+var renderMaxAge = time.Hour
+
+// UseRenderCacheMaxAge sets the max-age of the Cache-Control header of successful renders, which may be cached (e.g. by a CDN) for that long.
+// A max-age of 0 allows the renders to be cached, but only reused once they have been revalidated (see the ETag header)
+func UseRenderCacheMaxAge(maxAge time.Duration) {
+	renderMaxAge = maxAge
+}
+
+// cacheHeaders decorates every response with the headers needed by a cache in front of the renderer:
+// successful responses with an ETag (i.e. renders) are given a Cache-Control max-age, error responses are marked no-store,
+// and all responses vary by Accept-Encoding.
+func cacheHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&cachingResponseWriter{ResponseWriter: w}, r)
+	})
+}
+
+// cachingResponseWriter sets the caching headers of the response as its status is written - see cacheHeaders
+type cachingResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *cachingResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+	switch {
+	case status >= http.StatusBadRequest:
+		h.Set("Cache-Control", "no-store")
+		h.Del("ETag")
+	case status >= http.StatusOK && status < http.StatusMultipleChoices && len(h.Get("ETag")) > 0:
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(renderMaxAge.Seconds())))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cachingResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the wrapped writer does, so that streamed responses are still flushed
+func (w *cachingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// setRenderETag sets the ETag of the response to a digest of the request (see models.RenderRequest.Hash), the render type and options,
+// and the version of the service - which together determine the rendered result, so that every instance gives the same result the same ETag.
+// Returns true if the http request has an If-None-Match header matching the ETag, in which case the map should not be rendered,
+// and the response should be 412 Precondition Failed (as RFC 7232 requires of a POST).
+// If-Modified-Since is ignored, as RFC 7232 requires of a POST, and no Last-Modified header is given.
+func setRenderETag(w http.ResponseWriter, r *http.Request, renderRequest *models.RenderRequest) bool {
+	hash, err := renderRequest.Hash()
+	if err != nil {
+		log.Error(err, nil)
+		return false
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{hash, mux.Vars(r)["render_type"], fmt.Sprint(isSelfContained(r)), health.Version}, "|")))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/geography"
+	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+func (api *RendererAPI) convertTopoJSONToGeoJSON(w http.ResponseWriter, r *http.Request) {
+	api.convert(w, r, models.ConversionTopoJSONToGeoJSON, func(request *models.ConvertRequest) (interface{}, error) {
+		return geography.ToGeoJSON(request.Geography, request.IDAndNameOnly)
+	})
+}
+
+func (api *RendererAPI) convertGeoJSONToTopoJSON(w http.ResponseWriter, r *http.Request) {
+	api.convert(w, r, models.ConversionGeoJSONToTopoJSON, func(request *models.ConvertRequest) (interface{}, error) {
+		return geography.ToTopoJSON(request.Geography, request.IDAndNameOnly, request.Quantisation, request.OutputQuantisation)
+	})
+}
+
+// convert reads and validates a ConvertRequest for the given conversion, writing the json of the geography converted by convertGeography
+func (api *RendererAPI) convert(w http.ResponseWriter, r *http.Request, conversion string, convertGeography func(*models.ConvertRequest) (interface{}, error)) {
+
+	defer health.TrackTime(time.Now(), "convert_"+conversion)
+	log.Debug("convert", log.Data{"headers": r.Header, "conversion": conversion})
+	var request *models.ConvertRequest
+	var err error
+	if isStrict(r) {
+		request, err = models.CreateConvertRequestStrict(r.Body)
+	} else {
+		request, err = models.CreateConvertRequest(r.Body)
+	}
+	if err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = request.ResolveGeography(lookupGeography); err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err = request.ValidateConvertRequest(conversion); err != nil {
+		log.Error(err, log.Data{"_message": "ConvertRequest failed validation"})
+		http.Error(w, err.Error(), validationErrorCode(err))
+		return
+	}
+
+	converted, err := convertGeography(request)
+	if err != nil {
+		log.Error(err, log.Data{"_message": "Unable to convert geography", "conversion": conversion})
+		http.Error(w, err.Error(), validationErrorCode(err))
+		return
+	}
+
+	bytes, err := json.Marshal(converted)
+	if err != nil {
+		log.Error(err, log.Data{"_message": "Unable to marshal response"})
+		setErrorCode(w, err)
+		return
+	}
+
+	setContentType(w, contentJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(bytes); err != nil {
+		log.Error(err, log.Data{})
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"expvar"
+	"net/http/pprof"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/ONSdigital/dp-map-renderer/analyser"
+	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/gorilla/mux"
+)
+
+var (
+	debugEnabled  = false
+	debugBindAddr = ""
+)
+
+// in-flight request counts, published in /debug/vars
+var (
+	rendersInFlight  int64
+	analysesInFlight int64
+)
+
+func init() {
+	expvar.Publish("renders_in_flight", expvar.Func(func() interface{} { return atomic.LoadInt64(&rendersInFlight) }))
+	expvar.Publish("analyses_in_flight", expvar.Func(func() interface{} { return atomic.LoadInt64(&analysesInFlight) }))
+	expvar.Publish("geographies", expvar.Func(func() interface{} { return geographies.Len() }))
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+	expvar.Publish("timings", expvar.Func(func() interface{} { return health.Snapshot() }))
+	expvar.Publish("analyse_breaks_cache", expvar.Func(func() interface{} { return analyser.CurrentBreaksCacheSnapshot() }))
+}
+
+// UseDebugEndpoints enables (or disables) the pprof profiling endpoints under /debug/pprof, and /debug/vars.
+// If bindAddr is empty, the endpoints are served alongside the api, otherwise they are served only at bindAddr (e.g. localhost:23501),
+// so that they need never be exposed with the api. Must be called before CreateRendererAPI.
+func UseDebugEndpoints(enabled bool, bindAddr string) {
+	debugEnabled = enabled
+	debugBindAddr = bindAddr
+}
+
+// debugRoutes adds the pprof and expvar endpoints to the router
+func debugRoutes(router *mux.Router) {
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// Index serves the named profiles, e.g. /debug/pprof/heap, /debug/pprof/goroutine
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	router.Handle("/debug/vars", expvar.Handler())
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ONSdigital/dp-map-renderer/geography"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/gorilla/mux"
+)
+
+// Geography error messages
+var (
+	geographyNotFound  = "Geography not found"
+	invalidGeographyID = "The geography id must only contain letters, digits, hyphens and underscores"
+)
+
+var geographies = geography.NewStore()
+
+// UseGeographyStore assigns the store holding the geographies that render and analyse requests may refer to by geography_id
+func UseGeographyStore(store *geography.Store) {
+	geographies = store
+}
+
+// lookupGeography returns the registered geography with the given id, or nil if there is none
+func lookupGeography(id string) *models.Geography {
+	return geographies.Get(id)
+}
+
+func (api *RendererAPI) putGeography(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	log.Debug("putGeography", log.Data{"headers": r.Header, "geography_id": id})
+	if !models.IsValidGeographyID(id) {
+		http.Error(w, invalidGeographyID, http.StatusBadRequest)
+		return
+	}
+
+	var g *models.Geography
+	var err error
+	if isStrict(r) {
+		g, err = models.CreateGeographyStrict(r.Body)
+	} else {
+		g, err = models.CreateGeography(r.Body)
+	}
+	if err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = g.ValidateGeography(); err != nil {
+		log.Error(err, log.Data{"_message": "Geography failed validation", "geography_id": id})
+		http.Error(w, err.Error(), validationErrorCode(err))
+		return
+	}
+
+	replaced, err := geographies.Put(id, g)
+	if err == geography.ErrStoreFull {
+		log.Error(err, log.Data{"geography_id": id})
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if err != nil {
+		log.Error(err, log.Data{"geography_id": id})
+		setErrorCode(w, err)
+		return
+	}
+
+	if replaced {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (api *RendererAPI) getGeography(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	log.Debug("getGeography", log.Data{"geography_id": id})
+
+	g := geographies.Get(id)
+	if g == nil {
+		http.Error(w, geographyNotFound, http.StatusNotFound)
+		return
+	}
+
+	bytes, err := json.Marshal(g)
+	if err != nil {
+		log.Error(err, log.Data{"_message": "Unable to marshal geography", "geography_id": id})
+		setErrorCode(w, err)
+		return
+	}
+
+	setContentType(w, "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(bytes); err != nil {
+		log.Error(err, log.Data{})
+	}
+}
+
+func (api *RendererAPI) deleteGeography(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	log.Debug("deleteGeography", log.Data{"geography_id": id})
+
+	deleted, err := geographies.Delete(id)
+	if err != nil {
+		log.Error(err, log.Data{"geography_id": id})
+		setErrorCode(w, err)
+		return
+	}
+	if !deleted {
+		http.Error(w, geographyNotFound, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/gorilla/mux"
+)
+
+// Preset error messages
+var (
+	presetNotFound  = "Preset not found"
+	invalidPresetID = "The preset id must only contain letters, digits, hyphens and underscores"
+)
+
+// presetStore holds the presets that render requests may refer to by preset_id, in memory. It is safe for concurrent use.
+type presetStore struct {
+	mutex   sync.RWMutex
+	presets map[string]models.Preset
+}
+
+var presets = &presetStore{presets: make(map[string]models.Preset)}
+
+// lookupPreset returns the stored preset with the given id, or nil if there is none
+func lookupPreset(id string) models.Preset {
+	presets.mutex.RLock()
+	defer presets.mutex.RUnlock()
+	return presets.presets[id]
+}
+
+// put stores the preset with the given id, returning true if it replaced an existing preset
+func (s *presetStore) put(id string, preset models.Preset) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, replaced := s.presets[id]
+	s.presets[id] = preset
+	return replaced
+}
+
+// delete removes the preset with the given id, returning true if there was one
+func (s *presetStore) delete(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, deleted := s.presets[id]
+	delete(s.presets, id)
+	return deleted
+}
+
+func (api *RendererAPI) putPreset(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	log.Debug("putPreset", log.Data{"headers": r.Header, "preset_id": id})
+	if !models.IsValidPresetID(id) {
+		http.Error(w, invalidPresetID, http.StatusBadRequest)
+		return
+	}
+
+	preset, err := models.CreatePreset(r.Body)
+	if err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = preset.ValidatePreset(); err != nil {
+		log.Error(err, log.Data{"_message": "Preset failed validation", "preset_id": id})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if presets.put(id, preset) {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (api *RendererAPI) getPreset(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	log.Debug("getPreset", log.Data{"preset_id": id})
+
+	preset := lookupPreset(id)
+	if preset == nil {
+		http.Error(w, presetNotFound, http.StatusNotFound)
+		return
+	}
+
+	bytes, err := json.Marshal(preset)
+	if err != nil {
+		log.Error(err, log.Data{"_message": "Unable to marshal preset", "preset_id": id})
+		setErrorCode(w, err)
+		return
+	}
+
+	setContentType(w, contentJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(bytes); err != nil {
+		log.Error(err, log.Data{})
+	}
+}
+
+func (api *RendererAPI) deletePreset(w http.ResponseWriter, r *http.Request) {
+
+	id := mux.Vars(r)["id"]
+	log.Debug("deletePreset", log.Data{"preset_id": id})
+
+	if !presets.delete(id) {
+		http.Error(w, presetNotFound, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
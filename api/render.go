@@ -1,10 +1,15 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"errors"
 
+	"github.com/ONSdigital/dp-map-renderer/health"
 	"github.com/ONSdigital/dp-map-renderer/models"
 	"github.com/ONSdigital/dp-map-renderer/renderer"
 	"github.com/ONSdigital/go-ns/log"
@@ -19,44 +24,98 @@ var (
 	statusBadRequest  = "bad request"
 )
 
+// warningsHeader is the response header containing a json array of the non-fatal warnings found while rendering a map
+const warningsHeader = "X-Render-Warnings"
+
+// maxWarningsHeaderLength is the maximum length of the warnings header - warnings that don't fit are summarised in a final warning
+const maxWarningsHeaderLength = 4096
+
 // Content types
 var (
 	contentSVG  = "image/svg+xml"
 	contentHTML = "text/html"
+	contentJSON = "application/json"
 )
 
+// renderTypes are the render types of the /render and /render-csv endpoints
+var renderTypes = map[string]bool{"svg": true, "png": true, "all": true, "page": true, "metrics": true}
+
+// renderAllResponse is the json envelope returned for the render type "all", containing both the svg and png html
+type renderAllResponse struct {
+	SVG string `json:"svg"`
+	PNG string `json:"png"`
+}
+
 func (api *RendererAPI) renderMap(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	renderType := vars["render_type"]
 
-	log.Debug("renderMap", log.Data{"headers": r.Header, "render_type": renderType})
-	renderRequest, err := models.CreateRenderRequest(r.Body)
+	atomic.AddInt64(&rendersInFlight, 1)
+	defer atomic.AddInt64(&rendersInFlight, -1)
+	defer health.TrackTime(time.Now(), "render_"+renderType)
+	var renderRequest *models.RenderRequest
+	var err error
+	if isStrict(r) {
+		renderRequest, err = models.CreateRenderRequestStrict(r.Body)
+	} else {
+		renderRequest, err = models.CreateRenderRequest(r.Body)
+	}
 	if err != nil {
 		log.Error(err, nil)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), createErrorCode(err))
+		return
+	}
+
+	if err = renderRequest.ResolveGeography(lookupGeography); err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
 	if err = renderRequest.ValidateRenderRequest(); err != nil {
 		log.Error(err, nil)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), validationErrorCode(err))
 		return
 	}
 
+	api.render(w, r, renderRequest)
+}
+
+// render renders the valid request according to the render_type of the http request, writing the result (or an error) to the response
+func (api *RendererAPI) render(w http.ResponseWriter, r *http.Request, renderRequest *models.RenderRequest) {
+	renderType := mux.Vars(r)["render_type"]
 	var bytes []byte
+	var stats *renderer.RenderStats
+	var err error
+
+	if !renderTypes[renderType] {
+		log.Error(errors.New("Unknown render type"), log.Data{"render_type": renderType})
+		http.Error(w, unknownRenderType, http.StatusNotFound)
+		return
+	}
+
+	if setRenderETag(w, r, renderRequest) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
 
 	switch renderType {
 	case "svg":
-		bytes, err = renderer.RenderHTMLWithSVG(renderRequest)
+		bytes, stats, err = api.mapRenderer.RenderHTMLWithSVGAndStats(renderRequest)
 		setContentType(w, contentHTML)
 	case "png":
-		bytes, err = renderer.RenderHTMLWithPNG(renderRequest)
+		bytes, stats, err = api.mapRenderer.RenderHTMLWithPNGAndStats(renderRequest)
 		setContentType(w, contentHTML)
-	default:
-		log.Error(errors.New("Unknown render type"), log.Data{"render_type": renderType})
-		http.Error(w, unknownRenderType, http.StatusNotFound)
-		return
+	case "all":
+		bytes, stats, err = api.renderAll(renderRequest)
+		setContentType(w, contentJSON)
+	case "page":
+		bytes, stats, err = api.mapRenderer.RenderPageWithStats(renderRequest, isSelfContained(r))
+		setContentType(w, contentHTML)
+	case "metrics":
+		bytes, stats, err = api.renderMetrics(renderRequest)
+		setContentType(w, contentJSON)
 	}
 
 	if err != nil {
@@ -65,6 +124,8 @@ func (api *RendererAPI) renderMap(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logRender(r, renderRequest, stats)
+	setWarningsHeader(w, stats.Warnings)
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(bytes)
 	if err != nil {
@@ -75,10 +136,92 @@ func (api *RendererAPI) renderMap(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// renderAll renders both the svg and png html, returning them in a json envelope (see renderAllResponse)
+func (api *RendererAPI) renderAll(renderRequest *models.RenderRequest) ([]byte, *renderer.RenderStats, error) {
+	svgHTML, pngHTML, stats, err := api.mapRenderer.RenderAll(renderRequest)
+	if err != nil {
+		return nil, stats, err
+	}
+	bytes, err := json.Marshal(renderAllResponse{SVG: string(svgHTML), PNG: string(pngHTML)})
+	return bytes, stats, err
+}
+
+// renderMetrics returns the json of the layout metrics of the map, without rendering it (see renderer.LayoutMetrics)
+func (api *RendererAPI) renderMetrics(renderRequest *models.RenderRequest) ([]byte, *renderer.RenderStats, error) {
+	metrics, stats, err := api.mapRenderer.RenderLayoutMetrics(renderRequest)
+	if err != nil {
+		return nil, stats, err
+	}
+	bytes, err := json.Marshal(metrics)
+	return bytes, stats, err
+}
+
+// logRender writes a single log record describing the render, so that pathological requests can be spotted
+func logRender(r *http.Request, renderRequest *models.RenderRequest, stats *renderer.RenderStats) {
+	data := stats.LogData()
+	data["request_id"] = log.Context(r)
+	data["render_type"] = mux.Vars(r)["render_type"]
+	data["filename"] = renderRequest.Filename
+	data["original_schema_version"] = renderRequest.OriginalSchemaVersion
+	data["version"] = health.Version
+	if len(stats.Warnings) > 0 {
+		data["warnings"] = stats.Warnings
+	}
+	log.InfoR(r, "rendered map", data)
+}
+
+// isStrict returns true if the request has the query parameter strict=true, in which case unknown fields in the request body are rejected
+func isStrict(r *http.Request) bool {
+	return r.URL.Query().Get("strict") == "true"
+}
+
+// isSelfContained returns true if the request has the query parameter self_contained=true, in which case a page (see render type "page")
+// includes the pan-zoom library rather than loading it from a cdn
+func isSelfContained(r *http.Request) bool {
+	return r.URL.Query().Get("self_contained") == "true"
+}
+
+// setWarningsHeader sets the warnings header to a json array of the warnings (if there are any), omitting any that would make the header longer
+// than maxWarningsHeaderLength and replacing them with a count of those omitted
+func setWarningsHeader(w http.ResponseWriter, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	included := warnings
+	for {
+		h := included
+		if len(included) < len(warnings) {
+			h = append(append([]string{}, included...), fmt.Sprintf("... and %d more warnings", len(warnings)-len(included)))
+		}
+		b, err := json.Marshal(h)
+		if err == nil && (len(b) <= maxWarningsHeaderLength || len(included) == 0) {
+			w.Header().Set(warningsHeader, string(b))
+			return
+		}
+		included = included[:len(included)-1]
+	}
+}
+
 func setContentType(w http.ResponseWriter, contentType string) {
 	w.Header().Set("Content-Type", contentType)
 }
 
+// createErrorCode returns the http status for an error creating a render request - 404 if its preset_id is unknown, otherwise 400
+func createErrorCode(err error) int {
+	if _, notFound := err.(*models.PresetNotFoundError); notFound {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// validationErrorCode returns the http status for a request that failed validation - 422 if the geography is too large, otherwise 400
+func validationErrorCode(err error) int {
+	if _, tooLarge := err.(*models.TopologyTooLargeError); tooLarge {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
 func setErrorCode(w http.ResponseWriter, err error) {
 	log.Debug("error is", log.Data{"error": err})
 	switch err.Error() {
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/analyser"
+	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/gorilla/mux"
+)
+
+// messagesHeader is the response header containing a json array of the messages of the analysis of a csv (see renderCSV)
+const messagesHeader = "X-Analyse-Messages"
+
+// analyseFailedResponse is the json body returned (with a 422 status) when the csv of a render-csv request cannot be analysed
+type analyseFailedResponse struct {
+	Messages []*models.Message `json:"messages"`
+}
+
+// renderCSV analyses the csv of the request against its geography (as analyseData does), then renders the map of the resulting data
+// (as renderMap does) - with breaks and a palette suggested by the analysis if the request has none. The messages of the analysis are
+// returned in the messagesHeader.
+func (api *RendererAPI) renderCSV(w http.ResponseWriter, r *http.Request) {
+
+	atomic.AddInt64(&rendersInFlight, 1)
+	defer atomic.AddInt64(&rendersInFlight, -1)
+	defer health.TrackTime(time.Now(), "render_csv_"+mux.Vars(r)["render_type"])
+
+	request, err := models.CreateRenderCSVRequest(r.Body)
+	if err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), createErrorCode(err))
+		return
+	}
+	renderRequest := request.RenderRequest
+
+	if err = renderRequest.ResolveGeography(lookupGeography); err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	analyseRequest := request.AnalyseRequest()
+	if err = analyseRequest.ValidateAnalyseRequest(); err != nil {
+		log.Error(err, log.Data{"_message": "AnalyseRequest failed validation"})
+		http.Error(w, err.Error(), validationErrorCode(err))
+		return
+	}
+
+	response, err := analyser.AnalyseDataWithContext(r.Context(), analyseRequest)
+	if err != nil {
+		log.Error(err, log.Data{"_message": "Unable to Analyse request"})
+		writeAnalyseFailed(w, err)
+		return
+	}
+	request.SetAnalysedData(response)
+
+	if err = renderRequest.ValidateRenderRequest(); err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), validationErrorCode(err))
+		return
+	}
+
+	setMessagesHeader(w, response.Messages)
+	api.render(w, r, renderRequest)
+}
+
+// writeAnalyseFailed writes a 422 response with the error of an analysis that failed, as an error message (see analyseFailedResponse)
+func writeAnalyseFailed(w http.ResponseWriter, err error) {
+	bytes, e := json.Marshal(analyseFailedResponse{Messages: []*models.Message{{Level: "error", Text: err.Error()}}})
+	if e != nil {
+		log.Error(e, log.Data{"_message": "Unable to marshal response"})
+		setErrorCode(w, e)
+		return
+	}
+	setContentType(w, contentJSON)
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	if _, e = w.Write(bytes); e != nil {
+		log.Error(e, log.Data{})
+	}
+}
+
+// setMessagesHeader sets the messages header to a json array of the messages (if there are any), without their details
+// and omitting any that would make the header longer than maxWarningsHeaderLength
+func setMessagesHeader(w http.ResponseWriter, messages []*models.Message) {
+	summaries := []*models.Message{}
+	for _, m := range messages {
+		summaries = append(summaries, &models.Message{Level: m.Level, Code: m.Code, Count: m.Count, Text: m.Text, Truncated: m.Truncated || len(m.Details) > 0})
+	}
+	for len(summaries) > 0 {
+		b, err := json.Marshal(summaries)
+		if err == nil && len(b) <= maxWarningsHeaderLength {
+			w.Header().Set(messagesHeader, string(b))
+			return
+		}
+		summaries = summaries[:len(summaries)-1]
+	}
+}
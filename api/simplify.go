@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/geography"
+	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+func (api *RendererAPI) simplifyTopology(w http.ResponseWriter, r *http.Request) {
+
+	defer health.TrackTime(time.Now(), "simplify")
+	log.Debug("simplifyTopology", log.Data{"headers": r.Header})
+	var request *models.SimplifyRequest
+	var err error
+	if isStrict(r) {
+		request, err = models.CreateSimplifyRequestStrict(r.Body)
+	} else {
+		request, err = models.CreateSimplifyRequest(r.Body)
+	}
+	if err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = request.ResolveGeography(lookupGeography); err != nil {
+		log.Error(err, nil)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err = request.ValidateSimplifyRequest(); err != nil {
+		log.Error(err, log.Data{"_message": "SimplifyRequest failed validation"})
+		http.Error(w, err.Error(), validationErrorCode(err))
+		return
+	}
+
+	response, err := geography.Simplify(request.Geography, request.Tolerance, request.TargetPoints, request.Quantisation)
+	if err != nil {
+		log.Error(err, log.Data{"_message": "Unable to simplify topology"})
+		setErrorCode(w, err)
+		return
+	}
+	log.Debug("simplified topology", log.Data{"before": response.Before, "after": response.After, "tolerance": response.Tolerance})
+
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err, log.Data{"_message": "Unable to marshal response"})
+		setErrorCode(w, err)
+		return
+	}
+
+	setContentType(w, contentJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(bytes); err != nil {
+		log.Error(err, log.Data{})
+	}
+}
@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/ONSdigital/dp-map-renderer/analyser"
 	"github.com/ONSdigital/dp-map-renderer/api"
 	"github.com/ONSdigital/dp-map-renderer/config"
+	"github.com/ONSdigital/dp-map-renderer/geography"
 	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/health"
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/ONSdigital/dp-map-renderer/models"
 	"github.com/ONSdigital/dp-map-renderer/renderer"
 	"github.com/ONSdigital/go-ns/log"
 )
@@ -19,6 +27,8 @@ func main() {
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
 
 	cfg, err := config.Get()
 	if err != nil {
@@ -30,33 +40,160 @@ func main() {
 
 	apiErrors := make(chan error, 1)
 
-	renderer.UsePNGConverter(geojson2svg.NewPNGConverter(cfg.SVG2PNGExecutable, cfg.SVG2PNGArguments))
+	// conversions to png write temporary files in the scratch directory - any left by a previous process are removed,
+	// but only once they are stale, as another instance may be converting in the same directory
+	if err := geojson2svg.PrepareScratchDir(cfg.ScratchDir); err != nil {
+		log.Error(err, log.Data{"scratch_dir": cfg.ScratchDir, "_message": "set SCRATCH_DIR to a writable directory"})
+		os.Exit(1)
+	}
+	staleAge := cfg.ScratchSweepInterval
+	if staleAge <= 0 {
+		staleAge = geojson2svg.StaleScratchFileAge
+	}
+	if n, err := geojson2svg.SweepScratchDir(cfg.ScratchDir, staleAge); err != nil {
+		log.Error(err, log.Data{"scratch_dir": cfg.ScratchDir})
+		os.Exit(1)
+	} else if n > 0 {
+		log.Info("removed stale temporary files from the scratch directory", log.Data{"scratch_dir": cfg.ScratchDir, "files": n})
+	}
+	if cfg.ScratchSweepInterval > 0 {
+		geojson2svg.StartScratchSweep(context.Background(), cfg.ScratchDir, cfg.ScratchSweepInterval) // runs until the process exits
+	}
 
-	api.CreateRendererAPI(cfg.BindAddr, cfg.CORSAllowedOrigins, apiErrors)
+	var panZoomScript []byte
+	if len(cfg.PanZoomScriptFile) > 0 {
+		if panZoomScript, err = ioutil.ReadFile(cfg.PanZoomScriptFile); err != nil {
+			log.Error(err, log.Data{"pan_zoom_script_file": cfg.PanZoomScriptFile})
+			os.Exit(1)
+		}
+	}
 
-	// Gracefully shutdown the application closing any open resources.
-	gracefulShutdown := func() {
-		log.Info(fmt.Sprintf("Shutdown with timeout: %s", cfg.ShutdownTimeout), nil)
-		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	mapRenderer := renderer.New(geojson2svg.NewPNGConverterInDir(cfg.ScratchDir, cfg.SVG2PNGExecutable, cfg.SVG2PNGArguments), renderer.RendererOptions{
+		ViewBoxWidth:              cfg.DefaultViewBoxWidth,
+		HorizontalKeyHeight:       cfg.HorizontalKeyHeight,
+		VerticalKeyHeightFraction: cfg.VerticalKeyFraction,
+		LegendPadding:             cfg.LegendPadding,
+		FontSize:                  cfg.DefaultFontSize,
+		MaxFallbackPNGSize:        cfg.MaxFallbackPNGSize,
+		MinFallbackPNGScale:       cfg.MinFallbackPNGScale,
+		PanZoomScript:             string(panZoomScript),
+		Deterministic:             cfg.DeterministicOutput,
+		ColourBlindChecks:         cfg.ColourBlindChecks,
+	})
+	models.UseDefaults(cfg.DefaultViewBoxWidth, cfg.DefaultFontSize)
+	analyser.UseSampleSize(cfg.AnalyseSampleSize)
+	analyser.UseMaxRows(cfg.AnalyseMaxRows)
+	analyser.UseMaxMessageDetails(cfg.AnalyseMaxMessageDetails)
+	analyser.UseBreaksCache(analyser.NewBreaksCache(cfg.AnalyseBreaksCacheSize))
+	analyser.UseColourBlindChecks(cfg.ColourBlindChecks)
+	analyser.UseMaxXLSXEntrySize(cfg.AnalyseMaxXLSXEntrySize)
+	api.UseMaxUploadSize(cfg.AnalyseMaxUploadSize)
+	models.UseTopologyLimits(cfg.TopologyMaxArcs, cfg.TopologyMaxObjects, cfg.TopologyMaxCoordinates)
 
-		if err = api.Close(ctx); err != nil {
+	if len(cfg.TextFontFile) > 0 {
+		metrics, err := htmlutil.LoadFontMetrics(cfg.TextFontFile)
+		if err != nil {
+			log.Error(err, log.Data{"text_font_file": cfg.TextFontFile})
+			os.Exit(1)
+		}
+		htmlutil.UseTextMeasurer("", metrics)
+		htmlutil.UseTextMeasurer(metrics.FamilyName(), metrics)
+	}
+
+	store := geography.NewStore()
+	if len(cfg.GeographyStoreDir) > 0 {
+		if store, err = geography.NewDiskStore(cfg.GeographyStoreDir); err != nil {
 			log.Error(err, nil)
+			os.Exit(1)
 		}
+	}
+	store.SetMaxCount(cfg.GeographyStoreMaxCount)
+	api.UseGeographyStore(store)
+
+	selfTestCtx, stopSelfTest := context.WithCancel(context.Background())
+	var selfTestStopped <-chan struct{}
+	if cfg.SelfTestInterval > 0 {
+		selfTest := health.NewSelfTest("self_test", mapRenderer.SelfTest, cfg.SelfTestInterval)
+		health.UseSelfTest(selfTest)
+		selfTestStopped = selfTest.Start(selfTestCtx)
+	}
 
-		cancel()
+	api.UseDebugEndpoints(cfg.DebugEndpointsEnabled, cfg.DebugBindAddr)
+	api.UseRenderCacheMaxAge(cfg.RenderCacheMaxAge)
+	api.CreateRendererAPI(cfg.BindAddr, cfg.CORSAllowedOrigins, mapRenderer, apiErrors)
 
-		log.Info("Shutdown complete", nil)
-		os.Exit(1)
+	svc := &service{stopSelfTest: stopSelfTest, selfTestStopped: selfTestStopped, closeAPI: api.Close}
+
+	// Replace the png converter if its configuration has changed. Renders in progress finish with the previous converter.
+	reloadConverter := func() {
+		newCfg, err := config.Reload()
+		if err != nil {
+			log.ErrorC("unable to reload configuration - the png converter is unchanged", err, nil)
+			return
+		}
+		data := log.Data{
+			"previous_executable": cfg.SVG2PNGExecutable, "previous_arg_line": cfg.SVG2PNGArgLine,
+			"executable": newCfg.SVG2PNGExecutable, "arg_line": newCfg.SVG2PNGArgLine,
+		}
+		if newCfg.SVG2PNGExecutable == cfg.SVG2PNGExecutable && newCfg.SVG2PNGArgLine == cfg.SVG2PNGArgLine {
+			log.Info("configuration reloaded - the png converter is unchanged", data)
+			return
+		}
+		mapRenderer.UsePNGConverter(geojson2svg.NewPNGConverterInDir(cfg.ScratchDir, newCfg.SVG2PNGExecutable, newCfg.SVG2PNGArguments))
+		cfg.SVG2PNGExecutable, cfg.SVG2PNGArgLine, cfg.SVG2PNGArguments = newCfg.SVG2PNGExecutable, newCfg.SVG2PNGArgLine, newCfg.SVG2PNGArguments
+		log.Info("configuration reloaded - the png converter has changed", data)
 	}
 
 	for {
 		select {
+		case <-reloadSignals:
+			log.Debug("reload signal received", nil)
+			reloadConverter()
 		case err := <-apiErrors:
 			log.ErrorC("api error received", err, nil)
-			gracefulShutdown()
+			os.Exit(svc.shutdown(cfg.ShutdownTimeout, err))
 		case <-signals:
 			log.Debug("os signal received", nil)
-			gracefulShutdown()
+			os.Exit(svc.shutdown(cfg.ShutdownTimeout, nil))
+		}
+	}
+}
+
+// service holds the parts of the application that must be stopped gracefully
+type service struct {
+	stopSelfTest    context.CancelFunc
+	selfTestStopped <-chan struct{} // closed once the self test has stopped - nil if there is no self test
+	closeAPI        func(ctx context.Context) error
+}
+
+// shutdown gracefully stops the application within the timeout, returning the exit code: 0 following a signal, or 1 if the shutdown was
+// caused by an error, or did not complete. The self test is stopped (waiting for any test in progress), then the api is closed,
+// which waits for in-flight requests - including any conversions to png - to finish.
+func (s *service) shutdown(timeout time.Duration, cause error) int {
+	log.Info(fmt.Sprintf("Shutdown with timeout: %s", timeout), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	exitCode := 0
+	if cause != nil {
+		exitCode = 1
+	}
+
+	s.stopSelfTest()
+	if s.selfTestStopped != nil {
+		select {
+		case <-s.selfTestStopped:
+		case <-ctx.Done():
+			log.Error(errors.New("timed out waiting for the self test to stop"), nil)
+			exitCode = 1
 		}
 	}
+
+	if err := s.closeAPI(ctx); err != nil {
+		log.Error(err, nil)
+		exitCode = 1
+	}
+
+	log.Info("Shutdown complete", log.Data{"exit_code": exitCode})
+	return exitCode
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testService returns a service whose self test stops after selfTestDelay, and whose api takes closeDelay to close, returning closeErr
+func testService(selfTestDelay time.Duration, closeDelay time.Duration, closeErr error) (*service, *bool) {
+	selfTestStopped := make(chan struct{})
+	closed := false
+	svc := &service{
+		stopSelfTest: func() {
+			go func() {
+				time.Sleep(selfTestDelay)
+				close(selfTestStopped)
+			}()
+		},
+		selfTestStopped: selfTestStopped,
+		closeAPI: func(ctx context.Context) error {
+			select {
+			case <-time.After(closeDelay):
+				closed = true
+				return closeErr
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+	return svc, &closed
+}
+
+func TestShutdown(t *testing.T) {
+
+	Convey("A shutdown following a signal should exit with 0, once the api has closed", t, func() {
+		svc, closed := testService(10*time.Millisecond, 10*time.Millisecond, nil)
+
+		So(svc.shutdown(time.Second, nil), ShouldEqual, 0)
+		So(*closed, ShouldBeTrue)
+	})
+
+	Convey("A shutdown following an api error should exit with 1, once the api has closed", t, func() {
+		svc, closed := testService(0, 10*time.Millisecond, nil)
+
+		So(svc.shutdown(time.Second, errors.New("listen tcp :23500: bind: address already in use")), ShouldEqual, 1)
+		So(*closed, ShouldBeTrue)
+	})
+
+	Convey("A shutdown should exit with 1 if the api fails to close", t, func() {
+		svc, closed := testService(0, 0, errors.New("close failed"))
+
+		So(svc.shutdown(time.Second, nil), ShouldEqual, 1)
+		So(*closed, ShouldBeTrue)
+	})
+
+	Convey("A shutdown should exit with 1 if the api does not close within the timeout", t, func() {
+		svc, closed := testService(0, time.Second, nil)
+
+		start := time.Now()
+		So(svc.shutdown(50*time.Millisecond, nil), ShouldEqual, 1)
+		So(*closed, ShouldBeFalse)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+
+	Convey("A shutdown should wait for the self test to stop before closing the api", t, func() {
+		svc, _ := testService(20*time.Millisecond, 0, nil)
+		selfTestStopped := svc.selfTestStopped
+		svc.closeAPI = func(ctx context.Context) error {
+			select {
+			case <-selfTestStopped:
+				return nil
+			default:
+				return errors.New("the api was closed before the self test stopped")
+			}
+		}
+
+		So(svc.shutdown(time.Second, nil), ShouldEqual, 0)
+	})
+
+	Convey("A shutdown should exit with 1 if the self test does not stop within the timeout", t, func() {
+		svc, _ := testService(time.Second, 0, nil)
+
+		So(svc.shutdown(50*time.Millisecond, nil), ShouldEqual, 1)
+	})
+
+	Convey("A shutdown without a self test should exit with 0", t, func() {
+		svc, closed := testService(0, 0, nil)
+		svc.selfTestStopped = nil
+
+		So(svc.shutdown(time.Second, nil), ShouldEqual, 0)
+		So(*closed, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,86 @@
+package colour
+
+import (
+	"fmt"
+)
+
+// The thresholds at which CheckPalette reports colours that are hard to tell apart.
+// They are lenient enough that the palettes of package palette are not reported (other than those that are not colour blind safe,
+// when checked for colour blindness), even with 9 sequential classes.
+const (
+	// MinAdjacentContrast and MinAdjacentDifference - adjacent classes are reported if both their contrast ratio and their difference are below these
+	// (adjacent classes of a similar lightness are distinguishable if their hues differ, as in the middle of a diverging palette)
+	MinAdjacentContrast   = 1.05
+	MinAdjacentDifference = 10.0
+	// MinForegroundContrast is the contrast ratio with the key text and outline colours below which a class is reported
+	MinForegroundContrast = 1.2
+	// MaxColourBlindDifference and colourBlindFactor - two classes are reported as indistinguishable with a colour vision deficiency if their
+	// simulated difference is below MaxColourBlindDifference, and less than 1/colourBlindFactor of their actual difference
+	MaxColourBlindDifference = 9.0
+	colourBlindFactor        = 5.0
+)
+
+// Foreground is a colour drawn on or around the swatches of the key (e.g. the key text or the outline of the swatches), that
+// should be visible against the colour of each class
+type Foreground struct {
+	Name   string // describes the use of the colour, e.g. "the key text"
+	Colour string
+}
+
+// CheckPalette returns warnings describing the colours of the classes of a map (ordered from the lowest class to the highest) that
+// may be hard to tell apart: adjacent classes with a low contrast ratio and a small difference (see MinAdjacentContrast), and classes with a low
+// contrast against one of the foreground colours (see MinForegroundContrast). If colourBlind is true, any two classes that become
+// indistinguishable with protanopia or deuteranopia are also reported - the red-green deficiencies for which the colour blind safe palettes
+// of ColorBrewer are designed (tritanopia is much rarer, and would report the yellow and green classes of most palettes).
+// Colours that cannot be parsed are ignored.
+func CheckPalette(colours []string, foregrounds []Foreground, colourBlind bool) []string {
+	parsed := make([]*Colour, len(colours))
+	for i, value := range colours {
+		if c, err := Parse(value); err == nil {
+			parsed[i] = &c
+		}
+	}
+
+	var warnings []string
+	for i := 1; i < len(parsed); i++ {
+		a, b := parsed[i-1], parsed[i]
+		if a == nil || b == nil {
+			continue
+		}
+		if contrast := Contrast(*a, *b); contrast < MinAdjacentContrast && Difference(*a, *b) < MinAdjacentDifference {
+			warnings = append(warnings, fmt.Sprintf("Adjacent classes %d and %d (%s and %s) are hard to tell apart: their contrast ratio is %.2f:1", i, i+1, colours[i-1], colours[i], contrast))
+		}
+	}
+
+	for _, f := range foregrounds {
+		fg, err := Parse(f.Colour)
+		if err != nil {
+			continue
+		}
+		for i, c := range parsed {
+			if c == nil {
+				continue
+			}
+			if contrast := Contrast(*c, fg); contrast < MinForegroundContrast {
+				warnings = append(warnings, fmt.Sprintf("%s (%s) is hard to see against class %d (%s): their contrast ratio is %.2f:1", f.Name, f.Colour, i+1, colours[i], contrast))
+			}
+		}
+	}
+
+	if colourBlind {
+		for _, deficiency := range []string{Protanopia, Deuteranopia} {
+			for i := range parsed {
+				for j := i + 1; j < len(parsed); j++ {
+					if parsed[i] == nil || parsed[j] == nil {
+						continue
+					}
+					simulated := Difference(Simulate(*parsed[i], deficiency), Simulate(*parsed[j], deficiency))
+					if simulated < MaxColourBlindDifference && simulated*colourBlindFactor < Difference(*parsed[i], *parsed[j]) {
+						warnings = append(warnings, fmt.Sprintf("Classes %d and %d (%s and %s) are hard to tell apart with %s", i+1, j+1, colours[i], colours[j], deficiency))
+					}
+				}
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,202 @@
+// Package colour parses css colours and measures how distinguishable they are - their WCAG contrast ratio
+// (see https://www.w3.org/TR/WCAG21/#dfn-contrast-ratio), their difference in the CIELAB colour space, and how they appear
+// to viewers with a colour vision deficiency.
+package colour
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// hexColour matches #rgb, #rrggbb and #rrggbbaa colours
+	hexColour = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	// rgbColour matches rgb() with 3, and rgba() with 4, numeric (or percentage) arguments
+	rgbColour = regexp.MustCompile(`^(?i:rgba?)\(\s*(` + colourArg + `(?:\s*,\s*` + colourArg + `){2,3})\s*\)$`)
+)
+
+const colourArg = `[0-9]*\.?[0-9]+%?`
+
+// Colour is an opaque colour, with red, green and blue components between 0 and 1 (in the sRGB colour space)
+type Colour struct {
+	R, G, B float64
+}
+
+// White is the colour of the background that colours with an alpha component are composited over
+var White = Colour{1, 1, 1}
+
+// Parse returns the colour of a css hex colour (#rgb, #rrggbb or #rrggbbaa), rgb() or rgba() colour, or css named colour (in any case).
+// Colours that are not opaque are composited over White, as they would appear on the page.
+func Parse(value string) (Colour, error) {
+	value = strings.TrimSpace(value)
+	if rgb, ok := namedColours[strings.ToLower(value)]; ok {
+		return Colour{float64(rgb[0]) / 255, float64(rgb[1]) / 255, float64(rgb[2]) / 255}, nil
+	}
+	if strings.EqualFold(value, "transparent") {
+		return White, nil
+	}
+	if hexColour.MatchString(value) {
+		return parseHex(value[1:]), nil
+	}
+	if match := rgbColour.FindStringSubmatch(value); match != nil {
+		args := strings.Split(match[1], ",")
+		if strings.HasPrefix(strings.ToLower(value), "rgba") != (len(args) == 4) {
+			return Colour{}, fmt.Errorf("Not a valid colour: %v", value)
+		}
+		components := make([]float64, 4)
+		components[3] = 1
+		for i, arg := range args {
+			components[i] = parseArg(strings.TrimSpace(arg), i == 3)
+		}
+		return Colour{components[0], components[1], components[2]}.withAlpha(components[3]), nil
+	}
+	return Colour{}, fmt.Errorf("Not a valid colour: %v", value)
+}
+
+// IsNamed returns true if the value is a css named colour (in any case), including transparent
+func IsNamed(value string) bool {
+	_, ok := namedColours[strings.ToLower(value)]
+	return ok || strings.EqualFold(value, "transparent")
+}
+
+// parseHex returns the colour of the digits of a hex colour (without the #)
+func parseHex(digits string) Colour {
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	component := func(i int) float64 {
+		v, _ := strconv.ParseUint(digits[i:i+2], 16, 8)
+		return float64(v) / 255
+	}
+	c := Colour{component(0), component(2), component(4)}
+	if len(digits) == 8 {
+		return c.withAlpha(component(6))
+	}
+	return c
+}
+
+// parseArg returns the value of an argument of rgb() or rgba() between 0 and 1 - a percentage, a number between 0 and 255,
+// or (for the alpha argument) a number between 0 and 1
+func parseArg(arg string, alpha bool) float64 {
+	scale := 255.0
+	if alpha {
+		scale = 1
+	}
+	if strings.HasSuffix(arg, "%") {
+		arg, scale = strings.TrimSuffix(arg, "%"), 100
+	}
+	v, _ := strconv.ParseFloat(arg, 64)
+	return math.Min(v/scale, 1)
+}
+
+// withAlpha returns the colour with the given alpha composited over White
+func (c Colour) withAlpha(alpha float64) Colour {
+	blend := func(v float64) float64 { return v*alpha + 1 - alpha }
+	return Colour{blend(c.R), blend(c.G), blend(c.B)}
+}
+
+// Hex returns the #rrggbb form of the colour
+func (c Colour) Hex() string {
+	component := func(v float64) int { return int(math.Floor(math.Max(0, math.Min(1, v))*255 + 0.5)) }
+	return fmt.Sprintf("#%02x%02x%02x", component(c.R), component(c.G), component(c.B))
+}
+
+// linear returns the linear (gamma expanded) value of an sRGB component
+func linear(v float64) float64 {
+	if v <= 0.03928 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// gamma returns the sRGB value of a linear component, clamped between 0 and 1
+func gamma(v float64) float64 {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Luminance returns the relative luminance of the colour, as defined by WCAG - between 0 (black) and 1 (white)
+func (c Colour) Luminance() float64 {
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B)
+}
+
+// Contrast returns the WCAG contrast ratio of the two colours, between 1 (the same luminance) and 21 (black and white).
+// WCAG requires a ratio of at least 4.5 for text, and 3 for large text and the graphical parts of a page.
+func Contrast(a, b Colour) float64 {
+	la, lb := a.Luminance(), b.Luminance()
+	return (math.Max(la, lb) + 0.05) / (math.Min(la, lb) + 0.05)
+}
+
+// Difference returns the distance between the two colours in the CIELAB colour space (the CIE76 delta E),
+// where a difference of about 2.3 is just noticeable, and colours that are less than about 10 apart are hard to tell apart on a map
+func Difference(a, b Colour) float64 {
+	l1, a1, b1 := a.lab()
+	l2, a2, b2 := b.lab()
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
+
+// lab returns the CIELAB coordinates of the colour (with a D65 white point)
+func (c Colour) lab() (l, a, b float64) {
+	r, g, bl := linear(c.R), linear(c.G), linear(c.B)
+	x := (0.4124*r + 0.3576*g + 0.1805*bl) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*bl
+	z := (0.0193*r + 0.1192*g + 0.9505*bl) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// The colour vision deficiencies that colours may be simulated for (see Simulate)
+const (
+	Protanopia   = "protanopia"
+	Deuteranopia = "deuteranopia"
+	Tritanopia   = "tritanopia"
+)
+
+// Deficiencies are all the colour vision deficiencies that colours may be simulated for
+var Deficiencies = []string{Protanopia, Deuteranopia, Tritanopia}
+
+// deficiencyMatrices transform linear rgb to its appearance with each deficiency (Machado, Oliveira and Fernandes, 2009, at severity 1)
+var deficiencyMatrices = map[string][3][3]float64{
+	Protanopia: {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	Deuteranopia: {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	Tritanopia: {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// Simulate returns the colour as it appears to a viewer with the given colour vision deficiency (one of Deficiencies),
+// or the colour unchanged if the deficiency is not known
+func Simulate(c Colour, deficiency string) Colour {
+	m, ok := deficiencyMatrices[deficiency]
+	if !ok {
+		return c
+	}
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+	return Colour{
+		gamma(m[0][0]*r + m[0][1]*g + m[0][2]*b),
+		gamma(m[1][0]*r + m[1][1]*g + m[1][2]*b),
+		gamma(m[2][0]*r + m[2][1]*g + m[2][2]*b),
+	}
+}
@@ -0,0 +1,126 @@
+package colour_test
+
+import (
+	"testing"
+
+	. "github.com/ONSdigital/dp-map-renderer/colour"
+	"github.com/ONSdigital/dp-map-renderer/palette"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Parse should parse hex, rgb() and named colours", t, func() {
+		for _, value := range []string{"#f80", "#ff8800", "#FF8800ff", "rgb(255, 136, 0)", "RGB(100%,53.333%,0%)", "rgba(255, 136, 0, 1)", " #ff8800 "} {
+			c, err := Parse(value)
+			So(err, ShouldBeNil)
+			So(c.Hex(), ShouldEqual, "#ff8800")
+		}
+		c, err := Parse("DarkOrange")
+		So(err, ShouldBeNil)
+		So(c.Hex(), ShouldEqual, "#ff8c00")
+	})
+
+	Convey("Parse should composite colours that are not opaque over white", t, func() {
+		for _, value := range []string{"rgba(0, 0, 0, 0.5)", "rgba(0, 0, 0, 50%)"} {
+			c, err := Parse(value)
+			So(err, ShouldBeNil)
+			So(c.Hex(), ShouldEqual, "#808080")
+		}
+		c, err := Parse("#00000080")
+		So(err, ShouldBeNil)
+		So(c.Hex(), ShouldEqual, "#7f7f7f")
+		c, err = Parse("transparent")
+		So(err, ShouldBeNil)
+		So(c, ShouldResemble, White)
+	})
+
+	Convey("Parse should return an error for anything else", t, func() {
+		for _, value := range []string{"", "#ff88", "ff8800", "rgb(255, 136)", "rgb(255, 136, 0, 1)", "rgba(255, 136, 0)", "notacolour", "url(#pattern)"} {
+			_, err := Parse(value)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestContrast(t *testing.T) {
+	black, _ := Parse("black")
+	white, _ := Parse("white")
+
+	Convey("Contrast should return the WCAG contrast ratio, whatever the order of the colours", t, func() {
+		So(Contrast(black, white), ShouldAlmostEqual, 21)
+		So(Contrast(white, black), ShouldAlmostEqual, 21)
+		So(Contrast(black, black), ShouldEqual, 1)
+		grey, _ := Parse("#767676")
+		So(Contrast(grey, white), ShouldAlmostEqual, 4.54, 0.01)
+	})
+
+	Convey("Difference should be 0 for the same colour, and greatest for black and white", t, func() {
+		So(Difference(white, white), ShouldEqual, 0)
+		So(Difference(black, white), ShouldAlmostEqual, 100, 0.01)
+	})
+}
+
+func TestSimulate(t *testing.T) {
+	Convey("Simulate should leave greys unchanged", t, func() {
+		grey, _ := Parse("#808080")
+		for _, d := range Deficiencies {
+			So(Difference(Simulate(grey, d), grey), ShouldBeLessThan, 1)
+		}
+	})
+
+	Convey("Simulate should make red and green of a similar lightness hard to tell apart with deuteranopia, but not with tritanopia", t, func() {
+		red, _ := Parse("#fc8d59")
+		green, _ := Parse("#91cf60")
+		So(Difference(Simulate(red, Deuteranopia), Simulate(green, Deuteranopia)), ShouldBeLessThan, Difference(red, green)/5)
+		So(Difference(Simulate(red, Tritanopia), Simulate(green, Tritanopia)), ShouldBeGreaterThan, Difference(red, green)/5)
+	})
+
+	Convey("Simulate should not change the colour for an unknown deficiency", t, func() {
+		red, _ := Parse("red")
+		So(Simulate(red, "unknown"), ShouldResemble, red)
+	})
+}
+
+func TestCheckPalette(t *testing.T) {
+	foregrounds := []Foreground{{Name: "The key text", Colour: "black"}}
+
+	Convey("CheckPalette should report adjacent classes that are hard to tell apart, and classes the foreground cannot be seen against", t, func() {
+		warnings := CheckPalette([]string{"#ffffff", "rgb(250, 250, 250)", "#888888", "#111111", "Black"}, foregrounds, false)
+		So(warnings, ShouldResemble, []string{
+			"Adjacent classes 1 and 2 (#ffffff and rgb(250, 250, 250)) are hard to tell apart: their contrast ratio is 1.04:1",
+			"The key text (black) is hard to see against class 4 (#111111): their contrast ratio is 1.11:1",
+			"The key text (black) is hard to see against class 5 (Black): their contrast ratio is 1.00:1",
+		})
+	})
+
+	Convey("CheckPalette should not report adjacent classes of a similar lightness but a different hue", t, func() {
+		So(CheckPalette([]string{"#f4a582", "#92c5de"}, foregrounds, false), ShouldBeEmpty)
+	})
+
+	Convey("CheckPalette should ignore colours that cannot be parsed", t, func() {
+		So(CheckPalette([]string{"#ffffff", "url(#pattern)", "#fefefe"}, []Foreground{{Name: "The outline", Colour: "none"}}, false), ShouldBeEmpty)
+	})
+
+	Convey("CheckPalette should not report the ColorBrewer palettes", t, func() {
+		for _, p := range palette.All() {
+			for n := 2; n <= 11; n++ {
+				if colours, err := p.Colours(n); err == nil {
+					So(CheckPalette(colours, foregrounds, false), ShouldBeEmpty)
+				}
+			}
+		}
+	})
+
+	Convey("CheckPalette should only report classes that are hard to tell apart with colour blindness if asked to", t, func() {
+		for _, p := range palette.All() {
+			for n := 2; n <= 11; n++ {
+				if colours, err := p.Colours(n); err == nil {
+					So(CheckPalette(colours, foregrounds, false), ShouldBeEmpty)
+					So(len(CheckPalette(colours, foregrounds, true)) > 0, ShouldEqual, !p.ColourBlindSafe)
+				}
+			}
+		}
+		colours, _ := palette.Get("RdYlGn").Colours(2)
+		So(CheckPalette(colours, nil, true), ShouldResemble, []string{"Classes 1 and 2 (#fc8d59 and #91cf60) are hard to tell apart with deuteranopia"})
+	})
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"time"
 
 	"strings"
@@ -11,12 +13,40 @@ import (
 
 // Config is the configuration for this service
 type Config struct {
-	BindAddr           string        `envconfig:"BIND_ADDR"`
-	CORSAllowedOrigins string        `envconfig:"CORS_ALLOWED_ORIGINS"`
-	ShutdownTimeout    time.Duration `envconfig:"SHUTDOWN_TIMEOUT"`
-	SVG2PNGExecutable  string        `envconfig:"SVG_2_PNG_EXECUTABLE"`
-	SVG2PNGArgLine     string        `envconfig:"SVG_2_PNG_ARG_LINE"`
-	SVG2PNGArguments   []string
+	BindAddr                 string        `envconfig:"BIND_ADDR"`
+	CORSAllowedOrigins       string        `envconfig:"CORS_ALLOWED_ORIGINS"`
+	ShutdownTimeout          time.Duration `envconfig:"SHUTDOWN_TIMEOUT"`
+	SVG2PNGExecutable        string        `envconfig:"SVG_2_PNG_EXECUTABLE"`
+	SVG2PNGArgLine           string        `envconfig:"SVG_2_PNG_ARG_LINE"`
+	SVG2PNGArguments         []string
+	ScratchDir               string        `envconfig:"SCRATCH_DIR"`
+	ScratchSweepInterval     time.Duration `envconfig:"SCRATCH_SWEEP_INTERVAL"`
+	AnalyseSampleSize        int           `envconfig:"ANALYSE_SAMPLE_SIZE"`
+	AnalyseMaxRows           int           `envconfig:"ANALYSE_MAX_ROWS"`
+	AnalyseMaxMessageDetails int           `envconfig:"ANALYSE_MAX_MESSAGE_DETAILS"`
+	AnalyseBreaksCacheSize   int           `envconfig:"ANALYSE_BREAKS_CACHE_SIZE"`
+	AnalyseMaxUploadSize     int64         `envconfig:"ANALYSE_MAX_UPLOAD_SIZE"`
+	AnalyseMaxXLSXEntrySize  int64         `envconfig:"ANALYSE_MAX_XLSX_ENTRY_SIZE"`
+	TopologyMaxArcs          int           `envconfig:"TOPOLOGY_MAX_ARCS"`
+	TopologyMaxObjects       int           `envconfig:"TOPOLOGY_MAX_OBJECTS"`
+	TopologyMaxCoordinates   int           `envconfig:"TOPOLOGY_MAX_COORDINATES"`
+	GeographyStoreDir        string        `envconfig:"GEOGRAPHY_STORE_DIR"`
+	GeographyStoreMaxCount   int           `envconfig:"GEOGRAPHY_STORE_MAX_COUNT"`
+	TextFontFile             string        `envconfig:"TEXT_FONT_FILE"`
+	PanZoomScriptFile        string        `envconfig:"PAN_ZOOM_SCRIPT_FILE"`
+	SelfTestInterval         time.Duration `envconfig:"SELF_TEST_INTERVAL"`
+	DebugEndpointsEnabled    bool          `envconfig:"DEBUG_ENDPOINTS_ENABLED"`
+	DebugBindAddr            string        `envconfig:"DEBUG_BIND_ADDR"`
+	DefaultViewBoxWidth      float64       `envconfig:"DEFAULT_VIEWBOX_WIDTH"`
+	HorizontalKeyHeight      float64       `envconfig:"HORIZONTAL_KEY_HEIGHT"`
+	VerticalKeyFraction      float64       `envconfig:"VERTICAL_KEY_FRACTION"`
+	LegendPadding            float64       `envconfig:"LEGEND_PADDING"`
+	DefaultFontSize          int           `envconfig:"DEFAULT_FONT_SIZE"`
+	MaxFallbackPNGSize       int           `envconfig:"MAX_FALLBACK_PNG_SIZE"`
+	MinFallbackPNGScale      float64       `envconfig:"MIN_FALLBACK_PNG_SCALE"`
+	DeterministicOutput      bool          `envconfig:"DETERMINISTIC_OUTPUT"`
+	RenderCacheMaxAge        time.Duration `envconfig:"RENDER_CACHE_MAX_AGE"`
+	ColourBlindChecks        bool          `envconfig:"COLOUR_BLIND_CHECKS"`
 }
 
 var cfg *Config
@@ -28,27 +58,80 @@ func Get() (*Config, error) {
 	}
 
 	cfg = &Config{
-		BindAddr:           ":23500",
-		CORSAllowedOrigins: "*",
-		ShutdownTimeout:    5 * time.Second,
-		SVG2PNGExecutable:  "rsvg-convert",
-		SVG2PNGArgLine:     "<SVG>|-o|<PNG>",
+		BindAddr:                 ":23500",
+		CORSAllowedOrigins:       "*",
+		ShutdownTimeout:          5 * time.Second,
+		SVG2PNGExecutable:        "rsvg-convert",
+		SVG2PNGArgLine:           "<SVG>|-o|<PNG>",
+		ScratchDir:               filepath.Join(os.TempDir(), "dp-map-renderer"),
+		ScratchSweepInterval:     10 * time.Minute,
+		AnalyseSampleSize:        5000,
+		AnalyseMaxRows:           100000,
+		AnalyseMaxMessageDetails: 50,
+		AnalyseBreaksCacheSize:   32,
+		AnalyseMaxUploadSize:     32 << 20,
+		AnalyseMaxXLSXEntrySize:  100 << 20,
+		TopologyMaxArcs:          100000,
+		TopologyMaxObjects:       20000,
+		TopologyMaxCoordinates:   2000000,
+		GeographyStoreMaxCount:   1000,
+		SelfTestInterval:         5 * time.Minute,
+		DefaultViewBoxWidth:      400,
+		HorizontalKeyHeight:      90,
+		VerticalKeyFraction:      0.8,
+		LegendPadding:            10,
+		DefaultFontSize:          14,
+		MaxFallbackPNGSize:       0,
+		MinFallbackPNGScale:      0.25,
+		RenderCacheMaxAge:        time.Hour,
 	}
 
+	err := envconfig.Process("", cfg)
 	cfg.SVG2PNGArguments = strings.Split(cfg.SVG2PNGArgLine, "|")
 
-	return cfg, envconfig.Process("", cfg)
+	return cfg, err
+}
+
+// Reload discards the configuration returned by Get, re-reading it from the environment
+func Reload() (*Config, error) {
+	cfg = nil
+	return Get()
 }
 
 // Log writes all config properties to log.Debug
 func (cfg *Config) Log() {
 	log.Debug("Configuration", log.Data{
-		"BindAddr":           cfg.BindAddr,
-		"CORSAllowedOrigins": cfg.CORSAllowedOrigins,
-		"ShutdownTimeout":    cfg.ShutdownTimeout,
-		"SVG2PNGExecutable":  cfg.SVG2PNGExecutable,
-		"SVG2PNGArgLine":     cfg.SVG2PNGArgLine,
-		"SVG2PNGArguments":   cfg.SVG2PNGArguments,
+		"BindAddr":                 cfg.BindAddr,
+		"CORSAllowedOrigins":       cfg.CORSAllowedOrigins,
+		"ShutdownTimeout":          cfg.ShutdownTimeout,
+		"SVG2PNGExecutable":        cfg.SVG2PNGExecutable,
+		"SVG2PNGArgLine":           cfg.SVG2PNGArgLine,
+		"SVG2PNGArguments":         cfg.SVG2PNGArguments,
+		"ScratchDir":               cfg.ScratchDir,
+		"ScratchSweepInterval":     cfg.ScratchSweepInterval,
+		"AnalyseSampleSize":        cfg.AnalyseSampleSize,
+		"AnalyseMaxRows":           cfg.AnalyseMaxRows,
+		"AnalyseMaxMessageDetails": cfg.AnalyseMaxMessageDetails,
+		"AnalyseMaxUploadSize":     cfg.AnalyseMaxUploadSize,
+		"AnalyseMaxXLSXEntrySize":  cfg.AnalyseMaxXLSXEntrySize,
+		"TopologyMaxArcs":          cfg.TopologyMaxArcs,
+		"TopologyMaxObjects":       cfg.TopologyMaxObjects,
+		"TopologyMaxCoordinates":   cfg.TopologyMaxCoordinates,
+		"GeographyStoreDir":        cfg.GeographyStoreDir,
+		"GeographyStoreMaxCount":   cfg.GeographyStoreMaxCount,
+		"TextFontFile":             cfg.TextFontFile,
+		"PanZoomScriptFile":        cfg.PanZoomScriptFile,
+		"SelfTestInterval":         cfg.SelfTestInterval,
+		"DebugEndpointsEnabled":    cfg.DebugEndpointsEnabled,
+		"DebugBindAddr":            cfg.DebugBindAddr,
+		"DefaultViewBoxWidth":      cfg.DefaultViewBoxWidth,
+		"HorizontalKeyHeight":      cfg.HorizontalKeyHeight,
+		"VerticalKeyFraction":      cfg.VerticalKeyFraction,
+		"LegendPadding":            cfg.LegendPadding,
+		"DefaultFontSize":          cfg.DefaultFontSize,
+		"MaxFallbackPNGSize":       cfg.MaxFallbackPNGSize,
+		"MinFallbackPNGScale":      cfg.MinFallbackPNGScale,
+		"DeterministicOutput":      cfg.DeterministicOutput,
 	})
 
 }
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -20,6 +22,41 @@ func TestSpec(t *testing.T) {
 			Convey("The values should be set to the expected defaults", func() {
 				So(cfg.BindAddr, ShouldEqual, ":23500")
 				So(cfg.ShutdownTimeout, ShouldEqual, 5*time.Second)
+				So(cfg.ScratchDir, ShouldEqual, filepath.Join(os.TempDir(), "dp-map-renderer"))
+				So(cfg.ScratchSweepInterval, ShouldEqual, 10*time.Minute)
+				So(cfg.SelfTestInterval, ShouldEqual, 5*time.Minute)
+				So(cfg.DebugEndpointsEnabled, ShouldBeFalse)
+				So(cfg.DefaultViewBoxWidth, ShouldEqual, 400)
+				So(cfg.VerticalKeyFraction, ShouldEqual, 0.8)
+				So(cfg.DefaultFontSize, ShouldEqual, 14)
+				So(cfg.MaxFallbackPNGSize, ShouldEqual, 0)
+				So(cfg.MinFallbackPNGScale, ShouldEqual, 0.25)
+				So(cfg.DeterministicOutput, ShouldBeFalse)
+				So(cfg.RenderCacheMaxAge, ShouldEqual, time.Hour)
+				So(cfg.ColourBlindChecks, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestReload(t *testing.T) {
+	Convey("Given a changed environment", t, func() {
+		defer Reload()
+		os.Setenv("SVG_2_PNG_EXECUTABLE", "convert")
+		os.Setenv("SVG_2_PNG_ARG_LINE", "<SVG>|<PNG>")
+		defer os.Unsetenv("SVG_2_PNG_EXECUTABLE")
+		defer os.Unsetenv("SVG_2_PNG_ARG_LINE")
+
+		Convey("When the config is reloaded, the new values should be returned", func() {
+			cfg, err := Reload()
+			So(err, ShouldBeNil)
+			So(cfg.SVG2PNGExecutable, ShouldEqual, "convert")
+			So(cfg.SVG2PNGArguments, ShouldResemble, []string{"<SVG>", "<PNG>"})
+
+			Convey("And subsequently returned by Get", func() {
+				got, err := Get()
+				So(err, ShouldBeNil)
+				So(got, ShouldEqual, cfg)
 			})
 		})
 	})
@@ -0,0 +1,84 @@
+package geography
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+)
+
+// ToGeoJSON converts the topojson of the geography to a FeatureCollection, with the features of each object in order of object name
+// (rather than the random order in which the topology's map of objects is ranged over). Each feature has a copy of the properties of its
+// geometry - only the id_property and name_property of the geography if idAndNameOnly. Returns a TopologyTooLargeError if the
+// FeatureCollection exceeds the limits on the size of a geography, as the coordinates of shared arcs are repeated in each feature.
+func ToGeoJSON(g *models.Geography, idAndNameOnly bool) (*geojson.FeatureCollection, error) {
+	names := make([]string, 0, len(g.Topojson.Objects))
+	for name := range g.Topojson.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fc := geojson.NewFeatureCollection()
+	for _, name := range names {
+		object := *g.Topojson
+		object.Objects = map[string]*topojson.Geometry{name: g.Topojson.Objects[name]}
+		fc.Features = append(fc.Features, object.ToGeoJSON().Features...)
+	}
+	for _, f := range fc.Features {
+		f.Properties = copyProperties(f.Properties, g, idAndNameOnly)
+	}
+	if err := (&models.Geography{Geojson: fc}).CheckSize(); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+// ToTopoJSON converts the geojson of the geography to a topology, with an object for each feature identified by its id_property
+// (which is set to the id of a feature that does not have it), quantising the coordinates as the quantisation and outputQuantisation
+// of a models.ConvertRequest. The geography is not changed. Returns an error if two features have the same id, as only one would be
+// kept, or a TopologyTooLargeError if the topology exceeds the limits on the size of a geography.
+func ToTopoJSON(g *models.Geography, idAndNameOnly bool, quantisation float64, outputQuantisation float64) (*topojson.Topology, error) {
+	// the features are copied, as quantising changes their coordinates
+	b, err := json.Marshal(g.Geojson)
+	if err != nil {
+		return nil, err
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(b)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	for i, f := range fc.Features {
+		f.Properties = copyProperties(f.Properties, g, idAndNameOnly)
+		if _, ok := f.Properties[g.IDProperty]; !ok && f.ID != nil {
+			f.Properties[g.IDProperty] = fmt.Sprintf("%v", f.ID)
+		}
+		id, err := f.PropertyString(g.IDProperty)
+		if err != nil {
+			continue // the feature is given an id by the conversion
+		}
+		if ids[id] {
+			return nil, fmt.Errorf("geojson features must have different ids to be converted to topojson: features[%d] has the same %s as an earlier feature: %v", i, g.IDProperty, id)
+		}
+		ids[id] = true
+	}
+
+	topology := topojson.NewTopology(fc, &topojson.TopologyOptions{PreQuantize: quantisation, PostQuantize: outputQuantisation, IDProperty: g.IDProperty})
+	if err := (&models.Geography{Topojson: topology}).CheckSize(); err != nil {
+		return nil, err
+	}
+	return topology, nil
+}
+
+// copyProperties returns a copy of the properties of a feature - only the id_property and name_property of the geography if idAndNameOnly
+func copyProperties(properties map[string]interface{}, g *models.Geography, idAndNameOnly bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range properties {
+		if !idAndNameOnly || k == g.IDProperty || (k == g.NameProperty && len(k) > 0) {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package geography
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+	"github.com/paulmach/go.geojson"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	request, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	example := request.Geography
+
+	Convey("The example topology should convert to geojson and back with the same features and ids", t, func() {
+		fc, err := ToGeoJSON(example, false)
+		So(err, ShouldBeNil)
+		So(len(fc.Features), ShouldEqual, 380)
+		ids := featureIDs(fc, example.IDProperty)
+		So(ids[0], ShouldEqual, "E06000001")
+		So(fc.Features[0].Properties["AREANM"], ShouldEqual, "Hartlepool")
+
+		topology, err := ToTopoJSON(&models.Geography{Geojson: fc, IDProperty: "AREACD", NameProperty: "AREANM"}, false, 1e5, 0)
+		So(err, ShouldBeNil)
+		So(len(topology.Objects), ShouldEqual, 380)
+		So(topology.Transform, ShouldNotBeNil)
+
+		again, err := ToGeoJSON(&models.Geography{Topojson: topology, IDProperty: "AREACD"}, false)
+		So(err, ShouldBeNil)
+		So(featureIDs(again, example.IDProperty), ShouldResemble, ids)
+	})
+
+	Convey("Converting should not change the geography", t, func() {
+		fc, err := ToGeoJSON(example, false)
+		So(err, ShouldBeNil)
+		g := &models.Geography{Geojson: fc, IDProperty: "AREACD"}
+		first := fc.Features[0].Geometry.Polygon
+		if first == nil {
+			first = fc.Features[0].Geometry.MultiPolygon[0]
+		}
+		x := first[0][0][0]
+
+		_, err = ToTopoJSON(g, true, 1e4, 0)
+		So(err, ShouldBeNil)
+		So(first[0][0][0], ShouldEqual, x)
+		So(fc.Features[0].Properties["AREANM"], ShouldEqual, "Hartlepool")
+	})
+
+	Convey("Only the id and name properties should be kept if requested", t, func() {
+		fc, err := ToGeoJSON(&models.Geography{Topojson: example.Topojson, IDProperty: "AREACD"}, true)
+		So(err, ShouldBeNil)
+		So(fc.Features[0].Properties, ShouldResemble, map[string]interface{}{"AREACD": "E06000001"})
+	})
+
+	Convey("The converted geography should be subject to the size limits", t, func() {
+		models.UseTopologyLimits(0, 0, 1000)
+		defer models.UseTopologyLimits(100000, 20000, 2000000) // the defaults
+
+		_, err := ToGeoJSON(example, false)
+		So(err, ShouldNotBeNil)
+		So(err, ShouldHaveSameTypeAs, &models.TopologyTooLargeError{})
+	})
+
+	Convey("Features with the same id should not be converted to topojson", t, func() {
+		fc := geojson.NewFeatureCollection()
+		for _, id := range []string{"a", "b", "a"} {
+			f := geojson.NewPointFeature([]float64{1, 2})
+			f.Properties["code"] = id
+			fc.AddFeature(f)
+		}
+
+		_, err := ToTopoJSON(&models.Geography{Geojson: fc, IDProperty: "code"}, false, 0, 0)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "geojson features must have different ids to be converted to topojson: features[2] has the same code as an earlier feature: a")
+	})
+}
+
+// featureIDs returns the (sorted) values of the id property of the features
+func featureIDs(fc *geojson.FeatureCollection, idProperty string) []string {
+	ids := []string{}
+	for _, f := range fc.Features {
+		id, _ := f.PropertyString(idProperty)
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,268 @@
+package geography
+
+import (
+	"encoding/json"
+	"math"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+)
+
+// targetSearchSteps is the number of times the range of tolerances is halved when searching for the tolerance that meets a target number of points
+const targetSearchSteps = 30
+
+// Simplify returns a copy of the topology of the geography with each arc simplified to within the tolerance (using the same simplification
+// as the low detail regions of a rendered map), or to at most targetPoints points if given, and quantised to the given number of distinct values
+// (if not 0 - otherwise the quantisation of the topology is kept). As the arcs shared by neighbouring regions are simplified once,
+// and keep their end points, shared borders remain the same for both regions. The arcs of a ring that would have fewer than 4 points are
+// simplified less, so that small regions do not disappear. The objects (their ids and properties) are unchanged, and the geography is not changed.
+func Simplify(g *models.Geography, tolerance float64, targetPoints int, quantisation float64) (*models.SimplifyResponse, error) {
+	before, err := topologyStatistics(g.Topojson)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(g.Topojson)
+	if err != nil {
+		return nil, err
+	}
+	topology, err := topojson.UnmarshalTopology(b)
+	if err != nil {
+		return nil, err
+	}
+
+	arcs := decodeArcs(topology)
+	for _, o := range topology.Objects {
+		forEachPoint(o, func(p []float64) []float64 { return decodePoint(topology.Transform, p) })
+	}
+	rings := ringArcs(topology)
+	if targetPoints > 0 {
+		tolerance = findTolerance(arcs, rings, targetPoints-(before.Points-countPoints(arcs)))
+	}
+	simplified := simplifyArcs(arcs, rings, tolerance)
+
+	transform := topology.Transform
+	if quantisation > 0 {
+		transform = quantisationTransform(simplified, topology.Objects, quantisation)
+	}
+	topology.Transform = transform
+	topology.Arcs = encodeArcs(transform, simplified)
+	for _, o := range topology.Objects {
+		forEachPoint(o, func(p []float64) []float64 { return encodePoint(transform, p) })
+	}
+
+	after, err := topologyStatistics(topology)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SimplifyResponse{Topojson: topology, Tolerance: tolerance, Before: before, After: after}, nil
+}
+
+// topologyStatistics returns the number of arcs and points in the topology, and the size of its json
+func topologyStatistics(t *topojson.Topology) (*models.TopologyStatistics, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	arcs, _, points := (&models.Geography{Topojson: t}).Size()
+	return &models.TopologyStatistics{Arcs: arcs, Points: points, Bytes: len(b)}, nil
+}
+
+// findTolerance returns the smallest tolerance (to within the precision of the search) at which the simplified arcs have no more than
+// the target number of points - or the tolerance at which every arc is simplified as far as it can be, if there is no such tolerance
+func findTolerance(arcs [][][]float64, rings [][]int, target int) float64 {
+	if countPoints(arcs) <= target {
+		return 0
+	}
+	low, high := 0.0, diagonal(arcs)
+	for i := 0; i < targetSearchSteps; i++ {
+		mid := (low + high) / 2
+		if countPoints(simplifyArcs(arcs, rings, mid)) <= target {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return high
+}
+
+// simplifyArcs returns the arcs simplified to within the tolerance, each keeping at least its 2 end points. The arcs of a ring that would have
+// fewer than 4 points are simplified again with a smaller tolerance (halving it until the ring has 4 points, or is unsimplified),
+// so that small regions do not disappear.
+func simplifyArcs(arcs [][][]float64, rings [][]int, tolerance float64) [][][]float64 {
+	simplified := make([][][]float64, len(arcs))
+	for i := range arcs {
+		simplified[i] = g2s.SimplifyLine(arcs[i], tolerance, 2)
+	}
+	for _, ring := range rings {
+		for t := tolerance / 2; t > 0 && ringPoints(simplified, ring) < 4 && ringPoints(simplified, ring) < ringPoints(arcs, ring); t /= 2 {
+			for _, a := range ring {
+				simplified[a] = g2s.SimplifyLine(arcs[a], t, 2)
+			}
+		}
+	}
+	return simplified
+}
+
+// ringPoints returns the number of points in the ring made of the arcs (whose end points are shared)
+func ringPoints(arcs [][][]float64, ring []int) int {
+	points := 1
+	for _, a := range ring {
+		points += len(arcs[a]) - 1
+	}
+	return points
+}
+
+// ringArcs returns the (non-negative) indexes of the arcs of each polygon ring in the topology
+func ringArcs(t *topojson.Topology) [][]int {
+	var rings [][]int
+	var addRings func(g *topojson.Geometry)
+	addRings = func(g *topojson.Geometry) {
+		polygons := g.MultiPolygon
+		if g.Type == geojson.GeometryPolygon {
+			polygons = [][][]int{g.Polygon}
+		}
+		for _, polygon := range polygons {
+			for _, ring := range polygon {
+				indexes := make([]int, len(ring))
+				for i, a := range ring {
+					if a < 0 {
+						a = ^a
+					}
+					indexes[i] = a
+				}
+				rings = append(rings, indexes)
+			}
+		}
+		for _, child := range g.Geometries {
+			addRings(child)
+		}
+	}
+	for _, o := range t.Objects {
+		addRings(o)
+	}
+	return rings
+}
+
+// decodeArcs returns the arcs of the topology with their positions in absolute (untransformed) coordinates
+func decodeArcs(t *topojson.Topology) [][][]float64 {
+	arcs := make([][][]float64, len(t.Arcs))
+	for i, arc := range t.Arcs {
+		x, y := 0.0, 0.0
+		arcs[i] = make([][]float64, len(arc))
+		for j, p := range arc {
+			if t.Transform == nil {
+				arcs[i][j] = []float64{p[0], p[1]}
+				continue
+			}
+			x, y = x+p[0], y+p[1]
+			arcs[i][j] = decodePoint(t.Transform, []float64{x, y})
+		}
+	}
+	return arcs
+}
+
+// encodeArcs returns the arcs quantised and delta-encoded with the transform (if not nil), omitting positions that are quantised to the previous position
+func encodeArcs(transform *topojson.Transform, arcs [][][]float64) [][][]float64 {
+	if transform == nil {
+		return arcs
+	}
+	encoded := make([][][]float64, len(arcs))
+	for i, arc := range arcs {
+		x, y := 0.0, 0.0
+		encoded[i] = make([][]float64, 0, len(arc))
+		for j, p := range arc {
+			q := encodePoint(transform, p)
+			if j > 0 && q[0] == x && q[1] == y {
+				continue
+			}
+			encoded[i] = append(encoded[i], []float64{q[0] - x, q[1] - y})
+			x, y = q[0], q[1]
+		}
+		if len(encoded[i]) == 1 {
+			encoded[i] = append(encoded[i], []float64{0, 0})
+		}
+	}
+	return encoded
+}
+
+// decodePoint returns the absolute coordinates of the (undelta-encoded) position
+func decodePoint(transform *topojson.Transform, p []float64) []float64 {
+	if transform == nil {
+		return p
+	}
+	return []float64{p[0]*transform.Scale[0] + transform.Translate[0], p[1]*transform.Scale[1] + transform.Translate[1]}
+}
+
+// encodePoint returns the absolute coordinates quantised with the transform
+func encodePoint(transform *topojson.Transform, p []float64) []float64 {
+	if transform == nil {
+		return p
+	}
+	return []float64{math.Floor((p[0]-transform.Translate[0])/transform.Scale[0] + 0.5), math.Floor((p[1]-transform.Translate[1])/transform.Scale[1] + 0.5)}
+}
+
+// quantisationTransform returns the transform that quantises the coordinates of the arcs and point geometries to the given number of distinct values
+func quantisationTransform(arcs [][][]float64, objects map[string]*topojson.Geometry, quantisation float64) *topojson.Transform {
+	x0, y0, x1, y1 := bounds(arcs, objects)
+	if x0 > x1 {
+		return &topojson.Transform{Scale: [2]float64{1, 1}}
+	}
+	scale := func(min, max float64) float64 {
+		if max > min {
+			return (max - min) / (quantisation - 1)
+		}
+		return 1
+	}
+	return &topojson.Transform{Scale: [2]float64{scale(x0, x1), scale(y0, y1)}, Translate: [2]float64{x0, y0}}
+}
+
+// bounds returns the minimum and maximum x and y coordinates of the arcs and point geometries (with x0 > x1 if there are none)
+func bounds(arcs [][][]float64, objects map[string]*topojson.Geometry) (x0, y0, x1, y1 float64) {
+	x0, y0, x1, y1 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	extend := func(p []float64) []float64 {
+		x0, y0, x1, y1 = math.Min(x0, p[0]), math.Min(y0, p[1]), math.Max(x1, p[0]), math.Max(y1, p[1])
+		return p
+	}
+	for _, arc := range arcs {
+		for _, p := range arc {
+			extend(p)
+		}
+	}
+	for _, o := range objects {
+		forEachPoint(o, extend)
+	}
+	return
+}
+
+// forEachPoint replaces the coordinates of each point and multipoint geometry with the result of the function
+func forEachPoint(g *topojson.Geometry, f func([]float64) []float64) {
+	if g.Type == geojson.GeometryPoint {
+		g.Point = f(g.Point)
+	}
+	for i, p := range g.MultiPoint {
+		g.MultiPoint[i] = f(p)
+	}
+	for _, child := range g.Geometries {
+		forEachPoint(child, f)
+	}
+}
+
+// countPoints returns the number of positions in the arcs
+func countPoints(arcs [][][]float64) int {
+	n := 0
+	for _, arc := range arcs {
+		n += len(arc)
+	}
+	return n
+}
+
+// diagonal returns the length of the diagonal of the bounding box of the arcs - a tolerance at which every arc is simplified as far as it can be
+func diagonal(arcs [][][]float64) float64 {
+	x0, y0, x1, y1 := bounds(arcs, nil)
+	if x0 > x1 {
+		return 0
+	}
+	return math.Hypot(x1-x0, y1-y0)
+}
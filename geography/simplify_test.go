@@ -0,0 +1,96 @@
+package geography
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSimplify(t *testing.T) {
+	request, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	example := request.Geography
+	original, _ := json.Marshal(example.Topojson)
+
+	Convey("Simplifying the example topology should substantially reduce its size", t, func() {
+		result, err := Simplify(example, 0.01, 0, 0)
+		So(err, ShouldBeNil)
+		So(result.Tolerance, ShouldEqual, 0.01)
+		So(result.Before.Arcs, ShouldEqual, 1521)
+		So(result.After.Arcs, ShouldEqual, 1521)
+		So(result.After.Points, ShouldBeLessThan, result.Before.Points/2)
+		So(result.After.Bytes, ShouldBeLessThan, result.Before.Bytes*3/4)
+
+		Convey("And keep the ids and properties of its objects", func() {
+			geometries := result.Topojson.Objects["LA2014merc"].Geometries
+			So(len(geometries), ShouldEqual, 380)
+			for i, g := range example.Topojson.Objects["LA2014merc"].Geometries {
+				So(geometries[i].ID, ShouldEqual, g.ID)
+				So(geometries[i].Properties, ShouldResemble, g.Properties)
+			}
+		})
+
+		Convey("And keep shared borders consistent - each object has the same arcs, which keep their end points", func() {
+			geometries := result.Topojson.Objects["LA2014merc"].Geometries
+			for i, g := range example.Topojson.Objects["LA2014merc"].Geometries {
+				So(geometries[i].Polygon, ShouldResemble, g.Polygon)
+				So(geometries[i].MultiPolygon, ShouldResemble, g.MultiPolygon)
+			}
+			before, after := decodeArcs(example.Topojson), decodeArcs(result.Topojson)
+			for i := range before {
+				So(after[i][0], ShouldResemble, before[i][0])
+				So(after[i][len(after[i])-1], ShouldResemble, before[i][len(before[i])-1])
+			}
+			fc, err := ToGeoJSON(&models.Geography{Topojson: result.Topojson, IDProperty: "AREACD"}, false)
+			So(err, ShouldBeNil)
+			So(len(fc.Features), ShouldEqual, 380)
+			for _, f := range fc.Features {
+				polygons := f.Geometry.MultiPolygon
+				if f.Geometry.Polygon != nil {
+					polygons = [][][][]float64{f.Geometry.Polygon}
+				}
+				for _, polygon := range polygons {
+					for _, ring := range polygon {
+						So(len(ring), ShouldBeGreaterThanOrEqualTo, 4)
+						So(ring[len(ring)-1], ShouldResemble, ring[0])
+					}
+				}
+			}
+		})
+
+		Convey("And not change the geography", func() {
+			unchanged, _ := json.Marshal(example.Topojson)
+			So(string(unchanged), ShouldEqual, string(original))
+		})
+	})
+
+	Convey("Simplifying to a target number of points should find the tolerance that keeps as many points as possible", t, func() {
+		result, err := Simplify(example, 0, 5000, 0)
+		So(err, ShouldBeNil)
+		So(result.Tolerance, ShouldBeGreaterThan, 0)
+		So(result.After.Points, ShouldBeLessThanOrEqualTo, 5000)
+		So(result.After.Points, ShouldBeGreaterThan, 4900)
+
+		result, err = Simplify(example, 0, 1000000, 0)
+		So(err, ShouldBeNil)
+		So(result.Tolerance, ShouldEqual, 0)
+		So(result.After.Points, ShouldEqual, result.Before.Points)
+	})
+
+	Convey("Quantising the simplified topology should give it a coarser transform", t, func() {
+		result, err := Simplify(example, 0, 0, 1000)
+		So(err, ShouldBeNil)
+		So(result.Topojson.Transform.Scale[0], ShouldBeGreaterThan, example.Topojson.Transform.Scale[0])
+		So(result.After.Points, ShouldBeLessThan, result.Before.Points)
+		So(result.After.Bytes, ShouldBeLessThan, result.Before.Bytes)
+		for _, arc := range result.Topojson.Arcs {
+			So(len(arc), ShouldBeGreaterThanOrEqualTo, 2)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package geography
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// fileExtension is the extension of the files in which a disk-backed Store saves each geography
+const fileExtension = ".json"
+
+// tempFileExtension is the extension of the temporary files written while saving a geography (see save)
+const tempFileExtension = ".tmp"
+
+// staleTempFileAge is the age beyond which a temporary file is assumed to have been left behind (e.g. by a crash) rather than being written
+const staleTempFileAge = time.Minute
+
+// ErrStoreFull is returned by Put when the store already holds the maximum number of geographies
+var ErrStoreFull = errors.New("The maximum number of geographies has been registered - delete a geography before registering another")
+
+// Store holds geographies registered by id, so that render and analyse requests can refer to them (by geography_id) instead of
+// including the same topology in every request. Geographies are held in memory, and optionally saved to a directory so that
+// they survive a restart. A Store is safe for concurrent use.
+type Store struct {
+	mutex       sync.RWMutex
+	geographies map[string]*models.Geography
+	dir         string // the directory in which geographies are saved - empty if the store is in memory only
+	maxCount    int    // the maximum number of geographies held - 0 if there is no limit
+}
+
+// NewStore creates an empty, in-memory Store
+func NewStore() *Store {
+	return &Store{geographies: make(map[string]*models.Geography)}
+}
+
+// NewDiskStore creates a Store that saves geographies in the given directory (creating it if necessary), loading any geographies already saved there.
+// Stale temporary files left in the directory by a save that did not complete are removed.
+func NewDiskStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	store := NewStore()
+	store.dir = dir
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), tempFileExtension) && time.Since(f.ModTime()) > staleTempFileAge {
+			if err := os.Remove(filepath.Join(dir, f.Name())); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		id := strings.TrimSuffix(f.Name(), fileExtension)
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExtension) || !models.IsValidGeographyID(id) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var g models.Geography
+		if err = json.Unmarshal(b, &g); err != nil {
+			return nil, fmt.Errorf("Unable to load geography from %s: %v", f.Name(), err)
+		}
+		store.geographies[id] = &g
+	}
+	log.Debug("geography store loaded", log.Data{"dir": dir, "geographies": len(store.geographies)})
+	return store, nil
+}
+
+// Get returns the geography registered with the given id, or nil if there is none.
+// The geography is shared between requests, so must not be modified.
+func (s *Store) Get(id string) *models.Geography {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.geographies[id]
+}
+
+// Len returns the number of registered geographies
+func (s *Store) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.geographies)
+}
+
+// SetMaxCount sets the maximum number of geographies held by the store - further geographies are rejected by Put (see ErrStoreFull)
+// until others are deleted. A count of 0 (or less) removes the limit.
+func (s *Store) SetMaxCount(count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxCount = count
+}
+
+// Put registers the geography with the given id, replacing any existing geography with that id.
+// Returns true if the geography replaced an existing one, or ErrStoreFull if it would exceed the maximum count (see SetMaxCount).
+func (s *Store) Put(id string, g *models.Geography) (bool, error) {
+	if !models.IsValidGeographyID(id) {
+		return false, fmt.Errorf("geography_id must only contain letters, digits, hyphens and underscores: geography_id=%v", id)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, exists := s.geographies[id]
+	if !exists && s.maxCount > 0 && len(s.geographies) >= s.maxCount {
+		return false, ErrStoreFull
+	}
+	if len(s.dir) > 0 {
+		if err := s.save(id, g); err != nil {
+			return false, err
+		}
+	}
+	s.geographies[id] = g
+	return exists, nil
+}
+
+// Delete removes the geography registered with the given id, returning false if there was none
+func (s *Store) Delete(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.geographies[id]; !exists {
+		return false, nil
+	}
+	if len(s.dir) > 0 {
+		if err := os.Remove(s.filename(id)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	delete(s.geographies, id)
+	return true, nil
+}
+
+// save writes the geography to a temporary file, then renames it, so that a partially written file is never loaded
+func (s *Store) save(id string, g *models.Geography) error {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(s.dir, id+"-*"+tempFileExtension)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.filename(id))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s *Store) filename(id string) string {
+	return filepath.Join(s.dir, id+fileExtension)
+}
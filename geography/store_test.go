@@ -0,0 +1,111 @@
+package geography
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/rubenv/topojson"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore(t *testing.T) {
+	Convey("A geography that is put in the store can be retrieved and deleted", t, func() {
+		store := NewStore()
+		g := &models.Geography{Topojson: &topojson.Topology{Type: "Topology"}, IDProperty: "code"}
+
+		replaced, err := store.Put("test", g)
+		So(err, ShouldBeNil)
+		So(replaced, ShouldBeFalse)
+		So(store.Get("test"), ShouldEqual, g)
+		So(store.Len(), ShouldEqual, 1)
+
+		replaced, err = store.Put("test", g)
+		So(err, ShouldBeNil)
+		So(replaced, ShouldBeTrue)
+		So(store.Len(), ShouldEqual, 1)
+
+		deleted, err := store.Delete("test")
+		So(err, ShouldBeNil)
+		So(deleted, ShouldBeTrue)
+		So(store.Get("test"), ShouldBeNil)
+		So(store.Len(), ShouldEqual, 0)
+
+		deleted, err = store.Delete("test")
+		So(err, ShouldBeNil)
+		So(deleted, ShouldBeFalse)
+	})
+
+	Convey("A geography is rejected once the store holds the maximum count, unless it replaces one", t, func() {
+		store := NewStore()
+		store.SetMaxCount(1)
+		g := &models.Geography{Topojson: &topojson.Topology{Type: "Topology"}, IDProperty: "code"}
+
+		_, err := store.Put("first", g)
+		So(err, ShouldBeNil)
+		_, err = store.Put("second", g)
+		So(err, ShouldEqual, ErrStoreFull)
+		So(store.Get("second"), ShouldBeNil)
+
+		replaced, err := store.Put("first", g)
+		So(err, ShouldBeNil)
+		So(replaced, ShouldBeTrue)
+
+		_, err = store.Delete("first")
+		So(err, ShouldBeNil)
+		_, err = store.Put("second", g)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("An invalid id is rejected", t, func() {
+		_, err := NewStore().Put("../test", &models.Geography{IDProperty: "code"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A disk-backed store loads the geographies saved by a previous store", t, func() {
+		dir, err := ioutil.TempDir("", "geographies")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		store, err := NewDiskStore(dir)
+		So(err, ShouldBeNil)
+		_, err = store.Put("first", &models.Geography{Topojson: &topojson.Topology{Type: "Topology"}, IDProperty: "code", NameProperty: "name"})
+		So(err, ShouldBeNil)
+		_, err = store.Put("second", &models.Geography{Topojson: &topojson.Topology{Type: "Topology"}, IDProperty: "code"})
+		So(err, ShouldBeNil)
+		_, err = store.Delete("second")
+		So(err, ShouldBeNil)
+
+		reloaded, err := NewDiskStore(dir)
+		So(err, ShouldBeNil)
+		So(reloaded.Get("second"), ShouldBeNil)
+		first := reloaded.Get("first")
+		So(first, ShouldNotBeNil)
+		So(first.IDProperty, ShouldEqual, "code")
+		So(first.NameProperty, ShouldEqual, "name")
+		So(first.Topojson, ShouldNotBeNil)
+	})
+
+	Convey("A disk-backed store removes stale temporary files left by an incomplete save", t, func() {
+		dir, err := ioutil.TempDir("", "geographies")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		stale, recent := filepath.Join(dir, "first-1.tmp"), filepath.Join(dir, "second-2.tmp")
+		So(ioutil.WriteFile(stale, []byte("{"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(recent, []byte("{"), 0644), ShouldBeNil)
+		old := time.Now().Add(-time.Hour)
+		So(os.Chtimes(stale, old, old), ShouldBeNil)
+
+		store, err := NewDiskStore(dir)
+		So(err, ShouldBeNil)
+		So(store.Len(), ShouldEqual, 0)
+		_, err = os.Stat(stale)
+		So(os.IsNotExist(err), ShouldBeTrue)
+		_, err = os.Stat(recent)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,71 @@
+package geojson2svg_test
+
+import (
+	"io/ioutil"
+	"math"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/paulmach/go.geojson"
+)
+
+// FuzzDraw draws arbitrary geojson geometries, which should never panic or produce NaN coordinates, e.g.
+//
+//	go test ./geojson2svg -run XXX -fuzz FuzzDraw -fuzztime 1m
+func FuzzDraw(f *testing.F) {
+	for _, seed := range []string{
+		`{"type": "Point", "coordinates": [1, 2]}`,
+		`{"type": "Point", "coordinates": []}`,
+		`{"type": "MultiPoint", "coordinates": [[1, 2], [3]]}`,
+		`{"type": "LineString", "coordinates": [[0, 0], [0, 400], [400, 400]]}`,
+		`{"type": "MultiLineString", "coordinates": [[[0, 0], [1, 1]], []]}`,
+		`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]], [[0.5, 0.5]]]}`,
+		`{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[]]]}`,
+		`{"type": "GeometryCollection", "geometries": [{"type": "Point", "coordinates": [1, 2]}, null]}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	example, err := ioutil.ReadFile(path.Join("testdata", "example.json"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(example)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, feature := range fc.Features {
+		b, err := feature.Geometry.MarshalJSON()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		g, err := geojson.UnmarshalGeometry(data)
+		if err != nil {
+			return
+		}
+		for _, projection := range []geojson2svg.ScaleFunc{nil, geojson2svg.MercatorProjection} {
+			svg := geojson2svg.New()
+			svg.AppendGeometry(g)
+			var result string
+			if projection == nil {
+				result = svg.Draw(200, 200)
+			} else {
+				height := svg.GetHeightForWidth(200, projection)
+				if math.IsNaN(height) || math.IsInf(height, 0) {
+					t.Errorf("GetHeightForWidth returned %v for %s", height, data)
+				}
+				result = svg.DrawWithProjection(200, height, projection)
+			}
+			if strings.Contains(result, "NaN") || strings.Contains(result, "Inf") {
+				t.Errorf("the svg of %s contains an invalid number: %s", data, result)
+			}
+		}
+		geojson2svg.Area(geojson2svg.MercatorProjection, g)
+		geojson2svg.BoundingBox(&geojson.FeatureCollection{Features: []*geojson.Feature{geojson.NewFeature(g)}})
+	})
+}
@@ -10,8 +10,10 @@ import (
 	"io"
 	"math"
 	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
 	"github.com/ONSdigital/go-ns/log"
 	"github.com/paulmach/go.geojson"
 )
@@ -26,6 +28,16 @@ const (
 	FeatureCollection ElementType = iota
 )
 
+// NorthArrowSymbol is the fmt template of the north arrow symbol (see WithNorthArrow) - an arrow pointing up above the letter N
+const NorthArrowSymbol = `<symbol id="%s" viewBox="0 0 20 30"><path d="M10 0L17 16L10 12L3 16Z" style="fill: black; stroke: white; stroke-width: 0.5;"></path>` +
+	`<text x="10" y="29" style="text-anchor: middle; font-size: 12px; font-weight: bold; fill: black;">N</text></symbol>`
+
+// The size of the north arrow in the svg
+const (
+	NorthArrowWidth  = 20.0
+	NorthArrowHeight = 30.0
+)
+
 // ScaleFunc accepts x,y coordinates and transforms them, returning a new pair of x,y coordinates.
 type ScaleFunc func(float64, float64) (float64, float64)
 
@@ -45,9 +57,21 @@ type SVG struct {
 	titleProp      string
 	patterns       []string
 	pngConverter   PNGConverter
+	fallbackAlt    string
+	documentTitle  string
+	documentDesc   string
 	bounds         *boundingRectangle
 	points         [][]float64
 	responsiveSize bool
+	boundsPoints   [][]float64
+	overlays       []Overlay
+	underlays      []Overlay
+	screenOverlays []Overlay // drawn outside any fallback png - see WithScreenOverlay
+	northArrow     *northArrow
+	marker         *markerOptions // the marker of points, if any - see WithMarker
+	lowDetail      float64        // the tolerance of simplified copies of the elements, if greater than zero - see WithLowDetail
+	minify         bool
+	precision      int
 }
 
 // SVGElement represents a single element of an SVG - a Geometry, Feature or FeatureCollection
@@ -64,13 +88,24 @@ type Padding struct{ Top, Right, Bottom, Left float64 }
 // An Option represents a single SVG option.
 type Option func(*SVG)
 
+// An Overlay draws additional content (e.g. markers or labels) on top of the geojson elements, using the scale function to position it.
+// An Overlay may also be drawn beneath the geojson elements - see WithUnderlay.
+type Overlay func(sf ScaleFunc) string
+
 // PNGConverter converts an svg file to png. Call either Convert or IncludeFallbackImage - there's no need to call both.
 type PNGConverter interface {
 	// Convert converts the given svg file to a base64-encoded png
 	Convert(svg []byte) ([]byte, error)
-	// IncludeFallbackImage generates an svg with the given attributes, content and a fallback image:
-	// <svg svgAttributes><switch><g>svgContent</g><foreignObject><image src="data:image/png;base64,..." /></foreignObject></svg>
-	IncludeFallbackImage(svgAttributes string, svgContent string, width float64, height float64) string
+	// IncludeFallbackImage generates an svg with the given attributes, content and a fallback image with the given alt text
+	// (or DefaultFallbackAlt if empty):
+	// <svg svgAttributes><switch><g>svgContent</g><foreignObject><img alt="alt" src="data:image/png;base64,..." /></foreignObject></svg>
+	IncludeFallbackImage(svgAttributes string, svgContent string, width float64, height float64, alt string) string
+}
+
+// northArrow is the id of the north arrow symbol, and the position of its top left corner in the svg (see WithNorthArrow)
+type northArrow struct {
+	id   string
+	x, y float64
 }
 
 // boundingRectangle is used to cache the result of calculations in getBoundingRectangle
@@ -89,14 +124,28 @@ func New() *SVG {
 }
 
 // Draw renders the final SVG with the given options to a string.
-// All coordinates will be scaled to fit into the svg.
+// All coordinates will be scaled to fit into the svg. As they are not projected, they are not assumed to be geographic, so there is no north arrow.
 func (svg *SVG) Draw(width, height float64, opts ...Option) string {
-	return svg.DrawWithProjection(width, height, func(x, y float64) (float64, float64) { return x, y }, opts...)
+	return svg.draw(width, height, func(x, y float64) (float64, float64) { return x, y }, false, opts...)
 }
 
 // DrawWithProjection renders the final SVG with the given options to a string.
 // All coordinates will be converted by the given projection, then scaled to fit into the svg.
+// Patterns, overlays, underlays, the north arrow and the document title given as options are only drawn by this call, so that the SVG may be drawn again with the same options.
 func (svg *SVG) DrawWithProjection(width, height float64, projection ScaleFunc, opts ...Option) string {
+	return svg.draw(width, height, projection, true, opts...)
+}
+
+// draw renders the SVG with the given projection and options - with a north arrow (if configured) only if the coordinates are geographic
+func (svg *SVG) draw(width, height float64, projection ScaleFunc, geographic bool, opts ...Option) string {
+	initialPatterns, initialOverlays, initialUnderlays, initialNorthArrow := svg.patterns, svg.overlays, svg.underlays, svg.northArrow
+	initialTitle, initialDesc, initialScreenOverlays, initialMarker := svg.documentTitle, svg.documentDesc, svg.screenOverlays, svg.marker
+	initialLowDetail := svg.lowDetail
+	defer func() {
+		svg.patterns, svg.overlays, svg.underlays, svg.northArrow = initialPatterns, initialOverlays, initialUnderlays, initialNorthArrow
+		svg.documentTitle, svg.documentDesc, svg.screenOverlays, svg.marker = initialTitle, initialDesc, initialScreenOverlays, initialMarker
+		svg.lowDetail = initialLowDetail
+	}()
 
 	for _, o := range opts {
 		o(svg)
@@ -105,29 +154,81 @@ func (svg *SVG) DrawWithProjection(width, height float64, projection ScaleFunc,
 	sf := svg.makeScaleFunc(width, height, projection)
 
 	content := bytes.NewBufferString("")
-	for _, e := range svg.elements {
-		switch e.elementType {
-		case Geometry:
-			process(sf, content, e.geometry, "", "")
-		case Feature:
-			as, title := getFeatureAttributesAndTitle(svg.useProp, svg.titleProp, e.feature)
-			process(sf, content, e.feature.Geometry, as, title)
-		case FeatureCollection:
-			for _, f := range e.featureCollection.Features {
-				as, title := getFeatureAttributesAndTitle(svg.useProp, svg.titleProp, f)
-				process(sf, content, f.Geometry, as, title)
-			}
+	for _, underlay := range svg.underlays {
+		content.WriteString(underlay(sf))
+	}
+	usedMarkers := make(map[string]string)
+	elements := svg.drawElements(sf, 0, usedMarkers)
+	if svg.lowDetail > 0 {
+		if lowDetail := svg.drawElements(sf, svg.lowDetail, usedMarkers); len(lowDetail) <= int(MaxLowDetailRatio*float64(len(elements))) {
+			elements = fmt.Sprintf(`<g class="%s">%s</g><g class="%s" display="none">%s</g>`, FullDetailClassName, elements, LowDetailClassName, lowDetail)
 		}
 	}
+	content.WriteString(elements)
+	svg.patterns = append(svg.patterns, markerSymbolDefs(usedMarkers)...)
+	for _, overlay := range svg.overlays {
+		content.WriteString(overlay(sf))
+	}
+	if svg.northArrow != nil && geographic {
+		svg.patterns = append(svg.patterns, fmt.Sprintf(NorthArrowSymbol, svg.northArrow.id))
+		fmt.Fprintf(content, `<use href="#%s" x="%f" y="%f" width="%.f" height="%.f"></use>`, svg.northArrow.id, svg.northArrow.x, svg.northArrow.y, NorthArrowWidth, NorthArrowHeight)
+	}
 
 	attributes := makeSVGAttributes(width, height, svg)
 
 	patterns := svg.getPatterns()
 
+	var result string
 	if svg.pngConverter == nil {
-		return fmt.Sprintf(`<svg%s>%s%s</svg>`, attributes, patterns, content)
+		result = fmt.Sprintf(`<svg%s>%s%s</svg>`, attributes, patterns, content)
+	} else {
+		result = svg.pngConverter.IncludeFallbackImage(attributes, patterns+content.String(), width, height, svg.fallbackAlt)
+	}
+	if len(svg.screenOverlays) > 0 {
+		screen := bytes.NewBufferString("")
+		for _, overlay := range svg.screenOverlays {
+			screen.WriteString(overlay(sf))
+		}
+		end := strings.LastIndex(result, "</svg>")
+		result = result[:end] + screen.String() + result[end:]
+	}
+	result = AddDocumentTitle(result, svg.documentTitle, svg.documentDesc)
+	if svg.minify {
+		return Minify(result, svg.precision)
+	}
+	return result
+}
+
+// drawElements draws the elements of the svg, returning the result. If the tolerance is greater than zero, the elements are simplified to within the tolerance
+// and their ids have the LowDetailIDSuffix (see WithLowDetail). The symbols of any markers drawn are added to usedMarkers.
+func (svg *SVG) drawElements(sf ScaleFunc, tolerance float64, usedMarkers map[string]string) string {
+	content := bytes.NewBufferString("")
+	idSuffix := ""
+	if tolerance > 0 {
+		idSuffix = LowDetailIDSuffix
+	}
+	drawGeometry := func(g *geojson.Geometry, attributes string, title string, marker *pointMarker) {
+		if tolerance > 0 {
+			process(identityScaleFunc, content, simplifyGeometry(sf, g, tolerance), attributes, title, marker)
+		} else {
+			process(sf, content, g, attributes, title, marker)
+		}
+	}
+	for _, e := range svg.elements {
+		switch e.elementType {
+		case Geometry:
+			drawGeometry(e.geometry, "", "", svg.marker.newPointMarker(nil, usedMarkers))
+		case Feature:
+			as, title := getFeatureAttributesAndTitle(svg.useProp, svg.titleProp, e.feature, idSuffix)
+			drawGeometry(e.feature.Geometry, as, title, svg.marker.newPointMarker(e.feature, usedMarkers))
+		case FeatureCollection:
+			for _, f := range e.featureCollection.Features {
+				as, title := getFeatureAttributesAndTitle(svg.useProp, svg.titleProp, f, idSuffix)
+				drawGeometry(f.Geometry, as, title, svg.marker.newPointMarker(f, usedMarkers))
+			}
+		}
 	}
-	return svg.pngConverter.IncludeFallbackImage(attributes, patterns+content.String(), width, height)
+	return content.String()
 }
 
 // makeSVGAttributes converts the avg attributes to a string and adds either width and height or style="width:100%" attributes.
@@ -163,6 +264,13 @@ func (svg *SVG) AppendFeatureCollection(fc *geojson.FeatureCollection) {
 	svg.clearCache()
 }
 
+// ExtendBounds includes the given coordinates (which are not drawn) when calculating the size and position of the svg content,
+// e.g. so that the position of an overlay is within the svg.
+func (svg *SVG) ExtendBounds(points [][]float64) {
+	svg.boundsPoints = append(svg.boundsPoints, points...)
+	svg.clearCache()
+}
+
 // clearCache deletes all internal cached values
 func (svg *SVG) clearCache() {
 	svg.bounds = nil
@@ -208,6 +316,14 @@ func WithPattern(pattern string) Option {
 	}
 }
 
+// WithNorthArrow configures the SVG to draw a north arrow (NorthArrowWidth by NorthArrowHeight) on top of everything else, with its top left corner at x, y.
+// The arrow is a <symbol> with the given id in the defs of the svg, drawn by a <use> element. It is not drawn by Draw (see DrawWithProjection).
+func WithNorthArrow(symbolID string, x, y float64) Option {
+	return func(svg *SVG) {
+		svg.northArrow = &northArrow{id: symbolID, x: x, y: y}
+	}
+}
+
 // WithPNGFallback configures the SVG to include a png image as a foreignObject fallback for browsers that don't support svg
 func WithPNGFallback(converter PNGConverter) Option {
 	return func(svg *SVG) {
@@ -215,6 +331,42 @@ func WithPNGFallback(converter PNGConverter) Option {
 	}
 }
 
+// WithFallbackAlt sets the alt text of the fallback png image (see WithPNGFallback) - DefaultFallbackAlt if empty
+func WithFallbackAlt(alt string) Option {
+	return func(svg *SVG) {
+		svg.fallbackAlt = alt
+	}
+}
+
+// WithDocumentTitle adds <title> and <desc> elements with the given (unescaped) text as the first children of the svg element,
+// so that the svg describes itself when opened on its own. Either is omitted if empty.
+func WithDocumentTitle(title, desc string) Option {
+	return func(svg *SVG) {
+		svg.documentTitle, svg.documentDesc = title, desc
+	}
+}
+
+// AddDocumentTitle inserts <title> and <desc> elements with the given (unescaped) text as the first children of the svg element of the document,
+// as for WithDocumentTitle - for an svg that is not drawn by an SVG. Either is omitted if empty.
+func AddDocumentTitle(document string, title string, desc string) string {
+	children := ""
+	if len(title) > 0 {
+		children += "<title>" + htmlutil.EscapeText(title) + "</title>"
+	}
+	if len(desc) > 0 {
+		children += "<desc>" + htmlutil.EscapeText(desc) + "</desc>"
+	}
+	start := strings.Index(document, "<svg")
+	if len(children) == 0 || start < 0 {
+		return document
+	}
+	end := strings.Index(document[start:], ">")
+	if end < 0 {
+		return document
+	}
+	return document[:start+end+1] + children + document[start+end+1:]
+}
+
 // WithResponsiveSize configures the SVG to include a style="width:100%" attribute instead of fixed width and height attributes.
 func WithResponsiveSize(isResponsive bool) Option {
 	return func(svg *SVG) {
@@ -222,6 +374,57 @@ func WithResponsiveSize(isResponsive bool) Option {
 	}
 }
 
+// WithMinification configures the SVG to be minified (see Minify), with numbers rounded to the given number of decimal places.
+// The fallback png (if any) is converted from the svg before it is minified.
+func WithMinification(minify bool, precision int) Option {
+	return func(svg *SVG) {
+		svg.minify = minify
+		svg.precision = precision
+	}
+}
+
+// WithOverlay configures the SVG to draw the overlay after (i.e. on top of) all geojson elements.
+// Overlays are not included in the calculation of the bounds of the svg - see ExtendBounds.
+func WithOverlay(overlay Overlay) Option {
+	return func(svg *SVG) {
+		svg.overlays = append(svg.overlays, overlay)
+	}
+}
+
+// WithScreenOverlay configures the SVG to draw the overlay on top of everything else, but outside the content of any fallback png (see WithPNGFallback),
+// so that it is neither converted to png nor drawn in place of the fallback - for content that is only of use on screen (e.g. tooltips).
+// Like other overlays, it is not included in the calculation of the bounds of the svg.
+func WithScreenOverlay(overlay Overlay) Option {
+	return func(svg *SVG) {
+		svg.screenOverlays = append(svg.screenOverlays, overlay)
+	}
+}
+
+// FeatureOverlay returns an overlay that draws the features of the collection (e.g. the boundaries of larger areas) with the given attributes,
+// using the same scale as the rest of the svg. Neither the properties of the features nor their titles are drawn.
+func FeatureOverlay(fc *geojson.FeatureCollection, attributes map[string]string) Overlay {
+	as := makeAttributes(attributes)
+	return func(sf ScaleFunc) string {
+		content := bytes.NewBufferString("")
+		for _, f := range fc.Features {
+			process(sf, content, f.Geometry, as, "", nil)
+		}
+		return content.String()
+	}
+}
+
+// WithUnderlay configures the SVG to draw the overlay before (i.e. beneath) all geojson elements.
+// Like overlays, underlays are not included in the calculation of the bounds of the svg.
+func WithUnderlay(underlay Overlay) Option {
+	return func(svg *SVG) {
+		svg.underlays = append(svg.underlays, underlay)
+	}
+}
+
+// StrokeProperties are the names of the geojson properties that set the stroke of an SVG element as presentation attributes
+// (e.g. for features that are lines), to be included in UseProperties - e.g. UseProperties(append([]string{"class"}, StrokeProperties...)).
+var StrokeProperties = []string{"stroke", "stroke-width", "stroke-dasharray", "stroke-dashoffset", "stroke-linecap", "stroke-linejoin", "stroke-opacity"}
+
 // UseProperties configures which geojson properties should be copied to the
 // resulting SVG element.
 func UseProperties(props []string) Option {
@@ -237,7 +440,7 @@ func UseProperties(props []string) Option {
 	}
 }
 
-// getPoints returns an array of all coordinates (points) in the svg. Note that these points have not had any projection applied.
+// getPoints returns an array of all coordinates (points) in the svg, including those added with ExtendBounds. Note that these points have not had any projection applied.
 func (svg *SVG) getPoints() [][]float64 {
 	if len(svg.points) == 0 {
 		points := [][]float64{}
@@ -253,20 +456,20 @@ func (svg *SVG) getPoints() [][]float64 {
 				}
 			}
 		}
-		svg.points = points
+		svg.points = append(points, svg.boundsPoints...)
 	}
 	return svg.points
 }
 
-// process draws the given geometry to the svg canvas (the writer)
-func process(sf ScaleFunc, w io.Writer, g *geojson.Geometry, attributes string, title string) {
+// process draws the given geometry to the svg canvas (the writer), drawing any points with the marker (or as 1px circles if nil)
+func process(sf ScaleFunc, w io.Writer, g *geojson.Geometry, attributes string, title string, marker *pointMarker) {
 	switch {
 	case g == nil:
 		log.Debug("process invoked with nil Geometry", nil)
 	case g.IsPoint():
-		drawPoint(sf, w, g.Point, attributes, title)
+		drawPoint(sf, w, g.Point, attributes, title, marker)
 	case g.IsMultiPoint():
-		drawMultiPoint(sf, w, g.MultiPoint, attributes, title)
+		drawMultiPoint(sf, w, g.MultiPoint, attributes, title, marker)
 	case g.IsLineString():
 		drawLineString(sf, w, g.LineString, attributes, title)
 	case g.IsMultiLineString():
@@ -278,35 +481,35 @@ func process(sf ScaleFunc, w io.Writer, g *geojson.Geometry, attributes string,
 	case g.IsCollection():
 		drawGroupStart(w, attributes, title)
 		for _, x := range g.Geometries {
-			process(sf, w, x, "", "")
+			process(sf, w, x, "", "", marker)
 		}
 		drawGroupEnd(w)
 	}
 }
 
-// collect appends all points in the given geometry to the given slice, returning the new slice
+// collect appends all (valid) points in the given geometry to the given slice, returning the new slice
 func collect(g *geojson.Geometry) (points [][]float64) {
 	switch {
 	case g == nil:
 		log.Debug("collect invoked with nil Geometry", nil)
 	case g.IsPoint():
-		points = append(points, g.Point)
+		points = appendValidPoints(points, g.Point)
 	case g.IsMultiPoint():
-		points = append(points, g.MultiPoint...)
+		points = appendValidPoints(points, g.MultiPoint...)
 	case g.IsLineString():
-		points = append(points, g.LineString...)
+		points = appendValidPoints(points, g.LineString...)
 	case g.IsMultiLineString():
 		for _, x := range g.MultiLineString {
-			points = append(points, x...)
+			points = appendValidPoints(points, x...)
 		}
 	case g.IsPolygon():
 		for _, x := range g.Polygon {
-			points = append(points, x...)
+			points = appendValidPoints(points, x...)
 		}
 	case g.IsMultiPolygon():
 		for _, xs := range g.MultiPolygon {
 			for _, x := range xs {
-				points = append(points, x...)
+				points = appendValidPoints(points, x...)
 			}
 		}
 	case g.IsCollection():
@@ -317,31 +520,75 @@ func collect(g *geojson.Geometry) (points [][]float64) {
 	return points
 }
 
+// validPoint returns true if the point has x and y coordinates that are finite numbers. Other points (e.g. with NaN or missing
+// coordinates, which may be found in malformed geojson) are ignored.
+func validPoint(p []float64) bool {
+	return len(p) >= 2 && isFinite(p[0]) && isFinite(p[1])
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// appendValidPoints appends the valid points to the slice, returning the new slice
+func appendValidPoints(points [][]float64, ps ...[]float64) [][]float64 {
+	for _, p := range ps {
+		if validPoint(p) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// scalePoints returns the valid points, scaled by the scale function, omitting any that the scale function makes infinite (or NaN)
+func scalePoints(sf ScaleFunc, points ...[]float64) [][2]float64 {
+	scaled := make([][2]float64, 0, len(points))
+	for _, p := range points {
+		if !validPoint(p) {
+			continue
+		}
+		if x, y := sf(p[0], p[1]); isFinite(x) && isFinite(y) {
+			scaled = append(scaled, [2]float64{x, y})
+		}
+	}
+	return scaled
+}
+
 // the draw methods use writer.Write where possible as it is faster than fmt.Fprintf, even if it requires string concatenation
 // fmt.Fprintf is only used where values do actually require formatting, e.g. floats.
 
-// drawPoint draws an individual point
-func drawPoint(sf ScaleFunc, w io.Writer, p []float64, attributes string, title string) {
-	x, y := sf(p[0], p[1])
+// drawPoint draws an individual point as the marker (or a 1px circle if there is none) - or nothing if the point is invalid
+func drawPoint(sf ScaleFunc, w io.Writer, p []float64, attributes string, title string, marker *pointMarker) {
+	scaled := scalePoints(sf, p)
+	if len(scaled) == 0 {
+		return
+	}
+	if marker != nil {
+		marker.draw(w, scaled[0][0], scaled[0][1], attributes, title)
+		return
+	}
 	endTag := endTag("circle", title)
-	fmt.Fprintf(w, `<circle cx="%f" cy="%f" r="1"%s%s`, x, y, attributes, endTag)
+	fmt.Fprintf(w, `<circle cx="%f" cy="%f" r="1"%s%s`, scaled[0][0], scaled[0][1], attributes, endTag)
 }
 
 // drawMultiPoint draws multiple points grouped in a <g> tag
-func drawMultiPoint(sf ScaleFunc, w io.Writer, points [][]float64, attributes string, title string) {
+func drawMultiPoint(sf ScaleFunc, w io.Writer, points [][]float64, attributes string, title string, marker *pointMarker) {
 	drawGroupStart(w, attributes, title)
 	for _, p := range points {
-		drawPoint(sf, w, p, "", "")
+		drawPoint(sf, w, p, "", "", marker)
 	}
 	drawGroupEnd(w)
 }
 
-// drawLineString draws a single line (path) defined by the array of points
+// drawLineString draws a single line (path) defined by the array of points - or nothing if it has fewer than 2 valid points
 func drawLineString(sf ScaleFunc, w io.Writer, points [][]float64, attributes string, title string) {
+	scaled := scalePoints(sf, points...)
+	if len(scaled) < 2 {
+		return
+	}
 	path := bytes.NewBufferString("M")
-	for _, p := range points {
-		x, y := sf(p[0], p[1])
-		fmt.Fprintf(path, "%f %f,", x, y)
+	for _, p := range scaled {
+		fmt.Fprintf(path, "%f %f,", p[0], p[1])
 	}
 	endTag := endTag("path", title)
 	w.Write([]byte(`<path d="` + strings.TrimSuffix(path.String(), ",") + `"` + attributes + endTag))
@@ -357,16 +604,23 @@ func drawMultiLineString(sf ScaleFunc, w io.Writer, paths [][][]float64, attribu
 }
 
 // drawPolygon draws a single polygon, which may be defined by multiple paths. Each path is an array of points.
+// Paths with fewer than 2 valid points are omitted, as is the polygon if no paths remain.
 func drawPolygon(sf ScaleFunc, w io.Writer, paths [][][]float64, attributes string, title string) {
 	pathBuffer := bytes.NewBufferString("")
 	for _, subPath := range paths {
+		scaled := scalePoints(sf, subPath...)
+		if len(scaled) < 2 {
+			continue
+		}
 		subPathBuffer := bytes.NewBufferString(" M")
-		for _, point := range subPath {
-			x, y := sf(point[0], point[1])
-			fmt.Fprintf(subPathBuffer, "%f %f,", x, y)
+		for _, point := range scaled {
+			fmt.Fprintf(subPathBuffer, "%f %f,", point[0], point[1])
 		}
 		pathBuffer.Write(bytes.TrimRight(subPathBuffer.Bytes(), ","))
 	}
+	if pathBuffer.Len() == 0 {
+		return
+	}
 	w.Write([]byte(`<path d="` + strings.TrimPrefix(pathBuffer.String(), " ") + ` Z"` + attributes + endTag("path", title)))
 }
 
@@ -400,26 +654,41 @@ func endTag(tag string, title string) string {
 	return "/>"
 }
 
-// getFeatureAttributesAndTitle converts the properties of the feature into a string of attributes, and extracts the title property into a string
-func getFeatureAttributesAndTitle(useProp func(string) bool, titleProp string, feature *geojson.Feature) (string, string) {
+// getFeatureAttributesAndTitle converts the properties of the feature into a string of attributes, and extracts the title property into a string.
+// The idSuffix, if any, is appended to the id of the feature.
+func getFeatureAttributesAndTitle(useProp func(string) bool, titleProp string, feature *geojson.Feature, idSuffix string) (string, string) {
 	attrs := make(map[string]string)
-	id, isString := feature.ID.(string)
-	if isString && len(id) > 0 {
-		attrs["id"] = id
+	switch id := feature.ID.(type) {
+	case string:
+		if len(id) > 0 {
+			attrs["id"] = id + idSuffix
+		}
+	case float64:
+		attrs["id"] = strconv.FormatFloat(id, 'f', -1, 64) + idSuffix // e.g. 101, not 1.01e+02
+	case int:
+		attrs["id"] = strconv.Itoa(id) + idSuffix
 	}
 	for k, v := range feature.Properties {
 		if useProp(k) {
-			attrs[k] = fmt.Sprintf("%v", v)
+			attrs[k] = formatProperty(v)
 		}
 	}
 	titleString := ""
 	if title, ok := feature.Properties[titleProp]; ok {
-		titleString = fmt.Sprintf("%v", title)
+		titleString = formatProperty(title)
+	}
+	return makeAttributes(attrs), htmlutil.EscapeText(titleString)
+}
+
+// formatProperty formats the value of a property as an attribute or title - numbers in full (e.g. 0.00001 or 1000000, not 1e-05 or 1e+06)
+func formatProperty(value interface{}) string {
+	if f, isFloat := value.(float64); isFloat {
+		return strconv.FormatFloat(f, 'f', -1, 64)
 	}
-	return makeAttributes(attrs), titleString
+	return fmt.Sprintf("%v", value)
 }
 
-// makeAttributes converts the given map into a string with each key="value" pair in sorted order
+// makeAttributes converts the given map into a string with each key="value" pair in sorted order, escaping the values
 func makeAttributes(as map[string]string) string {
 	keys := make([]string, 0, len(as))
 	for k := range as {
@@ -428,7 +697,7 @@ func makeAttributes(as map[string]string) string {
 	sort.Strings(keys)
 	res := bytes.NewBufferString("")
 	for _, k := range keys {
-		fmt.Fprintf(res, ` %s="%s"`, k, as[k])
+		fmt.Fprintf(res, ` %s="%s"`, k, htmlutil.EscapeAttr(as[k]))
 	}
 	return res.String()
 }
@@ -453,6 +722,9 @@ func (svg *SVG) makeScaleFunc(width, height float64, projection ScaleFunc) Scale
 	xRes := (maxX - minX) / w
 	yRes := (maxY - minY) / h
 	res := math.Max(xRes, yRes)
+	if res == 0 || !isFinite(res) { // all points are in the same place
+		return func(x, y float64) (float64, float64) { return w / 2, h / 2 }
+	}
 
 	return func(x, y float64) (float64, float64) {
 		x, y = projection(x, y)
@@ -470,27 +742,88 @@ func (svg *SVG) getBoundingRectangle(projection ScaleFunc) (float64, float64, fl
 }
 
 // calcBoundingRectangle calculates the minX, minY, maxX, maxY coordinates of the svg, after applying the projection.
+// Points that are invalid, or that the projection makes infinite, are ignored.
 func calcBoundingRectangle(projection ScaleFunc, points [][]float64) *boundingRectangle {
-	if len(points) == 0 || len(points[0]) == 0 {
+	scaled := scalePoints(projection, points...)
+	if len(scaled) == 0 {
 		return &boundingRectangle{}
 	}
-	minX, minY := projection(points[0][0], points[0][1])
-	maxX, maxY := projection(points[0][0], points[0][1])
-	for _, p := range points[1:] {
-		x, y := projection(p[0], p[1])
-		minX = math.Min(minX, x)
-		maxX = math.Max(maxX, x)
-		minY = math.Min(minY, y)
-		maxY = math.Max(maxY, y)
+	minX, minY := scaled[0][0], scaled[0][1]
+	maxX, maxY := minX, minY
+	for _, p := range scaled[1:] {
+		minX = math.Min(minX, p[0])
+		maxX = math.Max(maxX, p[0])
+		minY = math.Min(minY, p[1])
+		maxY = math.Max(maxY, p[1])
 	}
 	return &boundingRectangle{minX, minY, maxX, maxY}
 }
 
+// BoundingBox returns the minX, minY, maxX, maxY coordinates of the features in the collection, without applying any projection.
+// Returns nil if there are no coordinates.
+func BoundingBox(fc *geojson.FeatureCollection) []float64 {
+	points := [][]float64{}
+	for _, f := range fc.Features {
+		points = append(points, collect(f.Geometry)...)
+	}
+	if len(points) == 0 || len(points[0]) == 0 {
+		return nil
+	}
+	b := calcBoundingRectangle(func(x, y float64) (float64, float64) { return x, y }, points)
+	return []float64{b.minX, b.minY, b.maxX, b.maxY}
+}
+
+// Area returns the area of the polygons in the geometry after applying the projection, subtracting the area of any holes.
+// Other types of geometry have no area.
+func Area(sf ScaleFunc, g *geojson.Geometry) float64 {
+	switch {
+	case g == nil:
+		return 0
+	case g.IsPolygon():
+		return areaOfPolygonWithHoles(sf, g.Polygon)
+	case g.IsMultiPolygon():
+		area := 0.0
+		for _, p := range g.MultiPolygon {
+			area += areaOfPolygonWithHoles(sf, p)
+		}
+		return area
+	case g.IsCollection():
+		area := 0.0
+		for _, c := range g.Geometries {
+			area += Area(sf, c)
+		}
+		return area
+	}
+	return 0
+}
+
+// areaOfPolygonWithHoles returns the area of the first path in the polygon, less the area of the remaining paths (the holes)
+func areaOfPolygonWithHoles(sf ScaleFunc, paths [][][]float64) float64 {
+	area := 0.0
+	for i, path := range paths {
+		if i == 0 {
+			area += math.Abs(areaOfPolygon(sf, path))
+		} else {
+			area -= math.Abs(areaOfPolygon(sf, path))
+		}
+	}
+	return area
+}
+
+// GetScaleFunc returns the function used by DrawWithProjection (with the same width, height and projection) to convert coordinates
+// to positions within the svg, e.g. to locate a feature before drawing.
+func (svg *SVG) GetScaleFunc(width, height float64, projection ScaleFunc) ScaleFunc {
+	return svg.makeScaleFunc(width, height, projection)
+}
+
 // GetHeightForWidth returns an appropriate height given a desired width.
 func (svg *SVG) GetHeightForWidth(width float64, projection ScaleFunc) float64 {
 	minX, minY, maxX, maxY := svg.getBoundingRectangle(projection)
 	svgWidth := maxX - minX
 	svgHeight := maxY - minY
+	if svgWidth == 0 { // e.g. a single point or a vertical line
+		return width
+	}
 	ratio := svgHeight / svgWidth
 	return math.Floor((width * ratio) + .5)
 
@@ -517,9 +850,10 @@ var MercatorProjection = func(longitude, latitude float64) (float64, float64) {
 func areaOfPolygon(sf ScaleFunc, path [][]float64) float64 {
 	s := 0.0
 
-	for i := 0; i < len(path)-1; i++ {
-		i0, i1 := sf(path[i][0], path[i][1])
-		j0, j1 := sf(path[i+1][0], path[i+1][1])
+	scaled := scalePoints(sf, path...)
+	for i := 0; i < len(scaled)-1; i++ {
+		i0, i1 := scaled[i][0], scaled[i][1]
+		j0, j1 := scaled[i+1][0], scaled[i+1][1]
 		s += float64(i0*j1 - j0*i1)
 	}
 
@@ -560,9 +894,10 @@ func Centroid(sf ScaleFunc, poly [][][]float64) []float64 {
 	}
 
 	c := []float64{0, 0}
-	for i := 0; i < len(ring)-1; i++ {
-		i0, i1 := sf(ring[i][0], ring[i][1])
-		j0, j1 := sf(ring[i+1][0], ring[i+1][1])
+	scaled := scalePoints(sf, ring...)
+	for i := 0; i < len(scaled)-1; i++ {
+		i0, i1 := scaled[i][0], scaled[i][1]
+		j0, j1 := scaled[i+1][0], scaled[i+1][1]
 		c[0] += (i0 + j0) * (i0*j1 - j0*i1)
 		c[1] += (i1 + j1) * (i0*j1 - j0*i1)
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"path"
 	"strings"
 	"testing"
@@ -401,6 +402,54 @@ func TestSVGWithNilGeometry(t *testing.T) {
 	}
 }
 
+func TestSVGWithInvalidPoints(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	line := geojson.NewLineStringGeometry([][]float64{{0, 0}, {400, 400}})
+	tcs := []struct {
+		name     string
+		geometry *geojson.Geometry
+		expected string
+	}{
+		{"nil point", geojson.NewPointGeometry(nil),
+			`<svg width="200" height="200"><path d="M0.000000 200.000000,200.000000 0.000000"/></svg>`},
+		{"point with one coordinate", geojson.NewPointGeometry([]float64{1}),
+			`<svg width="200" height="200"><path d="M0.000000 200.000000,200.000000 0.000000"/></svg>`},
+		{"NaN point", geojson.NewMultiPointGeometry([]float64{nan, 1}, []float64{200, 200}),
+			`<svg width="200" height="200"><g><circle cx="100.000000" cy="100.000000" r="1"/></g><path d="M0.000000 200.000000,200.000000 0.000000"/></svg>`},
+		{"infinite point in a line", geojson.NewLineStringGeometry([][]float64{{0, 400}, {inf, 0}, {400, 0}}),
+			`<svg width="200" height="200"><path d="M0.000000 0.000000,200.000000 200.000000"/><path d="M0.000000 200.000000,200.000000 0.000000"/></svg>`},
+		{"line with one point", geojson.NewLineStringGeometry([][]float64{{0, 400}}),
+			`<svg width="200" height="200"><path d="M0.000000 200.000000,200.000000 0.000000"/></svg>`},
+		{"polygon ring with one point", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {400, 0}, {400, 400}, {0, 0}}, {{200, 200}}}),
+			`<svg width="200" height="200"><path d="M0.000000 200.000000,200.000000 200.000000,200.000000 0.000000,0.000000 200.000000 Z"/><path d="M0.000000 200.000000,200.000000 0.000000"/></svg>`},
+		{"polygon with no valid rings", geojson.NewMultiPolygonGeometry([][][]float64{{{0, 0}}, nil}, nil),
+			`<svg width="200" height="200"><g></g><path d="M0.000000 200.000000,200.000000 0.000000"/></svg>`},
+	}
+	for _, tc := range tcs {
+		svg := geojson2svg.New()
+		svg.AppendGeometry(tc.geometry)
+		svg.AppendGeometry(line)
+		if got := svg.Draw(200, 200); got != tc.expected {
+			t.Errorf("%s:\nexpected \n%s\ngot \n%s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestSVGWithCoincidentPoints(t *testing.T) {
+	expected := `<svg width="200" height="200"><circle cx="100.000000" cy="100.000000" r="1"/><circle cx="100.000000" cy="100.000000" r="1"/></svg>`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "Point", "coordinates": [10, 20]}`)
+	addGeometry(t, svg, `{"type": "Point", "coordinates": [10, 20]}`)
+
+	got := svg.Draw(200, 200)
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+	if h := svg.GetHeightForWidth(200, func(x, y float64) (float64, float64) { return x, y }); h != 200 {
+		t.Errorf("expected a height of 200 for coincident points, got %v", h)
+	}
+}
+
 func TestSVGWithResponsiveSize(t *testing.T) {
 	expected := `<svg style="width:100%;"><path d="M0.000000 200.000000,0.000000 0.000000,200.000000 0.000000,200.000000 200.000000"/></svg>`
 	svg := geojson2svg.New()
@@ -440,6 +489,75 @@ func TestSVGWithFallbackAndPattern(t *testing.T) {
 	}
 }
 
+func TestSVGWithFallbackAlt(t *testing.T) {
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+	pngConverter := geojson2svg.NewPNGConverter("sh", []string{"-c", `echo "test" >> ` + geojson2svg.ArgPNGFilename})
+
+	got := svg.Draw(200, 200, geojson2svg.WithPNGFallback(pngConverter))
+	if expected := `<img alt="` + geojson2svg.DefaultFallbackAlt + `"`; !strings.Contains(got, expected) {
+		t.Errorf("Expected `%s` to contain `%s`", got, expected)
+	}
+
+	got = svg.Draw(200, 200, geojson2svg.WithPNGFallback(pngConverter), geojson2svg.WithFallbackAlt("Map: <Region>"))
+	if expected := `<img alt="Map: &lt;Region&gt;"`; !strings.Contains(got, expected) {
+		t.Errorf("Expected `%s` to contain `%s`", got, expected)
+	}
+}
+
+func TestSVGWithDocumentTitle(t *testing.T) {
+	expected := `<svg width="200" height="200"><title>Map: &lt;Region&gt; &amp; more</title><desc>Subtitle</desc><defs><pattern id="foo"></pattern></defs><path d="M0.000000 200.000000,0.000000 0.000000,200.000000 0.000000,200.000000 200.000000"/></svg>`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+
+	got := svg.Draw(200, 200, geojson2svg.WithPattern(`<pattern id="foo"></pattern>`), geojson2svg.WithDocumentTitle("Map: <Region> & more", "Subtitle"))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+
+	// the title is the first child of the svg element even with a fallback png, and is omitted when empty
+	pngConverter := geojson2svg.NewPNGConverter("sh", []string{"-c", `echo "test" >> ` + geojson2svg.ArgPNGFilename})
+	got = svg.Draw(200, 200, geojson2svg.WithPNGFallback(pngConverter), geojson2svg.WithDocumentTitle("Map", ""))
+	if !strings.Contains(got, ` height="200"><title>Map</title>`+"\n\t<switch>") {
+		t.Errorf("Expected `%s` to start with the title", got)
+	}
+	if strings.Contains(got, "<desc>") {
+		t.Errorf("Expected `%s` not to contain a desc", got)
+	}
+
+	// the title is only drawn by the call given the option
+	if got = svg.Draw(200, 200); strings.Contains(got, "<title>") {
+		t.Errorf("Expected `%s` not to contain a title", got)
+	}
+}
+
+func TestSVGWithNorthArrow(t *testing.T) {
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,40], [40,40], [40,0]]}`)
+	symbol := fmt.Sprintf(geojson2svg.NorthArrowSymbol, "map-north")
+	use := `<use href="#map-north" x="170.000000" y="10.000000" width="20" height="30"></use>`
+
+	got := svg.DrawWithProjection(200, 200, geojson2svg.MercatorProjection, geojson2svg.WithNorthArrow("map-north", 170, 10))
+	if !strings.Contains(got, "<defs>"+symbol+"</defs>") {
+		t.Errorf("Expected `%s` to contain `%s`", got, "<defs>"+symbol+"</defs>")
+	}
+	if !strings.HasSuffix(got, use+"</svg>") {
+		t.Errorf("Expected `%s` to end with `%s`", got, use+"</svg>")
+	}
+
+	// the identity projection - the coordinates may not be geographic
+	got = svg.Draw(200, 200, geojson2svg.WithNorthArrow("map-north", 170, 10))
+	if strings.Contains(got, "map-north") {
+		t.Errorf("Expected `%s` not to contain a north arrow", got)
+	}
+
+	// the arrow is only drawn by the call given the option
+	got = svg.DrawWithProjection(200, 200, geojson2svg.MercatorProjection)
+	if strings.Contains(got, "map-north") {
+		t.Errorf("Expected `%s` not to contain a north arrow", got)
+	}
+}
+
 func TestSVGMultiplePatterns(t *testing.T) {
 	pattern1 := `<pattern id="foo"><g><polygon points="00 00 02 00 00 02 00 00"></polygon></g></pattern>"`
 	pattern2 := `<pattern id="bar"><g><polygon points="00 00 02 00 00 02 00 00"></polygon></g></pattern>"`
@@ -454,6 +572,137 @@ func TestSVGMultiplePatterns(t *testing.T) {
 	}
 }
 
+func TestSVGOverlay(t *testing.T) {
+	expected := `<svg width="200" height="200"><path d="M0.000000 200.000000,0.000000 0.000000,200.000000 0.000000,200.000000 200.000000"/><circle cx="100.000000" cy="100.000000" r="2"/></svg>`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+	overlay := func(sf geojson2svg.ScaleFunc) string {
+		x, y := sf(200, 200)
+		return fmt.Sprintf(`<circle cx="%f" cy="%f" r="2"/>`, x, y)
+	}
+
+	got := svg.Draw(200, 200, geojson2svg.WithOverlay(overlay))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
+
+func TestSVGUnderlay(t *testing.T) {
+	expected := `<svg width="200" height="200"><circle cx="100.000000" cy="100.000000" r="2"/><path d="M0.000000 200.000000,0.000000 0.000000,200.000000 0.000000,200.000000 200.000000"/><circle cx="0.000000" cy="0.000000" r="2"/></svg>`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+	marker := func(x, y float64) geojson2svg.Overlay {
+		return func(sf geojson2svg.ScaleFunc) string {
+			x, y := sf(x, y)
+			return fmt.Sprintf(`<circle cx="%f" cy="%f" r="2"/>`, x, y)
+		}
+	}
+
+	got := svg.Draw(200, 200, geojson2svg.WithOverlay(marker(0, 400)), geojson2svg.WithUnderlay(marker(200, 200)))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
+
+func TestSVGScreenOverlay(t *testing.T) {
+	expected := `<svg width="200" height="200"><path d="M0.000000 200.000000,0.000000 0.000000,200.000000 0.000000,200.000000 200.000000"/><circle cx="0.000000" cy="0.000000" r="2"/><circle cx="100.000000" cy="100.000000" r="2"/></svg>`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+	marker := func(x, y float64) geojson2svg.Overlay {
+		return func(sf geojson2svg.ScaleFunc) string {
+			x, y := sf(x, y)
+			return fmt.Sprintf(`<circle cx="%f" cy="%f" r="2"/>`, x, y)
+		}
+	}
+
+	got := svg.Draw(200, 200, geojson2svg.WithScreenOverlay(marker(200, 200)), geojson2svg.WithOverlay(marker(0, 400)))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+
+	converter := &recordingConverter{}
+	got = svg.Draw(200, 200, geojson2svg.WithScreenOverlay(marker(200, 200)), geojson2svg.WithPNGFallback(converter))
+	if !strings.HasSuffix(got, "</switch>\n"+`<circle cx="100.000000" cy="100.000000" r="2"/></svg>`) {
+		t.Errorf("Expected `%s` to end with the screen overlay, outside the switch", got)
+	}
+	if strings.Contains(converter.converted, "<circle") {
+		t.Errorf("Expected the screen overlay to be excluded from the fallback png, but converted `%s`", converter.converted)
+	}
+}
+
+// recordingConverter is a PNGConverter that records the svg it converts, returning a fixed png
+type recordingConverter struct {
+	converted string
+}
+
+func (c *recordingConverter) Convert(svg []byte) ([]byte, error) {
+	c.converted = string(svg)
+	return []byte("png"), nil
+}
+
+func (c *recordingConverter) IncludeFallbackImage(attributes string, content string, width float64, height float64, alt string) string {
+	png, _ := c.Convert([]byte(geojson2svg.FallbackImageSVG(attributes, content, width, height, 1)))
+	return geojson2svg.SVGWithFallbackImage(attributes, content, width, height, png, alt)
+}
+
+func TestSVGWithStrokeProperties(t *testing.T) {
+	expected := `<svg width="200" height="200"><path d="M0.000000 200.000000,200.000000 0.000000" class="river" fill="none" stroke="#0000ff" stroke-dasharray="4 2" stroke-opacity="0.00001" stroke-width="1.5"/></svg>`
+	svg := geojson2svg.New()
+	addFeature(t, svg, `{"type": "Feature", "properties": {"class": "river", "fill": "none", "stroke": "#0000ff", "stroke-width": 1.5, "stroke-dasharray": "4 2", "stroke-opacity": 0.00001, "name": "River"}, "geometry": {"type": "LineString", "coordinates": [[0,0], [400,400]]}}`)
+
+	got := svg.Draw(200, 200, geojson2svg.UseProperties(append([]string{"class", "fill"}, geojson2svg.StrokeProperties...)))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
+
+func TestSVGFeatureOverlay(t *testing.T) {
+	expected := `<svg width="200" height="200"><path d="M0.000000 200.000000,0.000000 0.000000,200.000000 0.000000,200.000000 200.000000"/>` +
+		`<path d="M0.000000 200.000000,100.000000 100.000000" class="boundary" style="fill: none;"/></svg>`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+	fc, err := geojson.UnmarshalFeatureCollection([]byte(`{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {"class": "region", "name": "A"}, "geometry": {"type": "LineString", "coordinates": [[0,0], [200,200]]}}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	got := svg.Draw(200, 200, geojson2svg.WithTitles("name"), geojson2svg.WithOverlay(geojson2svg.FeatureOverlay(fc, map[string]string{"class": "boundary", "style": "fill: none;"})))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
+
+func TestSVGDrawnTwiceWithPatternAndOverlay(t *testing.T) {
+	pattern := `<pattern id="foo"><g><polygon points="00 00 02 00 00 02 00 00"></polygon></g></pattern>"`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+	overlay := func(sf geojson2svg.ScaleFunc) string {
+		x, y := sf(200, 200)
+		return fmt.Sprintf(`<circle cx="%f" cy="%f" r="2"/>`, x, y)
+	}
+
+	expected := svg.Draw(200, 200, geojson2svg.WithPattern(pattern), geojson2svg.WithOverlay(overlay))
+	got := svg.Draw(200, 200, geojson2svg.WithPattern(pattern), geojson2svg.WithOverlay(overlay))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
+
+func TestSVGExtendBounds(t *testing.T) {
+	expected := `<svg width="200" height="200"><path d="M0.000000 200.000000,0.000000 100.000000,100.000000 100.000000,100.000000 200.000000"/></svg>`
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+	svg.ExtendBounds([][]float64{{800, 800}})
+
+	got := svg.Draw(200, 200)
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+	if h := svg.GetHeightForWidth(200, func(x, y float64) (float64, float64) { return x, y }); h != 200 {
+		t.Errorf("expected height 200, got %v", h)
+	}
+}
+
 func TestFeatureProperties(t *testing.T) {
 	tcs := []struct {
 		name      string
@@ -485,6 +734,18 @@ func TestFeatureProperties(t *testing.T) {
 			`{"type": "Feature", "properties": {"class": "class"}, "geometry": { "type": "Point", "coordinates": [10.5,20] }}`,
 			[]string{},
 			`<svg width="400" height="400"><circle cx="200.000000" cy="200.000000" r="1"/></svg>`},
+		{"with string id (point)",
+			`{"type": "Feature", "id": "f1", "geometry": { "type": "Point", "coordinates": [10.5,20] }}`,
+			nil,
+			`<svg width="400" height="400"><circle cx="200.000000" cy="200.000000" r="1" id="f1"/></svg>`},
+		{"with numeric id (point)",
+			`{"type": "Feature", "id": 2000000, "geometry": { "type": "Point", "coordinates": [10.5,20] }}`,
+			nil,
+			`<svg width="400" height="400"><circle cx="200.000000" cy="200.000000" r="1" id="2000000"/></svg>`},
+		{"with escaped id and class (point)",
+			`{"type": "Feature", "id": "f1\" onload=\"alert(1)", "properties": {"class": "<b>&</b>"}, "geometry": { "type": "Point", "coordinates": [10.5,20] }}`,
+			nil,
+			`<svg width="400" height="400"><circle cx="200.000000" cy="200.000000" r="1" class="&lt;b&gt;&amp;&lt;/b&gt;" id="f1&#34; onload=&#34;alert(1)"/></svg>`},
 
 		{"no props (linestring)",
 			`{"type": "Feature", "geometry": { "type": "LineString", "coordinates": [[10.4,20.5], [40.3,42.3]] }}`,
@@ -555,6 +816,18 @@ func TestFeatureProperties(t *testing.T) {
 	}
 }
 
+func TestFeatureTitleIsEscaped(t *testing.T) {
+	expected := `<svg width="400" height="400"><circle cx="200.000000" cy="200.000000" r="1"><title>Fish &amp; Chips &lt;script&gt;</title></circle></svg>`
+
+	svg := geojson2svg.New()
+	addFeature(t, svg, `{"type": "Feature", "properties": {"name": "Fish & Chips <script>"}, "geometry": { "type": "Point", "coordinates": [10.5,20] }}`)
+
+	got := svg.Draw(400, 400, geojson2svg.WithTitles("name"))
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
+
 func TestExample(t *testing.T) {
 	exampleFile := path.Join("testdata", "example.json")
 	geojson, err := ioutil.ReadFile(exampleFile)
@@ -586,3 +859,54 @@ func TestExample(t *testing.T) {
 		t.Errorf("\nexpected \n%s\ngot \n%s", wantString, got)
 	}
 }
+
+func TestBoundingBox(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.AddFeature(geojson.NewPointFeature([]float64{1, 5}))
+	fc.AddFeature(geojson.NewPolygonFeature([][][]float64{{{-2, 3}, {4, 3}, {4, 7}, {-2, 3}}}))
+
+	got := geojson2svg.BoundingBox(fc)
+	expected := []float64{-2, 3, 4, 7}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := geojson2svg.BoundingBox(geojson.NewFeatureCollection()); got != nil {
+		t.Errorf("expected nil for an empty collection, got %v", got)
+	}
+}
+
+func TestArea(t *testing.T) {
+	identity := func(x, y float64) (float64, float64) { return x, y }
+	tcs := []struct {
+		name     string
+		geometry *geojson.Geometry
+		expected float64
+	}{
+		{"nil geometry", nil, 0},
+		{"point", geojson.NewPointGeometry([]float64{1, 1}), 0},
+		{"polygon", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {4, 0}, {4, 3}, {0, 3}, {0, 0}}}), 12},
+		{"clockwise polygon", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {0, 3}, {4, 3}, {4, 0}, {0, 0}}}), 12},
+		{"polygon with a hole", geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {4, 0}, {4, 3}, {0, 3}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 2}, {1, 1}}}), 11},
+		{"multipolygon", geojson.NewMultiPolygonGeometry([][][]float64{{{0, 0}, {4, 0}, {4, 3}, {0, 3}, {0, 0}}}, [][][]float64{{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}), 12.5},
+		{"collection", geojson.NewCollectionGeometry(geojson.NewPolygonGeometry([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}}), geojson.NewPointGeometry([]float64{1, 1})), 1},
+	}
+	for _, tc := range tcs {
+		if got := geojson2svg.Area(identity, tc.geometry); got != tc.expected {
+			t.Errorf("%s: expected area %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestGetScaleFunc(t *testing.T) {
+	svg := geojson2svg.New()
+	addGeometry(t, svg, `{"type": "LineString", "coordinates": [[0,0], [0,400], [400,400], [400,0]]}`)
+
+	sf := svg.GetScaleFunc(200, 200, func(x, y float64) (float64, float64) { return x, y })
+	if x, y := sf(400, 0); x != 200 || y != 200 {
+		t.Errorf("expected (400, 0) to be scaled to (200, 200), got (%v, %v)", x, y)
+	}
+	if x, y := sf(100, 300); x != 50 || y != 50 {
+		t.Errorf("expected (100, 300) to be scaled to (50, 50), got (%v, %v)", x, y)
+	}
+}
@@ -0,0 +1,127 @@
+package geojson2svg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/paulmach/go.geojson"
+)
+
+// The symbols that may be drawn at points (see WithMarker)
+const (
+	MarkerCircle   = "circle"
+	MarkerSquare   = "square"
+	MarkerTriangle = "triangle"
+	MarkerPin      = "pin"
+)
+
+// DefaultMarkerSize is the width and height of a marker that has no size
+const DefaultMarkerSize = 8.0
+
+// The properties of a feature that override the Marker of its points - named as in the simplestyle-spec
+const (
+	MarkerSymbolProperty = "marker-symbol"
+	MarkerSizeProperty   = "marker-size"
+	MarkerColourProperty = "marker-color"
+)
+
+// markerSymbols are the fmt templates (given the id) of the <symbol> of each marker, drawn within a 10 by 10 viewBox
+var markerSymbols = map[string]string{
+	MarkerCircle:   `<symbol id="%s" viewBox="0 0 10 10"><circle cx="5" cy="5" r="5"></circle></symbol>`,
+	MarkerSquare:   `<symbol id="%s" viewBox="0 0 10 10"><rect width="10" height="10"></rect></symbol>`,
+	MarkerTriangle: `<symbol id="%s" viewBox="0 0 10 10"><path d="M5 0L10 10L0 10Z"></path></symbol>`,
+	MarkerPin:      `<symbol id="%s" viewBox="0 0 10 10"><path d="M5 10L1.5 5.5A4 4 0 1 1 8.5 5.5Z"></path></symbol>`,
+}
+
+// Marker describes the symbol drawn at each point (in place of a 1px circle) - see WithMarker
+type Marker struct {
+	Symbol string  // one of the Marker constants - MarkerCircle if empty or unknown
+	Size   float64 // the width and height of the symbol - DefaultMarkerSize if not positive
+	Colour string  // the fill of the symbol - inherited (e.g. from the style of the feature) if empty
+}
+
+// markerOptions are the prefix of the ids of the marker symbols, and the Marker of points that do not override it
+type markerOptions struct {
+	idPrefix string
+	defaults Marker
+}
+
+// pointMarker is the Marker of the points of a feature, with the symbols used by the markers of a draw (keyed by id), so that each is defined once
+type pointMarker struct {
+	Marker
+	idPrefix string
+	used     map[string]string
+}
+
+// IsValidMarkerSymbol returns true if the symbol is one of the Marker constants
+func IsValidMarkerSymbol(symbol string) bool {
+	_, ok := markerSymbols[symbol]
+	return ok
+}
+
+// WithMarker configures the SVG to draw each point as the symbol of the marker, centred on the point (or, for a pin, with its tip on the point),
+// in place of a 1px circle. The marker of a feature may be overridden by its MarkerSymbolProperty, MarkerSizeProperty and MarkerColourProperty.
+// Each symbol drawn is defined (once) in the defs of the svg, with the id idPrefix-marker-symbol, and drawn by a <use> element.
+func WithMarker(idPrefix string, marker Marker) Option {
+	return func(svg *SVG) {
+		svg.marker = &markerOptions{idPrefix: idPrefix, defaults: marker}
+	}
+}
+
+// newPointMarker returns the Marker of the points of the feature (or of points that are not features, if nil), recording the symbols used,
+// or nil if the svg has no marker
+func (m *markerOptions) newPointMarker(feature *geojson.Feature, used map[string]string) *pointMarker {
+	if m == nil {
+		return nil
+	}
+	marker := m.defaults
+	if feature != nil {
+		if symbol, ok := feature.Properties[MarkerSymbolProperty].(string); ok && IsValidMarkerSymbol(symbol) {
+			marker.Symbol = symbol
+		}
+		if size, ok := feature.Properties[MarkerSizeProperty].(float64); ok && size > 0 {
+			marker.Size = size
+		}
+		if colour, ok := feature.Properties[MarkerColourProperty].(string); ok && len(colour) > 0 {
+			marker.Colour = colour
+		}
+	}
+	if !IsValidMarkerSymbol(marker.Symbol) {
+		marker.Symbol = MarkerCircle
+	}
+	if marker.Size <= 0 {
+		marker.Size = DefaultMarkerSize
+	}
+	return &pointMarker{Marker: marker, idPrefix: m.idPrefix, used: used}
+}
+
+// draw draws the marker at x, y with the given attributes and title, recording the use of its symbol
+func (m *pointMarker) draw(w io.Writer, x, y float64, attributes string, title string) {
+	id := m.idPrefix + "-marker-" + m.Symbol
+	m.used[id] = fmt.Sprintf(markerSymbols[m.Symbol], id)
+	top := y - m.Size/2
+	if m.Symbol == MarkerPin {
+		top = y - m.Size
+	}
+	fill := ""
+	if len(m.Colour) > 0 {
+		fill = ` fill="` + htmlutil.EscapeAttr(m.Colour) + `"`
+	}
+	fmt.Fprintf(w, `<use href="#%s" x="%f" y="%f" width="%g" height="%g"%s%s%s`, id, x-m.Size/2, top, m.Size, m.Size, fill, attributes, endTag("use", title))
+}
+
+// markerSymbolDefs returns the definitions of the symbols used, in order of id
+func markerSymbolDefs(used map[string]string) []string {
+	ids := make([]string, 0, len(used))
+	for id := range used {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	defs := make([]string, len(ids))
+	for i, id := range ids {
+		defs[i] = used[id]
+	}
+	return defs
+}
@@ -0,0 +1,107 @@
+package geojson2svg_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+)
+
+const twoPoints = `{"type": "FeatureCollection", "features": [` +
+	`{"type": "Feature", "properties": {"name": "A"}, "geometry": {"type": "Point", "coordinates": [0, 0]}},` +
+	`{"type": "Feature", "properties": {"name": "B"}, "geometry": {"type": "Point", "coordinates": [400, 400]}}]}`
+
+func TestSVGWithMarker(t *testing.T) {
+	tcs := []struct {
+		symbol   string
+		expected string
+	}{
+		{geojson2svg.MarkerCircle, `<circle cx="5" cy="5" r="5"></circle>`},
+		{geojson2svg.MarkerSquare, `<rect width="10" height="10"></rect>`},
+		{geojson2svg.MarkerTriangle, `<path d="M5 0L10 10L0 10Z"></path>`},
+		{geojson2svg.MarkerPin, `<path d="M5 10L1.5 5.5A4 4 0 1 1 8.5 5.5Z"></path>`},
+	}
+	for _, tc := range tcs {
+		svg := geojson2svg.New()
+		addFeatureCollection(t, svg, twoPoints)
+
+		got := svg.Draw(200, 200, geojson2svg.WithTitles("name"), geojson2svg.WithMarker("map", geojson2svg.Marker{Symbol: tc.symbol, Size: 10, Colour: "red"}))
+
+		symbol := `<symbol id="map-marker-` + tc.symbol + `" viewBox="0 0 10 10">` + tc.expected + `</symbol>`
+		if !strings.Contains(got, `<defs>`+symbol+`</defs>`) {
+			t.Errorf("Expected `%s` to define the %s symbol `%s`", got, tc.symbol, symbol)
+		}
+		top := "-5.000000"
+		if tc.symbol == geojson2svg.MarkerPin {
+			top = "-10.000000" // the tip of the pin is on the point
+		}
+		use := `<use href="#map-marker-` + tc.symbol + `" x="195.000000" y="` + top + `" width="10" height="10" fill="red"><title>B</title></use>`
+		if !strings.Contains(got, use) {
+			t.Errorf("Expected `%s` to contain `%s`", got, use)
+		}
+		if strings.Contains(got, `r="1"`) {
+			t.Errorf("Expected `%s` not to draw the points as circles", got)
+		}
+	}
+}
+
+func TestSVGWithMarkerDefinesEachSymbolOnce(t *testing.T) {
+	svg := geojson2svg.New()
+	addFeatureCollection(t, svg, twoPoints)
+	option := geojson2svg.WithMarker("map", geojson2svg.Marker{Symbol: geojson2svg.MarkerSquare})
+
+	svg.Draw(200, 200, option)
+	got := svg.Draw(200, 200, option)
+	if count := strings.Count(got, "<symbol"); count != 1 {
+		t.Errorf("Expected `%s` to define 1 symbol, but found %d", got, count)
+	}
+	if count := strings.Count(got, `<use href="#map-marker-square"`); count != 2 {
+		t.Errorf("Expected `%s` to use the symbol twice, but found %d", got, count)
+	}
+}
+
+func TestSVGWithMarkerSize(t *testing.T) {
+	svg := geojson2svg.New()
+	addFeatureCollection(t, svg, twoPoints)
+
+	got := svg.Draw(200, 200, geojson2svg.WithMarker("map", geojson2svg.Marker{}))
+	expected := `<use href="#map-marker-circle" x="196.000000" y="-4.000000" width="8" height="8"/>`
+	if !strings.Contains(got, expected) {
+		t.Errorf("Expected `%s` to contain a marker of the default symbol and size `%s`", got, expected)
+	}
+
+	got = svg.Draw(200, 200, geojson2svg.WithMarker("map", geojson2svg.Marker{Size: 20}))
+	expected = `<use href="#map-marker-circle" x="190.000000" y="-10.000000" width="20" height="20"/>`
+	if !strings.Contains(got, expected) {
+		t.Errorf("Expected `%s` to contain `%s`", got, expected)
+	}
+}
+
+func TestSVGWithMarkerProperties(t *testing.T) {
+	svg := geojson2svg.New()
+	addFeatureCollection(t, svg, `{"type": "FeatureCollection", "features": [`+
+		`{"type": "Feature", "properties": {"marker-symbol": "triangle", "marker-size": 4, "marker-color": "#00f\"/>"}, "geometry": {"type": "Point", "coordinates": [0, 0]}},`+
+		`{"type": "Feature", "properties": {"marker-symbol": "star"}, "geometry": {"type": "MultiPoint", "coordinates": [[400, 400]]}}]}`)
+
+	got := svg.Draw(200, 200, geojson2svg.WithMarker("map", geojson2svg.Marker{Symbol: geojson2svg.MarkerSquare, Size: 10}))
+	for _, expected := range []string{
+		`<use href="#map-marker-triangle" x="-2.000000" y="198.000000" width="4" height="4" fill="#00f&#34;/&gt;"/>`,
+		`<g><use href="#map-marker-square" x="195.000000" y="-5.000000" width="10" height="10"/></g>`,
+		`<defs><symbol id="map-marker-square"`,
+		`</symbol><symbol id="map-marker-triangle"`,
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Expected `%s` to contain `%s`", got, expected)
+		}
+	}
+}
+
+func TestSVGWithoutMarker(t *testing.T) {
+	svg := geojson2svg.New()
+	addFeatureCollection(t, svg, twoPoints)
+
+	got := svg.Draw(200, 200)
+	if expected := `<svg width="200" height="200"><circle cx="0.000000" cy="200.000000" r="1"/><circle cx="200.000000" cy="0.000000" r="1"/></svg>`; got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
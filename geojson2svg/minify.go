@@ -0,0 +1,102 @@
+package geojson2svg
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	startTagPattern    = regexp.MustCompile(`<[a-zA-Z][^>]*>`)
+	attributePattern   = regexp.MustCompile(`\s+([a-zA-Z:-]+)="([^"]*)"`)
+	decimalPattern     = regexp.MustCompile(`-?[0-9]*\.[0-9]+`)
+	styleSpacePattern  = regexp.MustCompile(`\s*([:;,])\s*`)
+	betweenTagsPattern = regexp.MustCompile(`>\s+<`)
+)
+
+// numericAttributes are the attributes whose numbers are rounded by Minify. Other attributes (e.g. ids and data- attributes) are unchanged.
+var numericAttributes = map[string]bool{
+	"d": true, "points": true, "transform": true, "viewBox": true, "textLength": true,
+	"x": true, "y": true, "x1": true, "y1": true, "x2": true, "y2": true, "dx": true, "dy": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true, "width": true, "height": true,
+}
+
+// defaultAttributes are attribute values that are the svg default, so may be omitted
+var defaultAttributes = map[string]bool{
+	`x="0"`: true, `y="0"`: true, `x1="0"`: true, `y1="0"`: true, `x2="0"`: true, `y2="0"`: true,
+	`dx="0"`: true, `dy="0"`: true, `cx="0"`: true, `cy="0"`: true,
+	`lengthAdjust="spacing"`: true, `patternUnits="objectBoundingBox"`: true,
+}
+
+// Minify reduces the size of an svg without changing how it is drawn: numbers in coordinate and size attributes are rounded
+// to the given number of decimal places, attributes that are empty or have their default value are removed, the whitespace
+// in style attributes is removed, as is whitespace between elements (so the svg must not rely on whitespace-only text).
+// The content of elements (e.g. titles and text) is unchanged.
+func Minify(svg string, precision int) string {
+	svg = startTagPattern.ReplaceAllStringFunc(svg, func(tag string) string {
+		return attributePattern.ReplaceAllStringFunc(tag, func(attribute string) string {
+			return minifyAttribute(attribute, precision)
+		})
+	})
+	return betweenTagsPattern.ReplaceAllString(svg, "><")
+}
+
+// minifyAttribute returns the minified form of a single name="value" attribute (including the whitespace before it), or "" if it can be omitted
+func minifyAttribute(attribute string, precision int) string {
+	match := attributePattern.FindStringSubmatch(attribute)
+	name, value := match[1], match[2]
+	if len(value) == 0 {
+		return ""
+	}
+	if numericAttributes[name] {
+		value = roundNumbers(value, precision)
+	}
+	if name == "style" {
+		value = strings.TrimSuffix(styleSpacePattern.ReplaceAllString(strings.TrimSpace(value), "$1"), ";")
+	}
+	minified := name + `="` + value + `"`
+	if defaultAttributes[minified] {
+		return ""
+	}
+	return " " + minified
+}
+
+// RoundNumbers rounds the numbers in the coordinate and size attributes of an svg (as Minify does) to the given number of decimal places,
+// so that the svg doesn't vary with the last digits of floating point calculations. Nothing else is changed.
+func RoundNumbers(svg string, precision int) string {
+	return startTagPattern.ReplaceAllStringFunc(svg, func(tag string) string {
+		return attributePattern.ReplaceAllStringFunc(tag, func(attribute string) string {
+			match := attributePattern.FindStringSubmatch(attribute)
+			if !numericAttributes[match[1]] {
+				return attribute
+			}
+			prefix := attribute[:len(attribute)-len(match[2])-1] // the whitespace, name and opening quote
+			return prefix + roundNumbers(match[2], precision) + `"`
+		})
+	})
+}
+
+// roundNumbers rounds each of the numbers with a decimal point in the value
+func roundNumbers(value string, precision int) string {
+	return decimalPattern.ReplaceAllStringFunc(value, func(n string) string {
+		return roundNumber(n, precision)
+	})
+}
+
+// roundNumber rounds the number to the given number of decimal places, removing trailing zeros. Numbers that would be longer once rounded (e.g. .5) are unchanged.
+func roundNumber(n string, precision int) string {
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return n
+	}
+	scale := math.Pow(10, float64(precision))
+	f = math.Round(f*scale) / scale
+	if f == 0 {
+		return "0" // not -0
+	}
+	if rounded := strconv.FormatFloat(f, 'f', -1, 64); len(rounded) <= len(n) {
+		return rounded
+	}
+	return n
+}
@@ -0,0 +1,84 @@
+package geojson2svg_test
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+)
+
+func TestMinify(t *testing.T) {
+	tcs := []struct {
+		name     string
+		svg      string
+		expected string
+	}{
+		{"rounded coordinates", `<path d="M10.123456 20.987654,30.500000 -0.000001"/>`, `<path d="M10.12 20.99,30.5 0"/>`},
+		{"rounded sizes", `<rect width="12.345000" height="8" x="1.005000"></rect>`, `<rect width="12.35" height="8" x="1"></rect>`},
+		{"default attributes", `<text x="0" y="0.000000" dy="0" textLength="10.1" lengthAdjust="spacing">a</text>`, `<text textLength="10.1">a</text>`},
+		{"empty attributes", `<path class="" d="M0 0"/>`, `<path d="M0 0"/>`},
+		{"style whitespace", `<rect style="stroke-width: 0.5; stroke: black; fill: #fff;"></rect>`, `<rect style="stroke-width:0.5;stroke:black;fill:#fff"></rect>`},
+		{"whitespace between elements", "<g>\n<polygon points=\"00 00 02 00\"></polygon>\n</g>", `<g><polygon points="00 00 02 00"></polygon></g>`},
+		{"non-numeric attributes", `<path id="map-1.5" data-ci-lower="1.23456" d="M1.23456 0"/>`, `<path id="map-1.5" data-ci-lower="1.23456" d="M1.23 0"/>`},
+		{"content unchanged", `<text x="1.5">  1.23456 : a  </text>`, `<text x="1.5">  1.23456 : a  </text>`},
+	}
+	for _, tc := range tcs {
+		if got := geojson2svg.Minify(tc.svg, 2); got != tc.expected {
+			t.Errorf("%s:\nexpected \n%s\ngot \n%s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestRoundNumbers(t *testing.T) {
+	svg := "<svg width=\"400\" height=\"300.000001\">\n<path class=\"a b\" style=\"stroke-width: 0.5;\" d=\"M10.123456 20.987654,30.500000 -0.000001\"/><text x=\"1.5\">1.23456</text></svg>"
+	expected := "<svg width=\"400\" height=\"300\">\n<path class=\"a b\" style=\"stroke-width: 0.5;\" d=\"M10.123 20.988,30.5 0\"/><text x=\"1.5\">1.23456</text></svg>"
+	if got := geojson2svg.RoundNumbers(svg, 3); got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+}
+
+func TestSVGWithMinification(t *testing.T) {
+	geojson, err := ioutil.ReadFile(path.Join("testdata", "example.json"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	svg := geojson2svg.New()
+	addFeatureCollection(t, svg, string(geojson))
+
+	options := []geojson2svg.Option{
+		geojson2svg.WithAttribute("xmlns", "http://www.w3.org/2000/svg"),
+		geojson2svg.UseProperties([]string{"style"}),
+		geojson2svg.WithPadding(geojson2svg.Padding{Top: 10, Right: 10, Bottom: 10, Left: 10}),
+	}
+	original := svg.Draw(1000, 510, options...)
+	minified := svg.Draw(1000, 510, append(options, geojson2svg.WithMinification(true, 1))...)
+
+	if len(minified) >= len(original) {
+		t.Errorf("expected the minified svg (%d bytes) to be smaller than the original (%d bytes)", len(minified), len(original))
+	}
+	if minified != geojson2svg.Minify(original, 1) {
+		t.Errorf("expected the minified svg to equal the original minified")
+	}
+	originalElements, err := testdata.CountElements(original)
+	if err != nil {
+		t.Fatalf("unable to unmarshal the original svg: %v", err)
+	}
+	minifiedElements, err := testdata.CountElements(minified)
+	if err != nil {
+		t.Fatalf("unable to unmarshal the minified svg: %v", err)
+	}
+	if len(minifiedElements) != len(originalElements) {
+		t.Errorf("expected elements %v, got %v", originalElements, minifiedElements)
+	}
+	for name, count := range originalElements {
+		if minifiedElements[name] != count {
+			t.Errorf("expected %d %s elements, got %d", count, name, minifiedElements[name])
+		}
+	}
+
+	if got := svg.Draw(1000, 510, append(options, geojson2svg.WithMinification(false, 1))...); got != original {
+		t.Errorf("expected minification to be turned off\nexpected \n%s\ngot \n%s", original, got)
+	}
+}
@@ -0,0 +1,86 @@
+package geojson2svg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// tempFilePrefix is the prefix of the names of the temporary files written by the png converter
+const tempFilePrefix = "temp_"
+
+// tempFilePatterns match the names of the temporary files written by the png converter (and by PrepareScratchDir)
+var tempFilePatterns = []string{tempFilePrefix + "*.svg", tempFilePrefix + "*.png", tempFilePrefix + "*.check"}
+
+// StaleScratchFileAge is the age beyond which a temporary file is assumed to have been left behind, rather than belonging to a conversion
+// in progress - in this process or in another sharing the directory
+const StaleScratchFileAge = 10 * time.Minute
+
+// PrepareScratchDir creates the directory in which a png converter writes its temporary files (see NewPNGConverterInDir),
+// if it doesn't already exist, and checks that a file can be written in it - returning an error if not,
+// e.g. because the directory is on a read-only filesystem.
+func PrepareScratchDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Unable to create the scratch directory for png conversion: dir=%s, error=%v", dir, err)
+	}
+	f, err := ioutil.TempFile(dir, tempFilePrefix+"*.check")
+	if err != nil {
+		return fmt.Errorf("The scratch directory for png conversion is not writable: dir=%s, error=%v", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// SweepScratchDir removes the png converter's temporary files from the directory that were last modified longer ago than maxAge -
+// e.g. left behind by a process that crashed while converting. Other files in the directory are left alone.
+// Returns the number of files removed.
+func SweepScratchDir(dir string, maxAge time.Duration) (int, error) {
+	removed := 0
+	cutoff := time.Now().Add(-maxAge)
+	for _, pattern := range tempFilePatterns {
+		files, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return removed, err
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil || info.IsDir() || info.ModTime().After(cutoff) {
+				continue
+			}
+			if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// StartScratchSweep sweeps the directory every interval (which must be positive) until the context is cancelled, removing temporary
+// files older than the interval - no conversion should take that long. It returns a channel that is closed once the sweep has stopped.
+func StartScratchSweep(ctx context.Context, dir string, interval time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := SweepScratchDir(dir, interval); err != nil {
+					log.Error(err, log.Data{"_message": "Unable to sweep the scratch directory", "dir": dir})
+				} else if n > 0 {
+					log.Info("removed stale temporary files from the scratch directory", log.Data{"dir": dir, "files": n})
+				}
+			}
+		}
+	}()
+	return stopped
+}
@@ -0,0 +1,139 @@
+package geojson2svg_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConvertInScratchDir(t *testing.T) {
+	Convey("A converter created with a scratch directory should write its temporary files there, and remove them", t, func() {
+		dir, err := ioutil.TempDir("", "scratch")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		// the conversion only succeeds if the files are in the scratch directory
+		script := `case "<SVG>" in "` + dir + `"/temp_*.svg) cat "<SVG>" > "<PNG>";; esac`
+		converter := geojson2svg.NewPNGConverterInDir(dir, "sh", []string{"-c", script})
+
+		result, err := converter.Convert([]byte("MySVG"))
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, base64.StdEncoding.EncodeToString([]byte("MySVG")))
+		So(filesIn(dir), ShouldBeEmpty)
+	})
+}
+
+func TestSweepScratchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scratch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// createFiles creates the files in the scratch directory, last modified the given time ago
+	createFiles := func(age time.Duration, names ...string) {
+		for _, name := range names {
+			file := filepath.Join(dir, name)
+			So(ioutil.WriteFile(file, []byte("x"), 0600), ShouldBeNil)
+			So(os.Chtimes(file, time.Now().Add(-age), time.Now().Add(-age)), ShouldBeNil)
+		}
+	}
+
+	Convey("Temporary files older than the maximum age should be removed, and other files left alone", t, func() {
+		createFiles(time.Hour, "temp_abc.svg", "temp_abc.png", "temp_def.png", "other.svg", "temp_notes.txt")
+		createFiles(0, "temp_new.svg", "temp_new.png")
+
+		removed, err := geojson2svg.SweepScratchDir(dir, time.Minute)
+		So(err, ShouldBeNil)
+		So(removed, ShouldEqual, 3)
+		So(filesIn(dir), ShouldResemble, []string{"other.svg", "temp_new.png", "temp_new.svg", "temp_notes.txt"})
+
+		removed, err = geojson2svg.SweepScratchDir(dir, 0)
+		So(err, ShouldBeNil)
+		So(removed, ShouldEqual, 2)
+		So(filesIn(dir), ShouldResemble, []string{"other.svg", "temp_notes.txt"})
+	})
+
+	Convey("A started sweep should periodically remove stale temporary files until it is stopped", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := geojson2svg.StartScratchSweep(ctx, dir, 10*time.Millisecond)
+
+		createFiles(time.Hour, "temp_stale.svg", "temp_stale.png")
+		deadline := time.Now().Add(5 * time.Second)
+		for len(filesIn(dir)) > 2 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(filesIn(dir), ShouldResemble, []string{"other.svg", "temp_notes.txt"})
+
+		cancel()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the sweep did not stop")
+		}
+	})
+}
+
+func TestPrepareScratchDir(t *testing.T) {
+	Convey("The scratch directory should be created if it doesn't exist", t, func() {
+		parent, err := ioutil.TempDir("", "scratch")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(parent)
+
+		dir := filepath.Join(parent, "a", "b")
+		So(geojson2svg.PrepareScratchDir(dir), ShouldBeNil)
+		info, err := os.Stat(dir)
+		So(err, ShouldBeNil)
+		So(info.IsDir(), ShouldBeTrue)
+		So(filesIn(dir), ShouldBeEmpty)
+	})
+
+	Convey("An informative error should be returned if the scratch directory cannot be created", t, func() {
+		parent, err := ioutil.TempDir("", "scratch")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(parent)
+		file := filepath.Join(parent, "file")
+		So(ioutil.WriteFile(file, []byte("x"), 0600), ShouldBeNil)
+
+		dir := filepath.Join(file, "scratch")
+		err = geojson2svg.PrepareScratchDir(dir)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "Unable to create the scratch directory for png conversion: dir="+dir)
+	})
+
+	Convey("An informative error should be returned if the scratch directory is read-only", t, func() {
+		dir, err := ioutil.TempDir("", "scratch")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(os.Chmod(dir, 0500), ShouldBeNil)
+		defer os.Chmod(dir, 0700)
+		if f, err := ioutil.TempFile(dir, "probe"); err == nil { // e.g. running as root, which ignores the permissions
+			f.Close()
+			os.Remove(f.Name())
+			SkipSo("the directory is writable despite its permissions")
+			return
+		}
+
+		err = geojson2svg.PrepareScratchDir(dir)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "The scratch directory for png conversion is not writable: dir="+dir)
+	})
+}
+
+// filesIn returns the (sorted) names of the files in the directory
+func filesIn(dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	So(err, ShouldBeNil)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
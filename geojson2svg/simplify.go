@@ -0,0 +1,110 @@
+package geojson2svg
+
+import (
+	"github.com/paulmach/go.geo"
+	"github.com/paulmach/go.geo/reducers"
+	"github.com/paulmach/go.geojson"
+)
+
+// The class names of the groups of full and low detail elements, and the suffix of the ids of low detail elements - see WithLowDetail
+const (
+	FullDetailClassName = "fullDetail"
+	LowDetailClassName  = "lowDetail"
+	LowDetailIDSuffix   = "-low"
+)
+
+// MaxLowDetailRatio is the largest size of the low detail elements, as a fraction of the size of the full detail elements,
+// beyond which simplifying is not worth the extra content and the low detail elements are omitted - see WithLowDetail
+const MaxLowDetailRatio = 0.5
+
+// WithLowDetail configures the SVG to also draw a simplified copy of its elements, in a group with the class LowDetailClassName that is not displayed
+// (the full detail elements are grouped with the class FullDetailClassName), so that a page may use css to display the low detail elements when the svg is small.
+// Each line and ring is simplified (using the Douglas-Peucker algorithm) so that no removed point is further than the tolerance (in the coordinates of the svg)
+// from the simplified line. The ids of the low detail elements have the suffix LowDetailIDSuffix, so that they remain unique.
+// The low detail elements are omitted if they are larger than MaxLowDetailRatio of the full detail elements.
+// A tolerance of zero or less draws no low detail elements.
+func WithLowDetail(tolerance float64) Option {
+	return func(svg *SVG) {
+		svg.lowDetail = tolerance
+	}
+}
+
+// identityScaleFunc returns the coordinates unchanged - for drawing geometries that have already been scaled
+func identityScaleFunc(x, y float64) (float64, float64) {
+	return x, y
+}
+
+// simplifyGeometry returns a copy of the geometry scaled by the scale function, with each line and ring simplified to within the tolerance
+// (see simplifyLine), which should be drawn with the identityScaleFunc.
+func simplifyGeometry(sf ScaleFunc, g *geojson.Geometry, tolerance float64) *geojson.Geometry {
+	switch {
+	case g == nil:
+		return nil
+	case g.IsPoint():
+		if points := simplifyLine(sf, [][]float64{g.Point}, 0, 0); len(points) > 0 {
+			return geojson.NewPointGeometry(points[0])
+		}
+		return nil
+	case g.IsMultiPoint():
+		return geojson.NewMultiPointGeometry(simplifyLine(sf, g.MultiPoint, 0, 0)...)
+	case g.IsLineString():
+		return geojson.NewLineStringGeometry(simplifyLine(sf, g.LineString, tolerance, 2))
+	case g.IsMultiLineString():
+		lines := make([][][]float64, len(g.MultiLineString))
+		for i, line := range g.MultiLineString {
+			lines[i] = simplifyLine(sf, line, tolerance, 2)
+		}
+		return geojson.NewMultiLineStringGeometry(lines...)
+	case g.IsPolygon():
+		return geojson.NewPolygonGeometry(simplifyPolygon(sf, g.Polygon, tolerance))
+	case g.IsMultiPolygon():
+		polygons := make([][][][]float64, len(g.MultiPolygon))
+		for i, polygon := range g.MultiPolygon {
+			polygons[i] = simplifyPolygon(sf, polygon, tolerance)
+		}
+		return geojson.NewMultiPolygonGeometry(polygons...)
+	case g.IsCollection():
+		geometries := make([]*geojson.Geometry, len(g.Geometries))
+		for i, x := range g.Geometries {
+			geometries[i] = simplifyGeometry(sf, x, tolerance)
+		}
+		return geojson.NewCollectionGeometry(geometries...)
+	}
+	return g
+}
+
+// simplifyPolygon simplifies each ring of the polygon - a ring needs at least 4 points (a closed triangle)
+func simplifyPolygon(sf ScaleFunc, polygon [][][]float64, tolerance float64) [][][]float64 {
+	rings := make([][][]float64, len(polygon))
+	for i, ring := range polygon {
+		rings[i] = simplifyLine(sf, ring, tolerance, 4)
+	}
+	return rings
+}
+
+// SimplifyLine returns the valid points of the line simplified (using the Douglas-Peucker algorithm, as WithLowDetail) so that no removed point
+// is further than the tolerance from the simplified line. If the simplified line would have fewer than minPoints points, the line is returned
+// unsimplified. A tolerance of zero or less leaves the line unsimplified.
+func SimplifyLine(line [][]float64, tolerance float64, minPoints int) [][]float64 {
+	return simplifyLine(identityScaleFunc, line, tolerance, minPoints)
+}
+
+// simplifyLine returns the valid points of the line scaled by the scale function and simplified to within the tolerance.
+// If the simplified line would have fewer than minPoints points, the scaled line is returned unsimplified, so that small regions do not disappear.
+func simplifyLine(sf ScaleFunc, line [][]float64, tolerance float64, minPoints int) [][]float64 {
+	scaled := scalePoints(sf, line...)
+	points := make([]geo.Point, len(scaled))
+	for i, p := range scaled {
+		points[i] = geo.Point(p)
+	}
+	if tolerance > 0 {
+		if simplified := reducers.DouglasPeucker((&geo.Path{}).SetPoints(points), tolerance).Points(); len(simplified) >= minPoints {
+			points = simplified
+		}
+	}
+	result := make([][]float64, len(points))
+	for i, p := range points {
+		result[i] = []float64{p[0], p[1]}
+	}
+	return result
+}
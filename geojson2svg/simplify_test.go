@@ -0,0 +1,48 @@
+package geojson2svg_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+)
+
+// wavyLine is a line whose waves are half a pixel high when drawn 200 pixels square
+const wavyLine = `{"type": "Feature", "id": "a", "properties": {}, "geometry": {"type": "LineString", ` +
+	`"coordinates": [[0,0], [50,1], [100,0], [150,1], [200,0], [250,1], [300,0], [350,1], [400,0], [400,100], [400,200], [400,300], [400,400]]}}`
+
+func TestSVGWithLowDetail(t *testing.T) {
+	svg := geojson2svg.New()
+	addFeature(t, svg, wavyLine)
+
+	full := svg.Draw(200, 200)
+	got := svg.Draw(200, 200, geojson2svg.WithLowDetail(1))
+
+	start := strings.Index(full, "<path")
+	end := strings.LastIndex(full, "</svg>")
+	expected := full[:start] +
+		`<g class="fullDetail">` + full[start:end] + `</g>` +
+		`<g class="lowDetail" display="none"><path d="M0.000000 200.000000,200.000000 200.000000,200.000000 0.000000" id="a-low"/></g>` +
+		full[end:]
+	if got != expected {
+		t.Errorf("\nexpected \n%s\ngot \n%s", expected, got)
+	}
+
+	if got := svg.Draw(200, 200, geojson2svg.WithLowDetail(0.1)); got != full {
+		t.Errorf("Expected the low detail elements to be omitted when they are not much smaller than the full detail, got \n%s", got)
+	}
+	if got := svg.Draw(200, 200); got != full {
+		t.Errorf("Expected the low detail option not to apply to later draws, got \n%s", got)
+	}
+}
+
+func TestSVGWithLowDetailKeepsSmallRings(t *testing.T) {
+	svg := geojson2svg.New()
+	addFeature(t, svg, wavyLine)
+	addFeature(t, svg, `{"type": "Feature", "id": "small", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,400], [1,400], [1,401], [0,400]]]}}`)
+
+	got := svg.Draw(200, 200, geojson2svg.WithLowDetail(1))
+	if !strings.Contains(got, `<path d="M0.000000 0.498753,0.498753 0.498753,0.498753 0.000000,0.000000 0.498753 Z" id="small-low"/>`) {
+		t.Errorf("Expected a ring too small to simplify to be drawn unsimplified, got \n%s", got)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
 	"github.com/ONSdigital/go-ns/log"
 )
 
@@ -27,14 +30,22 @@ const (
 		<foreignObject>%s</foreignObject>
 	</switch>
 </svg>`
+	// FallbackErrorText is included in the svg instead of the fallback image when the png conversion fails
+	FallbackErrorText = "<p>Unsupported Browser</p>"
+	// DefaultFallbackAlt is the alt text of a fallback image when none is given
+	DefaultFallbackAlt = "Fallback map image for older browsers"
 	// letterBytes is used to generate a random text string for use as a file name
 	letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 )
 
+// sizeAttributePattern matches the width and height attributes of an svg (but not e.g. stroke-width)
+var sizeAttributePattern = regexp.MustCompile(`(^|\s)(width|height)="[^"]*"`)
+
 // PNGConverter invokes an executable file to convert an svg file to png
 type executablePNGConverter struct {
 	Executable string
 	Arguments  []string
+	Dir        string // the directory in which the temporary svg and png files are written - the working directory if empty
 }
 
 // NewPNGConverter creates a new PNGConverter that invokes an executable to perform the conversion.
@@ -47,10 +58,16 @@ func NewPNGConverter(executable string, arguments []string) PNGConverter {
 	return &executablePNGConverter{Executable: executable, Arguments: arguments}
 }
 
+// NewPNGConverterInDir creates a new PNGConverter as NewPNGConverter, that writes its temporary files in the given directory
+// (see PrepareScratchDir) instead of the working directory.
+func NewPNGConverterInDir(dir string, executable string, arguments []string) PNGConverter {
+	return &executablePNGConverter{Executable: executable, Arguments: arguments, Dir: dir}
+}
+
 // Convert converts the given svg file to a base64-encoded png
 func (exe *executablePNGConverter) Convert(svg []byte) ([]byte, error) {
 
-	tempName := "temp_" + randomString(8)
+	tempName := filepath.Join(exe.Dir, tempFilePrefix+randomString(8))
 	tempSVG := tempName + ".svg"
 	tempPNG := tempName + ".png"
 
@@ -88,22 +105,51 @@ func (exe *executablePNGConverter) Convert(svg []byte) ([]byte, error) {
 	return []byte(imgBase64Str), nil
 }
 
-// IncludeFallbackImage inserts a foreignObject with a fallback png image.
+// IncludeFallbackImage inserts a foreignObject with a fallback png image, with the given alt text.
 // thanks to http://davidensinger.com/2013/04/inline-svg-with-png-fallback/
-func (exe *executablePNGConverter) IncludeFallbackImage(attributes string, content string, width float64, height float64) string {
-	if !strings.Contains(attributes, "width=") {
-		attributes = fmt.Sprintf(` width="%.f" height="%.f"%s`, width, height, attributes)
-	}
-	svgString := fmt.Sprintf(`<svg %s>%s</svg>`, attributes, content)
-	png, err := exe.Convert([]byte(svgString))
-	pngString := "<p>Unsupported Browser</p>"
-	if err == nil {
-		pngString = fmt.Sprintf(`<img alt="Fallback map image for older browsers" src="data:image/png;base64,%s" />`, string(png))
-	} else {
+func (exe *executablePNGConverter) IncludeFallbackImage(attributes string, content string, width float64, height float64, alt string) string {
+	png, err := exe.Convert([]byte(FallbackImageSVG(attributes, content, width, height, 1)))
+	if err != nil {
 		log.Error(err, log.Data{"_message": "Unable to include fallback png"})
 	}
-	svgString = fmt.Sprintf(svgSwitchTemplate, attributes, content, pngString)
-	return svgString
+	return SVGWithFallbackImage(attributes, content, width, height, png, alt)
+}
+
+// FallbackImageSVG returns the svg that is converted to png to create a fallback image for an svg with the given attributes and content.
+// The png is drawn at the given scale - e.g. 0.5 for an image half the width and height of the svg (whose width and height are given
+// in case the attributes don't include them).
+func FallbackImageSVG(attributes string, content string, width float64, height float64, scale float64) string {
+	return fmt.Sprintf(`<svg %s>%s</svg>`, scaledAttributes(attributes, width, height, scale), content)
+}
+
+// SVGWithFallbackImage returns an svg with the given attributes and content, and the base64-encoded png as a fallback image
+// for browsers that don't support svg, with the given alt text (or DefaultFallbackAlt if empty).
+// If png is empty (e.g. because the conversion failed), FallbackErrorText is used instead.
+func SVGWithFallbackImage(attributes string, content string, width float64, height float64, png []byte, alt string) string {
+	pngString := FallbackErrorText
+	if len(alt) == 0 {
+		alt = DefaultFallbackAlt
+	}
+	if len(png) > 0 {
+		pngString = fmt.Sprintf(`<img alt="%s" src="data:image/png;base64,%s" />`, htmlutil.EscapeAttr(alt), string(png))
+	}
+	return fmt.Sprintf(svgSwitchTemplate, scaledAttributes(attributes, width, height, 1), content, pngString)
+}
+
+// scaledAttributes returns the svg attributes with width and height for the given scale. At any scale other than 1, existing width and
+// height attributes are replaced and a viewBox is added (if there isn't one) so that the content is scaled too.
+func scaledAttributes(attributes string, width float64, height float64, scale float64) string {
+	if scale == 1 && strings.Contains(attributes, "width=") {
+		return attributes
+	}
+	attributes = strings.TrimSpace(attributes)
+	if scale != 1 {
+		attributes = strings.TrimSpace(sizeAttributePattern.ReplaceAllString(attributes, ""))
+		if !strings.Contains(attributes, "viewBox=") {
+			attributes = strings.TrimSpace(fmt.Sprintf(`viewBox="0 0 %g %g" %s`, width, height, attributes))
+		}
+	}
+	return strings.TrimSpace(fmt.Sprintf(`width="%.f" height="%.f" %s`, width*scale, height*scale, attributes))
 }
 
 // randomString creates a random string of length n consisting of upper and lowercase letters
@@ -31,3 +31,31 @@ func Test_ConvertShouldInvokeExecutableAndBase64EncodeTheResult(t *testing.T) {
 		So(string(result), ShouldResemble, base64.StdEncoding.EncodeToString([]byte("MySVG")))
 	})
 }
+
+func Test_FallbackImageSVGShouldBeScaled(t *testing.T) {
+	Convey("The svg converted to png should have the width and height of the given scale", t, func() {
+
+		So(geojson2svg.FallbackImageSVG(`id="map"`, "<path/>", 400, 300, 1), ShouldEqual, `<svg width="400" height="300" id="map"><path/></svg>`)
+		So(geojson2svg.FallbackImageSVG(`id="map" viewBox="0 0 400 300" width="400" height="300"`, "<path/>", 400, 300, 1),
+			ShouldEqual, `<svg id="map" viewBox="0 0 400 300" width="400" height="300"><path/></svg>`)
+		So(geojson2svg.FallbackImageSVG(`id="map" viewBox="0 0 400 300" width="400" height="300" style="stroke-width: 1"`, "<path/>", 400, 300, 0.5),
+			ShouldEqual, `<svg width="200" height="150" id="map" viewBox="0 0 400 300" style="stroke-width: 1"><path/></svg>`)
+		So(geojson2svg.FallbackImageSVG(` width="400" height="300"`, "<path/>", 400, 300, 0.25),
+			ShouldEqual, `<svg width="100" height="75" viewBox="0 0 400 300"><path/></svg>`)
+	})
+}
+
+func Test_SVGWithFallbackImage(t *testing.T) {
+	Convey("The svg should include the png as a fallback image, or the error text if there is no png", t, func() {
+
+		result := geojson2svg.SVGWithFallbackImage(`id="map"`, "<path/>", 400, 300, []byte("cG5n"), "")
+		So(result, ShouldStartWith, `<svg width="400" height="300" id="map">`)
+		So(result, ShouldContainSubstring, `<foreignObject><img alt="Fallback map image for older browsers" src="data:image/png;base64,cG5n" /></foreignObject>`)
+
+		result = geojson2svg.SVGWithFallbackImage(`id="map"`, "<path/>", 400, 300, []byte("cG5n"), `Map: "A & B", with values from 1 to 2`)
+		So(result, ShouldContainSubstring, `<foreignObject><img alt="Map: &#34;A &amp; B&#34;, with values from 1 to 2" src="data:image/png;base64,cG5n" /></foreignObject>`)
+
+		result = geojson2svg.SVGWithFallbackImage(`id="map"`, "<path/>", 400, 300, nil, "Map")
+		So(result, ShouldContainSubstring, `<foreignObject>`+geojson2svg.FallbackErrorText+`</foreignObject>`)
+	})
+}
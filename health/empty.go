@@ -9,11 +9,12 @@ import (
 
 type healthResponse struct {
 	Status string `json:"status"`
+	BuildInfo
 }
 
-// EmptyHealthcheck is responsible for returning the (empty) health status to the user
+// EmptyHealthcheck is responsible for returning the (empty) health status, and the build information, to the user
 func EmptyHealthcheck(w http.ResponseWriter, req *http.Request) {
-	var healthStateInfo healthResponse
+	healthStateInfo := healthResponse{BuildInfo: Build()}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// Readiness statuses
+const (
+	StatusOK       = "OK"
+	StatusFailing  = "FAILING"
+	StatusStarting = "STARTING"
+)
+
+// SelfTest periodically runs a check (e.g. rendering a map from start to finish), recording the duration (see RecordTime)
+// and the result, which determines the readiness of the service. A SelfTest never runs its check concurrently with itself.
+type SelfTest struct {
+	name     string
+	check    func() error
+	interval time.Duration
+	running  int32 // 1 while the check is running
+	mutex    sync.RWMutex
+	status   SelfTestStatus
+}
+
+// SelfTestStatus is the result of the most recent run of a SelfTest
+type SelfTestStatus struct {
+	Status   string        `json:"status"`
+	LastRun  *time.Time    `json:"last_run,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// NewSelfTest creates a SelfTest that runs the check every interval once started. The name is used to record the duration of the check.
+func NewSelfTest(name string, check func() error, interval time.Duration) *SelfTest {
+	return &SelfTest{name: name, check: check, interval: interval, status: SelfTestStatus{Status: StatusStarting}}
+}
+
+// Start runs the check immediately, then every interval (which must be positive), until the context is cancelled.
+// It returns a channel that is closed once the self test has stopped (after any check in progress has finished).
+func (s *SelfTest) Start(ctx context.Context) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.Run()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return stopped
+}
+
+// Run runs the check once and records the result - unless the check is already running, in which case it returns false immediately
+func (s *SelfTest) Run() bool {
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		return false
+	}
+	defer atomic.StoreInt32(&s.running, 0)
+
+	start := time.Now()
+	err := s.check()
+	duration := time.Since(start)
+	RecordTime(s.name, duration)
+
+	status := SelfTestStatus{Status: StatusOK, LastRun: &start, Duration: duration}
+	if err != nil {
+		status.Status = StatusFailing
+		status.Error = err.Error()
+	}
+
+	s.mutex.Lock()
+	previous := s.status.Status
+	s.status = status
+	s.mutex.Unlock()
+
+	if status.Status != previous {
+		data := log.Data{"self_test": s.name, "status": status.Status, "previous_status": previous, "duration": duration.String()}
+		if err != nil {
+			log.Error(err, data)
+		} else {
+			log.Info("self test status changed", data)
+		}
+	}
+	return true
+}
+
+// Status returns the result of the most recent run of the check
+func (s *SelfTest) Status() SelfTestStatus {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.status
+}
+
+// selfTest determines the readiness of the service - nil if there is no self test, in which case the service is always ready
+var selfTest *SelfTest
+
+// UseSelfTest assigns the SelfTest that determines the readiness of the service
+func UseSelfTest(s *SelfTest) {
+	selfTest = s
+}
+
+type readinessResponse struct {
+	Status   string          `json:"status"`
+	SelfTest *SelfTestStatus `json:"self_test,omitempty"`
+}
+
+// Readiness reports whether the service is ready to render maps - i.e. whether the most recent self test succeeded.
+// Responds with 200 if it is, and 503 if the self test failed or has not yet run.
+func Readiness(w http.ResponseWriter, req *http.Request) {
+	response := readinessResponse{Status: StatusOK}
+	if selfTest != nil {
+		status := selfTest.Status()
+		response.Status, response.SelfTest = status.Status, &status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status == StatusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.ErrorC("marshal json", err, log.Data{"struct": response})
+		return
+	}
+	if _, err = w.Write(responseJSON); err != nil {
+		log.ErrorC("writing json body", err, log.Data{"json": string(responseJSON)})
+	}
+}
@@ -0,0 +1,136 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/health"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSelfTestRun(t *testing.T) {
+
+	Convey("A self test that has not run should be starting", t, func() {
+		selfTest := health.NewSelfTest("test_starting", func() error { return nil }, time.Minute)
+		So(selfTest.Status().Status, ShouldEqual, health.StatusStarting)
+		So(selfTest.Status().LastRun, ShouldBeNil)
+	})
+
+	Convey("Run should record the result and duration of the check", t, func() {
+		var err error
+		selfTest := health.NewSelfTest("test_run", func() error { return err }, time.Minute)
+
+		So(selfTest.Run(), ShouldBeTrue)
+		So(selfTest.Status().Status, ShouldEqual, health.StatusOK)
+		So(selfTest.Status().LastRun, ShouldNotBeNil)
+		So(selfTest.Status().Error, ShouldBeEmpty)
+
+		err = errors.New("failed")
+		So(selfTest.Run(), ShouldBeTrue)
+		So(selfTest.Status().Status, ShouldEqual, health.StatusFailing)
+		So(selfTest.Status().Error, ShouldEqual, "failed")
+
+		count := int64(0)
+		for _, s := range health.Snapshot() {
+			if s.Name == "test_run" {
+				count = s.Count
+			}
+		}
+		So(count, ShouldEqual, 2)
+	})
+
+	Convey("Run should not run the check if it is already running", t, func() {
+		release := make(chan struct{})
+		var runs int32
+		selfTest := health.NewSelfTest("test_concurrent", func() error {
+			atomic.AddInt32(&runs, 1)
+			<-release
+			return nil
+		}, time.Minute)
+
+		done := make(chan bool)
+		go func() { done <- selfTest.Run() }()
+		for atomic.LoadInt32(&runs) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		So(selfTest.Run(), ShouldBeFalse)
+		close(release)
+		So(<-done, ShouldBeTrue)
+		So(atomic.LoadInt32(&runs), ShouldEqual, 1)
+	})
+}
+
+func TestSelfTestStart(t *testing.T) {
+
+	Convey("Start should run the check every interval until cancelled", t, func() {
+		var runs int32
+		selfTest := health.NewSelfTest("test_start", func() error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		}, time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := selfTest.Start(ctx)
+		for atomic.LoadInt32(&runs) < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		<-stopped
+
+		runsWhenStopped := atomic.LoadInt32(&runs)
+		time.Sleep(10 * time.Millisecond)
+		So(atomic.LoadInt32(&runs), ShouldEqual, runsWhenStopped)
+	})
+}
+
+func TestReadiness(t *testing.T) {
+
+	Convey("The service should be ready if there is no self test", t, func() {
+		health.UseSelfTest(nil)
+
+		w := httptest.NewRecorder()
+		health.Readiness(w, httptest.NewRequest("GET", "/ready", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldEqual, `{"status":"OK"}`)
+	})
+
+	Convey("Readiness should report the status of the self test", t, func() {
+		var err error
+		selfTest := health.NewSelfTest("test_readiness", func() error { return err }, time.Minute)
+		health.UseSelfTest(selfTest)
+		defer health.UseSelfTest(nil)
+
+		w := httptest.NewRecorder()
+		health.Readiness(w, httptest.NewRequest("GET", "/ready", nil))
+		So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+		selfTest.Run()
+		w = httptest.NewRecorder()
+		health.Readiness(w, httptest.NewRequest("GET", "/ready", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		err = errors.New("png conversion failed")
+		selfTest.Run()
+		w = httptest.NewRecorder()
+		health.Readiness(w, httptest.NewRequest("GET", "/ready", nil))
+		So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+		var response struct {
+			Status   string `json:"status"`
+			SelfTest struct {
+				Error string `json:"error"`
+			} `json:"self_test"`
+		}
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response.Status, ShouldEqual, health.StatusFailing)
+		So(response.SelfTest.Error, ShouldEqual, "png conversion failed")
+	})
+}
@@ -0,0 +1,155 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// sampleSize is the number of recent durations kept for each name, from which percentiles are calculated
+const sampleSize = 1024
+
+// Recorder records the durations of named operations - the count, total, minimum and maximum of all durations,
+// and the most recent durations (see sampleSize), from which percentiles are calculated.
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	mutex   sync.Mutex
+	timings map[string]*timing
+}
+
+type timing struct {
+	count   int64
+	total   time.Duration
+	min     time.Duration
+	max     time.Duration
+	samples []time.Duration // a ring buffer of the most recent durations
+	next    int             // the index in samples of the next duration, once samples is full
+}
+
+// TimingSnapshot summarises the durations recorded with a name
+type TimingSnapshot struct {
+	Name  string        `json:"name"`
+	Count int64         `json:"count"`
+	Total time.Duration `json:"total"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"` // the percentiles are of the most recent durations only
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+}
+
+// NewRecorder creates an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{timings: make(map[string]*timing)}
+}
+
+// Record records a duration with the given name
+func (r *Recorder) Record(name string, d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	t, ok := r.timings[name]
+	if !ok {
+		t = &timing{min: d, max: d}
+		r.timings[name] = t
+	}
+	t.count++
+	t.total += d
+	if d < t.min {
+		t.min = d
+	}
+	if d > t.max {
+		t.max = d
+	}
+	if len(t.samples) < sampleSize {
+		t.samples = append(t.samples, d)
+	} else {
+		t.samples[t.next] = d
+		t.next = (t.next + 1) % sampleSize
+	}
+}
+
+// Snapshot returns a summary of the durations recorded for each name, sorted by name
+func (r *Recorder) Snapshot() []TimingSnapshot {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := make([]TimingSnapshot, 0, len(r.timings))
+	for name, t := range r.timings {
+		samples := make([]time.Duration, len(t.samples))
+		copy(samples, t.samples)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		result = append(result, TimingSnapshot{
+			Name:  name,
+			Count: t.count,
+			Total: t.total,
+			Min:   t.min,
+			Max:   t.max,
+			Mean:  t.total / time.Duration(t.count),
+			P50:   percentile(samples, 50),
+			P90:   percentile(samples, 90),
+			P99:   percentile(samples, 99),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Reset removes all recorded durations
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.timings = make(map[string]*timing)
+}
+
+// percentile returns the p'th percentile of the sorted durations, using the nearest-rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // i.e. ceil(p/100 * n)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// timings is the Recorder used by RecordTime, TrackTime, LogTime and Snapshot
+var timings = NewRecorder()
+
+// RecordTime records a duration with the given name
+func RecordTime(name string, d time.Duration) {
+	timings.Record(name, d)
+}
+
+// TrackTime records the time elapsed since start with the given name - e.g. defer health.TrackTime(time.Now(), "render")
+func TrackTime(start time.Time, name string) {
+	timings.Record(name, time.Since(start))
+}
+
+// Snapshot returns a summary of the durations recorded by RecordTime and TrackTime, sorted by name
+func Snapshot() []TimingSnapshot {
+	return timings.Snapshot()
+}
+
+// LogTime logs a summary of the durations recorded by RecordTime and TrackTime
+func LogTime() {
+	for _, s := range timings.Snapshot() {
+		log.Info("timing", log.Data{
+			"name":     s.Name,
+			"count":    s.Count,
+			"total_ms": milliseconds(s.Total),
+			"min_ms":   milliseconds(s.Min),
+			"max_ms":   milliseconds(s.Max),
+			"mean_ms":  milliseconds(s.Mean),
+			"p50_ms":   milliseconds(s.P50),
+			"p90_ms":   milliseconds(s.P90),
+			"p99_ms":   milliseconds(s.P99),
+		})
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
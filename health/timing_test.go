@@ -0,0 +1,102 @@
+package health_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/health"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecorderSnapshot(t *testing.T) {
+
+	Convey("An empty Recorder should have an empty snapshot", t, func() {
+		So(health.NewRecorder().Snapshot(), ShouldBeEmpty)
+	})
+
+	Convey("The snapshot should summarise the durations recorded for each name, sorted by name", t, func() {
+		r := health.NewRecorder()
+		for i := 100; i >= 1; i-- {
+			r.Record("render", time.Duration(i)*time.Millisecond)
+		}
+		r.Record("analyse", 5*time.Millisecond)
+
+		snapshot := r.Snapshot()
+		So(len(snapshot), ShouldEqual, 2)
+		So(snapshot[0], ShouldResemble, health.TimingSnapshot{
+			Name: "analyse", Count: 1, Total: 5 * time.Millisecond, Min: 5 * time.Millisecond, Max: 5 * time.Millisecond,
+			Mean: 5 * time.Millisecond, P50: 5 * time.Millisecond, P90: 5 * time.Millisecond, P99: 5 * time.Millisecond,
+		})
+		So(snapshot[1], ShouldResemble, health.TimingSnapshot{
+			Name: "render", Count: 100, Total: 5050 * time.Millisecond, Min: time.Millisecond, Max: 100 * time.Millisecond,
+			Mean: 50500 * time.Microsecond, P50: 50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond,
+		})
+	})
+
+	Convey("Percentiles should be calculated from the most recent durations only", t, func() {
+		r := health.NewRecorder()
+		for i := 0; i < 2000; i++ {
+			r.Record("render", time.Second)
+		}
+		for i := 0; i < 2000; i++ {
+			r.Record("render", time.Millisecond)
+		}
+
+		snapshot := r.Snapshot()
+		So(snapshot[0].Count, ShouldEqual, 4000)
+		So(snapshot[0].Max, ShouldEqual, time.Second)
+		So(snapshot[0].P99, ShouldEqual, time.Millisecond)
+	})
+
+	Convey("Reset should remove all recorded durations", t, func() {
+		r := health.NewRecorder()
+		r.Record("render", time.Millisecond)
+		r.Reset()
+		So(r.Snapshot(), ShouldBeEmpty)
+	})
+}
+
+func TestRecorderIsSafeForConcurrentUse(t *testing.T) {
+
+	Convey("Durations recorded concurrently should all be counted", t, func() {
+		r := health.NewRecorder()
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					r.Record(fmt.Sprintf("name%d", i%4), time.Duration(i)*time.Microsecond)
+					if i%50 == 0 {
+						r.Snapshot()
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		snapshot := r.Snapshot()
+		So(len(snapshot), ShouldEqual, 4)
+		for _, s := range snapshot {
+			So(s.Count, ShouldEqual, 1000)
+		}
+	})
+}
+
+func TestTrackTime(t *testing.T) {
+
+	Convey("TrackTime should record the time elapsed since the start", t, func() {
+		health.TrackTime(time.Now().Add(-10*time.Millisecond), "test_track_time")
+
+		var found health.TimingSnapshot
+		for _, s := range health.Snapshot() {
+			if s.Name == "test_track_time" {
+				found = s
+			}
+		}
+		So(found.Count, ShouldEqual, 1)
+		So(found.Min, ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,51 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// Build information, set at build time using ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/ONSdigital/dp-map-renderer/health.Version=1.2.0 -X github.com/ONSdigital/dp-map-renderer/health.GitCommit=$(git rev-parse HEAD)"
+//
+// (see the Makefile). Their defaults identify a build that did not set them.
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// BuildInfo describes the build of the service
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// Build returns the build information of the service
+func Build() BuildInfo {
+	return BuildInfo{Version: Version, GitCommit: GitCommit, BuildDate: BuildDate}
+}
+
+// ServerHeader returns the value of the Server response header - the name and version of the service
+func ServerHeader() string {
+	return "dp-map-renderer/" + Version
+}
+
+// VersionHandler returns the build information of the service
+func VersionHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	buildJSON, err := json.Marshal(Build())
+	if err != nil {
+		log.ErrorC("marshal json", err, log.Data{"struct": Build()})
+		return
+	}
+	if _, err = w.Write(buildJSON); err != nil {
+		log.ErrorC("writing json body", err, log.Data{"json": string(buildJSON)})
+	}
+}
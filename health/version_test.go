@@ -0,0 +1,53 @@
+package health_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/health"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBuildDefaults(t *testing.T) {
+
+	Convey("Without build information set at build time, the build should be identified as a development build", t, func() {
+		So(health.Build(), ShouldResemble, health.BuildInfo{Version: "dev", GitCommit: "unknown", BuildDate: "unknown"})
+		So(health.ServerHeader(), ShouldEqual, "dp-map-renderer/dev")
+	})
+}
+
+func TestBuildInformationIsReported(t *testing.T) {
+	defer func(version, commit, date string) {
+		health.Version, health.GitCommit, health.BuildDate = version, commit, date
+	}(health.Version, health.GitCommit, health.BuildDate)
+	health.Version, health.GitCommit, health.BuildDate = "1.2.0", "3e2d52a", "2018-06-01T12:00:00Z"
+
+	expected := health.BuildInfo{Version: "1.2.0", GitCommit: "3e2d52a", BuildDate: "2018-06-01T12:00:00Z"}
+
+	Convey("The version endpoint should return the build information", t, func() {
+		w := httptest.NewRecorder()
+		health.VersionHandler(w, httptest.NewRequest("GET", "/version", nil))
+
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+		var build health.BuildInfo
+		So(json.Unmarshal(w.Body.Bytes(), &build), ShouldBeNil)
+		So(build, ShouldResemble, expected)
+	})
+
+	Convey("The healthcheck should include the build information", t, func() {
+		w := httptest.NewRecorder()
+		health.EmptyHealthcheck(w, httptest.NewRequest("GET", "/healthcheck", nil))
+
+		So(w.Code, ShouldEqual, http.StatusOK)
+		var response map[string]string
+		So(json.Unmarshal(w.Body.Bytes(), &response), ShouldBeNil)
+		So(response, ShouldResemble, map[string]string{"status": "OK", "version": "1.2.0", "git_commit": "3e2d52a", "build_date": "2018-06-01T12:00:00Z"})
+	})
+
+	Convey("The server header should include the version", t, func() {
+		So(health.ServerHeader(), ShouldEqual, "dp-map-renderer/1.2.0")
+	})
+}
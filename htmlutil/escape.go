@@ -0,0 +1,79 @@
+package htmlutil
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EscapeText escapes the text for inclusion as the content of an html or svg element.
+// Ampersands and angle brackets are replaced with entities, control characters (other than tab, newline and carriage return) are removed,
+// and invalid utf-8 is replaced with the unicode replacement character. All other characters, including non-ASCII, are unchanged.
+func EscapeText(text string) string {
+	return escape(text, false)
+}
+
+// EscapeAttr escapes the value for inclusion in a (single or double) quoted attribute of an html or svg element.
+// As well as the characters escaped by EscapeText, quotes are replaced with entities, and tab, newline and carriage return are replaced
+// with character references, so that they are not normalised to spaces when the attribute is parsed.
+func EscapeAttr(value string) string {
+	return escape(value, true)
+}
+
+// SanitizeText removes the characters from the text that EscapeText would remove, and replaces invalid utf-8, but does not replace any
+// characters with entities - for text that is escaped when it is rendered, e.g. the data of an html.Node.
+func SanitizeText(text string) string {
+	var b bytes.Buffer
+	for _, r := range text {
+		if r == '\t' || r == '\n' || r == '\r' || !unicode.IsControl(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func escape(s string, attr bool) string {
+	var b bytes.Buffer
+	for _, r := range s { // invalid utf-8 is decoded as unicode.ReplacementChar
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"' && attr:
+			b.WriteString("&#34;")
+		case r == '\'' && attr:
+			b.WriteString("&#39;")
+		case r == '\t' && attr:
+			b.WriteString("&#9;")
+		case r == '\n' && attr:
+			b.WriteString("&#10;")
+		case r == '\r' && attr:
+			b.WriteString("&#13;")
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+			// removed - control characters are not allowed in xml
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// SanitizeIdentifier makes the value safe for use as an id or class name in html, svg and css (without the need for escaping),
+// by replacing every character other than an ASCII letter, digit, hyphen or underscore with an underscore.
+// Each non-ASCII character is replaced with a single underscore.
+func SanitizeIdentifier(value string) string {
+	var b bytes.Buffer
+	for _, r := range value {
+		if r < utf8.RuneSelf && (r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package htmlutil_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	. "github.com/ONSdigital/dp-map-renderer/htmlutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// payloads are the usual attempts to break out of markup, with the expected results of EscapeText, EscapeAttr and SanitizeIdentifier
+var payloads = []struct {
+	input, text, attr, identifier string
+}{
+	{"", "", "", ""},
+	{"plain", "plain", "plain", "plain"},
+	{"Fish & Chips", "Fish &amp; Chips", "Fish &amp; Chips", "Fish___Chips"},
+	{"&amp;", "&amp;amp;", "&amp;amp;", "_amp_"},
+	{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;", "&lt;script&gt;alert(1)&lt;/script&gt;", "_script_alert_1___script_"},
+	{`" onmouseover="alert(1)`, `" onmouseover="alert(1)`, "&#34; onmouseover=&#34;alert(1)", "__onmouseover__alert_1_"},
+	{`' onload='alert(1)`, `' onload='alert(1)`, "&#39; onload=&#39;alert(1)", "__onload__alert_1_"},
+	{`"><svg onload=alert(1)>`, `"&gt;&lt;svg onload=alert(1)&gt;`, "&#34;&gt;&lt;svg onload=alert(1)&gt;", "___svg_onload_alert_1__"},
+	{"]]><![CDATA[x", "]]&gt;&lt;![CDATA[x", "]]&gt;&lt;![CDATA[x", "______CDATA_x"},
+	{"<!-- comment -->", "&lt;!-- comment --&gt;", "&lt;!-- comment --&gt;", "__--_comment_--_"},
+	{"line\tone\r\nline two", "line\tone\r\nline two", "line&#9;one&#13;&#10;line two", "line_one__line_two"},
+	{"null\x00bell\x07del\x7fc1\u0085", "nullbelldelc1", "nullbelldelc1", "null_bell_del_c1_"},
+	{"Caerdydd ŵ ŷ – “quoted” 10°", "Caerdydd ŵ ŷ – “quoted” 10°", "Caerdydd ŵ ŷ – “quoted” 10°", "Caerdydd________quoted__10_"},
+	{"invalid \xff utf-8", "invalid � utf-8", "invalid � utf-8", "invalid___utf-8"},
+	{"valid_id-123", "valid_id-123", "valid_id-123", "valid_id-123"},
+}
+
+func TestEscapeText(t *testing.T) {
+
+	Convey("EscapeText escapes ampersands and angle brackets, and removes control characters", t, func() {
+		for _, p := range payloads {
+			So(EscapeText(p.input), ShouldEqual, p.text)
+		}
+	})
+
+	Convey("Escaped text is parsed back to the original text, without any markup", t, func() {
+		for _, p := range payloads {
+			if strings.ContainsAny(p.input, "\x00\x07\x7f\u0085\xff") {
+				continue
+			}
+			var parsed struct {
+				Text string `xml:",chardata"`
+			}
+			err := xml.Unmarshal([]byte("<text>"+EscapeText(p.input)+"</text>"), &parsed)
+			So(err, ShouldBeNil)
+			So(parsed.Text, ShouldEqual, strings.Replace(p.input, "\r\n", "\n", -1))
+		}
+	})
+}
+
+func TestEscapeAttr(t *testing.T) {
+
+	Convey("EscapeAttr escapes quotes, ampersands, angle brackets and whitespace, and removes control characters", t, func() {
+		for _, p := range payloads {
+			So(EscapeAttr(p.input), ShouldEqual, p.attr)
+		}
+	})
+
+	Convey("An escaped attribute value is parsed back to the original value, without adding any attributes", t, func() {
+		for _, p := range payloads {
+			if strings.ContainsAny(p.input, "\x00\x07\x7f\u0085\xff") {
+				continue
+			}
+			for _, quote := range []string{`"`, `'`} {
+				var parsed struct {
+					Title string     `xml:"title,attr"`
+					Other []xml.Attr `xml:",any,attr"`
+				}
+				err := xml.Unmarshal([]byte("<text title="+quote+EscapeAttr(p.input)+quote+"></text>"), &parsed)
+				So(err, ShouldBeNil)
+				So(parsed.Title, ShouldEqual, p.input)
+				So(parsed.Other, ShouldBeEmpty)
+			}
+		}
+	})
+}
+
+func TestSanitizeText(t *testing.T) {
+
+	Convey("SanitizeText removes the same characters as EscapeText, without replacing any with entities", t, func() {
+		for _, p := range payloads {
+			sanitized := SanitizeText(p.input)
+			So(EscapeText(sanitized), ShouldEqual, p.text)
+			So(strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(p.text), ShouldEqual, sanitized)
+		}
+	})
+}
+
+func TestSanitizeIdentifier(t *testing.T) {
+
+	Convey("SanitizeIdentifier replaces every character other than an ASCII letter, digit, hyphen or underscore with an underscore", t, func() {
+		for _, p := range payloads {
+			So(SanitizeIdentifier(p.input), ShouldEqual, p.identifier)
+		}
+	})
+}
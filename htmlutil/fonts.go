@@ -0,0 +1,177 @@
+package htmlutil
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultFontSize is the font size (in pixels) used when none is given - the default font size on the ons site
+const defaultFontSize = 14.0
+
+// TextMeasurer measures the width of text rendered in a particular font
+type TextMeasurer interface {
+	// TextWidth returns the width (in pixels) of the text at the given font size
+	TextWidth(text string, fontSize int) float64
+}
+
+// tableMeasurer approximates the width of text using the characterWidths table
+type tableMeasurer struct{}
+
+// TextWidth returns the approximate width of the text, allowing for some spacing between letters and assuming that unknown characters are of average width
+func (tableMeasurer) TextWidth(text string, fontSize int) float64 {
+	size := 0.0
+	fSize := fontSizeOrDefault(fontSize)
+	for _, runeValue := range text {
+		size += approximateRuneWidth(runeValue, fSize)
+	}
+	return size
+}
+
+// unknownCharacterWidth is the relative size assumed for characters that are not in characterWidths - the average of the known widths
+var unknownCharacterWidth = averageCharacterWidth()
+
+// averageCharacterWidth returns the average of the widths in characterWidths - summed in order, so that the result is always the same
+func averageCharacterWidth() float64 {
+	widths := make([]float64, 0, len(characterWidths))
+	for _, width := range characterWidths {
+		widths = append(widths, width)
+	}
+	sort.Float64s(widths)
+	total := 0.0
+	for _, width := range widths {
+		total += width
+	}
+	return total / float64(len(widths))
+}
+
+// approximateRuneWidth returns the width of the rune according to the characterWidths table, plus the spacing between letters
+func approximateRuneWidth(r rune, fSize float64) float64 {
+	spacing := SpaceBetweenCharacters * fSize
+	runeSize, ok := characterWidths[r]
+	if !ok {
+		runeSize = unknownCharacterWidth
+	}
+	return fSize*runeSize + spacing
+}
+
+func fontSizeOrDefault(fontSize int) float64 {
+	if fontSize == 0 {
+		return defaultFontSize
+	}
+	return float64(fontSize)
+}
+
+// FontMetrics is a TextMeasurer that uses the advance widths (and kerning) of the glyphs in a TrueType or OpenType font.
+// Characters that are not in the font are measured using the characterWidths table.
+type FontMetrics struct {
+	font *sfnt.Font
+}
+
+// NewFontMetrics parses the given TrueType (or OpenType) font
+func NewFontMetrics(ttf []byte) (*FontMetrics, error) {
+	f, err := sfnt.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+	return &FontMetrics{font: f}, nil
+}
+
+// LoadFontMetrics reads and parses the TrueType (or OpenType) font in the given file
+func LoadFontMetrics(filename string) (*FontMetrics, error) {
+	ttf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewFontMetrics(ttf)
+}
+
+// FamilyName returns the name of the font family, as given in the font - or an empty string if it has no family name
+func (m *FontMetrics) FamilyName() string {
+	var b sfnt.Buffer
+	name, err := m.font.Name(&b, sfnt.NameIDFamily)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// TextWidth returns the width of the text - the sum of the advance widths of its glyphs, adjusted by the kerning between them
+func (m *FontMetrics) TextWidth(text string, fontSize int) float64 {
+	var b sfnt.Buffer
+	fSize := fontSizeOrDefault(fontSize)
+	ppem := fixed.Int26_6(fSize * 64)
+	width := fixed.Int26_6(0)
+	fallback := 0.0
+	var previous sfnt.GlyphIndex
+	for _, r := range text {
+		glyph, err := m.font.GlyphIndex(&b, r)
+		if err == nil && glyph != 0 {
+			var advance fixed.Int26_6
+			advance, err = m.font.GlyphAdvance(&b, glyph, ppem, font.HintingNone)
+			if err == nil {
+				if previous != 0 {
+					if kern, err := m.font.Kern(&b, previous, glyph, ppem, font.HintingNone); err == nil {
+						width += kern
+					}
+				}
+				width += advance
+				previous = glyph
+				continue
+			}
+		}
+		// the character isn't in the font
+		fallback += approximateRuneWidth(r, fSize)
+		previous = 0
+	}
+	return float64(width)/64 + fallback
+}
+
+// defaultMeasurer is used by GetApproximateTextWidth, and for any font family that does not have a measurer of its own
+var defaultMeasurer TextMeasurer = tableMeasurer{}
+
+// measurers contains the TextMeasurer for each font family, keyed by the lower case family name
+var measurers = map[string]TextMeasurer{}
+
+// UseTextMeasurer assigns the TextMeasurer used to measure text in the given font family (matched case-insensitively).
+// An empty font family assigns the default measurer. A nil measurer removes the font family's measurer, or restores the characterWidths table as the default.
+func UseTextMeasurer(fontFamily string, measurer TextMeasurer) {
+	key := normaliseFontFamily(fontFamily)
+	if len(key) == 0 {
+		if measurer == nil {
+			measurer = tableMeasurer{}
+		}
+		defaultMeasurer = measurer
+		return
+	}
+	if measurer == nil {
+		delete(measurers, key)
+		return
+	}
+	measurers[key] = measurer
+}
+
+// GetTextMeasurer returns the TextMeasurer for the first font family in the given (css font-family style, comma-separated) list that has one,
+// or the default measurer if none do
+func GetTextMeasurer(fontFamily string) TextMeasurer {
+	for _, family := range strings.Split(fontFamily, ",") {
+		if measurer, ok := measurers[normaliseFontFamily(family)]; ok {
+			return measurer
+		}
+	}
+	return defaultMeasurer
+}
+
+// GetTextWidth returns the width of the given text (in pixels) in the given font family and size
+func GetTextWidth(text string, fontFamily string, fontSize int) float64 {
+	return GetTextMeasurer(fontFamily).TextWidth(text, fontSize)
+}
+
+// normaliseFontFamily removes any quotes and surrounding whitespace from the font family name, and converts it to lower case
+func normaliseFontFamily(fontFamily string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(fontFamily), `"'`))
+}
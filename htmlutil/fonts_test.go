@@ -0,0 +1,70 @@
+package htmlutil_test
+
+import (
+	"testing"
+
+	. "github.com/ONSdigital/dp-map-renderer/htmlutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// The advance widths (in font units, of 2048 per em) of some glyphs in the Go Regular font
+const (
+	goRegularA               = 1139
+	goRegularI               = 505
+	goRegularW               = 1933
+	goRegularWWithCircumflex = 1479
+	goRegularUnitsPerEm      = 2048.0
+)
+
+func TestFontMetrics(t *testing.T) {
+	metrics, err := NewFontMetrics(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("The width of text is the sum of the advance widths of its glyphs (to the nearest 1/64 of a pixel)", t, func() {
+		So(metrics.TextWidth("aiW", 2048), ShouldEqual, goRegularA+goRegularI+goRegularW)
+		So(metrics.TextWidth("aiW", 14), ShouldAlmostEqual, (goRegularA+goRegularI+goRegularW)*14/goRegularUnitsPerEm, 0.05)
+		So(metrics.TextWidth("aiW", 0), ShouldEqual, metrics.TextWidth("aiW", 14))
+	})
+
+	Convey("Characters with diacritics are measured using the font", t, func() {
+		So(metrics.TextWidth("ŵ", 2048), ShouldEqual, goRegularWWithCircumflex)
+	})
+
+	Convey("Characters that are not in the font are measured using the character width table", t, func() {
+		So(metrics.TextWidth("a日", 14), ShouldAlmostEqual, goRegularA*14/goRegularUnitsPerEm+GetApproximateTextWidth("日", 14), 0.05)
+	})
+
+	Convey("The family name is read from the font", t, func() {
+		So(metrics.FamilyName(), ShouldEqual, "Go")
+	})
+}
+
+func TestGetTextMeasurer(t *testing.T) {
+	metrics, err := NewFontMetrics(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseTextMeasurer("Go", metrics)
+	defer UseTextMeasurer("Go", nil)
+
+	Convey("The measurer for the first font family in the list that has one is returned", t, func() {
+		So(GetTextMeasurer(`"Open Sans", 'go', sans-serif`), ShouldEqual, metrics)
+		So(GetTextWidth("aiW", "GO", 14), ShouldEqual, metrics.TextWidth("aiW", 14))
+	})
+
+	Convey("The default measurer is returned for an unknown font family", t, func() {
+		So(GetTextMeasurer("Helvetica, sans-serif"), ShouldResemble, GetTextMeasurer(""))
+		So(GetTextWidth("aiW", "", 14), ShouldEqual, GetApproximateTextWidth("aiW", 14))
+	})
+
+	Convey("A font may be used as the default measurer", t, func() {
+		UseTextMeasurer("", metrics)
+		defer UseTextMeasurer("", nil)
+
+		So(GetApproximateTextWidth("aiW", 14), ShouldEqual, metrics.TextWidth("aiW", 14))
+		So(GetTextMeasurer("Helvetica"), ShouldEqual, metrics)
+	})
+}
@@ -12,7 +12,8 @@ import (
 const SpaceBetweenCharacters = 0.0286
 
 // characterWidths contains the relative size of most ascii characters when rendered in a sans-serif font
-// the characterWidths map was generated using javascript - see charsizes.html in testdata
+// the ascii widths were generated using javascript - see charsizes.html in testdata.
+// The remaining widths are those of the equivalent Arial glyphs at 14px, rounded down to a whole pixel.
 var characterWidths = map[rune]float64{
 	'a':  0.500,
 	'b':  0.500,
@@ -108,6 +109,249 @@ var characterWidths = map[rune]float64{
 	'>':  0.571,
 	'?':  0.500,
 	' ':  0.286,
+	'|':  0.214,
+	'`':  0.286,
+	// Latin-1 supplement - accented letters are the width of the unaccented letter
+	'\u00a0': 0.286,
+	'¡':      0.286,
+	'¢':      0.500,
+	'¤':      0.500,
+	'¥':      0.500,
+	'¦':      0.214,
+	'§':      0.500,
+	'¨':      0.286,
+	'©':      0.714,
+	'ª':      0.357,
+	'«':      0.500,
+	'¬':      0.571,
+	'\u00ad': 0.286,
+	'®':      0.714,
+	'¯':      0.500,
+	'°':      0.357,
+	'±':      0.500,
+	'²':      0.286,
+	'³':      0.286,
+	'´':      0.286,
+	'µ':      0.571,
+	'¶':      0.500,
+	'·':      0.214,
+	'¸':      0.286,
+	'¹':      0.286,
+	'º':      0.357,
+	'»':      0.500,
+	'¼':      0.786,
+	'½':      0.786,
+	'¾':      0.786,
+	'¿':      0.571,
+	'À':      0.643,
+	'Á':      0.643,
+	'Â':      0.643,
+	'Ã':      0.643,
+	'Ä':      0.643,
+	'Å':      0.643,
+	'Æ':      1.000,
+	'Ç':      0.714,
+	'È':      0.643,
+	'É':      0.643,
+	'Ê':      0.643,
+	'Ë':      0.643,
+	'Ì':      0.286,
+	'Í':      0.286,
+	'Î':      0.286,
+	'Ï':      0.286,
+	'Ð':      0.714,
+	'Ñ':      0.714,
+	'Ò':      0.786,
+	'Ó':      0.786,
+	'Ô':      0.786,
+	'Õ':      0.786,
+	'Ö':      0.786,
+	'×':      0.571,
+	'Ø':      0.714,
+	'Ù':      0.714,
+	'Ú':      0.714,
+	'Û':      0.714,
+	'Ü':      0.714,
+	'Ý':      0.643,
+	'Þ':      0.643,
+	'ß':      0.571,
+	'à':      0.500,
+	'á':      0.500,
+	'â':      0.500,
+	'ã':      0.500,
+	'ä':      0.500,
+	'å':      0.500,
+	'æ':      0.857,
+	'ç':      0.500,
+	'è':      0.500,
+	'é':      0.500,
+	'ê':      0.500,
+	'ë':      0.500,
+	'ì':      0.214,
+	'í':      0.214,
+	'î':      0.214,
+	'ï':      0.214,
+	'ð':      0.500,
+	'ñ':      0.500,
+	'ò':      0.500,
+	'ó':      0.500,
+	'ô':      0.500,
+	'õ':      0.500,
+	'ö':      0.500,
+	'÷':      0.500,
+	'ø':      0.571,
+	'ù':      0.500,
+	'ú':      0.500,
+	'û':      0.500,
+	'ü':      0.500,
+	'ý':      0.500,
+	'þ':      0.500,
+	'ÿ':      0.500,
+	// Latin Extended-A (including the Welsh ŵ and ŷ)
+	'Ā': 0.643,
+	'ā': 0.500,
+	'Ă': 0.643,
+	'ă': 0.500,
+	'Ą': 0.643,
+	'ą': 0.500,
+	'Ć': 0.714,
+	'ć': 0.500,
+	'Ĉ': 0.714,
+	'ĉ': 0.500,
+	'Ċ': 0.714,
+	'ċ': 0.500,
+	'Č': 0.714,
+	'č': 0.500,
+	'Ď': 0.714,
+	'ď': 0.500,
+	'Đ': 0.714,
+	'đ': 0.500,
+	'Ē': 0.643,
+	'ē': 0.500,
+	'Ĕ': 0.643,
+	'ĕ': 0.500,
+	'Ė': 0.643,
+	'ė': 0.500,
+	'Ę': 0.643,
+	'ę': 0.500,
+	'Ě': 0.643,
+	'ě': 0.500,
+	'Ĝ': 0.786,
+	'ĝ': 0.500,
+	'Ğ': 0.786,
+	'ğ': 0.500,
+	'Ġ': 0.786,
+	'ġ': 0.500,
+	'Ģ': 0.786,
+	'ģ': 0.500,
+	'Ĥ': 0.714,
+	'ĥ': 0.500,
+	'Ħ': 0.714,
+	'ħ': 0.500,
+	'Ĩ': 0.286,
+	'ĩ': 0.214,
+	'Ī': 0.286,
+	'ī': 0.214,
+	'Ĭ': 0.286,
+	'ĭ': 0.214,
+	'Į': 0.286,
+	'į': 0.214,
+	'İ': 0.286,
+	'ı': 0.214,
+	'Ĳ': 0.714,
+	'ĳ': 0.429,
+	'Ĵ': 0.500,
+	'ĵ': 0.214,
+	'Ķ': 0.643,
+	'ķ': 0.500,
+	'ĸ': 0.500,
+	'Ĺ': 0.500,
+	'ĺ': 0.214,
+	'Ļ': 0.500,
+	'ļ': 0.214,
+	'Ľ': 0.500,
+	'ľ': 0.214,
+	'Ŀ': 0.500,
+	'ŀ': 0.286,
+	'Ł': 0.500,
+	'ł': 0.214,
+	'Ń': 0.714,
+	'ń': 0.500,
+	'Ņ': 0.714,
+	'ņ': 0.500,
+	'Ň': 0.714,
+	'ň': 0.500,
+	'ŉ': 0.571,
+	'Ŋ': 0.714,
+	'ŋ': 0.500,
+	'Ō': 0.786,
+	'ō': 0.500,
+	'Ŏ': 0.786,
+	'ŏ': 0.500,
+	'Ő': 0.786,
+	'ő': 0.500,
+	'Œ': 1.000,
+	'œ': 0.929,
+	'Ŕ': 0.714,
+	'ŕ': 0.286,
+	'Ŗ': 0.714,
+	'ŗ': 0.286,
+	'Ř': 0.714,
+	'ř': 0.286,
+	'Ś': 0.643,
+	'ś': 0.500,
+	'Ŝ': 0.643,
+	'ŝ': 0.500,
+	'Ş': 0.643,
+	'ş': 0.500,
+	'Š': 0.643,
+	'š': 0.500,
+	'Ţ': 0.571,
+	'ţ': 0.286,
+	'Ť': 0.571,
+	'ť': 0.286,
+	'Ŧ': 0.571,
+	'ŧ': 0.214,
+	'Ũ': 0.714,
+	'ũ': 0.500,
+	'Ū': 0.714,
+	'ū': 0.500,
+	'Ŭ': 0.714,
+	'ŭ': 0.500,
+	'Ů': 0.714,
+	'ů': 0.500,
+	'Ű': 0.714,
+	'ű': 0.500,
+	'Ų': 0.714,
+	'ų': 0.500,
+	'Ŵ': 0.929,
+	'ŵ': 0.714,
+	'Ŷ': 0.643,
+	'ŷ': 0.500,
+	'Ÿ': 0.643,
+	'Ź': 0.571,
+	'ź': 0.500,
+	'Ż': 0.571,
+	'ż': 0.500,
+	'Ž': 0.571,
+	'ž': 0.500,
+	'ſ': 0.214,
+	// punctuation, symbols and the spaces used to group digits
+	'–':      0.500,
+	'—':      1.000,
+	'‘':      0.214,
+	'’':      0.214,
+	'‚':      0.214,
+	'“':      0.286,
+	'”':      0.286,
+	'„':      0.286,
+	'…':      1.000,
+	'•':      0.286,
+	'€':      0.500,
+	'\u2009': 0.143,
+	'\u202f': 0.143,
+	'\u2007': 0.500,
+	'−':      0.571,
 }
 
 // CreateNode creates an html Node and sets attributes or adds child nodes according to the type of each value
@@ -165,6 +409,61 @@ func AppendAttribute(node *html.Node, key string, val string) {
 	node.Attr = append(attr, html.Attribute{Key: key, Val: newValue})
 }
 
+// JoinClasses returns the space-separated class list of all the given classes (each of which may itself be a list of classes),
+// with any duplicates removed - keeping the order in which each class first appears
+func JoinClasses(classes ...string) string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, c := range classes {
+		for _, class := range strings.Fields(c) {
+			if !seen[class] {
+				seen[class] = true
+				list = append(list, class)
+			}
+		}
+	}
+	return strings.Join(list, " ")
+}
+
+// AddClass adds each of the classes to the class list of the node, unless it is already present
+func AddClass(node *html.Node, classes ...string) {
+	setClass(node, JoinClasses(append([]string{GetAttribute(node, "class")}, classes...)...))
+}
+
+// RemoveClass removes each of the classes from the class list of the node, removing the class attribute if no classes remain
+func RemoveClass(node *html.Node, classes ...string) {
+	remove := make(map[string]bool)
+	for _, class := range strings.Fields(strings.Join(classes, " ")) {
+		remove[class] = true
+	}
+	var list []string
+	for _, class := range strings.Fields(GetAttribute(node, "class")) {
+		if !remove[class] {
+			list = append(list, class)
+		}
+	}
+	setClass(node, JoinClasses(list...))
+}
+
+// setClass replaces the value of the class attribute of the node (keeping its position), adding it if there is none,
+// or removes the attribute if the value is empty
+func setClass(node *html.Node, class string) {
+	var attr []html.Attribute
+	found := false
+	for _, a := range node.Attr {
+		if a.Key != "class" {
+			attr = append(attr, a)
+		} else if !found && len(class) > 0 {
+			found = true
+			attr = append(attr, html.Attribute{Key: "class", Val: class})
+		}
+	}
+	if !found && len(class) > 0 {
+		attr = append(attr, html.Attribute{Key: "class", Val: class})
+	}
+	node.Attr = attr
+}
+
 // Attr creates a new Attribute
 func Attr(key string, val string) html.Attribute {
 	return html.Attribute{Key: key, Val: val}
@@ -192,11 +491,18 @@ func FindNode(n *html.Node, a atom.Atom) *html.Node {
 
 // FindNodeWithAttributes is a depth-first search for the first node of the given type with the given attributes
 func FindNodeWithAttributes(n *html.Node, a atom.Atom, attr map[string]string) *html.Node {
+	return FindNodeFunc(n, func(c *html.Node) bool {
+		return c.DataAtom == a && HasAttributes(c, attr)
+	})
+}
+
+// FindNodeFunc is a depth-first search for the first child node for which the predicate returns true
+func FindNodeFunc(n *html.Node, pred func(*html.Node) bool) *html.Node {
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		if c.DataAtom == a && HasAttributes(c, attr) {
+		if pred(c) {
 			return c
 		}
-		gc := FindNodeWithAttributes(c, a, attr)
+		gc := FindNodeFunc(c, pred)
 		if gc != nil {
 			return gc
 		}
@@ -214,6 +520,16 @@ func HasAttributes(n *html.Node, attr map[string]string) bool {
 	return true
 }
 
+// HasClass returns true if the space-separated class list of the node contains the given class
+func HasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(GetAttribute(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
 // FindNodes returns all child nodes of the given type
 func FindNodes(n *html.Node, a atom.Atom) []*html.Node {
 	return FindNodesWithAttributes(n, a, nil)
@@ -221,27 +537,31 @@ func FindNodes(n *html.Node, a atom.Atom) []*html.Node {
 
 // FindNodesWithAttributes returns all child nodes of the given type with the given attributes
 func FindNodesWithAttributes(n *html.Node, a atom.Atom, attr map[string]string) []*html.Node {
-	var result []*html.Node
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		if c.DataAtom == a && HasAttributes(c, attr) {
-			result = append(result, c)
-		}
-		result = append(result, FindNodesWithAttributes(c, a, attr)...)
-	}
-	return result
+	return FindNodesFunc(n, func(c *html.Node) bool {
+		return c.DataAtom == a && HasAttributes(c, attr)
+	})
 }
 
 // FindAllNodes returns all child nodes of any of the given types, in the order in which they are found (a depth-first search)
 func FindAllNodes(n *html.Node, all ...atom.Atom) []*html.Node {
-	var result []*html.Node
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
+	return FindNodesFunc(n, func(c *html.Node) bool {
 		for _, a := range all {
 			if c.DataAtom == a {
-				result = append(result, c)
-				break
+				return true
 			}
 		}
-		result = append(result, FindAllNodes(c, all...)...)
+		return false
+	})
+}
+
+// FindNodesFunc returns all child nodes for which the predicate returns true, in the order in which they are found (a depth-first search)
+func FindNodesFunc(n *html.Node, pred func(*html.Node) bool) []*html.Node {
+	var result []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if pred(c) {
+			result = append(result, c)
+		}
+		result = append(result, FindNodesFunc(c, pred)...)
 	}
 	return result
 }
@@ -259,22 +579,51 @@ func GetText(n *html.Node) string {
 	return strings.Trim(buffer.String(), "\n")
 }
 
-// GetApproximateTextWidth returns the approximate width of the given text for the given font size (in pixels), assuming a sans-serif font.
-func GetApproximateTextWidth(text string, fontSize int) float64 {
-	size := 0.0
-	fSize := float64(fontSize)
-	if fontSize == 0 {
-		fSize = 14.0 // default font size on ons site
+// blockElements are the elements that GetTextWithSeparators places on a line of their own
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true, atom.Br: true, atom.Caption: true,
+	atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true, atom.Figcaption: true, atom.Figure: true,
+	atom.Footer: true, atom.Form: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Section: true, atom.Table: true, atom.Tr: true, atom.Ul: true,
+}
+
+// GetTextWithSeparators returns the text content of the given node, including the text content of all child nodes, with the content of
+// each block-level element (e.g. p, li, figcaption) on a separate line, and a line break for each br element.
+// Whitespace within each line is collapsed to a single space, empty lines are removed, and the content of script and style elements is ignored.
+func GetTextWithSeparators(n *html.Node) string {
+	var lines []string
+	var line bytes.Buffer
+	endLine := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); len(text) > 0 {
+			lines = append(lines, text)
+		}
+		line.Reset()
 	}
-	spacing := SpaceBetweenCharacters * fSize // allow for some spacing between letters
-	for _, runeValue := range text {
-		runeSize, ok := characterWidths[runeValue]
-		if ok {
-			runeSize = fSize * runeSize
-		} else { // unknown character - assume it's quite wide
-			runeSize = fSize * 0.8
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				line.WriteString(c.Data)
+			case c.DataAtom == atom.Script || c.DataAtom == atom.Style:
+				// not text content
+			case blockElements[c.DataAtom]:
+				endLine()
+				walk(c)
+				endLine()
+			default:
+				walk(c)
+			}
 		}
-		size += runeSize + spacing
 	}
-	return size
+	walk(n)
+	endLine()
+	return strings.Join(lines, "\n")
+}
+
+// GetApproximateTextWidth returns the approximate width of the given text for the given font size (in pixels), assuming a sans-serif font.
+// The text is measured by the default TextMeasurer (see UseTextMeasurer) - the characterWidths table unless a font has been assigned.
+func GetApproximateTextWidth(text string, fontSize int) float64 {
+	return defaultMeasurer.TextWidth(text, fontSize)
 }
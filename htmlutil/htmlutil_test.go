@@ -132,6 +132,68 @@ func TestAppendAttribute(t *testing.T) {
 	})
 }
 
+func TestJoinClasses(t *testing.T) {
+	Convey("JoinClasses should join the classes, removing duplicates in the order they first appear", t, func() {
+		So(JoinClasses("map_key", "map_key__vertical", "map_key"), ShouldEqual, "map_key map_key__vertical")
+		So(JoinClasses("map_key map_key", "map_key__vertical map_key"), ShouldEqual, "map_key map_key__vertical")
+	})
+
+	Convey("JoinClasses should ignore extra whitespace", t, func() {
+		So(JoinClasses("  map_key\t", "", " \nmap_key__vertical  map_key "), ShouldEqual, "map_key map_key__vertical")
+		So(JoinClasses(), ShouldEqual, "")
+		So(JoinClasses(" "), ShouldEqual, "")
+	})
+}
+
+func TestAddClass(t *testing.T) {
+	Convey("AddClass should add the classes to the class attribute, in place, unless already present", t, func() {
+		node := CreateNode("div", atom.Div, Attr("class", " map_key  map_key__vertical"), Attr("id", "key"))
+
+		AddClass(node, "map_key", "map_key_both map_key__vertical", "map_key_both")
+		So(len(node.Attr), ShouldEqual, 2)
+		So(node.Attr[0].Key, ShouldEqual, "class")
+		So(node.Attr[0].Val, ShouldEqual, "map_key map_key__vertical map_key_both")
+		So(node.Attr[1].Key, ShouldEqual, "id")
+	})
+
+	Convey("AddClass should add a class attribute if there is none", t, func() {
+		node := CreateNode("div", atom.Div, Attr("id", "key"))
+
+		AddClass(node, "map_key", "map_key")
+		So(len(node.Attr), ShouldEqual, 2)
+		So(GetAttribute(node, "class"), ShouldEqual, "map_key")
+
+		empty := CreateNode("div", atom.Div)
+		AddClass(empty, " ")
+		So(empty.Attr, ShouldBeEmpty)
+	})
+}
+
+func TestRemoveClass(t *testing.T) {
+	Convey("RemoveClass should remove a class from the middle of the class list, keeping the order of the others", t, func() {
+		node := CreateNode("div", atom.Div, Attr("class", "map_key  map_key__vertical\tmap_key_both"))
+
+		RemoveClass(node, "map_key__vertical")
+		So(GetAttribute(node, "class"), ShouldEqual, "map_key map_key_both")
+		So(HasClass(node, "map_key__vertical"), ShouldBeFalse)
+	})
+
+	Convey("RemoveClass should remove every occurrence of the classes", t, func() {
+		node := CreateNode("div", atom.Div, Attr("class", "map_key map_key_both map_key"))
+
+		RemoveClass(node, "map_key", "unknown")
+		So(GetAttribute(node, "class"), ShouldEqual, "map_key_both")
+	})
+
+	Convey("RemoveClass should remove the class attribute if no classes remain", t, func() {
+		node := CreateNode("div", atom.Div, Attr("id", "key"), Attr("class", "map_key"))
+
+		RemoveClass(node, "map_key")
+		So(len(node.Attr), ShouldEqual, 1)
+		So(node.Attr[0].Key, ShouldEqual, "id")
+	})
+}
+
 func TestAttr(t *testing.T) {
 	Convey("Attr should create an attribute", t, func() {
 
@@ -299,6 +361,80 @@ func TestFindAllNodes(t *testing.T) {
 	})
 }
 
+func TestHasClass(t *testing.T) {
+	Convey("HasClass should return true if the class list of the node contains the class", t, func() {
+
+		node := CreateNode("div", atom.Div, Attr("class", " map_key  map_key__vertical "))
+
+		So(HasClass(node, "map_key"), ShouldBeTrue)
+		So(HasClass(node, "map_key__vertical"), ShouldBeTrue)
+	})
+
+	Convey("HasClass should return false if the class list of the node does not contain the class", t, func() {
+
+		So(HasClass(CreateNode("div", atom.Div, Attr("class", "map_key__vertical")), "map_key"), ShouldBeFalse)
+		So(HasClass(CreateNode("div", atom.Div, Attr("id", "map_key")), "map_key"), ShouldBeFalse)
+		So(HasClass(CreateNode("div", atom.Div, Attr("class", "map_key")), ""), ShouldBeFalse)
+	})
+}
+
+func TestFindNodeFunc(t *testing.T) {
+	Convey("FindNodeFunc should return the first node that matches the predicate (depth-first)", t, func() {
+
+		node := CreateNode("div", atom.Div,
+			CreateNode("p", atom.P, CreateNode("span", atom.Span, Attr("class", "a match"), Attr("position", "first"))),
+			CreateNode("span", atom.Span, Attr("class", "match"), Attr("position", "second")))
+
+		result := FindNodeFunc(node, func(n *html.Node) bool { return HasClass(n, "match") })
+		So(result, ShouldNotBeNil)
+		So(GetAttribute(result, "position"), ShouldEqual, "first")
+	})
+
+	Convey("FindNodeFunc should return nil if no node matches the predicate", t, func() {
+
+		node := CreateNode("div", atom.Div, Attr("class", "match"),
+			CreateNode("p", atom.P, Attr("class", "matches")))
+
+		result := FindNodeFunc(node, func(n *html.Node) bool { return HasClass(n, "match") })
+		So(result, ShouldBeNil)
+	})
+}
+
+func TestFindNodesFunc(t *testing.T) {
+	Convey("FindNodesFunc should return all nodes that match the predicate, including nested matches", t, func() {
+
+		node := CreateNode("div", atom.Div,
+			CreateNode("div", atom.Div, Attr("class", "map_key map_key__horizontal"), Attr("position", "first"),
+				CreateNode("div", atom.Div, Attr("class", "map_key"), Attr("position", "second"))),
+			CreateNode("div", atom.Div, Attr("class", "map"), Attr("position", "not a key")),
+			CreateNode("span", atom.Span, Attr("class", "map_key"), Attr("position", "not a div")),
+			CreateNode("div", atom.Div, Attr("class", "map_key__vertical map_key"), Attr("position", "third")))
+
+		result := FindNodesFunc(node, func(n *html.Node) bool { return n.DataAtom == atom.Div && HasClass(n, "map_key") })
+		So(len(result), ShouldEqual, 3)
+		So(GetAttribute(result[0], "position"), ShouldEqual, "first")
+		So(GetAttribute(result[1], "position"), ShouldEqual, "second")
+		So(GetAttribute(result[2], "position"), ShouldEqual, "third")
+	})
+
+	Convey("FindNodesFunc should not test the node itself", t, func() {
+
+		node := CreateNode("div", atom.Div, Attr("class", "match"))
+
+		result := FindNodesFunc(node, func(n *html.Node) bool { return HasClass(n, "match") })
+		So(result, ShouldBeNil)
+	})
+
+	Convey("FindNodesFunc should return nil if no node matches the predicate", t, func() {
+
+		node := CreateNode("div", atom.Div,
+			CreateNode("p", atom.P, Attr("class", "no-match")))
+
+		result := FindNodesFunc(node, func(n *html.Node) bool { return HasClass(n, "match") })
+		So(result, ShouldBeNil)
+	})
+}
+
 func TestGetText(t *testing.T) {
 	Convey("GetText should return the text content of the node", t, func() {
 
@@ -313,6 +449,56 @@ func TestGetText(t *testing.T) {
 	})
 }
 
+func TestGetTextWithSeparators(t *testing.T) {
+	Convey("GetTextWithSeparators should put the content of each block-level element on a separate line", t, func() {
+
+		node := CreateNode("div", atom.Div,
+			"\n",
+			CreateNode("p", atom.P, "hello ", CreateNode("span", atom.Span, "world"), "!"),
+			CreateNode("div", atom.Div, CreateNode("p", atom.P, "second")),
+			CreateNode("ol", atom.Ol, "\n",
+				CreateNode("li", atom.Li, "first item"), "\n",
+				CreateNode("li", atom.Li, "second item"), "\n"),
+			"trailing ", CreateNode("a", atom.A, "link"))
+
+		So(GetTextWithSeparators(node), ShouldEqual, "hello world!\nsecond\nfirst item\nsecond item\ntrailing link")
+	})
+
+	Convey("GetTextWithSeparators should break lines at br elements", t, func() {
+
+		node := CreateNode("figcaption", atom.Figcaption, "Title", CreateNode("br", atom.Br), CreateNode("span", atom.Span, "Subtitle"))
+
+		So(GetTextWithSeparators(node), ShouldEqual, "Title\nSubtitle")
+	})
+
+	Convey("GetTextWithSeparators should collapse whitespace and remove empty lines", t, func() {
+
+		node := CreateNode("div", atom.Div,
+			CreateNode("p", atom.P, "  lots\tof \n\n whitespace  "),
+			CreateNode("p", atom.P, " \n "),
+			CreateNode("br", atom.Br),
+			CreateNode("br", atom.Br),
+			CreateNode("p", atom.P, "end"))
+
+		So(GetTextWithSeparators(node), ShouldEqual, "lots of whitespace\nend")
+	})
+
+	Convey("GetTextWithSeparators should ignore the content of script and style elements", t, func() {
+
+		node := CreateNode("div", atom.Div,
+			CreateNode("style", atom.Style, ".map { fill: red; }"),
+			CreateNode("p", atom.P, "text"),
+			CreateNode("script", atom.Script, "alert(1)"))
+
+		So(GetTextWithSeparators(node), ShouldEqual, "text")
+	})
+
+	Convey("GetTextWithSeparators should return an empty string for a node without text", t, func() {
+
+		So(GetTextWithSeparators(CreateNode("div", atom.Div, CreateNode("p", atom.P))), ShouldEqual, "")
+	})
+}
+
 func TestGetApproximateTextWidth(t *testing.T) {
 	text := "The quick brown fox jumps over the lazy dog"
 
@@ -338,7 +524,36 @@ func TestGetApproximateTextWidthUsesDefaultForUnknownCharacters(t *testing.T) {
 
 	Convey("GetApproximateTextWidth should return the correct width at 14px", t, func() {
 		result := GetApproximateTextWidth(text, 14)
-		So(int(result), ShouldEqual, 92)
+		So(int(result), ShouldEqual, 64)
+	})
+
+	Convey("Unknown characters should be measured as the average width of a known character", t, func() {
+		result := GetApproximateTextWidth("日本語", 14)
+		So(result, ShouldBeBetween, 3*14*0.5, 3*14*0.6)
+	})
+}
+
+func TestGetApproximateTextWidthOfASCIIIsUnchanged(t *testing.T) {
+	text := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-=[];'#,./\\!\"£$%^&*()_+{}:@~<>? "
+
+	Convey("GetApproximateTextWidth should return the same width for ascii characters as the original table", t, func() {
+		result := GetApproximateTextWidth(text, 14)
+		So(result, ShouldAlmostEqual, 703.6736, 0.0001)
+	})
+}
+
+func TestGetApproximateTextWidthOfWelshAndPunctuation(t *testing.T) {
+
+	Convey("Welsh text with diacritics should be measured as the unaccented text", t, func() {
+		So(GetApproximateTextWidth("Ŵyŵyr Gwŷr Môn, Siân â'r ddrŵs", 14), ShouldEqual, GetApproximateTextWidth("Wywyr Gwyr Mon, Sian a'r ddrws", 14))
+		So(GetApproximateTextWidth("Caerdydd – Abertawe", 14), ShouldBeBetween, 130, 137)
+	})
+
+	Convey("Common punctuation and symbols should not be measured as unknown characters", t, func() {
+		for _, r := range "–—‘’“”…°±×\u00a0\u2009\u202f" {
+			So(GetApproximateTextWidth(string(r), 14), ShouldNotAlmostEqual, GetApproximateTextWidth("日", 14))
+		}
+		So(GetApproximateTextWidth("“Rates rose 2.5°C ± 0.1 – a record…”", 14), ShouldBeBetween, 225, 240)
 	})
 }
 
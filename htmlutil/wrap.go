@@ -0,0 +1,73 @@
+package htmlutil
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// LineHeight is the height of a line of text, as a proportion of the font size
+const LineHeight = 1.2
+
+// WrapText splits the text into lines that fit within maxWidth (in pixels) at the given font size, as measured by GetApproximateTextWidth.
+// Lines are broken at whitespace, and at any explicit newlines in the text. Words that do not fit on a line of their own are split
+// at the last character that fits (a single character that does not fit is given a line of its own). Whitespace is collapsed to a single space, and removed from the start and end of each line.
+// If maxWidth is not positive, the text is only split at the explicit newlines. Empty text returns no lines.
+func WrapText(text string, fontSize int, maxWidth float64) []string {
+	lines := []string{}
+	if len(text) == 0 {
+		return lines
+	}
+	for _, paragraph := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		lines = append(lines, wrapParagraph(strings.Fields(paragraph), fontSize, maxWidth)...)
+	}
+	return lines
+}
+
+// wrapParagraph joins the words into lines that fit within maxWidth. A paragraph without words is a single empty line.
+func wrapParagraph(words []string, fontSize int, maxWidth float64) []string {
+	if len(words) == 0 {
+		return []string{""}
+	}
+	if maxWidth <= 0 {
+		return []string{strings.Join(words, " ")}
+	}
+	lines := []string{}
+	line := ""
+	for _, word := range words {
+		if len(line) > 0 {
+			if candidate := line + " " + word; GetApproximateTextWidth(candidate, fontSize) <= maxWidth {
+				line = candidate
+				continue
+			}
+			lines = append(lines, line)
+		}
+		for utf8.RuneCountInString(word) > 1 && GetApproximateTextWidth(word, fontSize) > maxWidth {
+			head, tail := splitWord(word, fontSize, maxWidth)
+			lines = append(lines, head)
+			word = tail
+		}
+		line = word
+	}
+	return append(lines, line)
+}
+
+// splitWord splits the word after the last character that fits within maxWidth - but always after at least one character
+func splitWord(word string, fontSize int, maxWidth float64) (string, string) {
+	runes := []rune(word)
+	n := 1
+	for n < len(runes) && GetApproximateTextWidth(string(runes[:n+1]), fontSize) <= maxWidth {
+		n++
+	}
+	return string(runes[:n]), string(runes[n:])
+}
+
+// MeasureLines returns the width of the widest line, and the total height of the lines (see LineHeight), at the given font size
+func MeasureLines(lines []string, fontSize int) (float64, float64) {
+	maxWidth := 0.0
+	for _, line := range lines {
+		if width := GetApproximateTextWidth(line, fontSize); width > maxWidth {
+			maxWidth = width
+		}
+	}
+	return maxWidth, float64(len(lines)) * fontSizeOrDefault(fontSize) * LineHeight
+}
@@ -0,0 +1,86 @@
+package htmlutil_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/ONSdigital/dp-map-renderer/htmlutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWrapText(t *testing.T) {
+
+	Convey("Empty text has no lines", t, func() {
+		So(WrapText("", 14, 100), ShouldBeEmpty)
+	})
+
+	Convey("Text that fits is returned as a single line, without surrounding whitespace", t, func() {
+		So(WrapText("  short   text  ", 14, 200), ShouldResemble, []string{"short text"})
+	})
+
+	Convey("Text is broken at the last word that fits", t, func() {
+		text := "The quick brown fox jumps over the lazy dog"
+		lines := WrapText(text, 14, 100)
+
+		So(strings.Join(lines, " "), ShouldEqual, text)
+		So(len(lines), ShouldBeGreaterThan, 1)
+		for i, line := range lines {
+			So(GetApproximateTextWidth(line, 14), ShouldBeLessThanOrEqualTo, 100)
+			if i < len(lines)-1 {
+				nextWord := strings.Fields(lines[i+1])[0]
+				So(GetApproximateTextWidth(line+" "+nextWord, 14), ShouldBeGreaterThan, 100)
+			}
+		}
+	})
+
+	Convey("A line that exactly fits the width is not broken", t, func() {
+		width := GetApproximateTextWidth("exact fit", 14)
+		So(WrapText("exact fit", 14, width), ShouldResemble, []string{"exact fit"})
+		So(WrapText("exact fit", 14, width-0.01), ShouldResemble, []string{"exact", "fit"})
+	})
+
+	Convey("A single long word is split at the last character that fits", t, func() {
+		lines := WrapText("Llanfairpwllgwyngyllgogerychwyrndrobwllllantysiliogogogoch", 14, 100)
+
+		So(len(lines), ShouldBeGreaterThan, 1)
+		So(strings.Join(lines, ""), ShouldEqual, "Llanfairpwllgwyngyllgogerychwyrndrobwllllantysiliogogogoch")
+		for _, line := range lines {
+			So(GetApproximateTextWidth(line, 14), ShouldBeLessThanOrEqualTo, 100)
+		}
+	})
+
+	Convey("A character wider than the line is given a line of its own", t, func() {
+		So(WrapText("WW", 14, 5), ShouldResemble, []string{"W", "W"})
+	})
+
+	Convey("Explicit newlines always break the text, and blank lines are kept", t, func() {
+		So(WrapText("first line\r\n\nthird line ", 14, 500), ShouldResemble, []string{"first line", "", "third line"})
+	})
+
+	Convey("Text is not wrapped if the width is not positive", t, func() {
+		So(WrapText("The quick brown fox\njumps over the lazy dog", 14, 0), ShouldResemble, []string{"The quick brown fox", "jumps over the lazy dog"})
+	})
+}
+
+func TestMeasureLines(t *testing.T) {
+
+	Convey("The width of the widest line and total height of the lines are returned", t, func() {
+		width, height := MeasureLines([]string{"short", "a longer line", ""}, 10)
+
+		So(width, ShouldEqual, GetApproximateTextWidth("a longer line", 10))
+		So(height, ShouldAlmostEqual, 3*10*LineHeight)
+	})
+
+	Convey("No lines have no size", t, func() {
+		width, height := MeasureLines(nil, 14)
+
+		So(width, ShouldEqual, 0)
+		So(height, ShouldEqual, 0)
+	})
+
+	Convey("The default font size is used if none is given", t, func() {
+		_, height := MeasureLines([]string{"one"}, 0)
+
+		So(height, ShouldAlmostEqual, 14*LineHeight)
+	})
+}
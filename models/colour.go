@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/dp-map-renderer/colour"
+)
+
+var (
+	// hexColour matches #rgb, #rrggbb and #rrggbbaa colours
+	hexColour = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	// rgbColour matches rgb() with 3, and rgba() with 4, numeric (or percentage) arguments
+	rgbColour = regexp.MustCompile(`^(?i:rgb\(\s*` + colourArg + `(\s*,\s*` + colourArg + `){2}\s*\)|rgba\(\s*` + colourArg + `(\s*,\s*` + colourArg + `){3}\s*\))$`)
+	// patternReference matches a reference to a pattern within the svg, e.g. url(#map-abcd1234-nodata)
+	patternReference = regexp.MustCompile(`^url\(#[\w-]+\)$`)
+)
+
+const colourArg = `[0-9]*\.?[0-9]+%?`
+
+// KeyForegrounds are the colours drawn on and around the swatches of the key - the text of the key and the outline of its swatches
+var KeyForegrounds = []colour.Foreground{{Name: "The key text and swatch outline", Colour: "black"}}
+
+// IsValidColour returns true if the value is a colour that is safe to insert into a style attribute:
+// a hex colour (#rgb, #rrggbb or #rrggbbaa), rgb() or rgba() with numeric arguments, or a css named colour (in any case)
+func IsValidColour(value string) bool {
+	return hexColour.MatchString(value) || rgbColour.MatchString(value) || colour.IsNamed(value)
+}
+
+// IsValidPaint returns true if the value may be used for the fill or stroke in RenderRequest.RegionStyles:
+// a valid colour (see IsValidColour), none, or a reference to a pattern within the svg
+func IsValidPaint(value string) bool {
+	return IsValidColour(value) || strings.EqualFold(value, "none") || patternReference.MatchString(value)
+}
+
+// validateColours returns an error if the colour of a break or the point marker, the stroke of the line style, or the fill or stroke of a region style, is not valid
+func (r *RenderRequest) validateColours() error {
+	if r.Choropleth != nil {
+		for i, b := range r.Choropleth.Breaks {
+			if b != nil && len(b.Colour) > 0 && !IsValidColour(b.Colour) {
+				return fmt.Errorf("choropleth.breaks[%d].color must be a hex colour (#rgb, #rrggbb or #rrggbbaa), rgb() or rgba() with numeric values, or a named colour: color=%v", i, b.Colour)
+			}
+		}
+	}
+	if r.LineStyle != nil && len(r.LineStyle.Stroke) > 0 && !IsValidPaint(r.LineStyle.Stroke) {
+		return fmt.Errorf("line_style.stroke must be a colour (as for choropleth.breaks), none or url(#pattern-id): stroke=%v", r.LineStyle.Stroke)
+	}
+	if r.PointMarker != nil && len(r.PointMarker.Colour) > 0 && !IsValidColour(r.PointMarker.Colour) {
+		return fmt.Errorf("point_marker.color must be a hex colour (#rgb, #rrggbb or #rrggbbaa), rgb() or rgba() with numeric values, or a named colour: color=%v", r.PointMarker.Colour)
+	}
+	ids := make([]string, 0, len(r.RegionStyles))
+	for id := range r.RegionStyles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, declaration := range strings.Split(r.RegionStyles[id], ";") {
+			parts := strings.SplitN(declaration, ":", 2)
+			if len(parts) < 2 {
+				continue
+			}
+			property, value := strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+			if (property == "fill" || property == "stroke") && !IsValidPaint(value) {
+				return fmt.Errorf("region_styles[%q] must use a colour (as for choropleth.breaks), none or url(#pattern-id) for the %s: %s=%v", id, property, property, value)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// The conversions between topojson and geojson made by the /convert endpoints
+const (
+	ConversionTopoJSONToGeoJSON = "topojson-to-geojson"
+	ConversionGeoJSONToTopoJSON = "geojson-to-topojson"
+)
+
+// ConvertRequest is a request to convert a geography (given inline, or by the id of a registered geography) from topojson to geojson, or the reverse
+type ConvertRequest struct {
+	Geography   *Geography `json:"geography,omitempty"`
+	GeographyID string     `json:"geography_id,omitempty"` // the id of a registered geography - an alternative to Geography
+	// IDAndNameOnly removes every property of the converted features except the id_property and name_property of the geography
+	IDAndNameOnly bool `json:"id_and_name_only,omitempty"`
+	// Quantisation is the number of distinct values (e.g. 1e5) to which the coordinates of a converted topology are quantised, or 0 for none
+	Quantisation float64 `json:"quantisation,omitempty"`
+	// OutputQuantisation is the number of distinct values (no more than the Quantisation, if given) to which the coordinates of a converted
+	// topology are quantised once its arcs have been found - defaults to the Quantisation
+	OutputQuantisation float64 `json:"output_quantisation,omitempty"`
+}
+
+// CreateConvertRequest manages the creation of a ConvertRequest from a reader, decoding the json as it is read
+func CreateConvertRequest(reader io.Reader) (*ConvertRequest, error) {
+	body := &bodyReader{reader: reader}
+	var request ConvertRequest
+	err := json.NewDecoder(body).Decode(&request)
+	if body.err != nil {
+		log.Error(body.err, nil)
+		return nil, ErrorReadingBody
+	}
+	if err == io.ErrUnexpectedEOF {
+		// report the same error as json.Unmarshal
+		err = ErrorTruncated
+	}
+	if err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	if reflect.DeepEqual(request, ConvertRequest{}) {
+		return &request, ErrorNoData
+	}
+
+	return &request, nil
+}
+
+// CreateConvertRequestStrict is the same as CreateConvertRequest, except that it returns an error naming any fields in the json
+// that are not part of a ConvertRequest. Unlike CreateConvertRequest, the whole body is read before it is decoded.
+func CreateConvertRequestStrict(reader io.Reader) (*ConvertRequest, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		log.Error(err, log.Data{"request_body": string(body)})
+		return nil, ErrorReadingBody
+	}
+	if err = checkUnknownFields(body, reflect.TypeOf(ConvertRequest{})); err != nil {
+		return nil, err
+	}
+	return CreateConvertRequest(bytes.NewReader(body))
+}
+
+// ResolveGeography replaces the GeographyID of the request with the registered Geography it refers to,
+// returning a GeographyNotFoundError if there is no such geography.
+// Requests without a GeographyID, or that also have a Geography (which ValidateConvertRequest rejects), are left unchanged.
+func (r *ConvertRequest) ResolveGeography(lookup GeographyLookup) error {
+	return resolveGeography(&r.Geography, &r.GeographyID, lookup)
+}
+
+// ValidateConvertRequest checks the content of a request for the given conversion (ConversionTopoJSONToGeoJSON or ConversionGeoJSONToTopoJSON),
+// which must have a geography of the type converted from
+func (r *ConvertRequest) ValidateConvertRequest(conversion string) error {
+
+	if r.Geography != nil && len(r.GeographyID) > 0 {
+		return fmt.Errorf("Only one of geography and geography_id may be provided")
+	}
+
+	var missingFields []string
+
+	if r.Geography == nil {
+		missingFields = append(missingFields, "geography")
+	} else {
+		if conversion == ConversionTopoJSONToGeoJSON && r.Geography.Topojson == nil {
+			missingFields = append(missingFields, "geography.topojson")
+		}
+		if conversion == ConversionGeoJSONToTopoJSON && r.Geography.Geojson == nil {
+			missingFields = append(missingFields, "geography.geojson")
+		}
+		if len(r.Geography.IDProperty) == 0 {
+			missingFields = append(missingFields, "geography.id_property")
+		}
+	}
+
+	if missingFields != nil {
+		return fmt.Errorf("Missing mandatory field(s): %v", missingFields)
+	}
+	if r.Geography.Topojson != nil && r.Geography.Geojson != nil {
+		return fmt.Errorf("Only one of geography.topojson and geography.geojson may be provided")
+	}
+	if err := checkGeographySize(r.Geography); err != nil {
+		return err
+	}
+	if err := checkTopology(r.Geography); err != nil {
+		return err
+	}
+	if conversion == ConversionTopoJSONToGeoJSON && (r.Quantisation != 0 || r.OutputQuantisation != 0) {
+		return fmt.Errorf("quantisation and output_quantisation may only be given when converting geojson to topojson")
+	}
+	if r.Quantisation != 0 && r.Quantisation < 2 {
+		return fmt.Errorf("quantisation must be 0 (for none) or at least 2: quantisation=%v", r.Quantisation)
+	}
+	if r.OutputQuantisation != 0 && (r.OutputQuantisation < 2 || (r.Quantisation != 0 && r.OutputQuantisation > r.Quantisation)) {
+		return fmt.Errorf("output_quantisation must be 0 (for the quantisation), or at least 2 and no more than the quantisation: quantisation=%v, output_quantisation=%v", r.Quantisation, r.OutputQuantisation)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+)
+
+// FuzzCreateRenderRequest creates (and validates) render requests from arbitrary json, which should never panic.
+// The topology of a valid request is converted to geojson, as it is when rendered. e.g.
+//
+//	go test ./models -run XXX -fuzz FuzzCreateRenderRequest -fuzztime 1m -fuzzminimizetime 1x
+func FuzzCreateRenderRequest(f *testing.F) {
+	for _, seed := range []string{
+		`{}`,
+		`{"geography": {"topojson": {"type": "Topology", "arcs": [], "objects": {"a": null}}, "id_property": "id"}, "data": [{"id": "a", "value": 1}]}`,
+		`{"geography": {"topojson": {"type": "Topology", "arcs": [[[0, 0], [1, 1]]], "objects": {"a": {"type": "LineString", "arcs": [1]}}}, "id_property": "id"}, "data": [{"id": "a", "value": 1}]}`,
+		`{"geography": {"topojson": {"type": "Topology", "arcs": [[]], "objects": {"a": {"type": "Polygon", "arcs": [[0]]}}}, "id_property": "id"}, "data": [{"id": "a", "value": 1}]}`,
+		`{"geography": {"geojson": {"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": null}]}, "id_property": "id"}, "data": [null]}`,
+		`{"schema_version": 1, "choropleth": {"breaks": [null]}}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Add(testdata.LoadExampleRequest(f))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		request, err := CreateRenderRequest(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if err = request.ValidateRenderRequest(); err != nil {
+			return
+		}
+		if request.Geography.Topojson != nil {
+			request.Geography.Topojson.ToGeoJSON()
+		}
+	})
+}
+
+// FuzzCreateAnalyseRequest creates (and validates) analyse requests from arbitrary json, which should never panic
+func FuzzCreateAnalyseRequest(f *testing.F) {
+	for _, seed := range []string{
+		`{}`,
+		`{"geography": {"topojson": {"type": "Topology", "arcs": [], "objects": {"a": null}}, "id_property": "id"}, "csv": "a,1"}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Add(testdata.LoadExampleAnalyseRequest(f))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		request, err := CreateAnalyseRequest(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		request.ValidateAnalyseRequest()
+	})
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// validGeographyID matches a geography_id that may be safely used in urls and file names
+var validGeographyID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// GeographyLookup returns the registered Geography with the given id, or nil if there is none
+type GeographyLookup func(id string) *Geography
+
+// GeographyNotFoundError is returned when a request refers to a geography_id that has not been registered
+type GeographyNotFoundError struct {
+	ID string
+}
+
+func (e *GeographyNotFoundError) Error() string {
+	return fmt.Sprintf("No geography has been registered with geography_id=%v", e.ID)
+}
+
+// IsValidGeographyID returns true if the id only contains letters, digits, hyphens and underscores
+func IsValidGeographyID(id string) bool {
+	return validGeographyID.MatchString(id)
+}
+
+// CreateGeography manages the creation of a Geography (to be registered by id) from a reader, decoding the json as it is read
+func CreateGeography(reader io.Reader) (*Geography, error) {
+	body := &bodyReader{reader: reader}
+	var geography Geography
+	err := json.NewDecoder(body).Decode(&geography)
+	if body.err != nil {
+		log.Error(body.err, nil)
+		return nil, ErrorReadingBody
+	}
+	if err == io.ErrUnexpectedEOF {
+		// report the same error as json.Unmarshal
+		err = ErrorTruncated
+	}
+	if err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	if reflect.DeepEqual(geography, Geography{}) {
+		return &geography, ErrorNoData
+	}
+
+	return &geography, nil
+}
+
+// CreateGeographyStrict is the same as CreateGeography, except that it returns an error naming any fields in the json
+// that are not part of a Geography. Unlike CreateGeography, the whole body is read before it is decoded.
+func CreateGeographyStrict(reader io.Reader) (*Geography, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		log.Error(err, log.Data{"request_body": string(body)})
+		return nil, ErrorReadingBody
+	}
+	if err = checkUnknownFields(body, reflect.TypeOf(Geography{})); err != nil {
+		return nil, err
+	}
+	return CreateGeography(bytes.NewReader(body))
+}
+
+// ValidateGeography checks the content of a geography that is to be registered by id
+func (g *Geography) ValidateGeography() error {
+
+	var missingFields []string
+
+	if g.Topojson == nil && g.Geojson == nil {
+		missingFields = append(missingFields, "topojson or geojson")
+	}
+	if len(g.IDProperty) == 0 {
+		missingFields = append(missingFields, "id_property")
+	}
+
+	if missingFields != nil {
+		return fmt.Errorf("Missing mandatory field(s): %v", missingFields)
+	}
+	if g.Topojson != nil && g.Geojson != nil {
+		return fmt.Errorf("Only one of topojson and geojson may be provided")
+	}
+	if err := checkGeographySize(g); err != nil {
+		return err
+	}
+	return checkTopology(g)
+}
+
+// ResolveGeography replaces the GeographyID of the request with the registered Geography it refers to,
+// returning a GeographyNotFoundError if there is no such geography.
+// Requests without a GeographyID, or that also have a Geography (which ValidateRenderRequest rejects), are left unchanged.
+func (r *RenderRequest) ResolveGeography(lookup GeographyLookup) error {
+	return resolveGeography(&r.Geography, &r.GeographyID, lookup)
+}
+
+// ResolveGeography replaces the GeographyID of the request with the registered Geography it refers to,
+// returning a GeographyNotFoundError if there is no such geography.
+// Requests without a GeographyID, or that also have a Geography (which ValidateAnalyseRequest rejects), are left unchanged.
+func (r *AnalyseRequest) ResolveGeography(lookup GeographyLookup) error {
+	return resolveGeography(&r.Geography, &r.GeographyID, lookup)
+}
+
+func resolveGeography(geography **Geography, id *string, lookup GeographyLookup) error {
+	if len(*id) == 0 || *geography != nil {
+		return nil
+	}
+	g := lookup(*id)
+	if g == nil {
+		return &GeographyNotFoundError{ID: *id}
+	}
+	*geography, *id = g, ""
+	return nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// Hash returns a digest of the request that is the same for any two requests that would be rendered identically,
+// e.g. for use as a cache key or ETag. The digest is calculated from a canonical json representation of the request:
+// object keys (including those of the topology objects and feature properties) are sorted, and numbers are formatted consistently (so 1, 1.0 and 1e0 are equivalent).
+func (r *RenderRequest) Hash() (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var value interface{}
+	if err = decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	canonical, err := json.Marshal(canonicalise(value))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalise returns the decoded json value with all numbers in their shortest float64 form.
+// Maps are left as they are, as encoding/json marshals them with sorted keys.
+func canonicalise(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = canonicalise(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = canonicalise(child)
+		}
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil || math.IsInf(f, 0) {
+			return v
+		}
+		if f == 0 {
+			f = 0 // normalise -0
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return value
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+)
+
+// The default limits on the size of a geography
+const (
+	defaultMaxArcs        = 100000
+	defaultMaxObjects     = 20000
+	defaultMaxCoordinates = 2000000
+)
+
+var (
+	maxArcs        = defaultMaxArcs
+	maxObjects     = defaultMaxObjects
+	maxCoordinates = defaultMaxCoordinates
+)
+
+// UseTopologyLimits sets the maximum number of arcs, objects (geometries or features) and coordinates accepted in a geography.
+// A value of 0 (or less) removes the corresponding limit.
+func UseTopologyLimits(arcs int, objects int, coordinates int) {
+	maxArcs, maxObjects, maxCoordinates = arcs, objects, coordinates
+}
+
+// TopologyTooLargeError is returned by validation when a geography exceeds one of the size limits
+type TopologyTooLargeError struct {
+	Measure string // arcs, objects or coordinates
+	Limit   int
+	Size    int
+}
+
+func (e *TopologyTooLargeError) Error() string {
+	return fmt.Sprintf("The geography has %d %s, which exceeds the limit of %d. Please simplify the topology (e.g. using toposimplify or mapshaper) and try again", e.Size, e.Measure, e.Limit)
+}
+
+// CheckSize returns a TopologyTooLargeError if the geography has more arcs, objects or coordinates than the limits (see UseTopologyLimits),
+// e.g. once it has been converted (the size of a geography is checked when a request is validated)
+func (g *Geography) CheckSize() error {
+	return checkGeographySize(g)
+}
+
+// checkGeographySize counts the arcs, objects and coordinates in the geography, returning a TopologyTooLargeError if any exceeds its limit.
+// The counts are made over the unconverted topology (or geojson), so are cheap compared to rendering it.
+func checkGeographySize(g *Geography) error {
+	arcs, objects, coordinates := g.Size()
+
+	for _, check := range []struct {
+		measure     string
+		limit, size int
+	}{
+		{"arcs", maxArcs, arcs},
+		{"objects", maxObjects, objects},
+		{"coordinates", maxCoordinates, coordinates},
+	} {
+		if check.limit > 0 && check.size > check.limit {
+			return &TopologyTooLargeError{Measure: check.measure, Limit: check.limit, Size: check.size}
+		}
+	}
+	return nil
+}
+
+// Size returns the number of arcs, objects (geometries or features) and coordinates in the geography, as limited by UseTopologyLimits
+func (g *Geography) Size() (arcs int, objects int, coordinates int) {
+	if g.Topojson != nil {
+		arcs = len(g.Topojson.Arcs)
+		for _, a := range g.Topojson.Arcs {
+			coordinates += len(a)
+		}
+		for _, o := range g.Topojson.Objects {
+			n, c := countGeometries(o)
+			objects += n
+			coordinates += c
+		}
+	}
+	if g.Geojson != nil {
+		objects = len(g.Geojson.Features)
+		for _, f := range g.Geojson.Features {
+			coordinates += countCoordinates(f.Geometry)
+		}
+	}
+	return arcs, objects, coordinates
+}
+
+// countGeometries returns the number of geometries (excluding collections) in the topojson geometry, and the number of coordinates
+// held directly by them (points - the coordinates of other geometries are held in the topology arcs)
+func countGeometries(g *topojson.Geometry) (int, int) {
+	if g == nil {
+		return 0, 0
+	}
+	switch g.Type {
+	case geojson.GeometryCollection:
+		objects, coordinates := 0, 0
+		for _, child := range g.Geometries {
+			n, c := countGeometries(child)
+			objects += n
+			coordinates += c
+		}
+		return objects, coordinates
+	case geojson.GeometryPoint:
+		return 1, 1
+	case geojson.GeometryMultiPoint:
+		return 1, len(g.MultiPoint)
+	}
+	return 1, 0
+}
+
+// countCoordinates returns the number of coordinates in the geojson geometry
+func countCoordinates(g *geojson.Geometry) int {
+	if g == nil {
+		return 0
+	}
+	switch g.Type {
+	case geojson.GeometryPoint:
+		return 1
+	case geojson.GeometryMultiPoint, geojson.GeometryLineString:
+		return len(g.MultiPoint) + len(g.LineString)
+	case geojson.GeometryMultiLineString:
+		return countPaths(g.MultiLineString)
+	case geojson.GeometryPolygon:
+		return countPaths(g.Polygon)
+	case geojson.GeometryMultiPolygon:
+		n := 0
+		for _, p := range g.MultiPolygon {
+			n += countPaths(p)
+		}
+		return n
+	case geojson.GeometryCollection:
+		n := 0
+		for _, c := range g.Geometries {
+			n += countCoordinates(c)
+		}
+		return n
+	}
+	return 0
+}
+
+// countPaths returns the total number of coordinates in the paths
+func countPaths(paths [][][]float64) int {
+	n := 0
+	for _, p := range paths {
+		n += len(p)
+	}
+	return n
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/json-iterator/go"
+)
+
+// CurrentSchemaVersion is the version of the RenderRequest schema described by the model.
+// Requests without a schema_version are treated as version 1.
+const CurrentSchemaVersion = 2
+
+// renderRequestJSON is the json of a render request of any schema version, decoded into its RenderRequest. The schema_version is decoded
+// separately (so that it can be validated before it is used), as are the fields of the choropleth that are only part of older schema versions.
+type renderRequestJSON struct {
+	*RenderRequest
+	SchemaVersion json.RawMessage `json:"schema_version,omitempty"`
+	Choropleth    *choroplethJSON `json:"choropleth,omitempty"`
+}
+
+// choroplethJSON is the json of a choropleth of any schema version, decoded into its Choropleth
+type choroplethJSON struct {
+	*Choropleth
+	ReferenceValue     *float64 `json:"reference_value,omitempty"`      // schema_version 1 only - migrated to reference_lines
+	ReferenceValueText *string  `json:"reference_value_text,omitempty"` // schema_version 1 only - migrated to reference_lines
+}
+
+// newRenderRequestJSON returns the json of the request, into which a body may be decoded over the fields already given
+func newRenderRequestJSON(request *RenderRequest) *renderRequestJSON {
+	r := &renderRequestJSON{RenderRequest: request}
+	if request.Choropleth != nil {
+		r.Choropleth = &choroplethJSON{Choropleth: request.Choropleth}
+	}
+	return r
+}
+
+// decode decodes the json object of a render request from the reader field by field, returning an error if it is followed by anything
+// other than whitespace. Returns the json of the fields given that a preset may contain (see presetFields), which are small,
+// so that the preset of the request can be applied beneath them (see applyPreset) without keeping the whole body.
+func (r *renderRequestJSON) decode(reader io.Reader) (Preset, error) {
+	iter := jsoniter.Parse(jsoniter.ConfigDefault, reader, 512)
+	if iter.WhatIsNext() == jsoniter.InvalidValue && iter.Error == io.EOF {
+		// an empty body, as reported by jsoniter.Decoder
+		return nil, io.EOF
+	}
+	given := Preset{}
+	value := reflect.ValueOf(r).Elem()
+	var err error
+	iter.ReadObjectCB(func(iter *jsoniter.Iterator, key string) bool {
+		field, exists := jsonField(value.Type(), key)
+		if !exists {
+			iter.Skip()
+			return true
+		}
+		target := value.FieldByIndex(field.Index).Addr().Interface()
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !presetFields[name] {
+			iter.ReadVal(target)
+			return true
+		}
+		raw := append(json.RawMessage(nil), iter.SkipAndReturnBytes()...)
+		if iter.Error != nil {
+			return false
+		}
+		given[name] = raw
+		err = jsoniter.Unmarshal(raw, target)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if iter.Error != nil {
+		return nil, iter.Error
+	}
+	if iter.WhatIsNext() != jsoniter.InvalidValue || iter.Error != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	r.decoded()
+	return given, nil
+}
+
+// decoded assigns the decoded choropleth to the RenderRequest
+func (r *renderRequestJSON) decoded() {
+	r.RenderRequest.Choropleth = nil
+	if r.Choropleth != nil {
+		if r.Choropleth.Choropleth == nil {
+			r.Choropleth.Choropleth = &Choropleth{}
+		}
+		r.RenderRequest.Choropleth = r.Choropleth.Choropleth
+	}
+}
+
+// isEmpty returns true if no fields were decoded
+func (r *renderRequestJSON) isEmpty() bool {
+	return len(r.SchemaVersion) == 0 && r.Choropleth == nil && reflect.DeepEqual(*r.RenderRequest, RenderRequest{})
+}
+
+// migration upgrades the json of a render request by one schema version
+type migration func(r *renderRequestJSON) error
+
+// renderRequestMigrations holds the migrations in order - the migration at index i upgrades from version i+1 to version i+2
+var renderRequestMigrations = []migration{
+	migrateReferenceLines,
+}
+
+// migrateRenderRequest upgrades the request to CurrentSchemaVersion, recording the original version in OriginalSchemaVersion.
+// Fields that are only part of older schema versions are ignored in requests using the current version.
+func migrateRenderRequest(r *renderRequestJSON) error {
+	version := 1
+	if len(r.SchemaVersion) > 0 {
+		if err := json.Unmarshal(r.SchemaVersion, &version); err != nil {
+			return fmt.Errorf("schema_version must be an integer: schema_version=%s", r.SchemaVersion)
+		}
+	}
+	if version < 1 || version > CurrentSchemaVersion {
+		return fmt.Errorf("Unsupported schema_version - the current version is %d: schema_version=%v", CurrentSchemaVersion, version)
+	}
+
+	for _, migrate := range renderRequestMigrations[version-1:] {
+		if err := migrate(r); err != nil {
+			return err
+		}
+	}
+	r.OriginalSchemaVersion = version
+	r.RenderRequest.SchemaVersion = CurrentSchemaVersion
+	return nil
+}
+
+// migrateReferenceLines (version 1 to 2) replaces choropleth.reference_value and choropleth.reference_value_text with a single entry in choropleth.reference_lines
+func migrateReferenceLines(r *renderRequestJSON) error {
+	c := r.Choropleth
+	if c == nil || (c.ReferenceValue == nil && c.ReferenceValueText == nil) {
+		return nil
+	}
+	line := &ReferenceLine{}
+	if c.ReferenceValue != nil {
+		line.Value = *c.ReferenceValue
+	}
+	if c.ReferenceValueText != nil {
+		line.Text = *c.ReferenceValueText
+	}
+	c.ReferenceLines = []*ReferenceLine{line}
+	return nil
+}
@@ -1,14 +1,18 @@
 package models
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/ONSdigital/go-ns/log"
-	"github.com/json-iterator/go"
+	"github.com/paulmach/go.geojson"
 	"github.com/rubenv/topojson"
 )
 
@@ -16,72 +20,366 @@ import (
 var (
 	ErrorReadingBody = errors.New("Failed to read message body")
 	ErrorNoData      = errors.New("Bad request - Missing data in body")
+	ErrorTruncated   = errors.New("unexpected end of JSON input")
 )
 
-// possible values for the 2 LegendPositions. 'None' is the default.
-var (
+// possible values for the 2 LegendPositions. 'None' (or empty) is the default.
+const (
 	LegendPositionBefore = "before"
 	LegendPositionAfter  = "after"
+	LegendPositionNone   = "none"
+)
+
+// possible values for the LegendFormat. 'svg' (or empty) is the default.
+const (
+	LegendFormatSVG  = "svg"
+	LegendFormatHTML = "html"
+)
+
+// possible values for the KeySwatch. 'rect' (or empty) is the default.
+const (
+	KeySwatchRect   = "rect"
+	KeySwatchCircle = "circle"
+	KeySwatchLine   = "line"
+)
+
+// possible values for the Mode of a Change. 'absolute' (or empty) is the default.
+const (
+	ChangeModeAbsolute        = "absolute"
+	ChangeModePercentagePoint = "percentage_point"
+)
+
+// possible values for the Symbol of a PointMarker. 'circle' (or empty) is the default.
+const (
+	MarkerSymbolCircle   = "circle"
+	MarkerSymbolSquare   = "square"
+	MarkerSymbolTriangle = "triangle"
+	MarkerSymbolPin      = "pin"
+)
+
+// MaxMarkerSize is the largest Size of a PointMarker
+const MaxMarkerSize = 100
+
+// possible values for the NorthArrow - the corner of the map in which it is drawn. Empty (the default) for no north arrow.
+const (
+	CornerTopLeft     = "top-left"
+	CornerTopRight    = "top-right"
+	CornerBottomLeft  = "bottom-left"
+	CornerBottomRight = "bottom-right"
+)
+
+// MapTypeChoropleth is the default MapType
+const MapTypeChoropleth = "choropleth"
+
+// The range of class counts for which the analyser calculates breaks
+const (
+	MinClassCount = 2
+	MaxClassCount = 11
+)
+
+// MinGraticuleInterval is the smallest interval (in degrees) between the lines of a Graticule
+const MinGraticuleInterval = 0.01
+
+// MaxHistogramBins is the maximum number of histogram bins that may be requested from the analyser
+const MaxHistogramBins = 1000
+
+// Defaults applied to a RenderRequest when it is created (unless changed by UseDefaults)
+const (
+	DefaultViewBoxWidth = 400.0 // the width of the svg viewBox when no width is specified in the request
+	DefaultFontSize     = 14    // the default font size on the ons site
+)
+
+var (
+	defaultViewBoxWidth = DefaultViewBoxWidth
+	defaultFontSize     = DefaultFontSize
 )
 
+// UseDefaults sets the width of the svg viewBox and the font size applied to a RenderRequest that does not specify them.
+// A value of 0 (or less) restores DefaultViewBoxWidth or DefaultFontSize respectively.
+func UseDefaults(viewBoxWidth float64, fontSize int) {
+	defaultViewBoxWidth, defaultFontSize = DefaultViewBoxWidth, DefaultFontSize
+	if viewBoxWidth > 0 {
+		defaultViewBoxWidth = viewBoxWidth
+	}
+	if fontSize > 0 {
+		defaultFontSize = fontSize
+	}
+}
+
 // RenderRequest represents a structure for a map render job
 type RenderRequest struct {
-	Title              string      `json:"title,omitempty"`
-	Subtitle           string      `json:"subtitle,omitempty"`
-	Source             string      `json:"source,omitempty"`
-	SourceLink         string      `json:"source_link,omitempty"`
-	Licence            string      `json:"licence,omitempty"`
-	Filename           string      `json:"filename,omitempty"`
-	Footnotes          []string    `json:"footnotes,omitempty"`
-	MapType            string      `json:"map_type,omitempty"`
-	Geography          *Geography  `json:"geography,omitempty"`
-	Data               []*DataRow  `json:"data,omitempty"` // ID's in Data should match values of IDProperty in Geography
-	Choropleth         *Choropleth `json:"choropleth,omitempty"`
-	DefaultWidth       float64     `json:"width,omitempty"`     // used when determining the viewBox dimensions and the switch point between displaying the horizontal and vertical legends in responsive design. Optional if min and max width specified
-	MinWidth           float64     `json:"min_width,omitempty"` // the minimum width in a responsive design. optional.
-	MaxWidth           float64     `json:"max_width,omitempty"` // the maximum width in a responsive design. Required if min width specified.
-	IncludeFallbackPng bool        `json:"include_fallback_png"`
-	FontSize           int         `json:"font_size"`
-}
-
-// Geography holds the topojson topology and supporting information
+	SchemaVersion         int               `json:"schema_version,omitempty"` // the version of the schema of the request - older versions are migrated to the current version on creation
+	OriginalSchemaVersion int               `json:"-"`                        // the schema version of the request before migration
+	Title                 string            `json:"title,omitempty"`
+	Subtitle              string            `json:"subtitle,omitempty"`
+	Source                string            `json:"source,omitempty"`
+	SourceLink            string            `json:"source_link,omitempty"`
+	Licence               string            `json:"licence,omitempty"`
+	Filename              string            `json:"filename,omitempty"`
+	ElementID             string            `json:"element_id,omitempty"` // optional - used (instead of Filename) as the prefix of all element ids, so that they are stable if the map is renamed
+	Footnotes             []string          `json:"footnotes,omitempty"`
+	MapType               string            `json:"map_type,omitempty"` // the type of map to render - defaults to choropleth
+	Geography             *Geography        `json:"geography,omitempty"`
+	GeographyID           string            `json:"geography_id,omitempty"` // the id of a registered geography - an alternative to Geography
+	Data                  []*DataRow        `json:"data,omitempty"`         // ID's in Data should match values of IDProperty in Geography
+	Choropleth            *Choropleth       `json:"choropleth,omitempty"`
+	DefaultWidth          float64           `json:"width,omitempty"`     // used when determining the viewBox dimensions and the switch point between displaying the horizontal and vertical legends in responsive design. Optional if min and max width specified
+	MinWidth              float64           `json:"min_width,omitempty"` // the minimum width in a responsive design. optional. Must not be greater than max width.
+	MaxWidth              float64           `json:"max_width,omitempty"` // the maximum width in a responsive design. Required if min width specified - defaults to width if it is not less than min width.
+	IncludeFallbackPng    bool              `json:"include_fallback_png"`
+	FontSize              int               `json:"font_size"`
+	FontFamily            string            `json:"font_family,omitempty"`                   // optional - the font family (or css font-family list) of the page showing the map, used to select the font metrics used to measure text
+	IDNormalisation       *IDNormalisation  `json:"id_normalisation,omitempty"`              // optional normalisation applied when matching IDs in Data to the Geography
+	RegionStyles          map[string]string `json:"region_styles,omitempty"`                 // optional css declarations for individual regions (by ID), applied after the choropleth colour. Only fill, stroke, stroke-width, opacity and fill-opacity are allowed
+	Annotations           []*Annotation     `json:"annotations,omitempty"`                   // optional labelled markers drawn on top of the map
+	AnnotationsInBounds   bool              `json:"include_annotations_in_bounds,omitempty"` // if true, the map is sized and positioned to include the annotations as well as the geography
+	IncludeCIAttributes   bool              `json:"include_ci_attributes,omitempty"`         // if true, the confidence interval of each region is added to its path as data-ci-lower and data-ci-upper attributes
+	Minify                bool              `json:"minify,omitempty"`                        // if true, the svgs are minified - coordinates are rounded and redundant attributes and whitespace removed
+	LowDetail             bool              `json:"low_detail,omitempty"`                    // if true, a responsive svg also contains simplified copies of the regions, which the page displays instead when the map is at its min width
+	ShowScaleBar          bool              `json:"show_scale_bar,omitempty"`                // if true, a scale bar (a round distance in km, measured at the middle latitude of the map) is drawn in the bottom left corner of the map
+	NorthArrow            string            `json:"north_arrow,omitempty"`                   // optional - the corner of the map in which to draw a north arrow: top-left, top-right, bottom-left or bottom-right
+	Tooltips              bool              `json:"tooltips,omitempty"`                      // if true, each region has a hidden tooltip (showing its title) that the page shows on hover or focus - omitted from pngs
+	LineStyle             *LineStyle        `json:"line_style,omitempty"`                    // optional stroke of the line features of the geography (e.g. rivers or railways), which are otherwise drawn as regions
+	PointMarker           *PointMarker      `json:"point_marker,omitempty"`                  // optional symbol drawn at the point features of the geography, which are otherwise drawn as 1px circles
+	Graticule             *Graticule        `json:"graticule,omitempty"`                     // optional lines of latitude and longitude drawn beneath the regions
+	OverlayGeography      *Geography        `json:"overlay_geography,omitempty"`             // optional boundaries (e.g. of larger areas) drawn without fill on top of the regions - not matched to the data
+	PlaceLabels           []*PlaceLabel     `json:"place_labels,omitempty"`                  // optional place names (e.g. cities) drawn on top of the regions, to help readers orient themselves
+	FocusRegionID         string            `json:"focus_region_id,omitempty"`               // optional - the id of the region on which a pan-zoom view of the map should initially be centred
+	EnablePanZoom         *bool             `json:"enable_pan_zoom,omitempty"`               // optional - if false, the svg is marked as static so that the page does not add pan-zoom to it. Defaults to true (see PanZoomEnabled)
+	PanZoomOptions        *PanZoomOptions   `json:"pan_zoom_options,omitempty"`              // optional options passed (via the svg) to the pan-zoom of the page, in place of its defaults
+	CompareData           []*DataRow        `json:"compare_data,omitempty"`                  // optional data of an earlier period - if given, the map shows the change from CompareData to Data
+	Change                *Change           `json:"change,omitempty"`                        // optional - how the change from CompareData to Data is calculated and labelled
+	DataSets              []*DataSet        `json:"data_sets,omitempty"`                     // optional sets of data (e.g. for several periods) between which the reader may switch - the first is drawn, and replaces Data
+	PresetID              string            `json:"preset_id,omitempty"`                     // optional - the id of a stored Preset of presentation fields, which apply where the request does not give the field
+}
+
+// DataSet is one of several labelled sets of data for the regions of a map (see RenderRequest.DataSets)
+type DataSet struct {
+	Label string     `json:"label"`
+	Data  []*DataRow `json:"data"`
+}
+
+// Change describes how the change from the CompareData to the Data of a request is calculated and labelled in the titles of the regions
+type Change struct {
+	Mode         string `json:"mode,omitempty"`          // absolute (the default) - in the units of the values, or percentage_point - for values that are percentages
+	Label        string `json:"label,omitempty"`         // the label of the Data in titles (e.g. "2021") - defaults to DefaultChangeLabel
+	CompareLabel string `json:"compare_label,omitempty"` // the label of the CompareData in titles (e.g. "2011") - defaults to DefaultCompareLabel
+}
+
+// The default labels of the Data and CompareData of a Change
+const (
+	DefaultChangeLabel  = "Current"
+	DefaultCompareLabel = "Previous"
+)
+
+// Geography holds the topojson topology (or geojson feature collection) and supporting information
 type Geography struct {
-	Topojson     *topojson.Topology `json:"topojson,omitempty"`
-	IDProperty   string             `json:"id_property,omitempty"`
-	NameProperty string             `json:"name_property,omitempty"`
+	Topojson     *topojson.Topology         `json:"topojson,omitempty"`
+	Geojson      *geojson.FeatureCollection `json:"geojson,omitempty"` // an alternative to Topojson - exactly one of the two must be provided
+	IDProperty   string                     `json:"id_property,omitempty"`
+	NameProperty string                     `json:"name_property,omitempty"`
 }
 
 // DataRow holds a single row of data.
 type DataRow struct {
-	ID    string  `json:"id,omitempty"`
-	Value float64 `json:"value,omitempty"`
+	ID      string   `json:"id,omitempty"`
+	Value   float64  `json:"value"`
+	LowerCI *float64 `json:"lower_ci,omitempty"` // optional lower bound of the confidence interval - must be given with upper_ci
+	UpperCI *float64 `json:"upper_ci,omitempty"` // optional upper bound of the confidence interval - must be given with lower_ci
+	// DisplayValue is optional text shown in place of the value in the title of the region (e.g. "fewer than 5"), which is still coloured by its Value
+	DisplayValue string `json:"display_value,omitempty"`
+	// FootnoteRefs are the (1-based) numbers of the Footnotes of the request that apply to the row, shown as markers in the title of the region
+	FootnoteRefs []int `json:"footnote_refs,omitempty"`
+	// Missing marks a row whose region has no value (its Value is ignored), so it is drawn as missing data, but with its Reason
+	// (e.g. "data suppressed") in its title in place of the generic text
+	Missing bool   `json:"missing,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// HasConfidenceInterval returns true if both bounds of the confidence interval are given
+func (d *DataRow) HasConfidenceInterval() bool {
+	return d.LowerCI != nil && d.UpperCI != nil
 }
 
 // Choropleth contains details required to create a choropleth map
 type Choropleth struct {
-	ReferenceValue           float64            `json:"reference_value,omitempty"`
-	ReferenceValueText       string             `json:"reference_value_text,omitempty"`
+	ReferenceLines           []*ReferenceLine   `json:"reference_lines,omitempty"` // only the first reference line is currently drawn in the legend
 	ValuePrefix              string             `json:"value_prefix,omitempty"`
 	ValueSuffix              string             `json:"value_suffix,omitempty"`
-	Breaks                   []*ChoroplethBreak `json:"breaks,omitempty"`
-	UpperBound               float64            `json:"upper_bound,omitempty"`                 // used only in displaying the upperbound in the legend
-	HorizontalLegendPosition string             `json:"horizontal_legend_position, omitempty"` // before, after or none (the default)
-	VerticalLegendPosition   string             `json:"vertical_legend_position, omitempty"`   // before, after or none (the default)
+	DisplayValueOnly         bool               `json:"display_value_only,omitempty"`         // if true, the display values of the data are shown without the value prefix and suffix
+	Breaks                   []*ChoroplethBreak `json:"breaks,omitempty"`                     // optional - if omitted, natural breaks are computed from the data
+	ClassCount               int                `json:"class_count,omitempty"`                // optional - the number of breaks computed when none are given, otherwise the best fit
+	Palette                  *ChoroplethPalette `json:"palette,omitempty"`                    // optional - used to colour any breaks without a colour
+	UpperBound               float64            `json:"upper_bound"`                          // used only in displaying the upperbound in the legend
+	HorizontalLegendPosition string             `json:"horizontal_legend_position,omitempty"` // before, after or none (the default)
+	VerticalLegendPosition   string             `json:"vertical_legend_position,omitempty"`   // before, after or none (the default)
+	LegendFormat             string             `json:"legend_format,omitempty"`              // svg (the default) or html - an ordered list in place of the svg legends (the png legends are always svg)
+	KeySwatch                string             `json:"key_swatch,omitempty"`                 // the shape of the colour samples in the svg legends - rect (the default), circle or line
+	ShowClassSummary         bool               `json:"show_class_summary,omitempty"`         // if true, the html figure includes a summary of the number of areas in each class beneath the key
+}
+
+// LineStyle is the stroke of the LineString and MultiLineString features of a geography, which are drawn without a fill
+type LineStyle struct {
+	Stroke      string  `json:"stroke,omitempty"`       // optional - a colour (as for a break's colour) or none
+	StrokeWidth float64 `json:"stroke_width,omitempty"` // optional - the width of the lines, in the units of the viewBox
+	DashArray   string  `json:"dash_array,omitempty"`   // optional - the lengths of the dashes and gaps of a dashed line, e.g. "4 2"
+	Class       string  `json:"class,omitempty"`        // optional additional class name(s) applied to the lines
+}
+
+// PointMarker is the symbol drawn at each point feature of a geography.
+// A feature may override it with the marker-symbol, marker-size and marker-color properties of the simplestyle-spec.
+type PointMarker struct {
+	Symbol string  `json:"symbol,omitempty"` // optional - circle (the default), square, triangle or pin
+	Size   float64 `json:"size,omitempty"`   // optional - the width and height of the symbol, in the units of the viewBox
+	Colour string  `json:"color,omitempty"`  // optional - the fill of the symbol, where the point is not coloured by its data
+}
+
+// Graticule is a grid of lines of latitude and longitude at a regular interval, drawn across the extent of the map beneath the regions
+type Graticule struct {
+	IntervalDegrees float64 `json:"interval_degrees"`
+	Class           string  `json:"class,omitempty"` // optional additional class name(s) applied to the lines
+}
+
+// Annotation is a labelled marker drawn at the given coordinates on top of the map
+type Annotation struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+	Label     string  `json:"label,omitempty"`
+	Class     string  `json:"class,omitempty"` // optional additional class name(s) applied to the annotation
+}
+
+// PlaceLabel is the name of a place drawn (with a dot) at the given coordinates on top of the regions.
+// Labels with a Tier are only drawn on maps at least Tier * PlaceLabelTierWidth wide, so that small maps are not cluttered.
+type PlaceLabel struct {
+	Name      string  `json:"name"`
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+	Size      int     `json:"size,omitempty"` // optional font size of the name (in pixels), otherwise slightly smaller than the font size of the map
+	Tier      int     `json:"tier,omitempty"` // optional - 0 (the default) for a label drawn at any width
+}
+
+// PlaceLabelTierWidth is the width of the map (see RenderRequest.DefaultWidth) per tier of a PlaceLabel, at or above which labels of that tier are drawn
+const PlaceLabelTierWidth = 300
+
+// PanZoomOptions are the options of the pan-zoom added to the map by the page. Options that are not given keep the page's defaults.
+type PanZoomOptions struct {
+	MinZoom               *float64 `json:"min_zoom,omitempty"`               // the minimum zoom - the page's default is 0.75
+	MaxZoom               *float64 `json:"max_zoom,omitempty"`               // the maximum zoom - the page's default is 100
+	ZoomScaleSensitivity  *float64 `json:"zoom_scale_sensitivity,omitempty"` // the change in zoom of each zoom step - the page's default is 0.4
+	MouseWheelZoomEnabled *bool    `json:"mouse_wheel_zoom_enabled,omitempty"`
+	ControlIconsEnabled   *bool    `json:"control_icons_enabled,omitempty"`
+	DblClickZoomEnabled   *bool    `json:"dbl_click_zoom_enabled,omitempty"`
+}
+
+// The ranges of the numeric PanZoomOptions
+const (
+	MinPanZoomZoom        = 0.01
+	MaxPanZoomZoom        = 1000.0
+	MinPanZoomSensitivity = 0.01
+	MaxPanZoomSensitivity = 1.0
+)
+
+// ReferenceLine is a value marked on the legend, e.g. a national average
+type ReferenceLine struct {
+	Value float64 `json:"value"`
+	Text  string  `json:"text,omitempty"` // the label for the line - the line is only drawn if it has a label
 }
 
 // ChoroplethBreak represents a single break - the point at which a colour changes
 type ChoroplethBreak struct {
-	LowerBound float64 `json:"lower_bound"` // the lower bound for this colour
-	Colour     string  `json:"color,omitempty"`
+	LowerBound float64  `json:"lower_bound"` // the lower bound for this colour
+	Colour     string   `json:"color,omitempty"`
+	Opacity    *float64 `json:"opacity,omitempty"` // optional - the opacity (0-1) of the colour on the map and in the key, e.g. to let a basemap show through the lowest class
 }
 
 // AnalyseRequest represents the structure of a request to analyse data and ensure it matches a topology
 type AnalyseRequest struct {
-	Geography    *Geography `json:"geography"`
-	CSV          string     `json:"csv"`
-	IDIndex      int        `json:"id_index"`
-	ValueIndex   int        `json:"value_index"`
-	HasHeaderRow bool       `json:"has_header_row"`
+	Geography       *Geography       `json:"geography"`
+	GeographyID     string           `json:"geography_id,omitempty"` // the id of a registered geography - an alternative to Geography
+	CSV             string           `json:"csv"`
+	IDIndex         *int             `json:"id_index,omitempty"` // optional - if omitted, the column whose values best match the ids of the geography is used
+	ValueIndex      int              `json:"value_index"`
+	HasHeaderRow    bool             `json:"has_header_row"`
+	ClassCount      int              `json:"class_count,omitempty"`      // an explicitly requested number of classes, for which palettes will be suggested in addition to the best fit class count
+	ExcludeOutliers bool             `json:"exclude_outliers,omitempty"` // if true, outlying values are excluded when calculating breaks (but are still returned in the data)
+	IDNormalisation *IDNormalisation `json:"id_normalisation,omitempty"` // optional normalisation applied when matching IDs in the csv to the topology
+	XLSX            []byte           `json:"xlsx,omitempty"`             // an xlsx file that may be provided instead of the csv
+	SheetName       string           `json:"sheet_name,omitempty"`       // the name of the sheet to read from the xlsx file
+	SheetIndex      int              `json:"sheet_index,omitempty"`      // the index of the sheet to read from the xlsx file, if no sheet_name is given
+	// ClassCountWeighting (0-1) is the weighting given to having fewer classes, as opposed to a better fit, when suggesting the best fit class count. Defaults to 0.2
+	ClassCountWeighting *float64 `json:"class_count_weighting,omitempty"`
+	HistogramBins       int      `json:"histogram_bins,omitempty"` // the number of bins in the histogram of values. Defaults to 30
+	// Reference is the id of a row (e.g. "K02000001" for the UK) whose value is the reference value suggested in the response, or ReferenceMean or ReferenceMedian.
+	// A row that is not in the geography is excluded from the data.
+	Reference string `json:"reference,omitempty"`
+	// MissingValueReasons optionally maps values that mark a row as missing (e.g. "[c]" or "..") to the reason shown in the title of its region
+	// (e.g. "data suppressed"). Such rows are returned as Missing rows with the Reason, rather than reported as having missing values.
+	MissingValueReasons map[string]string `json:"missing_value_reasons,omitempty"`
+	// CandidateBreaks are optional sets of breaks (the ascending lower bound of each class) to evaluate against the data, in addition to the suggested breaks
+	CandidateBreaks [][]float64 `json:"candidate_breaks,omitempty"`
+}
+
+// The references that may be requested in place of the id of a row (see AnalyseRequest.Reference)
+const (
+	ReferenceMean   = "mean"
+	ReferenceMedian = "median"
+)
+
+// IDNormalisation specifies how IDs are normalised before matching data to a topology
+type IDNormalisation struct {
+	Trim              bool `json:"trim,omitempty"`                // remove leading and trailing whitespace
+	CaseInsensitive   bool `json:"case_insensitive,omitempty"`    // ignore differences in case
+	StripLeadingZeros bool `json:"strip_leading_zeros,omitempty"` // ignore leading zeros
+}
+
+// Normalise returns the id normalised according to the options. A nil IDNormalisation returns the id unchanged.
+func (n *IDNormalisation) Normalise(id string) string {
+	if n == nil {
+		return id
+	}
+	if n.Trim {
+		id = strings.TrimSpace(id)
+	}
+	if n.CaseInsensitive {
+		id = strings.ToLower(id)
+	}
+	if n.StripLeadingZeros {
+		stripped := strings.TrimLeft(id, "0")
+		if len(stripped) == 0 && len(id) > 0 {
+			stripped = "0"
+		}
+		id = stripped
+	}
+	return id
+}
+
+// IsEnabled returns true if any normalisation option is set
+func (n *IDNormalisation) IsEnabled() bool {
+	return n != nil && (n.Trim || n.CaseInsensitive || n.StripLeadingZeros)
+}
+
+// FormatID returns the canonical string form of a feature id (or id property value) found in a geography, and true if it is a string or number.
+// Strings are returned unchanged; numbers are formatted without an exponent or trailing zeros, so 101 (or 101.0) becomes "101" and 1.5 becomes "1.5".
+// Numeric ids in the data must use the same form to be matched.
+func FormatID(id interface{}) (string, bool) {
+	switch v := id.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64), true
+		}
+		return v.String(), true
+	}
+	return "", false
 }
 
 // AnalyseResponse represents the structure of an analyse data response
@@ -92,48 +390,264 @@ type AnalyseResponse struct {
 	BestFitClassCount int         `json:"best_fit_class_count"`
 	MinValue          float64     `json:"min_value"`
 	MaxValue          float64     `json:"max_value"`
+	// SuggestedDecimalPlaces is the number of decimal places needed to display the values and breaks in the legend
+	SuggestedDecimalPlaces int  `json:"suggested_decimal_places"`
+	AllIntegers            bool `json:"all_integers"`
+	// Palettes are suggested colour palettes, sized to the best fit class count and the requested class count
+	Palettes   []*PaletteSuggestion `json:"palettes"`
+	Statistics *Statistics          `json:"statistics"`
+	// DivergingBreaks is a symmetric set of breaks centred on zero - only provided when the data contains both negative and positive values
+	DivergingBreaks []float64 `json:"diverging_breaks,omitempty"`
+	// Choropleths are ready to use in a RenderRequest - the best fit breaks (and those for the requested class count), coloured using the first suggested palette
+	Choropleths []*Choropleth `json:"choropleths"`
+	// SuggestedMappings are possible matches between csv ids and topology names - only provided when most rows could not be matched
+	SuggestedMappings []*IDMapping     `json:"suggested_mappings,omitempty"`
+	TopologySummary   *TopologySummary `json:"topology_summary"`
+	// FitMetrics describe how well the breaks for each class count fit the data - as used to determine the BestFitClassCount
+	FitMetrics []*FitMetric `json:"fit_metrics"`
+	Histogram  *Histogram   `json:"histogram"`
+	// ReferenceLine is the value (and suggested text) of the Reference of the request, as also given in the Choropleths - only provided if a reference is requested
+	ReferenceLine *ReferenceLine `json:"reference_line,omitempty"`
+}
+
+// Histogram counts the number of values in equal-width bins between the minimum and maximum value
+type Histogram struct {
+	Edges  []float64 `json:"edges"`  // the edges of the bins - one more than the number of bins
+	Counts []int     `json:"counts"` // the number of values in each bin (including the lower edge, and the maximum value in the last bin)
+}
+
+// FitMetric describes how well the breaks for a number of classes fit the data
+type FitMetric struct {
+	ClassCount            int     `json:"class_count"`
+	GoodnessOfVarianceFit float64 `json:"goodness_of_variance_fit"` // 0 is no fit, 1 a perfect fit
+	Fitness               float64 `json:"fitness"`                  // the goodness of fit combined with a score for having fewer classes - the highest is the best fit
+}
+
+// TopologySummary describes the features in the topology
+type TopologySummary struct {
+	FeatureCount    int               `json:"feature_count"`
+	DistinctIDCount int               `json:"distinct_id_count"` // less than FeatureCount if any features share an id
+	IDProperty      string            `json:"id_property"`       // the property used to identify features
+	BoundingBox     []float64         `json:"bounding_box"`      // [minX, minY, maxX, maxY]
+	GeometryTypes   []string          `json:"geometry_types"`
+	LargestFeatures []*FeatureSummary `json:"largest_features"` // the (up to) five largest features by area
+}
+
+// FeatureSummary identifies a feature in the topology, with its area
+type FeatureSummary struct {
+	ID   string  `json:"id"`
+	Name string  `json:"name,omitempty"`
+	Area float64 `json:"area"` // the area of the feature in the (unprojected) units of the topology, e.g. square degrees
 }
 
-// Message represents a message with a level type
+// IDMapping is a suggested mapping from a value in the id column of the csv to an id in the topology, found by matching the value to a name in the topology
+type IDMapping struct {
+	CSVValue     string  `json:"csv_value"`
+	TopologyID   string  `json:"topology_id"`
+	TopologyName string  `json:"topology_name"`
+	Confidence   float64 `json:"confidence"` // between 0 and 1, where 1 is an exact match of the (normalised) name
+}
+
+// Statistics contains summary statistics for the values in the data
+type Statistics struct {
+	Count             int     `json:"count"`
+	Mean              float64 `json:"mean"`
+	Median            float64 `json:"median"`
+	StandardDeviation float64 `json:"standard_deviation"` // the population standard deviation
+	LowerQuartile     float64 `json:"lower_quartile"`
+	UpperQuartile     float64 `json:"upper_quartile"`
+	DistinctValues    int     `json:"distinct_values"`
+}
+
+// PaletteSuggestion is a named colour palette sized for a particular number of classes
+type PaletteSuggestion struct {
+	Name            string   `json:"name"`
+	Type            string   `json:"type"` // sequential or diverging
+	ClassCount      int      `json:"class_count"`
+	Colours         []string `json:"colors"`
+	ColourBlindSafe bool     `json:"color_blind_safe"`
+	// Warnings describe any classes of the palette that may be hard to tell apart (see colour.CheckPalette)
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Message represents a message with a level type.
+// Code, Count and Details are optional structured information about the message, with Text providing a readable summary.
 type Message struct {
-	Level string `json:"level"`
-	Text  string `json:"text"`
+	Level     string   `json:"level"`
+	Text      string   `json:"text"`
+	Code      string   `json:"code,omitempty"`
+	Count     int      `json:"count,omitempty"`     // the number of items (e.g. rows) the message refers to
+	Details   []string `json:"details,omitempty"`   // the items (e.g. row ids) the message refers to - limited in number
+	Truncated bool     `json:"truncated,omitempty"` // true if Details does not include every item
 }
 
-// CreateRenderRequest manages the creation of a RenderRequest from a reader
+// The codes used in messages returned by the analyser
+const (
+	MessageCodeMissingColumns       = "missing_columns"
+	MessageCodeMissingValues        = "missing_values"
+	MessageCodeUnmatchedIDs         = "unmatched_ids"
+	MessageCodeSuggestedMappings    = "suggested_mappings"
+	MessageCodeNormalisedIDs        = "normalised_ids"
+	MessageCodeOutliers             = "outliers"
+	MessageCodeProcessed            = "processed"
+	MessageCodeSampled              = "sampled"
+	MessageCodeDivergingData        = "diverging_data"
+	MessageCodeDuplicateTopologyIDs = "duplicate_topology_ids"
+	MessageCodeMissingIDProperty    = "missing_id_property"
+	MessageCodeMissingReference     = "missing_reference"
+	MessageCodeDetectedIDColumn     = "detected_id_column"
+	MessageCodeEmptyClasses         = "empty_classes"
+	MessageCodeMissingWithReason    = "missing_with_reason"
+	MessageCodeNoPalette            = "no_palette"
+)
+
+// CreateRenderRequest manages the creation of a RenderRequest from a reader, decoding the json as it is read.
+// Requests using an older schema_version are migrated to CurrentSchemaVersion.
+// The fields of the preset with the request's preset_id (see UsePresetLookup) apply where the request does not give the field.
+// Only the json of the fields that a preset may contain is kept as it is decoded, not the whole body.
 func CreateRenderRequest(reader io.Reader) (*RenderRequest, error) {
 
-	bytes, err := ioutil.ReadAll(reader)
-	if err != nil {
-		log.Error(err, log.Data{"request_body": string(bytes)})
+	body := &bodyReader{reader: reader}
+	request := &RenderRequest{}
+	fields := newRenderRequestJSON(request)
+	given, err := fields.decode(body)
+	if body.err != nil {
+		log.Error(body.err, nil)
 		return nil, ErrorReadingBody
 	}
-
-	var request RenderRequest
-	err = jsoniter.Unmarshal(bytes, &request)
 	if err != nil {
-		log.Error(err, log.Data{"request_body": string(bytes)})
+		log.Error(err, nil)
 		return nil, err
 	}
+	fields.decoded()
 
-	// This should be the last check before returning RenderRequest
-	if len(bytes) == 2 {
-		return &request, ErrorNoData
+	// This should be the last check of the content before applying defaults
+	isEmpty := fields.isEmpty()
+
+	if len(request.PresetID) > 0 {
+		if err = fields.applyPreset(given); err != nil {
+			log.Error(err, nil)
+			return nil, err
+		}
 	}
 
-	return &request, nil
+	if err = migrateRenderRequest(fields); err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	request.setDefaults()
+
+	if isEmpty {
+		return request, ErrorNoData
+	}
+
+	return request, nil
+}
+
+// bodyReader records any error (other than EOF) returned by the underlying reader, so that it can be distinguished from a decoding error
+type bodyReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// checkEndOfJSON returns an error if anything other than whitespace follows the json value read by a decoder (as json.Unmarshal does),
+// given the input buffered by the decoder and the reader it was reading from
+func checkEndOfJSON(buffered io.Reader, reader io.Reader) error {
+	rest := bufio.NewReader(io.MultiReader(buffered, reader))
+	for {
+		c, err := rest.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return fmt.Errorf("invalid character %q after top-level value", c)
+		}
+	}
+}
+
+// setDefaults fills in the documented defaults for any optional fields that have not been given, so that the renderer can rely on them:
+// MaxWidth (see setDefaultMaxWidth); DefaultWidth - the average of MinWidth and MaxWidth, or the default viewBox width;
+// FontSize - the default font size (see UseDefaults); MapType - MapTypeChoropleth; the legend positions - LegendPositionNone;
+// the LegendFormat - LegendFormatSVG; the KeySwatch - KeySwatchRect; and Data - the data of the first of the DataSets, if there are any.
+func (r *RenderRequest) setDefaults() {
+	r.setDefaultMaxWidth()
+	if len(r.DataSets) > 0 && r.DataSets[0] != nil {
+		r.Data = r.DataSets[0].Data
+	}
+	if len(r.MapType) == 0 {
+		r.MapType = MapTypeChoropleth
+	}
+	if r.DefaultWidth <= 0 {
+		r.DefaultWidth = (r.MinWidth + r.MaxWidth) / 2
+	}
+	if r.DefaultWidth <= 0 {
+		r.DefaultWidth = defaultViewBoxWidth
+	}
+	if r.FontSize <= 0 {
+		r.FontSize = defaultFontSize
+	}
+	if r.Choropleth != nil {
+		if len(r.Choropleth.HorizontalLegendPosition) == 0 {
+			r.Choropleth.HorizontalLegendPosition = LegendPositionNone
+		}
+		if len(r.Choropleth.VerticalLegendPosition) == 0 {
+			r.Choropleth.VerticalLegendPosition = LegendPositionNone
+		}
+		if len(r.Choropleth.LegendFormat) == 0 {
+			r.Choropleth.LegendFormat = LegendFormatSVG
+		}
+		if len(r.Choropleth.KeySwatch) == 0 {
+			r.Choropleth.KeySwatch = KeySwatchRect
+		}
+	}
+}
+
+// PanZoomEnabled returns true unless EnablePanZoom has been set to false
+func (r *RenderRequest) PanZoomEnabled() bool {
+	return r.EnablePanZoom == nil || *r.EnablePanZoom
+}
+
+// setDefaultMaxWidth defaults MaxWidth to DefaultWidth (or the default viewBox width) when only MinWidth is given,
+// provided the default is not less than MinWidth - otherwise MaxWidth is left unset and validation will reject the request.
+func (r *RenderRequest) setDefaultMaxWidth() {
+	if r.MinWidth <= 0 || r.MaxWidth > 0 {
+		return
+	}
+	width := r.DefaultWidth
+	if width <= 0 {
+		width = defaultViewBoxWidth
+	}
+	if width >= r.MinWidth {
+		r.MaxWidth = width
+	}
 }
 
 // ValidateRenderRequest checks the content of the request structure
 func (r *RenderRequest) ValidateRenderRequest() error {
 
+	if r.Geography != nil && len(r.GeographyID) > 0 {
+		return fmt.Errorf("Only one of geography and geography_id may be provided")
+	}
+
 	var missingFields []string
 
 	if r.Geography == nil {
 		missingFields = append(missingFields, "geography")
 	} else {
-		if r.Geography.Topojson == nil {
-			missingFields = append(missingFields, "geography.topojson")
+		if r.Geography.Topojson == nil && r.Geography.Geojson == nil {
+			missingFields = append(missingFields, "geography.topojson or geography.geojson")
 		}
 		if len(r.Geography.IDProperty) == 0 {
 			missingFields = append(missingFields, "geography.id_property")
@@ -147,27 +661,315 @@ func (r *RenderRequest) ValidateRenderRequest() error {
 	if missingFields != nil {
 		return fmt.Errorf("Missing mandatory field(s): %v", missingFields)
 	}
+	if r.Geography.Topojson != nil && r.Geography.Geojson != nil {
+		return fmt.Errorf("Only one of geography.topojson and geography.geojson may be provided")
+	}
+	if err := checkGeographySize(r.Geography); err != nil {
+		return err
+	}
+	if err := checkTopology(r.Geography); err != nil {
+		return err
+	}
+	if err := r.validateOverlayGeography(); err != nil {
+		return err
+	}
+	if r.MinWidth > 0 && r.MaxWidth <= 0 {
+		return fmt.Errorf("max_width is required when min_width is specified: min_width=%v", r.MinWidth)
+	}
+	if r.MinWidth > 0 && r.MaxWidth < r.MinWidth {
+		return fmt.Errorf("max_width must be >= min_width: min_width=%v, max_width=%v", r.MinWidth, r.MaxWidth)
+	}
+	if len(r.ElementID) > 0 && !validElementID.MatchString(r.ElementID) {
+		return fmt.Errorf("element_id must only contain letters, digits, hyphens and underscores: element_id=%v", r.ElementID)
+	}
+	if len(r.DataSets) == 0 { // otherwise Data is the data of the first data set, which is validated below
+		for i, row := range r.Data {
+			if err := r.validateDataRow(fmt.Sprintf("data[%d]", i), row); err != nil {
+				return err
+			}
+		}
+	}
+	for i, set := range r.DataSets {
+		if set == nil {
+			return fmt.Errorf("data_sets must not contain null: data_sets[%d]", i)
+		}
+		if len(strings.TrimSpace(set.Label)) == 0 {
+			return fmt.Errorf("data_sets[%d].label is required", i)
+		}
+		for j, row := range set.Data {
+			if row == nil {
+				return fmt.Errorf("data_sets[%d].data must not contain null: data[%d]", i, j)
+			}
+			if err := r.validateDataRow(fmt.Sprintf("data_sets[%d].data[%d]", i, j), row); err != nil {
+				return err
+			}
+		}
+	}
+	for i, row := range r.CompareData {
+		if row == nil {
+			return fmt.Errorf("compare_data must not contain null: compare_data[%d]", i)
+		}
+	}
+	if r.Change != nil && !isValidChangeMode(r.Change.Mode) {
+		return fmt.Errorf("change.mode must be one of '%s' or '%s': mode=%v", ChangeModeAbsolute, ChangeModePercentagePoint, r.Change.Mode)
+	}
+	for i, a := range r.Annotations {
+		if a == nil {
+			return fmt.Errorf("annotations must not contain null: annotations[%d]", i)
+		}
+		if a.Longitude < -180 || a.Longitude > 180 || a.Latitude < -90 || a.Latitude > 90 {
+			return fmt.Errorf("annotations[%d] must have a longitude between -180 and 180 and a latitude between -90 and 90: longitude=%v, latitude=%v", i, a.Longitude, a.Latitude)
+		}
+		if len(a.Class) > 0 && !validClassNames.MatchString(a.Class) {
+			return fmt.Errorf("annotations[%d].class must be a space-separated list of class names: class=%v", i, a.Class)
+		}
+	}
+	for i, p := range r.PlaceLabels {
+		if p == nil {
+			return fmt.Errorf("place_labels must not contain null: place_labels[%d]", i)
+		}
+		if len(strings.TrimSpace(p.Name)) == 0 {
+			return fmt.Errorf("place_labels[%d].name is required", i)
+		}
+		if p.Longitude < -180 || p.Longitude > 180 || p.Latitude < -90 || p.Latitude > 90 {
+			return fmt.Errorf("place_labels[%d] must have a longitude between -180 and 180 and a latitude between -90 and 90: longitude=%v, latitude=%v", i, p.Longitude, p.Latitude)
+		}
+		if p.Size < 0 || p.Tier < 0 {
+			return fmt.Errorf("place_labels[%d] must not have a negative size or tier: size=%v, tier=%v", i, p.Size, p.Tier)
+		}
+	}
+	if r.Graticule != nil {
+		if r.Graticule.IntervalDegrees < MinGraticuleInterval || r.Graticule.IntervalDegrees > 90 {
+			return fmt.Errorf("graticule.interval_degrees must be between %g and 90: interval_degrees=%v", MinGraticuleInterval, r.Graticule.IntervalDegrees)
+		}
+		if len(r.Graticule.Class) > 0 && !validClassNames.MatchString(r.Graticule.Class) {
+			return fmt.Errorf("graticule.class must be a space-separated list of class names: class=%v", r.Graticule.Class)
+		}
+	}
+	if r.PointMarker != nil {
+		if !isValidMarkerSymbol(r.PointMarker.Symbol) {
+			return fmt.Errorf("point_marker.symbol must be one of '%s', '%s', '%s' or '%s': symbol=%v", MarkerSymbolCircle, MarkerSymbolSquare, MarkerSymbolTriangle, MarkerSymbolPin, r.PointMarker.Symbol)
+		}
+		if r.PointMarker.Size < 0 || r.PointMarker.Size > MaxMarkerSize {
+			return fmt.Errorf("point_marker.size must be between 0 and %d: size=%v", MaxMarkerSize, r.PointMarker.Size)
+		}
+	}
+	if r.LineStyle != nil {
+		if r.LineStyle.StrokeWidth < 0 {
+			return fmt.Errorf("line_style.stroke_width must not be negative: stroke_width=%v", r.LineStyle.StrokeWidth)
+		}
+		if len(r.LineStyle.DashArray) > 0 && !validDashArray.MatchString(r.LineStyle.DashArray) {
+			return fmt.Errorf("line_style.dash_array must be a list of non-negative numbers, e.g. '4 2': dash_array=%v", r.LineStyle.DashArray)
+		}
+		if len(r.LineStyle.Class) > 0 && !validClassNames.MatchString(r.LineStyle.Class) {
+			return fmt.Errorf("line_style.class must be a space-separated list of class names: class=%v", r.LineStyle.Class)
+		}
+	}
+	if err := r.PanZoomOptions.validate(); err != nil {
+		return err
+	}
+	if !isValidCorner(r.NorthArrow) {
+		return fmt.Errorf("north_arrow must be one of '%s', '%s', '%s' or '%s': north_arrow=%v", CornerTopLeft, CornerTopRight, CornerBottomLeft, CornerBottomRight, r.NorthArrow)
+	}
+	if mapTypeValidator != nil {
+		if err := mapTypeValidator(r); err != nil {
+			return err
+		}
+	}
+	if r.Choropleth != nil {
+		if !isValidLegendPosition(r.Choropleth.HorizontalLegendPosition) {
+			return fmt.Errorf("choropleth.horizontal_legend_position must be one of '%s', '%s' or '%s': horizontal_legend_position=%v", LegendPositionBefore, LegendPositionAfter, LegendPositionNone, r.Choropleth.HorizontalLegendPosition)
+		}
+		if !isValidLegendPosition(r.Choropleth.VerticalLegendPosition) {
+			return fmt.Errorf("choropleth.vertical_legend_position must be one of '%s', '%s' or '%s': vertical_legend_position=%v", LegendPositionBefore, LegendPositionAfter, LegendPositionNone, r.Choropleth.VerticalLegendPosition)
+		}
+		if !isValidLegendFormat(r.Choropleth.LegendFormat) {
+			return fmt.Errorf("choropleth.legend_format must be one of '%s' or '%s': legend_format=%v", LegendFormatSVG, LegendFormatHTML, r.Choropleth.LegendFormat)
+		}
+		if !isValidKeySwatch(r.Choropleth.KeySwatch) {
+			return fmt.Errorf("choropleth.key_swatch must be one of '%s', '%s' or '%s': key_swatch=%v", KeySwatchRect, KeySwatchCircle, KeySwatchLine, r.Choropleth.KeySwatch)
+		}
+		if r.Choropleth.ClassCount != 0 && (r.Choropleth.ClassCount < MinClassCount || r.Choropleth.ClassCount > MaxClassCount) {
+			return fmt.Errorf("choropleth.class_count must be between %d and %d: class_count=%v", MinClassCount, MaxClassCount, r.Choropleth.ClassCount)
+		}
+		for i, b := range r.Choropleth.Breaks {
+			if b != nil && b.Opacity != nil && (*b.Opacity < 0 || *b.Opacity > 1) {
+				return fmt.Errorf("choropleth.breaks[%d].opacity must be between 0 and 1: opacity=%v", i, *b.Opacity)
+			}
+		}
+		if r.Choropleth.Palette != nil && len(r.Choropleth.Breaks) == 0 && !r.Choropleth.hasKnownPalette() {
+			return fmt.Errorf("choropleth.palette.name must be the name of a known palette: name=%v", r.Choropleth.Palette.Name)
+		}
+		if r.Choropleth.Palette != nil && r.Choropleth.hasImplicitColours() {
+			if _, err := r.Choropleth.paletteColours(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.validateColours(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
-// CreateAnalyseRequest manages the creation of an AnalyseRequest from a reader
-func CreateAnalyseRequest(reader io.Reader) (*AnalyseRequest, error) {
-	bytes, err := ioutil.ReadAll(reader)
-	if err != nil {
-		log.Error(err, log.Data{"request_body": string(bytes)})
-		return nil, ErrorReadingBody
+// validateDataRow returns an error if the (non-nil) row, at the given path in the request, has a reason but is not missing,
+// has only one of its confidence interval bounds or a lower bound above its upper bound, or refers to a footnote that does not exist
+func (r *RenderRequest) validateDataRow(path string, row *DataRow) error {
+	if row == nil {
+		return nil
+	}
+	if len(row.Reason) > 0 && !row.Missing {
+		return fmt.Errorf("%s.reason may only be given for a missing row: id=%v", path, row.ID)
+	}
+	if (row.LowerCI == nil) != (row.UpperCI == nil) {
+		return fmt.Errorf("%s must have both lower_ci and upper_ci, or neither: id=%v", path, row.ID)
+	}
+	if row.HasConfidenceInterval() && *row.LowerCI > *row.UpperCI {
+		return fmt.Errorf("%s.lower_ci must be <= upper_ci: id=%v, lower_ci=%v, upper_ci=%v", path, row.ID, *row.LowerCI, *row.UpperCI)
 	}
+	for _, ref := range row.FootnoteRefs {
+		if ref < 1 || ref > len(r.Footnotes) {
+			return fmt.Errorf("%s.footnote_refs must be the numbers of footnotes (between 1 and %d): id=%v, footnote_ref=%v", path, len(r.Footnotes), row.ID, ref)
+		}
+	}
+	return nil
+}
+
+var mapTypeValidator func(r *RenderRequest) error
+
+// validateOverlayGeography returns an error if the request has an OverlayGeography without exactly one of topojson and geojson,
+// or that is too large or malformed (as for the Geography). The overlay does not need an IDProperty.
+func (r *RenderRequest) validateOverlayGeography() error {
+	g := r.OverlayGeography
+	if g == nil {
+		return nil
+	}
+	if (g.Topojson == nil) == (g.Geojson == nil) {
+		return fmt.Errorf("overlay_geography must have exactly one of topojson and geojson")
+	}
+	if err := checkGeographySize(g); err != nil {
+		return err
+	}
+	if err := checkTopology(g); err != nil {
+		return fmt.Errorf("%v: overlay_geography", err)
+	}
+	return nil
+}
+
+// validate returns an error if a zoom or the sensitivity of the options is out of range, or the min_zoom is greater than the max_zoom
+func (o *PanZoomOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	names := []string{"min_zoom", "max_zoom"}
+	for i, zoom := range []*float64{o.MinZoom, o.MaxZoom} {
+		if zoom != nil && (*zoom < MinPanZoomZoom || *zoom > MaxPanZoomZoom) {
+			return fmt.Errorf("pan_zoom_options.%s must be between %g and %g: %s=%v", names[i], MinPanZoomZoom, MaxPanZoomZoom, names[i], *zoom)
+		}
+	}
+	if o.MinZoom != nil && o.MaxZoom != nil && *o.MinZoom > *o.MaxZoom {
+		return fmt.Errorf("pan_zoom_options.min_zoom must be <= max_zoom: min_zoom=%v, max_zoom=%v", *o.MinZoom, *o.MaxZoom)
+	}
+	if s := o.ZoomScaleSensitivity; s != nil && (*s < MinPanZoomSensitivity || *s > MaxPanZoomSensitivity) {
+		return fmt.Errorf("pan_zoom_options.zoom_scale_sensitivity must be between %g and %g: zoom_scale_sensitivity=%v", MinPanZoomSensitivity, MaxPanZoomSensitivity, *s)
+	}
+	return nil
+}
+
+// UseMapTypeValidator assigns the function used by ValidateRenderRequest to check that the MapType is known,
+// and that the request has any configuration required by that type of map.
+func UseMapTypeValidator(validator func(r *RenderRequest) error) {
+	mapTypeValidator = validator
+}
+
+// validElementID matches an ElementID that may be safely used in element ids and css selectors
+var validElementID = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validClassNames matches a space-separated list of css class names
+var validClassNames = regexp.MustCompile(`^\s*-?[_a-zA-Z][_a-zA-Z0-9-]*(\s+-?[_a-zA-Z][_a-zA-Z0-9-]*)*\s*$`)
+
+// validDashArray matches the dash array of a LineStyle - non-negative numbers separated by spaces and/or commas
+var validDashArray = regexp.MustCompile(`^\s*[0-9]*\.?[0-9]+([\s,]+[0-9]*\.?[0-9]+)*\s*$`)
+
+// isValidLegendPosition returns true if the position is one of the LegendPosition constants, or empty
+func isValidLegendPosition(position string) bool {
+	switch position {
+	case "", LegendPositionBefore, LegendPositionAfter, LegendPositionNone:
+		return true
+	}
+	return false
+}
+
+// isValidLegendFormat returns true if the format is one of the LegendFormat constants, or empty
+func isValidLegendFormat(format string) bool {
+	switch format {
+	case "", LegendFormatSVG, LegendFormatHTML:
+		return true
+	}
+	return false
+}
+
+// isValidChangeMode returns true if the mode is one of the ChangeMode constants, or empty
+func isValidChangeMode(mode string) bool {
+	switch mode {
+	case "", ChangeModeAbsolute, ChangeModePercentagePoint:
+		return true
+	}
+	return false
+}
 
+// isValidCorner returns true if the corner is one of the Corner constants, or empty
+func isValidCorner(corner string) bool {
+	switch corner {
+	case "", CornerTopLeft, CornerTopRight, CornerBottomLeft, CornerBottomRight:
+		return true
+	}
+	return false
+}
+
+// isValidMarkerSymbol returns true if the symbol is one of the MarkerSymbol constants, or empty
+func isValidMarkerSymbol(symbol string) bool {
+	switch symbol {
+	case "", MarkerSymbolCircle, MarkerSymbolSquare, MarkerSymbolTriangle, MarkerSymbolPin:
+		return true
+	}
+	return false
+}
+
+// isValidKeySwatch returns true if the swatch is one of the KeySwatch constants, or empty
+func isValidKeySwatch(swatch string) bool {
+	switch swatch {
+	case "", KeySwatchRect, KeySwatchCircle, KeySwatchLine:
+		return true
+	}
+	return false
+}
+
+// CreateAnalyseRequest manages the creation of an AnalyseRequest from a reader, decoding the json as it is read
+func CreateAnalyseRequest(reader io.Reader) (*AnalyseRequest, error) {
+	body := &bodyReader{reader: reader}
 	var request AnalyseRequest
-	err = json.Unmarshal(bytes, &request)
+	decoder := json.NewDecoder(body)
+	err := decoder.Decode(&request)
+	if err == nil {
+		err = checkEndOfJSON(decoder.Buffered(), body)
+	}
+	if body.err != nil {
+		log.Error(body.err, nil)
+		return nil, ErrorReadingBody
+	}
+	if err == io.ErrUnexpectedEOF {
+		// report the same error as json.Unmarshal
+		err = ErrorTruncated
+	}
 	if err != nil {
-		log.Error(err, log.Data{"request_body": string(bytes)})
+		log.Error(err, nil)
 		return nil, err
 	}
 
-	// This should be the last check before returning RenderRequest
-	if len(bytes) == 2 {
+	// This should be the last check before returning AnalyseRequest
+	if reflect.DeepEqual(request, AnalyseRequest{}) {
 		return &request, ErrorNoData
 	}
 
@@ -177,31 +979,77 @@ func CreateAnalyseRequest(reader io.Reader) (*AnalyseRequest, error) {
 // ValidateAnalyseRequest checks the content of the request structure
 func (r *AnalyseRequest) ValidateAnalyseRequest() error {
 
+	if r.Geography != nil && len(r.GeographyID) > 0 {
+		return fmt.Errorf("Only one of geography and geography_id may be provided")
+	}
+
 	var missingFields []string
 
 	if r.Geography == nil {
 		missingFields = append(missingFields, "geography")
 	} else {
-		if r.Geography.Topojson == nil {
-			missingFields = append(missingFields, "geography.topojson")
+		if r.Geography.Topojson == nil && r.Geography.Geojson == nil {
+			missingFields = append(missingFields, "geography.topojson or geography.geojson")
 		}
 		if len(r.Geography.IDProperty) == 0 {
 			missingFields = append(missingFields, "geography.id_property")
 		}
 	}
 
-	if len(r.CSV) == 0 {
+	if len(r.CSV) == 0 && len(r.XLSX) == 0 {
 		missingFields = append(missingFields, "csv")
 	}
 
 	if missingFields != nil {
 		return fmt.Errorf("Missing mandatory field(s): %v", missingFields)
 	}
-	if r.IDIndex < 0 || r.ValueIndex < 0 {
-		return fmt.Errorf("id_index and value_index must be >=0: id_index=%v, value_index=%v", r.IDIndex, r.ValueIndex)
+	if r.Geography.Topojson != nil && r.Geography.Geojson != nil {
+		return fmt.Errorf("Only one of geography.topojson and geography.geojson may be provided")
 	}
-	if r.IDIndex == r.ValueIndex {
-		return fmt.Errorf("id_index and value_index cannot refer to the same column: id_index=%v, value_index=%v", r.IDIndex, r.ValueIndex)
+	if err := checkGeographySize(r.Geography); err != nil {
+		return err
+	}
+	if err := checkTopology(r.Geography); err != nil {
+		return err
+	}
+	if r.IDIndex != nil && *r.IDIndex < 0 {
+		return fmt.Errorf("id_index must be >=0: id_index=%v", *r.IDIndex)
+	}
+	if r.ValueIndex < 0 {
+		return fmt.Errorf("value_index must be >=0: value_index=%v", r.ValueIndex)
+	}
+	if r.IDIndex != nil && *r.IDIndex == r.ValueIndex {
+		return fmt.Errorf("id_index and value_index cannot refer to the same column: id_index=%v, value_index=%v", *r.IDIndex, r.ValueIndex)
+	}
+	if r.SheetIndex < 0 {
+		return fmt.Errorf("sheet_index must be >=0: sheet_index=%v", r.SheetIndex)
+	}
+	if r.HistogramBins < 0 || r.HistogramBins > MaxHistogramBins {
+		return fmt.Errorf("histogram_bins must be between 0 and %d: histogram_bins=%v", MaxHistogramBins, r.HistogramBins)
+	}
+	if r.ClassCountWeighting != nil && (*r.ClassCountWeighting < 0 || *r.ClassCountWeighting > 1) {
+		return fmt.Errorf("class_count_weighting must be between 0 and 1: class_count_weighting=%v", *r.ClassCountWeighting)
+	}
+	if r.ClassCount != 0 && (r.ClassCount < MinClassCount || r.ClassCount > MaxClassCount) {
+		return fmt.Errorf("class_count must be between %d and %d: class_count=%v", MinClassCount, MaxClassCount, r.ClassCount)
+	}
+	for i, breaks := range r.CandidateBreaks {
+		if len(breaks) < MinClassCount || len(breaks) > MaxClassCount {
+			return fmt.Errorf("candidate_breaks must each have between %d and %d breaks: candidate_breaks[%d]=%v", MinClassCount, MaxClassCount, i, breaks)
+		}
+		if !isStrictlyAscending(breaks) {
+			return fmt.Errorf("candidate_breaks must each be in ascending order, without duplicates: candidate_breaks[%d]=%v", i, breaks)
+		}
 	}
 	return nil
 }
+
+// isStrictlyAscending returns true if each value is greater than the one before it
+func isStrictlyAscending(values []float64) bool {
+	for i := 1; i < len(values); i++ {
+		if values[i] <= values[i-1] {
+			return false
+		}
+	}
+	return true
+}
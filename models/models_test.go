@@ -1,13 +1,17 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 
 	"bytes"
 
 	"github.com/ONSdigital/dp-map-renderer/testdata"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -45,39 +49,1008 @@ func TestCreateRenderRequestWithNoBody(t *testing.T) {
 		So(err, ShouldResemble, ErrorNoData)
 		So(filter, ShouldNotBeNil)
 	})
+
+	Convey("When a render request has an empty body containing whitespace, an error is returned", t, func() {
+		for _, body := range []string{"{ }", "\n{\n}\n", " {\t} "} {
+			filter, err := CreateRenderRequest(strings.NewReader(body))
+			So(err, ShouldResemble, ErrorNoData)
+			So(filter, ShouldNotBeNil)
+		}
+	})
+
+	Convey("When a render request only has zero values it is treated as empty, otherwise no error is returned", t, func() {
+		request, err := CreateRenderRequest(strings.NewReader(`{"title":""}`))
+		So(err, ShouldResemble, ErrorNoData)
+		request, err = CreateRenderRequest(strings.NewReader(`{"title":"a"}`))
+		So(err, ShouldBeNil)
+		So(request.Title, ShouldEqual, "a")
+	})
+
+	Convey("When the reader fails part way through a render request, an error is returned", t, func() {
+		_, err := CreateRenderRequest(io.MultiReader(strings.NewReader(`{"title":"a",`), reader{}))
+		So(err, ShouldEqual, ErrorReadingBody)
+	})
+}
+
+func BenchmarkCreateRenderRequest(b *testing.B) {
+	body := testdata.LoadExampleRequest(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CreateRenderRequest(bytes.NewReader(body)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCreateRenderRequestStrict reads the whole body before decoding it, for comparison with BenchmarkCreateRenderRequest
+func BenchmarkCreateRenderRequestStrict(b *testing.B) {
+	body := testdata.LoadExampleRequest(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CreateRenderRequestStrict(bytes.NewReader(body)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCreateRenderRequestWithInvalidJSON(t *testing.T) {
+	Convey("When a render request contains json with an invalid syntax, and error is returned", t, func() {
+		_, err := CreateRenderRequest(strings.NewReader(`{"foo`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "unexpected end of")
+	})
+
+	Convey("When a render request is followed by anything other than whitespace, an error is returned", t, func() {
+		for _, body := range []string{`{"title":"a"} {"bogus":`, `{"title":"a"}}`, `{"title":"a"} xx`} {
+			_, err := CreateRenderRequest(strings.NewReader(body))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "after top-level value")
+		}
+		request, err := CreateRenderRequest(strings.NewReader("{\"title\":\"a\"} \n"))
+		So(err, ShouldBeNil)
+		So(request.Title, ShouldEqual, "a")
+	})
+}
+
+func TestValidateRenderRequestRejectsMissingFields(t *testing.T) {
+	Convey("When a Render request has missing fields, an error is returned", t, func() {
+		request := RenderRequest{}
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "Missing mandatory field(s)")
+		So(err.Error(), ShouldContainSubstring, "geography")
+		So(err.Error(), ShouldContainSubstring, "data")
+	})
+
+	Convey("When a Render request has missing geography fields, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.Geography.Topojson = nil
+		request.Geography.IDProperty = ""
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "Missing mandatory field(s)")
+		So(err.Error(), ShouldContainSubstring, "geography.topojson")
+		So(err.Error(), ShouldContainSubstring, "geography.id_property")
+	})
+
+}
+
+func TestValidateRenderRequestLegendPositions(t *testing.T) {
+	Convey("When a Render request has a valid legend position, no error is returned", t, func() {
+		for _, position := range []string{LegendPositionBefore, LegendPositionAfter, LegendPositionNone, ""} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.Choropleth.HorizontalLegendPosition = position
+			request.Choropleth.VerticalLegendPosition = position
+
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When a Render request has an invalid horizontal legend position, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.Choropleth.HorizontalLegendPosition = "befor"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.horizontal_legend_position must be one of 'before', 'after' or 'none': horizontal_legend_position=befor")
+	})
+
+	Convey("When a Render request has an invalid vertical legend position, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.Choropleth.VerticalLegendPosition = "Before"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.vertical_legend_position must be one of 'before', 'after' or 'none': vertical_legend_position=Before")
+	})
+
+	Convey("When a Choropleth is marshalled, empty legend positions are omitted", t, func() {
+		b, err := json.Marshal(&Choropleth{VerticalLegendPosition: LegendPositionAfter})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldNotContainSubstring, "horizontal_legend_position")
+		So(string(b), ShouldContainSubstring, `"vertical_legend_position":"after"`)
+
+		var c Choropleth
+		So(json.Unmarshal(b, &c), ShouldBeNil)
+		So(c, ShouldResemble, Choropleth{VerticalLegendPosition: LegendPositionAfter})
+	})
+}
+
+func TestValidateRenderRequestLegendFormat(t *testing.T) {
+	Convey("When a Render request has a valid legend format, no error is returned", t, func() {
+		for _, format := range []string{LegendFormatSVG, LegendFormatHTML, ""} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.Choropleth.LegendFormat = format
+
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When a Render request has an invalid legend format, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.Choropleth.LegendFormat = "list"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.legend_format must be one of 'svg' or 'html': legend_format=list")
+	})
+}
+
+func TestValidateRenderRequestKeySwatch(t *testing.T) {
+	Convey("When a Render request has a valid key swatch, no error is returned", t, func() {
+		for _, swatch := range []string{KeySwatchRect, KeySwatchCircle, KeySwatchLine, ""} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.Choropleth.KeySwatch = swatch
+
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When a Render request has an invalid key swatch, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.Choropleth.KeySwatch = "square"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.key_swatch must be one of 'rect', 'circle' or 'line': key_swatch=square")
+	})
+}
+
+func TestValidateRenderRequestNorthArrow(t *testing.T) {
+	Convey("When a Render request has a valid north arrow corner, no error is returned", t, func() {
+		for _, corner := range []string{CornerTopLeft, CornerTopRight, CornerBottomLeft, CornerBottomRight, ""} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.NorthArrow = corner
+
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When a Render request has an invalid north arrow corner, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.NorthArrow = "top"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "north_arrow must be one of 'top-left', 'top-right', 'bottom-left' or 'bottom-right': north_arrow=top")
+	})
+}
+
+func TestValidateRenderRequestGraticule(t *testing.T) {
+	Convey("When a Render request has a valid graticule, no error is returned", t, func() {
+		for _, g := range []*Graticule{nil, {IntervalDegrees: 1}, {IntervalDegrees: MinGraticuleInterval, Class: "grid faint"}, {IntervalDegrees: 90}} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.Graticule = g
+
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When a Render request has a graticule with an invalid interval or class, an error is returned", t, func() {
+		for _, interval := range []float64{0, -1, 0.001, 91} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.Graticule = &Graticule{IntervalDegrees: interval}
+
+			err := request.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, fmt.Sprintf("graticule.interval_degrees must be between 0.01 and 90: interval_degrees=%v", interval))
+		}
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.Graticule = &Graticule{IntervalDegrees: 1, Class: `grid"`}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `graticule.class must be a space-separated list of class names: class=grid"`)
+	})
+}
+
+func TestValidateRenderRequestOverlayGeography(t *testing.T) {
+	Convey("When a Render request has an overlay geography with topojson or geojson, no error is returned", t, func() {
+		for _, overlay := range []*Geography{
+			nil,
+			{Topojson: &topojson.Topology{Type: "Topology", Arcs: [][][]float64{{{0, 0}, {1, 1}}}, Objects: map[string]*topojson.Geometry{"o": {Type: "LineString", LineString: []int{0}}}}},
+			{Geojson: geojson.NewFeatureCollection()},
+		} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.OverlayGeography = overlay
+
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When a Render request has an overlay geography with neither or both of topojson and geojson, an error is returned", t, func() {
+		for _, overlay := range []*Geography{{}, {Topojson: &topojson.Topology{}, Geojson: geojson.NewFeatureCollection()}} {
+			reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+			request, _ := CreateRenderRequest(reader)
+			request.OverlayGeography = overlay
+
+			err := request.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "overlay_geography must have exactly one of topojson and geojson")
+		}
+	})
+
+	Convey("When a Render request has a malformed overlay topology, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.OverlayGeography = &Geography{Topojson: &topojson.Topology{Type: "Topology", Objects: map[string]*topojson.Geometry{"o": nil}}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `topojson objects must not contain null geometries: objects["o"]: overlay_geography`)
+	})
+}
+
+func TestValidateRenderRequestElementID(t *testing.T) {
+	Convey("When a Render request has a valid element id, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.ElementID = "Non-UK_born-2015"
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a Render request has an element id that is not safe to use in ids, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.ElementID = "my map"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "element_id must only contain letters, digits, hyphens and underscores: element_id=my map")
+	})
+}
+
+func TestValidateRenderRequestConfidenceIntervals(t *testing.T) {
+	lower, upper := 1.5, 2.5
+	Convey("When a Render request has data with confidence intervals, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Data[0].LowerCI, request.Data[0].UpperCI = &lower, &upper
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a data row has only one bound of a confidence interval, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Data[1].LowerCI = &lower
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "data[1] must have both lower_ci and upper_ci, or neither: id="+request.Data[1].ID)
+	})
+
+	Convey("When a data row has a lower bound greater than its upper bound, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Data[0].LowerCI, request.Data[0].UpperCI = &upper, &lower
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "data[0].lower_ci must be <= upper_ci: id="+request.Data[0].ID+", lower_ci=2.5, upper_ci=1.5")
+	})
+}
+
+func TestValidateRenderRequestFootnoteRefs(t *testing.T) {
+	Convey("When a data row refers to footnotes of the request, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Footnotes = []string{"Boundary changed in 2021", "Provisional"}
+		request.Data[0].FootnoteRefs = []int{1, 2}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a data row refers to a footnote that the request does not have, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Footnotes = []string{"Boundary changed in 2021"}
+		request.Data[1].FootnoteRefs = []int{1, 2}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "data[1].footnote_refs must be the numbers of footnotes (between 1 and 1): id="+request.Data[1].ID+", footnote_ref=2")
+
+		request.Data[1].FootnoteRefs = []int{0}
+		So(request.ValidateRenderRequest(), ShouldNotBeNil)
+	})
+}
+
+func TestValidateRenderRequestChange(t *testing.T) {
+	Convey("When a Render request has compare data and a valid change mode, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.CompareData = []*DataRow{{ID: request.Data[0].ID, Value: 1}}
+		for _, mode := range []string{"", ChangeModeAbsolute, ChangeModePercentagePoint} {
+			request.Change = &Change{Mode: mode}
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When the change mode is unknown, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Change = &Change{Mode: "percent"}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "change.mode must be one of 'absolute' or 'percentage_point': mode=percent")
+	})
+
+	Convey("When the compare data contains null, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.CompareData = []*DataRow{{ID: "a"}, nil}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "compare_data must not contain null: compare_data[1]")
+	})
+}
+
+func TestValidateRenderRequestDataSets(t *testing.T) {
+	Convey("When a Render request has labelled data sets, no error is returned, and the data is that of the first data set", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader([]byte(`{"data_sets": [{"label": "2011", "data": [{"id": "a", "value": 1}]}, {"label": "2021", "data": []}]}`)))
+		So(len(request.Data), ShouldEqual, 1)
+		So(request.Data[0].ID, ShouldEqual, "a")
+
+		request, _ = CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.DataSets = []*DataSet{{Label: "2011", Data: request.Data}, {Label: "2021"}}
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a data set has no label, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.DataSets = []*DataSet{{Label: "2011"}, {Label: " "}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "data_sets[1].label is required")
+	})
+
+	Convey("When the data sets or their data contain null, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.DataSets = []*DataSet{nil}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "data_sets must not contain null: data_sets[0]")
+
+		request.DataSets = []*DataSet{{Label: "2011", Data: []*DataRow{{ID: "a"}, nil}}}
+		err = request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "data_sets[0].data must not contain null: data[1]")
+	})
+
+	Convey("When the rows of any data set are invalid, an error naming the data set and row is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		lower, upper := 2.5, 1.5
+		rows := map[string]*DataRow{
+			"data_sets[1].data[1].lower_ci must be <= upper_ci: id=b, lower_ci=2.5, upper_ci=1.5":                         {ID: "b", LowerCI: &lower, UpperCI: &upper},
+			"data_sets[1].data[1] must have both lower_ci and upper_ci, or neither: id=b":                                 {ID: "b", LowerCI: &lower},
+			"data_sets[1].data[1].footnote_refs must be the numbers of footnotes (between 1 and 1): id=b, footnote_ref=2": {ID: "b", FootnoteRefs: []int{2}},
+			"data_sets[1].data[1].reason may only be given for a missing row: id=b":                                       {ID: "b", Value: 1, Reason: "suppressed"},
+		}
+		for expected, row := range rows {
+			request.DataSets = []*DataSet{{Label: "2011", Data: request.Data}, {Label: "2021", Data: []*DataRow{{ID: "a"}, row}}}
+			err := request.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, expected)
+		}
+	})
+}
+
+func TestValidateRenderRequestPointMarker(t *testing.T) {
+	Convey("When a Render request has a valid point marker, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		for _, symbol := range []string{"", MarkerSymbolCircle, MarkerSymbolSquare, MarkerSymbolTriangle, MarkerSymbolPin} {
+			request.PointMarker = &PointMarker{Symbol: symbol, Size: 10, Colour: "#336699"}
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		}
+	})
+
+	Convey("When the point marker is invalid, an error is returned", t, func() {
+		invalid := []struct {
+			marker   *PointMarker
+			expected string
+		}{
+			{&PointMarker{Symbol: "star"}, "point_marker.symbol must be one of 'circle', 'square', 'triangle' or 'pin': symbol=star"},
+			{&PointMarker{Size: 101}, "point_marker.size must be between 0 and 100: size=101"},
+			{&PointMarker{Colour: "url(#pattern)"}, "point_marker.color must be a hex colour (#rgb, #rrggbb or #rrggbbaa), rgb() or rgba() with numeric values, or a named colour: color=url(#pattern)"},
+		}
+		for _, test := range invalid {
+			request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+			request.PointMarker = test.marker
+
+			err := request.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, test.expected)
+		}
+	})
+}
+
+func TestValidateRenderRequestLineStyle(t *testing.T) {
+	Convey("When a Render request has a valid line style, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.LineStyle = &LineStyle{Stroke: "#0000ff", StrokeWidth: 1.5, DashArray: "4, 2 0.5", Class: "river major"}
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When the line style is invalid, an error is returned", t, func() {
+		invalid := []struct {
+			style    *LineStyle
+			expected string
+		}{
+			{&LineStyle{Stroke: "url(http://example.com)"}, "line_style.stroke must be a colour (as for choropleth.breaks), none or url(#pattern-id): stroke=url(http://example.com)"},
+			{&LineStyle{StrokeWidth: -1}, "line_style.stroke_width must not be negative: stroke_width=-1"},
+			{&LineStyle{DashArray: "4 -2"}, "line_style.dash_array must be a list of non-negative numbers, e.g. '4 2': dash_array=4 -2"},
+			{&LineStyle{Class: "river\"><script>"}, "line_style.class must be a space-separated list of class names: class=river\"><script>"},
+		}
+		for _, test := range invalid {
+			request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+			request.LineStyle = test.style
+
+			err := request.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, test.expected)
+		}
+	})
+}
+
+func TestDataRowDisplayValue(t *testing.T) {
+	Convey("A data row should carry both its value and display value in json, omitting an empty display value", t, func() {
+		b, err := json.Marshal([]*DataRow{{ID: "a", Value: 3, DisplayValue: "fewer than 5"}, {ID: "b", Value: 12}})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `[{"id":"a","value":3,"display_value":"fewer than 5"},{"id":"b","value":12}]`)
+
+		var rows []*DataRow
+		So(json.Unmarshal(b, &rows), ShouldBeNil)
+		So(rows[0].Value, ShouldEqual, 3)
+		So(rows[0].DisplayValue, ShouldEqual, "fewer than 5")
+	})
+}
+
+func TestValidateRenderRequestAnnotations(t *testing.T) {
+	Convey("When a Render request has valid annotations, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Annotations = []*Annotation{{Longitude: -0.2158, Latitude: 51.5139, Label: "Grenfell Tower"}, {Longitude: 180, Latitude: -90, Class: "site proposed"}}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a Render request has an annotation outside the valid coordinates, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Annotations = []*Annotation{{Longitude: -0.2158, Latitude: 51.5139}, {Longitude: 51.5139, Latitude: -190.2158}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "annotations[1] must have a longitude between -180 and 180 and a latitude between -90 and 90: longitude=51.5139, latitude=-190.2158")
+	})
+
+	Convey("When a Render request has an annotation with an invalid class, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Annotations = []*Annotation{{Class: `site" onclick="alert(1)`}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "annotations[0].class must be a space-separated list of class names")
+	})
+
+	Convey("When a Render request has a null annotation, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Annotations = []*Annotation{nil}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "annotations must not contain null: annotations[0]")
+	})
+}
+
+func TestValidateRenderRequestPlaceLabels(t *testing.T) {
+	Convey("When a Render request has valid place labels, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PlaceLabels = []*PlaceLabel{{Name: "London", Longitude: -0.1276, Latitude: 51.5072}, {Name: "Cardiff", Longitude: -3.1791, Latitude: 51.4816, Size: 8, Tier: 2}}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a Render request has a place label without a name, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PlaceLabels = []*PlaceLabel{{Name: "London"}, {Name: " "}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "place_labels[1].name is required")
+	})
+
+	Convey("When a Render request has a place label outside the valid coordinates, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PlaceLabels = []*PlaceLabel{{Name: "Nowhere", Longitude: 190, Latitude: 51.5}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "place_labels[0] must have a longitude between -180 and 180 and a latitude between -90 and 90: longitude=190, latitude=51.5")
+	})
+
+	Convey("When a Render request has a place label with a negative size or tier, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PlaceLabels = []*PlaceLabel{{Name: "London", Tier: -1}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "place_labels[0] must not have a negative size or tier: size=0, tier=-1")
+	})
+
+	Convey("When a Render request has a null place label, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PlaceLabels = []*PlaceLabel{nil}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "place_labels must not contain null: place_labels[0]")
+	})
+}
+
+func TestPanZoomEnabled(t *testing.T) {
+	Convey("Pan-zoom should be enabled unless enable_pan_zoom is false", t, func() {
+		enabled, disabled := true, false
+		So((&RenderRequest{}).PanZoomEnabled(), ShouldBeTrue)
+		So((&RenderRequest{EnablePanZoom: &enabled}).PanZoomEnabled(), ShouldBeTrue)
+		So((&RenderRequest{EnablePanZoom: &disabled}).PanZoomEnabled(), ShouldBeFalse)
+	})
+}
+
+func TestValidateRenderRequestPanZoomOptions(t *testing.T) {
+	zoom := func(f float64) *float64 { return &f }
+
+	Convey("When a Render request has valid pan-zoom options, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		disabled := false
+		request.PanZoomOptions = &PanZoomOptions{MinZoom: zoom(1), MaxZoom: zoom(20), ZoomScaleSensitivity: zoom(0.2), ControlIconsEnabled: &disabled}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a Render request has a zoom out of range, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PanZoomOptions = &PanZoomOptions{MaxZoom: zoom(5000)}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "pan_zoom_options.max_zoom must be between 0.01 and 1000: max_zoom=5000")
+	})
+
+	Convey("When a Render request has a min_zoom greater than its max_zoom, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PanZoomOptions = &PanZoomOptions{MinZoom: zoom(10), MaxZoom: zoom(2)}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "pan_zoom_options.min_zoom must be <= max_zoom: min_zoom=10, max_zoom=2")
+	})
+
+	Convey("When a Render request has a sensitivity out of range, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.PanZoomOptions = &PanZoomOptions{ZoomScaleSensitivity: zoom(0)}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "pan_zoom_options.zoom_scale_sensitivity must be between 0.01 and 1: zoom_scale_sensitivity=0")
+	})
+}
+
+func TestValidateRenderRequestColours(t *testing.T) {
+	Convey("Hex, rgb(), rgba() and named colours should be valid, in any case", t, func() {
+		for _, colour := range []string{"#fff", "#FFF", "#a1b2c3", "#A1B2C3", "#a1b2c3d4", "rgb(241, 238, 246)", "RGB(100%,50%,0%)",
+			"rgba(0,0,0,0.5)", "rgba( 255 , 255 , 255 , .25 )", "red", "Red", "RED", "rebeccapurple", "LightGoldenRodYellow", "transparent"} {
+			So(IsValidColour(colour), ShouldBeTrue)
+		}
+	})
+
+	Convey("Other values should not be valid colours", t, func() {
+		for _, colour := range []string{"", "#ff", "#ffff", "#fffff", "#ggg", "fff", "rgb(1,2)", "rgb(1,2,3,4)", "rgba(1,2,3)", "rgb(a,b,c)",
+			"hsl(120, 100%, 50%)", "notacolour", "none", "url(#map-nodata)", "red;} body{display:none", "red; fill: blue", " red", "red\"", "expression(alert(1))"} {
+			So(IsValidColour(colour), ShouldBeFalse)
+		}
+	})
+
+	Convey("When a Render request has breaks with valid (or no) colours, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Choropleth.Breaks[0].Colour = "#abc"
+		request.Choropleth.Breaks[1].Colour = "DarkSlateBlue"
+		request.Choropleth.Breaks[2].Colour = ""
+		request.Choropleth.Palette = &ChoroplethPalette{Name: "Blues"}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a Render request has a break colour that would inject css, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Choropleth.Breaks[2].Colour = "red;} body{display:none"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.breaks[2].color must be a hex colour (#rgb, #rrggbb or #rrggbbaa), rgb() or rgba() with numeric values, or a named colour: color=red;} body{display:none")
+	})
+
+	Convey("When a Render request has a break colour that refers to a url, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.Choropleth.Breaks[0].Colour = "url(http://example.com/x.svg#p)"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "choropleth.breaks[0].color must be a hex colour")
+	})
+
+	Convey("When a Render request has region styles with valid colours, no error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.RegionStyles = map[string]string{
+			"E06000001": "fill: url(#map-nodata); STROKE: #000; stroke-width: 2px",
+			"E06000002": "fill: none; stroke: Navy",
+			"E06000003": "opacity: 0.5; display: none",
+		}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a Render request has a region style with an invalid fill or stroke, an error is returned", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		request.RegionStyles = map[string]string{"E06000001": "fill: red", "E06000002": "stroke-width: 1; Stroke: url(http://example.com/x.svg#p)"}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `region_styles["E06000002"] must use a colour (as for choropleth.breaks), none or url(#pattern-id) for the stroke: stroke=url(http://example.com/x.svg#p)`)
+	})
+}
+
+func TestChoroplethPalette(t *testing.T) {
+	breaks := func(colours ...string) []*ChoroplethBreak {
+		// deliberately not in order of lower bound
+		return []*ChoroplethBreak{{LowerBound: 10, Colour: colours[1]}, {LowerBound: 0, Colour: colours[0]}, {LowerBound: 20, Colour: colours[2]}}
+	}
+
+	Convey("When breaks do not have colours, they are filled from the palette in order of lower bound", t, func() {
+		c := &Choropleth{Breaks: breaks("", "", ""), Palette: &ChoroplethPalette{Name: "blues"}}
+		So(c.FillBreakColours(), ShouldBeNil)
+		So(c.Breaks[1].Colour, ShouldEqual, "#deebf7")
+		So(c.Breaks[0].Colour, ShouldEqual, "#9ecae1")
+		So(c.Breaks[2].Colour, ShouldEqual, "#3182bd")
+	})
+
+	Convey("When the palette is reversed, the colours are applied from the highest break", t, func() {
+		c := &Choropleth{Breaks: breaks("", "", ""), Palette: &ChoroplethPalette{Name: "Blues", Reverse: true}}
+		So(c.FillBreakColours(), ShouldBeNil)
+		So(c.Breaks[1].Colour, ShouldEqual, "#3182bd")
+		So(c.Breaks[0].Colour, ShouldEqual, "#9ecae1")
+		So(c.Breaks[2].Colour, ShouldEqual, "#deebf7")
+	})
+
+	Convey("When some breaks have explicit colours, they are not changed", t, func() {
+		c := &Choropleth{Breaks: breaks("red", "", "green"), Palette: &ChoroplethPalette{Name: "Blues"}}
+		So(c.FillBreakColours(), ShouldBeNil)
+		So(c.Breaks[1].Colour, ShouldEqual, "red")
+		So(c.Breaks[0].Colour, ShouldEqual, "#9ecae1")
+		So(c.Breaks[2].Colour, ShouldEqual, "green")
+	})
+
+	Convey("When all breaks have explicit colours, the palette is not used", t, func() {
+		c := &Choropleth{Breaks: breaks("red", "blue", "green"), Palette: &ChoroplethPalette{Name: "NoSuchPalette"}}
+		So(c.FillBreakColours(), ShouldBeNil)
+		request := &RenderRequest{Geography: &Geography{Topojson: &topojson.Topology{}, IDProperty: "code"}, Data: []*DataRow{{ID: "a"}}, Choropleth: c}
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When the palette does not support the number of breaks, an error is returned", t, func() {
+		c := &Choropleth{Breaks: append(breaks("", "", ""), &ChoroplethBreak{LowerBound: 30}), Palette: &ChoroplethPalette{Name: "RdBu"}}
+		for i := 0; i < 8; i++ {
+			c.Breaks = append(c.Breaks, &ChoroplethBreak{LowerBound: float64(40 + i)})
+		}
+		request := &RenderRequest{Geography: &Geography{Topojson: &topojson.Topology{}, IDProperty: "code"}, Data: []*DataRow{{ID: "a"}}, Choropleth: c}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.breaks cannot be coloured from the palette: Palette 'RdBu' does not support 12 classes")
+		So(c.FillBreakColours(), ShouldResemble, err)
+		So(c.Breaks[0].Colour, ShouldBeEmpty)
+	})
+
+	Convey("When the palette is unknown, an error is returned", t, func() {
+		c := &Choropleth{Breaks: breaks("", "", ""), Palette: &ChoroplethPalette{Name: "Bleus"}}
+		request := &RenderRequest{Geography: &Geography{Topojson: &topojson.Topology{}, IDProperty: "code"}, Data: []*DataRow{{ID: "a"}}, Choropleth: c}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.palette.name must be the name of a known palette: name=Bleus")
+	})
+
+	Convey("When breaks are to be computed, the palette must be known and the class count in range", t, func() {
+		c := &Choropleth{Palette: &ChoroplethPalette{Name: "Bleus"}}
+		request := &RenderRequest{Geography: &Geography{Topojson: &topojson.Topology{}, IDProperty: "code"}, Data: []*DataRow{{ID: "a"}}, Choropleth: c}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.palette.name must be the name of a known palette: name=Bleus")
+
+		c.Palette.Name = "Blues"
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+
+		c.ClassCount = 12
+		err = request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.class_count must be between 2 and 11: class_count=12")
+	})
+}
+
+func TestRenderCSVRequest(t *testing.T) {
+	Convey("A render-csv request should be read from the fields of a RenderRequest alongside the csv fields", t, func() {
+		body := `{"filename":"csv","geography":{"topojson":{"type":"Topology"},"id_property":"code"},"choropleth":{"class_count":3},"csv":"a,1","id_index":0,"value_index":1}`
+		request, err := CreateRenderCSVRequest(strings.NewReader(body))
+		So(err, ShouldBeNil)
+		So(request.RenderRequest.Filename, ShouldEqual, "csv")
+		So(request.CSV, ShouldEqual, "a,1")
+		So(request.ValueIndex, ShouldEqual, 1)
+
+		analyseRequest := request.AnalyseRequest()
+		So(analyseRequest.Geography, ShouldEqual, request.RenderRequest.Geography)
+		So(analyseRequest.CSV, ShouldEqual, "a,1")
+		So(analyseRequest.ClassCount, ShouldEqual, 3)
+	})
+
+	Convey("The analysed data and breaks for the class count should be set, coloured with the first suggested palette", t, func() {
+		request := &RenderCSVRequest{RenderRequest: &RenderRequest{Choropleth: &Choropleth{ClassCount: 3}}}
+		response := &AnalyseResponse{
+			Data:              []*DataRow{{ID: "a", Value: 1}},
+			Breaks:            [][]float64{{1, 5}, {1, 3, 5}},
+			BestFitClassCount: 2,
+			Palettes:          []*PaletteSuggestion{{Name: "Blues", ClassCount: 2}, {Name: "Greens", ClassCount: 3}},
+		}
+
+		request.SetAnalysedData(response)
+		So(request.RenderRequest.Data, ShouldResemble, response.Data)
+		So(request.RenderRequest.Choropleth.Breaks, ShouldResemble, []*ChoroplethBreak{{LowerBound: 1}, {LowerBound: 3}, {LowerBound: 5}})
+		So(request.RenderRequest.Choropleth.Palette.Name, ShouldEqual, "Greens")
+	})
+
+	Convey("The breaks of a request that has them should not be replaced", t, func() {
+		breaks := []*ChoroplethBreak{{LowerBound: 0, Colour: "red"}}
+		request := &RenderCSVRequest{RenderRequest: &RenderRequest{Choropleth: &Choropleth{Breaks: breaks}}}
+
+		request.SetAnalysedData(&AnalyseResponse{Breaks: [][]float64{{1, 5}}, BestFitClassCount: 2})
+		So(request.RenderRequest.Choropleth.Breaks, ShouldResemble, breaks)
+		So(request.RenderRequest.Choropleth.Palette, ShouldBeNil)
+	})
+}
+
+func TestRenderRequestWidths(t *testing.T) {
+	Convey("Given a Render request with width fields", t, func() {
+		create := func(widths string) *RenderRequest {
+			body := `{"geography":{"topojson":{"type":"Topology"},"id_property":"code"},"data":[{"id":"A","value":1}]` + widths + `}`
+			request, err := CreateRenderRequest(strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return request
+		}
+
+		Convey("When no widths are given, min and max width are left unset and the request is valid", func() {
+			request := create("")
+			So(request.DefaultWidth, ShouldEqual, DefaultViewBoxWidth)
+			So(request.MinWidth, ShouldEqual, 0)
+			So(request.MaxWidth, ShouldEqual, 0)
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		})
+
+		Convey("When only width is given, it is valid", func() {
+			request := create(`,"width":450`)
+			So(request.MaxWidth, ShouldEqual, 0)
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		})
+
+		Convey("When only max_width is given, it is valid", func() {
+			request := create(`,"max_width":500`)
+			So(request.MinWidth, ShouldEqual, 0)
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		})
+
+		Convey("When min_width is less than max_width, it is valid", func() {
+			request := create(`,"min_width":300,"max_width":500`)
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		})
+
+		Convey("When min_width equals max_width, it is valid", func() {
+			request := create(`,"min_width":300,"max_width":300`)
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		})
+
+		Convey("When min_width is greater than max_width, an error is returned", func() {
+			request := create(`,"width":400,"min_width":500,"max_width":300`)
+			err := request.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "max_width must be >= min_width: min_width=500, max_width=300")
+		})
+
+		Convey("When min_width is given without max_width, max_width defaults to width", func() {
+			request := create(`,"width":450,"min_width":300`)
+			So(request.MaxWidth, ShouldEqual, 450)
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		})
+
+		Convey("When min_width is given without max_width or width, max_width defaults to the default viewBox width", func() {
+			request := create(`,"min_width":300`)
+			So(request.MaxWidth, ShouldEqual, DefaultViewBoxWidth)
+			So(request.ValidateRenderRequest(), ShouldBeNil)
+		})
+
+		Convey("When min_width is given without max_width and is greater than the default, an error is returned", func() {
+			request := create(`,"width":400,"min_width":500`)
+			So(request.MaxWidth, ShouldEqual, 0)
+			err := request.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "max_width is required when min_width is specified: min_width=500")
+		})
+	})
+}
+
+func TestCreateRenderRequestAppliesDefaults(t *testing.T) {
+	Convey("When a minimal Render request is created, the documented defaults are applied", t, func() {
+		body := `{"geography":{"topojson":{"type":"Topology"},"id_property":"code"},"data":[{"id":"A","value":1}],"choropleth":{"breaks":[{"lower_bound":0,"color":"red"}]}}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+
+		So(err, ShouldBeNil)
+		So(request.FontSize, ShouldEqual, DefaultFontSize)
+		So(request.MapType, ShouldEqual, MapTypeChoropleth)
+		So(request.DefaultWidth, ShouldEqual, DefaultViewBoxWidth)
+		So(request.Choropleth.HorizontalLegendPosition, ShouldEqual, LegendPositionNone)
+		So(request.Choropleth.VerticalLegendPosition, ShouldEqual, LegendPositionNone)
+		So(request.Choropleth.LegendFormat, ShouldEqual, LegendFormatSVG)
+		So(request.Choropleth.KeySwatch, ShouldEqual, KeySwatchRect)
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a responsive Render request without a width is created, the width defaults to the average of min and max width", t, func() {
+		body := `{"geography":{"topojson":{"type":"Topology"},"id_property":"code"},"data":[{"id":"A","value":1}],"min_width":300,"max_width":600}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+
+		So(err, ShouldBeNil)
+		So(request.DefaultWidth, ShouldEqual, 450)
+		So(request.Choropleth, ShouldBeNil)
+	})
+
+	Convey("When a Render request with explicit values is created, they are untouched", t, func() {
+		body := `{"geography":{"topojson":{"type":"Topology"},"id_property":"code"},"data":[{"id":"A","value":1}],"width":550,"min_width":300,"max_width":500,"font_size":16,"choropleth":{"horizontal_legend_position":"before","vertical_legend_position":"after"}}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+
+		So(err, ShouldBeNil)
+		So(request.FontSize, ShouldEqual, 16)
+		So(request.DefaultWidth, ShouldEqual, 550)
+		So(request.MinWidth, ShouldEqual, 300)
+		So(request.MaxWidth, ShouldEqual, 500)
+		So(request.Choropleth.HorizontalLegendPosition, ShouldEqual, LegendPositionBefore)
+		So(request.Choropleth.VerticalLegendPosition, ShouldEqual, LegendPositionAfter)
+	})
+
+	Convey("When the defaults are changed with UseDefaults, they are applied to a new Render request", t, func() {
+		UseDefaults(600, 12)
+		defer UseDefaults(0, 0)
+		body := `{"geography":{"topojson":{"type":"Topology"},"id_property":"code"},"data":[{"id":"A","value":1}],"min_width":300}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+
+		So(err, ShouldBeNil)
+		So(request.FontSize, ShouldEqual, 12)
+		So(request.MaxWidth, ShouldEqual, 600)
+		So(request.DefaultWidth, ShouldEqual, 450)
+	})
 }
 
-func TestCreateRenderRequestWithInvalidJSON(t *testing.T) {
-	Convey("When a render request contains json with an invalid syntax, and error is returned", t, func() {
-		_, err := CreateRenderRequest(strings.NewReader(`{"foo`))
+func TestCreateRenderRequestMigratesSchemaVersion(t *testing.T) {
+	Convey("When a render request without a schema_version is created, the reference value is migrated to a reference line", t, func() {
+		request, err := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+		So(request.OriginalSchemaVersion, ShouldEqual, 1)
+		So(request.SchemaVersion, ShouldEqual, CurrentSchemaVersion)
+		So(request.Choropleth.ReferenceLines, ShouldResemble, []*ReferenceLine{{Value: 13, Text: "UK avg."}})
+	})
+
+	Convey("When a version 1 render request is created, only the given reference fields are migrated", t, func() {
+		body := `{"schema_version":1,"choropleth":{"reference_value_text":"England","value_prefix":"£"}}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+		So(err, ShouldBeNil)
+		So(request.Choropleth.ValuePrefix, ShouldEqual, "£")
+		So(request.Choropleth.ReferenceLines, ShouldResemble, []*ReferenceLine{{Value: 0, Text: "England"}})
+
+		request, err = CreateRenderRequest(strings.NewReader(`{"schema_version":1,"choropleth":{"value_prefix":"£"}}`))
+		So(err, ShouldBeNil)
+		So(request.Choropleth.ReferenceLines, ShouldBeNil)
+	})
+
+	Convey("When a current version render request is created, it is not migrated", t, func() {
+		body := `{"schema_version":2,"choropleth":{"reference_value":13,"reference_lines":[{"value":4,"text":"Wales"}]}}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+		So(err, ShouldBeNil)
+		So(request.OriginalSchemaVersion, ShouldEqual, 2)
+		So(request.Choropleth.ReferenceLines, ShouldResemble, []*ReferenceLine{{Value: 4, Text: "Wales"}})
+
+		_, err = CreateRenderRequestStrict(strings.NewReader(body))
 		So(err, ShouldNotBeNil)
-		So(err.Error(), ShouldContainSubstring, "unexpected end of")
+		So(err.Error(), ShouldEqual, "Unknown field(s): [choropleth.reference_value]")
 	})
-}
 
-func TestValidateRenderRequestRejectsMissingFields(t *testing.T) {
-	Convey("When a Render request has missing fields, an error is returned", t, func() {
-		request := RenderRequest{}
-		err := request.ValidateRenderRequest()
+	Convey("When a render request has an unsupported schema_version, an error is returned", t, func() {
+		_, err := CreateRenderRequest(strings.NewReader(`{"schema_version":3}`))
 		So(err, ShouldNotBeNil)
-		So(err.Error(), ShouldContainSubstring, "Missing mandatory field(s)")
-		So(err.Error(), ShouldContainSubstring, "geography")
-		So(err.Error(), ShouldContainSubstring, "data")
+		So(err.Error(), ShouldEqual, "Unsupported schema_version - the current version is 2: schema_version=3")
+
+		_, err = CreateRenderRequest(strings.NewReader(`{"schema_version":0}`))
+		So(err, ShouldNotBeNil)
+
+		_, err = CreateRenderRequest(strings.NewReader(`{"schema_version":"1"}`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `schema_version must be an integer: schema_version="1"`)
 	})
+}
 
-	Convey("When a Render request has missing geography fields, an error is returned", t, func() {
+func TestGeographyAcceptsGeoJSON(t *testing.T) {
+	Convey("When a request contains a geojson geography, it is unmarshalled and valid", t, func() {
+		body := `{"geography":{"geojson":{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"code":"A"}}]},"id_property":"code"},"data":[{"id":"A","value":1}]}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+
+		So(err, ShouldBeNil)
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+		So(request.Geography.Topojson, ShouldBeNil)
+		So(len(request.Geography.Geojson.Features), ShouldEqual, 1)
+		So(request.Geography.Geojson.Features[0].Properties["code"], ShouldEqual, "A")
+	})
+
+	Convey("When a request contains both topojson and geojson, an error is returned", t, func() {
 		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
 		request, _ := CreateRenderRequest(reader)
-		request.Geography.Topojson = nil
-		request.Geography.IDProperty = ""
+		request.Geography.Geojson = request.Geography.Topojson.ToGeoJSON()
 
 		err := request.ValidateRenderRequest()
 		So(err, ShouldNotBeNil)
-		So(err.Error(), ShouldContainSubstring, "Missing mandatory field(s)")
-		So(err.Error(), ShouldContainSubstring, "geography.topojson")
-		So(err.Error(), ShouldContainSubstring, "geography.id_property")
+		So(err.Error(), ShouldEqual, "Only one of geography.topojson and geography.geojson may be provided")
+
+		analyseRequest := AnalyseRequest{Geography: request.Geography, CSV: "foo,bar", ValueIndex: 1}
+		err = analyseRequest.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Only one of geography.topojson and geography.geojson may be provided")
 	})
 
+	Convey("When a request contains neither topojson nor geojson, an error is returned", t, func() {
+		request := AnalyseRequest{Geography: &Geography{IDProperty: "code"}, CSV: "foo,bar", ValueIndex: 1}
+		err := request.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "geography.topojson or geography.geojson")
+	})
 }
 
 func TestCreateAnalyseRequestFromFile(t *testing.T) {
@@ -106,6 +1079,12 @@ func TestCreateAnalyseRequestWithNoBody(t *testing.T) {
 		So(err, ShouldResemble, ErrorNoData)
 		So(filter, ShouldNotBeNil)
 	})
+
+	Convey("When an analyse request has an empty body containing whitespace, an error is returned", t, func() {
+		filter, err := CreateAnalyseRequest(strings.NewReader(" { \n } "))
+		So(err, ShouldResemble, ErrorNoData)
+		So(filter, ShouldNotBeNil)
+	})
 }
 
 func TestCreateAnalyseRequestWithInvalidJSON(t *testing.T) {
@@ -114,6 +1093,16 @@ func TestCreateAnalyseRequestWithInvalidJSON(t *testing.T) {
 		So(err, ShouldNotBeNil)
 		So(err.Error(), ShouldResemble, "unexpected end of JSON input")
 	})
+
+	Convey("When an analyse request is followed by anything other than whitespace, an error is returned", t, func() {
+		_, err := CreateAnalyseRequest(strings.NewReader(`{"csv":"a"} xx`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldResemble, "invalid character 'x' after top-level value")
+
+		request, err := CreateAnalyseRequest(strings.NewReader("{\"csv\":\"a\"}\r\n"))
+		So(err, ShouldBeNil)
+		So(request.CSV, ShouldEqual, "a")
+	})
 }
 
 func TestValidateAnalyseRequestRejectsMissingFields(t *testing.T) {
@@ -143,23 +1132,554 @@ func TestValidateAnalyseRequestRejectsInvalidValues(t *testing.T) {
 		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
 		request, _ := CreateAnalyseRequest(reader)
 		request.ValueIndex = -1
-		request.IDIndex = -2
+		idIndex := -2
+		request.IDIndex = &idIndex
 
 		err := request.ValidateAnalyseRequest()
 		So(err, ShouldNotBeNil)
-		So(err.Error(), ShouldContainSubstring, "value_index")
-		So(err.Error(), ShouldContainSubstring, "id_index")
+		So(err.Error(), ShouldEqual, "id_index must be >=0: id_index=-2")
+
+		request.IDIndex = nil
+		err = request.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "value_index must be >=0: value_index=-1")
 	})
 
 	Convey("When an analyse request has the same value for value and id indexes, an error is returned", t, func() {
 		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
 		request, _ := CreateAnalyseRequest(reader)
 		request.ValueIndex = 0
-		request.IDIndex = 0
+		idIndex := 0
+		request.IDIndex = &idIndex
 
 		err := request.ValidateAnalyseRequest()
 		So(err, ShouldNotBeNil)
 		So(err.Error(), ShouldContainSubstring, "id_index and value_index cannot refer to the same column")
 	})
 
+	Convey("When an analyse request has a class count outside the supported range, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, _ := CreateAnalyseRequest(reader)
+		request.ClassCount = 12
+
+		err := request.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "class_count must be between 2 and 11")
+
+		request.ClassCount = 1
+		So(request.ValidateAnalyseRequest(), ShouldNotBeNil)
+
+		request.ClassCount = 5
+		So(request.ValidateAnalyseRequest(), ShouldBeNil)
+	})
+
+	Convey("When an analyse request has an invalid number of histogram bins, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, _ := CreateAnalyseRequest(reader)
+		request.HistogramBins = -1
+
+		err := request.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "histogram_bins must be between 0 and 1000")
+
+		request.HistogramBins = 1001
+		So(request.ValidateAnalyseRequest(), ShouldNotBeNil)
+
+		request.HistogramBins = 50
+		So(request.ValidateAnalyseRequest(), ShouldBeNil)
+	})
+
+	Convey("When an analyse request has a class count weighting outside 0-1, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, _ := CreateAnalyseRequest(reader)
+		weighting := 1.5
+		request.ClassCountWeighting = &weighting
+
+		err := request.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "class_count_weighting must be between 0 and 1")
+
+		weighting = -0.1
+		So(request.ValidateAnalyseRequest(), ShouldNotBeNil)
+
+		weighting = 0
+		So(request.ValidateAnalyseRequest(), ShouldBeNil)
+	})
+
+	Convey("When an analyse request has candidate breaks of the wrong length or out of order, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleAnalyseRequest(t))
+		request, _ := CreateAnalyseRequest(reader)
+		request.CandidateBreaks = [][]float64{{0, 5, 10}, {0}}
+
+		err := request.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "candidate_breaks must each have between 2 and 11 breaks: candidate_breaks[1]=[0]")
+
+		request.CandidateBreaks = [][]float64{{0, 5, 5}}
+		err = request.ValidateAnalyseRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "candidate_breaks must each be in ascending order, without duplicates: candidate_breaks[0]=[0 5 5]")
+
+		request.CandidateBreaks = [][]float64{{0, 5, 10}, {-1, 1}}
+		So(request.ValidateAnalyseRequest(), ShouldBeNil)
+	})
+
+}
+
+func TestValidateRenderRequestRejectsInvalidOpacity(t *testing.T) {
+	Convey("When a break has an opacity outside 0-1, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		opacity := 1.5
+		request.Choropleth.Breaks[1].Opacity = &opacity
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "choropleth.breaks[1].opacity must be between 0 and 1: opacity=1.5")
+
+		opacity = -0.1
+		So(request.ValidateRenderRequest(), ShouldNotBeNil)
+
+		opacity = 0
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+}
+
+func TestValidateRenderRequestRejectsReasonWithoutMissing(t *testing.T) {
+	Convey("When a data row has a reason but is not missing, an error is returned", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		request, _ := CreateRenderRequest(reader)
+		request.Data[2].Reason = "data suppressed"
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "data[2].reason may only be given for a missing row: id="+request.Data[2].ID)
+
+		request.Data[2].Missing = true
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+}
+
+func TestZeroValuesSurviveMarshalling(t *testing.T) {
+	Convey("When an AnalyseResponse containing zero values is marshalled and unmarshalled, the zeros are retained", t, func() {
+		response := AnalyseResponse{
+			Data:        []*DataRow{{ID: "A", Value: 0}, {ID: "B", Value: 1.5}},
+			Choropleths: []*Choropleth{{Breaks: []*ChoroplethBreak{{LowerBound: -2, Colour: "red"}}, UpperBound: 0}},
+		}
+		b, err := json.Marshal(&response)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `{"id":"A","value":0}`)
+		So(string(b), ShouldContainSubstring, `"upper_bound":0`)
+
+		var result map[string]interface{}
+		So(json.Unmarshal(b, &result), ShouldBeNil)
+		row := result["data"].([]interface{})[0].(map[string]interface{})
+		So(row["value"], ShouldEqual, 0)
+	})
+
+	Convey("When a RenderRequest containing zero values is marshalled and unmarshalled, the zeros are retained", t, func() {
+		request := RenderRequest{
+			Data:       []*DataRow{{ID: "A", Value: 0}},
+			Choropleth: &Choropleth{ReferenceLines: []*ReferenceLine{{Value: 0, Text: "England"}}, UpperBound: 0},
+		}
+		b, err := json.Marshal(&request)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `{"id":"A","value":0}`)
+		So(string(b), ShouldContainSubstring, `"reference_lines":[{"value":0,"text":"England"}]`)
+		So(string(b), ShouldContainSubstring, `"upper_bound":0`)
+
+		var result map[string]interface{}
+		So(json.Unmarshal(b, &result), ShouldBeNil)
+		row := result["data"].([]interface{})[0].(map[string]interface{})
+		So(row["value"], ShouldEqual, 0)
+		choropleth := result["choropleth"].(map[string]interface{})
+		line := choropleth["reference_lines"].([]interface{})[0].(map[string]interface{})
+		So(line["value"], ShouldEqual, 0)
+
+		created, err := CreateRenderRequest(bytes.NewReader(b))
+		So(err, ShouldBeNil)
+		So(created.Data[0].Value, ShouldEqual, 0)
+		So(created.Choropleth.ReferenceLines[0].Value, ShouldEqual, 0)
+	})
+}
+
+func TestCreateRequestStrict(t *testing.T) {
+	Convey("When a render request with misspelt nested fields is created in strict mode, an error naming the fields is returned", t, func() {
+		body := `{"geography":{"topojson":{"type":"Topology","objects":{}},"id-property":"code"},"data":[{"id":"A","value":1},{"id":"B","vlaue":2}],"choropleth":{"breaks":[{"lowerBound":0,"color":"red"}]}}`
+		_, err := CreateRenderRequestStrict(strings.NewReader(body))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Unknown field(s): [choropleth.breaks[0].lowerBound data[1].vlaue geography.id-property]")
+	})
+
+	Convey("When a render request is created in strict mode, fields are matched case-insensitively and topojson is not checked", t, func() {
+		body := `{"Geography":{"topojson":{"type":"Topology","objects":{},"unexpected":true},"ID_PROPERTY":"code"},"data":[{"id":"A","value":1}]}`
+		request, err := CreateRenderRequestStrict(strings.NewReader(body))
+		So(err, ShouldBeNil)
+		So(request.Geography.IDProperty, ShouldEqual, "code")
+	})
+
+	Convey("When the example render request is created in strict mode, no error is returned", t, func() {
+		request, err := CreateRenderRequestStrict(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When an analyse request with a misspelt nested field is created in strict mode, an error naming the field is returned", t, func() {
+		body := `{"geography":{"topojson":{"type":"Topology","objects":{}},"id_property":"code"},"csv":"a,1","value_index":1,"id_normalisation":{"trim_space":true}}`
+		_, err := CreateAnalyseRequestStrict(strings.NewReader(body))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "Unknown field(s): [id_normalisation.trim_space]")
+	})
+
+	Convey("When an analyse request with invalid json is created in strict mode, the json error is returned", t, func() {
+		_, err := CreateAnalyseRequestStrict(strings.NewReader(`{"foo`))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldResemble, "unexpected end of JSON input")
+	})
+
+	Convey("When a render request with unknown fields is created without strict mode, no error is returned", t, func() {
+		body := `{"geography":{"topojson":{"type":"Topology","objects":{}},"id-property":"code"},"data":[{"id":"A","value":1}]}`
+		request, err := CreateRenderRequest(strings.NewReader(body))
+		So(err, ShouldBeNil)
+		So(request.Geography.IDProperty, ShouldEqual, "")
+	})
+}
+
+func TestValidateRejectsOversizedTopology(t *testing.T) {
+	defer UseTopologyLimits(defaultMaxArcs, defaultMaxObjects, defaultMaxCoordinates)
+
+	// topology returns a topology with the given number of arcs, each of 2 points, and a single polygon referencing the first arc
+	topology := func(arcs int) *topojson.Topology {
+		t := &topojson.Topology{Type: "Topology", Arcs: make([][][]float64, arcs)}
+		for i := range t.Arcs {
+			t.Arcs[i] = [][]float64{{0, 0}, {1, 1}}
+		}
+		t.Objects = map[string]*topojson.Geometry{"o": {Type: "GeometryCollection", Geometries: []*topojson.Geometry{{Type: "Polygon", Polygon: [][]int{{0}}}}}}
+		return t
+	}
+
+	Convey("When a render request has more arcs than the limit, a TopologyTooLargeError is returned", t, func() {
+		UseTopologyLimits(100, 0, 0)
+		request := RenderRequest{Geography: &Geography{Topojson: topology(101), IDProperty: "code"}, Data: []*DataRow{{ID: "A"}}}
+
+		err := request.ValidateRenderRequest()
+		So(err, ShouldResemble, &TopologyTooLargeError{Measure: "arcs", Limit: 100, Size: 101})
+		So(err.Error(), ShouldEqual, "The geography has 101 arcs, which exceeds the limit of 100. Please simplify the topology (e.g. using toposimplify or mapshaper) and try again")
+	})
+
+	Convey("When an analyse request has more coordinates than the limit, a TopologyTooLargeError is returned", t, func() {
+		UseTopologyLimits(0, 0, 100)
+		request := AnalyseRequest{Geography: &Geography{Topojson: topology(51), IDProperty: "code"}, CSV: "A,1", ValueIndex: 1}
+
+		err := request.ValidateAnalyseRequest()
+		So(err, ShouldResemble, &TopologyTooLargeError{Measure: "coordinates", Limit: 100, Size: 102})
+	})
+
+	Convey("When a geojson geography has more features than the limit, a TopologyTooLargeError is returned", t, func() {
+		UseTopologyLimits(0, 2, 0)
+		fc := geojson.NewFeatureCollection()
+		for i := 0; i < 3; i++ {
+			fc.AddFeature(geojson.NewPolygonFeature([][][]float64{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}))
+		}
+		request := AnalyseRequest{Geography: &Geography{Geojson: fc, IDProperty: "code"}, CSV: "A,1", ValueIndex: 1}
+
+		err := request.ValidateAnalyseRequest()
+		So(err, ShouldResemble, &TopologyTooLargeError{Measure: "objects", Limit: 2, Size: 3})
+	})
+
+	Convey("When a geography is within the limits, no error is returned", t, func() {
+		UseTopologyLimits(101, 1, 202)
+		request := RenderRequest{Geography: &Geography{Topojson: topology(101), IDProperty: "code"}, Data: []*DataRow{{ID: "A"}}}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When the limits are removed, a large geography is accepted", t, func() {
+		UseTopologyLimits(0, 0, 0)
+		request := RenderRequest{Geography: &Geography{Topojson: topology(1000), IDProperty: "code"}, Data: []*DataRow{{ID: "A"}}}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+}
+
+func TestValidateRejectsMalformedTopology(t *testing.T) {
+	arcs := [][][]float64{{{0, 0}, {1, 1}}, {{1, 1}, {2, 0}}}
+	tcs := []struct {
+		name     string
+		arcs     [][][]float64
+		objects  map[string]*topojson.Geometry
+		expected string
+	}{
+		{"null object", arcs, map[string]*topojson.Geometry{"o": nil},
+			`topojson objects must not contain null geometries: objects["o"]`},
+		{"null geometry in a collection", arcs, map[string]*topojson.Geometry{"o": {Type: "GeometryCollection", Geometries: []*topojson.Geometry{nil}}},
+			`topojson objects must not contain null geometries: objects["o"]`},
+		{"arc index out of range", arcs, map[string]*topojson.Geometry{"o": {Type: "LineString", LineString: []int{0, 2}}},
+			`topojson geometries must only refer to arcs that exist: arc=2, number of arcs=2: objects["o"]`},
+		{"reversed arc index out of range", arcs, map[string]*topojson.Geometry{"o": {Type: "MultiPolygon", MultiPolygon: [][][]int{{{0, -3}}}}},
+			`topojson geometries must only refer to arcs that exist: arc=-3, number of arcs=2: objects["o"]`},
+		{"arc position with one coordinate", [][][]float64{{{0, 0}, {1}}}, map[string]*topojson.Geometry{"o": {Type: "Polygon", Polygon: [][]int{{0}}}},
+			`topojson arcs must only contain positions with at least 2 coordinates: arcs[0][1]=[1]`},
+	}
+
+	for _, tc := range tcs {
+		Convey("When a request's topology has a "+tc.name+", an error is returned", t, func() {
+			geography := &Geography{Topojson: &topojson.Topology{Type: "Topology", Arcs: tc.arcs, Objects: tc.objects}, IDProperty: "code"}
+
+			renderRequest := RenderRequest{Geography: geography, Data: []*DataRow{{ID: "A"}}}
+			err := renderRequest.ValidateRenderRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, tc.expected)
+
+			analyseRequest := AnalyseRequest{Geography: geography, CSV: "A,1", ValueIndex: 1}
+			err = analyseRequest.ValidateAnalyseRequest()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, tc.expected)
+
+			So(geography.ValidateGeography(), ShouldNotBeNil)
+		})
+	}
+
+	Convey("When a request's topology refers to reversed arcs that exist, no error is returned", t, func() {
+		geography := &Geography{Topojson: &topojson.Topology{Type: "Topology", Arcs: arcs, Objects: map[string]*topojson.Geometry{
+			"o": {Type: "Polygon", Polygon: [][]int{{0, -2}}}}}, IDProperty: "code"}
+		request := RenderRequest{Geography: geography, Data: []*DataRow{{ID: "A"}}}
+
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+}
+
+func TestRenderRequestHash(t *testing.T) {
+	Convey("When semantically identical render requests are built in different orders, their hashes are equal", t, func() {
+		original, err := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+
+		// re-marshalling the decoded json sorts the keys, which are not sorted in the example file
+		var fields map[string]interface{}
+		So(json.Unmarshal(testdata.LoadExampleRequest(t), &fields), ShouldBeNil)
+		b, err := json.Marshal(fields)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldNotEqual, string(testdata.LoadExampleRequest(t)))
+		reordered, err := CreateRenderRequest(bytes.NewReader(b))
+		So(err, ShouldBeNil)
+
+		expected, err := original.Hash()
+		So(err, ShouldBeNil)
+		So(expected, ShouldHaveLength, 64)
+		hash, err := reordered.Hash()
+		So(err, ShouldBeNil)
+		So(hash, ShouldEqual, expected)
+
+		first, _ := CreateRenderRequest(strings.NewReader(`{"filename":"a","geography":{"topojson":{"type":"Topology","objects":{"b":{"type":"Point","coordinates":[1,2],"properties":{"x":1,"y":-0}},"a":{"type":"Point","coordinates":[3,4]}},"arcs":[]},"id_property":"x"},"region_styles":{"p":"fill: red","q":"fill: blue"}}`))
+		second, _ := CreateRenderRequest(strings.NewReader(`{"region_styles":{"q":"fill: blue","p":"fill: red"},"geography":{"id_property":"x","topojson":{"arcs":[],"objects":{"a":{"coordinates":[3.0,4e0],"type":"Point"},"b":{"properties":{"y":0,"x":1.0},"coordinates":[1,2],"type":"Point"}},"type":"Topology"}},"filename":"a"}`))
+		hash, err = first.Hash()
+		So(err, ShouldBeNil)
+		hash2, err := second.Hash()
+		So(err, ShouldBeNil)
+		So(hash2, ShouldEqual, hash)
+	})
+
+	Convey("When any visible field of a render request changes, its hash changes", t, func() {
+		request, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		expected, err := request.Hash()
+		So(err, ShouldBeNil)
+
+		changes := []func(r *RenderRequest){
+			func(r *RenderRequest) { r.Title += "." },
+			func(r *RenderRequest) { r.Data[0].Value++ },
+			func(r *RenderRequest) { r.Choropleth.Breaks[1].Colour = "red" },
+			func(r *RenderRequest) { r.Choropleth.ReferenceLines[0].Text = "England avg." },
+			func(r *RenderRequest) { r.Geography.Topojson.Arcs[0][0][0]++ },
+			func(r *RenderRequest) { r.Geography.NameProperty = "code" },
+			func(r *RenderRequest) { r.IncludeFallbackPng = !r.IncludeFallbackPng },
+			func(r *RenderRequest) { r.RegionStyles = map[string]string{"E06000001": "stroke: black"} },
+		}
+		for i, change := range changes {
+			changed, _ := CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+			change(changed)
+			hash, err := changed.Hash()
+			So(err, ShouldBeNil)
+			So(fmt.Sprintf("%d: %s", i, hash), ShouldNotEqual, fmt.Sprintf("%d: %s", i, expected))
+		}
+	})
+}
+
+func TestFormatID(t *testing.T) {
+	Convey("FormatID should return strings unchanged", t, func() {
+		id, ok := FormatID("E06000001")
+		So(ok, ShouldBeTrue)
+		So(id, ShouldEqual, "E06000001")
+	})
+
+	Convey("FormatID should format numbers without an exponent or trailing zeros", t, func() {
+		for value, expected := range map[interface{}]string{101.0: "101", 2000000.0: "2000000", 1.5: "1.5", 42: "42", int64(7): "7", float32(2.5): "2.5", json.Number("101.0"): "101"} {
+			id, ok := FormatID(value)
+			So(ok, ShouldBeTrue)
+			So(id, ShouldEqual, expected)
+		}
+	})
+
+	Convey("FormatID should reject other types", t, func() {
+		for _, value := range []interface{}{nil, true, []string{"a"}} {
+			_, ok := FormatID(value)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
+
+func TestIDNormalisation(t *testing.T) {
+	Convey("A nil IDNormalisation should not change the id", t, func() {
+		var n *IDNormalisation
+		So(n.Normalise(" E0001 "), ShouldEqual, " E0001 ")
+		So(n.IsEnabled(), ShouldBeFalse)
+	})
+
+	Convey("An IDNormalisation with no options should not change the id", t, func() {
+		n := &IDNormalisation{}
+		So(n.Normalise(" E0001 "), ShouldEqual, " E0001 ")
+		So(n.IsEnabled(), ShouldBeFalse)
+	})
+
+	Convey("Trim should remove leading and trailing whitespace", t, func() {
+		n := &IDNormalisation{Trim: true}
+		So(n.Normalise(" \tE0001 \n"), ShouldEqual, "E0001")
+		So(n.IsEnabled(), ShouldBeTrue)
+	})
+
+	Convey("CaseInsensitive should lower case the id", t, func() {
+		n := &IDNormalisation{CaseInsensitive: true}
+		So(n.Normalise("E0001a"), ShouldEqual, "e0001a")
+	})
+
+	Convey("StripLeadingZeros should remove leading zeros, leaving a single zero for an id of only zeros", t, func() {
+		n := &IDNormalisation{StripLeadingZeros: true}
+		So(n.Normalise("000123"), ShouldEqual, "123")
+		So(n.Normalise("E0001"), ShouldEqual, "E0001")
+		So(n.Normalise("000"), ShouldEqual, "0")
+		So(n.Normalise(""), ShouldEqual, "")
+	})
+
+	Convey("All options should be applied together, trimming before stripping zeros", t, func() {
+		n := &IDNormalisation{Trim: true, CaseInsensitive: true, StripLeadingZeros: true}
+		So(n.Normalise(" 00AB12 "), ShouldEqual, "ab12")
+	})
+}
+
+func TestResolveGeography(t *testing.T) {
+	registered := &Geography{Topojson: &topojson.Topology{Type: "Topology"}, IDProperty: "code"}
+	lookup := func(id string) *Geography {
+		if id == "registered" {
+			return registered
+		}
+		return nil
+	}
+
+	Convey("When a request has a registered geography_id, the geography is resolved", t, func() {
+		request := &RenderRequest{GeographyID: "registered", Data: []*DataRow{{ID: "A"}}}
+
+		So(request.ResolveGeography(lookup), ShouldBeNil)
+		So(request.Geography, ShouldEqual, registered)
+		So(request.GeographyID, ShouldBeEmpty)
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+	})
+
+	Convey("When a request has an unknown geography_id, a GeographyNotFoundError is returned", t, func() {
+		request := &AnalyseRequest{GeographyID: "unknown", CSV: "A,1", ValueIndex: 1}
+
+		So(request.ResolveGeography(lookup), ShouldResemble, &GeographyNotFoundError{ID: "unknown"})
+	})
+
+	Convey("When a request has both a geography and a geography_id, validation fails", t, func() {
+		request := &AnalyseRequest{Geography: &Geography{Topojson: &topojson.Topology{Type: "Topology"}, IDProperty: "code"}, GeographyID: "registered", CSV: "A,1", ValueIndex: 1}
+
+		So(request.ResolveGeography(lookup), ShouldBeNil)
+		So(request.ValidateAnalyseRequest(), ShouldResemble, fmt.Errorf("Only one of geography and geography_id may be provided"))
+	})
+
+	Convey("A geography to be registered must have an id_property and either topojson or geojson", t, func() {
+		So((&Geography{}).ValidateGeography().Error(), ShouldEqual, "Missing mandatory field(s): [topojson or geojson id_property]")
+		So(registered.ValidateGeography(), ShouldBeNil)
+	})
+}
+
+func TestValidateSimplifyRequest(t *testing.T) {
+	topology := &Geography{Topojson: &topojson.Topology{Type: "Topology"}}
+
+	Convey("A simplify request must have a topology and a tolerance, target_points or quantisation", t, func() {
+		So((&SimplifyRequest{Tolerance: 1}).ValidateSimplifyRequest().Error(), ShouldEqual, "Missing mandatory field(s): [geography]")
+		So((&SimplifyRequest{Geography: &Geography{Geojson: geojson.NewFeatureCollection()}, Tolerance: 1}).ValidateSimplifyRequest().Error(), ShouldEqual, "Missing mandatory field(s): [geography.topojson]")
+		So((&SimplifyRequest{Geography: topology}).ValidateSimplifyRequest().Error(), ShouldEqual, "One of tolerance, target_points or quantisation must be provided")
+		So((&SimplifyRequest{Geography: topology, Tolerance: 0.1}).ValidateSimplifyRequest(), ShouldBeNil)
+		So((&SimplifyRequest{Geography: topology, TargetPoints: 1000, Quantisation: 1e4}).ValidateSimplifyRequest(), ShouldBeNil)
+	})
+
+	Convey("A simplify request must not have both a tolerance and target_points, or invalid values", t, func() {
+		So((&SimplifyRequest{Geography: topology, Tolerance: 0.1, TargetPoints: 1000}).ValidateSimplifyRequest().Error(), ShouldEqual, "Only one of tolerance and target_points may be provided")
+		So((&SimplifyRequest{Geography: topology, Tolerance: -1}).ValidateSimplifyRequest().Error(), ShouldEqual, "tolerance must not be negative: tolerance=-1")
+		So((&SimplifyRequest{Geography: topology, TargetPoints: -1}).ValidateSimplifyRequest().Error(), ShouldEqual, "target_points must not be negative: target_points=-1")
+		So((&SimplifyRequest{Geography: topology, Quantisation: 1}).ValidateSimplifyRequest().Error(), ShouldEqual, "quantisation must be 0 (to keep the quantisation of the topology) or at least 2: quantisation=1")
+	})
+}
+
+func TestRenderRequestWithPreset(t *testing.T) {
+	preset := Preset{
+		"choropleth": json.RawMessage(`{"horizontal_legend_position": "before", "vertical_legend_position": "after", "value_suffix": "%"}`),
+		"tooltips":   json.RawMessage(`true`),
+		"font_size":  json.RawMessage(`20`),
+	}
+	UsePresetLookup(func(id string) Preset {
+		if id == "stored" {
+			return preset
+		}
+		return nil
+	})
+	defer UsePresetLookup(nil)
+
+	Convey("The fields of the preset should apply where the request does not give them", t, func() {
+		request, err := CreateRenderRequest(strings.NewReader(`{"preset_id": "stored", "title": "A map", "choropleth": {"value_prefix": "£"}}`))
+		So(err, ShouldBeNil)
+		So(request.Title, ShouldEqual, "A map")
+		So(request.Tooltips, ShouldBeTrue)
+		So(request.FontSize, ShouldEqual, 20)
+		So(request.Choropleth.HorizontalLegendPosition, ShouldEqual, LegendPositionBefore)
+		So(request.Choropleth.VerticalLegendPosition, ShouldEqual, LegendPositionAfter)
+		So(request.Choropleth.ValuePrefix, ShouldEqual, "£")
+		So(request.Choropleth.ValueSuffix, ShouldEqual, "%")
+	})
+
+	Convey("The fields given in the request should take precedence over the preset, even if false or empty", t, func() {
+		request, err := CreateRenderRequest(strings.NewReader(`{"preset_id": "stored", "tooltips": false, "font_size": 12, "choropleth": {"vertical_legend_position": "none", "value_suffix": ""}}`))
+		So(err, ShouldBeNil)
+		So(request.Tooltips, ShouldBeFalse)
+		So(request.FontSize, ShouldEqual, 12)
+		So(request.Choropleth.HorizontalLegendPosition, ShouldEqual, LegendPositionBefore)
+		So(request.Choropleth.VerticalLegendPosition, ShouldEqual, LegendPositionNone)
+		So(request.Choropleth.ValueSuffix, ShouldEqual, "")
+	})
+
+	Convey("Only the json of the presentation fields given should be kept as a request is decoded, not the whole body", t, func() {
+		body := testdata.LoadExampleRequest(t)
+		fields := newRenderRequestJSON(&RenderRequest{})
+		given, err := fields.decode(bytes.NewReader(body))
+		So(err, ShouldBeNil)
+		So(fields.Geography, ShouldNotBeNil)
+		size := 0
+		for name, raw := range given {
+			So(presetFields[name], ShouldBeTrue)
+			size += len(raw)
+		}
+		So(given, ShouldContainKey, "choropleth")
+		So(size*10, ShouldBeLessThan, len(body))
+	})
+
+	Convey("A request with an unknown preset_id should fail with a PresetNotFoundError", t, func() {
+		_, err := CreateRenderRequest(strings.NewReader(`{"preset_id": "unknown", "title": "A map"}`))
+		So(err, ShouldResemble, &PresetNotFoundError{ID: "unknown"})
+	})
+
+	Convey("A preset may only contain valid presentation fields", t, func() {
+		So(preset.ValidatePreset(), ShouldBeNil)
+		So(Preset{"geography_id": json.RawMessage(`"x"`), "data": json.RawMessage(`[]`), "minify": json.RawMessage(`true`)}.ValidatePreset().Error(), ShouldEqual, "A preset may only contain the presentation fields of a render request, not: [data geography_id]")
+		So(Preset{"font_size": json.RawMessage(`"large"`)}.ValidatePreset().Error(), ShouldStartWith, "Invalid preset: ")
+	})
 }
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ONSdigital/dp-map-renderer/palette"
+)
+
+// ChoroplethPalette names a palette (see package palette) used to colour the breaks that do not have an explicit colour
+type ChoroplethPalette struct {
+	Name    string `json:"name"`
+	Reverse bool   `json:"reverse,omitempty"` // if true, the palette colours are applied from the highest break to the lowest
+}
+
+// hasImplicitColours returns true if any of the breaks does not have a colour
+func (c *Choropleth) hasImplicitColours() bool {
+	for _, b := range c.Breaks {
+		if b != nil && len(b.Colour) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKnownPalette returns true if the palette is the name of a palette in package palette
+func (c *Choropleth) hasKnownPalette() bool {
+	return palette.Get(c.Palette.Name) != nil
+}
+
+// paletteColours returns the colours of the palette for the number of breaks, ordered from the lowest break to the highest
+func (c *Choropleth) paletteColours() ([]string, error) {
+	p := palette.Get(c.Palette.Name)
+	if p == nil {
+		return nil, fmt.Errorf("choropleth.palette.name must be the name of a known palette: name=%v", c.Palette.Name)
+	}
+	colours, err := p.Colours(len(c.Breaks))
+	if err != nil {
+		return nil, fmt.Errorf("choropleth.breaks cannot be coloured from the palette: %v", err)
+	}
+	if c.Palette.Reverse {
+		for i, j := 0, len(colours)-1; i < j; i, j = i+1, j-1 {
+			colours[i], colours[j] = colours[j], colours[i]
+		}
+	}
+	return colours, nil
+}
+
+// FillBreakColours sets the colour of each break that does not have one to the colour of the palette for the break's position
+// (ordered by lower bound). Explicit colours are not changed. Returns an error if the palette is unknown or does not support the number of breaks.
+func (c *Choropleth) FillBreakColours() error {
+	if c == nil || c.Palette == nil || !c.hasImplicitColours() {
+		return nil
+	}
+	colours, err := c.paletteColours()
+	if err != nil {
+		return err
+	}
+	breaks := make([]*ChoroplethBreak, 0, len(c.Breaks))
+	for _, b := range c.Breaks {
+		if b != nil {
+			breaks = append(breaks, b)
+		}
+	}
+	sort.SliceStable(breaks, func(i, j int) bool { return breaks[i].LowerBound < breaks[j].LowerBound })
+	for i, b := range breaks {
+		if len(b.Colour) == 0 {
+			b.Colour = colours[i]
+		}
+	}
+	return nil
+}
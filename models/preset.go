@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/json-iterator/go"
+)
+
+// presetFields are the json names of the fields of a RenderRequest that a Preset may contain - the presentation of a map,
+// but never its geography, data, title or element ids, which differ between maps
+var presetFields = map[string]bool{
+	"source":                        true,
+	"source_link":                   true,
+	"licence":                       true,
+	"map_type":                      true,
+	"choropleth":                    true,
+	"width":                         true,
+	"min_width":                     true,
+	"max_width":                     true,
+	"include_fallback_png":          true,
+	"font_size":                     true,
+	"font_family":                   true,
+	"include_annotations_in_bounds": true,
+	"include_ci_attributes":         true,
+	"minify":                        true,
+	"low_detail":                    true,
+	"show_scale_bar":                true,
+	"north_arrow":                   true,
+	"tooltips":                      true,
+	"line_style":                    true,
+	"point_marker":                  true,
+	"graticule":                     true,
+	"enable_pan_zoom":               true,
+	"pan_zoom_options":              true,
+	"change":                        true,
+}
+
+// Preset holds the json of presentation fields of a RenderRequest (e.g. the palette and legend positions of the choropleth, the font size
+// and the pan-zoom options), keyed by field name, so that many requests may share them by preset_id (see RenderRequest.PresetID)
+type Preset map[string]json.RawMessage
+
+// PresetLookup returns the stored Preset with the given id, or nil if there is none
+type PresetLookup func(id string) Preset
+
+// PresetNotFoundError is returned when a request refers to a preset_id that has not been stored
+type PresetNotFoundError struct {
+	ID string
+}
+
+func (e *PresetNotFoundError) Error() string {
+	return fmt.Sprintf("No preset has been stored with preset_id=%v", e.ID)
+}
+
+// presetLookup finds the presets of requests - see UsePresetLookup
+var presetLookup PresetLookup
+
+// UsePresetLookup assigns the function used by CreateRenderRequest to find the preset of a request with a preset_id.
+// Until one is assigned, a request with a preset_id fails with a PresetNotFoundError.
+func UsePresetLookup(lookup PresetLookup) {
+	presetLookup = lookup
+}
+
+// IsValidPresetID returns true if the id only contains letters, digits, hyphens and underscores
+func IsValidPresetID(id string) bool {
+	return validGeographyID.MatchString(id)
+}
+
+// CreatePreset manages the creation of a Preset (to be stored by id) from a reader
+func CreatePreset(reader io.Reader) (Preset, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		log.Error(err, nil)
+		return nil, ErrorReadingBody
+	}
+	var preset Preset
+	if err = json.Unmarshal(body, &preset); err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+	if len(preset) == 0 {
+		return preset, ErrorNoData
+	}
+	return preset, nil
+}
+
+// ValidatePreset returns an error if the preset contains any field that is not a presentation field of a RenderRequest
+// (e.g. its geography or data), or a field whose json is not valid for that field
+func (p Preset) ValidatePreset() error {
+	var invalid []string
+	for name := range p {
+		if !presetFields[name] {
+			invalid = append(invalid, name)
+		}
+	}
+	if invalid != nil {
+		sort.Strings(invalid)
+		return fmt.Errorf("A preset may only contain the presentation fields of a render request, not: %v", invalid)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	var request RenderRequest
+	if err = json.Unmarshal(b, &request); err != nil {
+		return fmt.Errorf("Invalid preset: %v", err)
+	}
+	return nil
+}
+
+// applyPreset replaces the fields that a preset may contain with the fields of the request's preset, over which the json of the fields
+// given in the request is decoded - so that the fields given in the request take precedence, including the fields of its choropleth
+// and other nested objects. Returns a PresetNotFoundError if there is no preset with the request's PresetID.
+func (r *renderRequestJSON) applyPreset(given Preset) error {
+	var preset Preset
+	if presetLookup != nil {
+		preset = presetLookup(r.PresetID)
+	}
+	if preset == nil {
+		return &PresetNotFoundError{ID: r.PresetID}
+	}
+	b, err := json.Marshal(preset)
+	if err != nil {
+		return err
+	}
+	var merged RenderRequest
+	if err = jsoniter.Unmarshal(b, &merged); err != nil {
+		return err
+	}
+	if b, err = json.Marshal(given); err != nil {
+		return err
+	}
+	fields := newRenderRequestJSON(&merged)
+	if err = jsoniter.Unmarshal(b, fields); err != nil {
+		return err
+	}
+	fields.decoded()
+
+	request, presented := reflect.ValueOf(r.RenderRequest).Elem(), reflect.ValueOf(&merged).Elem()
+	for name := range presetFields {
+		if field, exists := jsonField(request.Type(), name); exists {
+			request.FieldByIndex(field.Index).Set(presented.FieldByIndex(field.Index))
+		}
+	}
+	r.Choropleth = fields.Choropleth
+	return nil
+}
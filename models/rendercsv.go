@@ -0,0 +1,89 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+)
+
+// RenderCSVRequest is a RenderRequest whose data is given as a csv file (as in an AnalyseRequest),
+// which is analysed to provide the data of the map - and its breaks, if the choropleth has none
+type RenderCSVRequest struct {
+	RenderRequest *RenderRequest `json:"-"`
+	CSV           string         `json:"csv"`
+	IDIndex       int            `json:"id_index"`
+	ValueIndex    int            `json:"value_index"`
+	HasHeaderRow  bool           `json:"has_header_row"`
+}
+
+// CreateRenderCSVRequest manages the creation of a RenderCSVRequest from a reader - the csv fields alongside the fields of a RenderRequest
+// (see CreateRenderRequest)
+func CreateRenderCSVRequest(reader io.Reader) (*RenderCSVRequest, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, ErrorReadingBody
+	}
+	renderRequest, err := CreateRenderRequest(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request := RenderCSVRequest{RenderRequest: renderRequest}
+	if err = json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// AnalyseRequest returns a request to analyse the csv against the geography of the RenderRequest,
+// suggesting breaks for the class count of its choropleth (if any)
+func (r *RenderCSVRequest) AnalyseRequest() *AnalyseRequest {
+	idIndex := r.IDIndex
+	request := &AnalyseRequest{
+		Geography:       r.RenderRequest.Geography,
+		CSV:             r.CSV,
+		IDIndex:         &idIndex,
+		ValueIndex:      r.ValueIndex,
+		HasHeaderRow:    r.HasHeaderRow,
+		IDNormalisation: r.RenderRequest.IDNormalisation,
+	}
+	if r.RenderRequest.Choropleth != nil {
+		request.ClassCount = r.RenderRequest.Choropleth.ClassCount
+	}
+	return request
+}
+
+// SetAnalysedData sets the data of the RenderRequest to the data of the analysis. If the choropleth has no breaks, they are set to the breaks
+// of the analysis for the class count of the choropleth (or the best fit class count), to be coloured from the palette of the choropleth
+// - or the first palette suggested by the analysis, if it has none.
+func (r *RenderCSVRequest) SetAnalysedData(response *AnalyseResponse) {
+	r.RenderRequest.Data = response.Data
+	if r.RenderRequest.Choropleth == nil {
+		r.RenderRequest.Choropleth = &Choropleth{}
+	}
+	choropleth := r.RenderRequest.Choropleth
+	if len(choropleth.Breaks) > 0 {
+		return
+	}
+	classCount := choropleth.ClassCount
+	if classCount == 0 {
+		classCount = response.BestFitClassCount
+	}
+	for _, lowerBounds := range response.Breaks {
+		if len(lowerBounds) != classCount {
+			continue
+		}
+		for _, lowerBound := range lowerBounds {
+			choropleth.Breaks = append(choropleth.Breaks, &ChoroplethBreak{LowerBound: lowerBound})
+		}
+	}
+	if choropleth.Palette != nil {
+		return
+	}
+	for _, p := range response.Palettes {
+		if p.ClassCount == classCount {
+			choropleth.Palette = &ChoroplethPalette{Name: p.Name}
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/rubenv/topojson"
+)
+
+// SimplifyRequest is a request to simplify (and optionally quantise) the topology of a geography, given inline or by the id of a registered geography
+type SimplifyRequest struct {
+	Geography   *Geography `json:"geography,omitempty"`
+	GeographyID string     `json:"geography_id,omitempty"` // the id of a registered geography - an alternative to Geography
+	// Tolerance is the furthest (in the coordinates of the topology, e.g. degrees) that a removed point may be from its simplified arc
+	Tolerance float64 `json:"tolerance,omitempty"`
+	// TargetPoints is the number of points that the arcs of the simplified topology should have at most - an alternative to Tolerance,
+	// which is found so that the arcs keep as many points as possible
+	TargetPoints int `json:"target_points,omitempty"`
+	// Quantisation is the number of distinct values (e.g. 1e4) to which the coordinates of the simplified topology are quantised,
+	// or 0 to keep the quantisation of the topology (if any)
+	Quantisation float64 `json:"quantisation,omitempty"`
+}
+
+// SimplifyResponse holds the simplified topology, with the size of the topology before and after simplifying
+type SimplifyResponse struct {
+	Topojson  *topojson.Topology  `json:"topojson"`
+	Tolerance float64             `json:"tolerance"` // the tolerance used - found from the target_points if given
+	Before    *TopologyStatistics `json:"before"`
+	After     *TopologyStatistics `json:"after"`
+}
+
+// TopologyStatistics describes the size of a topology
+type TopologyStatistics struct {
+	Arcs   int `json:"arcs"`
+	Points int `json:"points"` // the number of positions in the arcs and point geometries
+	Bytes  int `json:"bytes"`  // the size of the topology serialised as json
+}
+
+// CreateSimplifyRequest manages the creation of a SimplifyRequest from a reader, decoding the json as it is read
+func CreateSimplifyRequest(reader io.Reader) (*SimplifyRequest, error) {
+	body := &bodyReader{reader: reader}
+	var request SimplifyRequest
+	err := json.NewDecoder(body).Decode(&request)
+	if body.err != nil {
+		log.Error(body.err, nil)
+		return nil, ErrorReadingBody
+	}
+	if err == io.ErrUnexpectedEOF {
+		// report the same error as json.Unmarshal
+		err = ErrorTruncated
+	}
+	if err != nil {
+		log.Error(err, nil)
+		return nil, err
+	}
+
+	if reflect.DeepEqual(request, SimplifyRequest{}) {
+		return &request, ErrorNoData
+	}
+
+	return &request, nil
+}
+
+// CreateSimplifyRequestStrict is the same as CreateSimplifyRequest, except that it returns an error naming any fields in the json
+// that are not part of a SimplifyRequest. Unlike CreateSimplifyRequest, the whole body is read before it is decoded.
+func CreateSimplifyRequestStrict(reader io.Reader) (*SimplifyRequest, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		log.Error(err, log.Data{"request_body": string(body)})
+		return nil, ErrorReadingBody
+	}
+	if err = checkUnknownFields(body, reflect.TypeOf(SimplifyRequest{})); err != nil {
+		return nil, err
+	}
+	return CreateSimplifyRequest(bytes.NewReader(body))
+}
+
+// ResolveGeography replaces the GeographyID of the request with the registered Geography it refers to,
+// returning a GeographyNotFoundError if there is no such geography.
+// Requests without a GeographyID, or that also have a Geography (which ValidateSimplifyRequest rejects), are left unchanged.
+func (r *SimplifyRequest) ResolveGeography(lookup GeographyLookup) error {
+	return resolveGeography(&r.Geography, &r.GeographyID, lookup)
+}
+
+// ValidateSimplifyRequest checks the content of the request, which must have a geography with a topojson topology
+// and a tolerance, target_points or quantisation
+func (r *SimplifyRequest) ValidateSimplifyRequest() error {
+
+	if r.Geography != nil && len(r.GeographyID) > 0 {
+		return fmt.Errorf("Only one of geography and geography_id may be provided")
+	}
+
+	var missingFields []string
+
+	if r.Geography == nil {
+		missingFields = append(missingFields, "geography")
+	} else if r.Geography.Topojson == nil {
+		missingFields = append(missingFields, "geography.topojson")
+	}
+
+	if missingFields != nil {
+		return fmt.Errorf("Missing mandatory field(s): %v", missingFields)
+	}
+	if r.Geography.Geojson != nil {
+		return fmt.Errorf("Only one of geography.topojson and geography.geojson may be provided")
+	}
+	if err := checkGeographySize(r.Geography); err != nil {
+		return err
+	}
+	if err := checkTopology(r.Geography); err != nil {
+		return err
+	}
+	if r.Tolerance == 0 && r.TargetPoints == 0 && r.Quantisation == 0 {
+		return fmt.Errorf("One of tolerance, target_points or quantisation must be provided")
+	}
+	if r.Tolerance != 0 && r.TargetPoints != 0 {
+		return fmt.Errorf("Only one of tolerance and target_points may be provided")
+	}
+	if r.Tolerance < 0 {
+		return fmt.Errorf("tolerance must not be negative: tolerance=%v", r.Tolerance)
+	}
+	if r.TargetPoints < 0 {
+		return fmt.Errorf("target_points must not be negative: target_points=%v", r.TargetPoints)
+	}
+	if r.Quantisation != 0 && r.Quantisation < 2 {
+		return fmt.Errorf("quantisation must be 0 (to keep the quantisation of the topology) or at least 2: quantisation=%v", r.Quantisation)
+	}
+	return nil
+}
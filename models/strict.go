@@ -0,0 +1,174 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+)
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// uncheckedTypes are not checked for unknown fields - topojson and geojson may contain foreign members
+var uncheckedTypes = map[reflect.Type]bool{
+	reflect.TypeOf(topojson.Topology{}):         true,
+	reflect.TypeOf(geojson.FeatureCollection{}): true,
+}
+
+// CreateRenderRequestStrict is the same as CreateRenderRequest, except that it returns an error naming any fields in the json
+// that are not part of a RenderRequest (e.g. a misspelt field name). Fields are checked against the schema version of the request,
+// so fields that were removed from the schema are only accepted in requests using an older schema_version.
+// Unlike CreateRenderRequest, the whole body is read before it is decoded.
+func CreateRenderRequestStrict(reader io.Reader) (*RenderRequest, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		log.Error(err, log.Data{"request_body": string(body)})
+		return nil, ErrorReadingBody
+	}
+	request, err := CreateRenderRequest(bytes.NewReader(body))
+	if err != nil && err != ErrorNoData {
+		return nil, err
+	}
+	t := reflect.TypeOf(RenderRequest{})
+	if request.OriginalSchemaVersion < CurrentSchemaVersion {
+		t = reflect.TypeOf(renderRequestJSON{})
+	}
+	if unknownErr := checkUnknownFields(body, t); unknownErr != nil {
+		return nil, unknownErr
+	}
+	return request, err
+}
+
+// CreateAnalyseRequestStrict is the same as CreateAnalyseRequest, except that it returns an error naming any fields in the json
+// that are not part of an AnalyseRequest (e.g. a misspelt field name). Unlike CreateAnalyseRequest, the whole body is read before it is decoded.
+func CreateAnalyseRequestStrict(reader io.Reader) (*AnalyseRequest, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		log.Error(err, log.Data{"request_body": string(body)})
+		return nil, ErrorReadingBody
+	}
+	if err = checkUnknownFields(body, reflect.TypeOf(AnalyseRequest{})); err != nil {
+		return nil, err
+	}
+	return CreateAnalyseRequest(bytes.NewReader(body))
+}
+
+// checkUnknownFields returns an error listing the path of each field in the json that does not correspond to a field of the given type.
+// Invalid json is ignored, so that the error is reported by the normal decoding.
+func checkUnknownFields(body []byte, t reflect.Type) error {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil
+	}
+	unknown := unknownFields(value, t, "")
+	if len(unknown) > 0 {
+		return fmt.Errorf("Unknown field(s): %v", unknown)
+	}
+	return nil
+}
+
+// unknownFields recursively compares the decoded json value with the type it will be unmarshalled into, returning the path
+// (e.g. choropleth.breaks[0].lowerBound) of any object keys that do not match a field. As with encoding/json, field names are matched case-insensitively.
+// Topojson, geojson and other types with their own UnmarshalJSON method are not checked.
+func unknownFields(value interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if uncheckedTypes[t] || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	unknown := []string{}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil
+		}
+		keys := make([]string, 0, len(object))
+		for k := range object {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field, exists := jsonField(t, k)
+			if !exists {
+				unknown = append(unknown, joinPath(path, k))
+				continue
+			}
+			unknown = append(unknown, unknownFields(object[k], field.Type, joinPath(path, k))...)
+		}
+	case reflect.Slice, reflect.Array:
+		array, isArray := value.([]interface{})
+		if !isArray {
+			return nil
+		}
+		for i, v := range array {
+			unknown = append(unknown, unknownFields(v, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil
+		}
+		for k, v := range object {
+			unknown = append(unknown, unknownFields(v, t.Elem(), joinPath(path, k))...)
+		}
+		sort.Strings(unknown)
+	}
+	return unknown
+}
+
+// jsonField returns the field of the struct type that the json key is unmarshalled into (with the index of the field from the struct type,
+// for reflect.Value.FieldByIndex, if it is a field of an embedded struct)
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && len(name) == 0 {
+			embedded = append(embedded, field)
+			continue
+		}
+		if name == "-" || len(field.PkgPath) > 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	// as with encoding/json, the fields of an embedded struct are only matched if the struct has no field of the same name
+	for _, field := range embedded {
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			continue
+		}
+		if f, exists := jsonField(ft, key); exists {
+			f.Index = append(append([]int{}, field.Index...), f.Index...)
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// joinPath appends the key to the path, separated by a dot
+func joinPath(path string, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+)
+
+// checkTopology returns an error if the topology (if any) of the geography is malformed in a way that would prevent it being
+// converted to geojson - null objects or geometries, arc positions without both coordinates, or references to arcs that do not exist.
+func checkTopology(g *Geography) error {
+	t := g.Topojson
+	if t == nil {
+		return nil
+	}
+	for i, arc := range t.Arcs {
+		for j, position := range arc {
+			if len(position) < 2 {
+				return fmt.Errorf("topojson arcs must only contain positions with at least 2 coordinates: arcs[%d][%d]=%v", i, j, position)
+			}
+		}
+	}
+	for name, o := range t.Objects {
+		if err := checkTopologyGeometry(o, len(t.Arcs)); err != nil {
+			return fmt.Errorf("%v: objects[%q]", err, name)
+		}
+	}
+	return nil
+}
+
+// checkTopologyGeometry returns an error if the geometry is null or refers to an arc outside the range 0 to arcCount-1
+// (a negative index i refers to the arc ^i, reversed)
+func checkTopologyGeometry(g *topojson.Geometry, arcCount int) error {
+	if g == nil {
+		return fmt.Errorf("topojson objects must not contain null geometries")
+	}
+	var lines [][]int
+	switch g.Type {
+	case geojson.GeometryCollection:
+		for _, child := range g.Geometries {
+			if err := checkTopologyGeometry(child, arcCount); err != nil {
+				return err
+			}
+		}
+	case geojson.GeometryLineString:
+		lines = [][]int{g.LineString}
+	case geojson.GeometryMultiLineString:
+		lines = g.MultiLineString
+	case geojson.GeometryPolygon:
+		lines = g.Polygon
+	case geojson.GeometryMultiPolygon:
+		for _, polygon := range g.MultiPolygon {
+			lines = append(lines, polygon...)
+		}
+	}
+	for _, line := range lines {
+		for _, a := range line {
+			index := a
+			if index < 0 {
+				index = ^index
+			}
+			if index >= arcCount {
+				return fmt.Errorf("topojson geometries must only refer to arcs that exist: arc=%d, number of arcs=%d", a, arcCount)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Package palette provides a set of named colour palettes (from ColorBrewer - http://colorbrewer2.org)
+// that may be used to colour the classes of a choropleth map.
+package palette
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The types of palette
+const (
+	Sequential = "sequential"
+	Diverging  = "diverging"
+)
+
+// Palette is a named set of colour schemes, one for each number of classes it supports
+type Palette struct {
+	Name            string
+	Type            string
+	ColourBlindSafe bool
+	colours         map[int][]string
+}
+
+// Colours returns the colours of the palette for the given number of classes, ordered from lowest to highest class.
+// Two-class schemes use the outer colours of the three-class scheme.
+func (p *Palette) Colours(classCount int) ([]string, error) {
+	if classCount == 2 && p.colours[3] != nil {
+		return []string{p.colours[3][0], p.colours[3][2]}, nil
+	}
+	colours, ok := p.colours[classCount]
+	if !ok {
+		return nil, fmt.Errorf("Palette '%s' does not support %d classes", p.Name, classCount)
+	}
+	c := make([]string, len(colours))
+	copy(c, colours)
+	return c, nil
+}
+
+// SupportsClassCount returns true if the palette has a colour scheme for the given number of classes
+func (p *Palette) SupportsClassCount(classCount int) bool {
+	_, err := p.Colours(classCount)
+	return err == nil
+}
+
+// Get returns the palette with the given name (case-insensitive), or nil if there is no such palette
+func Get(name string) *Palette {
+	for _, p := range palettes {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// All returns all palettes, sequential palettes first
+func All() []*Palette {
+	all := make([]*Palette, len(palettes))
+	copy(all, palettes)
+	return all
+}
+
+// MaxClassCount returns the largest number of classes supported by any palette of the given type, or 0 if there are no palettes of the type
+func MaxClassCount(paletteType string) int {
+	max := 0
+	for _, p := range palettes {
+		if p.Type != paletteType {
+			continue
+		}
+		for n := range p.colours {
+			if n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
+
+// palettes are the ColorBrewer schemes (Apache-Style Software License - see http://colorbrewer2.org)
+var palettes = []*Palette{
+	{
+		Name: "Blues", Type: Sequential, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3: {"#deebf7", "#9ecae1", "#3182bd"},
+			4: {"#eff3ff", "#bdd7e7", "#6baed6", "#2171b5"},
+			5: {"#eff3ff", "#bdd7e7", "#6baed6", "#3182bd", "#08519c"},
+			6: {"#eff3ff", "#c6dbef", "#9ecae1", "#6baed6", "#3182bd", "#08519c"},
+			7: {"#eff3ff", "#c6dbef", "#9ecae1", "#6baed6", "#4292c6", "#2171b5", "#084594"},
+			8: {"#f7fbff", "#deebf7", "#c6dbef", "#9ecae1", "#6baed6", "#4292c6", "#2171b5", "#084594"},
+			9: {"#f7fbff", "#deebf7", "#c6dbef", "#9ecae1", "#6baed6", "#4292c6", "#2171b5", "#08519c", "#08306b"},
+		},
+	},
+	{
+		Name: "Greens", Type: Sequential, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3: {"#e5f5e0", "#a1d99b", "#31a354"},
+			4: {"#edf8e9", "#bae4b3", "#74c476", "#238b45"},
+			5: {"#edf8e9", "#bae4b3", "#74c476", "#31a354", "#006d2c"},
+			6: {"#edf8e9", "#c7e9c0", "#a1d99b", "#74c476", "#31a354", "#006d2c"},
+			7: {"#edf8e9", "#c7e9c0", "#a1d99b", "#74c476", "#41ab5d", "#238b45", "#005a32"},
+			8: {"#f7fcf5", "#e5f5e0", "#c7e9c0", "#a1d99b", "#74c476", "#41ab5d", "#238b45", "#005a32"},
+			9: {"#f7fcf5", "#e5f5e0", "#c7e9c0", "#a1d99b", "#74c476", "#41ab5d", "#238b45", "#006d2c", "#00441b"},
+		},
+	},
+	{
+		Name: "Oranges", Type: Sequential, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3: {"#fee6ce", "#fdae6b", "#e6550d"},
+			4: {"#feedde", "#fdbe85", "#fd8d3c", "#d94701"},
+			5: {"#feedde", "#fdbe85", "#fd8d3c", "#e6550d", "#a63603"},
+			6: {"#feedde", "#fdd0a2", "#fdae6b", "#fd8d3c", "#e6550d", "#a63603"},
+			7: {"#feedde", "#fdd0a2", "#fdae6b", "#fd8d3c", "#f16913", "#d94801", "#8c2d04"},
+			8: {"#fff5eb", "#fee6ce", "#fdd0a2", "#fdae6b", "#fd8d3c", "#f16913", "#d94801", "#8c2d04"},
+			9: {"#fff5eb", "#fee6ce", "#fdd0a2", "#fdae6b", "#fd8d3c", "#f16913", "#d94801", "#a63603", "#7f2704"},
+		},
+	},
+	{
+		Name: "Purples", Type: Sequential, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3: {"#efedf5", "#bcbddc", "#756bb1"},
+			4: {"#f2f0f7", "#cbc9e2", "#9e9ac8", "#6a51a3"},
+			5: {"#f2f0f7", "#cbc9e2", "#9e9ac8", "#756bb1", "#54278f"},
+			6: {"#f2f0f7", "#dadaeb", "#bcbddc", "#9e9ac8", "#756bb1", "#54278f"},
+			7: {"#f2f0f7", "#dadaeb", "#bcbddc", "#9e9ac8", "#807dba", "#6a51a3", "#4a1486"},
+			8: {"#fcfbfd", "#efedf5", "#dadaeb", "#bcbddc", "#9e9ac8", "#807dba", "#6a51a3", "#4a1486"},
+			9: {"#fcfbfd", "#efedf5", "#dadaeb", "#bcbddc", "#9e9ac8", "#807dba", "#6a51a3", "#54278f", "#3f007d"},
+		},
+	},
+	{
+		Name: "YlGnBu", Type: Sequential, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3: {"#edf8b1", "#7fcdbb", "#2c7fb8"},
+			4: {"#ffffcc", "#a1dab4", "#41b6c4", "#225ea8"},
+			5: {"#ffffcc", "#a1dab4", "#41b6c4", "#2c7fb8", "#253494"},
+			6: {"#ffffcc", "#c7e9b4", "#7fcdbb", "#41b6c4", "#2c7fb8", "#253494"},
+			7: {"#ffffcc", "#c7e9b4", "#7fcdbb", "#41b6c4", "#1d91c0", "#225ea8", "#0c2c84"},
+			8: {"#ffffd9", "#edf8b1", "#c7e9b4", "#7fcdbb", "#41b6c4", "#1d91c0", "#225ea8", "#0c2c84"},
+			9: {"#ffffd9", "#edf8b1", "#c7e9b4", "#7fcdbb", "#41b6c4", "#1d91c0", "#225ea8", "#253494", "#081d58"},
+		},
+	},
+	{
+		Name: "YlOrRd", Type: Sequential, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3: {"#ffeda0", "#feb24c", "#f03b20"},
+			4: {"#ffffb2", "#fecc5c", "#fd8d3c", "#e31a1c"},
+			5: {"#ffffb2", "#fecc5c", "#fd8d3c", "#f03b20", "#bd0026"},
+			6: {"#ffffb2", "#fed976", "#feb24c", "#fd8d3c", "#f03b20", "#bd0026"},
+			7: {"#ffffb2", "#fed976", "#feb24c", "#fd8d3c", "#fc4e2a", "#e31a1c", "#b10026"},
+			8: {"#ffffcc", "#ffeda0", "#fed976", "#feb24c", "#fd8d3c", "#fc4e2a", "#e31a1c", "#b10026"},
+			9: {"#ffffcc", "#ffeda0", "#fed976", "#feb24c", "#fd8d3c", "#fc4e2a", "#e31a1c", "#bd0026", "#800026"},
+		},
+	},
+	{
+		Name: "RdBu", Type: Diverging, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3:  {"#ef8a62", "#f7f7f7", "#67a9cf"},
+			4:  {"#ca0020", "#f4a582", "#92c5de", "#0571b0"},
+			5:  {"#ca0020", "#f4a582", "#f7f7f7", "#92c5de", "#0571b0"},
+			6:  {"#b2182b", "#ef8a62", "#fddbc7", "#d1e5f0", "#67a9cf", "#2166ac"},
+			7:  {"#b2182b", "#ef8a62", "#fddbc7", "#f7f7f7", "#d1e5f0", "#67a9cf", "#2166ac"},
+			8:  {"#b2182b", "#d6604d", "#f4a582", "#fddbc7", "#d1e5f0", "#92c5de", "#4393c3", "#2166ac"},
+			9:  {"#b2182b", "#d6604d", "#f4a582", "#fddbc7", "#f7f7f7", "#d1e5f0", "#92c5de", "#4393c3", "#2166ac"},
+			10: {"#67001f", "#b2182b", "#d6604d", "#f4a582", "#fddbc7", "#d1e5f0", "#92c5de", "#4393c3", "#2166ac", "#053061"},
+			11: {"#67001f", "#b2182b", "#d6604d", "#f4a582", "#fddbc7", "#f7f7f7", "#d1e5f0", "#92c5de", "#4393c3", "#2166ac", "#053061"},
+		},
+	},
+	{
+		Name: "PuOr", Type: Diverging, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3:  {"#f1a340", "#f7f7f7", "#998ec3"},
+			4:  {"#e66101", "#fdb863", "#b2abd2", "#5e3c99"},
+			5:  {"#e66101", "#fdb863", "#f7f7f7", "#b2abd2", "#5e3c99"},
+			6:  {"#b35806", "#f1a340", "#fee0b6", "#d8daeb", "#998ec3", "#542788"},
+			7:  {"#b35806", "#f1a340", "#fee0b6", "#f7f7f7", "#d8daeb", "#998ec3", "#542788"},
+			8:  {"#b35806", "#e08214", "#fdb863", "#fee0b6", "#d8daeb", "#b2abd2", "#8073ac", "#542788"},
+			9:  {"#b35806", "#e08214", "#fdb863", "#fee0b6", "#f7f7f7", "#d8daeb", "#b2abd2", "#8073ac", "#542788"},
+			10: {"#7f3b08", "#b35806", "#e08214", "#fdb863", "#fee0b6", "#d8daeb", "#b2abd2", "#8073ac", "#542788", "#2d004b"},
+			11: {"#7f3b08", "#b35806", "#e08214", "#fdb863", "#fee0b6", "#f7f7f7", "#d8daeb", "#b2abd2", "#8073ac", "#542788", "#2d004b"},
+		},
+	},
+	{
+		Name: "BrBG", Type: Diverging, ColourBlindSafe: true,
+		colours: map[int][]string{
+			3:  {"#d8b365", "#f5f5f5", "#5ab4ac"},
+			4:  {"#a6611a", "#dfc27d", "#80cdc1", "#018571"},
+			5:  {"#a6611a", "#dfc27d", "#f5f5f5", "#80cdc1", "#018571"},
+			6:  {"#8c510a", "#d8b365", "#f6e8c3", "#c7eae5", "#5ab4ac", "#01665e"},
+			7:  {"#8c510a", "#d8b365", "#f6e8c3", "#f5f5f5", "#c7eae5", "#5ab4ac", "#01665e"},
+			8:  {"#8c510a", "#bf812d", "#dfc27d", "#f6e8c3", "#c7eae5", "#80cdc1", "#35978f", "#01665e"},
+			9:  {"#8c510a", "#bf812d", "#dfc27d", "#f6e8c3", "#f5f5f5", "#c7eae5", "#80cdc1", "#35978f", "#01665e"},
+			10: {"#543005", "#8c510a", "#bf812d", "#dfc27d", "#f6e8c3", "#c7eae5", "#80cdc1", "#35978f", "#01665e", "#003c30"},
+			11: {"#543005", "#8c510a", "#bf812d", "#dfc27d", "#f6e8c3", "#f5f5f5", "#c7eae5", "#80cdc1", "#35978f", "#01665e", "#003c30"},
+		},
+	},
+	{
+		Name: "RdYlGn", Type: Diverging, ColourBlindSafe: false,
+		colours: map[int][]string{
+			3:  {"#fc8d59", "#ffffbf", "#91cf60"},
+			4:  {"#d7191c", "#fdae61", "#a6d96a", "#1a9641"},
+			5:  {"#d7191c", "#fdae61", "#ffffbf", "#a6d96a", "#1a9641"},
+			6:  {"#d73027", "#fc8d59", "#fee08b", "#d9ef8b", "#91cf60", "#1a9850"},
+			7:  {"#d73027", "#fc8d59", "#fee08b", "#ffffbf", "#d9ef8b", "#91cf60", "#1a9850"},
+			8:  {"#d73027", "#f46d43", "#fdae61", "#fee08b", "#d9ef8b", "#a6d96a", "#66bd63", "#1a9850"},
+			9:  {"#d73027", "#f46d43", "#fdae61", "#fee08b", "#ffffbf", "#d9ef8b", "#a6d96a", "#66bd63", "#1a9850"},
+			10: {"#a50026", "#d73027", "#f46d43", "#fdae61", "#fee08b", "#d9ef8b", "#a6d96a", "#66bd63", "#1a9850", "#006837"},
+			11: {"#a50026", "#d73027", "#f46d43", "#fdae61", "#fee08b", "#ffffbf", "#d9ef8b", "#a6d96a", "#66bd63", "#1a9850", "#006837"},
+		},
+	},
+}
@@ -0,0 +1,62 @@
+package palette_test
+
+import (
+	"testing"
+
+	. "github.com/ONSdigital/dp-map-renderer/palette"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGet(t *testing.T) {
+	Convey("Get should return a palette by name, ignoring case", t, func() {
+		So(Get("Blues"), ShouldNotBeNil)
+		So(Get("blues"), ShouldEqual, Get("Blues"))
+		So(Get("RdBu").Type, ShouldEqual, Diverging)
+	})
+
+	Convey("Get should return nil for an unknown palette", t, func() {
+		So(Get("NoSuchPalette"), ShouldBeNil)
+	})
+}
+
+func TestColours(t *testing.T) {
+	Convey("Colours should return one colour per class", t, func() {
+		for _, p := range All() {
+			for n := 2; n <= 11; n++ {
+				colours, err := p.Colours(n)
+				if p.SupportsClassCount(n) {
+					So(err, ShouldBeNil)
+					So(len(colours), ShouldEqual, n)
+				} else {
+					So(err, ShouldNotBeNil)
+				}
+			}
+		}
+	})
+
+	Convey("Sequential palettes support up to 9 classes and diverging palettes up to 11", t, func() {
+		So(Get("Blues").SupportsClassCount(9), ShouldBeTrue)
+		So(Get("Blues").SupportsClassCount(10), ShouldBeFalse)
+		So(Get("RdBu").SupportsClassCount(11), ShouldBeTrue)
+		So(Get("RdBu").SupportsClassCount(12), ShouldBeFalse)
+	})
+
+	Convey("MaxClassCount should return the largest number of classes supported by a type of palette", t, func() {
+		So(MaxClassCount(Sequential), ShouldEqual, 9)
+		So(MaxClassCount(Diverging), ShouldEqual, 11)
+		So(MaxClassCount("unknown"), ShouldEqual, 0)
+	})
+
+	Convey("Two-class schemes use the outer colours of the three-class scheme", t, func() {
+		colours, err := Get("Blues").Colours(2)
+		So(err, ShouldBeNil)
+		So(colours, ShouldResemble, []string{"#deebf7", "#3182bd"})
+	})
+
+	Convey("Colours should return a copy that can safely be modified", t, func() {
+		colours, _ := Get("Blues").Colours(3)
+		colours[0] = "red"
+		again, _ := Get("Blues").Colours(3)
+		So(again[0], ShouldEqual, "#deebf7")
+	})
+}
@@ -0,0 +1,52 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mapAlt returns the alt text of a png image of the map: its title, and the range of the values in the data if it is a choropleth
+func (svgRequest *SVGRequest) mapAlt() string {
+	request := svgRequest.request
+	alt := "Map"
+	if title := strings.Join(strings.Fields(request.Title), " "); len(title) > 0 {
+		alt += ": " + title
+	}
+	if len(svgRequest.breaks) > 0 && len(request.Data) > 0 {
+		alt += fmt.Sprintf(", with values from %g to %g", svgRequest.dataMin, svgRequest.dataMax)
+	}
+	return alt
+}
+
+// keyAlt returns the alt text of a png image of the key: the legend title and the range of the key
+func (svgRequest *SVGRequest) keyAlt() string {
+	alt := "Map key"
+	if len(svgRequest.breaks) == 0 {
+		return alt
+	}
+	choropleth := svgRequest.request.Choropleth
+	if title := strings.Join(strings.Fields(choropleth.ValuePrefix+" "+choropleth.ValueSuffix), " "); len(title) > 0 {
+		alt += ": " + title
+	}
+	return alt + fmt.Sprintf(", from %g to %g", svgRequest.breaks[0].LowerBound, svgRequest.breaks[len(svgRequest.breaks)-1].UpperBound)
+}
+
+// mapTitle returns the title of the map svg document ("Map", followed by the title of the request if it has one)
+func (svgRequest *SVGRequest) mapTitle() string {
+	return documentTitle("Map: ", "Map", svgRequest.request.Title)
+}
+
+// keyTitle returns the title of the svg document of the key with the given orientation ("horizontal" or "vertical"),
+// e.g. "Horizontal key for " followed by the title of the request
+func (svgRequest *SVGRequest) keyTitle(orientation string) string {
+	key := strings.ToUpper(orientation[:1]) + orientation[1:] + " key"
+	return documentTitle(key+" for ", key, svgRequest.request.Title)
+}
+
+// documentTitle returns the prefix followed by the title (with its whitespace normalised), or the fallback if the title is empty
+func documentTitle(prefix string, fallback string, title string) string {
+	if title = strings.Join(strings.Fields(title), " "); len(title) > 0 {
+		return prefix + title
+	}
+	return fallback
+}
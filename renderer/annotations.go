@@ -0,0 +1,93 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// AnnotationClassName is the name of the class assigned to all annotations (labelled markers) drawn on the map
+const AnnotationClassName = "mapAnnotation"
+
+// PlaceLabelClassName is the name of the class assigned to all place labels (see RenderRequest.PlaceLabels) drawn on the map
+const PlaceLabelClassName = "mapPlaceLabel"
+
+// annotationPoints returns the coordinates of the annotations, for inclusion in the bounds of the map
+func annotationPoints(annotations []*models.Annotation) [][]float64 {
+	points := [][]float64{}
+	for _, a := range annotations {
+		points = append(points, []float64{a.Longitude, a.Latitude})
+	}
+	return points
+}
+
+// annotationOverlay returns an overlay that draws each annotation as a marker circle with its label offset above and to the right
+func annotationOverlay(svgRequest *SVGRequest) g2s.Overlay {
+	request := svgRequest.request
+	return func(sf g2s.ScaleFunc) string {
+		content := bytes.NewBufferString("")
+		fmt.Fprintf(content, `<g id="%s-annotations">`, mapID(request))
+		for _, a := range request.Annotations {
+			x, y := sf(a.Longitude, a.Latitude)
+			writeMarker(content, annotationClass(a), x, y, 3, "fill: black; stroke: white; stroke-width: 1;", a.Label, "mapAnnotationText", svgRequest.fontSize())
+		}
+		fmt.Fprint(content, `</g>`)
+		return content.String()
+	}
+}
+
+// placeLabelOverlay returns an overlay that draws each place label (of a tier shown at the width of the map) as a small dot with its name
+// offset above and to the right - smaller and lighter than an annotation, so that annotations stand out from the places around them
+func placeLabelOverlay(svgRequest *SVGRequest) g2s.Overlay {
+	request := svgRequest.request
+	return func(sf g2s.ScaleFunc) string {
+		content := bytes.NewBufferString("")
+		fmt.Fprintf(content, `<g id="%s-place-labels">`, mapID(request))
+		for _, p := range visiblePlaceLabels(request.PlaceLabels, svgRequest.ViewBoxWidth) {
+			size := p.Size
+			if size <= 0 {
+				size = svgRequest.fontSize() - 2
+			}
+			x, y := sf(p.Longitude, p.Latitude)
+			writeMarker(content, PlaceLabelClassName, x, y, 2, "fill: #323132;", p.Name, "mapPlaceLabelText", size)
+		}
+		fmt.Fprint(content, `</g>`)
+		return content.String()
+	}
+}
+
+// visiblePlaceLabels returns the place labels whose tier is drawn on a map of the given width (see models.PlaceLabelTierWidth)
+func visiblePlaceLabels(labels []*models.PlaceLabel, width float64) []*models.PlaceLabel {
+	visible := []*models.PlaceLabel{}
+	for _, p := range labels {
+		if width >= float64(p.Tier*models.PlaceLabelTierWidth) {
+			visible = append(visible, p)
+		}
+	}
+	return visible
+}
+
+// writeMarker writes a group with the given class, containing a circle of the given radius and style at (x, y),
+// and the (escaped) text, if any, offset above and to the right of the circle
+func writeMarker(w io.Writer, class string, x, y, radius float64, style string, text string, textClass string, fontSize int) {
+	fmt.Fprintf(w, `<g class="%s">`, class)
+	fmt.Fprintf(w, `<circle cx="%f" cy="%f" r="%g" style="%s"></circle>`, x, y, radius, style)
+	if len(text) > 0 {
+		fmt.Fprintf(w, `<text x="%f" y="%f" style="font-size: %dpx;" class="%s">%s</text>`, x+radius+2, y-radius-2, fontSize, textClass, htmlutil.EscapeText(text))
+	}
+	fmt.Fprint(w, `</g>`)
+}
+
+// annotationClass returns the class list of the annotation - AnnotationClassName followed by each of its (sanitised) classes
+func annotationClass(a *models.Annotation) string {
+	classes := []string{AnnotationClassName}
+	for _, class := range strings.Fields(a.Class) {
+		classes = append(classes, htmlutil.SanitizeIdentifier(class))
+	}
+	return strings.Join(classes, " ")
+}
@@ -0,0 +1,250 @@
+package renderer_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// The size of the synthetic geography, and the baseline to compare the benchmarks with, e.g.
+//
+//	go test ./renderer -run TestBenchmarkBaseline -args -baseline=/tmp/baseline.json -baseline.update
+//	go test ./renderer -bench . -args -synthetic.features=5000 -synthetic.points=200
+var (
+	syntheticFeatures = flag.Int("synthetic.features", 2000, "the number of features in the synthetic geography used by the benchmarks")
+	syntheticPoints   = flag.Int("synthetic.points", 50, "the number of points in the boundary of each synthetic feature")
+	baselinePath      = flag.String("baseline", "", "a json file of benchmark costs that TestBenchmarkBaseline compares the benchmarks with")
+	syntheticRows     = flag.Int("synthetic.rows", 35000, "the number of data rows in the large data request used by the benchmarks")
+	updateBaseline    = flag.Bool("baseline.update", false, "if true, TestBenchmarkBaseline saves the benchmark costs as the baseline instead of comparing them")
+	baselineTolerance = flag.Float64("baseline.tolerance", 0.2, "the fraction by which a benchmark may exceed its baseline cost")
+)
+
+// renderBenchmarks are run (as sub-benchmarks) with both the example request and a synthetic request
+var renderBenchmarks = []struct {
+	name string
+	fn   func(b *testing.B, request *models.RenderRequest)
+}{
+	{"PrepareSVGRequest", benchmarkPrepareSVGRequest},
+	{"RenderSVG", benchmarkRenderSVG},
+	{"RenderHorizontalKey", benchmarkRenderHorizontalKey},
+	{"RenderVerticalKey", benchmarkRenderVerticalKey},
+}
+
+func BenchmarkPrepareSVGRequest(b *testing.B) {
+	runWithBenchmarkRequests(b, benchmarkPrepareSVGRequest)
+}
+
+func BenchmarkRenderSVG(b *testing.B) {
+	runWithBenchmarkRequests(b, benchmarkRenderSVG)
+}
+
+func BenchmarkRenderHorizontalKey(b *testing.B) {
+	runWithBenchmarkRequests(b, benchmarkRenderHorizontalKey)
+}
+
+func BenchmarkRenderVerticalKey(b *testing.B) {
+	runWithBenchmarkRequests(b, benchmarkRenderVerticalKey)
+}
+
+func benchmarkPrepareSVGRequest(b *testing.B, request *models.RenderRequest) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		PrepareSVGRequest(request)
+	}
+}
+
+// benchmarkRenderSVG prepares a new SVGRequest for each iteration (outside the timer), as RenderSVG modifies the features of the request
+func benchmarkRenderSVG(b *testing.B, request *models.RenderRequest) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		svgRequest := PrepareSVGRequest(request)
+		b.StartTimer()
+		RenderSVG(svgRequest)
+	}
+}
+
+func benchmarkRenderHorizontalKey(b *testing.B, request *models.RenderRequest) {
+	svgRequest := PrepareSVGRequest(request)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		RenderHorizontalKey(svgRequest)
+	}
+}
+
+func benchmarkRenderVerticalKey(b *testing.B, request *models.RenderRequest) {
+	svgRequest := PrepareSVGRequest(request)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		RenderVerticalKey(svgRequest)
+	}
+}
+
+// runWithBenchmarkRequests runs the benchmark with each of the benchmark requests as a sub-benchmark
+func runWithBenchmarkRequests(b *testing.B, benchmark func(b *testing.B, request *models.RenderRequest)) {
+	for _, r := range benchmarkRequests(b) {
+		request := r.request
+		b.Run(r.name, func(b *testing.B) { benchmark(b, request) })
+	}
+}
+
+type namedRequest struct {
+	name    string
+	request *models.RenderRequest
+}
+
+// benchmarkRequests returns the example request, a request using a synthetic geography and a request with a large amount of data
+// for a small synthetic geography (see the synthetic.* flags)
+func benchmarkRequests(tb testing.TB) []namedRequest {
+	example, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(tb)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return []namedRequest{
+		{"example", example},
+		{fmt.Sprintf("synthetic-%dx%d", *syntheticFeatures, *syntheticPoints), syntheticRequest(*syntheticFeatures, *syntheticPoints)},
+		{fmt.Sprintf("data-%d", *syntheticRows), largeDataRequest(*syntheticRows)},
+	}
+}
+
+// largeDataRequest returns a synthetic request for 100 features, with the given number of data rows - most of which do not match a feature
+func largeDataRequest(rows int) *models.RenderRequest {
+	request := syntheticRequest(100, 4)
+	geography := testdata.GenerateGeography(rows, 4)
+	for i := len(request.Data); i < rows; i++ {
+		request.Data = append(request.Data, &models.DataRow{ID: "X" + geography.IDs[i], Value: geography.Values[i]})
+	}
+	return request
+}
+
+// syntheticRequest returns a request for a choropleth of a synthetic geography, with both legends
+func syntheticRequest(features int, points int) *models.RenderRequest {
+	geography := testdata.GenerateGeography(features, points)
+	data := make([]*models.DataRow, len(geography.IDs))
+	upperBound := 0.0
+	for i, id := range geography.IDs {
+		data[i] = &models.DataRow{ID: id, Value: geography.Values[i]}
+		if geography.Values[i] > upperBound {
+			upperBound = geography.Values[i]
+		}
+	}
+	return &models.RenderRequest{
+		Filename:     "synthetic",
+		Geography:    &models.Geography{Topojson: geography.Topology, IDProperty: "code", NameProperty: "name"},
+		Data:         data,
+		DefaultWidth: models.DefaultViewBoxWidth,
+		FontSize:     models.DefaultFontSize,
+		MapType:      models.MapTypeChoropleth,
+		Choropleth: &models.Choropleth{
+			ValuePrefix: "Synthetic",
+			ValueSuffix: "values",
+			Breaks: []*models.ChoroplethBreak{
+				{LowerBound: 0, Colour: "#fee5d9"}, {LowerBound: 2, Colour: "#fcae91"}, {LowerBound: 5, Colour: "#fb6a4a"},
+				{LowerBound: 10, Colour: "#de2d26"}, {LowerBound: 20, Colour: "#a50f15"},
+			},
+			UpperBound:               upperBound,
+			ReferenceLines:           []*models.ReferenceLine{{Value: 10, Text: "Average"}},
+			HorizontalLegendPosition: models.LegendPositionBefore,
+			VerticalLegendPosition:   models.LegendPositionAfter,
+		},
+	}
+}
+
+// TestBenchmarkBaseline runs the render benchmarks and compares their costs with the baseline given by the -baseline flag,
+// failing if any exceeds it by more than -baseline.tolerance. With -baseline.update, the costs are saved as the baseline instead.
+// Skipped if no baseline is given. Baselines depend on the machine, so should be recorded on the machine that compares with them.
+func TestBenchmarkBaseline(t *testing.T) {
+	if len(*baselinePath) == 0 {
+		t.Skip("no baseline given (see the -baseline flag)")
+	}
+
+	var baseline testdata.BenchmarkBaseline
+	if !*updateBaseline {
+		var err error
+		baseline, err = testdata.LoadBenchmarkBaseline(*baselinePath)
+		if os.IsNotExist(err) {
+			t.Skipf("the baseline %s does not exist - create it using -baseline.update", *baselinePath)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := testdata.BenchmarkBaseline{}
+	for _, r := range benchmarkRequests(t) {
+		for _, bm := range renderBenchmarks {
+			request, fn := r.request, bm.fn
+			results[bm.name+"/"+r.name] = testdata.CostOf(testing.Benchmark(func(b *testing.B) { fn(b, request) }))
+		}
+	}
+
+	if *updateBaseline {
+		if err := results.Save(*baselinePath); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	for _, regression := range baseline.Compare(results, *baselineTolerance) {
+		t.Error(regression)
+	}
+}
+
+func TestSyntheticRequest(t *testing.T) {
+	Convey("A synthetic request should render a region for each feature, without warnings", t, func() {
+		request := syntheticRequest(30, 10)
+		So(request.ValidateRenderRequest(), ShouldBeNil)
+
+		svgRequest := PrepareSVGRequest(request)
+		svg := RenderSVG(svgRequest)
+		So(strings.Count(svg, "<path "), ShouldEqual, 30)
+		So(svg, ShouldContainSubstring, `id="map-synthetic-F000029"`)
+		So(svgRequest.Warnings, ShouldBeEmpty)
+		So(RenderVerticalKey(svgRequest), ShouldContainSubstring, "Synthetic values")
+	})
+
+	Convey("The same counts should always generate the same geography", t, func() {
+		So(testdata.GenerateGeography(30, 10), ShouldResemble, testdata.GenerateGeography(30, 10))
+		So(testdata.GenerateGeography(30, 10).CSV(), ShouldStartWith, "F000000,")
+	})
+}
+
+func TestBenchmarkBaselineCompare(t *testing.T) {
+	Convey("Only costs exceeding the baseline by more than the tolerance should be reported", t, func() {
+		baseline := testdata.BenchmarkBaseline{
+			"RenderSVG/example": {NsPerOp: 1000, AllocsPerOp: 100, BytesPerOp: 5000},
+			"RenderSVG/other":   {NsPerOp: 1000, AllocsPerOp: 100, BytesPerOp: 5000},
+		}
+		results := testdata.BenchmarkBaseline{
+			"RenderSVG/example": {NsPerOp: 1100, AllocsPerOp: 130, BytesPerOp: 5000},
+			"RenderSVG/other":   {NsPerOp: 900, AllocsPerOp: 100, BytesPerOp: 5999},
+			"RenderSVG/new":     {NsPerOp: 9999, AllocsPerOp: 999, BytesPerOp: 99999},
+		}
+
+		So(baseline.Compare(results, 0.2), ShouldResemble, []string{
+			"RenderSVG/example: 130 allocs/op exceeds the baseline of 100 by more than 20%",
+		})
+		So(baseline.Compare(results, 0.05), ShouldHaveLength, 3)
+	})
+
+	Convey("A saved baseline should be loaded unchanged", t, func() {
+		path := filepath.Join(os.TempDir(), "dp-map-renderer-baseline-test.json")
+		defer os.Remove(path)
+		baseline := testdata.BenchmarkBaseline{"RenderSVG/example": {NsPerOp: 1000, AllocsPerOp: 100, BytesPerOp: 5000}}
+
+		So(baseline.Save(path), ShouldBeNil)
+		loaded, err := testdata.LoadBenchmarkBaseline(path)
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, baseline)
+	})
+}
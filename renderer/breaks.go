@@ -0,0 +1,61 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/dp-map-renderer/analyser"
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// setAutomaticBreaks computes the breaks of a choropleth that has none from the data of the request (see analyser.ChooseBreaks),
+// for the class count and palette of the choropleth, if given. The breaks are left without a colour, to be coloured from the palette.
+// When the request has DataSets, the breaks are computed from the values of all of them, so that every data set is classified against the same breaks.
+// Returns a warning recording the breaks chosen, or why none could be computed (in which case the regions are not coloured),
+// or empty if the request already has breaks or has no data.
+func setAutomaticBreaks(request *models.RenderRequest) string {
+	choropleth := request.Choropleth
+	if choropleth == nil || len(choropleth.Breaks) > 0 || len(request.Data) == 0 {
+		return ""
+	}
+	data := request.Data
+	if len(request.DataSets) > 1 {
+		data = nil
+		for _, set := range request.DataSets {
+			if set != nil {
+				data = append(data, set.Data...)
+			}
+		}
+	}
+	values := []float64{}
+	for _, row := range data {
+		if row != nil && !row.Missing {
+			values = append(values, row.Value)
+		}
+	}
+	paletteName := ""
+	if choropleth.Palette != nil {
+		paletteName = choropleth.Palette.Name
+	}
+
+	chosen, err := analyser.ChooseBreaks(context.Background(), values, choropleth.ClassCount, paletteName)
+	if err != nil {
+		return fmt.Sprintf("No breaks were given, and none could be computed from the data - the regions have not been coloured: %v", err)
+	}
+	lowerBounds := make([]string, len(chosen.LowerBounds))
+	for i, lowerBound := range chosen.LowerBounds {
+		choropleth.Breaks = append(choropleth.Breaks, &models.ChoroplethBreak{LowerBound: lowerBound})
+		lowerBounds[i] = strconv.FormatFloat(lowerBound, 'g', -1, 64)
+	}
+	if choropleth.Palette == nil {
+		choropleth.Palette = &models.ChoroplethPalette{Name: chosen.Palette}
+	}
+	fit := "the requested"
+	if chosen.BestFit {
+		fit = "the best fit"
+	}
+	return fmt.Sprintf("No breaks were given - natural breaks were computed from the data, using %s %d classes coloured with the %s palette (lower bounds: %s)",
+		fit, len(chosen.LowerBounds), chosen.Palette, strings.Join(lowerBounds, ", "))
+}
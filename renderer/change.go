@@ -0,0 +1,106 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// changeSignificantDigits is the precision to which a change is rounded, removing the floating point error of the subtraction (e.g. of 10.2 from 14.1)
+const changeSignificantDigits = 12
+
+// setChangeData replaces the Data of a request that has CompareData with the change from the CompareData to the Data of each region,
+// so that the regions are classified by their change. The DisplayValue of each row shows both values and the change (see models.Change),
+// e.g. "2011: 10%, 2021: 14%, +4pp", and the choropleth is set to show display values without the value prefix and suffix.
+// Rows whose id is in only one of the data sets are omitted, so that their regions are shown without data, and a region that is Missing in either
+// data set is Missing (with the Reason of the Data, or else of the CompareData) in the change. The CompareData is then removed,
+// so that preparing the request again does not repeat the calculation.
+// Returns a warning listing the ids that are in only one of the data sets, or empty if there are none (or the request has no CompareData).
+func setChangeData(request *models.RenderRequest) string {
+	if len(request.CompareData) == 0 {
+		return ""
+	}
+	change := request.Change
+	if change == nil {
+		change = &models.Change{}
+	}
+	label, compareLabel := change.Label, change.CompareLabel
+	if len(label) == 0 {
+		label = models.DefaultChangeLabel
+	}
+	if len(compareLabel) == 0 {
+		compareLabel = models.DefaultCompareLabel
+	}
+	choropleth := request.Choropleth
+	if choropleth == nil {
+		choropleth = &models.Choropleth{}
+	}
+
+	compareRows := make(map[string]*models.DataRow)
+	for _, row := range request.CompareData {
+		compareRows[request.IDNormalisation.Normalise(row.ID)] = row
+	}
+	data := []*models.DataRow{}
+	matched := make(map[string]bool)
+	oneSided := []string{}
+	for _, row := range request.Data {
+		id := request.IDNormalisation.Normalise(row.ID)
+		compareRow, exists := compareRows[id]
+		if !exists {
+			oneSided = append(oneSided, row.ID)
+			continue
+		}
+		matched[id] = true
+		if row.Missing || compareRow.Missing {
+			reason := row.Reason
+			if !row.Missing {
+				reason = compareRow.Reason
+			}
+			data = append(data, &models.DataRow{ID: row.ID, Missing: true, Reason: reason, FootnoteRefs: row.FootnoteRefs})
+			continue
+		}
+		difference := roundChange(row.Value - compareRow.Value)
+		text := fmt.Sprintf("%s: %s, %s: %s, %s", compareLabel, displayValue(choropleth, valueAndColour{value: compareRow.Value, row: compareRow}),
+			label, displayValue(choropleth, valueAndColour{value: row.Value, row: row}), formatChange(choropleth, change.Mode, difference))
+		data = append(data, &models.DataRow{ID: row.ID, Value: difference, DisplayValue: text, FootnoteRefs: row.FootnoteRefs})
+	}
+	for _, row := range request.CompareData {
+		if !matched[request.IDNormalisation.Normalise(row.ID)] {
+			oneSided = append(oneSided, row.ID)
+		}
+	}
+
+	request.Data = data
+	request.CompareData = nil
+	if request.Choropleth != nil {
+		request.Choropleth.DisplayValueOnly = true
+	}
+	if len(oneSided) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d data rows are not in both the data and the compare data, so their regions are shown without data. IDs: %s", len(oneSided), summariseIDs(oneSided))
+}
+
+// roundChange rounds the change to changeSignificantDigits
+func roundChange(difference float64) float64 {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(difference, 'g', changeSignificantDigits, 64), 64)
+	if err != nil {
+		return difference
+	}
+	return rounded
+}
+
+// formatChange formats the change with an explicit sign - in percentage points (e.g. "+4pp") for ChangeModePercentagePoint,
+// otherwise with the value prefix and suffix of the choropleth (e.g. "-£1.5k")
+func formatChange(choropleth *models.Choropleth, mode string, difference float64) string {
+	sign := "+"
+	if difference < 0 {
+		sign = "-"
+	}
+	if mode == models.ChangeModePercentagePoint {
+		return fmt.Sprintf("%s%gpp", sign, math.Abs(difference))
+	}
+	return fmt.Sprintf("%s%s%g%s", sign, choropleth.ValuePrefix, math.Abs(difference), choropleth.ValueSuffix)
+}
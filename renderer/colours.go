@@ -0,0 +1,22 @@
+package renderer
+
+import (
+	"github.com/ONSdigital/dp-map-renderer/colour"
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// colourWarnings returns warnings describing the classes of the choropleth that are hard to tell apart from each other,
+// or from the text and outline of the key (see colour.CheckPalette) - and, if colourBlind is true, with red-green colour blindness.
+// The opacity of the breaks is not taken into account.
+func colourWarnings(request *models.RenderRequest, colourBlind bool) []string {
+	if request.Choropleth == nil {
+		return nil
+	}
+	var colours []string
+	for _, b := range sortBreaks(request.Choropleth.Breaks, true) {
+		if len(b.Colour) > 0 {
+			colours = append(colours, b.Colour)
+		}
+	}
+	return colour.CheckPalette(colours, models.KeyForegrounds, colourBlind)
+}
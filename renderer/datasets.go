@@ -0,0 +1,132 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	h "github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/paulmach/go.geojson"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DataSetButtonsClassName is the class of the group of buttons that switch the map between the DataSets of the request
+const DataSetButtonsClassName = "map__data-sets"
+
+// dataSetsText is the accessible name of the group of buttons (text that will need internationalising at some point)
+const dataSetsText = "Data sets"
+
+// dataSetsScript switches the map between the data sets embedded in the figure (whose id prefix is the first argument) when a button is pressed,
+// setting the fill (and fill opacity) and title of each region (and of its low detail copy, whose id has the suffix given as the second argument) to those of the data set
+const dataSetsScript = `
+	(function() {
+		var prefix = "%s";
+		var dataSets = JSON.parse(document.getElementById(prefix + "-data-sets-json").textContent);
+		var buttons = document.querySelectorAll("#" + prefix + "-data-sets button");
+		var show = function(index) {
+			var regions = dataSets[index].regions;
+			for (var id in regions) {
+				[id, id + "%s"].forEach(function(regionId) { // the region and its low detail copy, if any
+					var region = document.getElementById(regionId);
+					if (!region) {
+						return;
+					}
+					region.style.fill = regions[id].fill;
+					region.style.fillOpacity = regions[id].fill_opacity === undefined ? "" : regions[id].fill_opacity;
+					var title = region.querySelector("title");
+					if (title) {
+						title.textContent = regions[id].title;
+					}
+				});
+			}
+			for (var i = 0; i < buttons.length; i++) {
+				buttons[i].setAttribute("aria-pressed", i === index ? "true" : "false");
+			}
+		};
+		for (var i = 0; i < buttons.length; i++) {
+			buttons[i].addEventListener("click", show.bind(null, i));
+		}
+	})();
+`
+
+// dataSetRegion is the fill and title of a region for one of the data sets of a request
+type dataSetRegion struct {
+	Fill        string   `json:"fill"`
+	FillOpacity *float64 `json:"fill_opacity,omitempty"` // the opacity of the break of the region's value, if given
+	Title       string   `json:"title"`
+}
+
+// dataSetJSON is one of the data sets of a request, as embedded in the figure for dataSetsScript
+type dataSetJSON struct {
+	Label   string                   `json:"label"`
+	Regions map[string]dataSetRegion `json:"regions"` // keyed by the id of the region
+}
+
+// dataSetsJSON returns the fill and title of every region for each of the DataSets of the request, classified against the breaks of the request,
+// as a json array of dataSetJSON. Returns empty if the request does not have more than one data set, or has no breaks.
+// The ids of the features must already have been set (see setFeatureIDs), but not their titles.
+func dataSetsJSON(svgRequest *SVGRequest, features []*geojson.Feature) string {
+	request := svgRequest.request
+	if len(request.DataSets) < 2 || len(svgRequest.descendingBreaks) == 0 {
+		return ""
+	}
+	id := idPrefix(request)
+	missingValueFill := "url(#" + id + "-nodata)"
+	sets := make([]dataSetJSON, len(request.DataSets))
+	for i, set := range request.DataSets {
+		dataMap := mapDataToColour(set.Data, svgRequest.descendingBreaks, id+"-", request.IDNormalisation)
+		missingReasons := mapMissingReasons(set.Data, id+"-", request.IDNormalisation)
+		regions := make(map[string]dataSetRegion)
+		for _, feature := range features {
+			name, ok := feature.Properties[request.Geography.NameProperty]
+			if !ok {
+				name = ""
+			}
+			featureID := normaliseFeatureID(feature.ID, id+"-", request.IDNormalisation)
+			region := dataSetRegion{Fill: missingValueFill, Title: fmt.Sprintf("%v %s", name, MissingDataText)}
+			if vc, exists := dataMap[featureID]; exists {
+				region = dataSetRegion{Fill: vc.colour, FillOpacity: vc.opacity, Title: fmt.Sprintf("%v %s", name, dataText(request.Choropleth, vc))}
+			} else if reason, exists := missingReasons[featureID]; exists {
+				region.Title = fmt.Sprintf("%v %s", name, reason)
+			}
+			regions[fmt.Sprintf("%v", feature.ID)] = region
+		}
+		sets[i] = dataSetJSON{Label: set.Label, Regions: regions}
+	}
+	b, err := json.Marshal(sets)
+	if err != nil {
+		log.Error(err, nil)
+		return ""
+	}
+	return string(b)
+}
+
+// renderDataSets returns a group of buttons (one for each of the DataSets of the request), the data sets as json and the script that switches between them,
+// or empty if the map has no data sets to switch between. RenderSVG must have been called first.
+func renderDataSets(svgRequest *SVGRequest) string {
+	if len(svgRequest.dataSets) == 0 {
+		return ""
+	}
+	request := svgRequest.request
+	id := idPrefix(request)
+	group := h.CreateNode("div", atom.Div,
+		h.Attr("id", id+"-data-sets"),
+		h.Attr("class", DataSetButtonsClassName),
+		h.Attr("role", "group"),
+		h.Attr("aria-label", dataSetsText))
+	for i, set := range request.DataSets {
+		group.AppendChild(h.CreateNode("button", atom.Button,
+			h.Attr("type", "button"),
+			h.Attr("aria-pressed", strconv.FormatBool(i == 0)),
+			h.SanitizeText(set.Label)))
+	}
+	var buf bytes.Buffer
+	html.Render(&buf, group)
+	fmt.Fprintf(&buf, "\n<script type=\"application/json\" id=\"%s-data-sets-json\">%s</script>", id, svgRequest.dataSets)
+	fmt.Fprintf(&buf, "\n<script type=\"text/javascript\">%s</script>\n", fmt.Sprintf(dataSetsScript, id, g2s.LowDetailIDSuffix))
+	return buf.String()
+}
@@ -0,0 +1,31 @@
+package renderer
+
+import (
+	"strings"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// includeLimitedFallbackImage generates an svg with the given attributes, content and a fallback png (with the given alt text) no larger (once encoded) than
+// the MaxFallbackPNGSize of the request. An oversized png is converted again at half the scale until it fits, or until the
+// MinFallbackPNGScale is reached, in which case the svg has no fallback. Either is recorded as a warning on the request.
+func includeLimitedFallbackImage(converter g2s.PNGConverter, svgRequest *SVGRequest, attributes string, content string, width float64, height float64, alt string) string {
+	maxSize, minScale := svgRequest.options.MaxFallbackPNGSize, svgRequest.options.MinFallbackPNGScale
+	for scale := 1.0; scale >= minScale; scale /= 2 {
+		png, err := converter.Convert([]byte(g2s.FallbackImageSVG(attributes, content, width, height, scale)))
+		if err != nil {
+			log.Error(err, log.Data{"_message": "Unable to include fallback png"})
+			return g2s.SVGWithFallbackImage(attributes, content, width, height, nil, alt)
+		}
+		if len(png) <= maxSize {
+			if scale < 1 {
+				svgRequest.addWarning("The fallback png image was reduced to %g%% of its size to fit the maximum of %d bytes", scale*100, maxSize)
+			}
+			return g2s.SVGWithFallbackImage(attributes, content, width, height, png, alt)
+		}
+		log.Debug("fallback png exceeds the maximum size", log.Data{"size": len(png), "max_size": maxSize, "scale": scale})
+	}
+	svgRequest.addWarning("The fallback png image was omitted as it exceeds the maximum of %d bytes even at %g%% of its size", maxSize, minScale*100)
+	return "<svg " + strings.TrimSpace(attributes) + ">" + content + "</svg>"
+}
@@ -0,0 +1,83 @@
+package renderer_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var svgSizePattern = regexp.MustCompile(`^<svg[^>]*?\swidth="([0-9.]+)" height="([0-9.]+)"`)
+
+// sizedPNGConverter converts svgs to a png whose (encoded) length is proportional to the width and height of the svg
+type sizedPNGConverter struct {
+	pixelsPerByte float64
+}
+
+func (c *sizedPNGConverter) Convert(svg []byte) ([]byte, error) {
+	size := svgSizePattern.FindStringSubmatch(string(svg))
+	width, _ := strconv.ParseFloat(size[1], 64)
+	height, _ := strconv.ParseFloat(size[2], 64)
+	return bytes.Repeat([]byte("A"), int(width*height/c.pixelsPerByte)), nil
+}
+
+func (c *sizedPNGConverter) IncludeFallbackImage(svgAttributes string, svgContent string, width float64, height float64, alt string) string {
+	png, _ := c.Convert([]byte(geojson2svg.FallbackImageSVG(svgAttributes, svgContent, width, height, 1)))
+	return geojson2svg.SVGWithFallbackImage(svgAttributes, svgContent, width, height, png, alt)
+}
+
+func TestRenderSVGLimitsTheSizeOfTheFallbackPng(t *testing.T) {
+	render := func(maxSize int) (string, *SVGRequest) {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.IncludeFallbackPng = true
+		limited := New(&sizedPNGConverter{pixelsPerByte: 100}, RendererOptions{MaxFallbackPNGSize: maxSize, MinFallbackPNGScale: 0.25})
+		svgRequest := limited.PrepareSVGRequest(renderRequest)
+		return RenderSVG(svgRequest), svgRequest
+	}
+	// sizeAt returns the length of the png converted from the map at the given scale
+	sizeAt := func(svgRequest *SVGRequest, scale float64) int {
+		png, _ := (&sizedPNGConverter{pixelsPerByte: 100}).Convert([]byte(fmt.Sprintf(`<svg width="%.f" height="%.f">`, svgRequest.ViewBoxWidth*scale, svgRequest.ViewBoxHeight*scale)))
+		return len(png)
+	}
+
+	Convey("A fallback png within the maximum size should be included at full size", t, func() {
+		svg, svgRequest := render(1000000)
+		So(svg, ShouldContainSubstring, "base64,"+strings.Repeat("A", sizeAt(svgRequest, 1))+`"`)
+		So(strings.Join(svgRequest.Warnings, " "), ShouldNotContainSubstring, "fallback")
+		So(svgRequest.Stats().PNGConversions, ShouldEqual, 1)
+	})
+
+	Convey("An oversized fallback png should be converted again at half the scale until it fits, with a warning", t, func() {
+		_, unlimited := render(1000000)
+		halfScaleSize := sizeAt(unlimited, 0.5)
+
+		svg, svgRequest := render(halfScaleSize)
+		So(svg, ShouldContainSubstring, "base64,"+strings.Repeat("A", halfScaleSize)+`"`)
+		So(svgRequest.Warnings, ShouldResemble, append(unlimited.Warnings, "The fallback png image was reduced to 50% of its size to fit the maximum of "+strconv.Itoa(halfScaleSize)+" bytes"))
+		So(svgRequest.Stats().PNGConversions, ShouldEqual, 2)
+	})
+
+	Convey("A fallback png that is oversized even at the minimum scale should be omitted, with a warning", t, func() {
+		_, unlimited := render(1000000)
+		svg, svgRequest := render(10)
+		So(svg, ShouldNotContainSubstring, "<foreignObject>")
+		So(svg, ShouldNotContainSubstring, geojson2svg.FallbackErrorText)
+		So(svg, ShouldContainSubstring, `<path `)
+		So(svgRequest.Warnings, ShouldResemble, append(unlimited.Warnings, "The fallback png image was omitted as it exceeds the maximum of 10 bytes even at 25% of its size"))
+		So(svgRequest.Stats().PNGConversions, ShouldEqual, 3)
+
+		_, err := unmarshalSimpleSVG(svg)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"encoding/json"
+	"strconv"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/paulmach/go.geojson"
+)
+
+// The attributes added to the path of the focus region (see RenderRequest.FocusRegionID), giving its bounding box within the viewBox,
+// and to the svg, giving the id of the focus region - from which a pan-zoom script can centre the initial view on the region
+const (
+	focusRegionAttribute = "data-focus-region"
+	focusXAttribute      = "data-focus-x"
+	focusYAttribute      = "data-focus-y"
+	focusWidthAttribute  = "data-focus-width"
+	focusHeightAttribute = "data-focus-height"
+)
+
+// panZoomAttribute is added to the svg (with the value "false") when RenderRequest.EnablePanZoom is false,
+// so that the page leaves the svg as a static responsive image rather than adding pan-zoom to it
+const panZoomAttribute = "data-pan-zoom"
+
+// panZoomOptionsAttribute is added to the svg with the RenderRequest.PanZoomOptions, as the json of an svgPanZoom options object
+const panZoomOptionsAttribute = "data-pan-zoom-options"
+
+// svgPanZoomOptions are the PanZoomOptions of a request, with the names used by svgPanZoom
+type svgPanZoomOptions struct {
+	MinZoom               *float64 `json:"minZoom,omitempty"`
+	MaxZoom               *float64 `json:"maxZoom,omitempty"`
+	ZoomScaleSensitivity  *float64 `json:"zoomScaleSensitivity,omitempty"`
+	MouseWheelZoomEnabled *bool    `json:"mouseWheelZoomEnabled,omitempty"`
+	ControlIconsEnabled   *bool    `json:"controlIconsEnabled,omitempty"`
+	DblClickZoomEnabled   *bool    `json:"dblClickZoomEnabled,omitempty"`
+}
+
+// panZoomOptionsJSON returns the options as the json of an svgPanZoom options object (e.g. {"minZoom":1,"controlIconsEnabled":false}),
+// or empty if no options are given
+func panZoomOptionsJSON(options *models.PanZoomOptions) string {
+	if options == nil {
+		return ""
+	}
+	b, err := json.Marshal(svgPanZoomOptions(*options))
+	if err != nil || string(b) == "{}" {
+		return ""
+	}
+	return string(b)
+}
+
+// setFocusRegion finds the feature of the focus region of the request, adding its bounding box (in the coordinates of the svg) as properties.
+// Returns the id of the feature, or empty if the region is not found. The ids of the features must already have been set (see setFeatureIDs).
+func setFocusRegion(svgRequest *SVGRequest, features []*geojson.Feature) string {
+	id := idPrefix(svgRequest.request) + "-" + svgRequest.request.FocusRegionID
+	for _, feature := range features {
+		if feature.ID != id {
+			continue
+		}
+		bounds := g2s.BoundingBox(&geojson.FeatureCollection{Features: []*geojson.Feature{feature}})
+		if bounds == nil {
+			return ""
+		}
+		sf := svgRequest.svg.GetScaleFunc(svgRequest.ViewBoxWidth, svgRequest.ViewBoxHeight, g2s.MercatorProjection)
+		left, top := sf(bounds[0], bounds[3])
+		right, bottom := sf(bounds[2], bounds[1])
+		feature.Properties[focusXAttribute] = formatCoordinate(left)
+		feature.Properties[focusYAttribute] = formatCoordinate(top)
+		feature.Properties[focusWidthAttribute] = formatCoordinate(right - left)
+		feature.Properties[focusHeightAttribute] = formatCoordinate(bottom - top)
+		return id
+	}
+	return ""
+}
+
+// formatCoordinate formats a position within the svg to 2 decimal places, which is precise enough to pan and zoom to
+func formatCoordinate(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
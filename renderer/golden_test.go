@@ -0,0 +1,81 @@
+package renderer_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// deterministic renders the golden files, using the same converter as the other tests
+var deterministic = New(pngConverter, RendererOptions{Deterministic: true})
+
+// renderGolden renders the example request as html with an svg and with a png
+func renderGolden(t *testing.T) (svgHTML []byte, pngHTML []byte) {
+	renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svgHTML, pngHTML, _, err = deterministic.RenderAll(renderRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svgHTML, pngHTML
+}
+
+// TestGolden compares the rendered example request with the golden files in testdata/golden.
+// After an intended change to the output, regenerate them using `go test ./renderer -run TestGolden -args -update`.
+func TestGolden(t *testing.T) {
+	svgHTML, pngHTML := renderGolden(t)
+	testdata.AssertGolden(t, "exampleRequest.svg.html", svgHTML)
+	testdata.AssertGolden(t, "exampleRequest.png.html", pngHTML)
+}
+
+func TestDeterministicRender(t *testing.T) {
+	Convey("Consecutive renders of the example request should be byte-identical", t, func() {
+		svgHTML, pngHTML := renderGolden(t)
+		secondSVG, secondPNG := renderGolden(t)
+		So(testdata.CompareGolden(svgHTML, secondSVG), ShouldBeNil)
+		So(testdata.CompareGolden(pngHTML, secondPNG), ShouldBeNil)
+	})
+
+	Convey("A change of a single character should be reported at the line and column where it was made", t, func() {
+		golden := testdata.LoadGolden(t, "exampleRequest.svg.html")
+		changed := append([]byte{}, golden...)
+		i := bytes.Index(changed, []byte(`class="mapRegion"`))
+		changed[i+len(`class="m`)] = 'M'
+		err := testdata.CompareGolden(golden, changed)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, `expected "apRegion\"`)
+		So(err.Error(), ShouldContainSubstring, `got "MpRegion\"`)
+		So(err.Error(), ShouldContainSubstring, fmt.Sprintf("line %d,", bytes.Count(golden[:i], []byte("\n"))+1))
+	})
+
+	Convey("The regions of a topology with several objects should be rendered in order of object name", t, func() {
+		render := func(r *Renderer) string {
+			fc := geojson.NewFeatureCollection()
+			for i, name := range []string{"E", "D", "C", "B", "A"} {
+				square := geojson.NewPolygonFeature([][][]float64{{{float64(i), 0}, {float64(i) + 1, 0}, {float64(i) + 1, 1}, {float64(i), 1}, {float64(i), 0}}})
+				square.Properties["code"] = name
+				fc.AddFeature(square)
+			}
+			// NewTopology creates an object for each feature, named by its id
+			topology := topojson.NewTopology(fc, &topojson.TopologyOptions{IDProperty: "code"})
+			request := &models.RenderRequest{Filename: "objects", Geography: &models.Geography{Topojson: topology, IDProperty: "code"}}
+			return RenderSVG(r.PrepareSVGRequest(request))
+		}
+
+		expected := render(deterministic)
+		So(expected, ShouldContainSubstring, `id="map-objects-A"`)
+		So(bytes.Index([]byte(expected), []byte(`id="map-objects-A"`)), ShouldBeLessThan, bytes.Index([]byte(expected), []byte(`id="map-objects-B"`)))
+		for i := 0; i < 20; i++ {
+			So(render(deterministic), ShouldEqual, expected)
+		}
+	})
+}
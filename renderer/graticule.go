@@ -0,0 +1,92 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// GraticuleClassName is the name of the class assigned to the group of graticule lines drawn beneath the map
+const GraticuleClassName = "mapGraticule"
+
+// maxGraticuleLines is the maximum number of lines of latitude (or of longitude) in a graticule - beyond which it is omitted
+const maxGraticuleLines = 100
+
+// graticuleSamples is the number of points per interval of the graticule at which lines of latitude are sampled,
+// so that they follow the curve of any projection that does not draw them straight
+const graticuleSamples = 10
+
+// graticuleLines returns the lines of latitude and longitude of the graticule across the extent of the map, as the coordinates of each line.
+// Returns an error if there would be more than maxGraticuleLines in either direction.
+func graticuleLines(graticule *models.Graticule, bounds []float64) ([][][]float64, error) {
+	minLon, minLat, maxLon, maxLat := bounds[0], bounds[1], bounds[2], bounds[3]
+	interval := graticule.IntervalDegrees
+	longitudes, latitudes := gridValues(minLon, maxLon, interval), gridValues(minLat, maxLat, interval)
+	if len(longitudes) > maxGraticuleLines || len(latitudes) > maxGraticuleLines {
+		return nil, fmt.Errorf("The graticule has been omitted as it would have more than %d lines of latitude or longitude - the interval of %g degrees is too small for the map", maxGraticuleLines, interval)
+	}
+
+	lines := [][][]float64{}
+	for _, lon := range longitudes {
+		lines = append(lines, [][]float64{{lon, minLat}, {lon, maxLat}})
+	}
+	step := interval / graticuleSamples
+	for _, lat := range latitudes {
+		line := [][]float64{}
+		for lon := minLon; lon < maxLon; lon += step {
+			line = append(line, []float64{lon, lat})
+		}
+		lines = append(lines, append(line, []float64{maxLon, lat}))
+	}
+	return lines, nil
+}
+
+// gridValues returns the multiples of the interval between min and max (inclusive)
+func gridValues(min float64, max float64, interval float64) []float64 {
+	values := []float64{}
+	for i := math.Ceil(min / interval); i*interval <= max; i++ {
+		values = append(values, i*interval)
+		if len(values) > maxGraticuleLines {
+			break
+		}
+	}
+	return values
+}
+
+// graticuleUnderlay returns an underlay that draws each line of the graticule as a path (with the classes of the graticule),
+// in a group with GraticuleClassName and a faint default stroke
+func graticuleUnderlay(svgRequest *SVGRequest, lines [][][]float64) g2s.Overlay {
+	request := svgRequest.request
+	class := graticuleClass(request.Graticule)
+	return func(sf g2s.ScaleFunc) string {
+		content := bytes.NewBufferString("")
+		fmt.Fprintf(content, `<g id="%s-graticule" class="%s" fill="none" stroke="#BEBEBE" stroke-width="0.5">`, mapID(request), GraticuleClassName)
+		for _, line := range lines {
+			points := []string{}
+			for _, p := range line {
+				x, y := sf(p[0], p[1])
+				points = append(points, fmt.Sprintf("%f %f", x, y))
+			}
+			fmt.Fprintf(content, `<path%s d="M%s"></path>`, class, strings.Join(points, ","))
+		}
+		fmt.Fprint(content, `</g>`)
+		return content.String()
+	}
+}
+
+// graticuleClass returns the class attribute (with the sanitised classes of the graticule) of each line of the graticule, or empty if it has no class
+func graticuleClass(graticule *models.Graticule) string {
+	classes := []string{}
+	for _, class := range strings.Fields(graticule.Class) {
+		classes = append(classes, htmlutil.SanitizeIdentifier(class))
+	}
+	if len(classes) == 0 {
+		return ""
+	}
+	return ` class="` + strings.Join(classes, " ") + `"`
+}
@@ -8,6 +8,7 @@ import (
 
 	"strings"
 
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
 	h "github.com/ONSdigital/dp-map-renderer/htmlutil"
 	"github.com/ONSdigital/dp-map-renderer/models"
 	"github.com/ONSdigital/go-ns/log"
@@ -16,12 +17,15 @@ import (
 	"math"
 )
 
-// Placeholders are inserted into the html to be replaced with the svg map, legends, css and javascript
+// Placeholders are inserted into the html to be replaced with the svg map, legends, css and javascript.
+// They are comments (see placeholder), so cannot be mimicked by text from the request, which is always escaped.
 const (
-	svgReplacementText           = "[SVG Here]"
-	verticalKeyReplacementText   = "[Vertical key Here]"
-	horizontalKeyReplacementText = "[Horizontal key Here]"
-	cssReplacementText           = "[CSS Here]"
+	svgReplacementText           = "<!--[SVG Here]-->"
+	verticalKeyReplacementText   = "<!--[Vertical key Here]-->"
+	horizontalKeyReplacementText = "<!--[Horizontal key Here]-->"
+	cssReplacementText           = "<!--[CSS Here]-->"
+	dataSetsReplacementText      = "<!--[Data sets Here]-->"
+	classSummaryReplacementText  = "<!--[Class summary Here]-->"
 )
 
 var (
@@ -38,18 +42,54 @@ var (
 )
 
 // RenderHTMLWithSVG returns an HTML figure element with caption and footer, and an SVG version of the map and (optional) legend
-func RenderHTMLWithSVG(request *models.RenderRequest) ([]byte, error) {
+func (r *Renderer) RenderHTMLWithSVG(request *models.RenderRequest) ([]byte, error) {
+	result, _, err := r.RenderHTMLWithSVGAndWarnings(request)
+	return result, err
+}
+
+// RenderHTMLWithSVGAndWarnings is the same as RenderHTMLWithSVG, but also returns any non-fatal warnings found while rendering (e.g. data that does not match the geography)
+func (r *Renderer) RenderHTMLWithSVGAndWarnings(request *models.RenderRequest) ([]byte, []string, error) {
+	result, stats, err := r.RenderHTMLWithSVGAndStats(request)
+	return result, stats.Warnings, err
+}
+
+// RenderHTMLWithSVGAndStats is the same as RenderHTMLWithSVG, but also returns the stats of the render, including any non-fatal warnings
+func (r *Renderer) RenderHTMLWithSVGAndStats(request *models.RenderRequest) ([]byte, *RenderStats, error) {
 	s := renderHTML(request)
-	result := renderSVGs(request, s)
-	return []byte(result), nil
+	result, stats := renderSVGs(r.PrepareSVGRequest(request), s)
+	stats.OutputBytes = len(result)
+	return []byte(result), stats, nil
 }
 
 // RenderHTMLWithPNG returns an HTML figure element with caption and footer, and a PNG version of the map and (optional) legend
-func RenderHTMLWithPNG(request *models.RenderRequest) ([]byte, error) {
-	request.IncludeFallbackPng = false
+func (r *Renderer) RenderHTMLWithPNG(request *models.RenderRequest) ([]byte, error) {
+	result, _, err := r.RenderHTMLWithPNGAndWarnings(request)
+	return result, err
+}
+
+// RenderHTMLWithPNGAndWarnings is the same as RenderHTMLWithPNG, but also returns any non-fatal warnings found while rendering (e.g. a failure to convert the svg to png)
+func (r *Renderer) RenderHTMLWithPNGAndWarnings(request *models.RenderRequest) ([]byte, []string, error) {
+	result, stats, err := r.RenderHTMLWithPNGAndStats(request)
+	return result, stats.Warnings, err
+}
+
+// RenderHTMLWithPNGAndStats is the same as RenderHTMLWithPNG, but also returns the stats of the render, including any non-fatal warnings
+func (r *Renderer) RenderHTMLWithPNGAndStats(request *models.RenderRequest) ([]byte, *RenderStats, error) {
 	s := renderHTML(request)
-	result := renderPNGs(request, s)
-	return []byte(result), nil
+	result, stats := renderPNGs(r.PrepareSVGRequest(request), s)
+	stats.OutputBytes = len(result)
+	return []byte(result), stats, nil
+}
+
+// RenderAll returns both the HTML rendered by RenderHTMLWithSVG and the HTML rendered by RenderHTMLWithPNG, preparing the request
+// (e.g. converting the topojson to geojson) only once. Also returns the stats of the render, which cover both documents.
+func (r *Renderer) RenderAll(request *models.RenderRequest) (svgHTML []byte, pngHTML []byte, stats *RenderStats, err error) {
+	s := renderHTML(request)
+	svgRequest := r.PrepareSVGRequest(request)
+	svgResult, _ := renderSVGs(svgRequest, s)
+	pngResult, stats := renderPNGs(svgRequest, s)
+	stats.OutputBytes = len(svgResult) + len(pngResult)
+	return []byte(svgResult), []byte(pngResult), stats, nil
 }
 
 // renderHTML returns an HTML figure element with caption and footer, and divs with placeholder text for the map and legend
@@ -59,6 +99,9 @@ func renderHTML(request *models.RenderRequest) string {
 	figure.AppendChild(svgContainer)
 	addCssPlaceholder(request, svgContainer)
 	addSVGDivs(request, svgContainer)
+	if len(request.DataSets) > 1 {
+		figure.AppendChild(placeholder(dataSetsReplacementText))
+	}
 	addFooter(request, figure)
 	var buf bytes.Buffer
 	html.Render(&buf, figure)
@@ -92,9 +135,12 @@ func createFigure(request *models.RenderRequest) *html.Node {
 	return figure
 }
 
-// idPrefix returns the prefix that should be used for all ids
+// idPrefix returns the prefix that should be used for all ids - based on the (sanitised) ElementID if given, otherwise the Filename
 func idPrefix(request *models.RenderRequest) string {
-	return "map-" + request.Filename
+	if len(request.ElementID) > 0 {
+		return "map-" + h.SanitizeIdentifier(request.ElementID)
+	}
+	return "map-" + h.SanitizeIdentifier(request.Filename)
 }
 
 // mapID returns the id for the map, as used in links etc
@@ -102,7 +148,7 @@ func mapID(request *models.RenderRequest) string {
 	return idPrefix(request) + "-map"
 }
 
-// addSVGDivs adds divs with marker text for each of the horizontal & vertical legends, and the map
+// addSVGDivs adds divs with marker text for each of the horizontal & vertical legends, and the map, followed by marker text for any class summary
 func addSVGDivs(request *models.RenderRequest, parent *html.Node) {
 	if request.Choropleth == nil {
 		return
@@ -111,36 +157,33 @@ func addSVGDivs(request *models.RenderRequest, parent *html.Node) {
 	prefix := idPrefix(request)
 
 	if request.Choropleth.HorizontalLegendPosition == models.LegendPositionBefore {
-		parent.AppendChild(h.CreateNode("div", atom.Div,
-			h.Attr("id", prefix+"-legend-horizontal"),
-			h.Attr("class", "map_key map_key__horizontal"),
-			horizontalKeyReplacementText))
+		parent.AppendChild(legendDiv(prefix, "horizontal", horizontalKeyReplacementText))
 	}
 	if request.Choropleth.VerticalLegendPosition == models.LegendPositionBefore {
-		parent.AppendChild(h.CreateNode("div", atom.Div,
-			h.Attr("id", prefix+"-legend-vertical"),
-			h.Attr("class", "map_key map_key__vertical"),
-			verticalKeyReplacementText))
+		parent.AppendChild(legendDiv(prefix, "vertical", verticalKeyReplacementText))
 	}
 
 	parent.AppendChild(h.CreateNode("div", atom.Div,
 		h.Attr("id", mapID(request)),
 		h.Attr("class", "map"),
-		svgReplacementText))
+		placeholder(svgReplacementText)))
 
 	if request.Choropleth.VerticalLegendPosition == models.LegendPositionAfter {
-		parent.AppendChild(h.CreateNode("div", atom.Div,
-			h.Attr("id", prefix+"-legend-vertical"),
-			h.Attr("class", "map_key map_key__vertical"),
-			verticalKeyReplacementText))
+		parent.AppendChild(legendDiv(prefix, "vertical", verticalKeyReplacementText))
 	}
 	if request.Choropleth.HorizontalLegendPosition == models.LegendPositionAfter {
-		parent.AppendChild(h.CreateNode("div", atom.Div,
-			h.Attr("id", prefix+"-legend-horizontal"),
-			h.Attr("class", "map_key map_key__horizontal"),
-			horizontalKeyReplacementText))
+		parent.AppendChild(legendDiv(prefix, "horizontal", horizontalKeyReplacementText))
 	}
+	if request.Choropleth.ShowClassSummary {
+		parent.AppendChild(placeholder(classSummaryReplacementText))
+	}
+}
 
+// legendDiv returns the div with marker text for the legend with the given orientation
+func legendDiv(prefix string, orientation string, replacementText string) *html.Node {
+	div := h.CreateNode("div", atom.Div, h.Attr("id", prefix+"-legend-"+orientation), placeholder(replacementText))
+	h.AddClass(div, "map_key", "map_key__"+orientation)
+	return div
 }
 
 // addFooter adds a footer to the given element, containing the source and footnotes
@@ -151,15 +194,15 @@ func addFooter(request *models.RenderRequest, parent *html.Node) {
 	if len(request.Licence) > 0 {
 		footer.AppendChild(h.CreateNode("p", atom.P,
 			h.Attr("class", "figure__licence"),
-			request.Licence))
+			footerText(request.Licence)))
 		footer.AppendChild(h.Text("\n"))
 	}
 	if len(request.Source) > 0 {
-		var source interface{} = request.Source
+		source := footerText(request.Source)
 		if len(request.SourceLink) > 0 {
 			source = h.CreateNode("a", atom.A,
 				h.Attr("href", request.SourceLink),
-				request.Source)
+				source)
 		}
 
 		footer.AppendChild(h.CreateNode("p", atom.P,
@@ -185,6 +228,12 @@ func addFooter(request *models.RenderRequest, parent *html.Node) {
 	parent.AppendChild(h.Text("\n"))
 }
 
+// footerText creates a text node for a string in the footer (e.g. the source or licence), with control characters removed.
+// The text is escaped when rendered, so cannot contain markup (or placeholders).
+func footerText(value string) *html.Node {
+	return h.Text(h.SanitizeText(value))
+}
+
 // addFooterItemsToList adds one li node for each footnote to the given list node
 func addFooterItemsToList(request *models.RenderRequest, ol *html.Node) {
 	for i, note := range request.Footnotes {
@@ -197,23 +246,43 @@ func addFooterItemsToList(request *models.RenderRequest, ol *html.Node) {
 	}
 }
 
-// addCssPlaceholder adds a text node that should be replaced with style enabling the map to responsively adjust its size.
+// placeholder creates a comment node that renders as the replacement text
+func placeholder(replacementText string) *html.Node {
+	return &html.Node{Type: html.CommentNode, Data: strings.TrimSuffix(strings.TrimPrefix(replacementText, "<!--"), "-->")}
+}
+
+// addCssPlaceholder adds a placeholder that should be replaced with style enabling the map to responsively adjust its size.
 func addCssPlaceholder(request *models.RenderRequest, parent *html.Node) {
-	parent.AppendChild(h.Text(cssReplacementText))
+	parent.AppendChild(placeholder(cssReplacementText))
 }
 
-// renderSVGs replaces the SVG marker text with the actual SVG(s)
-func renderSVGs(request *models.RenderRequest, original string) string {
-	svgRequest := PrepareSVGRequest(request)
+// renderSVGs replaces the SVG marker text with the actual SVG(s), returning the result and the stats of the render (including any warnings).
+// The keys are html lists instead of svgs if the request asks for them (see Choropleth.LegendFormat).
+func renderSVGs(svgRequest *SVGRequest, original string) (string, *RenderStats) {
+	htmlLegend := hasHTMLLegend(svgRequest.request)
 	result := strings.Replace(original, svgReplacementText, "\n" + RenderSVG(svgRequest) + "\n", 1)
 	if strings.Contains(result, verticalKeyReplacementText) {
-		result = strings.Replace(result, verticalKeyReplacementText, "\n" + RenderVerticalKey(svgRequest) + "\n", 1)
+		var key string
+		if htmlLegend {
+			key = RenderHTMLKey(svgRequest, "vertical")
+		} else {
+			key = RenderVerticalKey(svgRequest)
+		}
+		result = strings.Replace(result, verticalKeyReplacementText, "\n" + key + "\n", 1)
 	}
 	if strings.Contains(result, horizontalKeyReplacementText) {
-		result = strings.Replace(result, horizontalKeyReplacementText, "\n" + RenderHorizontalKey(svgRequest) + "\n", 1)
+		var key string
+		if htmlLegend {
+			key = RenderHTMLKey(svgRequest, "horizontal")
+		} else {
+			key = RenderHorizontalKey(svgRequest)
+		}
+		result = strings.Replace(result, horizontalKeyReplacementText, "\n" + key + "\n", 1)
 	}
 	result = strings.Replace(result, cssReplacementText, renderCss(svgRequest), 1)
-	return result
+	result = strings.Replace(result, dataSetsReplacementText, renderDataSets(svgRequest), 1)
+	result = strings.Replace(result, classSummaryReplacementText, RenderClassSummary(svgRequest), 1)
+	return result, svgRequest.Stats()
 }
 
 // renderCss creates a <script> block that has styles specific to this svg that allow it to be responsive and
@@ -236,14 +305,10 @@ func renderCss(svgRequest *SVGRequest) string {
 
 	if hasVerticalLegend(svgRequest.request) {
 		// relative width of svg and vertical legend
-		svgWidthPercent := math.Floor(svgRequest.ViewBoxWidth / (svgRequest.ViewBoxWidth + svgRequest.VerticalLegendWidth) * 100.0)
-		vlWidthPercent := 100.0 - svgWidthPercent - 1
-		vlMaxWidth := (math.Max(svgRequest.request.MaxWidth, svgRequest.ViewBoxWidth) / svgWidthPercent) * vlWidthPercent
+		svgWidthPercent, vlWidthPercent, vlMaxWidth := verticalLegendLayout(svgRequest)
 
-		if hasHorizontalLegend(svgRequest.request) && svgRequest.responsiveSize {
+		if switchPoint := legendSwitchPoint(svgRequest); switchPoint > 0 {
 			// switch between both legends
-			switchPoint := svgRequest.ViewBoxWidth + svgRequest.VerticalLegendWidth
-
 			fmt.Fprintf(css, "\n\t@media (min-width: %.0fpx) {", switchPoint + 1.0)
 			fmt.Fprintf(css, "\n\t\t#%s-legend-horizontal { display: none;}", id)
 			fmt.Fprintf(css, "\n\t\t#%s-map { display: inline-block; width: %.0f%%;}", id, svgWidthPercent)
@@ -262,20 +327,56 @@ func renderCss(svgRequest *SVGRequest) string {
 		}
 	}
 
+	if svgRequest.request.LowDetail && svgRequest.responsiveSize {
+		// display the low detail regions rather than the full detail when the map is at its min width
+		fmt.Fprintf(css, "\n\t@media (max-width: %.0fpx) {", svgRequest.request.MinWidth)
+		fmt.Fprintf(css, "\n\t\t#%s-map .%s { display: none;}", id, g2s.FullDetailClassName)
+		fmt.Fprintf(css, "\n\t\t#%s-map .%s { display: inline;}", id, g2s.LowDetailClassName)
+		fmt.Fprintf(css, "\n\t}")
+	}
+
+	if hasHTMLLegend(svgRequest.request) {
+		// default layout of the html keys, which may be overridden by the page
+		fmt.Fprintf(css, "\n\t#%s-figure .map_key_list { list-style: none; margin: 0; padding: 0;}", id)
+		fmt.Fprintf(css, "\n\t#%s-figure .map_key_swatch { display: inline-block; width: 1em; height: 1em; margin-right: 0.5em; vertical-align: middle; border: 0.5px solid black;}", id)
+	}
+
 	fmt.Fprintf(css, "\n</style>\n")
 	return css.String()
 }
 
+// verticalLegendLayout returns the percentage of the width of the container taken by the svg and by the vertical legend
+// when they are displayed side by side, and the max width (in pixels) of the vertical legend
+func verticalLegendLayout(svgRequest *SVGRequest) (svgWidthPercent float64, vlWidthPercent float64, vlMaxWidth float64) {
+	svgWidthPercent = math.Floor(svgRequest.ViewBoxWidth / (svgRequest.ViewBoxWidth + svgRequest.VerticalLegendWidth) * 100.0)
+	vlWidthPercent = 100.0 - svgWidthPercent - 1
+	vlMaxWidth = (math.Max(svgRequest.request.MaxWidth, svgRequest.ViewBoxWidth) / svgWidthPercent) * vlWidthPercent
+	return svgWidthPercent, vlWidthPercent, vlMaxWidth
+}
+
+// legendSwitchPoint returns the width of the page (in pixels) at or below which the horizontal legend is displayed instead of the vertical legend,
+// or 0 if the map does not switch between legends (it must have a responsive size and both legends)
+func legendSwitchPoint(svgRequest *SVGRequest) float64 {
+	if !hasVerticalLegend(svgRequest.request) || !hasHorizontalLegend(svgRequest.request) || !svgRequest.responsiveSize {
+		return 0
+	}
+	return svgRequest.ViewBoxWidth + svgRequest.VerticalLegendWidth
+}
+
 // renderPNGs replaces the SVG marker text with png images. It will not return a responsive design, and will ensure that only one of the legends is included.
-func renderPNGs(request *models.RenderRequest, original string) string {
-	svgRequest := PrepareSVGRequest(request)
+// Returns the result and the stats of the render (including any warnings).
+// The svgRequest is modified so that its svgs have neither a responsive size, a fallback png nor tooltips, so should not be used to render svgs afterwards.
+func renderPNGs(svgRequest *SVGRequest, original string) (string, *RenderStats) {
+	request := svgRequest.request
 	svgRequest.responsiveSize = false
+	svgRequest.includeFallbackPng = false
+	svgRequest.includeTooltips = false
 
 	svg := RenderSVG(svgRequest)
-	result := strings.Replace(original, svgReplacementText, renderPNG(svg), 1)
+	result := strings.Replace(original, svgReplacementText, renderPNG(svgRequest, svg, svgRequest.mapAlt()), 1)
 	if strings.Contains(result, verticalKeyReplacementText) {
 		key := RenderVerticalKey(svgRequest)
-		result = strings.Replace(result, verticalKeyReplacementText, renderPNG(key), 1)
+		result = strings.Replace(result, verticalKeyReplacementText, renderPNG(svgRequest, key, svgRequest.keyAlt()), 1)
 	}
 	if strings.Contains(result, horizontalKeyReplacementText) {
 		// only render horizontal if we won't have vertical
@@ -283,27 +384,32 @@ func renderPNGs(request *models.RenderRequest, original string) string {
 			result = strings.Replace(result, horizontalKeyReplacementText, "", 1)
 		} else {
 			key := RenderHorizontalKey(svgRequest)
-			result = strings.Replace(result, horizontalKeyReplacementText, renderPNG(key), 1)
+			result = strings.Replace(result, horizontalKeyReplacementText, renderPNG(svgRequest, key, svgRequest.keyAlt()), 1)
 		}
 	}
 	result = strings.Replace(result, cssReplacementText, "", 1)
-	return result
+	result = strings.Replace(result, dataSetsReplacementText, "", 1)
+	result = strings.Replace(result, classSummaryReplacementText, RenderClassSummary(svgRequest), 1)
+	return result, svgRequest.Stats()
 }
 
-// renderPNG converts the given svg to a png, retaining the width and height attributes
-func renderPNG(svg string) string {
-	if pngConverter == nil {
+// renderPNG converts the given svg to a png with the given alt text, retaining the width and height attributes. If the conversion fails, the svg is returned and a warning added to the svgRequest.
+func renderPNG(svgRequest *SVGRequest, svg string, alt string) string {
+	converter := svgRequest.converter()
+	if converter == nil {
 		log.Error(fmt.Errorf("pngConverter is nil - cannot convert svg to png"), nil)
+		svgRequest.addWarning("Unable to convert the svg to png - returning svg instead")
 		return svg
 	}
 	png := svg
-	b64, err := pngConverter.Convert([]byte(svg))
+	b64, err := converter.Convert([]byte(svg))
 	if err == nil {
 		width := widthPattern.FindString(svg)
 		height := heightPattern.FindString(svg)
-		png = fmt.Sprintf(`<img %s %s src="data:image/png;base64,%s" />`, width, height, string(b64))
+		png = fmt.Sprintf(`<img alt="%s" %s %s src="data:image/png;base64,%s" />`, h.EscapeAttr(alt), width, height, string(b64))
 	} else {
 		log.Error(err, log.Data{"_message": "Unable to convert svg to png"})
+		svgRequest.addWarning("Unable to convert the svg to png - returning svg instead")
 	}
 	return png
 }
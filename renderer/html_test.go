@@ -2,14 +2,17 @@ package renderer_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
 
 	"fmt"
 
 	"strings"
 
+	"github.com/ONSdigital/dp-map-renderer/health"
 	. "github.com/ONSdigital/dp-map-renderer/htmlutil"
 	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/palette"
 	"github.com/ONSdigital/dp-map-renderer/renderer"
 	"github.com/ONSdigital/dp-map-renderer/testdata"
 	. "github.com/smartystreets/goconvey/convey"
@@ -48,6 +51,72 @@ func TestRenderHTMLWithSVG(t *testing.T) {
 	})
 }
 
+func TestRenderHTMLWithPanZoomDisabled(t *testing.T) {
+
+	Convey("By default the svg should not be marked as static", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		container, _ := invokeRenderHTMLWithSVG(renderRequest)
+
+		svg := FindNode(findNodeWithClass(container, atom.Div, "map"), atom.Svg)
+		So(svg, ShouldNotBeNil)
+		So(GetAttribute(svg, "data-pan-zoom"), ShouldBeEmpty)
+		So(FindNode(container, atom.Script), ShouldBeNil)
+	})
+
+	Convey("With pan-zoom disabled, the svg should be marked as static, and not have a focus region", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		enabled := false
+		renderRequest.EnablePanZoom = &enabled
+		renderRequest.FocusRegionID = "E06000001"
+
+		container, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		svg := FindNode(findNodeWithClass(container, atom.Div, "map"), atom.Svg)
+		So(svg, ShouldNotBeNil)
+		So(GetAttribute(svg, "data-pan-zoom"), ShouldEqual, "false")
+		So(GetAttribute(svg, "style"), ShouldEqual, "width:100%;")
+		So(FindNode(container, atom.Script), ShouldBeNil)
+		So(result, ShouldNotContainSubstring, "data-focus")
+	})
+}
+
+func TestRenderHTMLWithPanZoomOptions(t *testing.T) {
+
+	Convey("The pan-zoom options of the request should be given to the page as the json of an svgPanZoom options object", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		maxZoom, controls := 20.0, false
+		renderRequest.PanZoomOptions = &models.PanZoomOptions{MaxZoom: &maxZoom, ControlIconsEnabled: &controls}
+
+		container, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		svg := FindNode(findNodeWithClass(container, atom.Div, "map"), atom.Svg)
+		So(GetAttribute(svg, "data-pan-zoom-options"), ShouldEqual, `{"maxZoom":20,"controlIconsEnabled":false}`)
+		So(result, ShouldContainSubstring, `data-pan-zoom-options="{&#34;maxZoom&#34;:20,&#34;controlIconsEnabled&#34;:false}"`)
+	})
+
+	Convey("Without pan-zoom options the page's defaults should be used", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.PanZoomOptions = &models.PanZoomOptions{}
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		So(result, ShouldNotContainSubstring, "data-pan-zoom-options")
+	})
+}
+
 func TestRenderHTMLWithPNGWithVerticalLegend(t *testing.T) {
 
 	Convey("Successfully render a png image of the map with no horizontal legend", t, func() {
@@ -64,7 +133,7 @@ func TestRenderHTMLWithPNGWithVerticalLegend(t *testing.T) {
 		renderRequest.MinWidth = 300
 		renderRequest.MaxWidth = 500
 
-		container, html := invokeRenderHTMLWithPNG(renderRequest)
+		container, html := invokeRenderHTMLWithPNG(renderer.Default(), renderRequest)
 
 		fmt.Println(html)
 		So(GetAttribute(container, "class"), ShouldEqual, "figure")
@@ -82,12 +151,14 @@ func TestRenderHTMLWithPNGWithVerticalLegend(t *testing.T) {
 		mDiv := findNodeWithClass(container, atom.Div, "map")
 		img := FindNode(mDiv, atom.Img)
 		So(img, ShouldNotBeNil)
+		So(GetAttribute(img, "alt"), ShouldEqual, exampleMapAlt)
 		So(len(GetAttribute(img, "width")), ShouldBeGreaterThan, 0)
 		So(len(GetAttribute(img, "height")), ShouldBeGreaterThan, 0)
 
 		vDiv := findNodeWithClass(container, atom.Div, "map_key__vertical")
 		img = FindNode(vDiv, atom.Img)
 		So(img, ShouldNotBeNil)
+		So(GetAttribute(img, "alt"), ShouldEqual, exampleKeyAlt)
 		So(len(GetAttribute(img, "width")), ShouldBeGreaterThan, 0)
 		So(len(GetAttribute(img, "height")), ShouldBeGreaterThan, 0)
 
@@ -118,7 +189,7 @@ func TestRenderHTMLWithPNGWithHorizontalLegend(t *testing.T) {
 		renderRequest.Choropleth.VerticalLegendPosition = "none"
 		renderRequest.Choropleth.HorizontalLegendPosition = "before"
 
-		container, html := invokeRenderHTMLWithPNG(renderRequest)
+		container, html := invokeRenderHTMLWithPNG(renderer.Default(), renderRequest)
 
 		fmt.Println(html)
 		So(GetAttribute(container, "class"), ShouldEqual, "figure")
@@ -133,12 +204,14 @@ func TestRenderHTMLWithPNGWithHorizontalLegend(t *testing.T) {
 		hDiv := findNodeWithClass(container, atom.Div, "map_key__horizontal")
 		img := FindNode(hDiv, atom.Img)
 		So(img, ShouldNotBeNil)
+		So(GetAttribute(img, "alt"), ShouldEqual, exampleKeyAlt)
 		So(len(GetAttribute(img, "width")), ShouldBeGreaterThan, 0)
 		So(len(GetAttribute(img, "height")), ShouldBeGreaterThan, 0)
 
 		mDiv := findNodeWithClass(container, atom.Div, "map")
 		img = FindNode(mDiv, atom.Img)
 		So(img, ShouldNotBeNil)
+		So(GetAttribute(img, "alt"), ShouldEqual, exampleMapAlt)
 		So(len(GetAttribute(img, "width")), ShouldBeGreaterThan, 0)
 		So(len(GetAttribute(img, "height")), ShouldBeGreaterThan, 0)
 
@@ -159,7 +232,7 @@ func TestRenderHTMLWithPNG_ConverterNotAvailable(t *testing.T) {
 
 	Convey("Return the svg version when a png converter is not available", t, func() {
 
-		renderer.UsePNGConverter(nil)
+		noConverter := renderer.New(nil, renderer.DefaultOptions())
 
 		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
 		renderRequest, err := models.CreateRenderRequest(reader)
@@ -168,7 +241,7 @@ func TestRenderHTMLWithPNG_ConverterNotAvailable(t *testing.T) {
 		}
 		renderRequest.IncludeFallbackPng = false
 
-		container, _ := invokeRenderHTMLWithPNG(renderRequest)
+		container, _ := invokeRenderHTMLWithPNG(noConverter, renderRequest)
 
 		So(GetAttribute(container, "class"), ShouldEqual, "figure")
 		So(GetAttribute(container, "id"), ShouldEqual, "map-"+renderRequest.Filename+"-figure")
@@ -302,6 +375,71 @@ func TestRenderHTML_BothLegends(t *testing.T) {
 	})
 }
 
+func TestRenderHTML_HTMLLegend(t *testing.T) {
+
+	Convey("Should render the legends as ordered lists, with an item for each break and one for missing data", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.LegendFormat = models.LegendFormatHTML
+
+		container, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		So(len(FindAllNodes(container, atom.Svg)), ShouldEqual, 1)
+		So(result, ShouldContainSubstring, ".map_key_swatch {")
+
+		for _, orientation := range []string{"horizontal", "vertical"} {
+			key := FindNodeWithAttributes(container, atom.Div, map[string]string{"id": "map-abcd1234-legend-" + orientation})
+			So(key, ShouldNotBeNil)
+			So(GetAttribute(key, "class"), ShouldEqual, "map_key map_key__"+orientation)
+
+			title := FindNode(key, atom.P)
+			So(title, ShouldNotBeNil)
+			So(GetText(title), ShouldEqual, "% non-UK born")
+
+			list := FindNode(key, atom.Ol)
+			So(list, ShouldNotBeNil)
+			So(GetAttribute(list, "aria-labelledby"), ShouldEqual, GetAttribute(title, "id"))
+			items := FindNodes(list, atom.Li)
+			So(len(items), ShouldEqual, len(renderRequest.Choropleth.Breaks)+1)
+
+			expected := []struct{ colour, text string }{
+				{"rgb(241, 238, 246)", "0 to 6"},
+				{"rgb(189, 201, 225)", "6 to 11"},
+				{"rgb(116, 169, 207)", "11 to 20"},
+				{"rgb(43, 140, 190)", "20 to 33"},
+				{"rgb(4, 90, 141)", "33 to 54"},
+			}
+			for i, e := range expected {
+				swatch := findNodeWithClass(items[i], atom.Span, "map_key_swatch")
+				So(GetAttribute(swatch, "style"), ShouldEqual, "background-color: "+e.colour+";")
+				So(GetText(findNodeWithClass(items[i], atom.Span, "map_key_range")), ShouldEqual, e.text)
+			}
+			missing := items[len(items)-1]
+			So(HasClass(missing, "map_key_item__missing"), ShouldBeTrue)
+			So(GetText(findNodeWithClass(missing, atom.Span, "map_key_range")), ShouldEqual, renderer.MissingDataText)
+		}
+	})
+
+	Convey("The png render should fall back to svg legends", t, func() {
+		renderer.UsePNGConverter(pngConverter)
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.LegendFormat = models.LegendFormatHTML
+
+		container, _ := invokeRenderHTMLWithPNG(renderer.Default(), renderRequest)
+
+		So(findNodeWithClass(container, atom.Ol, "map_key_list"), ShouldBeNil)
+		vDiv := findNodeWithClass(container, atom.Div, "map_key__vertical")
+		So(GetAttribute(FindNode(vDiv, atom.Img), "alt"), ShouldEqual, exampleKeyAlt)
+	})
+}
+
 func TestRenderCssForVerticalLegend(t *testing.T) {
 
 	Convey("Should render a style block when no min/max specified but vertical legend included", t, func() {
@@ -348,6 +486,50 @@ func TestRenderResponsiveCss(t *testing.T) {
 	})
 }
 
+func TestRenderCssDoesNotInvertWidthConstraints(t *testing.T) {
+
+	Convey("Should render a fixed width style block when min width is greater than max width", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.MinWidth = 500
+		renderRequest.MaxWidth = 300
+		renderRequest.DefaultWidth = 450
+		renderRequest.Choropleth.HorizontalLegendPosition = "before"
+		renderRequest.Choropleth.VerticalLegendPosition = "none"
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		style := regexp.MustCompile(`(?s)<style type="text/css">.*</style>`).FindString(result)
+		So(style, ShouldContainSubstring, `width: 450px;`)
+		So(style, ShouldNotContainSubstring, `min-width: 500px;`)
+		So(style, ShouldNotContainSubstring, `max-width: 300px;`)
+	})
+
+	Convey("Should render a fixed width style block when min width is specified without max width", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.MinWidth = 300
+		renderRequest.MaxWidth = 0
+		renderRequest.DefaultWidth = 450
+		renderRequest.Choropleth.HorizontalLegendPosition = "before"
+		renderRequest.Choropleth.VerticalLegendPosition = "after"
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		style := regexp.MustCompile(`(?s)<style type="text/css">.*</style>`).FindString(result)
+		So(style, ShouldContainSubstring, `width: 450px;`)
+		So(style, ShouldNotContainSubstring, `min-width: 300px;`)
+		So(style, ShouldNotContainSubstring, `max-width: 0px;`)
+		So(style, ShouldNotContainSubstring, `@media`)
+	})
+}
+
 func TestRenderCss(t *testing.T) {
 
 	Convey("Should render a style block with a fixed width", t, func() {
@@ -427,6 +609,31 @@ func TestRenderHTMLWithNoSVG(t *testing.T) {
 	})
 }
 
+func TestRenderHTMLText(t *testing.T) {
+
+	Convey("The text of a rendered figure should have the caption, source and each footnote on separate lines", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		So(err, ShouldBeNil)
+		renderRequest.Title = "Map title"
+		renderRequest.Subtitle = "Map subtitle"
+		renderRequest.Source = "source text"
+		renderRequest.SourceLink = "http://example.com/source"
+		renderRequest.Footnotes = []string{"Note1", "Note2\nOn Two Lines"}
+
+		container, _ := invokeRenderHTMLWithSVG(renderRequest)
+
+		lines := strings.Split(GetTextWithSeparators(container), "\n")
+		So(lines, ShouldContain, "Map title")
+		So(lines, ShouldContain, "Map subtitle")
+		So(lines, ShouldContain, "Source: source text")
+		So(lines, ShouldContain, "Note1")
+		So(lines, ShouldContain, "Note2")
+		So(lines, ShouldContain, "On Two Lines")
+		So(lines[len(lines)-1], ShouldEqual, "On Two Lines")
+	})
+}
+
 func TestRenderHTML_Source(t *testing.T) {
 
 	Convey("A renderRequest without a source should not have a source paragraph", t, func() {
@@ -486,6 +693,201 @@ func TestRenderHTML_Licence(t *testing.T) {
 	})
 }
 
+func TestRenderHTML_FooterMarkupIsInert(t *testing.T) {
+	source := `</a><img src="x" onerror="alert(1)"><!--[CSS Here]-->`
+	licence := "<script>alert(1)</script>\x07<!--[Vertical key Here]--> [SVG Here]"
+
+	// footerRequest returns the example request with the (markup-laden) source and licence, and no vertical legend
+	footerRequest := func() *models.RenderRequest {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+		renderRequest.Source = source
+		renderRequest.SourceLink = "http://example.com/source"
+		renderRequest.Licence = licence
+		renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionNone
+		return renderRequest
+	}
+
+	assertInert := func(container *html.Node, result string, expectedSVGs int) {
+		footer := FindNode(container, atom.Footer)
+		So(footer, ShouldNotBeNil)
+		So(FindAllNodes(footer, atom.Img, atom.Script, atom.Svg, atom.Style), ShouldBeEmpty)
+
+		licenceNode := findNodeWithClass(footer, atom.P, "figure__licence")
+		So(licenceNode, ShouldNotBeNil)
+		So(GetText(licenceNode), ShouldEqual, "<script>alert(1)</script><!--[Vertical key Here]--> [SVG Here]")
+
+		link := FindNode(findNodeWithClass(footer, atom.P, "figure__source"), atom.A)
+		So(link, ShouldNotBeNil)
+		So(link.FirstChild.Type, ShouldEqual, html.TextNode)
+		So(link.FirstChild.NextSibling, ShouldBeNil)
+		So(link.FirstChild.Data, ShouldEqual, source)
+
+		So(strings.Count(result, "<svg"), ShouldEqual, expectedSVGs)
+		So(result, ShouldNotContainSubstring, "<script>")
+		So(result, ShouldNotContainSubstring, "<img src=\"x\"")
+	}
+
+	Convey("Markup in the source and licence should be rendered as text in the html with svg", t, func() {
+		container, result := invokeRenderHTMLWithSVG(footerRequest())
+
+		assertInert(container, result, 2) // the map and horizontal legend
+		So(strings.Count(result, "<style"), ShouldEqual, 1)
+	})
+
+	Convey("Markup in the source and licence should be rendered as text in the html with png", t, func() {
+		container, result := invokeRenderHTMLWithPNG(renderer.New(pngConverter, renderer.DefaultOptions()), footerRequest())
+
+		assertInert(container, result, 0)
+		So(result, ShouldNotContainSubstring, "<style")
+	})
+}
+
+func TestRenderHTMLReturnsWarnings(t *testing.T) {
+	Convey("Rendering the example request should return warnings for the unmatched data and regions without data", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := renderer.RenderHTMLWithSVG(renderRequest)
+		So(err, ShouldBeNil)
+
+		renderRequest, _ = models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		result, warnings, err := renderer.RenderHTMLWithSVGAndWarnings(renderRequest)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, string(expected))
+		So(warnings, ShouldHaveLength, 2)
+		So(warnings[0], ShouldStartWith, "42 data rows do not match a region in the geography. IDs: E10000002, E10000003,")
+		So(warnings[0], ShouldEndWith, "and 32 more")
+		So(warnings[1], ShouldEqual, "7 regions do not have data. IDs: E06000053, E07000030, E07000038, E07000069, E07000124, E07000191, E09000001")
+	})
+
+	Convey("Rendering a png without a png converter should return a warning", t, func() {
+		noConverter := renderer.New(nil, renderer.DefaultOptions())
+		renderRequest, _ := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+
+		_, warnings, err := noConverter.RenderHTMLWithPNGAndWarnings(renderRequest)
+		So(err, ShouldBeNil)
+		So(warnings, ShouldContain, "Unable to convert the svg to png - returning svg instead")
+	})
+}
+
+func TestRenderHTMLReturnsColourWarnings(t *testing.T) {
+	render := func(r *renderer.Renderer, colours []string) []string {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, b := range renderRequest.Choropleth.Breaks {
+			b.Colour = colours[i]
+		}
+		_, warnings, err := r.RenderHTMLWithSVGAndWarnings(renderRequest)
+		So(err, ShouldBeNil)
+		return warnings
+	}
+	colourWarnings := func(warnings []string) []string {
+		var w []string
+		for _, warning := range warnings {
+			if strings.Contains(warning, "hard to") {
+				w = append(w, warning)
+			}
+		}
+		return w
+	}
+
+	Convey("Rendering a choropleth with a palette whose classes are hard to tell apart should return warnings listing them", t, func() {
+		warnings := colourWarnings(render(renderer.Default(), []string{"#ffffff", "#fbfbfb", "#2b8cbe", "#101010", "#000000"}))
+		So(warnings, ShouldContain, "Adjacent classes 1 and 2 (#ffffff and #fbfbfb) are hard to tell apart: their contrast ratio is 1.03:1")
+		So(warnings, ShouldContain, "The key text and swatch outline (black) is hard to see against class 5 (#000000): their contrast ratio is 1.00:1")
+		So(warnings, ShouldHaveLength, 3)
+	})
+
+	Convey("Rendering a choropleth with a ColorBrewer palette should not return colour warnings", t, func() {
+		colours, _ := palette.Get("Blues").Colours(5)
+		So(colourWarnings(render(renderer.Default(), colours)), ShouldBeEmpty)
+	})
+
+	Convey("Classes that are hard to tell apart with colour blindness should only be listed if the renderer checks for them", t, func() {
+		colours, _ := palette.Get("RdYlGn").Colours(5)
+		So(colourWarnings(render(renderer.Default(), colours)), ShouldBeEmpty)
+
+		checked := renderer.New(nil, renderer.RendererOptions{ColourBlindChecks: true})
+		So(colourWarnings(render(checked, colours)), ShouldContain, "Classes 2 and 4 (#fdae61 and #a6d96a) are hard to tell apart with deuteranopia")
+	})
+}
+
+func TestRenderAll(t *testing.T) {
+	Convey("RenderAll should return the same documents as RenderHTMLWithSVG and RenderHTMLWithPNG, preparing the request only once", t, func() {
+		renderer.UsePNGConverter(pngConverter)
+		newRequest := func() *models.RenderRequest {
+			renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			renderRequest.IncludeFallbackPng = true
+			renderRequest.MinWidth = 300
+			renderRequest.MaxWidth = 500
+			renderRequest.Choropleth.HorizontalLegendPosition = models.LegendPositionBefore
+			renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionAfter
+			return renderRequest
+		}
+		expectedSVG, err := renderer.RenderHTMLWithSVG(newRequest())
+		So(err, ShouldBeNil)
+		expectedPNG, err := renderer.RenderHTMLWithPNG(newRequest())
+		So(err, ShouldBeNil)
+
+		prepareCount := prepareTimingCount()
+		svgHTML, pngHTML, stats, err := renderer.RenderAll(newRequest())
+
+		So(err, ShouldBeNil)
+		So(prepareTimingCount(), ShouldEqual, prepareCount+1)
+		So(string(svgHTML), ShouldEqual, string(expectedSVG))
+		So(string(pngHTML), ShouldEqual, string(expectedPNG))
+		So(string(svgHTML), ShouldContainSubstring, "<foreignObject>")
+		So(stats.OutputBytes, ShouldEqual, len(svgHTML)+len(pngHTML))
+		So(stats.Warnings, ShouldHaveLength, 2)
+	})
+}
+
+// prepareTimingCount returns the number of times PrepareSVGRequest has been recorded in the timings
+func prepareTimingCount() int64 {
+	for _, s := range health.Snapshot() {
+		if s.Name == "render_prepare" {
+			return s.Count
+		}
+	}
+	return 0
+}
+
+func TestRenderHTMLUsesElementID(t *testing.T) {
+	Convey("When an ElementID is given, all ids should use it instead of the Filename", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.ElementID = "stable-id"
+		renderRequest.Filename = "renamed"
+		renderRequest.Title = "Map renamed [1]"
+		renderRequest.Choropleth.HorizontalLegendPosition = models.LegendPositionBefore
+		renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionAfter
+
+		container, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		So(GetAttribute(container, "id"), ShouldEqual, "map-stable-id-figure")
+		So(FindNodeWithAttributes(container, atom.Svg, map[string]string{"id": "map-stable-id-map-svg"}), ShouldNotBeNil)
+		So(result, ShouldContainSubstring, `<pattern id="map-stable-id-nodata"`)
+		So(result, ShouldContainSubstring, `id="map-stable-id-legend-horizontal-key"`)
+		So(result, ShouldContainSubstring, `id="map-stable-id-legend-vertical-key"`)
+		So(result, ShouldContainSubstring, `href="#map-stable-id-note-1"`)
+		So(result, ShouldContainSubstring, `id="map-stable-id-note-1"`)
+		So(result, ShouldNotContainSubstring, "map-renamed")
+
+		caption := FindNode(container, atom.Figcaption)
+		So(caption.FirstChild.Data, ShouldStartWith, "Map renamed")
+	})
+}
+
 func TestRenderHTML_Footer(t *testing.T) {
 	Convey("A renderRequest without footnotes should not have notes paragraph", t, func() {
 		request := models.RenderRequest{Filename: "myId"}
@@ -545,8 +947,8 @@ func invokeRenderHTMLWithSVG(renderRequest *models.RenderRequest) (*html.Node, s
 	return node, string(response)
 }
 
-func invokeRenderHTMLWithPNG(renderRequest *models.RenderRequest) (*html.Node, string) {
-	response, err := renderer.RenderHTMLWithPNG(renderRequest)
+func invokeRenderHTMLWithPNG(r *renderer.Renderer, renderRequest *models.RenderRequest) (*html.Node, string) {
+	response, err := r.RenderHTMLWithPNG(renderRequest)
 	So(err, ShouldBeNil)
 	nodes, err := html.ParseFragment(bytes.NewReader([]byte(response)), &html.Node{
 		Type:     html.ElementNode,
@@ -562,23 +964,246 @@ func invokeRenderHTMLWithPNG(renderRequest *models.RenderRequest) (*html.Node, s
 }
 
 func findNodeWithClass(parent *html.Node, a atom.Atom, class string) *html.Node {
-	nodes := findNodesWithClass(parent, a, class)
-	if len(nodes) == 0 {
-		return nil
-	}
-	return nodes[0]
+	return FindNodeFunc(parent, func(n *html.Node) bool {
+		return n.DataAtom == a && HasClass(n, class)
+	})
 }
 
 func findNodesWithClass(parent *html.Node, a atom.Atom, class string) []*html.Node {
-	nodes := FindNodes(parent, a)
-	result := make([]*html.Node, 0)
-	for _, n := range nodes {
-		classAttr := GetAttribute(n, "class")
-		for _, c := range strings.Split(classAttr, " ") {
-			if c == class {
-				result = append(result, n)
-			}
+	return FindNodesFunc(parent, func(n *html.Node) bool {
+		return n.DataAtom == a && HasClass(n, class)
+	})
+}
+
+func TestRenderPage(t *testing.T) {
+
+	parsePage := func(page []byte) *html.Node {
+		doc, err := html.Parse(bytes.NewReader(page))
+		So(err, ShouldBeNil)
+		return doc
+	}
+
+	Convey("A page should be a complete html document containing the figure, loading the pan-zoom library from the cdn", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		page, stats, err := renderer.Default().RenderPageWithStats(renderRequest, false)
+		So(err, ShouldBeNil)
+		So(stats.OutputBytes, ShouldEqual, len(page))
+		So(string(page), ShouldStartWith, "<!DOCTYPE html>\n")
+
+		doc := parsePage(page)
+		head := FindNode(doc, atom.Head)
+		So(FindNodeWithAttributes(head, atom.Meta, map[string]string{"charset": "UTF-8"}), ShouldNotBeNil)
+		So(GetText(FindNode(head, atom.Title)), ShouldEqual, renderRequest.Title)
+		So(FindNodeWithAttributes(head, atom.Script, map[string]string{"src": renderer.PanZoomLibraryURL}), ShouldNotBeNil)
+
+		body := FindNode(doc, atom.Body)
+		So(GetAttribute(FindNode(body, atom.Figure), "id"), ShouldEqual, "map-"+renderRequest.Filename+"-figure")
+		scripts := FindNodes(body, atom.Script)
+		So(len(scripts), ShouldEqual, 1)
+		So(scripts[0].FirstChild.Data, ShouldContainSubstring, `var mapId = "map-`+renderRequest.Filename+`-map-svg"`)
+		So(scripts[0].FirstChild.Data, ShouldContainSubstring, `document.getElementById(event.target.id + "-tooltip")`)
+		So(scripts[0].FirstChild.Data, ShouldContainSubstring, `svg.addEventListener("mouseover", showTooltip("visible"));`)
+		So(scripts[0].FirstChild.Data, ShouldContainSubstring, `svg.addEventListener("focusout", showTooltip("hidden"));`)
+		So(FindNodeWithAttributes(body, atom.Svg, map[string]string{"id": "map-" + renderRequest.Filename + "-map-svg"}), ShouldNotBeNil)
+	})
+
+	Convey("A self-contained page should inline the pan-zoom library, and make no network requests", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
 		}
+		options := renderer.DefaultOptions()
+		options.PanZoomScript = `window.svgPanZoom = function() { return "</script>"; };`
+
+		page, stats, err := renderer.New(nil, options).RenderPageWithStats(renderRequest, true)
+		So(err, ShouldBeNil)
+		So(stats.Warnings, ShouldNotContain, "The svg-pan-zoom library is not available to the renderer - the self-contained page does not pan and zoom")
+
+		doc := parsePage(page)
+		scripts := FindNodes(FindNode(doc, atom.Head), atom.Script)
+		So(len(scripts), ShouldEqual, 1)
+		So(GetAttribute(scripts[0], "src"), ShouldBeEmpty)
+		So(scripts[0].FirstChild.Data, ShouldContainSubstring, `window.svgPanZoom = function() { return "<\/script>"; };`)
+		So(string(page), ShouldNotContainSubstring, renderer.PanZoomLibraryURL)
+		So(string(page), ShouldNotContainSubstring, `src="http`)
+		So(string(page), ShouldNotContainSubstring, "<link")
+	})
+
+	Convey("A self-contained page from a renderer without the pan-zoom library should omit it, with a warning", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		page, stats, err := renderer.New(nil, renderer.DefaultOptions()).RenderPageWithStats(renderRequest, true)
+		So(err, ShouldBeNil)
+		So(stats.Warnings, ShouldContain, "The svg-pan-zoom library is not available to the renderer - the self-contained page does not pan and zoom")
+		So(FindNode(FindNode(parsePage(page), atom.Head), atom.Script), ShouldBeNil)
+		So(string(page), ShouldNotContainSubstring, `src="http`)
+	})
+}
+
+func TestRenderHTMLWithDataSets(t *testing.T) {
+
+	newRequest := func() *models.RenderRequest {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		later := []*models.DataRow{}
+		for _, row := range renderRequest.Data[1:] {
+			later = append(later, &models.DataRow{ID: row.ID, Value: row.Value + 1})
+		}
+		renderRequest.DataSets = []*models.DataSet{{Label: "2011", Data: renderRequest.Data}, {Label: "<b>2021</b>", Data: later}}
+		return renderRequest
 	}
-	return result
+
+	Convey("A map with data sets should include a button for each, and the fill and title of each region for each data set", t, func() {
+		renderRequest := newRequest()
+		prefix := "map-" + renderRequest.Filename
+
+		container, result := invokeRenderHTMLWithSVG(renderRequest)
+		So(result, ShouldNotContainSubstring, "<b>")
+
+		group := FindNodeWithAttributes(container, atom.Div, map[string]string{"id": prefix + "-data-sets"})
+		So(group, ShouldNotBeNil)
+		So(GetAttribute(group, "class"), ShouldEqual, renderer.DataSetButtonsClassName)
+		So(GetAttribute(group, "role"), ShouldEqual, "group")
+		buttons := FindNodes(group, atom.Button)
+		So(len(buttons), ShouldEqual, 2)
+		So(GetText(buttons[0]), ShouldEqual, "2011")
+		So(GetAttribute(buttons[0], "aria-pressed"), ShouldEqual, "true")
+		So(GetText(buttons[1]), ShouldEqual, "<b>2021</b>")
+		So(GetAttribute(buttons[1], "aria-pressed"), ShouldEqual, "false")
+
+		dataSetsJSON := FindNodeWithAttributes(container, atom.Script, map[string]string{"id": prefix + "-data-sets-json"})
+		So(dataSetsJSON, ShouldNotBeNil)
+		var sets []struct {
+			Label   string
+			Regions map[string]struct{ Fill, Title string }
+		}
+		So(json.Unmarshal([]byte(dataSetsJSON.FirstChild.Data), &sets), ShouldBeNil)
+		So(len(sets), ShouldEqual, 2)
+		So(sets[1].Label, ShouldEqual, "<b>2021</b>")
+
+		first := prefix + "-" + renderRequest.Data[0].ID
+		path := FindNodeFunc(container, func(n *html.Node) bool { return n.Data == "path" && GetAttribute(n, "id") == first })
+		So(path, ShouldNotBeNil)
+		So(GetAttribute(path, "style"), ShouldContainSubstring, "fill: "+sets[0].Regions[first].Fill+";")
+		So(GetText(path), ShouldEqual, sets[0].Regions[first].Title)
+		So(sets[1].Regions[first].Fill, ShouldEqual, "url(#"+prefix+"-nodata)")
+		So(sets[1].Regions[first].Title, ShouldEndWith, renderer.MissingDataText)
+
+		second := prefix + "-" + renderRequest.Data[1].ID
+		So(sets[1].Regions[second].Title, ShouldNotEqual, sets[0].Regions[second].Title)
+
+		scripts := FindNodes(container, atom.Script)
+		So(scripts[len(scripts)-1].FirstChild.Data, ShouldContainSubstring, `var prefix = "`+prefix+`"`)
+	})
+
+	Convey("A map with data sets rendered with pngs should not include the buttons", t, func() {
+		_, result := invokeRenderHTMLWithPNG(renderer.Default(), newRequest())
+
+		So(result, ShouldNotContainSubstring, renderer.DataSetButtonsClassName)
+		So(result, ShouldNotContainSubstring, "<!--[Data sets Here]-->")
+	})
+}
+
+func TestRenderHTMLWithClassSummary(t *testing.T) {
+
+	Convey("The class summary should give the number of classes and the number of areas in the largest", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.ShowClassSummary = true
+
+		// classify the example data by hand: the count of values in [0, 6), [6, 11), [11, 20), [20, 33) and from 33
+		lowerBounds := []float64{0, 6, 11, 20, 33}
+		counts := make([]int, len(lowerBounds))
+		for _, row := range renderRequest.Data {
+			class := 0
+			for i, lowerBound := range lowerBounds {
+				if row.Value >= lowerBound {
+					class = i
+				}
+			}
+			counts[class]++
+		}
+		So(counts, ShouldResemble, []int{130, 131, 104, 23, 27})
+
+		container, _ := invokeRenderHTMLWithSVG(renderRequest)
+
+		summary := FindNodeWithAttributes(container, atom.P, map[string]string{"id": "map-" + renderRequest.Filename + "-class-summary"})
+		So(summary, ShouldNotBeNil)
+		So(GetAttribute(summary, "class"), ShouldEqual, renderer.ClassSummaryClassName)
+		So(GetText(summary), ShouldEqual, "5 classes; largest class: 131 areas")
+	})
+
+	Convey("The class summary should also be included when the map is rendered with pngs", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.ShowClassSummary = true
+		renderRequest.Choropleth.Breaks = renderRequest.Choropleth.Breaks[:2]
+
+		container, _ := invokeRenderHTMLWithPNG(renderer.Default(), renderRequest)
+
+		So(GetText(FindNodeWithAttributes(container, atom.P, map[string]string{"class": renderer.ClassSummaryClassName})), ShouldEqual, "2 classes; largest class: 285 areas")
+	})
+
+	Convey("The class summary should be omitted unless requested", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+
+		So(result, ShouldNotContainSubstring, renderer.ClassSummaryClassName)
+	})
+}
+
+func TestRenderHTMLWithTooltips(t *testing.T) {
+
+	Convey("Tooltips should be included in an svg render, but not in a png render", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Tooltips = true
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+		So(strings.Count(result, `class="`+renderer.TooltipClassName+`"`), ShouldEqual, strings.Count(result, `class="mapRegion"`))
+
+		_, result = invokeRenderHTMLWithPNG(renderer.Default(), renderRequest)
+		So(result, ShouldNotContainSubstring, renderer.TooltipClassName)
+	})
+}
+
+func TestRenderHTMLWithLowDetail(t *testing.T) {
+
+	Convey("The css should display the low detail regions instead of the full detail when the map is at its min width", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.LowDetail = true
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+		So(result, ShouldContainSubstring, `class="fullDetail"`)
+		So(result, ShouldContainSubstring, `class="lowDetail" display="none"`)
+		So(result, ShouldContainSubstring, "@media (max-width: 300px) {"+
+			"\n\t\t#map-abcd1234-map .fullDetail { display: none;}"+
+			"\n\t\t#map-abcd1234-map .lowDetail { display: inline;}"+
+			"\n\t}")
+
+		_, result = invokeRenderHTMLWithPNG(renderer.Default(), renderRequest)
+		So(result, ShouldNotContainSubstring, "lowDetail")
+	})
 }
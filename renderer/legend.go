@@ -0,0 +1,99 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	h "github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// missingDataSwatch is the background of the swatch for missing data in an html key - stripes resembling the MissingDataPattern
+const missingDataSwatch = "repeating-linear-gradient(-45deg, #6D6E72 0, #6D6E72 2px, transparent 2px, transparent 6px)"
+
+// hasHTMLLegend returns true if the legends of the request should be rendered as html lists rather than svgs (see Choropleth.LegendFormat)
+func hasHTMLLegend(request *models.RenderRequest) bool {
+	return request.Choropleth != nil && request.Choropleth.LegendFormat == models.LegendFormatHTML
+}
+
+// RenderHTMLKey creates an ordered list with an item (a colour swatch and the range of values) for each break of the choropleth,
+// and one for missing data, as an alternative to the svg key with the given orientation ("horizontal" or "vertical").
+// The list is preceded by the legend title, if any.
+func RenderHTMLKey(svgRequest *SVGRequest, orientation string) string {
+	if svgRequest.geoJSON == nil || len(svgRequest.breaks) == 0 {
+		return ""
+	}
+	request := svgRequest.request
+	id := idPrefix(request) + "-legend-" + orientation
+
+	list := h.CreateNode("ol", atom.Ol,
+		h.Attr("id", id+"-list"),
+		h.Attr("class", h.JoinClasses(getKeyClass(request, orientation), "map_key_list")))
+	for _, b := range svgRequest.breaks {
+		list.AppendChild(keyItem("map_key_item", "background-color: "+b.Colour+";"+opacityStyle("opacity", b.Opacity), fmt.Sprintf("%g to %g", b.LowerBound, b.UpperBound)))
+	}
+	list.AppendChild(keyItem("map_key_item map_key_item__missing", "background: "+missingDataSwatch+";", MissingDataText))
+
+	var buf bytes.Buffer
+	title := strings.TrimSpace(request.Choropleth.ValuePrefix + " " + request.Choropleth.ValueSuffix)
+	if len(title) > 0 {
+		h.AddAttribute(list, "aria-labelledby", id+"-title")
+		html.Render(&buf, h.CreateNode("p", atom.P, h.Attr("id", id+"-title"), h.Attr("class", "map_key_title"), h.Text(title)))
+	}
+	html.Render(&buf, list)
+	return buf.String()
+}
+
+// keyItem creates an item of an html key, with a swatch of the given style followed by the text
+func keyItem(class string, swatchStyle string, text string) *html.Node {
+	return h.CreateNode("li", atom.Li,
+		h.Attr("class", class),
+		h.CreateNode("span", atom.Span, h.Attr("class", "map_key_swatch"), h.Attr("style", swatchStyle)),
+		h.CreateNode("span", atom.Span, h.Attr("class", "map_key_range"), h.Text(text)))
+}
+
+// ClassSummaryClassName is the class of the paragraph summarising the number of areas in each class of the choropleth
+const ClassSummaryClassName = "map_key_summary"
+
+// RenderClassSummary creates a paragraph summarising the classes of the choropleth and the number of areas in the largest,
+// e.g. "5 classes; largest class: 120 areas", from the classification of the data by PrepareSVGRequest.
+// Returns empty if the choropleth has no breaks or the request has no data.
+func RenderClassSummary(svgRequest *SVGRequest) string {
+	if len(svgRequest.breaks) == 0 || len(svgRequest.dataColours) == 0 {
+		return ""
+	}
+	largest := 0
+	for _, count := range classCounts(svgRequest) {
+		if count > largest {
+			largest = count
+		}
+	}
+	summary := fmt.Sprintf("%s; largest class: %s", plural(len(svgRequest.breaks), "class", "classes"), plural(largest, "area", "areas"))
+
+	var buf bytes.Buffer
+	html.Render(&buf, h.CreateNode("p", atom.P,
+		h.Attr("id", idPrefix(svgRequest.request)+"-class-summary"),
+		h.Attr("class", ClassSummaryClassName),
+		h.Text(summary)))
+	return buf.String()
+}
+
+// classCounts returns the number of areas with data in each class of the choropleth, in ascending order of lower bound (as svgRequest.breaks)
+func classCounts(svgRequest *SVGRequest) []int {
+	counts := make([]int, len(svgRequest.breaks))
+	for _, vc := range svgRequest.dataColours {
+		counts[vc.class]++
+	}
+	return counts
+}
+
+// plural returns the count followed by the singular or plural noun, as appropriate to the count
+func plural(count int, one string, many string) string {
+	if count == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", count, many)
+}
@@ -0,0 +1,57 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/paulmach/go.geojson"
+)
+
+// LineClassName is the name of the class assigned to the line features of the geography when the request has a LineStyle
+const LineClassName = "mapLine"
+
+// setLineStyles applies the line style to each LineString and MultiLineString feature, after any other style (e.g. the colour of its data),
+// so that lines are drawn as strokes without a fill. Polygons and points are left unchanged.
+func setLineStyles(features []*geojson.Feature, lineStyle *models.LineStyle) {
+	style := lineStyleDeclarations(lineStyle)
+	class := lineClass(lineStyle)
+	for _, feature := range features {
+		if feature.Geometry == nil || !(feature.Geometry.IsLineString() || feature.Geometry.IsMultiLineString()) {
+			continue
+		}
+		if original, exists := feature.Properties["style"]; exists {
+			feature.Properties["style"] = fmt.Sprintf("%v %s", original, style)
+		} else {
+			feature.Properties["style"] = style
+		}
+		appendProperty(feature, "class", class)
+	}
+}
+
+// lineStyleDeclarations returns the css declarations of the line style, starting with no fill
+func lineStyleDeclarations(lineStyle *models.LineStyle) string {
+	style := bytes.NewBufferString("fill: none;")
+	if len(lineStyle.Stroke) > 0 {
+		fmt.Fprintf(style, " stroke: %s;", lineStyle.Stroke)
+	}
+	if lineStyle.StrokeWidth > 0 {
+		fmt.Fprintf(style, " stroke-width: %s;", strconv.FormatFloat(lineStyle.StrokeWidth, 'f', -1, 64))
+	}
+	if dashes := strings.Fields(strings.Replace(lineStyle.DashArray, ",", " ", -1)); len(dashes) > 0 {
+		fmt.Fprintf(style, " stroke-dasharray: %s;", strings.Join(dashes, " "))
+	}
+	return style.String()
+}
+
+// lineClass returns the class list of the lines - LineClassName followed by each of the (sanitised) classes of the line style
+func lineClass(lineStyle *models.LineStyle) string {
+	classes := []string{LineClassName}
+	for _, class := range strings.Fields(lineStyle.Class) {
+		classes = append(classes, htmlutil.SanitizeIdentifier(class))
+	}
+	return strings.Join(classes, " ")
+}
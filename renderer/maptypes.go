@@ -0,0 +1,74 @@
+package renderer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/paulmach/go.geojson"
+)
+
+// MapType defines how a type of map (identified by RenderRequest.MapType) is validated and rendered
+type MapType struct {
+	// Validate checks that the request has any configuration required by this type of map. Optional.
+	Validate func(request *models.RenderRequest) error
+	// Render styles the regions of the map (e.g. setting their colours and titles), returning any warnings
+	Render func(features []*geojson.Feature, request *models.RenderRequest) []string
+	// renderPrepared is used instead of Render if given, and may use the calculations cached by PrepareSVGRequest
+	renderPrepared func(features []*geojson.Feature, svgRequest *SVGRequest) []string
+}
+
+// render styles the regions of the map, returning any warnings
+func (m *MapType) render(features []*geojson.Feature, svgRequest *SVGRequest) []string {
+	if m.renderPrepared != nil {
+		return m.renderPrepared(features, svgRequest)
+	}
+	return m.Render(features, svgRequest.request)
+}
+
+// mapTypes is the registry of known map types, keyed by MapType
+var mapTypes = map[string]*MapType{}
+
+func init() {
+	RegisterMapType(models.MapTypeChoropleth, &MapType{
+		Render:         setChoroplethColoursAndTitles,
+		renderPrepared: setPreparedChoroplethColoursAndTitles,
+	})
+	models.UseMapTypeValidator(validateMapType)
+}
+
+// RegisterMapType adds (or replaces) the definition of the named type of map
+func RegisterMapType(name string, mapType *MapType) {
+	mapTypes[name] = mapType
+}
+
+// getMapType returns the definition for the request's MapType - choropleth if none is given - or nil if the type is not known
+func getMapType(request *models.RenderRequest) *MapType {
+	if len(request.MapType) == 0 {
+		return mapTypes[models.MapTypeChoropleth]
+	}
+	return mapTypes[request.MapType]
+}
+
+// validateMapType returns an error if the request's MapType is not known, or if it fails the validation for that type of map
+func validateMapType(request *models.RenderRequest) error {
+	mapType := getMapType(request)
+	if mapType == nil {
+		return fmt.Errorf("map_type must be one of '%s': map_type=%v", strings.Join(mapTypeNames(), "', '"), request.MapType)
+	}
+	if mapType.Validate == nil {
+		return nil
+	}
+	return mapType.Validate(request)
+}
+
+// mapTypeNames returns the sorted names of the registered map types
+func mapTypeNames() []string {
+	names := make([]string, 0, len(mapTypes))
+	for name := range mapTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
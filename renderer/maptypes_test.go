@@ -0,0 +1,87 @@
+package renderer_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	"github.com/paulmach/go.geojson"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMapTypeDispatch(t *testing.T) {
+
+	RegisterMapType("test", &MapType{
+		Validate: func(request *models.RenderRequest) error {
+			if request.Choropleth == nil {
+				return errors.New("test maps require a choropleth")
+			}
+			return nil
+		},
+		Render: func(features []*geojson.Feature, request *models.RenderRequest) []string {
+			for _, feature := range features {
+				feature.Properties["style"] = "fill: pink;"
+			}
+			return []string{"rendered as a test map"}
+		},
+	})
+
+	Convey("A request is rendered by the function registered for its map type", t, func() {
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			MapType:    "test",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}},
+		}
+		So(renderRequest.ValidateRenderRequest(), ShouldBeNil)
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		result := RenderSVG(svgRequest)
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldEqual, "fill: pink;")
+		So(svg.Paths[1].Style, ShouldEqual, "fill: pink;")
+		So(svgRequest.Warnings, ShouldContain, "rendered as a test map")
+	})
+
+	Convey("The validator for the map type is called by ValidateRenderRequest", t, func() {
+		renderRequest := &models.RenderRequest{
+			MapType:   "test",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code"},
+			Data:      []*models.DataRow{{ID: "f0", Value: 10}},
+		}
+		So(renderRequest.ValidateRenderRequest(), ShouldResemble, errors.New("test maps require a choropleth"))
+	})
+
+	Convey("A request without a map type is rendered as a choropleth", t, func() {
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+		}
+		So(renderRequest.ValidateRenderRequest(), ShouldBeNil)
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldEqual, "fill: red;")
+		So(svg.Paths[1].Style, ShouldEqual, "fill: green;")
+	})
+
+	Convey("A request with an unknown map type is rejected", t, func() {
+		renderRequest := &models.RenderRequest{
+			MapType:   "unknown",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code"},
+			Data:      []*models.DataRow{{ID: "f0", Value: 10}},
+		}
+		err := renderRequest.ValidateRenderRequest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "map_type must be one of 'choropleth'")
+		So(err.Error(), ShouldEndWith, "map_type=unknown")
+	})
+}
@@ -0,0 +1,71 @@
+package renderer
+
+import (
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// LayoutMetrics describes the layout of the map rendered by RenderHTMLWithSVG, so that a page can reserve space for the map before it is rendered
+type LayoutMetrics struct {
+	ViewBoxWidth  float64 `json:"view_box_width"`  // the width of the viewBox of the map svg
+	ViewBoxHeight float64 `json:"view_box_height"` // the height of the viewBox of the map svg
+	AspectRatio   float64 `json:"aspect_ratio"`    // the width of the map divided by its height, or 0 if the map has no height
+	// Responsive is true if the map scales with the page between MinWidth and MaxWidth - otherwise it has a fixed width of ViewBoxWidth pixels
+	Responsive bool    `json:"responsive"`
+	MinWidth   float64 `json:"min_width,omitempty"`
+	MaxWidth   float64 `json:"max_width,omitempty"`
+	// HorizontalLegend and VerticalLegend are true if the legend is emitted
+	HorizontalLegend bool   `json:"horizontal_legend"`
+	VerticalLegend   bool   `json:"vertical_legend"`
+	LegendFormat     string `json:"legend_format,omitempty"` // svg or html, if there is a legend
+	// HorizontalLegendHeight is the height of the viewBox of the horizontal legend svg (whose width is the ViewBoxWidth)
+	HorizontalLegendHeight float64 `json:"horizontal_legend_height,omitempty"`
+	// VerticalLegendWidth is the width of the viewBox of the vertical legend svg (whose height is the ViewBoxHeight)
+	VerticalLegendWidth float64 `json:"vertical_legend_width,omitempty"`
+	// MapWidthPercent and VerticalLegendWidthPercent are the percentages of the width of the container taken by the map and the vertical legend
+	// when they are displayed side by side, and VerticalLegendMaxWidth the max width (in pixels) of the vertical legend
+	MapWidthPercent            float64 `json:"map_width_percent,omitempty"`
+	VerticalLegendWidthPercent float64 `json:"vertical_legend_width_percent,omitempty"`
+	VerticalLegendMaxWidth     float64 `json:"vertical_legend_max_width,omitempty"`
+	// LegendSwitchPoint is the width of the page (in pixels) at or below which the horizontal legend is displayed instead of the vertical legend,
+	// or 0 if the map does not switch between legends
+	LegendSwitchPoint float64 `json:"legend_switch_point,omitempty"`
+}
+
+// RenderLayoutMetrics prepares the request (see PrepareSVGRequest) and returns the layout of the map that RenderHTMLWithSVG would render,
+// without drawing the map or its legends. Also returns the stats of the preparation, including any non-fatal warnings.
+func (r *Renderer) RenderLayoutMetrics(request *models.RenderRequest) (*LayoutMetrics, *RenderStats, error) {
+	svgRequest := r.PrepareSVGRequest(request)
+	metrics := &LayoutMetrics{
+		ViewBoxWidth:  svgRequest.ViewBoxWidth,
+		ViewBoxHeight: svgRequest.ViewBoxHeight,
+		Responsive:    svgRequest.responsiveSize,
+	}
+	if metrics.ViewBoxHeight > 0 {
+		metrics.AspectRatio = metrics.ViewBoxWidth / metrics.ViewBoxHeight
+	}
+	if svgRequest.responsiveSize {
+		metrics.MinWidth, metrics.MaxWidth = request.MinWidth, request.MaxWidth
+	}
+
+	// the legends are only drawn for a map with a geography
+	hasLegends := svgRequest.geoJSON != nil
+	metrics.HorizontalLegend = hasLegends && hasHorizontalLegend(request)
+	metrics.VerticalLegend = hasLegends && hasVerticalLegend(request)
+	if metrics.HorizontalLegend || metrics.VerticalLegend {
+		metrics.LegendFormat = models.LegendFormatSVG
+		if hasHTMLLegend(request) {
+			metrics.LegendFormat = models.LegendFormatHTML
+		}
+	}
+	if metrics.HorizontalLegend && metrics.LegendFormat == models.LegendFormatSVG {
+		metrics.HorizontalLegendHeight = svgRequest.options.HorizontalKeyHeight
+	}
+	if metrics.VerticalLegend {
+		if metrics.LegendFormat == models.LegendFormatSVG {
+			metrics.VerticalLegendWidth = svgRequest.VerticalLegendWidth
+		}
+		metrics.MapWidthPercent, metrics.VerticalLegendWidthPercent, metrics.VerticalLegendMaxWidth = verticalLegendLayout(svgRequest)
+		metrics.LegendSwitchPoint = legendSwitchPoint(svgRequest)
+	}
+	return metrics, svgRequest.Stats(), nil
+}
@@ -0,0 +1,82 @@
+package renderer_test
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	mapViewBoxPattern              = regexp.MustCompile(`<svg id="[^"]*-map-svg"[^>]* viewBox="0 0 ([0-9.]+) ([0-9.]+)"`)
+	horizontalLegendViewBoxPattern = regexp.MustCompile(`<svg id="[^"]*-legend-horizontal-svg"[^>]* viewBox="0 0 ([0-9.]+) ([0-9.]+)"`)
+	verticalLegendViewBoxPattern   = regexp.MustCompile(`<svg id="[^"]*-legend-vertical-svg"[^>]* viewBox="0 0 ([0-9.]+) ([0-9.]+)"`)
+	switchPointPattern             = regexp.MustCompile(`@media \(max-width: ([0-9]+)px\) \{\s*#[^ ]*-legend-vertical \{ display: none;\}`)
+	mapWidthPercentPattern         = regexp.MustCompile(`-map \{ display: inline-block; width: ([0-9]+)%;\}`)
+	verticalLegendPercentPattern   = regexp.MustCompile(`-legend-vertical \{ display: inline-block; width: ([0-9]+)%; max-width: ([0-9]+)px;\}`)
+)
+
+func TestRenderLayoutMetrics(t *testing.T) {
+
+	Convey("The layout metrics should match the layout of the rendered map", t, func() {
+		renderRequest := loadExampleRequest(t)
+		html, err := RenderHTMLWithSVG(loadExampleRequest(t))
+		So(err, ShouldBeNil)
+
+		metrics, stats, err := Default().RenderLayoutMetrics(renderRequest)
+		So(err, ShouldBeNil)
+		So(stats.DrawDuration, ShouldEqual, 0)
+
+		mapViewBox := submatchFloats(mapViewBoxPattern, html)
+		So(math.Floor(metrics.ViewBoxWidth+0.5), ShouldEqual, mapViewBox[0])
+		So(math.Floor(metrics.ViewBoxHeight+0.5), ShouldEqual, mapViewBox[1])
+		So(metrics.AspectRatio, ShouldAlmostEqual, metrics.ViewBoxWidth/metrics.ViewBoxHeight)
+		So(metrics.Responsive, ShouldBeTrue)
+		So(metrics.MinWidth, ShouldEqual, 300)
+		So(metrics.MaxWidth, ShouldEqual, 500)
+
+		So(metrics.HorizontalLegend, ShouldBeTrue)
+		So(metrics.VerticalLegend, ShouldBeTrue)
+		So(metrics.LegendFormat, ShouldEqual, models.LegendFormatSVG)
+		So(metrics.HorizontalLegendHeight, ShouldEqual, submatchFloats(horizontalLegendViewBoxPattern, html)[1])
+		So(math.Floor(metrics.VerticalLegendWidth+0.5), ShouldEqual, submatchFloats(verticalLegendViewBoxPattern, html)[0])
+
+		So(math.Floor(metrics.LegendSwitchPoint+0.5), ShouldEqual, submatchFloats(switchPointPattern, html)[0])
+		So(metrics.MapWidthPercent, ShouldEqual, submatchFloats(mapWidthPercentPattern, html)[0])
+		legendPercent := submatchFloats(verticalLegendPercentPattern, html)
+		So(metrics.VerticalLegendWidthPercent, ShouldEqual, legendPercent[0])
+		So(math.Floor(metrics.VerticalLegendMaxWidth+0.5), ShouldEqual, legendPercent[1])
+	})
+
+	Convey("A map with a fixed width and no legends should report neither legend", t, func() {
+		renderRequest := loadExampleRequest(t)
+		renderRequest.MinWidth, renderRequest.MaxWidth = 0, 0
+		renderRequest.Choropleth.HorizontalLegendPosition = models.LegendPositionNone
+		renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionNone
+
+		metrics, _, err := Default().RenderLayoutMetrics(renderRequest)
+		So(err, ShouldBeNil)
+		So(metrics.ViewBoxWidth, ShouldEqual, 400)
+		So(metrics.Responsive, ShouldBeFalse)
+		So(metrics.HorizontalLegend, ShouldBeFalse)
+		So(metrics.VerticalLegend, ShouldBeFalse)
+		So(metrics.LegendFormat, ShouldBeEmpty)
+		So(metrics.VerticalLegendWidth, ShouldEqual, 0)
+		So(metrics.LegendSwitchPoint, ShouldEqual, 0)
+	})
+}
+
+// submatchFloats returns the numbers matched by the groups of the pattern in the html
+func submatchFloats(pattern *regexp.Regexp, html []byte) []float64 {
+	match := pattern.FindSubmatch(html)
+	So(match, ShouldNotBeNil)
+	values := make([]float64, len(match)-1)
+	for i, m := range match[1:] {
+		values[i], _ = strconv.ParseFloat(string(m), 64)
+	}
+	return values
+}
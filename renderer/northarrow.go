@@ -0,0 +1,29 @@
+package renderer
+
+import (
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// northArrowMargin is the distance of the north arrow from the edges of the map
+const northArrowMargin = 10.0
+
+// northArrowPosition returns the position of the top left corner of the north arrow, in the requested corner of the map.
+// In the bottom left corner, the arrow is drawn above the scale bar (if any).
+func northArrowPosition(svgRequest *SVGRequest) (float64, float64) {
+	request := svgRequest.request
+	left, right := northArrowMargin, svgRequest.ViewBoxWidth-northArrowMargin-g2s.NorthArrowWidth
+	top, bottom := northArrowMargin, svgRequest.ViewBoxHeight-northArrowMargin-g2s.NorthArrowHeight
+	switch request.NorthArrow {
+	case models.CornerTopRight:
+		return right, top
+	case models.CornerBottomLeft:
+		if request.ShowScaleBar {
+			bottom -= scaleBarHeight(svgRequest)
+		}
+		return left, bottom
+	case models.CornerBottomRight:
+		return right, bottom
+	}
+	return left, top
+}
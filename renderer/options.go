@@ -0,0 +1,74 @@
+package renderer
+
+import "github.com/ONSdigital/dp-map-renderer/models"
+
+// RendererOptions holds the house-style dimensions used when rendering maps and legends
+type RendererOptions struct {
+	ViewBoxWidth              float64 // the width of the map's viewBox when the request does not specify a width
+	HorizontalKeyHeight       float64 // the height of the horizontal legend's viewBox
+	VerticalKeyHeightFraction float64 // the height of the colour bar in the vertical legend, as a fraction of the legend's height
+	LegendPadding             float64 // the space added to the width of the vertical legend, around its widest content
+	FontSize                  int     // the font size (in pixels) used when the request does not specify one
+	MaxFallbackPNGSize        int     // the maximum length of a base64-encoded fallback png, beyond which it is converted at a smaller scale or omitted - 0 for no limit
+	MinFallbackPNGScale       float64 // the smallest scale at which an oversized fallback png is converted before it is omitted
+	PanZoomScript             string  // the source of the svg-pan-zoom library, inlined in self-contained pages (see RenderPageWithStats) - empty if not available
+	ColourBlindChecks         bool    // if true, the warnings of a render include the classes of a choropleth that are hard to tell apart with red-green colour blindness (see colour.CheckPalette)
+	Deterministic             bool    // if true, the same request is always rendered identically (e.g. for golden-file tests): the regions of a topology with several objects are ordered by object name, and coordinates are rounded to 3 decimal places
+}
+
+// DefaultOptions returns the options used unless others are given to New or Configure
+func DefaultOptions() RendererOptions {
+	return RendererOptions{
+		ViewBoxWidth:              models.DefaultViewBoxWidth,
+		HorizontalKeyHeight:       90,
+		VerticalKeyHeightFraction: 0.8,
+		LegendPadding:             10,
+		FontSize:                  models.DefaultFontSize,
+		MaxFallbackPNGSize:        0,
+		MinFallbackPNGScale:       0.25,
+	}
+}
+
+// withDefaults returns a copy of the options in which any that are zero (or negative, or a fraction greater than 1) take their default value
+func (o RendererOptions) withDefaults() RendererOptions {
+	defaults := DefaultOptions()
+	if o.ViewBoxWidth <= 0 {
+		o.ViewBoxWidth = defaults.ViewBoxWidth
+	}
+	if o.HorizontalKeyHeight <= 0 {
+		o.HorizontalKeyHeight = defaults.HorizontalKeyHeight
+	}
+	if o.VerticalKeyHeightFraction <= 0 || o.VerticalKeyHeightFraction > 1 {
+		o.VerticalKeyHeightFraction = defaults.VerticalKeyHeightFraction
+	}
+	if o.LegendPadding <= 0 {
+		o.LegendPadding = defaults.LegendPadding
+	}
+	if o.FontSize <= 0 {
+		o.FontSize = defaults.FontSize
+	}
+	if o.MaxFallbackPNGSize <= 0 {
+		o.MaxFallbackPNGSize = defaults.MaxFallbackPNGSize
+	}
+	if o.MinFallbackPNGScale <= 0 || o.MinFallbackPNGScale > 1 {
+		o.MinFallbackPNGScale = defaults.MinFallbackPNGScale
+	}
+	return o
+}
+
+// Configure assigns the options used by the default Renderer - any that are zero (or negative, or a fraction greater than 1) take their default value.
+// The view box width and font size are also applied to render requests as they are created (see models.UseDefaults).
+// Must be called before rendering begins.
+func Configure(o RendererOptions) {
+	o = o.withDefaults()
+	defaultRenderer.Configure(o)
+	models.UseDefaults(o.ViewBoxWidth, o.FontSize)
+}
+
+// fontSize returns the font size of the request, or the default font size of the renderer if it has none
+func (svgRequest *SVGRequest) fontSize() int {
+	if svgRequest.request.FontSize > 0 {
+		return svgRequest.request.FontSize
+	}
+	return svgRequest.options.FontSize
+}
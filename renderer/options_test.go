@@ -0,0 +1,128 @@
+package renderer_test
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigureHorizontalKeyHeight(t *testing.T) {
+	Convey("The horizontal key should have the configured height", t, func() {
+		Configure(RendererOptions{HorizontalKeyHeight: 120})
+		defer Configure(DefaultOptions())
+
+		renderRequest := loadExampleRequest(t)
+		renderRequest.MinWidth, renderRequest.MaxWidth = 0, 0
+
+		result := RenderHorizontalKey(PrepareSVGRequest(renderRequest))
+
+		So(result, ShouldContainSubstring, ` viewBox="0 0 400 120"`)
+		So(result, ShouldContainSubstring, ` width="400" height="120"`)
+	})
+}
+
+func TestConfigureVerticalKeyHeightFraction(t *testing.T) {
+	Convey("The colour bar of the vertical key should fill the configured fraction of the legend's height, centred vertically", t, func() {
+		renderRequest := loadExampleRequest(t)
+		defaultHeight := verticalKeyBarHeight(RenderVerticalKey(PrepareSVGRequest(renderRequest)))
+
+		Configure(RendererOptions{VerticalKeyHeightFraction: 0.5})
+		defer Configure(DefaultOptions())
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		result := RenderVerticalKey(svgRequest)
+
+		So(defaultHeight, ShouldAlmostEqual, svgRequest.ViewBoxHeight*0.8, 0.001)
+		So(verticalKeyBarHeight(result), ShouldAlmostEqual, svgRequest.ViewBoxHeight*0.5, 0.001)
+		translateY := regexp.MustCompile(`legend-vertical-key" transform="translate\([\d.]+, ([\d.]+)\)"`).FindStringSubmatch(result)
+		So(len(translateY), ShouldEqual, 2)
+		y, _ := strconv.ParseFloat(translateY[1], 64)
+		So(y, ShouldAlmostEqual, svgRequest.ViewBoxHeight*0.25, 0.001)
+	})
+}
+
+func TestConfigureLegendPadding(t *testing.T) {
+	Convey("The vertical legend and the css should allow for the configured padding", t, func() {
+		renderRequest := loadExampleRequest(t)
+		renderRequest.MinWidth, renderRequest.MaxWidth = 0, 0
+		renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionAfter
+		renderRequest.Choropleth.HorizontalLegendPosition = models.LegendPositionNone
+		defaultWidth := PrepareSVGRequest(renderRequest).VerticalLegendWidth
+		_, defaultResult := invokeRenderHTMLWithSVG(renderRequest)
+
+		Configure(RendererOptions{LegendPadding: 50})
+		defer Configure(DefaultOptions())
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		So(svgRequest.VerticalLegendWidth, ShouldAlmostEqual, defaultWidth+40, 0.001)
+		So(getWidth(RenderVerticalKey(svgRequest)), ShouldEqual, int(defaultWidth+40+0.5))
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+		style := regexp.MustCompile(`(?s)<style type="text/css">.*</style>`)
+		So(style.FindString(result), ShouldNotBeEmpty)
+		So(style.FindString(result), ShouldNotEqual, style.FindString(defaultResult))
+	})
+}
+
+func TestConfigureViewBoxWidthAndFontSize(t *testing.T) {
+	Convey("A request without a width or font size should use the configured defaults", t, func() {
+		renderRequest := loadExampleRequest(t)
+		renderRequest.MinWidth, renderRequest.MaxWidth, renderRequest.DefaultWidth = 0, 0, 0
+		renderRequest.FontSize = 0
+		renderRequest.Choropleth.HorizontalLegendPosition = models.LegendPositionBefore
+		renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionNone
+		defaultLegendWidth := PrepareSVGRequest(renderRequest).VerticalLegendWidth
+
+		Configure(RendererOptions{ViewBoxWidth: 500, FontSize: 20})
+		defer Configure(DefaultOptions())
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		So(svgRequest.ViewBoxWidth, ShouldEqual, 500)
+		So(svgRequest.VerticalLegendWidth, ShouldBeGreaterThan, defaultLegendWidth)
+		So(RenderHorizontalKey(svgRequest), ShouldContainSubstring, ` viewBox="0 0 500 90"`)
+
+		_, result := invokeRenderHTMLWithSVG(renderRequest)
+		So(regexp.MustCompile(`(?s)<style type="text/css">.*</style>`).FindString(result), ShouldContainSubstring, `width: 500px;`)
+
+		Convey("And new requests should be created with the configured font size", func() {
+			request, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+			So(err, ShouldBeNil)
+			So(request.FontSize, ShouldEqual, 20)
+		})
+	})
+
+	Convey("Options that are not given should take their default values", t, func() {
+		Configure(RendererOptions{ViewBoxWidth: 500})
+		defer Configure(DefaultOptions())
+
+		renderRequest := loadExampleRequest(t)
+		renderRequest.MinWidth, renderRequest.MaxWidth = 0, 0
+
+		So(RenderHorizontalKey(PrepareSVGRequest(renderRequest)), ShouldContainSubstring, ` viewBox="0 0 400 90"`)
+	})
+}
+
+func loadExampleRequest(t *testing.T) *models.RenderRequest {
+	renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return renderRequest
+}
+
+// verticalKeyBarHeight returns the total height of the coloured rectangles in the vertical key
+func verticalKeyBarHeight(result string) float64 {
+	total := 0.0
+	for _, m := range regexp.MustCompile(`<rect class="keyColour" height="([\d.]+)" width="8" y=`).FindAllStringSubmatch(result, -1) {
+		height, err := strconv.ParseFloat(m[1], 64)
+		So(err, ShouldBeNil)
+		total += height
+	}
+	return total
+}
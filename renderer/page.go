@@ -0,0 +1,150 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// PanZoomLibraryURL is the location of the svg-pan-zoom library loaded by a page that is not self-contained
+const PanZoomLibraryURL = "https://cdn.ons.gov.uk/vendor/svg-pan-zoom/3.5.2/svg-pan-zoom.min.js"
+
+// pageStyle is the house style of a standalone page, which the css of the figure itself (see renderCss) does not provide
+const pageStyle = `
+	body {
+		font-family: "Open Sans", Helvetica, Arial, sans-serif;
+		font-size: 14px;
+		font-weight: 400;
+	}
+	.map__caption {
+		font-size: 150%;
+		font-weight: bold;
+	}
+	.map__subtitle {
+		font-size: 75%;
+	}
+	div.map_key__vertical, div.map {
+		display: inline-block;
+	}
+	.mapRegion {
+		stroke: #323132;
+		stroke-width: 0.5;
+	}
+	.mapRegion:hover {
+		stroke: purple;
+		stroke-width: 1;
+	}
+`
+
+// pageScript initialises svg-pan-zoom on the map (whose id is the single argument) once the page has loaded:
+// sizing the svg to its viewBox, applying any data-pan-zoom-options and centring on any data-focus-region.
+// An svg marked data-pan-zoom="false", or a page without the library, is left as a static image.
+// Either way, the tooltip of a region (see RenderRequest.Tooltips), if any, is shown while the region (or its low detail copy) is hovered over or focused.
+const pageScript = `
+	document.addEventListener("DOMContentLoaded", function() {
+		var mapId = "%s"
+		var svg = document.getElementById(mapId);
+		var showTooltip = function(visibility) {
+			return function(event) {
+				var tooltip = event.target.id && document.getElementById(event.target.id + "-tooltip");
+				if (tooltip) {
+					tooltip.setAttribute("visibility", visibility);
+				}
+			};
+		};
+		if (svg) {
+			svg.addEventListener("mouseover", showTooltip("visible"));
+			svg.addEventListener("focusin", showTooltip("visible"));
+			svg.addEventListener("mouseout", showTooltip("hidden"));
+			svg.addEventListener("focusout", showTooltip("hidden"));
+		}
+		if (typeof svgPanZoom === "function" && svg && svg.clientWidth > 0 && svg.hasAttribute("viewBox") && svg.getAttribute("data-pan-zoom") !== "false") {
+			var viewBox = svg.getAttribute("viewBox").split(" ") // x1 y1 x2 y2
+			var heightRatio = parseInt(viewBox[3]) / parseInt(viewBox[2])
+			var setSvgHeight = function() {
+				svg.style.height = Math.round(svg.clientWidth * heightRatio) + "px"
+				return true;
+			};
+			setSvgHeight();
+			var options = {minZoom: 0.75, maxZoom: 100, zoomScaleSensitivity: 0.4, mouseWheelZoomEnabled: false, controlIconsEnabled: true, fit: true, center: true};
+			var custom = svg.hasAttribute("data-pan-zoom-options") ? JSON.parse(svg.getAttribute("data-pan-zoom-options")) : {};
+			for (var name in custom) {
+				options[name] = custom[name];
+			}
+			var panZoom = window.panZoom = svgPanZoom('#' + mapId, options);
+			var focus = function() {
+				panZoom.fit();
+				panZoom.center();
+				var region = svg.hasAttribute("data-focus-region") && document.getElementById(svg.getAttribute("data-focus-region"));
+				if (!region || !region.hasAttribute("data-focus-width")) {
+					return;
+				}
+				var x = parseFloat(region.getAttribute("data-focus-x")), y = parseFloat(region.getAttribute("data-focus-y"));
+				var w = parseFloat(region.getAttribute("data-focus-width")), h = parseFloat(region.getAttribute("data-focus-height"));
+				var sizes = panZoom.getSizes();
+				panZoom.zoom(Math.max(1, Math.min(options.maxZoom, 0.8 * Math.min(sizes.viewBox.width / w, sizes.viewBox.height / h))));
+				sizes = panZoom.getSizes();
+				panZoom.pan({x: sizes.width / 2 - (x + w / 2) * sizes.realZoom, y: sizes.height / 2 - (y + h / 2) * sizes.realZoom});
+			};
+			focus();
+
+			window.addEventListener('resize', function(){
+				setSvgHeight()
+				panZoom.resize();
+				focus();
+			});
+		}
+	});
+`
+
+// RenderPageWithStats returns a complete html document containing the figure rendered by RenderHTMLWithSVG, the svg-pan-zoom library
+// and a script that initialises it on the map - a page that may be opened on its own or embedded in an iframe.
+// If selfContained, the library is inlined from RendererOptions.PanZoomScript rather than loaded from PanZoomLibraryURL,
+// so that the page makes no network requests (without pan and zoom, and with a warning, if the renderer has no PanZoomScript).
+// Also returns the stats of the render, including any non-fatal warnings.
+func (r *Renderer) RenderPageWithStats(request *models.RenderRequest, selfContained bool) ([]byte, *RenderStats, error) {
+	figure, stats, err := r.RenderHTMLWithSVGAndStats(request)
+	if err != nil {
+		return nil, stats, err
+	}
+	_, options := r.configuration()
+
+	page := bytes.NewBufferString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"UTF-8\">\n")
+	page.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	fmt.Fprintf(page, "<title>%s</title>\n", html.EscapeString(pageTitle(request)))
+	fmt.Fprintf(page, "<style type=\"text/css\">%s</style>\n", pageStyle)
+	switch {
+	case !selfContained:
+		fmt.Fprintf(page, "<script type=\"text/javascript\" src=\"%s\"></script>\n", PanZoomLibraryURL)
+	case len(options.PanZoomScript) > 0:
+		fmt.Fprintf(page, "<script type=\"text/javascript\">\n%s\n</script>\n", inlineScript(options.PanZoomScript))
+	default:
+		err := fmt.Errorf("The svg-pan-zoom library is not available to the renderer - the self-contained page does not pan and zoom")
+		log.Error(err, nil)
+		stats.Warnings = append(stats.Warnings, err.Error())
+	}
+	page.WriteString("</head>\n<body>\n")
+	page.Write(figure)
+	fmt.Fprintf(page, "<script type=\"text/javascript\">%s</script>\n", fmt.Sprintf(pageScript, mapID(request)+"-svg"))
+	page.WriteString("</body>\n</html>\n")
+
+	stats.OutputBytes = page.Len()
+	return page.Bytes(), stats, nil
+}
+
+// pageTitle returns the title of a standalone page - the title of the request, or "Map" if it has none
+func pageTitle(request *models.RenderRequest) string {
+	return documentTitle("", "Map", request.Title)
+}
+
+// scriptEndTag matches the start of a script end tag, in any case
+var scriptEndTag = regexp.MustCompile(`(?i)</(script)`)
+
+// inlineScript returns the javascript with any script end tag escaped, so that it cannot close the script element it is inlined in
+func inlineScript(script string) string {
+	return scriptEndTag.ReplaceAllString(script, `<\/$1`)
+}
@@ -0,0 +1,104 @@
+package renderer
+
+import (
+	"sync"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// Renderer renders maps using its own PNGConverter and options, so that renderers with different configurations may be used in one process.
+// A Renderer is safe for concurrent use, and its configuration may be changed while rendering - requests already prepared
+// (see PrepareSVGRequest) continue to use the previous configuration.
+type Renderer struct {
+	mutex        sync.RWMutex
+	pngConverter g2s.PNGConverter
+	options      RendererOptions
+}
+
+// New creates a Renderer that uses the PNGConverter (which may be nil, in which case pngs cannot be rendered) and options -
+// any options that are zero (or negative, or a fraction greater than 1) take their default value.
+func New(pngConverter g2s.PNGConverter, options RendererOptions) *Renderer {
+	return &Renderer{pngConverter: pngConverter, options: options.withDefaults()}
+}
+
+// UsePNGConverter assigns a PNGConverter that will be used to generate fallback png images for svgs
+func (r *Renderer) UsePNGConverter(p g2s.PNGConverter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pngConverter = p
+}
+
+// Configure assigns the options used by the renderer - any that are zero (or negative, or a fraction greater than 1) take their default value.
+// Unlike the package-level Configure, the defaults applied to render requests as they are created are unchanged.
+func (r *Renderer) Configure(o RendererOptions) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.options = o.withDefaults()
+}
+
+// configuration returns the PNGConverter and options currently assigned to the renderer
+func (r *Renderer) configuration() (g2s.PNGConverter, RendererOptions) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.pngConverter, r.options
+}
+
+// defaultRenderer is used by the package-level functions, which are retained for compatibility
+var defaultRenderer = New(nil, DefaultOptions())
+
+// Default returns the Renderer used by the package-level functions (see UsePNGConverter and Configure)
+func Default() *Renderer {
+	return defaultRenderer
+}
+
+// UsePNGConverter assigns a PNGConverter that will be used by the default Renderer to generate fallback png images for svgs.
+// It is safe to call while rendering - requests already prepared (see PrepareSVGRequest) continue to use the previous converter.
+func UsePNGConverter(p g2s.PNGConverter) {
+	defaultRenderer.UsePNGConverter(p)
+}
+
+// PrepareSVGRequest wraps the request in an SVGRequest using the default Renderer, caching expensive calculations up front
+func PrepareSVGRequest(request *models.RenderRequest) *SVGRequest {
+	return defaultRenderer.PrepareSVGRequest(request)
+}
+
+// RenderHTMLWithSVG renders the request with the default Renderer - see Renderer.RenderHTMLWithSVG
+func RenderHTMLWithSVG(request *models.RenderRequest) ([]byte, error) {
+	return defaultRenderer.RenderHTMLWithSVG(request)
+}
+
+// RenderHTMLWithSVGAndWarnings renders the request with the default Renderer - see Renderer.RenderHTMLWithSVGAndWarnings
+func RenderHTMLWithSVGAndWarnings(request *models.RenderRequest) ([]byte, []string, error) {
+	return defaultRenderer.RenderHTMLWithSVGAndWarnings(request)
+}
+
+// RenderHTMLWithSVGAndStats renders the request with the default Renderer - see Renderer.RenderHTMLWithSVGAndStats
+func RenderHTMLWithSVGAndStats(request *models.RenderRequest) ([]byte, *RenderStats, error) {
+	return defaultRenderer.RenderHTMLWithSVGAndStats(request)
+}
+
+// RenderHTMLWithPNG renders the request with the default Renderer - see Renderer.RenderHTMLWithPNG
+func RenderHTMLWithPNG(request *models.RenderRequest) ([]byte, error) {
+	return defaultRenderer.RenderHTMLWithPNG(request)
+}
+
+// RenderHTMLWithPNGAndWarnings renders the request with the default Renderer - see Renderer.RenderHTMLWithPNGAndWarnings
+func RenderHTMLWithPNGAndWarnings(request *models.RenderRequest) ([]byte, []string, error) {
+	return defaultRenderer.RenderHTMLWithPNGAndWarnings(request)
+}
+
+// RenderHTMLWithPNGAndStats renders the request with the default Renderer - see Renderer.RenderHTMLWithPNGAndStats
+func RenderHTMLWithPNGAndStats(request *models.RenderRequest) ([]byte, *RenderStats, error) {
+	return defaultRenderer.RenderHTMLWithPNGAndStats(request)
+}
+
+// RenderAll renders the request with the default Renderer - see Renderer.RenderAll
+func RenderAll(request *models.RenderRequest) (svgHTML []byte, pngHTML []byte, stats *RenderStats, err error) {
+	return defaultRenderer.RenderAll(request)
+}
+
+// SelfTest tests the default Renderer - see Renderer.SelfTest
+func SelfTest() error {
+	return defaultRenderer.SelfTest()
+}
@@ -0,0 +1,86 @@
+package renderer_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	"github.com/ONSdigital/dp-map-renderer/testdata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenderersWithDifferentConfigurations(t *testing.T) {
+	Convey("Two renderers with different converters and options should render concurrently without interfering with each other", t, func() {
+		first := New(&namedPNGConverter{name: "first"}, RendererOptions{HorizontalKeyHeight: 60})
+		second := New(&namedPNGConverter{name: "second"}, RendererOptions{HorizontalKeyHeight: 120})
+
+		type result struct {
+			name string
+			html string
+		}
+		var wg sync.WaitGroup
+		results := make(chan result, 20)
+		for g := 0; g < 10; g++ {
+			r, name := first, "first"
+			if g%2 == 1 {
+				r, name = second, "second"
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				renderRequest.IncludeFallbackPng = true
+				renderRequest.Choropleth.HorizontalLegendPosition = models.LegendPositionAfter
+				renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionNone
+				html, err := r.RenderHTMLWithSVG(renderRequest)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results <- result{name: name, html: string(html)}
+			}()
+		}
+		wg.Wait()
+		close(results)
+
+		count := 0
+		heights := map[string]string{"first": `viewBox="0 0 400 60"`, "second": `viewBox="0 0 400 120"`}
+		for r := range results {
+			count++
+			other := "second"
+			if r.name == "second" {
+				other = "first"
+			}
+			So(strings.Count(r.html, `<img src="`+r.name+`" />`), ShouldEqual, 2)
+			So(r.html, ShouldNotContainSubstring, `<img src="`+other+`" />`)
+			So(r.html, ShouldContainSubstring, heights[r.name])
+			So(r.html, ShouldNotContainSubstring, heights[other])
+		}
+		So(count, ShouldEqual, 10)
+	})
+
+	Convey("The package-level functions should use the default renderer", t, func() {
+		UsePNGConverter(&namedPNGConverter{name: "default"})
+		defer UsePNGConverter(pngConverter)
+
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := Default().RenderHTMLWithPNG(renderRequest)
+		So(err, ShouldBeNil)
+		So(string(expected), ShouldContainSubstring, "base64,default")
+
+		renderRequest, _ = models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		result, err := RenderHTMLWithPNG(renderRequest)
+		So(err, ShouldBeNil)
+		So(string(result), ShouldEqual, string(expected))
+	})
+}
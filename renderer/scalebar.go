@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+)
+
+// earthRadius is the mean radius of the earth in km, used to measure the ground distance represented by the scale bar
+const earthRadius = 6371.0
+
+// maxScaleBarFraction is the maximum length of the scale bar, as a fraction of the width of the map
+const maxScaleBarFraction = 0.3
+
+// scaleBarMargin is the distance of the scale bar from the bottom and left edges of the map
+const scaleBarMargin = 10.0
+
+// scaleBarOverlay returns an overlay that draws a scale bar in the bottom left corner of the map, with end ticks and a label.
+// Its length is a round distance (see scaleBarDistance), measured along the middle latitude of the map.
+func scaleBarOverlay(svgRequest *SVGRequest) g2s.Overlay {
+	bounds := g2s.BoundingBox(svgRequest.geoJSON)
+	return func(sf g2s.ScaleFunc) string {
+		if bounds == nil {
+			return ""
+		}
+		kmPerPixel := groundDistancePerPixel(sf, (bounds[0]+bounds[2])/2, (bounds[1]+bounds[3])/2)
+		if kmPerPixel <= 0 || math.IsInf(kmPerPixel, 0) || math.IsNaN(kmPerPixel) {
+			return ""
+		}
+		distance := scaleBarDistance(kmPerPixel * svgRequest.ViewBoxWidth)
+		length := distance / kmPerPixel
+
+		content := bytes.NewBufferString("")
+		fmt.Fprintf(content, `<g id="%s-scalebar" class="mapScaleBar" transform="translate(%f, %f)">`, mapID(svgRequest.request), scaleBarMargin, svgRequest.ViewBoxHeight-scaleBarMargin)
+		fmt.Fprintf(content, `<line x1="0" y1="0" x2="%f" y2="0" style="stroke: black; stroke-width: 1.5;"></line>`, length)
+		fmt.Fprint(content, `<line x1="0" y1="-5" x2="0" y2="0" style="stroke: black; stroke-width: 1.5;"></line>`)
+		fmt.Fprintf(content, `<line x1="%f" y1="-5" x2="%f" y2="0" style="stroke: black; stroke-width: 1.5;"></line>`, length, length)
+		fmt.Fprintf(content, `<text x="%f" y="-8" style="text-anchor: middle; font-size: %dpx;" class="mapScaleBarText">%s</text>`, length/2, svgRequest.fontSize(), scaleBarLabel(distance))
+		fmt.Fprint(content, `</g>`)
+		return content.String()
+	}
+}
+
+// scaleBarHeight returns the height of the scale bar, including its label (above the bar) and the margin below it
+func scaleBarHeight(svgRequest *SVGRequest) float64 {
+	return scaleBarMargin + 8 + float64(svgRequest.fontSize())
+}
+
+// groundDistancePerPixel returns the ground distance (in km) represented by a horizontal pixel at the given point of the map.
+// It is measured along the parallel across a degree of longitude centred on the point, so that it allows for any distortion
+// of the projection at that latitude (e.g. Mercator stretching the map further from the equator).
+func groundDistancePerPixel(sf g2s.ScaleFunc, longitude, latitude float64) float64 {
+	x1, _ := sf(longitude-0.5, latitude)
+	x2, _ := sf(longitude+0.5, latitude)
+	return earthRadius * (math.Pi / 180) * math.Cos(latitude*math.Pi/180) / math.Abs(x2-x1)
+}
+
+// scaleBarDistance returns the round distance in km (1, 2 or 5 times a power of 10, e.g. 10, 20, 50 or 100) shown by the scale bar of a map
+// with the given width (in km): the largest no more than 30% of the width - which is at least 15% of the width unless no round distance lies between the two.
+func scaleBarDistance(mapWidth float64) float64 {
+	max := mapWidth * maxScaleBarFraction
+	power := math.Pow10(int(math.Floor(math.Log10(max))))
+	for _, multiple := range []float64{5, 2, 1} {
+		if distance := multiple * power; distance <= max {
+			return distance
+		}
+	}
+	return power
+}
+
+// scaleBarLabel returns the label of the scale bar for the distance - in km, or in m if less than 1 km
+func scaleBarLabel(distance float64) string {
+	if distance < 1 {
+		return fmt.Sprintf("%g m", math.Round(distance*1000))
+	}
+	return fmt.Sprintf("%g km", distance)
+}
@@ -0,0 +1,64 @@
+package renderer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+)
+
+// selfTestRequest is a tiny render request - two squares, coloured by their value - used by SelfTest
+const selfTestRequest = `{
+	"schema_version": 2,
+	"filename": "self-test",
+	"geography": {
+		"topojson": {"type":"Topology","objects":{"squares":{"type":"GeometryCollection","geometries":[
+			{"type":"Polygon","arcs":[[0]],"properties":{"code":"a","name":"Square A"}},
+			{"type":"Polygon","arcs":[[1]],"properties":{"code":"b","name":"Square B"}}]}},
+			"arcs":[[[0,0],[1,0],[1,1],[0,1],[0,0]],[[1,0],[2,0],[2,1],[1,1],[1,0]]]},
+		"id_property": "code",
+		"name_property": "name"
+	},
+	"data": [{"id": "a", "value": 1}, {"id": "b", "value": 2}],
+	"choropleth": {
+		"breaks": [{"lower_bound": 0, "color": "red"}, {"lower_bound": 1.5, "color": "blue"}],
+		"upper_bound": 2,
+		"vertical_legend_position": "after"
+	}
+}`
+
+// SelfTest renders a tiny, embedded map from start to finish - preparing and rendering the svg, then converting it to a png
+// using the renderer's PNGConverter (see UsePNGConverter) - returning an error if any stage fails
+func (r *Renderer) SelfTest() error {
+	request, err := models.CreateRenderRequest(bytes.NewReader([]byte(selfTestRequest)))
+	if err != nil {
+		return fmt.Errorf("self test request is invalid: %v", err)
+	}
+	if err = request.ValidateRenderRequest(); err != nil {
+		return fmt.Errorf("self test request is invalid: %v", err)
+	}
+
+	svgRequest := r.PrepareSVGRequest(request)
+	svg := RenderSVG(svgRequest)
+	if !strings.Contains(svg, "<path") {
+		return errors.New("self test svg does not contain any regions")
+	}
+	if len(svgRequest.Warnings) > 0 {
+		return fmt.Errorf("self test svg rendered with warnings: %v", svgRequest.Warnings)
+	}
+
+	converter := svgRequest.converter()
+	if converter == nil {
+		return errors.New("pngConverter is nil - cannot convert svg to png")
+	}
+	png, err := converter.Convert([]byte(svg))
+	if err != nil {
+		return fmt.Errorf("self test failed to convert svg to png: %v", err)
+	}
+	if len(png) == 0 {
+		return errors.New("self test png is empty")
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package renderer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/dp-map-renderer/health"
+	. "github.com/ONSdigital/dp-map-renderer/renderer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// switchablePNGConverter fails to convert svgs while failing is true
+type switchablePNGConverter struct {
+	recordingPNGConverter
+	mutex   sync.Mutex
+	failing bool
+}
+
+func (c *switchablePNGConverter) Convert(svg []byte) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.failing {
+		return nil, errors.New("executable file not found in $PATH")
+	}
+	return c.recordingPNGConverter.Convert(svg)
+}
+
+func (c *switchablePNGConverter) setFailing(failing bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.failing = failing
+}
+
+func TestSelfTest(t *testing.T) {
+
+	Convey("SelfTest should succeed when the svg can be converted to a png", t, func() {
+		UsePNGConverter(pngConverter)
+
+		So(SelfTest(), ShouldBeNil)
+	})
+
+	Convey("SelfTest should fail when the png converter fails", t, func() {
+		err := New(&switchablePNGConverter{failing: true}, DefaultOptions()).SelfTest()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "executable file not found")
+	})
+
+	Convey("SelfTest should fail when there is no png converter", t, func() {
+		So(New(nil, DefaultOptions()).SelfTest(), ShouldNotBeNil)
+	})
+}
+
+func TestSelfTestDeterminesReadiness(t *testing.T) {
+
+	Convey("Readiness should flip to failing when the png converter fails, and recover when it works again", t, func() {
+		converter := &switchablePNGConverter{}
+
+		selfTest := health.NewSelfTest("test_self_test", New(converter, DefaultOptions()).SelfTest, 5*time.Millisecond)
+		health.UseSelfTest(selfTest)
+		defer health.UseSelfTest(nil)
+
+		So(readinessCode(), ShouldEqual, http.StatusServiceUnavailable) // not yet run
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := selfTest.Start(ctx)
+
+		So(waitForStatus(selfTest, health.StatusOK), ShouldBeTrue)
+		So(readinessCode(), ShouldEqual, http.StatusOK)
+
+		converter.setFailing(true)
+		So(waitForStatus(selfTest, health.StatusFailing), ShouldBeTrue)
+		So(readinessCode(), ShouldEqual, http.StatusServiceUnavailable)
+		So(selfTest.Status().Error, ShouldContainSubstring, "executable file not found")
+
+		converter.setFailing(false)
+		So(waitForStatus(selfTest, health.StatusOK), ShouldBeTrue)
+		So(readinessCode(), ShouldEqual, http.StatusOK)
+
+		cancel()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("self test did not stop when cancelled")
+		}
+	})
+}
+
+func readinessCode() int {
+	w := httptest.NewRecorder()
+	health.Readiness(w, httptest.NewRequest("GET", "/ready", nil))
+	return w.Code
+}
+
+// waitForStatus waits (for up to a second) for the self test to have the given status
+func waitForStatus(selfTest *health.SelfTest, status string) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if selfTest.Status().Status == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package renderer
+
+import (
+	"time"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/go-ns/log"
+)
+
+// RenderStats records the size of a render request and the work done to render it, so that pathological requests can be spotted in the logs
+type RenderStats struct {
+	FeatureCount    int           // the number of regions in the geography
+	DataRowCount    int           // the number of rows of data
+	BreakCount      int           // the number of breaks in the choropleth
+	OutputBytes     int           // the length of the rendered html
+	PNGConversions  int           // the number of svgs converted to png (including fallback images)
+	PrepareDuration time.Duration // the time taken by PrepareSVGRequest
+	DrawDuration    time.Duration // the time taken to draw the map and legends, excluding conversions to png
+	ConvertDuration time.Duration // the time taken to convert svgs to png
+	Warnings        []string      // non-fatal problems found while rendering the request
+}
+
+// LogData returns the stats as log data, with the durations in milliseconds
+func (s *RenderStats) LogData() log.Data {
+	return log.Data{
+		"feature_count":   s.FeatureCount,
+		"data_row_count":  s.DataRowCount,
+		"break_count":     s.BreakCount,
+		"output_bytes":    s.OutputBytes,
+		"png_conversions": s.PNGConversions,
+		"prepare_ms":      milliseconds(s.PrepareDuration),
+		"draw_ms":         milliseconds(s.DrawDuration),
+		"convert_ms":      milliseconds(s.ConvertDuration),
+		"warning_count":   len(s.Warnings),
+	}
+}
+
+// addDrawTime adds the time since start to the draw duration, excluding the time spent converting to png since then
+// (convertBefore is the ConvertDuration at the start)
+func (s *RenderStats) addDrawTime(start time.Time, convertBefore time.Duration) {
+	s.DrawDuration += time.Since(start) - (s.ConvertDuration - convertBefore)
+}
+
+// addConversion records a conversion to png that began at start
+func (s *RenderStats) addConversion(start time.Time) {
+	s.PNGConversions++
+	s.ConvertDuration += time.Since(start)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// statsConverter is a PNGConverter that records each conversion in the stats of the request,
+// and limits the size of fallback images (see RendererOptions.MaxFallbackPNGSize)
+type statsConverter struct {
+	converter  g2s.PNGConverter
+	svgRequest *SVGRequest
+}
+
+func (c *statsConverter) Convert(svg []byte) ([]byte, error) {
+	defer c.svgRequest.stats.addConversion(time.Now())
+	return c.converter.Convert(svg)
+}
+
+func (c *statsConverter) IncludeFallbackImage(svgAttributes string, svgContent string, width float64, height float64, alt string) string {
+	if c.svgRequest.options.MaxFallbackPNGSize > 0 {
+		return includeLimitedFallbackImage(c, c.svgRequest, svgAttributes, svgContent, width, height, alt)
+	}
+	defer c.svgRequest.stats.addConversion(time.Now())
+	return c.converter.IncludeFallbackImage(svgAttributes, svgContent, width, height, alt)
+}
+
+// converter returns the PNGConverter of the request (see UsePNGConverter), recording its conversions in the stats of the request - or nil if there is no PNGConverter
+func (svgRequest *SVGRequest) converter() g2s.PNGConverter {
+	if svgRequest.pngConverter == nil {
+		return nil
+	}
+	return &statsConverter{converter: svgRequest.pngConverter, svgRequest: svgRequest}
+}
+
+// Stats returns the stats recorded while preparing and rendering the request
+func (svgRequest *SVGRequest) Stats() *RenderStats {
+	svgRequest.stats.Warnings = svgRequest.Warnings
+	return &svgRequest.stats
+}
@@ -0,0 +1,84 @@
+package renderer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
+	"github.com/paulmach/go.geojson"
+)
+
+// allowedStyleProperties are the css properties that may be used in RenderRequest.RegionStyles, each with a function that returns
+// true if a value is allowed - colours (or references to patterns within the svg, e.g. url(#map-abcd1234-nodata)), numbers or lengths
+var allowedStyleProperties = map[string]func(string) bool{
+	"fill":         models.IsValidPaint,
+	"stroke":       models.IsValidPaint,
+	"stroke-width": numericStyleValue.MatchString,
+	"opacity":      numericStyleValue.MatchString,
+	"fill-opacity": numericStyleValue.MatchString,
+}
+
+// numericStyleValue matches the numbers and lengths that may be used in RenderRequest.RegionStyles
+var numericStyleValue = regexp.MustCompile(`^-?[0-9]*\.?[0-9]+(px|em|%)?$`)
+
+// mapRegionStyles creates a map of the (prefixed and normalised) region id to its sanitised style override.
+// Declarations that are not allowed are dropped, and a warning is logged for them.
+func mapRegionStyles(regionStyles map[string]string, prefix string, normalisation *models.IDNormalisation) map[interface{}]string {
+	styles := make(map[interface{}]string)
+	for id, css := range regionStyles {
+		style, rejected := sanitiseStyle(css)
+		if len(rejected) > 0 {
+			log.Info("warning: region_styles contains declarations that are not allowed, which have been ignored", log.Data{"id": id, "declarations": rejected})
+		}
+		if len(style) > 0 {
+			styles[prefix+normalisation.Normalise(id)] = style
+		}
+	}
+	return styles
+}
+
+// sanitiseStyle returns the css declarations that use an allowed property and value, each terminated with a semi-colon, and the declarations that were rejected
+func sanitiseStyle(css string) (string, []string) {
+	allowed := []string{}
+	rejected := []string{}
+	for _, declaration := range strings.Split(css, ";") {
+		declaration = strings.TrimSpace(declaration)
+		if len(declaration) == 0 {
+			continue
+		}
+		parts := strings.SplitN(declaration, ":", 2)
+		if len(parts) == 2 {
+			property := strings.ToLower(strings.TrimSpace(parts[0]))
+			value := strings.TrimSpace(parts[1])
+			if isAllowed, ok := allowedStyleProperties[property]; ok && isAllowed(value) {
+				allowed = append(allowed, property+": "+value+";")
+				continue
+			}
+		}
+		rejected = append(rejected, declaration)
+	}
+	return strings.Join(allowed, " "), rejected
+}
+
+// warnUnknownRegionStyles logs (and returns) a warning listing the ids in the region styles that do not match any feature
+func warnUnknownRegionStyles(features []*geojson.Feature, regionStyles map[string]string, prefix string, normalisation *models.IDNormalisation) []string {
+	featureIDs := make(map[interface{}]bool)
+	for _, feature := range features {
+		featureIDs[normaliseFeatureID(feature.ID, prefix, normalisation)] = true
+	}
+	unknown := []string{}
+	for id := range regionStyles {
+		if !featureIDs[prefix+normalisation.Normalise(id)] {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	log.Info("warning: region_styles contains ids that do not match any region in the geography", log.Data{"ids": unknown})
+	return []string{fmt.Sprintf("region_styles contains ids that do not match any region in the geography: %s", strings.Join(unknown, ", "))}
+}
@@ -5,21 +5,38 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"strconv"
 
 	"strings"
+	"time"
 
 	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/health"
 	"github.com/ONSdigital/dp-map-renderer/htmlutil"
 	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/go-ns/log"
 	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
 )
 
 // RegionClassName is the name of the class assigned to all map regions (denoted by features in the input topology)
 const RegionClassName = "mapRegion"
 
-// MissingDataText is the text appended to the title of a region that has missing data
+// OverlayClassName is the name of the class assigned to the boundaries of the OverlayGeography drawn on top of the regions
+const OverlayClassName = "mapOverlay"
+
+// overlayStyle is the style of the boundaries of the OverlayGeography - outlines only, so the regions beneath remain visible
+const overlayStyle = "fill: none; stroke: #323132; stroke-width: 1.5;"
+
+// MissingDataText is the text appended to the title of a region that has missing data (unless its data row is Missing with a Reason)
 const MissingDataText = "data unavailable"
 
+// The attributes added to a region for the bounds of its confidence interval, when RenderRequest.IncludeCIAttributes is set
+const (
+	ciLowerAttribute = "data-ci-lower"
+	ciUpperAttribute = "data-ci-upper"
+)
+
 // MissingDataPattern is the fmt template used to generate the pattern used for regions with missing data
 const MissingDataPattern = `<pattern id="%s-nodata" width="20" height="20" patternUnits="userSpaceOnUse">
 <g fill="#6D6E72">
@@ -36,67 +53,141 @@ const MissingDataPattern = `<pattern id="%s-nodata" width="20" height="20" patte
 </g>
 </pattern>`
 
-var pngConverter g2s.PNGConverter
+// minifyPrecision is the number of decimal places of the coordinates in minified svgs (see RenderRequest.Minify)
+const minifyPrecision = 2
 
-// UsePNGConverter assigns a PNGConverter that will be used to generate fallback png images for svgs.
-func UsePNGConverter(p g2s.PNGConverter) {
-	pngConverter = p
-}
+// deterministicPrecision is the number of decimal places of the coordinates in the svgs of a deterministic renderer (see RendererOptions.Deterministic)
+const deterministicPrecision = 3
+
+// prepareTimingName is the name of the timing (see health.Snapshot) recorded by PrepareSVGRequest
+const prepareTimingName = "render_prepare"
 
 // valueAndColour represents a choropleth data point, which has both a numeric value and an associated colour
 type valueAndColour struct {
-	value  float64
-	colour string
+	value   float64
+	colour  string
+	opacity *float64 // the opacity of the break of the value, if given
+	class   int      // the index of the break of the value, in ascending order of lower bound
+	row     *models.DataRow
 }
 
 // SVGRequest wraps a models.RenderRequest and allows caching of expensive calculations (such as converting topojson to geojson)
 type SVGRequest struct {
 	request             *models.RenderRequest
 	geoJSON             *geojson.FeatureCollection
+	overlayGeoJSON      *geojson.FeatureCollection // the features of the OverlayGeography of the request, if any
 	svg                 *g2s.SVG
-	ViewBoxWidth        float64      // the width dimension of the svg (for the viewBox). The FixedWidth if provided, otherwise the average of min and max width, falling back to 400 if nothing specified
+	ViewBoxWidth        float64      // the width dimension of the svg (for the viewBox). The FixedWidth if provided, otherwise the average of min and max width, falling back to RendererOptions.ViewBoxWidth if nothing specified
 	ViewBoxHeight       float64      // the height dimension of the svg (for the viewBox). Relative to width.
 	breaks              []*breakInfo // sorted breaks
 	referencePos        float64      // the relative position of the reference tick
 	VerticalLegendWidth float64      // the view box width of the vertical legend
 	verticalKeyOffset   float64      // offset for the position of the key. // I.e. the middle of the key should be positioned in the middle of the legend, plus the offset.
 	responsiveSize      bool         // if true, the svg should scale with the size of the page. Otherwise the size is fixed.
+	Warnings            []string     // non-fatal problems found while preparing and rendering the request (which are otherwise only logged)
+	stats               RenderStats
+	pngConverter        g2s.PNGConverter // the PNGConverter when the request was prepared, which is used for every conversion of the request
+	options             RendererOptions  // the options of the renderer when the request was prepared
+	includeFallbackPng  bool             // if true, the svgs include a fallback png image. Initially the IncludeFallbackPng of the request.
+	includeTooltips     bool             // if true, the map includes a tooltip for each region. Initially the Tooltips of the request.
+	featuresStyled      bool             // true once RenderSVG has set the ids, classes and styles of the features, which only needs doing once
+	focusRegion         string           // the id of the path of the FocusRegionID of the request, once found by RenderSVG
+	dataSets            string           // the json of the DataSets of the request (see dataSetsJSON), once calculated by RenderSVG
+
+	// calculated once by PrepareSVGRequest, rather than by each of RenderSVG and the legends
+	ascendingBreaks  []*models.ChoroplethBreak      // the choropleth breaks sorted by ascending lower bound
+	descendingBreaks []*models.ChoroplethBreak      // the choropleth breaks sorted by descending lower bound
+	dataMin, dataMax float64                        // the lowest and highest values in the data
+	dataColours      map[interface{}]valueAndColour // the value and colour of each data row (see mapDataToColour)
 }
 
-// PrepareSVGRequest wraps the request in an SVGRequest, caching expensive calculations up front
-func PrepareSVGRequest(request *models.RenderRequest) *SVGRequest {
-	geoJSON := getGeoJSON(request)
+// addWarning appends a formatted warning to the request's warnings
+func (svgRequest *SVGRequest) addWarning(format string, args ...interface{}) {
+	svgRequest.Warnings = append(svgRequest.Warnings, fmt.Sprintf(format, args...))
+}
+
+// PrepareSVGRequest wraps the request in an SVGRequest, caching expensive calculations up front.
+// The SVGRequest is rendered with the PNGConverter and options of the renderer at this point.
+func (r *Renderer) PrepareSVGRequest(request *models.RenderRequest) *SVGRequest {
+	start := time.Now()
+	pngConverter, options := r.configuration()
+	var warnings []string
+	if warning := setChangeData(request); len(warning) > 0 {
+		log.Info(warning, nil)
+		warnings = append(warnings, warning)
+	}
+	if warning := setAutomaticBreaks(request); len(warning) > 0 {
+		log.Info(warning, nil)
+		warnings = append(warnings, warning)
+	}
+	if err := request.Choropleth.FillBreakColours(); err != nil {
+		log.Error(err, nil)
+		warnings = append(warnings, err.Error())
+	}
+	warnings = append(warnings, colourWarnings(request, options.ColourBlindChecks)...)
+	geoJSON := getGeoJSON(request, options.Deterministic)
+	overlayGeoJSON := geographyGeoJSON(request.OverlayGeography, options.Deterministic)
 
 	svg := g2s.New()
 
 	width, height := 0.0, 0.0
 	if geoJSON != nil {
 		svg.AppendFeatureCollection(geoJSON)
-		width, height = getViewBoxDimensions(svg, request)
+		if request.AnnotationsInBounds && len(request.Annotations) > 0 {
+			svg.ExtendBounds(annotationPoints(request.Annotations))
+		}
+		width, height = getViewBoxDimensions(svg, request, options.ViewBoxWidth)
 	}
 
-	responsiveSize := request.MinWidth > 0 && request.MaxWidth > 0
+	responsiveSize := request.MinWidth > 0 && request.MaxWidth >= request.MinWidth
 
 	svgRequest := &SVGRequest{
-		request:        request,
-		geoJSON:        geoJSON,
-		svg:            svg,
-		ViewBoxWidth:   width,
-		ViewBoxHeight:  height,
-		responsiveSize: responsiveSize,
+		request:            request,
+		geoJSON:            geoJSON,
+		overlayGeoJSON:     overlayGeoJSON,
+		svg:                svg,
+		ViewBoxWidth:       width,
+		ViewBoxHeight:      height,
+		responsiveSize:     responsiveSize,
+		Warnings:           warnings,
+		pngConverter:       pngConverter,
+		options:            options,
+		includeFallbackPng: request.IncludeFallbackPng,
+		includeTooltips:    request.Tooltips,
 	}
 
 	if request.Choropleth != nil && len(request.Choropleth.Breaks) > 0 {
-		svgRequest.breaks, svgRequest.referencePos = getSortedBreakInfo(request)
+		svgRequest.ascendingBreaks = sortBreaks(request.Choropleth.Breaks, true)
+		svgRequest.descendingBreaks = sortBreaks(request.Choropleth.Breaks, false)
+		svgRequest.dataMin, svgRequest.dataMax = dataExtremes(request.Data)
+		if request.Data != nil {
+			svgRequest.dataColours = mapDataToColour(request.Data, svgRequest.descendingBreaks, idPrefix(request)+"-", request.IDNormalisation)
+		}
+		svgRequest.breaks, svgRequest.referencePos = getSortedBreakInfo(svgRequest)
+		if ref := referenceLine(request.Choropleth); len(ref.Text) > 0 && (svgRequest.referencePos < 0 || svgRequest.referencePos > 1) {
+			svgRequest.addWarning("The reference value %g (%s) is outside the range of the legend (%g to %g)", ref.Value, ref.Text, svgRequest.breaks[0].LowerBound, svgRequest.breaks[len(svgRequest.breaks)-1].UpperBound)
+		}
+
+		svgRequest.VerticalLegendWidth, svgRequest.verticalKeyOffset = getVerticalLegendWidth(svgRequest)
+	}
 
-		svgRequest.VerticalLegendWidth, svgRequest.verticalKeyOffset = getVerticalLegendWidth(request, svgRequest.breaks)
+	if request.LowDetail && !responsiveSize {
+		svgRequest.addWarning("low_detail requires a responsive size (min_width and max_width) - the map has no low detail regions")
 	}
 
+	if geoJSON != nil {
+		svgRequest.stats.FeatureCount = len(geoJSON.Features)
+	}
+	svgRequest.stats.DataRowCount = len(request.Data)
+	svgRequest.stats.BreakCount = len(svgRequest.breaks)
+	svgRequest.stats.PrepareDuration = time.Since(start)
+	health.RecordTime(prepareTimingName, svgRequest.stats.PrepareDuration)
 	return svgRequest
 }
 
 // RenderSVG generates an SVG map for the given request
 func RenderSVG(svgRequest *SVGRequest) string {
+	defer svgRequest.stats.addDrawTime(time.Now(), svgRequest.stats.ConvertDuration)
 
 	geoJSON := svgRequest.geoJSON
 	if geoJSON == nil {
@@ -107,64 +198,193 @@ func RenderSVG(svgRequest *SVGRequest) string {
 	vbHeight := svgRequest.ViewBoxHeight
 
 	id := idPrefix(request)
-	setFeatureIDs(geoJSON.Features, request.Geography.IDProperty, id+ "-")
-	setClassProperty(geoJSON.Features, RegionClassName)
-	setChoroplethColoursAndTitles(geoJSON.Features, request)
+	if !svgRequest.featuresStyled {
+		setFeatureIDs(geoJSON.Features, request.Geography.IDProperty, id+"-")
+		setClassProperty(geoJSON.Features, RegionClassName)
+		svgRequest.dataSets = dataSetsJSON(svgRequest, geoJSON.Features)
+		if mapType := getMapType(request); mapType != nil {
+			svgRequest.Warnings = append(svgRequest.Warnings, mapType.render(geoJSON.Features, svgRequest)...)
+		} else {
+			svgRequest.addWarning("Unknown map type %q - the regions have not been styled", request.MapType)
+		}
+		if request.LineStyle != nil {
+			setLineStyles(geoJSON.Features, request.LineStyle)
+		}
+		if len(request.FocusRegionID) > 0 && request.PanZoomEnabled() {
+			if svgRequest.focusRegion = setFocusRegion(svgRequest, geoJSON.Features); len(svgRequest.focusRegion) == 0 {
+				svgRequest.addWarning("The focus region %q is not in the geography - the map will not be centred on it", request.FocusRegionID)
+			}
+		}
+		svgRequest.featuresStyled = true
+	}
 
-	converter := pngConverter
-	if !request.IncludeFallbackPng {
+	converter := svgRequest.converter()
+	if !svgRequest.includeFallbackPng {
 		converter = nil
 	}
 
 	missingDataPattern := strings.Replace(fmt.Sprintf(MissingDataPattern, id), "\n", "", -1)
 
-	return svgRequest.svg.DrawWithProjection(vbWidth, vbHeight, g2s.MercatorProjection,
-		g2s.UseProperties([]string{"style", "class"}),
+	options := []g2s.Option{
+		g2s.UseProperties([]string{"style", "class", ciLowerAttribute, ciUpperAttribute, focusXAttribute, focusYAttribute, focusWidthAttribute, focusHeightAttribute}),
 		g2s.WithTitles(request.Geography.NameProperty),
 		g2s.WithAttribute("id", mapID(request)+"-svg"),
 		g2s.WithAttribute("viewBox", fmt.Sprintf("0 0 %.f %.f", vbWidth, vbHeight)),
 		g2s.WithPNGFallback(converter),
+		g2s.WithFallbackAlt(svgRequest.mapAlt()),
+		g2s.WithDocumentTitle(svgRequest.mapTitle(), strings.Join(strings.Fields(request.Subtitle), " ")),
 		g2s.WithPattern(missingDataPattern),
 		g2s.WithResponsiveSize(svgRequest.responsiveSize),
-	)
+		g2s.WithMinification(request.Minify, minifyPrecision),
+	}
+	if len(svgRequest.focusRegion) > 0 {
+		options = append(options, g2s.WithAttribute(focusRegionAttribute, svgRequest.focusRegion))
+	}
+	if !request.PanZoomEnabled() {
+		options = append(options, g2s.WithAttribute(panZoomAttribute, "false"))
+	} else if panZoomOptions := panZoomOptionsJSON(request.PanZoomOptions); len(panZoomOptions) > 0 {
+		options = append(options, g2s.WithAttribute(panZoomOptionsAttribute, panZoomOptions))
+	}
+	if request.Graticule != nil {
+		if bounds := g2s.BoundingBox(geoJSON); bounds != nil {
+			if lines, err := graticuleLines(request.Graticule, bounds); err != nil {
+				log.Error(err, nil)
+				svgRequest.addWarning("%s", err.Error())
+			} else {
+				options = append(options, g2s.WithUnderlay(graticuleUnderlay(svgRequest, lines)))
+			}
+		}
+	}
+	if svgRequest.overlayGeoJSON != nil {
+		options = append(options, g2s.WithOverlay(g2s.FeatureOverlay(svgRequest.overlayGeoJSON, map[string]string{"class": OverlayClassName, "style": overlayStyle})))
+	}
+	if len(request.PlaceLabels) > 0 {
+		options = append(options, g2s.WithOverlay(placeLabelOverlay(svgRequest)))
+	}
+	if len(request.Annotations) > 0 {
+		options = append(options, g2s.WithOverlay(annotationOverlay(svgRequest)))
+	}
+	if request.ShowScaleBar {
+		options = append(options, g2s.WithOverlay(scaleBarOverlay(svgRequest)))
+	}
+	if request.PointMarker != nil {
+		options = append(options, g2s.WithMarker(id, g2s.Marker{Symbol: request.PointMarker.Symbol, Size: request.PointMarker.Size, Colour: request.PointMarker.Colour}))
+	}
+	if request.LowDetail && svgRequest.responsiveSize {
+		options = append(options, g2s.WithLowDetail(lowDetailTolerance(svgRequest)))
+	}
+	if svgRequest.includeTooltips {
+		options = append(options, g2s.WithScreenOverlay(tooltipOverlay(svgRequest, geoJSON.Features)))
+	}
+	if len(request.NorthArrow) > 0 {
+		x, y := northArrowPosition(svgRequest)
+		options = append(options, g2s.WithNorthArrow(mapID(request)+"-north-arrow", x, y))
+	}
+
+	result := svgRequest.stabilise(svgRequest.svg.DrawWithProjection(vbWidth, vbHeight, g2s.MercatorProjection, options...))
+	if converter != nil && strings.Contains(result, g2s.FallbackErrorText) {
+		svgRequest.addWarning("Unable to include a fallback png image in the svg")
+	}
+	if request.LowDetail && svgRequest.responsiveSize && !strings.Contains(result, `class="`+g2s.LowDetailClassName+`"`) {
+		svgRequest.addWarning("The low detail regions were omitted as they were not much smaller than the full detail regions")
+	}
+	return result
 }
 
-// getGeoJSON performs a sanity check for missing properties, then converts the topojson to geojson
-func getGeoJSON(request *models.RenderRequest) *geojson.FeatureCollection {
+// lowDetailTolerance returns the tolerance to which the low detail regions are simplified - the width of one pixel (in the coordinates of the viewBox)
+// when the map is at its min width, as a simplification any finer than that would not be visible
+func lowDetailTolerance(svgRequest *SVGRequest) float64 {
+	return svgRequest.ViewBoxWidth / svgRequest.request.MinWidth
+}
+
+// getGeoJSON performs a sanity check for missing properties, then converts the topojson of the request's geography to geojson (see geographyGeoJSON)
+func getGeoJSON(request *models.RenderRequest, ordered bool) *geojson.FeatureCollection {
+	return geographyGeoJSON(request.Geography, ordered)
+}
+
+// geographyGeoJSON performs a sanity check for missing properties, then converts the topojson to geojson.
+// If the geography was supplied as geojson a copy of its features is returned.
+// Either way the features (and their properties) may be modified without changing the geography, which may be shared between requests.
+// If ordered, the features of a topology with several objects are in order of object name (otherwise the order varies).
+func geographyGeoJSON(geography *models.Geography, ordered bool) *geojson.FeatureCollection {
+	if geography != nil && geography.Geojson != nil {
+		if len(geography.Geojson.Features) == 0 {
+			return nil
+		}
+		return copyFeatures(geography.Geojson)
+	}
+
 	// sanity check
-	if request.Geography == nil ||
-		request.Geography.Topojson == nil ||
-		len(request.Geography.Topojson.Arcs) == 0 ||
-		len(request.Geography.Topojson.Objects) == 0 {
+	if geography == nil ||
+		geography.Topojson == nil ||
+		len(geography.Topojson.Arcs) == 0 ||
+		len(geography.Topojson.Objects) == 0 {
 		return nil
 	}
 
-	return request.Geography.Topojson.ToGeoJSON()
+	// the converted features share their properties with the topology, so are also copied
+	if ordered && len(geography.Topojson.Objects) > 1 {
+		return copyFeatures(orderedGeoJSON(geography.Topojson))
+	}
+	return copyFeatures(geography.Topojson.ToGeoJSON())
 }
 
-// getViewBoxDimensions assigns the viewbox a fixed width (400) and calculates the height relative to this,
+// orderedGeoJSON converts the topology to geojson with the features of each object in order of object name,
+// rather than the random order in which ToGeoJSON ranges over the map of objects
+func orderedGeoJSON(topology *topojson.Topology) *geojson.FeatureCollection {
+	names := make([]string, 0, len(topology.Objects))
+	for name := range topology.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fc := geojson.NewFeatureCollection()
+	for _, name := range names {
+		object := *topology
+		object.Objects = map[string]*topojson.Geometry{name: topology.Objects[name]}
+		fc.Features = append(fc.Features, object.ToGeoJSON().Features...)
+	}
+	return fc
+}
+
+// copyFeatures returns a copy of the feature collection with a copy of each feature and its properties (the geometries are not copied)
+func copyFeatures(fc *geojson.FeatureCollection) *geojson.FeatureCollection {
+	result := *fc
+	result.Features = make([]*geojson.Feature, len(fc.Features))
+	for i, f := range fc.Features {
+		feature := *f
+		feature.Properties = make(map[string]interface{}, len(f.Properties))
+		for k, v := range f.Properties {
+			feature.Properties[k] = v
+		}
+		result.Features[i] = &feature
+	}
+	return &result
+}
+
+// getViewBoxDimensions assigns the viewbox a fixed width (by default defaultWidth) and calculates the height relative to this,
 // returning (width, height)
-func getViewBoxDimensions(svg *g2s.SVG, request *models.RenderRequest) (float64, float64) {
+func getViewBoxDimensions(svg *g2s.SVG, request *models.RenderRequest, defaultWidth float64) (float64, float64) {
 	width := request.DefaultWidth
 	if width <= 0.0 { // average the min and max width
 		width = (request.MinWidth + request.MaxWidth) / 2
 	}
-	if width <= 0.0 { // use a default width of 400
-		width = 400.0
+	if width <= 0.0 { // use the default width (see RendererOptions)
+		width = defaultWidth
 	}
 	height := svg.GetHeightForWidth(width, g2s.MercatorProjection)
 	return width, height
 }
 
 // setFeatureIDs looks in each Feature for a property with the given idProperty, using it as the feature id.
+// Numeric ids are converted to their canonical string form (see models.FormatID).
 func setFeatureIDs(features []*geojson.Feature, idProperty string, prefix string) {
 	for _, feature := range features {
-		id, isString := feature.Properties[idProperty].(string)
-		if isString && len(id) > 0 {
+		id, isValid := models.FormatID(feature.Properties[idProperty])
+		if isValid && len(id) > 0 {
 			feature.ID = prefix + id
 		} else {
-			id, isString := feature.ID.(string)
-			if isString && len(id) > 0 {
+			id, isValid := models.FormatID(feature.ID)
+			if isValid && len(id) > 0 {
 				feature.ID = prefix + id
 			}
 		}
@@ -189,51 +409,182 @@ func appendProperty(feature *geojson.Feature, propertyName string, value string)
 }
 
 // setChoroplethColoursAndTitles creates a mapping from the id of a data row to its value and colour,
-// then iterates through the features assigning a title and style for the colour.
-func setChoroplethColoursAndTitles(features []*geojson.Feature, request *models.RenderRequest) {
-	choropleth := request.Choropleth
-	if choropleth == nil || request.Data == nil {
-		return
+// then iterates through the features assigning a title and style for the colour (see colourChoropleth).
+func setChoroplethColoursAndTitles(features []*geojson.Feature, request *models.RenderRequest) []string {
+	if request.Choropleth == nil || request.Data == nil {
+		return nil
+	}
+	dataMap := mapDataToColour(request.Data, sortBreaks(request.Choropleth.Breaks, false), idPrefix(request)+"-", request.IDNormalisation)
+	return colourChoropleth(features, request, dataMap)
+}
+
+// dataText returns the text following the name of a region in its title - the value of its data (see displayValue),
+// followed by the confidence interval of the data, if given, and a marker for each of its footnote references
+func dataText(choropleth *models.Choropleth, vc valueAndColour) string {
+	text := displayValue(choropleth, vc)
+	if vc.row.HasConfidenceInterval() {
+		text = fmt.Sprintf("%s (%g–%g)", text, *vc.row.LowerCI, *vc.row.UpperCI)
+	}
+	for _, ref := range vc.row.FootnoteRefs {
+		text = fmt.Sprintf("%s [%d]", text, ref)
+	}
+	return text
+}
+
+// displayValue returns the value of a data row as shown in the title of its region - the DisplayValue of the row if it has one, otherwise the value,
+// with the value prefix and suffix of the choropleth (unless the display value is to be shown without them)
+func displayValue(choropleth *models.Choropleth, vc valueAndColour) string {
+	if len(vc.row.DisplayValue) == 0 {
+		return fmt.Sprintf("%s%g%s", choropleth.ValuePrefix, vc.value, choropleth.ValueSuffix)
 	}
+	if choropleth.DisplayValueOnly {
+		return vc.row.DisplayValue
+	}
+	return choropleth.ValuePrefix + vc.row.DisplayValue + choropleth.ValueSuffix
+}
+
+// setPreparedChoroplethColoursAndTitles is the same as setChoroplethColoursAndTitles, but uses the mapping of data to colour calculated by PrepareSVGRequest
+func setPreparedChoroplethColoursAndTitles(features []*geojson.Feature, svgRequest *SVGRequest) []string {
+	if svgRequest.dataColours == nil {
+		return setChoroplethColoursAndTitles(features, svgRequest.request)
+	}
+	return colourChoropleth(features, svgRequest.request, svgRequest.dataColours)
+}
+
+// colourChoropleth iterates through the features assigning a title and style for the colour of their data, given by dataMap.
+// Any style given for the region in request.RegionStyles is applied after the colour, so that it takes precedence.
+// The confidence interval of a data row, if given, is appended to the title (and added as attributes if request.IncludeCIAttributes is set),
+// followed by a marker for each of its footnote references.
+// Returns warnings describing any data rows that do not match a feature, and features without data.
+func colourChoropleth(features []*geojson.Feature, request *models.RenderRequest, dataMap map[interface{}]valueAndColour) []string {
+	choropleth := request.Choropleth
+	var warnings []string
 	id := idPrefix(request)
-	dataMap := mapDataToColour(request.Data, choropleth, id+ "-")
+	regionStyles := mapRegionStyles(request.RegionStyles, id+"-", request.IDNormalisation)
+	if len(request.RegionStyles) > 0 {
+		warnings = append(warnings, warnUnknownRegionStyles(features, request.RegionStyles, id+"-", request.IDNormalisation)...)
+	}
 	missingValueStyle := "fill: url(#" + id + "-nodata);"
+	missingReasons := mapMissingReasons(request.Data, id+"-", request.IDNormalisation)
+	matched := make(map[interface{}]bool)
+	missingData := []string{}
 	for _, feature := range features {
 		style := missingValueStyle
 		title, ok := feature.Properties[request.Geography.NameProperty]
 		if !ok {
 			title = ""
 		}
-		if vc, exists := dataMap[feature.ID]; exists {
-			style = "fill: " + vc.colour + ";"
-			title = fmt.Sprintf("%v %s%g%s", title, choropleth.ValuePrefix, vc.value, choropleth.ValueSuffix)
+		featureID := normaliseFeatureID(feature.ID, id+"-", request.IDNormalisation)
+		if vc, exists := dataMap[featureID]; exists {
+			style = "fill: " + vc.colour + ";" + opacityStyle("fill-opacity", vc.opacity)
+			title = fmt.Sprintf("%v %s", title, dataText(choropleth, vc))
+			if vc.row.HasConfidenceInterval() && request.IncludeCIAttributes {
+				feature.Properties[ciLowerAttribute] = strconv.FormatFloat(*vc.row.LowerCI, 'f', -1, 64)
+				feature.Properties[ciUpperAttribute] = strconv.FormatFloat(*vc.row.UpperCI, 'f', -1, 64)
+			}
+			matched[featureID] = true
+		} else if reason, exists := missingReasons[featureID]; exists {
+			title = fmt.Sprintf("%v %s", title, reason)
+			matched[featureID] = true
 		} else {
 			title = fmt.Sprintf("%v %s", title, MissingDataText)
+			missingData = append(missingData, strings.TrimPrefix(fmt.Sprintf("%v", feature.ID), id+"-"))
+		}
+		if override, exists := regionStyles[normaliseFeatureID(feature.ID, id+"-", request.IDNormalisation)]; exists {
+			style += " " + override
 		}
 		feature.Properties[request.Geography.NameProperty] = title
 		appendProperty(feature, "style", style)
 	}
+	unmatched := []string{}
+	for _, row := range request.Data {
+		if !matched[id+"-"+request.IDNormalisation.Normalise(row.ID)] {
+			unmatched = append(unmatched, row.ID)
+		}
+	}
+	if len(unmatched) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d data rows do not match a region in the geography. IDs: %s", len(unmatched), summariseIDs(unmatched)))
+	}
+	if len(missingData) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d regions do not have data. IDs: %s", len(missingData), summariseIDs(missingData)))
+	}
+	return warnings
 }
 
-// mapDataToColour creates a map of DataRow.ID=valueAndColour
-func mapDataToColour(data []*models.DataRow, choropleth *models.Choropleth, prefix string) map[interface{}]valueAndColour {
-	breaks := sortBreaks(choropleth.Breaks, false)
+// maxWarningIDs is the maximum number of ids listed in a warning
+const maxWarningIDs = 10
+
+// summariseIDs returns the ids as a comma-separated list, truncated to maxWarningIDs
+func summariseIDs(ids []string) string {
+	if len(ids) <= maxWarningIDs {
+		return strings.Join(ids, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(ids[:maxWarningIDs], ", "), len(ids)-maxWarningIDs)
+}
 
+// mapDataToColour creates a map of DataRow.ID=valueAndColour, normalising the ID (after the prefix). Rows that are Missing are not included.
+// The breaks must be sorted by descending lower bound.
+func mapDataToColour(data []*models.DataRow, breaks []*models.ChoroplethBreak, prefix string, normalisation *models.IDNormalisation) map[interface{}]valueAndColour {
 	dataMap := make(map[interface{}]valueAndColour)
 	for _, row := range data {
-		dataMap[prefix+row.ID] = valueAndColour{value: row.Value, colour: getColour(row.Value, breaks)}
+		if row.Missing {
+			continue
+		}
+		i := breakIndex(row.Value, breaks)
+		dataMap[prefix+normalisation.Normalise(row.ID)] = valueAndColour{value: row.Value, colour: breaks[i].Colour, opacity: breaks[i].Opacity, class: len(breaks) - 1 - i, row: row}
 	}
 	return dataMap
 }
 
+// mapMissingReasons creates a map of DataRow.ID=the text shown in place of the value of a row that is Missing - its Reason, or MissingDataText if it has none -
+// normalising the ID (after the prefix) as mapDataToColour does
+func mapMissingReasons(data []*models.DataRow, prefix string, normalisation *models.IDNormalisation) map[interface{}]string {
+	reasons := make(map[interface{}]string)
+	for _, row := range data {
+		if !row.Missing {
+			continue
+		}
+		reason := row.Reason
+		if len(strings.TrimSpace(reason)) == 0 {
+			reason = MissingDataText
+		}
+		reasons[prefix+normalisation.Normalise(row.ID)] = reason
+	}
+	return reasons
+}
+
+// normaliseFeatureID normalises the part of the (prefixed) feature id after the prefix, so that it may be found in the map created by mapDataToColour
+func normaliseFeatureID(featureID interface{}, prefix string, normalisation *models.IDNormalisation) interface{} {
+	id, isString := featureID.(string)
+	if !isString || !normalisation.IsEnabled() || !strings.HasPrefix(id, prefix) {
+		return featureID
+	}
+	return prefix + normalisation.Normalise(strings.TrimPrefix(id, prefix))
+}
+
+// opacityStyle returns the style setting the given opacity property (e.g. "fill-opacity") to the opacity of a break, preceded by a space,
+// or empty if the break does not have an opacity
+func opacityStyle(property string, opacity *float64) string {
+	if opacity == nil {
+		return ""
+	}
+	return fmt.Sprintf(" %s: %g;", property, *opacity)
+}
+
 // getColour returns the colour for the given value. If the value is below the lowest lowerbound, returns the colour for the lowest.
 func getColour(value float64, breaks []*models.ChoroplethBreak) string {
-	for _, b := range breaks {
+	return breaks[breakIndex(value, breaks)].Colour
+}
+
+// breakIndex returns the index of the break of the given value within the breaks, which must be sorted by descending lower bound.
+// If the value is below the lowest lowerbound, returns the index of the lowest.
+func breakIndex(value float64, breaks []*models.ChoroplethBreak) int {
+	for i, b := range breaks {
 		if value >= b.LowerBound {
-			return b.Colour
+			return i
 		}
 	}
-	return breaks[len(breaks)-1].Colour
+	return len(breaks) - 1
 }
 
 // sortBreaks returns a copy of the breaks slice, sorted ascending or descending according to asc.
@@ -251,6 +602,7 @@ func sortBreaks(breaks []*models.ChoroplethBreak, asc bool) []*models.Choropleth
 
 // RenderHorizontalKey creates an SVG containing a horizontally-oriented key for the choropleth
 func RenderHorizontalKey(svgRequest *SVGRequest) string {
+	defer svgRequest.stats.addDrawTime(time.Now(), svgRequest.stats.ConvertDuration)
 
 	geoJSON := svgRequest.geoJSON
 	if geoJSON == nil {
@@ -270,42 +622,45 @@ func RenderHorizontalKey(svgRequest *SVGRequest) string {
 	fmt.Fprintf(content, "</defs>")
 
 	keyClass := getKeyClass(request, "horizontal")
-	vbHeight := 90.0
+	vbHeight := svgRequest.options.HorizontalKeyHeight
 	svgAttributes := fmt.Sprintf(`id="%s-legend-horizontal-svg" class="%s" viewBox="0 0 %.f %.f"`, id, keyClass, svgRequest.ViewBoxWidth, vbHeight)
 	if !svgRequest.responsiveSize {
 		svgAttributes += fmt.Sprintf(` width="%.f" height="%.f"`, svgRequest.ViewBoxWidth, vbHeight)
 	}
 
 	fmt.Fprintf(content, `<g id="%s-legend-horizontal-container">`, id)
-	writeHorizontalKeyTitle(request, svgRequest.ViewBoxWidth, content)
+	writeHorizontalKeyTitle(svgRequest, content)
 	fmt.Fprintf(content, `<g id="%s-legend-horizontal-key" transform="translate(%f, 20)">`, id, keyInfo.keyX)
 	left := 0.0
 	breaks := svgRequest.breaks
 	for i := 0; i < len(breaks); i++ {
 		width := breaks[i].RelativeSize * keyInfo.keyWidth
-		fmt.Fprintf(content, `<rect class="keyColour" height="8" width="%f" x="%f" style="stroke-width: 0.5; stroke: black; fill: %s;">`, width, left, breaks[i].Colour)
-		content.WriteString(`</rect>`)
+		writeHorizontalKeySwatch(content, request.Choropleth.KeySwatch, left, width, breaks[i])
 		writeHorizontalKeyTick(ticks, left, breaks[i].LowerBound)
 		left += width
 	}
 	writeHorizontalKeyTick(ticks, left, breaks[len(breaks)-1].UpperBound)
-	if len(request.Choropleth.ReferenceValueText) > 0 {
+	if len(referenceLine(request.Choropleth).Text) > 0 {
 		writeHorizontalKeyRefTick(ticks, keyInfo, svgRequest)
 	}
 	fmt.Fprint(content, ticks.String())
 
-	writeKeyMissingPattern(content, missingId, 0.0, 55.0, request.FontSize)
+	writeKeyMissingPattern(content, missingId, 0.0, 55.0, svgRequest)
 
 	content.WriteString(`</g></g>`)
 
-	if pngConverter == nil || request.IncludeFallbackPng == false {
-		return fmt.Sprintf("<svg %s>%s</svg>", svgAttributes, content)
+	var result string
+	if converter := svgRequest.converter(); converter == nil || !svgRequest.includeFallbackPng {
+		result = fmt.Sprintf("<svg %s>%s</svg>", svgAttributes, content)
+	} else {
+		result = converter.IncludeFallbackImage(svgAttributes, content.String(), svgRequest.ViewBoxWidth, vbHeight, svgRequest.keyAlt())
 	}
-	return pngConverter.IncludeFallbackImage(svgAttributes, content.String(), svgRequest.ViewBoxWidth, vbHeight)
+	return svgRequest.finishSVG(g2s.AddDocumentTitle(result, svgRequest.keyTitle("horizontal"), svgRequest.keyAlt()))
 }
 
 // RenderVerticalKey creates an SVG containing a vertically-oriented key for the choropleth
 func RenderVerticalKey(svgRequest *SVGRequest) string {
+	defer svgRequest.stats.addDrawTime(time.Now(), svgRequest.stats.ConvertDuration)
 
 	geoJSON := svgRequest.geoJSON
 	if geoJSON == nil {
@@ -316,7 +671,7 @@ func RenderVerticalKey(svgRequest *SVGRequest) string {
 
 	breaks := svgRequest.breaks
 
-	keyHeight := svgHeight * 0.8
+	keyHeight := svgHeight * svgRequest.options.VerticalKeyHeightFraction
 	keyWidth, offset := svgRequest.VerticalLegendWidth, svgRequest.verticalKeyOffset
 
 	id := idPrefix(request)
@@ -337,46 +692,71 @@ func RenderVerticalKey(svgRequest *SVGRequest) string {
 	}
 
 	fmt.Fprintf(content, `<g id="%s-legend-vertical-container">`, id)
-	writeVerticalLegendTitle(content, keyWidth, svgHeight, request)
-	fmt.Fprintf(content, `<g id="%s-legend-vertical-key" transform="translate(%f, %f)">`, id, (keyWidth+offset)/2, svgHeight*0.1)
+	writeVerticalLegendTitle(content, keyWidth, svgHeight, svgRequest)
+	fmt.Fprintf(content, `<g id="%s-legend-vertical-key" transform="translate(%f, %f)">`, id, (keyWidth+offset)/2, (svgHeight-keyHeight)/2)
 	position := 0.0
 	for i := 0; i < len(breaks); i++ {
 		height := breaks[i].RelativeSize * keyHeight
 		adjustedPosition := keyHeight - position
-		fmt.Fprintf(content, `<rect class="keyColour" height="%f" width="8" y="%f" style="stroke-width: 0.5; stroke: black; fill: %s;">`, height, adjustedPosition-height, breaks[i].Colour)
-		content.WriteString(`</rect>`)
+		writeVerticalKeySwatch(content, request.Choropleth.KeySwatch, adjustedPosition-height, height, breaks[i])
 		writeVerticalKeyTick(ticks, adjustedPosition, breaks[i].LowerBound)
 		position += height
 	}
 	writeVerticalKeyTick(ticks, keyHeight-position, breaks[len(breaks)-1].UpperBound)
-	if len(request.Choropleth.ReferenceValueText) > 0 {
-		writeVerticalKeyRefTick(ticks, keyHeight-(keyHeight*svgRequest.referencePos), request)
+	if len(referenceLine(request.Choropleth).Text) > 0 {
+		writeVerticalKeyRefTick(ticks, keyHeight-(keyHeight*svgRequest.referencePos), svgRequest)
 	}
 	fmt.Fprint(content, ticks.String())
 	content.WriteString(`</g>`)
 
-	xPos := (keyWidth - float64(htmlutil.GetApproximateTextWidth(MissingDataText, request.FontSize)+12)) / 2
-	writeKeyMissingPattern(content, missingId, xPos, svgHeight*0.95, request.FontSize)
+	xPos := (keyWidth - float64(svgRequest.textWidth(MissingDataText)+12)) / 2
+	writeKeyMissingPattern(content, missingId, xPos, svgHeight*0.95, svgRequest)
 
 	content.WriteString(`</g>`)
 
-	if pngConverter == nil || request.IncludeFallbackPng == false {
-		return fmt.Sprintf("<svg %s>%s</svg>", attributes, content)
+	var result string
+	if converter := svgRequest.converter(); converter == nil || !svgRequest.includeFallbackPng {
+		result = fmt.Sprintf("<svg %s>%s</svg>", attributes, content)
+	} else {
+		result = converter.IncludeFallbackImage(attributes, content.String(), keyWidth, svgHeight, svgRequest.keyAlt())
 	}
-	return pngConverter.IncludeFallbackImage(attributes, content.String(), keyWidth, svgHeight)
+	return svgRequest.finishSVG(g2s.AddDocumentTitle(result, svgRequest.keyTitle("vertical"), svgRequest.keyAlt()))
 }
 
-func writeVerticalLegendTitle(content *bytes.Buffer, keyWidth float64, svgHeight float64, request *models.RenderRequest) (int, error) {
+func writeVerticalLegendTitle(content *bytes.Buffer, keyWidth float64, svgHeight float64, svgRequest *SVGRequest) (int, error) {
+	request := svgRequest.request
 	text := request.Choropleth.ValuePrefix + " " + request.Choropleth.ValueSuffix
-	textLen := htmlutil.GetApproximateTextWidth(text, request.FontSize)
-	return fmt.Fprintf(content, `<text x="%f" y="%f" dy=".5em" style="text-anchor: middle;" class="keyText" textLength="%.f" lengthAdjust="spacingAndGlyphs">%s</text>`, keyWidth/2, svgHeight*0.05, textLen, text)
+	textLen := svgRequest.textWidth(text)
+	return fmt.Fprintf(content, `<text x="%f" y="%f" dy=".5em" style="text-anchor: middle;" class="keyText" textLength="%.f" lengthAdjust="spacingAndGlyphs">%s</text>`, keyWidth/2, svgHeight*0.05, textLen, htmlutil.EscapeText(text))
+}
+
+// finishSVG returns the svg with its numbers rounded if the renderer is deterministic, and minified if the request asks for minified svgs
+func (svgRequest *SVGRequest) finishSVG(svg string) string {
+	svg = svgRequest.stabilise(svg)
+	if !svgRequest.request.Minify {
+		return svg
+	}
+	return g2s.Minify(svg, minifyPrecision)
+}
+
+// stabilise returns the svg with its numbers rounded (see geojson2svg.RoundNumbers) if the renderer is deterministic, otherwise unchanged
+func (svgRequest *SVGRequest) stabilise(svg string) string {
+	if !svgRequest.options.Deterministic {
+		return svg
+	}
+	return g2s.RoundNumbers(svg, deterministicPrecision)
+}
+
+// textWidth returns the width of the text in the request's font family and size
+func (svgRequest *SVGRequest) textWidth(text string) float64 {
+	return htmlutil.GetTextWidth(text, svgRequest.request.FontFamily, svgRequest.fontSize())
 }
 
 // getKeyClass returns the class of the map key - with an additional class if both keys are rendered.
 func getKeyClass(request *models.RenderRequest, keyType string) string {
 	keyClass := "map_key_" + keyType
 	if hasVerticalLegend(request) && hasHorizontalLegend(request) {
-		keyClass = keyClass + " " + keyClass + "_both"
+		return htmlutil.JoinClasses(keyClass, keyClass+"_both")
 	}
 	return keyClass
 }
@@ -397,43 +777,46 @@ func hasHorizontalLegend(request *models.RenderRequest) bool {
 
 // getVerticalLegendWidth determines the approximate width required for the legend
 // it also returns an offset for the position of the key. I.e. the middle of the key should be positioned in the middle of the legend, plus the offset.
-func getVerticalLegendWidth(request *models.RenderRequest, breaks []*breakInfo) (float64, float64) {
-	missingWidth := htmlutil.GetApproximateTextWidth(MissingDataText, request.FontSize) + 12
-	titleWidth := htmlutil.GetApproximateTextWidth(request.Choropleth.ValuePrefix+" "+request.Choropleth.ValueSuffix, request.FontSize)
+func getVerticalLegendWidth(svgRequest *SVGRequest) (float64, float64) {
+	request := svgRequest.request
+	missingWidth := svgRequest.textWidth(MissingDataText) + 12
+	titleWidth := svgRequest.textWidth(request.Choropleth.ValuePrefix + " " + request.Choropleth.ValueSuffix)
 	maxWidth := math.Max(float64(missingWidth), float64(titleWidth))
-	keyWidth, offset := getVerticalTickTextWidth(request, breaks)
-	return math.Max(maxWidth, keyWidth) + 10, offset
+	keyWidth, offset := getVerticalTickTextWidth(svgRequest)
+	return math.Max(maxWidth, keyWidth) + svgRequest.options.LegendPadding, offset
 }
 
 // getVerticalTickTextWidth calculates the approximate total width of the ticks on both sides of the key, allowing 38 pixels for the colour bar
 // it also returns an offset for the position of the key. I.e. the middle of the key should be positioned in the middle of the legend, plus the offset.
-func getVerticalTickTextWidth(request *models.RenderRequest, breaks []*breakInfo) (float64, float64) {
+func getVerticalTickTextWidth(svgRequest *SVGRequest) (float64, float64) {
 	maxTick := 0.0
-	for _, b := range breaks {
-		lbound := htmlutil.GetApproximateTextWidth(fmt.Sprintf("%g", b.LowerBound), request.FontSize)
+	for _, b := range svgRequest.breaks {
+		lbound := svgRequest.textWidth(fmt.Sprintf("%g", b.LowerBound))
 		if lbound > maxTick {
 			maxTick = lbound
 		}
-		ubound := htmlutil.GetApproximateTextWidth(fmt.Sprintf("%g", b.UpperBound), request.FontSize)
+		ubound := svgRequest.textWidth(fmt.Sprintf("%g", b.UpperBound))
 		if ubound > maxTick {
 			maxTick = ubound
 		}
 	}
-	refTick := htmlutil.GetApproximateTextWidth(request.Choropleth.ReferenceValueText, request.FontSize)
-	refValue := htmlutil.GetApproximateTextWidth(fmt.Sprintf("%g", request.Choropleth.ReferenceValue), request.FontSize)
+	ref := referenceLine(svgRequest.request.Choropleth)
+	refTick := svgRequest.textWidth(ref.Text)
+	refValue := svgRequest.textWidth(fmt.Sprintf("%g", ref.Value))
 	refWidth := math.Max(refTick, refValue)
 	return maxTick + refWidth + 38.0, maxTick - refWidth
 }
 
 // writeHorizontalKeyTitle write the title above the key for a horizontal legend, ensuring that the text fits within the svg
-func writeHorizontalKeyTitle(request *models.RenderRequest, svgWidth float64, content *bytes.Buffer) {
+func writeHorizontalKeyTitle(svgRequest *SVGRequest, content *bytes.Buffer) {
+	request, svgWidth := svgRequest.request, svgRequest.ViewBoxWidth
 	textAdjust := ""
 	titleText := request.Choropleth.ValuePrefix + " " + request.Choropleth.ValueSuffix
-	titleTextLen := htmlutil.GetApproximateTextWidth(titleText, request.FontSize)
+	titleTextLen := svgRequest.textWidth(titleText)
 	if titleTextLen >= svgWidth {
 		textAdjust = fmt.Sprintf(` textLength="%.f" lengthAdjust="spacingAndGlyphs"`, svgWidth-2)
 	}
-	fmt.Fprintf(content, `<text x="%f" y="6" dy=".5em" style="text-anchor: middle;" class="keyText"%s>%s</text>`, svgWidth/2.0, textAdjust, titleText)
+	fmt.Fprintf(content, `<text x="%f" y="6" dy=".5em" style="text-anchor: middle;" class="keyText"%s>%s</text>`, svgWidth/2.0, textAdjust, htmlutil.EscapeText(titleText))
 }
 
 // writeHorizontalKeyTick draws a vertical line (the tick) at the given position, labelling it with the given value
@@ -462,31 +845,73 @@ func writeHorizontalKeyRefTick(w *bytes.Buffer, keyInfo *horizontalKeyInfo, svgR
 	if keyInfo.referenceTextLeftLen > xPos+keyInfo.keyX { // adjust the text length so it will fit
 		textAttr = fmt.Sprintf(` textLength="%.f" lengthAdjust="spacingAndGlyphs"`, xPos+keyInfo.keyX-1)
 	}
-	fmt.Fprintf(w, `<text x="0" y="33" dx="-0.1em" dy=".74em" style="text-anchor: end; fill: DimGrey;" class="keyText"%s>%s</text>`, textAttr, keyInfo.referenceTextLeft)
+	fmt.Fprintf(w, `<text x="0" y="33" dx="-0.1em" dy=".74em" style="text-anchor: end; fill: DimGrey;" class="keyText"%s>%s</text>`, textAttr, htmlutil.EscapeText(keyInfo.referenceTextLeft))
 	textAttr = ""
 	if keyInfo.referenceTextRightLen > svgWidth-(xPos+keyInfo.keyX) { // adjust the text length so it will fit
 		textAttr = fmt.Sprintf(` textLength="%.f" lengthAdjust="spacingAndGlyphs"`, svgWidth-(xPos+keyInfo.keyX)-2)
 	}
-	fmt.Fprintf(w, `<text x="0" y="33" dx="0.1em" dy=".74em" style="text-anchor: start; fill: DimGrey;" class="keyText"%s>%s</text>`, textAttr, keyInfo.referenceTextRight)
+	fmt.Fprintf(w, `<text x="0" y="33" dx="0.1em" dy=".74em" style="text-anchor: start; fill: DimGrey;" class="keyText"%s>%s</text>`, textAttr, htmlutil.EscapeText(keyInfo.referenceTextRight))
 	fmt.Fprintf(w, `</g>`)
 }
 
 // writeVerticalKeyRefTick draws a horizontal line at the correct position for the reference value, labelling it with the reference value and reference text.
-func writeVerticalKeyRefTick(w *bytes.Buffer, yPos float64, request *models.RenderRequest) {
-	text, value := request.Choropleth.ReferenceValueText, request.Choropleth.ReferenceValue
-	textLen := htmlutil.GetApproximateTextWidth(text, request.FontSize)
+func writeVerticalKeyRefTick(w *bytes.Buffer, yPos float64, svgRequest *SVGRequest) {
+	ref := referenceLine(svgRequest.request.Choropleth)
+	text, value := ref.Text, ref.Value
+	textLen := svgRequest.textWidth(text)
 	fmt.Fprintf(w, `<g class="map__tick" transform="translate(0, %f)">`, yPos)
 	w.WriteString(`<line x2="45" x1="8" style="stroke-width: 1; stroke: DimGrey;"></line>`)
-	fmt.Fprintf(w, `<text x="18" dy="-.32em" style="text-anchor: start; fill: DimGrey;" class="keyText" textLength="%.f" lengthAdjust="spacingAndGlyphs">%s</text>`, textLen, text)
+	fmt.Fprintf(w, `<text x="18" dy="-.32em" style="text-anchor: start; fill: DimGrey;" class="keyText" textLength="%.f" lengthAdjust="spacingAndGlyphs">%s</text>`, textLen, htmlutil.EscapeText(text))
 	fmt.Fprintf(w, `<text x="18" dy="1em" style="text-anchor: start; fill: DimGrey;" class="keyText">%g</text>`, value)
 	w.WriteString(`</g>`)
 }
 
-// writeKeyMissingPattern draws a square filled with the missing pattern at the given position, labelling it with MissingDataText
-func writeKeyMissingPattern(w *bytes.Buffer, id string, xPos float64, yPos float64, fontSize int) {
+// writeHorizontalKeySwatch draws the colour sample (with the opacity, if any) of a break in a horizontal key, from the left position across the given width.
+// Every shape of swatch (see Choropleth.KeySwatch) is centred on y=4, the middle of the 8 pixel high key, so the ticks mark its ends.
+func writeHorizontalKeySwatch(w *bytes.Buffer, swatch string, left float64, width float64, b *breakInfo) {
+	switch swatch {
+	case models.KeySwatchCircle:
+		fmt.Fprintf(w, `<circle class="keyColour" cx="%f" cy="4" r="%f" style="stroke-width: 0.5; stroke: black; fill: %s;%s"></circle>`, left+width/2, swatchRadius(width), b.Colour, opacityStyle("fill-opacity", b.Opacity))
+	case models.KeySwatchLine:
+		fmt.Fprintf(w, `<line class="keyColour" x1="%f" y1="4" x2="%f" y2="4" style="stroke-width: 4; stroke: %s;%s"></line>`, left, left+width, b.Colour, opacityStyle("stroke-opacity", b.Opacity))
+	default:
+		fmt.Fprintf(w, `<rect class="keyColour" height="8" width="%f" x="%f" style="stroke-width: 0.5; stroke: black; fill: %s;%s">`, width, left, b.Colour, opacityStyle("fill-opacity", b.Opacity))
+		w.WriteString(`</rect>`)
+	}
+}
+
+// writeVerticalKeySwatch draws the colour sample (with the opacity, if any) of a break in a vertical key, from the top position down the given height.
+// Every shape of swatch (see Choropleth.KeySwatch) is centred on x=4, the middle of the 8 pixel wide key, so the ticks mark its ends.
+func writeVerticalKeySwatch(w *bytes.Buffer, swatch string, top float64, height float64, b *breakInfo) {
+	switch swatch {
+	case models.KeySwatchCircle:
+		fmt.Fprintf(w, `<circle class="keyColour" cx="4" cy="%f" r="%f" style="stroke-width: 0.5; stroke: black; fill: %s;%s"></circle>`, top+height/2, swatchRadius(height), b.Colour, opacityStyle("fill-opacity", b.Opacity))
+	case models.KeySwatchLine:
+		fmt.Fprintf(w, `<line class="keyColour" x1="4" y1="%f" x2="4" y2="%f" style="stroke-width: 4; stroke: %s;%s"></line>`, top, top+height, b.Colour, opacityStyle("stroke-opacity", b.Opacity))
+	default:
+		fmt.Fprintf(w, `<rect class="keyColour" height="%f" width="8" y="%f" style="stroke-width: 0.5; stroke: black; fill: %s;%s">`, height, top, b.Colour, opacityStyle("fill-opacity", b.Opacity))
+		w.WriteString(`</rect>`)
+	}
+}
+
+// swatchRadius returns the radius of a circular swatch for a break of the given length - the half-height of the key, unless the break is too short
+func swatchRadius(length float64) float64 {
+	return math.Min(4, length/2)
+}
+
+// writeKeyMissingPattern draws a sample (of the request's KeySwatch shape, 8 pixels across) filled with the missing pattern at the given position,
+// labelling it with MissingDataText. The sample is centred on y=4, in line with the middle of the label.
+func writeKeyMissingPattern(w *bytes.Buffer, id string, xPos float64, yPos float64, svgRequest *SVGRequest) {
 	fmt.Fprintf(w, `<g class="missingPattern" transform="translate(%f, %f)">`, xPos, yPos)
-	fmt.Fprintf(w, `<rect class="keyColour" height="8" width="8" style="stroke-width: 0.8; stroke: black; fill: url(#%s-nodata);"></rect>`, id)
-	fmt.Fprintf(w, `<text x="12" dy=".55em" style="text-anchor: start; fill: DimGrey;" class="keyText" textLength="%.f" lengthAdjust="spacingAndGlyphs">%s</text>`, htmlutil.GetApproximateTextWidth(MissingDataText, fontSize), MissingDataText)
+	switch svgRequest.request.Choropleth.KeySwatch {
+	case models.KeySwatchCircle:
+		fmt.Fprintf(w, `<circle class="keyColour" cx="4" cy="4" r="4" style="stroke-width: 0.8; stroke: black; fill: url(#%s-nodata);"></circle>`, id)
+	case models.KeySwatchLine:
+		fmt.Fprintf(w, `<line class="keyColour" x1="0" y1="4" x2="8" y2="4" style="stroke-width: 4; stroke: url(#%s-nodata);"></line>`, id)
+	default:
+		fmt.Fprintf(w, `<rect class="keyColour" height="8" width="8" style="stroke-width: 0.8; stroke: black; fill: url(#%s-nodata);"></rect>`, id)
+	}
+	fmt.Fprintf(w, `<text x="12" dy=".55em" style="text-anchor: start; fill: DimGrey;" class="keyText" textLength="%.f" lengthAdjust="spacingAndGlyphs">%s</text>`, svgRequest.textWidth(MissingDataText), MissingDataText)
 	w.WriteString(`</g>`)
 }
 
@@ -496,40 +921,63 @@ type breakInfo struct {
 	UpperBound   float64
 	RelativeSize float64
 	Colour       string
+	Opacity      *float64
 }
 
 // getSortedBreakInfo returns information about the breaks - lowerBound, upperBound and relative size
 // where the lowerBound of the first break is the lowest of the LowerBound and the lowest value in data
 // and the upperBound of the last break is the maximum value in the data
-// also returns the relative position of the reference value
-func getSortedBreakInfo(request *models.RenderRequest) ([]*breakInfo, float64) {
-
-	data := make([]*models.DataRow, len(request.Data))
-	copy(data, request.Data)
-	sort.Slice(data, func(i, j int) bool { return data[i].Value < data[j].Value })
+// also returns the relative position of the reference value.
+// Uses the sorted breaks and data extremes of the svgRequest.
+func getSortedBreakInfo(svgRequest *SVGRequest) ([]*breakInfo, float64) {
+	request := svgRequest.request
 
-	breaks := sortBreaks(request.Choropleth.Breaks, true)
-	minValue := math.Min(data[0].Value, breaks[0].LowerBound)
+	breaks := svgRequest.ascendingBreaks
+	minValue := math.Min(svgRequest.dataMin, breaks[0].LowerBound)
 	maxValue := request.Choropleth.UpperBound
 	if maxValue < breaks[len(breaks)-1].LowerBound {
-		maxValue = data[len(data)-1].Value
+		maxValue = svgRequest.dataMax
 	}
 	totalRange := maxValue - minValue
 
 	breakCount := len(breaks)
 	info := make([]*breakInfo, breakCount)
 	for i := 0; i < breakCount-1; i++ {
-		info[i] = &breakInfo{LowerBound: breaks[i].LowerBound, UpperBound: breaks[i+1].LowerBound, Colour: breaks[i].Colour}
+		info[i] = &breakInfo{LowerBound: breaks[i].LowerBound, UpperBound: breaks[i+1].LowerBound, Colour: breaks[i].Colour, Opacity: breaks[i].Opacity}
 	}
 	info[0].LowerBound = minValue
-	info[breakCount-1] = &breakInfo{LowerBound: breaks[breakCount-1].LowerBound, UpperBound: maxValue, Colour: breaks[breakCount-1].Colour}
+	info[breakCount-1] = &breakInfo{LowerBound: breaks[breakCount-1].LowerBound, UpperBound: maxValue, Colour: breaks[breakCount-1].Colour, Opacity: breaks[breakCount-1].Opacity}
 	for _, b := range info {
 		b.RelativeSize = (b.UpperBound - b.LowerBound) / totalRange
 	}
-	referencePos := (request.Choropleth.ReferenceValue - minValue) / totalRange
+	referencePos := (referenceLine(request.Choropleth).Value - minValue) / totalRange
 	return info, referencePos
 }
 
+// dataExtremes returns the lowest and highest values in the data, or zero if there is no data
+func dataExtremes(data []*models.DataRow) (float64, float64) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, row := range data {
+		if !row.Missing {
+			min = math.Min(min, row.Value)
+			max = math.Max(max, row.Value)
+		}
+	}
+	if math.IsInf(min, 1) {
+		return 0, 0
+	}
+	return min, max
+}
+
+// referenceLine returns the reference line to draw in the legend - only the first of the choropleth's reference lines is drawn.
+// If there are none, an empty line (which is not drawn) is returned.
+func referenceLine(choropleth *models.Choropleth) *models.ReferenceLine {
+	if len(choropleth.ReferenceLines) == 0 || choropleth.ReferenceLines[0] == nil {
+		return &models.ReferenceLine{}
+	}
+	return choropleth.ReferenceLines[0]
+}
+
 // horizontalKeyInfo contains break info, the width of the key, the x position of the key, and reference tick values
 type horizontalKeyInfo struct {
 	referenceTextLeft     string
@@ -543,8 +991,7 @@ type horizontalKeyInfo struct {
 // getHorizontalKeyInfo returns the width of the key, the x position of the key, the breaks within the key, and reference tick values
 // (making sure that the longer of the reference value and text is given the most space)
 func getHorizontalKeyInfo(svgWidth float64, svgRequest *SVGRequest) *horizontalKeyInfo {
-	request := svgRequest.request
-	refInfo := getHorizontalRefTextInfo(request)
+	refInfo := getHorizontalRefTextInfo(svgRequest)
 	info := horizontalKeyInfo{}
 
 	// assume a default width of 90% of svg
@@ -553,8 +1000,8 @@ func getHorizontalKeyInfo(svgWidth float64, svgRequest *SVGRequest) *horizontalK
 
 	// half of the upper and lower bound text will sit outside the key
 	breaks := svgRequest.breaks
-	left := htmlutil.GetApproximateTextWidth(fmt.Sprintf("%g", breaks[0].LowerBound), request.FontSize) / 2
-	right := htmlutil.GetApproximateTextWidth(fmt.Sprintf("%g", breaks[len(breaks)-1].UpperBound), request.FontSize) / 2
+	left := svgRequest.textWidth(fmt.Sprintf("%g", breaks[0].LowerBound)) / 2
+	right := svgRequest.textWidth(fmt.Sprintf("%g", breaks[len(breaks)-1].UpperBound)) / 2
 
 	// the longer bit of reference text should sit on the side of the tick with the most space
 	info.referenceTextLeft = refInfo.referenceTextLong
@@ -593,20 +1040,21 @@ type horizontalRefTextInfo struct {
 }
 
 // getHorizontalRefTextInfo calculates the approximate width of the reference value and text, dividing them into short and long values.
-func getHorizontalRefTextInfo(request *models.RenderRequest) *horizontalRefTextInfo {
+func getHorizontalRefTextInfo(svgRequest *SVGRequest) *horizontalRefTextInfo {
 	info := horizontalRefTextInfo{}
-	refTextLen := htmlutil.GetApproximateTextWidth(request.Choropleth.ReferenceValueText, request.FontSize)
-	refValue := fmt.Sprintf("%g", request.Choropleth.ReferenceValue)
-	refValueLen := htmlutil.GetApproximateTextWidth(refValue, request.FontSize)
+	ref := referenceLine(svgRequest.request.Choropleth)
+	refTextLen := svgRequest.textWidth(ref.Text)
+	refValue := fmt.Sprintf("%g", ref.Value)
+	refValueLen := svgRequest.textWidth(refValue)
 	if refTextLen > refValueLen {
-		info.referenceTextLong = request.Choropleth.ReferenceValueText
+		info.referenceTextLong = ref.Text
 		info.referenceTextLongLen = refTextLen
 		info.referenceTextShort = refValue
 		info.referenceTextShortLen = refValueLen
 	} else {
 		info.referenceTextLong = refValue
 		info.referenceTextLongLen = refValueLen
-		info.referenceTextShort = request.Choropleth.ReferenceValueText
+		info.referenceTextShort = ref.Text
 		info.referenceTextShortLen = refTextLen
 	}
 	return &info
@@ -4,22 +4,38 @@ import (
 	"bytes"
 	"testing"
 
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"math"
 
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
 	"github.com/ONSdigital/dp-map-renderer/models"
+	"github.com/ONSdigital/dp-map-renderer/palette"
 	. "github.com/ONSdigital/dp-map-renderer/renderer"
 	"github.com/ONSdigital/dp-map-renderer/testdata"
+	"github.com/paulmach/go.geojson"
 	"github.com/rubenv/topojson"
 	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
 var pngConverter = geojson2svg.NewPNGConverter("sh", []string{"-c", `echo "test" >> ` + geojson2svg.ArgPNGFilename})
-var expectedFallbackImage = `<img alt="Fallback map image for older browsers" src="data:image/png;base64,dGVzdAo=" />`
+var expectedMapFallbackImage = `<img alt="` + exampleMapAlt + `" src="data:image/png;base64,dGVzdAo=" />`
+var expectedKeyFallbackImage = `<img alt="` + exampleKeyAlt + `" src="data:image/png;base64,dGVzdAo=" />`
+
+// the alt text of the png images of the map and key of the example request
+const (
+	exampleMapAlt = "Map: Non-UK born population, Great Britain, 2015, with values from 0 to 54"
+	exampleKeyAlt = "Map key: % non-UK born, from 0 to 54"
+)
 
 func TestRenderSVGWithFixedSize(t *testing.T) {
 
@@ -49,8 +65,8 @@ func TestRenderSVGWithResponsiveSize(t *testing.T) {
 			t.Fatal(err)
 		}
 		renderRequest.DefaultWidth = 0
-		renderRequest.MaxWidth = 300
-		renderRequest.MinWidth = 500
+		renderRequest.MaxWidth = 500
+		renderRequest.MinWidth = 300
 
 		result := RenderSVG(PrepareSVGRequest(renderRequest))
 
@@ -59,6 +75,24 @@ func TestRenderSVGWithResponsiveSize(t *testing.T) {
 	})
 }
 
+func TestRenderSVGWithInvertedWidths(t *testing.T) {
+
+	Convey("An svg map should have a fixed size when min width is greater than max width", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.DefaultWidth = 0
+		renderRequest.MaxWidth = 300
+		renderRequest.MinWidth = 500
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		So(result, ShouldStartWith, `<svg width="400" height="748" id="map-abcd1234-map-svg" viewBox="0 0 400 748">`)
+	})
+}
+
 func TestRenderSVGDoesNotIncludeFallbackPng(t *testing.T) {
 
 	Convey("Successfully render an svg map without fallback png", t, func() {
@@ -95,7 +129,7 @@ func TestRenderSVGIncludesFallbackPng(t *testing.T) {
 		So(result, ShouldNotBeNil)
 		So(result, ShouldStartWith, `<svg `)
 		So(result, ShouldContainSubstring, `<foreignObject>`)
-		So(result, ShouldContainSubstring, expectedFallbackImage)
+		So(result, ShouldContainSubstring, expectedMapFallbackImage)
 	})
 }
 
@@ -151,122 +185,1283 @@ func TestRenderSVGSucceedsWithNullValues(t *testing.T) {
 	})
 }
 
-func TestSVGIgnoresNilFeatureNames(t *testing.T) {
+func TestSVGIgnoresNilFeatureNames(t *testing.T) {
+
+	Convey("Rendered svg should not include 'nil' in the title when the topology doesn't have the name property", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Geography.NameProperty = "missing"
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		So(result, ShouldNotContainSubstring, "<nil>")
+		So(result, ShouldContainSubstring, "<title> 7% non-UK born")
+	})
+}
+
+func TestSVGHasWidthAndHeight(t *testing.T) {
+
+	Convey("simpleSVG should be given default width and proportional height", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:  "testname",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(svg.Width, ShouldEqual, "400")
+		So(svg.Height, ShouldEqual, "329")
+	})
+}
+
+func TestSVGContainsClassName(t *testing.T) {
+
+	Convey("simpleSVG should assign class to map regions", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:  "testname",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+		}
+		renderRequest.Geography.Topojson.Objects["simplegeojson"].Geometries[0].Properties["class"] = "foo"
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Class, ShouldEqual, RegionClassName+" foo")
+		So(svg.Paths[1].Class, ShouldEqual, RegionClassName)
+	})
+}
+
+func TestSVGContainsIDs(t *testing.T) {
+
+	Convey("simpleSVG should assign ids to map regions", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:  "testname",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].ID, ShouldEqual, "map-testname-f0")
+		So(svg.Paths[1].ID, ShouldEqual, "map-testname-f1")
+	})
+}
+
+func TestSVGContainsTitles(t *testing.T) {
+
+	Convey("simpleSVG should assign names as titles to map regions", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:  "testname",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		So(result, ShouldNotBeNil)
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1")
+	})
+}
+
+func TestSVGContainsChoroplethColours(t *testing.T) {
+
+	Convey("simpleSVG should use style to colour regions", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		So(result, ShouldNotBeNil)
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: red")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: green")
+	})
+}
+
+func TestSVGContainsChoroplethOpacity(t *testing.T) {
+
+	Convey("The opacity of a break should be applied to the regions of its class, and to its swatch in each key", t, func() {
+		opacity := 0.2
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red", Opacity: &opacity}, {LowerBound: 11, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+		}
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		svg, e := unmarshalSimpleSVG(RenderSVG(svgRequest))
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldEqual, "fill: red; fill-opacity: 0.2;")
+		So(svg.Paths[1].Style, ShouldEqual, "fill: green;")
+
+		horizontal := RenderHorizontalKey(svgRequest)
+		So(horizontal, ShouldContainSubstring, `style="stroke-width: 0.5; stroke: black; fill: red; fill-opacity: 0.2;">`)
+		So(horizontal, ShouldContainSubstring, `style="stroke-width: 0.5; stroke: black; fill: green;">`)
+		So(RenderVerticalKey(svgRequest), ShouldContainSubstring, `style="stroke-width: 0.5; stroke: black; fill: red; fill-opacity: 0.2;">`)
+		So(RenderHTMLKey(svgRequest, "horizontal"), ShouldContainSubstring, `style="background-color: red; opacity: 0.2;"`)
+
+		renderRequest.Choropleth.KeySwatch = models.KeySwatchLine
+		So(RenderHorizontalKey(PrepareSVGRequest(renderRequest)), ShouldContainSubstring, `style="stroke-width: 4; stroke: red; stroke-opacity: 0.2;">`)
+	})
+}
+
+func TestSVGContainsChoroplethColoursFromPalette(t *testing.T) {
+
+	Convey("simpleSVG should colour regions from the palette when the breaks do not have colours", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0}, {LowerBound: 11}}, Palette: &models.ChoroplethPalette{Name: "Blues", Reverse: true}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+		}
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		result := RenderSVG(svgRequest)
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: #3182bd")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: #deebf7")
+		So(RenderHorizontalKey(svgRequest), ShouldContainSubstring, "fill: #deebf7")
+	})
+}
+
+func TestSVGContainsChoroplethColoursFromAutomaticBreaks(t *testing.T) {
+
+	Convey("simpleSVG should colour regions using breaks computed from the data when the request has none", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+		}
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		result := RenderSVG(svgRequest)
+
+		So(renderRequest.Choropleth.Breaks, ShouldHaveLength, 2)
+		So(svgRequest.Warnings, ShouldContain, "No breaks were given - natural breaks were computed from the data, using the best fit 2 classes coloured with the Blues palette (lower bounds: 10, 20)")
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: #deebf7")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: #3182bd")
+		So(RenderHorizontalKey(svgRequest), ShouldContainSubstring, "fill: #3182bd")
+	})
+
+	Convey("The requested class count and palette should be used to compute the breaks", t, func() {
+
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.Breaks = nil
+		renderRequest.Choropleth.ClassCount = 4
+		renderRequest.Choropleth.Palette = &models.ChoroplethPalette{Name: "Greens"}
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		result := RenderSVG(svgRequest)
+
+		So(svgRequest.Stats().BreakCount, ShouldEqual, 4)
+		So(svgRequest.Warnings[0], ShouldStartWith, "No breaks were given - natural breaks were computed from the data, using the requested 4 classes coloured with the Greens palette")
+		colours, _ := palette.Get("Greens").Colours(4)
+		key := RenderVerticalKey(svgRequest)
+		for _, colour := range colours {
+			So(result, ShouldContainSubstring, "fill: "+colour)
+			So(key, ShouldContainSubstring, "fill: "+colour)
+		}
+	})
+
+	Convey("A request whose breaks cannot be computed should not be coloured, with a warning", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 10}},
+		}
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+
+		So(renderRequest.Choropleth.Breaks, ShouldBeEmpty)
+		So(svgRequest.Warnings[0], ShouldStartWith, "No breaks were given, and none could be computed from the data - the regions have not been coloured")
+	})
+
+	Convey("The breaks of a request with data sets should be computed from the values of all of them", t, func() {
+
+		first := []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 10}}
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{},
+			Data:       first,
+			DataSets:   []*models.DataSet{{Label: "2011", Data: first}, {Label: "2021", Data: []*models.DataRow{{ID: "f0", Value: 20}}}},
+		}
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+
+		So(renderRequest.Choropleth.Breaks, ShouldHaveLength, 2)
+		So(svgRequest.Warnings, ShouldContain, "No breaks were given - natural breaks were computed from the data, using the best fit 2 classes coloured with the Blues palette (lower bounds: 10, 20)")
+	})
+}
+
+func TestSVGRequestWarnings(t *testing.T) {
+
+	Convey("A request whose data and regions match should not have warnings", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+		}
+		svgRequest := PrepareSVGRequest(renderRequest)
+		RenderSVG(svgRequest)
+
+		So(svgRequest.Warnings, ShouldBeEmpty)
+	})
+
+	Convey("A request with unmatched data, regions without data and a reference value outside the legend should have warnings", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}, UpperBound: 30, ReferenceLines: []*models.ReferenceLine{{Value: 40, Text: "UK"}}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "x1", Value: 20}},
+		}
+		svgRequest := PrepareSVGRequest(renderRequest)
+		So(svgRequest.Warnings, ShouldResemble, []string{"The reference value 40 (UK) is outside the range of the legend (0 to 30)"})
+
+		RenderSVG(svgRequest)
+		So(svgRequest.Warnings, ShouldResemble, []string{
+			"The reference value 40 (UK) is outside the range of the legend (0 to 30)",
+			"1 data rows do not match a region in the geography. IDs: x1",
+			"1 regions do not have data. IDs: f1",
+		})
+	})
+
+	Convey("A request whose fallback png cannot be created should have a warning", t, func() {
+		failing := New(geojson2svg.NewPNGConverter("sh", []string{"-c", "exit 1"}), DefaultOptions())
+
+		renderRequest := &models.RenderRequest{
+			Filename:           "testname",
+			Geography:          &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			IncludeFallbackPng: true,
+		}
+		svgRequest := failing.PrepareSVGRequest(renderRequest)
+		RenderSVG(svgRequest)
+
+		So(svgRequest.Warnings, ShouldResemble, []string{"Unable to include a fallback png image in the svg"})
+	})
+}
+
+func TestSVGContainsDisplayValues(t *testing.T) {
+
+	newRequest := func() *models.RenderRequest {
+		return &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}, ValuePrefix: "£", ValueSuffix: "k"},
+			Data:       []*models.DataRow{{ID: "f0", Value: 3, DisplayValue: "fewer than 5"}, {ID: "f1", Value: 12}},
+		}
+	}
+
+	Convey("simpleSVG should show the display value of a row in place of its value, still colouring the region by its value", t, func() {
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(newRequest())))
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 £fewer than 5k")
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: red")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 £12k")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: green")
+	})
+
+	Convey("The display value should be shown without the prefix and suffix when display_value_only is set", t, func() {
+
+		renderRequest := newRequest()
+		renderRequest.Choropleth.DisplayValueOnly = true
+		lower, upper := 1.0, 4.0
+		renderRequest.Data[0].LowerCI, renderRequest.Data[0].UpperCI = &lower, &upper
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 fewer than 5 (1–4)")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 £12k")
+	})
+}
+
+func TestSVGContainsFootnoteMarkers(t *testing.T) {
+
+	Convey("simpleSVG should append a marker for each footnote of a data row to the title of its region", t, func() {
+
+		lower, upper := 10.1, 14.5
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}, ValueSuffix: "%"},
+			Data:       []*models.DataRow{{ID: "f0", Value: 12, FootnoteRefs: []int{2}}, {ID: "f1", Value: 20, LowerCI: &lower, UpperCI: &upper, FootnoteRefs: []int{1, 2}}},
+			Footnotes:  []string{"Boundary changed in 2021", "Provisional"},
+		}
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 12% [2]")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 20% (10.1–14.5) [1] [2]")
+	})
+}
+
+func TestSVGContainsChange(t *testing.T) {
+
+	newRequest := func() *models.RenderRequest {
+		return &models.RenderRequest{
+			Filename:    "testname",
+			Geography:   &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth:  &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: -100, Colour: "red"}, {LowerBound: 0, Colour: "green"}}, ValueSuffix: "%"},
+			Data:        []*models.DataRow{{ID: "f0", Value: 14.1}, {ID: "f1", Value: 20}},
+			CompareData: []*models.DataRow{{ID: "f0", Value: 10.2}, {ID: "f1", Value: 22.5}},
+			Change:      &models.Change{Label: "2021", CompareLabel: "2011"},
+		}
+	}
+
+	Convey("simpleSVG should colour regions by the change from the compare data, showing both values and the change in their titles", t, func() {
+
+		svgRequest := PrepareSVGRequest(newRequest())
+		svg, e := unmarshalSimpleSVG(RenderSVG(svgRequest))
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 2011: 10.2%, 2021: 14.1%, +3.9%")
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: green")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 2011: 22.5%, 2021: 20%, -2.5%")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: red")
+		So(svgRequest.Warnings, ShouldBeEmpty)
+	})
+
+	Convey("The change should be shown in percentage points for the percentage_point mode", t, func() {
+
+		renderRequest := newRequest()
+		renderRequest.Change.Mode = models.ChangeModePercentagePoint
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 2011: 10.2%, 2021: 14.1%, +3.9pp")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 2011: 22.5%, 2021: 20%, -2.5pp")
+	})
+
+	Convey("Regions with data in only one of the data sets should be shown without data, with a warning", t, func() {
+
+		renderRequest := newRequest()
+		renderRequest.Change = nil
+		renderRequest.CompareData = []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f2", Value: 5}}
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		svg, e := unmarshalSimpleSVG(RenderSVG(svgRequest))
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 Previous: 10%, Current: 14.1%, +4.1%")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 "+MissingDataText)
+		So(svgRequest.Warnings, ShouldContain, "2 data rows are not in both the data and the compare data, so their regions are shown without data. IDs: f1, f2")
+	})
+}
+
+func TestSVGContainsMissingRowsWithReasons(t *testing.T) {
+
+	newRequest := func(data ...*models.DataRow) *models.RenderRequest {
+		return &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:       data,
+		}
+	}
+
+	Convey("A region whose row is missing with a reason should have the missing data fill, with the reason in its title", t, func() {
+		svgRequest := PrepareSVGRequest(newRequest(&models.DataRow{ID: "f0", Missing: true, Reason: "data suppressed"}, &models.DataRow{ID: "f1", Value: 20}))
+		svg, e := unmarshalSimpleSVG(RenderSVG(svgRequest))
+
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 data suppressed")
+		So(svg.Paths[0].Style, ShouldEqual, "fill: url(#map-testname-nodata);")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 20")
+		So(svgRequest.Warnings, ShouldBeEmpty)
+		So(RenderHTMLKey(svgRequest, "horizontal"), ShouldContainSubstring, MissingDataText)
+	})
+
+	Convey("A region without a row should still have the generic missing data text, as should a missing row without a reason", t, func() {
+		svgRequest := PrepareSVGRequest(newRequest(&models.DataRow{ID: "f1", Value: 20}))
+		svg, e := unmarshalSimpleSVG(RenderSVG(svgRequest))
+
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 "+MissingDataText)
+		So(svgRequest.Warnings, ShouldResemble, []string{"1 regions do not have data. IDs: f0"})
+
+		svg, e = unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(newRequest(&models.DataRow{ID: "f0", Missing: true}, &models.DataRow{ID: "f1", Value: 20}))))
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 "+MissingDataText)
+	})
+
+	Convey("The value of a missing row should not be used to compute breaks", t, func() {
+		renderRequest := newRequest(&models.DataRow{ID: "f0", Missing: true, Reason: "data suppressed", Value: 1000}, &models.DataRow{ID: "f1", Value: 20}, &models.DataRow{ID: "x1", Value: 10})
+		renderRequest.Choropleth.Breaks = nil
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		svg, e := unmarshalSimpleSVG(RenderSVG(svgRequest))
+
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 data suppressed")
+		So(svgRequest.Warnings[0], ShouldStartWith, "No breaks were given")
+		So(svgRequest.Warnings[0], ShouldNotContainSubstring, "1000")
+	})
+}
+
+func TestSVGContainsConfidenceIntervals(t *testing.T) {
+
+	lower, upper := 10.1, 14.5
+	newRequest := func() *models.RenderRequest {
+		return &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}, ValueSuffix: "%"},
+			Data:       []*models.DataRow{{ID: "f0", Value: 12.3, LowerCI: &lower, UpperCI: &upper}, {ID: "f1", Value: 20}},
+		}
+	}
+
+	Convey("simpleSVG should append the confidence interval to the title of regions that have one", t, func() {
+
+		result := RenderSVG(PrepareSVGRequest(newRequest()))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 12.3% (10.1–14.5)")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 20%")
+		So(svg.Paths[0].CILower, ShouldBeEmpty)
+		So(svg.Paths[0].CIUpper, ShouldBeEmpty)
+	})
+
+	Convey("The confidence interval should follow the value prefix and suffix", t, func() {
+
+		renderRequest := newRequest()
+		renderRequest.Choropleth.ValuePrefix = "£"
+		renderRequest.Choropleth.ValueSuffix = "k"
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 £12.3k (10.1–14.5)")
+	})
+
+	Convey("simpleSVG should add the confidence interval as attributes when requested", t, func() {
+
+		renderRequest := newRequest()
+		renderRequest.IncludeCIAttributes = true
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(svg.Paths[0].CILower, ShouldEqual, "10.1")
+		So(svg.Paths[0].CIUpper, ShouldEqual, "14.5")
+		So(svg.Paths[1].CILower, ShouldBeEmpty)
+		So(svg.Paths[1].CIUpper, ShouldBeEmpty)
+	})
+}
+
+func TestSVGContainsChoroplethColoursForNumericIDs(t *testing.T) {
+
+	Convey("simpleSVG should colour and title regions whose id property is numeric", t, func() {
+
+		topology := simpleTopology()
+		topology.Objects["simplegeojson"].Geometries[0].Properties["code"] = 101.0
+		topology.Objects["simplegeojson"].Geometries[1].Properties["code"] = 2000000.0
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: topology, IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "101", Value: 10}, {ID: "2000000", Value: 20}},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].ID, ShouldEqual, "map-testname-101")
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: red")
+		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0 10")
+		So(svg.Paths[1].ID, ShouldEqual, "map-testname-2000000")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: green")
+		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1 20")
+	})
+
+	Convey("simpleSVG should colour regions whose geojson feature id is numeric", t, func() {
+
+		fc := toGeoJSON(t, simpleTopology())
+		for i, f := range fc.Features {
+			delete(f.Properties, "code")
+			f.ID = float64(i + 1)
+		}
+		renderRequest := &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Geojson: fc, IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "1", Value: 10}, {ID: "2", Value: 20}},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].ID, ShouldEqual, "map-testname-1")
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: red")
+		So(svg.Paths[1].ID, ShouldEqual, "map-testname-2")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: green")
+	})
+}
+
+func TestSVGContainsChoroplethColoursForNormalisedIDs(t *testing.T) {
+
+	Convey("simpleSVG should colour regions whose ids only match the data after normalisation", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:        "testname",
+			Geography:       &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth:      &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:            []*models.DataRow{{ID: " F0", Value: 10}, {ID: "f1", Value: 20}},
+			IDNormalisation: &models.IDNormalisation{Trim: true, CaseInsensitive: true},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: red")
+		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: green")
+		So(svg.Paths[0].ID, ShouldEqual, "map-testname-f0")
+	})
+}
+
+func TestSVGAppliesRegionStyles(t *testing.T) {
+
+	Convey("simpleSVG should apply a region style after the choropleth colour of a matched region", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:     "testname",
+			Geography:    &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth:   &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:         []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+			RegionStyles: map[string]string{"f0": "fill: url(#map-testname-nodata); STROKE: #000;stroke-width: 2px"},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldEqual, "fill: red; fill: url(#map-testname-nodata); stroke: #000; stroke-width: 2px;")
+		So(svg.Paths[1].Style, ShouldEqual, "fill: green;")
+	})
+
+	Convey("simpleSVG should apply a region style to a region without data", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:        "testname",
+			Geography:       &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth:      &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:            []*models.DataRow{{ID: "f0", Value: 10}},
+			RegionStyles:    map[string]string{"F1 ": "opacity: 0.5", "unknown": "fill: blue"},
+			IDNormalisation: &models.IDNormalisation{Trim: true, CaseInsensitive: true},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldEqual, "fill: red;")
+		So(svg.Paths[1].Style, ShouldEqual, "fill: url(#map-testname-nodata); opacity: 0.5;")
+	})
+
+	Convey("simpleSVG should ignore region style declarations that are not allowed", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:     "testname",
+			Geography:    &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth:   &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
+			Data:         []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+			RegionStyles: map[string]string{"f0": `fill: url(http://example.com/x.svg#p); display: none; stroke: red" onload="alert(1); fill-opacity: 0.2`, "f1": "background: expression(alert(1))"},
+		}
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+
+		So(result, ShouldNotContainSubstring, "example.com")
+		So(result, ShouldNotContainSubstring, "alert")
+		So(result, ShouldNotContainSubstring, "display")
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].Style, ShouldEqual, "fill: red; fill-opacity: 0.2;")
+		So(svg.Paths[1].Style, ShouldEqual, "fill: green;")
+	})
+}
+
+func TestSVGContainsScaleBar(t *testing.T) {
+
+	// a region 4 degrees of longitude wide and 0.2 degrees high, centred on the given latitude - so the map is about 100 pixels per degree of longitude
+	render := func(latitude float64, showScaleBar bool) string {
+		fc := geojson.NewFeatureCollection()
+		fc.AddFeature(geojson.NewPolygonFeature([][][]float64{{{-2, latitude - 0.1}, {2, latitude - 0.1}, {2, latitude + 0.1}, {-2, latitude + 0.1}, {-2, latitude - 0.1}}}))
+		renderRequest := &models.RenderRequest{
+			Filename:     "testname",
+			Geography:    &models.Geography{Geojson: fc, IDProperty: "code"},
+			DefaultWidth: 400,
+			FontSize:     12,
+			ShowScaleBar: showScaleBar,
+		}
+		return RenderSVG(PrepareSVGRequest(renderRequest))
+	}
+	scaleBar := regexp.MustCompile(`<g id="map-testname-map-scalebar" class="mapScaleBar" transform="translate\(10.000000, ([\d.]+)\)"><line x1="0" y1="0" x2="([\d.]+)" y2="0"`)
+	label := regexp.MustCompile(`class="mapScaleBarText">([^<]*)</text>`)
+	// the ground distance of a degree of longitude at the latitude
+	kmPerDegree := func(latitude float64) float64 {
+		return 6371 * math.Pi / 180 * math.Cos(latitude*math.Pi/180)
+	}
+	// the width of a degree of longitude in the svg, measured from the bottom edge of the region
+	pixelsPerDegree := func(svg string) float64 {
+		m := regexp.MustCompile(`<path d="M0.000000 [\d.]+,([\d.]+) `).FindStringSubmatch(svg)
+		So(m, ShouldNotBeNil)
+		width, _ := strconv.ParseFloat(m[1], 64)
+		return width / 4
+	}
+
+	Convey("The map should not have a scale bar by default", t, func() {
+		So(render(51, false), ShouldNotContainSubstring, "mapScaleBar")
+	})
+
+	Convey("The scale bar should be the largest round distance no more than 30% of the width of the map, drawn to scale in the bottom left corner", t, func() {
+		// the map is about 280 km wide, so the bar can be no more than 84 km
+		result := render(51, true)
+		m := scaleBar.FindStringSubmatch(result)
+		So(m, ShouldNotBeNil)
+		So(label.FindStringSubmatch(result)[1], ShouldEqual, "50 km")
+		length, _ := strconv.ParseFloat(m[2], 64)
+		So(length, ShouldAlmostEqual, 50/kmPerDegree(51)*pixelsPerDegree(result), 0.01)
+		So(length, ShouldBeBetween, 400*0.15, 400*0.3)
+		So(result, ShouldContainSubstring, fmt.Sprintf(`<line x1="%f" y1="-5" x2="%f" y2="0"`, length, length))
+	})
+
+	Convey("The scale bar should allow for the Mercator projection stretching the map further from the equator", t, func() {
+		// the map is about 200 km wide, so the same 50 km bar is longer than at 51 degrees
+		result := render(63, true)
+		m := scaleBar.FindStringSubmatch(result)
+		So(m, ShouldNotBeNil)
+		So(label.FindStringSubmatch(result)[1], ShouldEqual, "50 km")
+		length, _ := strconv.ParseFloat(m[2], 64)
+		So(length, ShouldAlmostEqual, 50/kmPerDegree(63)*pixelsPerDegree(result), 0.01)
+
+		// at 75 degrees the map is about 115 km wide, so the bar is 20 km
+		result = render(75, true)
+		m = scaleBar.FindStringSubmatch(result)
+		So(m, ShouldNotBeNil)
+		So(label.FindStringSubmatch(result)[1], ShouldEqual, "20 km")
+		length, _ = strconv.ParseFloat(m[2], 64)
+		So(length, ShouldAlmostEqual, 20/kmPerDegree(75)*pixelsPerDegree(result), 0.01)
+	})
+}
+
+func TestSVGContainsGraticule(t *testing.T) {
+
+	// a region from 2 degrees west to 2 degrees east, and 50 to 52 degrees north
+	prepare := func(graticule *models.Graticule) *SVGRequest {
+		fc := geojson.NewFeatureCollection()
+		fc.AddFeature(geojson.NewPolygonFeature([][][]float64{{{-2, 50}, {2, 50}, {2, 52}, {-2, 52}, {-2, 50}}}))
+		renderRequest := &models.RenderRequest{
+			Filename:  "testname",
+			Geography: &models.Geography{Geojson: fc, IDProperty: "code"},
+			Graticule: graticule,
+		}
+		return PrepareSVGRequest(renderRequest)
+	}
+	paths := regexp.MustCompile(`<path class="grid faint" d="M([^"]*)"></path>`)
+
+	Convey("The map should not have a graticule by default", t, func() {
+		So(RenderSVG(prepare(nil)), ShouldNotContainSubstring, "mapGraticule")
+	})
+
+	Convey("The graticule should have a line for each interval of longitude and latitude across the map, beneath the regions", t, func() {
+		svgRequest := prepare(&models.Graticule{IntervalDegrees: 1, Class: "grid faint"})
+		result := RenderSVG(svgRequest)
+
+		group := strings.Index(result, `<g id="map-testname-map-graticule" class="mapGraticule"`)
+		So(group, ShouldBeGreaterThan, 0)
+		So(group, ShouldBeLessThan, strings.Index(result, `class="mapRegion"`))
+
+		lines := paths.FindAllStringSubmatch(result, -1)
+		So(len(lines), ShouldEqual, 5+3) // longitudes -2 to 2, latitudes 50 to 52
+		for _, meridian := range lines[:5] {
+			So(strings.Count(meridian[1], ","), ShouldEqual, 1)
+		}
+		for _, parallel := range lines[5:] {
+			So(strings.Count(parallel[1], ","), ShouldEqual, 40) // sampled 10 times per degree
+		}
+		// the meridians span the height of the map, and the parallels its width
+		point := func(line string, i int) []float64 {
+			points := strings.Split(line, ",")
+			if i < 0 {
+				i += len(points)
+			}
+			var x, y float64
+			fmt.Sscanf(points[i], "%f %f", &x, &y)
+			return []float64{x, y}
+		}
+		So(point(lines[0][1], 0)[1], ShouldAlmostEqual, svgRequest.ViewBoxHeight, 1)
+		So(point(lines[0][1], -1)[1], ShouldAlmostEqual, 0, 0.01)
+		So(point(lines[5][1], 0)[0], ShouldAlmostEqual, 0, 0.01)
+		So(point(lines[5][1], -1)[0], ShouldAlmostEqual, svgRequest.ViewBoxWidth, 0.01)
+	})
+
+	Convey("The graticule should be omitted, with a warning, if it would have too many lines", t, func() {
+		svgRequest := prepare(&models.Graticule{IntervalDegrees: 0.01})
+		result := RenderSVG(svgRequest)
+
+		So(result, ShouldNotContainSubstring, "mapGraticule")
+		So(svgRequest.Warnings, ShouldResemble, []string{"The graticule has been omitted as it would have more than 100 lines of latitude or longitude - the interval of 0.01 degrees is too small for the map"})
+	})
+}
+
+func TestSVGContainsOverlayGeography(t *testing.T) {
+
+	prepare := func(overlay *models.Geography) *SVGRequest {
+		renderRequest := &models.RenderRequest{
+			Filename:         "testname",
+			Geography:        &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			OverlayGeography: overlay,
+		}
+		return PrepareSVGRequest(renderRequest)
+	}
+
+	Convey("The map should not have an overlay by default", t, func() {
+		So(RenderSVG(prepare(nil)), ShouldNotContainSubstring, OverlayClassName)
+	})
+
+	Convey("The features of the overlay geography should be drawn as outlines on top of the regions, without changing the size of the map", t, func() {
+		fc := geojson.NewFeatureCollection()
+		fc.AddFeature(geojson.NewPolygonFeature([][][]float64{{{47, 9}, {48, 9}, {48, 10}, {47, 10}, {47, 9}}}))
+		fc.Features[0].Properties["name"] = "overlay"
+		svgRequest := prepare(&models.Geography{Geojson: fc})
+		expected := prepare(nil)
+		result := RenderSVG(svgRequest)
+
+		So(svgRequest.ViewBoxWidth, ShouldEqual, expected.ViewBoxWidth)
+		So(svgRequest.ViewBoxHeight, ShouldEqual, expected.ViewBoxHeight)
+		overlay := strings.Index(result, `Z" class="mapOverlay" style="fill: none; stroke: #323132; stroke-width: 1.5;"/>`)
+		So(overlay, ShouldBeGreaterThan, strings.LastIndex(result, `class="mapRegion"`))
+		So(strings.Count(result, `class="mapOverlay"`), ShouldEqual, 1)
+		So(result, ShouldNotContainSubstring, "<title>overlay</title>")
+	})
+
+	Convey("An overlay geography supplied as topojson should be converted in the same way as the geography", t, func() {
+		result := RenderSVG(prepare(&models.Geography{Topojson: simpleTopology()}))
+
+		So(strings.Count(result, `class="mapOverlay"`), ShouldEqual, 2)
+	})
+}
+
+func TestSVGContainsFocusRegion(t *testing.T) {
+
+	prepare := func(focusRegionID string) *SVGRequest {
+		renderRequest := &models.RenderRequest{
+			Filename:      "testname",
+			Geography:     &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			FocusRegionID: focusRegionID,
+		}
+		return PrepareSVGRequest(renderRequest)
+	}
+
+	Convey("The svg should name the path of the focus region, which should have its bounding box as data attributes", t, func() {
+		svgRequest := prepare("f1")
+		result := RenderSVG(svgRequest)
+
+		So(result, ShouldContainSubstring, ` data-focus-region="map-testname-f1" id="map-testname-map-svg"`)
+		// feature 1 fills the map, which may be slightly less tall than the view box
+		focus := regexp.MustCompile(`class="mapRegion" data-focus-height="([^"]*)" data-focus-width="400.00" data-focus-x="0.00" data-focus-y="0.00" id="map-testname-f1"`).FindStringSubmatch(result)
+		So(focus, ShouldHaveLength, 2)
+		height, _ := strconv.ParseFloat(focus[1], 64)
+		So(height, ShouldAlmostEqual, svgRequest.ViewBoxHeight, 1)
+		So(strings.Count(result, "data-focus-x"), ShouldEqual, 1)
+		So(svgRequest.Warnings, ShouldBeEmpty)
+	})
+
+	Convey("A focus region that is not in the geography should be ignored, with a warning", t, func() {
+		svgRequest := prepare("unknown")
+		result := RenderSVG(svgRequest)
+
+		So(result, ShouldNotContainSubstring, "data-focus")
+		So(svgRequest.Warnings, ShouldResemble, []string{`The focus region "unknown" is not in the geography - the map will not be centred on it`})
+	})
+
+	Convey("The map should not have a focus region by default", t, func() {
+		So(RenderSVG(prepare("")), ShouldNotContainSubstring, "data-focus")
+	})
+}
+
+func TestSVGContainsNorthArrow(t *testing.T) {
+
+	render := func(corner string, showScaleBar bool) (string, *SVGRequest) {
+		renderRequest := &models.RenderRequest{
+			Filename:     "testname",
+			Geography:    &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			FontSize:     12,
+			NorthArrow:   corner,
+			ShowScaleBar: showScaleBar,
+		}
+		svgRequest := PrepareSVGRequest(renderRequest)
+		return RenderSVG(svgRequest), svgRequest
+	}
+	use := regexp.MustCompile(`<use href="#map-testname-map-north-arrow" x="([\d.]+)" y="([\d.]+)" width="20" height="30"></use>`)
+
+	Convey("The map should not have a north arrow by default", t, func() {
+		result, _ := render("", false)
+		So(result, ShouldNotContainSubstring, "north-arrow")
+	})
+
+	Convey("The north arrow should be a symbol in the defs, drawn 10 pixels inside the requested corner of the viewBox", t, func() {
+		for _, corner := range []string{models.CornerTopLeft, models.CornerTopRight, models.CornerBottomLeft, models.CornerBottomRight} {
+			result, svgRequest := render(corner, false)
+			So(strings.Count(result, `<symbol id="map-testname-map-north-arrow"`), ShouldEqual, 1)
+			symbol := strings.Index(result, fmt.Sprintf(geojson2svg.NorthArrowSymbol, "map-testname-map-north-arrow"))
+			So(symbol, ShouldBeBetween, strings.Index(result, "<defs>"), strings.Index(result, "</defs>"))
+			m := use.FindStringSubmatch(result)
+			So(m, ShouldNotBeNil)
+			position := parseFloats([][]string{{"", m[1]}, {"", m[2]}})
+
+			expected := []float64{10, 10}
+			if strings.HasSuffix(corner, "right") {
+				expected[0] = svgRequest.ViewBoxWidth - 10 - 20
+			}
+			if strings.HasPrefix(corner, "bottom") {
+				expected[1] = svgRequest.ViewBoxHeight - 10 - 30
+			}
+			So(position, ShouldResemble, expected)
+		}
+	})
+
+	Convey("In the bottom left corner, the north arrow should be drawn above the scale bar and its label", t, func() {
+		result, svgRequest := render(models.CornerBottomLeft, true)
+		m := use.FindStringSubmatch(result)
+		So(m, ShouldNotBeNil)
+		y, _ := strconv.ParseFloat(m[2], 64)
+		So(y+30, ShouldBeLessThanOrEqualTo, svgRequest.ViewBoxHeight-10-8-12)
+		So(result, ShouldContainSubstring, "mapScaleBar")
+	})
+}
+
+func TestSVGContainsAnnotations(t *testing.T) {
+
+	// annotations at the top left, centre and bottom right of the simple topology's bounding box
+	annotations := func() []*models.Annotation {
+		return []*models.Annotation{
+			{Longitude: 47.128000259399414, Latitude: 9.532394934735397, Label: "Top <left>", Class: "site"},
+			{Longitude: 47.13034987449646, Latitude: 9.530490399249758},
+			{Longitude: 47.132699489593506, Latitude: 9.52858586376412, Label: "Bottom right", Class: `big "quoted" site`},
+		}
+	}
+
+	Convey("simpleSVG should draw annotations at their projected positions, on top of the regions", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:    "testname",
+			Geography:   &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Annotations: annotations(),
+			FontSize:    14,
+		}
+		svgRequest := PrepareSVGRequest(renderRequest)
+		result := RenderSVG(svgRequest)
+
+		svg, e := unmarshalAnnotatedSVG(result)
+		So(e, ShouldBeNil)
+		So(svg.Annotations.ID, ShouldEqual, "map-testname-map-annotations")
+		markers := svg.Annotations.Markers
+		So(len(markers), ShouldEqual, 3)
+		So(markers[0].Class, ShouldEqual, "mapAnnotation site")
+		So(markers[0].Circle.CX, ShouldAlmostEqual, 0, 0.01)
+		So(markers[0].Circle.CY, ShouldAlmostEqual, 0, 0.01)
+		So(markers[0].Text.Value, ShouldEqual, "Top <left>")
+		So(markers[0].Text.X, ShouldAlmostEqual, 5, 0.01)
+		So(markers[0].Text.Y, ShouldAlmostEqual, -5, 0.01)
+		So(markers[1].Class, ShouldEqual, "mapAnnotation")
+		So(markers[1].Circle.CX, ShouldAlmostEqual, svgRequest.ViewBoxWidth/2, 1)
+		So(markers[1].Circle.CY, ShouldAlmostEqual, svgRequest.ViewBoxHeight/2, 1)
+		So(markers[1].Text, ShouldBeNil)
+		So(markers[2].Circle.CX, ShouldAlmostEqual, svgRequest.ViewBoxWidth, 1)
+		So(markers[2].Circle.CY, ShouldAlmostEqual, svgRequest.ViewBoxHeight, 1)
+		So(markers[2].Class, ShouldEqual, "mapAnnotation big _quoted_ site")
+
+		So(result, ShouldContainSubstring, "Top &lt;left&gt;")
+		So(strings.Index(result, `<g id="map-testname-map-annotations">`), ShouldBeGreaterThan, strings.LastIndex(result, "<path"))
+	})
+
+	Convey("Annotations should not affect the bounds of the map unless requested", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:    "testname",
+			Geography:   &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Annotations: []*models.Annotation{{Longitude: 47.1374, Latitude: 9.52858586376412, Label: "Outside"}},
+		}
+		svgRequest := PrepareSVGRequest(renderRequest)
+		svg, e := unmarshalAnnotatedSVG(RenderSVG(svgRequest))
+		So(e, ShouldBeNil)
+		So(svg.Annotations.Markers[0].Circle.CX, ShouldBeGreaterThan, svgRequest.ViewBoxWidth)
+
+		renderRequest.Geography.Topojson = simpleTopology()
+		renderRequest.AnnotationsInBounds = true
+		svgRequest = PrepareSVGRequest(renderRequest)
+		svg, e = unmarshalAnnotatedSVG(RenderSVG(svgRequest))
+		So(e, ShouldBeNil)
+		So(svg.Annotations.Markers[0].Circle.CX, ShouldAlmostEqual, svgRequest.ViewBoxWidth, 1)
+		So(svg.Annotations.Markers[0].Circle.CY, ShouldAlmostEqual, svgRequest.ViewBoxHeight, 1)
+	})
+
+	Convey("Annotations should be included in the fallback png", t, func() {
+		converter := &recordingPNGConverter{}
+		recording := New(converter, DefaultOptions())
+
+		renderRequest := &models.RenderRequest{
+			Filename:           "testname",
+			Geography:          &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Annotations:        annotations(),
+			IncludeFallbackPng: true,
+		}
+		RenderSVG(recording.PrepareSVGRequest(renderRequest))
+
+		So(converter.content, ShouldContainSubstring, `<g id="map-testname-map-annotations">`)
+		So(converter.content, ShouldContainSubstring, "Bottom right")
+	})
+
+	Convey("simpleSVG without annotations should not contain an annotations group", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:  "testname",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+		}
+		So(RenderSVG(PrepareSVGRequest(renderRequest)), ShouldNotContainSubstring, "annotations")
+	})
+}
+
+func TestSVGContainsTooltips(t *testing.T) {
+
+	newRequest := func() *models.RenderRequest {
+		return &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 15, Colour: "green"}}, ValueSuffix: "%"},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+			Tooltips:   true,
+		}
+	}
+
+	Convey("simpleSVG with tooltips should contain a hidden tooltip for each region, with the title of the region", t, func() {
+
+		svgRequest := PrepareSVGRequest(newRequest())
+		result := RenderSVG(svgRequest)
+		svg, e := unmarshalTooltipSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Tooltips.ID, ShouldEqual, "map-testname-map-tooltips")
+		So(len(svg.Tooltips.Tooltips), ShouldEqual, 2)
+		for i, tooltip := range svg.Tooltips.Tooltips {
+			So(tooltip.ID, ShouldEqual, svg.Paths[i].ID+"-tooltip")
+			So(tooltip.Class, ShouldEqual, TooltipClassName)
+			So(tooltip.Visibility, ShouldEqual, "hidden")
+			So(tooltip.Text, ShouldEqual, svg.Paths[i].Title.Value)
+			So(tooltip.Rect.X, ShouldBeGreaterThanOrEqualTo, 0)
+			So(tooltip.Rect.X+tooltip.Rect.Width, ShouldBeLessThanOrEqualTo, svgRequest.ViewBoxWidth)
+			So(tooltip.Rect.Y, ShouldBeGreaterThanOrEqualTo, 0)
+		}
+		So(svg.Tooltips.Tooltips[0].Text, ShouldEqual, "feature 0 10%")
+
+		withoutTooltips := newRequest()
+		withoutTooltips.Tooltips = false
+		So(result, ShouldStartWith, strings.Split(RenderSVG(PrepareSVGRequest(withoutTooltips)), "<path")[0])
+	})
+
+	Convey("Tooltips should be excluded from the fallback png", t, func() {
+		converter := &recordingPNGConverter{}
+		renderRequest := newRequest()
+		renderRequest.IncludeFallbackPng = true
+
+		result := RenderSVG(New(converter, DefaultOptions()).PrepareSVGRequest(renderRequest))
+
+		So(converter.content, ShouldContainSubstring, "feature 0 10%")
+		So(converter.content, ShouldNotContainSubstring, TooltipClassName)
+		So(result, ShouldContainSubstring, `<g id="map-testname-f0-tooltip" class="mapTooltip"`)
+	})
+
+	Convey("simpleSVG without tooltips should not contain any", t, func() {
+
+		renderRequest := newRequest()
+		renderRequest.Tooltips = false
+		So(RenderSVG(PrepareSVGRequest(renderRequest)), ShouldNotContainSubstring, TooltipClassName)
+	})
+}
+
+func TestSVGContainsLineStyles(t *testing.T) {
+
+	newRequest := func() *models.RenderRequest {
+		return &models.RenderRequest{
+			Filename:   "testname",
+			Geography:  &models.Geography{Topojson: mixedTopology(), IDProperty: "code", NameProperty: "name"},
+			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 15, Colour: "green"}}},
+			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
+			LineStyle:  &models.LineStyle{Stroke: "#0000ff", StrokeWidth: 1.5, DashArray: "4, 2", Class: "river"},
+		}
+	}
+
+	Convey("Lines should be drawn with the stroke of the line style and no fill, leaving polygons untouched", t, func() {
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(newRequest())))
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].ID, ShouldEqual, "map-testname-f0")
+		So(svg.Paths[0].Style, ShouldEqual, "fill: red;")
+		So(svg.Paths[0].Class, ShouldEqual, RegionClassName)
+		So(svg.Paths[1].ID, ShouldEqual, "map-testname-f1")
+		So(svg.Paths[1].Style, ShouldEqual, "fill: green; fill: none; stroke: #0000ff; stroke-width: 1.5; stroke-dasharray: 4 2;")
+		So(svg.Paths[1].Class, ShouldEqual, LineClassName+" river "+RegionClassName)
+		So(svg.Paths[1].Title.Value, ShouldEqual, "river 1 20")
+	})
+
+	Convey("Lines should be drawn as regions when the request has no line style", t, func() {
+
+		renderRequest := newRequest()
+		renderRequest.LineStyle = nil
+
+		svg, e := unmarshalSimpleSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(svg.Paths[1].Style, ShouldEqual, "fill: green;")
+		So(svg.Paths[1].Class, ShouldEqual, RegionClassName)
+	})
+}
+
+func TestSVGContainsPointMarkers(t *testing.T) {
 
-	Convey("Rendered svg should not include 'nil' in the title when the topology doesn't have the name property", t, func() {
-		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
-		renderRequest, err := models.CreateRenderRequest(reader)
+	newRequest := func() *models.RenderRequest {
+		fc, err := geojson.UnmarshalFeatureCollection([]byte(`{"type": "FeatureCollection", "features": [` +
+			`{"type": "Feature", "properties": {"code": "f0", "name": "feature 0"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[10,0],[10,10],[0,10],[0,0]]]}},` +
+			`{"type": "Feature", "properties": {"code": "p0", "name": "point 0"}, "geometry": {"type": "Point", "coordinates": [2,2]}},` +
+			`{"type": "Feature", "properties": {"code": "p1", "name": "point 1", "marker-symbol": "pin"}, "geometry": {"type": "Point", "coordinates": [8,8]}}]}`))
 		if err != nil {
 			t.Fatal(err)
 		}
-		renderRequest.Geography.NameProperty = "missing"
+		return &models.RenderRequest{
+			Filename:    "testname",
+			Geography:   &models.Geography{Geojson: fc, IDProperty: "code", NameProperty: "name"},
+			Choropleth:  &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 15, Colour: "green"}}},
+			Data:        []*models.DataRow{{ID: "f0", Value: 10}, {ID: "p0", Value: 20}},
+			PointMarker: &models.PointMarker{Symbol: models.MarkerSymbolSquare, Size: 12, Colour: "blue"},
+		}
+	}
 
-		result := RenderSVG(PrepareSVGRequest(renderRequest))
+	Convey("Points should be drawn as the symbol of the point marker (or of the feature), each symbol defined once", t, func() {
 
-		So(result, ShouldNotContainSubstring, "<nil>")
-		So(result, ShouldContainSubstring, "<title> 7% non-UK born")
-	})
-}
+		result := RenderSVG(PrepareSVGRequest(newRequest()))
 
-func TestSVGHasWidthAndHeight(t *testing.T) {
+		So(strings.Count(result, `<symbol id="map-testname-marker-square"`), ShouldEqual, 1)
+		So(strings.Count(result, `<symbol id="map-testname-marker-pin"`), ShouldEqual, 1)
+		So(result, ShouldContainSubstring, `<use href="#map-testname-marker-square"`)
+		So(result, ShouldContainSubstring, `width="12" height="12" fill="blue" class="mapRegion" id="map-testname-p0" style="fill: green;"><title>point 0 20</title></use>`)
+		So(result, ShouldContainSubstring, `<use href="#map-testname-marker-pin"`)
+		So(result, ShouldNotContainSubstring, `r="1"`)
 
-	Convey("simpleSVG should be given default width and proportional height", t, func() {
+		svg, e := unmarshalSimpleSVG(result)
+		So(e, ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, 1)
+		So(svg.Paths[0].Style, ShouldEqual, "fill: red;")
+	})
 
-		renderRequest := &models.RenderRequest{
-			Filename:  "testname",
-			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
-		}
+	Convey("Points should be drawn as 1px circles when the request has no point marker", t, func() {
 
-		result := RenderSVG(PrepareSVGRequest(renderRequest))
+		renderRequest := newRequest()
+		renderRequest.PointMarker = nil
 
-		svg, e := unmarshalSimpleSVG(result)
-		So(e, ShouldBeNil)
-		So(svg.Width, ShouldEqual, "400")
-		So(svg.Height, ShouldEqual, "329")
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+		So(result, ShouldNotContainSubstring, "<symbol")
+		So(strings.Count(result, `r="1"`), ShouldEqual, 2)
 	})
 }
 
-func TestSVGContainsClassName(t *testing.T) {
-
-	Convey("simpleSVG should assign class to map regions", t, func() {
+func TestSVGContainsPlaceLabels(t *testing.T) {
 
+	// place labels at the top left, centre and bottom right of the simple topology's bounding box, in tiers 0, 1 and 2
+	prepare := func(width float64) *SVGRequest {
 		renderRequest := &models.RenderRequest{
-			Filename:  "testname",
-			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Filename:     "testname",
+			Geography:    &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			DefaultWidth: width,
+			FontSize:     14,
+			PlaceLabels: []*models.PlaceLabel{
+				{Name: "Top <left>", Longitude: 47.128000259399414, Latitude: 9.532394934735397},
+				{Name: "Centre", Longitude: 47.13034987449646, Latitude: 9.530490399249758, Tier: 1, Size: 9},
+				{Name: "Bottom right", Longitude: 47.132699489593506, Latitude: 9.52858586376412, Tier: 2},
+			},
 		}
-		renderRequest.Geography.Topojson.Objects["simplegeojson"].Geometries[0].Properties["class"] = "foo"
-
-		result := RenderSVG(PrepareSVGRequest(renderRequest))
-
-		svg, e := unmarshalSimpleSVG(result)
-		So(e, ShouldBeNil)
-		So(len(svg.Paths), ShouldEqual, 2)
-		So(svg.Paths[0].Class, ShouldEqual, RegionClassName+" foo")
-		So(svg.Paths[1].Class, ShouldEqual, RegionClassName)
+		return PrepareSVGRequest(renderRequest)
+	}
+	position := func(match []string) []float64 {
+		x, _ := strconv.ParseFloat(match[1], 64)
+		y, _ := strconv.ParseFloat(match[2], 64)
+		return []float64{x, y}
+	}
+	labels := regexp.MustCompile(`<g class="mapPlaceLabel"><circle cx="([^"]*)" cy="([^"]*)" r="2" style="fill: #323132;"></circle><text x="[^"]*" y="[^"]*" style="font-size: (\d+)px;" class="mapPlaceLabelText">([^<]*)</text></g>`)
+
+	Convey("Place labels should be drawn at their projected positions, on top of the regions, with smaller text by default", t, func() {
+		svgRequest := prepare(800)
+		result := RenderSVG(svgRequest)
+
+		So(strings.Index(result, `<g id="map-testname-map-place-labels">`), ShouldBeGreaterThan, strings.LastIndex(result, "<path"))
+		matches := labels.FindAllStringSubmatch(result, -1)
+		So(len(matches), ShouldEqual, 3)
+		So(position(matches[0]), ShouldResemble, []float64{0, 0})
+		So(matches[0][3], ShouldEqual, "12")
+		So(matches[0][4], ShouldEqual, "Top &lt;left&gt;")
+		centre := position(matches[1])
+		So(centre[0], ShouldAlmostEqual, svgRequest.ViewBoxWidth/2, 1)
+		So(centre[1], ShouldAlmostEqual, svgRequest.ViewBoxHeight/2, 1)
+		So(matches[1][3], ShouldEqual, "9")
+		bottomRight := position(matches[2])
+		So(bottomRight[0], ShouldAlmostEqual, svgRequest.ViewBoxWidth, 1)
+		So(bottomRight[1], ShouldAlmostEqual, svgRequest.ViewBoxHeight, 1)
 	})
-}
 
-func TestSVGContainsIDs(t *testing.T) {
+	Convey("Only the place labels of tiers shown at the width of the map should be drawn", t, func() {
+		matches := labels.FindAllStringSubmatch(RenderSVG(prepare(400)), -1)
+		So(len(matches), ShouldEqual, 2)
+		So(matches[0][4], ShouldEqual, "Top &lt;left&gt;")
+		So(matches[1][4], ShouldEqual, "Centre")
 
-	Convey("simpleSVG should assign ids to map regions", t, func() {
+		matches = labels.FindAllStringSubmatch(RenderSVG(prepare(200)), -1)
+		So(len(matches), ShouldEqual, 1)
+		So(matches[0][4], ShouldEqual, "Top &lt;left&gt;")
+	})
 
+	Convey("The map should not have a place labels group by default", t, func() {
 		renderRequest := &models.RenderRequest{
 			Filename:  "testname",
 			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
 		}
-
-		result := RenderSVG(PrepareSVGRequest(renderRequest))
-
-		svg, e := unmarshalSimpleSVG(result)
-		So(e, ShouldBeNil)
-		So(len(svg.Paths), ShouldEqual, 2)
-		So(svg.Paths[0].ID, ShouldEqual, "map-testname-f0")
-		So(svg.Paths[1].ID, ShouldEqual, "map-testname-f1")
+		So(RenderSVG(PrepareSVGRequest(renderRequest)), ShouldNotContainSubstring, PlaceLabelClassName)
 	})
 }
 
-func TestSVGContainsTitles(t *testing.T) {
-
-	Convey("simpleSVG should assign names as titles to map regions", t, func() {
+func TestRenderSVGFromGeoJSON(t *testing.T) {
 
-		renderRequest := &models.RenderRequest{
-			Filename:  "testname",
-			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+	Convey("An svg map rendered from geojson should be identical to one rendered from the equivalent topojson", t, func() {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		topojsonRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(testdata.LoadExampleRequest(t))
+		geojsonRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
 		}
+		geojsonRequest.Geography.Geojson = toGeoJSON(t, geojsonRequest.Geography.Topojson)
+		geojsonRequest.Geography.Topojson = nil
 
-		result := RenderSVG(PrepareSVGRequest(renderRequest))
+		expected := RenderSVG(PrepareSVGRequest(topojsonRequest))
+		result := RenderSVG(PrepareSVGRequest(geojsonRequest))
 
-		So(result, ShouldNotBeNil)
-		svg, e := unmarshalSimpleSVG(result)
-		So(e, ShouldBeNil)
-		So(len(svg.Paths), ShouldEqual, 2)
-		So(svg.Paths[0].Title.Value, ShouldEqual, "feature 0")
-		So(svg.Paths[1].Title.Value, ShouldEqual, "feature 1")
+		So(len(result), ShouldBeGreaterThan, 0)
+		So(result == expected, ShouldBeTrue)
 	})
-}
-
-func TestSVGContainsChoroplethColours(t *testing.T) {
 
-	Convey("simpleSVG should use style to colour regions", t, func() {
+	Convey("simpleSVG rendered from geojson should use the id and name properties in the same way as topojson", t, func() {
 
 		renderRequest := &models.RenderRequest{
 			Filename:   "testname",
-			Geography:  &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+			Geography:  &models.Geography{Geojson: toGeoJSON(t, simpleTopology()), IDProperty: "code", NameProperty: "name"},
 			Choropleth: &models.Choropleth{Breaks: []*models.ChoroplethBreak{{LowerBound: 0, Colour: "red"}, {LowerBound: 11, Colour: "green"}}},
 			Data:       []*models.DataRow{{ID: "f0", Value: 10}, {ID: "f1", Value: 20}},
 		}
 
 		result := RenderSVG(PrepareSVGRequest(renderRequest))
 
-		So(result, ShouldNotBeNil)
 		svg, e := unmarshalSimpleSVG(result)
 		So(e, ShouldBeNil)
 		So(len(svg.Paths), ShouldEqual, 2)
+		So(svg.Paths[0].ID, ShouldEqual, "map-testname-f0")
 		So(svg.Paths[0].Style, ShouldContainSubstring, "fill: red")
+		So(svg.Paths[0].Title.Value, ShouldStartWith, "feature 0")
+		So(svg.Paths[1].ID, ShouldEqual, "map-testname-f1")
 		So(svg.Paths[1].Style, ShouldContainSubstring, "fill: green")
 	})
 }
 
+func TestRenderFromLegacySchemaVersion(t *testing.T) {
+
+	Convey("A map rendered from a version 1 request should be identical to one rendered from the equivalent current version request", t, func() {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(testdata.LoadExampleRequest(t), &fields); err != nil {
+			t.Fatal(err)
+		}
+		choropleth := fields["choropleth"].(map[string]interface{})
+		choropleth["reference_lines"] = []interface{}{map[string]interface{}{"value": choropleth["reference_value"], "text": choropleth["reference_value_text"]}}
+		delete(choropleth, "reference_value")
+		delete(choropleth, "reference_value_text")
+		fields["schema_version"] = models.CurrentSchemaVersion
+		body, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		legacyRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		currentRequest, err := models.CreateRenderRequestStrict(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		So(legacyRequest.OriginalSchemaVersion, ShouldEqual, 1)
+		So(currentRequest.OriginalSchemaVersion, ShouldEqual, models.CurrentSchemaVersion)
+
+		legacy := PrepareSVGRequest(legacyRequest)
+		current := PrepareSVGRequest(currentRequest)
+
+		So(RenderSVG(legacy) == RenderSVG(current), ShouldBeTrue)
+		So(RenderVerticalKey(legacy), ShouldEqual, RenderVerticalKey(current))
+		So(RenderHorizontalKey(legacy), ShouldEqual, RenderHorizontalKey(current))
+		So(RenderVerticalKey(legacy), ShouldContainSubstring, "UK avg.")
+	})
+}
+
 func TestSVGHasMissingValuePatternAndCorrectTitle(t *testing.T) {
 
 	Convey("simpleSVG should use style to colour regions, applying style to regions missing data, and modify the title with values", t, func() {
@@ -323,8 +1518,7 @@ func TestRenderVerticalKeyWithoutReferenceValue(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		renderRequest.Choropleth.ReferenceValue = 0
-		renderRequest.Choropleth.ReferenceValueText = ""
+		renderRequest.Choropleth.ReferenceLines = nil
 
 		result := RenderVerticalKey(PrepareSVGRequest(renderRequest))
 
@@ -357,6 +1551,86 @@ func TestRenderHorizontalKey(t *testing.T) {
 
 }
 
+func TestRenderKeysEscapeText(t *testing.T) {
+	Convey("RenderHorizontalKey and RenderVerticalKey should escape the legend title and reference text", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.ValuePrefix = "<b>Fish"
+		renderRequest.Choropleth.ValueSuffix = "& Chips</b>"
+		renderRequest.Choropleth.ReferenceLines[0].Text = "<script>alert(1)</script>"
+		svgRequest := PrepareSVGRequest(renderRequest)
+
+		for _, result := range []string{RenderHorizontalKey(svgRequest), RenderVerticalKey(svgRequest)} {
+			So(result, ShouldContainSubstring, "&lt;b&gt;Fish &amp; Chips&lt;/b&gt;")
+			So(result, ShouldContainSubstring, "&lt;script&gt;alert(1)&lt;/script&gt;")
+			So(result, ShouldNotContainSubstring, "<b>")
+			So(result, ShouldNotContainSubstring, "<script>")
+		}
+	})
+
+	Convey("Ids derived from the element id should be sanitised", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.ElementID = `x"><script>`
+
+		result := RenderHorizontalKey(PrepareSVGRequest(renderRequest))
+
+		So(result, ShouldStartWith, `<svg id="map-x___script_-legend-horizontal-svg"`)
+		So(result, ShouldNotContainSubstring, "<script>")
+	})
+
+}
+
+func TestSVGsHaveDocumentTitles(t *testing.T) {
+	Convey("The map and key svgs should each have a title and description as their first children, built from the request", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Title = "Fish <& Chips>"
+		renderRequest.Subtitle = "Per   head"
+		svgRequest := PrepareSVGRequest(renderRequest)
+
+		expected := map[string][]string{
+			RenderSVG(svgRequest):           {"Map: Fish <& Chips>", "Per head"},
+			RenderHorizontalKey(svgRequest): {"Horizontal key for Fish <& Chips>", exampleKeyAlt},
+			RenderVerticalKey(svgRequest):   {"Vertical key for Fish <& Chips>", exampleKeyAlt},
+		}
+		for result, text := range expected {
+			So(result, ShouldContainSubstring, "Fish &lt;&amp; Chips&gt;</title>")
+			svg, e := unmarshalDocumentSVG(result)
+			So(e, ShouldBeNil)
+			So(svg.Children[0].XMLName.Local, ShouldEqual, "title")
+			So(svg.Children[0].Value, ShouldEqual, text[0])
+			So(svg.Children[1].XMLName.Local, ShouldEqual, "desc")
+			So(svg.Children[1].Value, ShouldEqual, text[1])
+		}
+	})
+
+	Convey("Without a title or subtitle the map svg should have a generic title and no description", t, func() {
+
+		renderRequest := &models.RenderRequest{
+			Filename:  "testname",
+			Geography: &models.Geography{Topojson: simpleTopology(), IDProperty: "code", NameProperty: "name"},
+		}
+		svg, e := unmarshalDocumentSVG(RenderSVG(PrepareSVGRequest(renderRequest)))
+		So(e, ShouldBeNil)
+		So(svg.Children[0].XMLName.Local, ShouldEqual, "title")
+		So(svg.Children[0].Value, ShouldEqual, "Map")
+		So(svg.Children[1].XMLName.Local, ShouldNotEqual, "desc")
+	})
+}
+
 func TestRenderHorizontalKeyWithLongTitle(t *testing.T) {
 	Convey("RenderHorizontalKey should render an svg and adjust title text to fit within the bounds", t, func() {
 
@@ -389,7 +1663,7 @@ func TestRenderHorizontalKeyWithLongReferenceText(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		renderRequest.Choropleth.ReferenceValueText = "This is a longer bit of text"
+		renderRequest.Choropleth.ReferenceLines[0].Text = "This is a longer bit of text"
 
 		result := RenderHorizontalKey(PrepareSVGRequest(renderRequest))
 
@@ -412,8 +1686,8 @@ func TestRenderHorizontalKeyWithLongerReferenceTextOnLeft(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		renderRequest.Choropleth.ReferenceValue = 28
-		renderRequest.Choropleth.ReferenceValueText = "This is a much longer bit of text that will shorten the key"
+		renderRequest.Choropleth.ReferenceLines[0].Value = 28
+		renderRequest.Choropleth.ReferenceLines[0].Text = "This is a much longer bit of text that will shorten the key"
 
 		result := RenderHorizontalKey(PrepareSVGRequest(renderRequest))
 
@@ -436,8 +1710,8 @@ func TestRenderHorizontalKeyWithLongerReferenceTextOnRight(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		renderRequest.Choropleth.ReferenceValue = 13
-		renderRequest.Choropleth.ReferenceValueText = "This is a much longer bit of text that will shorten the key"
+		renderRequest.Choropleth.ReferenceLines[0].Value = 13
+		renderRequest.Choropleth.ReferenceLines[0].Text = "This is a much longer bit of text that will shorten the key"
 
 		result := RenderHorizontalKey(PrepareSVGRequest(renderRequest))
 
@@ -530,6 +1804,89 @@ func TestRenderVerticalKeyClassChangesWhenHorizontalKeyAlsoPresent(t *testing.T)
 
 }
 
+func TestRenderKeysWithKeySwatch(t *testing.T) {
+	horizontalTicks := regexp.MustCompile(`<g class="map__tick" transform="translate\(([\d.]+), 0\)">`)
+	verticalTicks := regexp.MustCompile(`<g class="map__tick" transform="translate\(0, ([\d.]+)\)">`)
+	render := func(swatch string, vertical bool) (string, []float64) {
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.KeySwatch = swatch
+		renderRequest.Choropleth.ReferenceLines = nil
+		if vertical {
+			result := RenderVerticalKey(PrepareSVGRequest(renderRequest))
+			return result, parseFloats(verticalTicks.FindAllStringSubmatch(result, -1))
+		}
+		result := RenderHorizontalKey(PrepareSVGRequest(renderRequest))
+		return result, parseFloats(horizontalTicks.FindAllStringSubmatch(result, -1))
+	}
+
+	Convey("By default the keys should have a bar of rectangles, and a square sample for missing data", t, func() {
+		for _, vertical := range []bool{false, true} {
+			result, ticks := render("", vertical)
+			So(len(ticks), ShouldEqual, 6)
+			So(strings.Count(result, `<rect class="keyColour"`), ShouldEqual, 6)
+			So(result, ShouldNotContainSubstring, `<circle class="keyColour"`)
+			So(result, ShouldContainSubstring, `<rect class="keyColour" height="8" width="8" style="stroke-width: 0.8; stroke: black; fill: url(#map-abcd1234-`)
+		}
+	})
+
+	Convey("Circular swatches should be centred between the ticks of their break, on the axis of the key", t, func() {
+		result, ticks := render(models.KeySwatchCircle, false)
+		circles := regexp.MustCompile(`<circle class="keyColour" cx="([\d.]+)" cy="4" r="([\d.]+)"`).FindAllStringSubmatch(result, -1)
+		So(len(circles), ShouldEqual, 6) // including the missing data sample
+		So(len(ticks), ShouldEqual, 6)
+		for i, c := range parseFloats(circles[:5]) {
+			So(c, ShouldAlmostEqual, (ticks[i]+ticks[i+1])/2, 0.001)
+		}
+		So(result, ShouldNotContainSubstring, `<rect class="keyColour"`)
+		So(result, ShouldContainSubstring, `<circle class="keyColour" cx="4" cy="4" r="4" style="stroke-width: 0.8; stroke: black; fill: url(#map-abcd1234-horizontal-nodata);">`)
+
+		result, ticks = render(models.KeySwatchCircle, true)
+		circles = regexp.MustCompile(`<circle class="keyColour" cx="4" cy="([\d.]+)" r="([\d.]+)"`).FindAllStringSubmatch(result, -1)
+		So(len(circles), ShouldEqual, 6) // including the missing data sample
+		So(len(ticks), ShouldEqual, 6)
+		for i, c := range parseFloats(circles[:5]) {
+			So(c, ShouldAlmostEqual, (ticks[i]+ticks[i+1])/2, 0.001)
+		}
+		So(result, ShouldNotContainSubstring, `<rect class="keyColour"`)
+		So(result, ShouldContainSubstring, `<circle class="keyColour" cx="4" cy="4" r="4" style="stroke-width: 0.8; stroke: black; fill: url(#map-abcd1234-vertical-nodata);">`)
+	})
+
+	Convey("Line swatches should run from tick to tick of their break, on the axis of the key", t, func() {
+		result, ticks := render(models.KeySwatchLine, false)
+		lines := regexp.MustCompile(`<line class="keyColour" x1="([\d.]+)" y1="4" x2="([\d.]+)" y2="4"`).FindAllStringSubmatch(result, -1)
+		So(len(lines), ShouldEqual, 6) // including the missing data sample
+		So(len(ticks), ShouldEqual, 6)
+		for i, l := range lines[:5] {
+			So(parseFloats([][]string{{"", l[1]}, {"", l[2]}}), ShouldResemble, []float64{ticks[i], ticks[i+1]})
+		}
+		So(result, ShouldNotContainSubstring, `<rect class="keyColour"`)
+		So(result, ShouldContainSubstring, `<line class="keyColour" x1="0" y1="4" x2="8" y2="4" style="stroke-width: 4; stroke: url(#map-abcd1234-horizontal-nodata);">`)
+
+		result, ticks = render(models.KeySwatchLine, true)
+		lines = regexp.MustCompile(`<line class="keyColour" x1="4" y1="([\d.]+)" x2="4" y2="([\d.]+)"`).FindAllStringSubmatch(result, -1)
+		So(len(lines), ShouldEqual, 5)
+		So(len(ticks), ShouldEqual, 6)
+		for i, l := range lines {
+			So(parseFloats([][]string{{"", l[1]}, {"", l[2]}}), ShouldResemble, []float64{ticks[i+1], ticks[i]})
+		}
+		So(result, ShouldNotContainSubstring, `<rect class="keyColour"`)
+		So(result, ShouldContainSubstring, `<line class="keyColour" x1="0" y1="4" x2="8" y2="4" style="stroke-width: 4; stroke: url(#map-abcd1234-vertical-nodata);">`)
+	})
+}
+
+// parseFloats returns the first submatch of each match as a float
+func parseFloats(matches [][]string) []float64 {
+	result := make([]float64, len(matches))
+	for i, m := range matches {
+		result[i], _ = strconv.ParseFloat(m[1], 64)
+	}
+	return result
+}
+
 func TestRenderHorizontalKeyHasFallbackPng(t *testing.T) {
 	Convey("RenderHorizontalKey should render a fallback png", t, func() {
 
@@ -546,7 +1903,7 @@ func TestRenderHorizontalKeyHasFallbackPng(t *testing.T) {
 
 		So(result, ShouldNotBeNil)
 		So(result, ShouldContainSubstring, `<foreignObject>`)
-		So(result, ShouldContainSubstring, expectedFallbackImage)
+		So(result, ShouldContainSubstring, expectedKeyFallbackImage)
 
 	})
 
@@ -588,7 +1945,7 @@ func TestRenderVerticalKeyHasFallbackPng(t *testing.T) {
 
 		So(result, ShouldNotBeNil)
 		So(result, ShouldContainSubstring, `<foreignObject>`)
-		So(result, ShouldContainSubstring, expectedFallbackImage)
+		So(result, ShouldContainSubstring, expectedKeyFallbackImage)
 
 	})
 
@@ -634,6 +1991,77 @@ func TestRenderHorizontalKeyHasCorrectUpperBound(t *testing.T) {
 
 }
 
+func TestRenderIsIndependentOfDataAndBreakOrder(t *testing.T) {
+	Convey("The map and legends should be the same whatever the order of the data and breaks, which should not be reordered", t, func() {
+		render := func(reverse bool) ([]string, *models.RenderRequest) {
+			renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			renderRequest.Choropleth.UpperBound = 0 // so that the highest value in the data is used
+			if reverse {
+				data, breaks := renderRequest.Data, renderRequest.Choropleth.Breaks
+				for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+					data[i], data[j] = data[j], data[i]
+				}
+				for i, j := 0, len(breaks)-1; i < j; i, j = i+1, j-1 {
+					breaks[i], breaks[j] = breaks[j], breaks[i]
+				}
+			}
+			svgRequest := PrepareSVGRequest(renderRequest)
+			return []string{RenderSVG(svgRequest), RenderHorizontalKey(svgRequest), RenderVerticalKey(svgRequest)}, renderRequest
+		}
+
+		expected, renderRequest := render(false)
+		result, reversedRequest := render(true)
+
+		So(result, ShouldResemble, expected)
+		So(renderRequest.Data[0].ID, ShouldEqual, "E06000001")
+		So(reversedRequest.Data[0].ID, ShouldEqual, renderRequest.Data[len(renderRequest.Data)-1].ID)
+		So(reversedRequest.Choropleth.Breaks[0].LowerBound, ShouldEqual, renderRequest.Choropleth.Breaks[len(renderRequest.Choropleth.Breaks)-1].LowerBound)
+	})
+}
+
+func TestRenderMinifiedSVGs(t *testing.T) {
+	Convey("The map and legends should be smaller when minified, with the same regions and elements", t, func() {
+		render := func(minify bool) []string {
+			renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			renderRequest.Minify = minify
+			svgRequest := PrepareSVGRequest(renderRequest)
+			return []string{RenderSVG(svgRequest), RenderHorizontalKey(svgRequest), RenderVerticalKey(svgRequest)}
+		}
+
+		expected := render(false)
+		result := render(true)
+
+		So(result, ShouldHaveLength, len(expected))
+		for i := range result {
+			So(len(result[i]), ShouldBeLessThan, len(expected[i]))
+			So(result[i], ShouldNotContainSubstring, "\n")
+			resultElements, err := testdata.CountElements(result[i])
+			So(err, ShouldBeNil)
+			expectedElements, err := testdata.CountElements(expected[i])
+			So(err, ShouldBeNil)
+			So(resultElements, ShouldResemble, expectedElements)
+		}
+
+		svg := &simpleSVG{}
+		So(xml.Unmarshal([]byte(result[0]), svg), ShouldBeNil)
+		original := &simpleSVG{}
+		So(xml.Unmarshal([]byte(expected[0]), original), ShouldBeNil)
+		So(len(svg.Paths), ShouldEqual, len(original.Paths))
+		for i, p := range svg.Paths {
+			So(p.ID, ShouldEqual, original.Paths[i].ID)
+			So(p.Class, ShouldEqual, original.Paths[i].Class)
+			So(p.Title.Value, ShouldEqual, original.Paths[i].Title.Value)
+			So(len(p.D), ShouldBeLessThan, len(original.Paths[i].D))
+		}
+	})
+}
+
 func TestRenderVerticalKeyWidth(t *testing.T) {
 	Convey("RenderVerticalKey should adjust width to acommodate the text", t, func() {
 
@@ -658,7 +2086,7 @@ func TestRenderVerticalKeyWidth(t *testing.T) {
 
 		Convey("A long reference text should cause the width to increase", func() {
 			renderRequest.Choropleth.ValueSuffix = "short text"
-			renderRequest.Choropleth.ReferenceValueText = "some text long enough to increase the width..."
+			renderRequest.Choropleth.ReferenceLines[0].Text = "some text long enough to increase the width..."
 			width := getWidth(RenderVerticalKey(PrepareSVGRequest(renderRequest)))
 
 			So(width, ShouldBeGreaterThan, defaultWidth)
@@ -667,9 +2095,9 @@ func TestRenderVerticalKeyWidth(t *testing.T) {
 
 		Convey("Long tick values should cause the width to increase", func() {
 			renderRequest.Choropleth.ValueSuffix = "short text"
-			renderRequest.Choropleth.ReferenceValueText = ".."
+			renderRequest.Choropleth.ReferenceLines[0].Text = ".."
 			renderRequest.Choropleth.Breaks[0].LowerBound = 123456.123456
-			renderRequest.Choropleth.ReferenceValue = 123456.123456
+			renderRequest.Choropleth.ReferenceLines[0].Value = 123456.123456
 			width := getWidth(RenderVerticalKey(PrepareSVGRequest(renderRequest)))
 
 			So(width, ShouldBeGreaterThan, defaultWidth)
@@ -694,13 +2122,42 @@ func assertKeyContents(result string, renderRequest *models.RenderRequest, align
 	So(len(withClass), ShouldEqual, len(textElements))
 	// look for the reference text if it should be present
 	referenceTick := regexp.MustCompile(`<line [^>]*stroke: DimGrey;[^>]*></line>`).FindString(result)
-	if len(renderRequest.Choropleth.ReferenceValueText) == 0 {
+	if len(renderRequest.Choropleth.ReferenceLines) == 0 || len(renderRequest.Choropleth.ReferenceLines[0].Text) == 0 {
 		So(len(referenceTick), ShouldEqual, 0)
 	} else {
 		So(len(referenceTick), ShouldBeGreaterThan, 0)
-		So(result, ShouldContainSubstring, renderRequest.Choropleth.ReferenceValueText)
+		So(result, ShouldContainSubstring, renderRequest.Choropleth.ReferenceLines[0].Text)
+	}
+
+}
+
+func TestRenderVerticalKeyWidthUsesFontMetrics(t *testing.T) {
+	metrics, err := htmlutil.NewFontMetrics(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
 	}
+	htmlutil.UseTextMeasurer("Go", metrics)
+	defer htmlutil.UseTextMeasurer("Go", nil)
+
+	Convey("The width of the vertical key is measured using the metrics of the request's font family", t, func() {
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.Choropleth.ValuePrefix = "Ŵyŵyr"
+		renderRequest.Choropleth.ValueSuffix = "ŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵŵ"
+		title := renderRequest.Choropleth.ValuePrefix + " " + renderRequest.Choropleth.ValueSuffix
 
+		approximate := PrepareSVGRequest(renderRequest)
+		So(approximate.VerticalLegendWidth, ShouldAlmostEqual, htmlutil.GetApproximateTextWidth(title, renderRequest.FontSize)+10, 0.001)
+
+		renderRequest.FontFamily = `"Go", sans-serif`
+		measured := PrepareSVGRequest(renderRequest)
+		So(measured.VerticalLegendWidth, ShouldAlmostEqual, metrics.TextWidth(title, renderRequest.FontSize)+10, 0.001)
+		So(measured.VerticalLegendWidth, ShouldBeLessThan, approximate.VerticalLegendWidth)
+	})
 }
 
 func getWidth(result string) int {
@@ -718,6 +2175,25 @@ func simpleTopology() *topojson.Topology {
 	return simpleTopology
 }
 
+// mixedTopology has a polygon (f0) and a line (f1)
+func mixedTopology() *topojson.Topology {
+	mixedTopology, _ := topojson.UnmarshalTopology([]byte(`{"type":"Topology","objects":{"mixed":{"type":"GeometryCollection","geometries":[{"type":"Polygon","arcs":[[0]],"properties":{"code":"f0","name":"feature 0"}},{"type":"LineString","arcs":[1],"properties":{"code":"f1","name":"river 1"}}]}},"arcs":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[-5,5],[15,5]]],"bbox":[-5,0,15,10]}`))
+	return mixedTopology
+}
+
+// toGeoJSON converts the topology to a geojson feature collection via its json representation, as a client would supply it
+func toGeoJSON(t *testing.T, topology *topojson.Topology) *geojson.FeatureCollection {
+	b, err := json.Marshal(topology.ToGeoJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fc
+}
+
 // definition of an SVG sufficient to get details for a simple topology
 type simpleSVG struct {
 	Paths   []path `xml:"path"`
@@ -727,19 +2203,239 @@ type simpleSVG struct {
 }
 
 type path struct {
-	D     string `xml:"d,attr"`
-	ID    string `xml:"id,attr"`
-	Style string `xml:"style,attr"`
-	Class string `xml:"class,attr"`
-	Title title  `xml:"title"`
+	D       string `xml:"d,attr"`
+	ID      string `xml:"id,attr"`
+	Style   string `xml:"style,attr"`
+	Class   string `xml:"class,attr"`
+	Title   title  `xml:"title"`
+	CILower string `xml:"data-ci-lower,attr"`
+	CIUpper string `xml:"data-ci-upper,attr"`
 }
 
 type title struct {
 	Value string `xml:",chardata"`
 }
 
+// definition of an SVG sufficient to get details of the annotations
+type annotatedSVG struct {
+	Annotations struct {
+		ID      string `xml:"id,attr"`
+		Markers []struct {
+			Class  string `xml:"class,attr"`
+			Circle struct {
+				CX float64 `xml:"cx,attr"`
+				CY float64 `xml:"cy,attr"`
+			} `xml:"circle"`
+			Text *struct {
+				X     float64 `xml:"x,attr"`
+				Y     float64 `xml:"y,attr"`
+				Value string  `xml:",chardata"`
+			} `xml:"text"`
+		} `xml:"g"`
+	} `xml:"g"`
+}
+
+// definition of an SVG sufficient to get details of its regions and their tooltips
+type tooltipSVG struct {
+	Paths    []path `xml:"path"`
+	Tooltips struct {
+		ID       string `xml:"id,attr"`
+		Tooltips []struct {
+			ID         string `xml:"id,attr"`
+			Class      string `xml:"class,attr"`
+			Visibility string `xml:"visibility,attr"`
+			Rect       struct {
+				X     float64 `xml:"x,attr"`
+				Y     float64 `xml:"y,attr"`
+				Width float64 `xml:"width,attr"`
+			} `xml:"rect"`
+			Text string `xml:"text"`
+		} `xml:"g"`
+	} `xml:"g"`
+}
+
+func unmarshalTooltipSVG(source string) (*tooltipSVG, error) {
+	svg := &tooltipSVG{}
+	err := xml.Unmarshal([]byte(source), svg)
+	return svg, err
+}
+
+// definition of an SVG sufficient to get the names and text of its children, in order
+type documentSVG struct {
+	Children []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+func unmarshalDocumentSVG(source string) (*documentSVG, error) {
+	svg := &documentSVG{}
+	err := xml.Unmarshal([]byte(source), svg)
+	return svg, err
+}
+
+func unmarshalAnnotatedSVG(source string) (*annotatedSVG, error) {
+	svg := &annotatedSVG{}
+	err := xml.Unmarshal([]byte(source), svg)
+	return svg, err
+}
+
+// recordingPNGConverter records the svg content it is asked to include a fallback image for
+type recordingPNGConverter struct {
+	content string
+}
+
+func (c *recordingPNGConverter) Convert(svg []byte) ([]byte, error) {
+	return []byte("test"), nil
+}
+
+func (c *recordingPNGConverter) IncludeFallbackImage(svgAttributes string, svgContent string, width float64, height float64, alt string) string {
+	c.content = svgContent
+	return "<svg" + svgAttributes + ">" + svgContent + "</svg>"
+}
+
 func unmarshalSimpleSVG(source string) (*simpleSVG, error) {
 	svg := &simpleSVG{}
 	err := xml.Unmarshal([]byte(source), svg)
 	return svg, err
 }
+
+func TestSVGRequestStats(t *testing.T) {
+	Convey("The stats should describe the request and count the conversions to png", t, func() {
+		converter := &recordingPNGConverter{}
+		recording := New(converter, DefaultOptions())
+
+		reader := bytes.NewReader(testdata.LoadExampleRequest(t))
+		renderRequest, err := models.CreateRenderRequest(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderRequest.IncludeFallbackPng = true
+
+		svgRequest := recording.PrepareSVGRequest(renderRequest)
+		stats := svgRequest.Stats()
+		So(stats.FeatureCount, ShouldEqual, len(renderRequest.Geography.Topojson.ToGeoJSON().Features))
+		So(stats.DataRowCount, ShouldEqual, len(renderRequest.Data))
+		So(stats.BreakCount, ShouldEqual, len(renderRequest.Choropleth.Breaks))
+		So(stats.PrepareDuration, ShouldBeGreaterThan, 0)
+		So(stats.PNGConversions, ShouldEqual, 0)
+
+		RenderSVG(svgRequest)
+		RenderVerticalKey(svgRequest)
+		RenderHorizontalKey(svgRequest)
+
+		stats = svgRequest.Stats()
+		So(stats.PNGConversions, ShouldEqual, 3)
+		So(stats.DrawDuration, ShouldBeGreaterThan, 0)
+		So(stats.ConvertDuration, ShouldBeGreaterThan, 0)
+		So(stats.Warnings, ShouldResemble, svgRequest.Warnings)
+	})
+}
+
+// namedPNGConverter converts every svg to its name, so that the converter used can be identified in the output
+type namedPNGConverter struct {
+	name string
+}
+
+func (c *namedPNGConverter) Convert(svg []byte) ([]byte, error) {
+	time.Sleep(time.Millisecond)
+	return []byte(c.name), nil
+}
+
+func (c *namedPNGConverter) IncludeFallbackImage(svgAttributes string, svgContent string, width float64, height float64, alt string) string {
+	return "<svg " + svgAttributes + ">" + svgContent + "<img src=\"" + c.name + "\" /></svg>"
+}
+
+func TestUsePNGConverterWhileRendering(t *testing.T) {
+	Convey("Replacing the png converter while rendering should not affect renders in progress", t, func() {
+		converters := []*namedPNGConverter{{name: "first"}, {name: "second"}}
+		swapping := New(converters[0], DefaultOptions())
+
+		var wg sync.WaitGroup
+		results := make(chan []byte, 40)
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 5; i++ {
+					renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					renderRequest.Choropleth.VerticalLegendPosition = models.LegendPositionAfter
+					result, _, err := swapping.RenderHTMLWithPNGAndStats(renderRequest)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					results <- result
+				}
+			}()
+		}
+		stopSwapping := make(chan struct{})
+		swapped := make(chan struct{})
+		go func() {
+			defer close(swapped)
+			for i := 1; ; i++ {
+				select {
+				case <-stopSwapping:
+					return
+				case <-time.After(time.Millisecond):
+					swapping.UsePNGConverter(converters[i%2])
+				}
+			}
+		}()
+		wg.Wait()
+		close(stopSwapping)
+		<-swapped
+		close(results)
+
+		count := 0
+		for result := range results {
+			count++
+			first := strings.Count(string(result), "base64,first")
+			second := strings.Count(string(result), "base64,second")
+			So(first+second, ShouldEqual, 2)
+			So(first == 0 || second == 0, ShouldBeTrue)
+		}
+		So(count, ShouldEqual, 40)
+	})
+}
+
+func TestSVGContainsLowDetail(t *testing.T) {
+
+	Convey("A responsive svg with low detail should contain a simplified copy of each region, with the id suffixed", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+		renderRequest.LowDetail = true
+
+		result := RenderSVG(PrepareSVGRequest(renderRequest))
+		fullStart := strings.Index(result, `<g class="`+geojson2svg.FullDetailClassName+`">`)
+		lowStart := strings.Index(result, `<g class="`+geojson2svg.LowDetailClassName+`" display="none">`)
+		So(fullStart, ShouldBeGreaterThan, 0)
+		So(lowStart, ShouldBeGreaterThan, fullStart)
+		full, low := result[fullStart:lowStart], result[lowStart:]
+
+		ids := regexp.MustCompile(`<path[^>]* id="([^"]+)"`)
+		fullIDs, lowIDs := ids.FindAllStringSubmatch(full, -1), ids.FindAllStringSubmatch(low, -1)
+		So(len(fullIDs), ShouldBeGreaterThan, 0)
+		So(len(lowIDs), ShouldEqual, len(fullIDs))
+		for i := range fullIDs {
+			So(lowIDs[i][1], ShouldEqual, fullIDs[i][1]+geojson2svg.LowDetailIDSuffix)
+		}
+		So(float64(len(low)), ShouldBeLessThan, 0.3*float64(len(full)))
+	})
+
+	Convey("An svg without a responsive size should not contain low detail regions", t, func() {
+		renderRequest, err := models.CreateRenderRequest(bytes.NewReader(testdata.LoadExampleRequest(t)))
+		So(err, ShouldBeNil)
+		renderRequest.LowDetail = true
+		renderRequest.MinWidth, renderRequest.MaxWidth = 0, 0
+
+		svgRequest := PrepareSVGRequest(renderRequest)
+		result := RenderSVG(svgRequest)
+		So(result, ShouldNotContainSubstring, geojson2svg.LowDetailClassName)
+		So(strings.Join(svgRequest.Warnings, "\n"), ShouldContainSubstring, "low_detail requires a responsive size")
+	})
+}
@@ -0,0 +1,49 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	g2s "github.com/ONSdigital/dp-map-renderer/geojson2svg"
+	"github.com/ONSdigital/dp-map-renderer/htmlutil"
+	"github.com/paulmach/go.geojson"
+)
+
+// TooltipClassName is the name of the class assigned to the group of each tooltip (see RenderRequest.Tooltips)
+const TooltipClassName = "mapTooltip"
+
+// tooltipPadding is the space between the text of a tooltip and the edge of its rectangle
+const tooltipPadding = 4.0
+
+// tooltipOverlay returns an overlay that draws a hidden tooltip for each region with an id and a title - a rounded rectangle containing the title,
+// centred above the middle of the bounding box of the region (but kept within the map). The tooltip of a region has the id of the region followed by
+// "-tooltip", so that a script can show it when the region is hovered over or focused (see pageScript).
+func tooltipOverlay(svgRequest *SVGRequest, features []*geojson.Feature) g2s.Overlay {
+	request := svgRequest.request
+	fontSize := svgRequest.fontSize()
+	height := float64(fontSize) + 2*tooltipPadding
+	return func(sf g2s.ScaleFunc) string {
+		content := bytes.NewBufferString("")
+		fmt.Fprintf(content, `<g id="%s-tooltips">`, mapID(request))
+		for _, feature := range features {
+			title, _ := feature.Properties[request.Geography.NameProperty].(string)
+			bounds := g2s.BoundingBox(&geojson.FeatureCollection{Features: []*geojson.Feature{feature}})
+			if feature.ID == nil || len(title) == 0 || bounds == nil {
+				continue
+			}
+			left, top := sf(bounds[0], bounds[3])
+			right, bottom := sf(bounds[2], bounds[1])
+			width := svgRequest.textWidth(title) + 2*tooltipPadding
+			x := math.Max(0, math.Min((left+right-width)/2, svgRequest.ViewBoxWidth-width))
+			y := math.Max(0, (top+bottom)/2-height-tooltipPadding)
+
+			fmt.Fprintf(content, `<g id="%v-tooltip" class="%s" visibility="hidden" pointer-events="none">`, feature.ID, TooltipClassName)
+			fmt.Fprintf(content, `<rect x="%f" y="%f" width="%f" height="%f" rx="3" ry="3" style="fill: white; stroke: #323132; stroke-width: 0.5;"></rect>`, x, y, width, height)
+			fmt.Fprintf(content, `<text x="%f" y="%f" dy=".35em" style="font-size: %dpx;">%s</text>`, x+tooltipPadding, y+height/2, fontSize, htmlutil.EscapeText(title))
+			fmt.Fprint(content, `</g>`)
+		}
+		fmt.Fprint(content, `</g>`)
+		return content.String()
+	}
+}
@@ -0,0 +1,68 @@
+package testdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"testing"
+)
+
+// BenchmarkCost is the cost of a single operation of a benchmark
+type BenchmarkCost struct {
+	NsPerOp     int64 `json:"ns_per_op"`
+	AllocsPerOp int64 `json:"allocs_per_op"`
+	BytesPerOp  int64 `json:"bytes_per_op"`
+}
+
+// CostOf returns the cost of a single operation of the benchmark result
+func CostOf(result testing.BenchmarkResult) BenchmarkCost {
+	return BenchmarkCost{NsPerOp: result.NsPerOp(), AllocsPerOp: result.AllocsPerOp(), BytesPerOp: result.AllocedBytesPerOp()}
+}
+
+// BenchmarkBaseline records the cost of benchmarks by name, so that later runs may be compared with it to detect performance regressions
+type BenchmarkBaseline map[string]BenchmarkCost
+
+// LoadBenchmarkBaseline reads a baseline from the json file at path
+func LoadBenchmarkBaseline(path string) (BenchmarkBaseline, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseline := BenchmarkBaseline{}
+	if err = json.Unmarshal(b, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid benchmark baseline %s: %v", path, err)
+	}
+	return baseline, nil
+}
+
+// Save writes the baseline to a json file at path
+func (baseline BenchmarkBaseline) Save(path string) error {
+	b, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// Compare returns a description of each cost in results that exceeds the baseline by more than the tolerance (e.g. 0.2 for 20%), sorted by name.
+// Benchmarks that are not in the baseline are ignored.
+func (baseline BenchmarkBaseline) Compare(results BenchmarkBaseline, tolerance float64) []string {
+	var regressions []string
+	exceeds := func(name string, measure string, result int64, base int64) {
+		if float64(result) > float64(base)*(1+tolerance) {
+			regressions = append(regressions, fmt.Sprintf("%s: %d %s exceeds the baseline of %d by more than %g%%", name, result, measure, base, tolerance*100))
+		}
+	}
+	for name, result := range results {
+		base, ok := baseline[name]
+		if !ok {
+			continue
+		}
+		exceeds(name, "ns/op", result.NsPerOp, base.NsPerOp)
+		exceeds(name, "allocs/op", result.AllocsPerOp, base.AllocsPerOp)
+		exceeds(name, "B/op", result.BytesPerOp, base.BytesPerOp)
+	}
+	sort.Strings(regressions)
+	return regressions
+}
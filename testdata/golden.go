@@ -0,0 +1,79 @@
+package testdata
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// updateGolden regenerates the golden files instead of comparing output with them, e.g.
+//
+//	go test ./renderer -run TestGolden -args -update
+var updateGolden = flag.Bool("update", false, "if true, AssertGolden writes the golden files instead of comparing output with them")
+
+// goldenDir is the directory of the golden files, relative to the package under test
+var goldenDir = filepath.Join("..", "testdata", "golden")
+
+// LoadGolden reads the golden file of the given name
+func LoadGolden(t testing.TB, name string) []byte {
+	return loadTestdata(t, filepath.Join("golden", name))
+}
+
+// AssertGolden compares actual with the golden file of the given name (in testdata/golden), failing the test at the first difference.
+// With the -update flag, the golden file is written instead.
+func AssertGolden(t testing.TB, name string, actual []byte) {
+	t.Helper()
+	path := filepath.Join(goldenDir, name)
+	if *updateGolden {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("the golden file %s does not exist - create it using -update", path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CompareGolden(expected, actual); err != nil {
+		t.Errorf("%s: %v - if the change is intended, regenerate the golden files using -update", path, err)
+	}
+}
+
+// CompareGolden returns an error describing the first difference between expected and actual, or nil if they are identical
+func CompareGolden(expected []byte, actual []byte) error {
+	if bytes.Equal(expected, actual) {
+		return nil
+	}
+	line, column := 1, 1
+	i := 0
+	for i < len(expected) && i < len(actual) && expected[i] == actual[i] {
+		if expected[i] == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+		i++
+	}
+	return fmt.Errorf("the output differs at line %d, column %d: expected %q, got %q (expected %d bytes, got %d)",
+		line, column, excerpt(expected, i), excerpt(actual, i), len(expected), len(actual))
+}
+
+// excerpt returns up to 40 bytes of b, starting at i
+func excerpt(b []byte, i int) string {
+	end := i + 40
+	if end > len(b) {
+		end = len(b)
+	}
+	return string(b[i:end])
+}
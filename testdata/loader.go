@@ -7,16 +7,21 @@ import (
 )
 
 // LoadExampleAnalyseRequest reads the example request from exampleAnalyseRequest.json
-func LoadExampleAnalyseRequest(t *testing.T) []byte {
+func LoadExampleAnalyseRequest(t testing.TB) []byte {
 	return loadTestdata(t, "exampleAnalyseRequest.json")
 }
 
 // LoadExampleRequest reads the example request from exampleRequest.json
-func LoadExampleRequest(t *testing.T) []byte {
+func LoadExampleRequest(t testing.TB) []byte {
 	return loadTestdata(t, "exampleRequest.json")
 }
 
-func loadTestdata(t *testing.T, name string) []byte {
+// LoadExampleXLSX reads the example spreadsheet from exampleAnalyse.xlsx
+func LoadExampleXLSX(t testing.TB) []byte {
+	return loadTestdata(t, "exampleAnalyse.xlsx")
+}
+
+func loadTestdata(t testing.TB, name string) []byte {
 	path := filepath.Join("../testdata", name) // relative path
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -0,0 +1,25 @@
+package testdata
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// CountElements unmarshals the svg, returning the number of elements with each name
+func CountElements(svg string) (map[string]int, error) {
+	counts := make(map[string]int)
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return counts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			counts[start.Name.Local]++
+		}
+	}
+}
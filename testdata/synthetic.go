@@ -0,0 +1,85 @@
+package testdata
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/rubenv/topojson"
+)
+
+// SyntheticGeography is a generated topology of square features arranged in a grid, with a value for each feature.
+// Each feature has a code property (its id) and a name property.
+type SyntheticGeography struct {
+	Topology *topojson.Topology
+	IDs      []string  // the id of each feature
+	Values   []float64 // the value of each feature, in the same order as IDs
+}
+
+// syntheticCellSize is the width and height (in degrees) of each feature in a SyntheticGeography
+const syntheticCellSize = 0.01
+
+// GenerateGeography returns a SyntheticGeography with the given number of features, each with pointsPerFeature points (at least 4) in its boundary.
+// The values are exponentially distributed, to resemble real data. The same counts always generate the same geography.
+func GenerateGeography(features int, pointsPerFeature int) *SyntheticGeography {
+	if pointsPerFeature < 4 {
+		pointsPerFeature = 4
+	}
+	random := rand.New(rand.NewSource(1))
+	columns := int(math.Ceil(math.Sqrt(float64(features))))
+
+	geography := &SyntheticGeography{IDs: make([]string, features), Values: make([]float64, features)}
+	geometries := make([]*topojson.Geometry, features)
+	arcs := make([][][]float64, features)
+	for i := 0; i < features; i++ {
+		id := fmt.Sprintf("F%06d", i)
+		x := -3.0 + float64(i%columns)*syntheticCellSize
+		y := 51.0 + float64(i/columns)*syntheticCellSize
+		arcs[i] = squareRing(x, y, syntheticCellSize, pointsPerFeature)
+		geometries[i] = &topojson.Geometry{
+			ID:         id,
+			Type:       geojson.GeometryPolygon,
+			Properties: map[string]interface{}{"code": id, "name": fmt.Sprintf("Feature %d", i)},
+			Polygon:    [][]int{{i}},
+		}
+		geography.IDs[i] = id
+		geography.Values[i] = math.Round(random.ExpFloat64()*100) / 10
+	}
+	geography.Topology = &topojson.Topology{
+		Type:    "Topology",
+		Objects: map[string]*topojson.Geometry{"synthetic": {Type: geojson.GeometryCollection, Geometries: geometries}},
+		Arcs:    arcs,
+	}
+	return geography
+}
+
+// CSV returns the id and value of each feature as csv, without a header row
+func (g *SyntheticGeography) CSV() string {
+	var csv bytes.Buffer
+	for i, id := range g.IDs {
+		fmt.Fprintf(&csv, "%s,%g\n", id, g.Values[i])
+	}
+	return csv.String()
+}
+
+// squareRing returns the closed ring of points around the square with the given bottom left corner and size, spaced evenly along its sides
+func squareRing(x float64, y float64, size float64, points int) [][]float64 {
+	ring := make([][]float64, 0, points+1)
+	for i := 0; i < points; i++ {
+		d := 4 * float64(i) / float64(points) // the distance along the perimeter, in sides
+		side, t := int(d), (d-math.Floor(d))*size
+		switch side {
+		case 0:
+			ring = append(ring, []float64{x + t, y})
+		case 1:
+			ring = append(ring, []float64{x + size, y + t})
+		case 2:
+			ring = append(ring, []float64{x + size - t, y + size})
+		default:
+			ring = append(ring, []float64{x, y + size - t})
+		}
+	}
+	return append(ring, ring[0])
+}